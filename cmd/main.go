@@ -28,6 +28,10 @@ func NewSQLCompleter() *SQLCompleter {
 			"UPDATE", "SET", "DELETE", "CREATE", "TABLE", "DROP",
 			"AND", "OR", "NOT", "NULL", "TRUE", "FALSE", "INT",
 			"TEXT", "FLOAT", "BOOL", "VARCHAR", "PRIMARY", "KEY",
+			"UNIQUE", "INDEX", "ON", "EXPLAIN", "ANALYZE",
+			"JOIN", "INNER", "LEFT", "OUTER", "CROSS", "AS", "GROUP",
+			"BY", "HAVING", "ORDER", "ASC", "DESC", "LIMIT", "OFFSET",
+			"COUNT", "SUM", "AVG", "MIN", "MAX",
 		},
 	}
 }
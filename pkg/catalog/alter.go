@@ -0,0 +1,200 @@
+package catalog
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// SchemaChange describes the change an ALTER TABLE statement makes to a table
+type SchemaChange struct {
+	Action types.AlterAction
+
+	// Column is the column AlterAddColumn adds, Constraints the table constraints added
+	Column      parser.ColumnDefinition
+	Constraints []parser.TableConstraint
+
+	// ConstraintName is the constraint that AlterDropConstraint drops
+	ConstraintName string
+
+	// ColumnName is the column AlterDropColumn and AlterRenameColumn change
+	ColumnName string
+
+	// NewName is the new name of the column or, for AlterRenameTable, of the table
+	NewName string
+}
+
+// Columns gives the columns of a table after the change, checking that it can be made
+func (c SchemaChange) Columns(schema TableSchema) ([]parser.ColumnDefinition, error) {
+	columns := slices.Clone(schema.Columns())
+
+	switch c.Action {
+	case types.AlterAddColumn:
+		if schema.HasColumn(c.Column.Name()) {
+			return nil, fmt.Errorf("column '%s' already exists in table '%s'", c.Column.Name(), schema.Name())
+		}
+		if slices.Contains(c.Column.Constraints(), types.ConstraintPrimaryKey) ||
+			slices.ContainsFunc(c.Constraints, func(tc parser.TableConstraint) bool { return tc.Type == types.ConstraintPrimaryKey }) {
+			return nil, fmt.Errorf("cannot add a PRIMARY KEY column to table '%s'", schema.Name())
+		}
+		return append(columns, c.Column), nil
+
+	case types.AlterDropColumn:
+		i, err := columnIndex(schema, c.ColumnName)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(PrimaryKey(schema), c.ColumnName) {
+			return nil, fmt.Errorf("cannot drop primary key column '%s'", c.ColumnName)
+		}
+		if len(columns) == 1 {
+			return nil, fmt.Errorf("cannot drop the only column of table '%s'", schema.Name())
+		}
+		return slices.Delete(columns, i, i+1), nil
+
+	case types.AlterRenameColumn:
+		i, err := columnIndex(schema, c.ColumnName)
+		if err != nil {
+			return nil, err
+		}
+		if schema.HasColumn(c.NewName) {
+			return nil, fmt.Errorf("column '%s' already exists in table '%s'", c.NewName, schema.Name())
+		}
+		columns[i] = &renamedColumn{ColumnDefinition: columns[i], name: c.NewName}
+		return columns, nil
+	}
+	return columns, nil
+}
+
+// TableConstraints gives the table constraints after the change, checking and naming added ones
+func (c SchemaChange) TableConstraints(schema TableSchema, columns []parser.ColumnDefinition, tables func(string) (TableSchema, bool)) ([]parser.TableConstraint, error) {
+	constraints := schema.Constraints()
+
+	switch c.Action {
+	case types.AlterAddColumn:
+		return defineConstraints(schema.Name(), columns, constraints, c.Constraints, tables)
+
+	case types.AlterAddConstraint:
+		for _, constraint := range c.Constraints {
+			if constraint.Type == types.ConstraintPrimaryKey {
+				return nil, fmt.Errorf("cannot add a PRIMARY KEY to table '%s'", schema.Name())
+			}
+		}
+		return defineConstraints(schema.Name(), columns, constraints, c.Constraints, tables)
+
+	case types.AlterDropConstraint:
+		i := slices.IndexFunc(constraints, func(tc parser.TableConstraint) bool { return tc.Name == c.ConstraintName })
+		if i >= 0 {
+			return slices.Delete(slices.Clone(constraints), i, i+1), nil
+		}
+		for _, constraint := range UniqueConstraints(schema) {
+			if constraint.Name == c.ConstraintName {
+				return nil, fmt.Errorf("constraint '%s' of table '%s' is part of a column definition and cannot be dropped", c.ConstraintName, schema.Name())
+			}
+		}
+		return nil, fmt.Errorf("constraint '%s' of table '%s' does not exist", c.ConstraintName, schema.Name())
+
+	case types.AlterDropColumn:
+		var result []parser.TableConstraint
+		for _, constraint := range constraints {
+			if !slices.Contains(constraint.Columns, c.ColumnName) {
+				result = append(result, constraint)
+			}
+		}
+		return result, nil
+
+	case types.AlterRenameColumn:
+		result := make([]parser.TableConstraint, len(constraints))
+		for i, constraint := range constraints {
+			constraint.Columns, _ = c.RenameColumns(constraint.Columns)
+			if constraint.Check != nil {
+				constraint.Check = parser.RenameColumn(constraint.Check, c.ColumnName, c.NewName)
+			}
+			result[i] = constraint
+		}
+		return result, nil
+	}
+	return constraints, nil
+}
+
+// columnIndex finds the position of a column in a table
+func columnIndex(schema TableSchema, name string) (int, error) {
+	for i, col := range schema.Columns() {
+		if col.Name() == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("column '%s' does not exist in table '%s'", name, schema.Name())
+}
+
+// RenameColumns returns the columns of an index after the change, or false if the index goes away
+func (c SchemaChange) RenameColumns(columns []string) ([]string, bool) {
+	switch c.Action {
+	case types.AlterDropColumn:
+		return columns, !slices.Contains(columns, c.ColumnName)
+	case types.AlterRenameColumn:
+		renamed := slices.Clone(columns)
+		for i, col := range renamed {
+			if col == c.ColumnName {
+				renamed[i] = c.NewName
+			}
+		}
+		return renamed, true
+	}
+	return columns, true
+}
+
+// RenameIndex returns an index after the change, or false if it covers a dropped column
+func (c SchemaChange) RenameIndex(index Index) (Index, bool) {
+	if index.Expressions == nil {
+		columns, ok := c.RenameColumns(index.Columns)
+		index.Columns = columns
+		return index, ok
+	}
+	switch c.Action {
+	case types.AlterDropColumn:
+		return index, !index.Reads(c.ColumnName)
+	case types.AlterRenameColumn:
+		columns, _ := c.RenameColumns(index.Columns)
+		expressions := slices.Clone(index.Expressions)
+		for i, expr := range expressions {
+			if expr != nil {
+				expressions[i] = parser.RenameColumn(expr, c.ColumnName, c.NewName)
+				columns[i] = fmt.Sprint(expressions[i])
+			}
+		}
+		index.Columns, index.Expressions = columns, expressions
+	}
+	return index, true
+}
+
+// Stats carries the statistics of a table over the change
+func (c SchemaChange) Stats(stats TableStats) TableStats {
+	if c.Action != types.AlterDropColumn && c.Action != types.AlterRenameColumn {
+		return stats
+	}
+	columns := make(map[string]ColumnStats, len(stats.Columns))
+	for name, colStats := range stats.Columns {
+		if name == c.ColumnName {
+			if c.Action == types.AlterDropColumn {
+				continue
+			}
+			name = c.NewName
+		}
+		columns[name] = colStats
+	}
+	stats.Columns = columns
+	return stats
+}
+
+// renamedColumn is a column definition under a new name
+type renamedColumn struct {
+	parser.ColumnDefinition
+	name string
+}
+
+func (c *renamedColumn) Name() string {
+	return c.name
+}
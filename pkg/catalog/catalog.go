@@ -2,6 +2,8 @@ package catalog
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
@@ -10,19 +12,21 @@ import (
 
 // MemoryCatalog is an in-memory implementation of the Catalog interface
 type MemoryCatalog struct {
-	tables map[string]TableSchema
-	mu     sync.RWMutex
+	tables  map[string]TableSchema
+	indexes map[string]Index
+	mu      sync.RWMutex
 }
 
 // NewCatalog creates a new memory catalog
 func NewCatalog() Catalog {
 	return &MemoryCatalog{
-		tables: make(map[string]TableSchema),
+		tables:  make(map[string]TableSchema),
+		indexes: make(map[string]Index),
 	}
 }
 
 // CreateTable creates a new table schema
-func (c *MemoryCatalog) CreateTable(name string, columns []parser.ColumnDefinition) error {
+func (c *MemoryCatalog) CreateTable(name string, columns []parser.ColumnDefinition, constraints ...parser.TableConstraint) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -30,14 +34,31 @@ func (c *MemoryCatalog) CreateTable(name string, columns []parser.ColumnDefiniti
 		return errors.New("table already exists")
 	}
 
-	c.tables[name] = &memoryTableSchema{
-		name:    name,
-		columns: columns,
+	constraints, err := defineConstraints(name, columns, nil, constraints, c.lookupTable)
+	if err != nil {
+		return err
+	}
+	schema := &memoryTableSchema{
+		name:        name,
+		columns:     columns,
+		constraints: constraints,
+	}
+	for _, index := range KeyIndexes(schema) {
+		if c.indexNameInUse(index.Name) {
+			return fmt.Errorf("index '%s' already exists", index.Name)
+		}
 	}
 
+	c.tables[name] = schema
 	return nil
 }
 
+// lookupTable finds a table for checking foreign keys; the caller holds the lock
+func (c *MemoryCatalog) lookupTable(name string) (TableSchema, bool) {
+	schema, ok := c.tables[name]
+	return schema, ok
+}
+
 // DropTable removes a table schema
 func (c *MemoryCatalog) DropTable(name string) error {
 	c.mu.Lock()
@@ -46,8 +67,123 @@ func (c *MemoryCatalog) DropTable(name string) error {
 	if _, exists := c.tables[name]; !exists {
 		return errors.New("table does not exist")
 	}
+	names := make([]string, 0, len(c.tables))
+	for tableName := range c.tables {
+		names = append(names, tableName)
+	}
+	sort.Strings(names)
+	for _, tableName := range names {
+		for _, fk := range ForeignKeys(c.tables[tableName]) {
+			if fk.RefTable == name && tableName != name {
+				return fmt.Errorf("cannot drop table '%s' referenced by constraint '%s' of table '%s'", name, fk.Name, tableName)
+			}
+		}
+	}
 
 	delete(c.tables, name)
+
+	// Indexes go away with their table
+	for indexName, index := range c.indexes {
+		if index.Table == name {
+			delete(c.indexes, indexName)
+		}
+	}
+
+	return nil
+}
+
+// AlterTable changes the schema of a table
+func (c *MemoryCatalog) AlterTable(name string, change SchemaChange) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	schema, exists := c.tables[name]
+	if !exists {
+		return errors.New("table does not exist")
+	}
+	columns, err := change.Columns(schema)
+	if err != nil {
+		return err
+	}
+	constraints, err := change.TableConstraints(schema, columns, c.lookupTable)
+	if err != nil {
+		return err
+	}
+
+	newName := name
+	if change.Action == types.AlterRenameTable {
+		if _, exists := c.tables[change.NewName]; exists {
+			return errors.New("table already exists")
+		}
+		newName = change.NewName
+	}
+	altered := &memoryTableSchema{
+		name:        newName,
+		columns:     columns,
+		constraints: constraints,
+		version:     schema.Version() + 1,
+	}
+	if stats, ok := schema.Stats(); ok {
+		stats = change.Stats(stats)
+		altered.stats = &stats
+	}
+
+	// The indexes of new or renamed constraints need names of their own
+	oldIndexes := make(map[string]bool)
+	for _, index := range KeyIndexes(schema) {
+		oldIndexes[index.Name] = true
+	}
+	for _, index := range KeyIndexes(altered) {
+		if !oldIndexes[index.Name] && c.indexNameInUse(index.Name) {
+			return fmt.Errorf("index '%s' already exists", index.Name)
+		}
+	}
+
+	// Foreign keys that reference the table follow it, in the table itself
+	// as well as in others
+	if altered.constraints, _, err = followReferences(altered.constraints, name, altered, change); err != nil {
+		return err
+	}
+	referencing := make(map[string]*memoryTableSchema)
+	for tableName, other := range c.tables {
+		if tableName == name {
+			continue
+		}
+		constraints, references, err := followReferences(other.Constraints(), name, altered, change)
+		if err != nil {
+			return err
+		}
+		if references {
+			referencing[tableName] = &memoryTableSchema{
+				name:        tableName,
+				columns:     other.Columns(),
+				constraints: constraints,
+				version:     other.Version(),
+			}
+			if stats, ok := other.Stats(); ok {
+				referencing[tableName].stats = &stats
+			}
+		}
+	}
+	for tableName, other := range referencing {
+		c.tables[tableName] = other
+	}
+
+	for indexName, index := range c.indexes {
+		if index.Table != name {
+			continue
+		}
+		index, ok := change.RenameIndex(index)
+		if !ok {
+			delete(c.indexes, indexName)
+			continue
+		}
+		index.Table = newName
+		c.indexes[indexName] = index
+	}
+
+	delete(c.tables, name)
+	c.tables[newName] = altered
 	return nil
 }
 
@@ -73,10 +209,146 @@ func (c *MemoryCatalog) ListTables() []string {
 	return tableNames
 }
 
+// CreateIndex registers a new index
+func (c *MemoryCatalog) CreateIndex(index Index) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	schema, exists := c.tables[index.Table]
+	if !exists {
+		return fmt.Errorf("table '%s' does not exist", index.Table)
+	}
+
+	if c.indexNameInUse(index.Name) {
+		return fmt.Errorf("index '%s' already exists", index.Name)
+	}
+
+	if len(index.Columns) == 0 {
+		return errors.New("index must have at least one column")
+	}
+	seen := make(map[string]bool)
+	for i, col := range index.Columns {
+		if expr := index.Expression(i); expr != nil {
+			for _, exprCol := range parser.ColumnsOf(expr) {
+				if !schema.HasColumn(exprCol) {
+					return fmt.Errorf("column '%s' does not exist in table '%s'", exprCol, index.Table)
+				}
+			}
+		} else if !schema.HasColumn(col) {
+			return fmt.Errorf("column '%s' does not exist in table '%s'", col, index.Table)
+		}
+		if seen[col] {
+			return fmt.Errorf("column '%s' appears more than once in index", col)
+		}
+		seen[col] = true
+	}
+
+	c.indexes[index.Name] = index
+	return nil
+}
+
+// indexNameInUse reports whether an index name is taken; the caller must hold c.mu
+func (c *MemoryCatalog) indexNameInUse(name string) bool {
+	if _, exists := c.indexes[name]; exists {
+		return true
+	}
+	for _, schema := range c.tables {
+		for _, index := range KeyIndexes(schema) {
+			if index.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DropIndex removes an index created with CreateIndex
+func (c *MemoryCatalog) DropIndex(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.indexes[name]; !exists {
+		if c.indexNameInUse(name) {
+			return fmt.Errorf("index '%s' backs a constraint and cannot be dropped", name)
+		}
+		return fmt.Errorf("index '%s' does not exist", name)
+	}
+
+	delete(c.indexes, name)
+	return nil
+}
+
+// GetIndex retrieves an index by name
+func (c *MemoryCatalog) GetIndex(name string) (Index, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if index, ok := c.indexes[name]; ok {
+		return index, true
+	}
+	for _, schema := range c.tables {
+		for _, index := range KeyIndexes(schema) {
+			if index.Name == name {
+				return index, true
+			}
+		}
+	}
+	return Index{}, false
+}
+
+// TableIndexes lists the indexes of a table, constraint indexes first and primary key leading
+func (c *MemoryCatalog) TableIndexes(tableName string) []Index {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	schema, exists := c.tables[tableName]
+	if !exists {
+		return nil
+	}
+
+	result := KeyIndexes(schema)
+
+	var others []Index
+	for _, index := range c.indexes {
+		if index.Table == tableName {
+			others = append(others, index)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Name < others[j].Name
+	})
+
+	return append(result, others...)
+}
+
+// SetTableStats records the statistics of a table
+func (c *MemoryCatalog) SetTableStats(tableName string, stats TableStats) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	schema, exists := c.tables[tableName]
+	if !exists {
+		return fmt.Errorf("table '%s' does not exist", tableName)
+	}
+
+	// Schemas handed out earlier are left untouched
+	c.tables[tableName] = &memoryTableSchema{
+		name:        schema.Name(),
+		columns:     schema.Columns(),
+		constraints: schema.Constraints(),
+		stats:       &stats,
+		version:     schema.Version(),
+	}
+	return nil
+}
+
 // memoryTableSchema is an in-memory implementation of the TableSchema interface
 type memoryTableSchema struct {
-	name    string
-	columns []parser.ColumnDefinition
+	name        string
+	columns     []parser.ColumnDefinition
+	constraints []parser.TableConstraint
+	stats       *TableStats
+	version     int
 }
 
 // Name returns the table name
@@ -113,3 +385,21 @@ func (s *memoryTableSchema) GetColumnType(name string) types.DataType {
 	}
 	return col.Type()
 }
+
+// Constraints returns the named, multi-column and CHECK constraints
+func (s *memoryTableSchema) Constraints() []parser.TableConstraint {
+	return s.constraints
+}
+
+// Stats returns the statistics of the table, if it has been analyzed
+func (s *memoryTableSchema) Stats() (TableStats, bool) {
+	if s.stats == nil {
+		return TableStats{}, false
+	}
+	return *s.stats, true
+}
+
+// Version counts the times the table has been altered
+func (s *memoryTableSchema) Version() int {
+	return s.version
+}
@@ -1,6 +1,8 @@
 package catalog
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
@@ -26,6 +28,22 @@ func (m *mockColumnDefinition) Constraints() []types.Constraint {
 	return m.constraints
 }
 
+func (m *mockColumnDefinition) TypeParams() []int {
+	return nil
+}
+
+func (m *mockColumnDefinition) TypeName() string {
+	return m.dataType.String()
+}
+
+func (m *mockColumnDefinition) Collation() parser.Collation {
+	return parser.CollateBinary
+}
+
+func (m *mockColumnDefinition) Default() parser.Expression {
+	return nil
+}
+
 func TestMemoryCatalog(t *testing.T) {
 	cat := NewCatalog()
 
@@ -126,3 +144,417 @@ func TestMemoryCatalog(t *testing.T) {
 		t.Errorf("DropTable() with non-existent table should error")
 	}
 }
+
+func TestMemoryCatalog_Indexes(t *testing.T) {
+	cat := NewCatalog()
+
+	cols := []parser.ColumnDefinition{
+		&mockColumnDefinition{
+			name:        "id",
+			dataType:    types.TypeInt,
+			constraints: []types.Constraint{types.ConstraintPrimaryKey},
+		},
+		&mockColumnDefinition{
+			name:        "email",
+			dataType:    types.TypeString,
+			constraints: []types.Constraint{types.ConstraintUnique},
+		},
+		&mockColumnDefinition{
+			name:     "age",
+			dataType: types.TypeInt,
+		},
+	}
+	if err := cat.CreateTable("users", cols); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	err := cat.CreateIndex(Index{Name: "users_age", Table: "users", Columns: []string{"age"}})
+	if err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+
+	indexes := cat.TableIndexes("users")
+	wantNames := []string{"users_pkey", "users_email_key", "users_age"}
+	if len(indexes) != len(wantNames) {
+		t.Fatalf("TableIndexes() returned %d indexes, want %d", len(indexes), len(wantNames))
+	}
+	for i, name := range wantNames {
+		if indexes[i].Name != name {
+			t.Errorf("TableIndexes()[%d] = %s, want %s", i, indexes[i].Name, name)
+		}
+	}
+	if !indexes[0].Primary || !indexes[0].Unique || !indexes[1].Unique || indexes[2].Unique {
+		t.Errorf("TableIndexes() flags are wrong: %+v", indexes)
+	}
+
+	invalid := []Index{
+		{Name: "users_age", Table: "users", Columns: []string{"id"}},
+		{Name: "users_pkey", Table: "users", Columns: []string{"age"}},
+		{Name: "users_missing", Table: "users", Columns: []string{"missing"}},
+		{Name: "orders_id", Table: "orders", Columns: []string{"id"}},
+		{Name: "users_none", Table: "users"},
+	}
+	for _, index := range invalid {
+		if err := cat.CreateIndex(index); err == nil {
+			t.Errorf("CreateIndex(%s) error = nil, want error", index.Name)
+		}
+	}
+
+	// An expression index computes its key from the columns of a row
+	emailLength, err := parser.ParseExpression("LENGTH(email)")
+	if err != nil {
+		t.Fatalf("ParseExpression() error = %v", err)
+	}
+	expressionIndex := Index{Name: "users_email_length", Table: "users", Columns: []string{"age", "LENGTH(email)"}, Expressions: []parser.Expression{nil, emailLength}}
+	if err := cat.CreateIndex(expressionIndex); err != nil {
+		t.Fatalf("CreateIndex() of an expression index error = %v", err)
+	}
+	row := map[string]parser.Value{"age": parser.NewIntValue(30), "email": parser.NewStringValue("a@b.c")}
+	if got := fmt.Sprint(expressionIndex.KeyValues(row)); got != "[30 5]" {
+		t.Errorf("KeyValues() = %s, want [30 5]", got)
+	}
+	if !expressionIndex.Reads("email") || expressionIndex.Reads("id") {
+		t.Errorf("Reads() does not follow the columns of the expression")
+	}
+	renamed, ok := SchemaChange{Action: types.AlterRenameColumn, ColumnName: "email", NewName: "mail"}.RenameIndex(expressionIndex)
+	if !ok || fmt.Sprint(renamed.Columns) != "[age LENGTH(mail)]" || !renamed.Reads("mail") {
+		t.Errorf("RenameIndex() = %v, %v", renamed.Columns, ok)
+	}
+	if _, ok := (SchemaChange{Action: types.AlterDropColumn, ColumnName: "email"}).RenameIndex(expressionIndex); ok {
+		t.Errorf("RenameIndex() kept an index on a dropped column")
+	}
+	missing := Index{Name: "users_missing_length", Table: "users", Columns: []string{"LENGTH(missing)"}, Expressions: []parser.Expression{parser.RenameColumn(emailLength, "email", "missing")}}
+	if err := cat.CreateIndex(missing); err == nil {
+		t.Errorf("CreateIndex() on an expression of a missing column error = nil, want error")
+	}
+
+	if _, found := cat.GetIndex("users_email_key"); !found {
+		t.Errorf("GetIndex() did not find the constraint index")
+	}
+	if err := cat.DropIndex("users_pkey"); err == nil {
+		t.Errorf("DropIndex() on a constraint index error = nil, want error")
+	}
+
+	// Dropping the table drops its indexes
+	if err := cat.DropTable("users"); err != nil {
+		t.Fatalf("DropTable() error = %v", err)
+	}
+	if _, found := cat.GetIndex("users_age"); found {
+		t.Errorf("GetIndex() found an index of a dropped table")
+	}
+}
+
+func TestMemoryCatalog_TableStats(t *testing.T) {
+	cat := NewCatalog()
+
+	cols := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt},
+	}
+	if err := cat.CreateTable("users", cols); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	before, _ := cat.GetTable("users")
+	if _, ok := before.Stats(); ok {
+		t.Errorf("Stats() of a table that was never analyzed ok = true")
+	}
+
+	stats := TableStats{
+		RowCount: 3,
+		Columns: map[string]ColumnStats{
+			"id": {DistinctCount: 3, Histogram: []parser.Value{parser.NewIntValue(1), parser.NewIntValue(3)}},
+		},
+	}
+	if err := cat.SetTableStats("users", stats); err != nil {
+		t.Fatalf("SetTableStats() error = %v", err)
+	}
+	if err := cat.SetTableStats("orders", stats); err == nil {
+		t.Errorf("SetTableStats() on a missing table error = nil, want error")
+	}
+
+	schema, _ := cat.GetTable("users")
+	got, ok := schema.Stats()
+	if !ok || got.RowCount != 3 || got.Columns["id"].DistinctCount != 3 {
+		t.Errorf("Stats() = %+v, %v", got, ok)
+	}
+	if !schema.HasColumn("id") {
+		t.Errorf("the analyzed schema lost its columns")
+	}
+	if _, ok := before.Stats(); ok {
+		t.Errorf("SetTableStats() changed a schema retrieved earlier")
+	}
+}
+
+func TestMemoryCatalog_AlterTable(t *testing.T) {
+	cat := NewCatalog()
+
+	cols := []parser.ColumnDefinition{
+		&mockColumnDefinition{
+			name:        "id",
+			dataType:    types.TypeInt,
+			constraints: []types.Constraint{types.ConstraintPrimaryKey},
+		},
+		&mockColumnDefinition{name: "email", dataType: types.TypeString},
+		&mockColumnDefinition{name: "age", dataType: types.TypeInt},
+	}
+	if err := cat.CreateTable("users", cols); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := cat.CreateIndex(Index{Name: "users_email_age", Table: "users", Columns: []string{"email", "age"}}); err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+	if err := cat.CreateIndex(Index{Name: "users_age", Table: "users", Columns: []string{"age"}}); err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+	stats := TableStats{RowCount: 2, Columns: map[string]ColumnStats{"email": {DistinctCount: 2}, "age": {DistinctCount: 1}}}
+	if err := cat.SetTableStats("users", stats); err != nil {
+		t.Fatalf("SetTableStats() error = %v", err)
+	}
+	before, _ := cat.GetTable("users")
+
+	changes := []SchemaChange{
+		{Action: types.AlterAddColumn, Column: &mockColumnDefinition{name: "city", dataType: types.TypeString, constraints: []types.Constraint{types.ConstraintUnique}}},
+		{Action: types.AlterRenameColumn, ColumnName: "email", NewName: "mail"},
+		{Action: types.AlterDropColumn, ColumnName: "age"},
+		{Action: types.AlterRenameTable, NewName: "people"},
+	}
+	table := "users"
+	for _, change := range changes {
+		if err := cat.AlterTable(table, change); err != nil {
+			t.Fatalf("AlterTable(%+v) error = %v", change, err)
+		}
+		if change.Action == types.AlterRenameTable {
+			table = change.NewName
+		}
+	}
+
+	schema, ok := cat.GetTable("people")
+	if !ok || schema.Version() != 4 {
+		t.Fatalf("GetTable() after ALTER TABLE = %v, %v", schema, ok)
+	}
+	var names []string
+	for _, col := range schema.Columns() {
+		names = append(names, col.Name())
+	}
+	if strings.Join(names, ",") != "id,mail,city" {
+		t.Errorf("Columns() = %v, want [id mail city]", names)
+	}
+	if _, ok := cat.GetTable("users"); ok || before.Version() != 0 || !before.HasColumn("email") {
+		t.Errorf("ALTER TABLE changed a schema retrieved earlier or left the old name")
+	}
+
+	// Indexes follow their columns, and go away with a dropped one
+	var indexes []string
+	for _, index := range cat.TableIndexes("people") {
+		indexes = append(indexes, index.Name+"("+strings.Join(index.Columns, ",")+")")
+	}
+	if got := strings.Join(indexes, " "); got != "people_pkey(id) people_city_key(city)" {
+		t.Errorf("TableIndexes() = %s", got)
+	}
+	if got, _ := schema.Stats(); got.RowCount != 2 || len(got.Columns) != 1 || got.Columns["mail"].DistinctCount != 2 {
+		t.Errorf("Stats() after ALTER TABLE = %+v", got)
+	}
+
+	invalid := []SchemaChange{
+		{Action: types.AlterAddColumn, Column: &mockColumnDefinition{name: "mail", dataType: types.TypeString}},
+		{Action: types.AlterAddColumn, Column: &mockColumnDefinition{name: "key", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}}},
+		{Action: types.AlterDropColumn, ColumnName: "id"},
+		{Action: types.AlterDropColumn, ColumnName: "age"},
+		{Action: types.AlterRenameColumn, ColumnName: "mail", NewName: "city"},
+		{Action: types.AlterRenameTable, NewName: "people"},
+	}
+	for _, change := range invalid {
+		if err := cat.AlterTable("people", change); err == nil {
+			t.Errorf("AlterTable(%+v) error = nil, want error", change)
+		}
+	}
+	if err := cat.AlterTable("users", changes[1]); err == nil {
+		t.Errorf("AlterTable() on a missing table error = nil, want error")
+	}
+}
+
+func TestMemoryCatalog_TableConstraints(t *testing.T) {
+	cat := NewCatalog()
+
+	check := func(cond string) parser.Expression {
+		t.Helper()
+		expr, err := parser.ParseExpression(cond)
+		if err != nil {
+			t.Fatalf("ParseExpression(%s) error = %v", cond, err)
+		}
+		return expr
+	}
+	cols := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt},
+		&mockColumnDefinition{name: "line", dataType: types.TypeInt},
+		&mockColumnDefinition{name: "sku", dataType: types.TypeString, constraints: []types.Constraint{types.ConstraintUnique}},
+		&mockColumnDefinition{name: "qty", dataType: types.TypeInt},
+	}
+	constraints := []parser.TableConstraint{
+		{Type: types.ConstraintPrimaryKey, Columns: []string{"id", "line"}},
+		{Type: types.ConstraintUnique, Columns: []string{"sku"}},
+		{Type: types.ConstraintCheck, Columns: []string{"qty"}, Check: check("qty > 0")},
+		{Type: types.ConstraintCheck, Columns: []string{"qty"}, Check: check("qty < 100")},
+		{Name: "sane", Type: types.ConstraintCheck, Columns: []string{"id", "qty"}, Check: check("id <> qty")},
+	}
+	if err := cat.CreateTable("orders", cols, constraints...); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	// Constraints without a name are named after their table and columns
+	schema, _ := cat.GetTable("orders")
+	var names []string
+	for _, c := range schema.Constraints() {
+		names = append(names, c.Name)
+	}
+	if got := strings.Join(names, " "); got != "orders_pkey orders_sku_key1 orders_qty_check orders_qty_check1 sane" {
+		t.Errorf("constraint names = %s", got)
+	}
+	if got := strings.Join(PrimaryKey(schema), ","); got != "id,line" {
+		t.Errorf("PrimaryKey() = %s, want id,line", got)
+	}
+	var indexes []string
+	for _, index := range cat.TableIndexes("orders") {
+		indexes = append(indexes, index.Name+"("+strings.Join(index.Columns, ",")+")")
+	}
+	if got := strings.Join(indexes, " "); got != "orders_pkey(id,line) orders_sku_key(sku) orders_sku_key1(sku)" {
+		t.Errorf("TableIndexes() = %s", got)
+	}
+
+	// Constraints follow a renamed column and go away with a dropped one
+	if err := cat.AlterTable("orders", SchemaChange{Action: types.AlterRenameColumn, ColumnName: "qty", NewName: "quantity"}); err != nil {
+		t.Fatalf("AlterTable() error = %v", err)
+	}
+	schema, _ = cat.GetTable("orders")
+	if c := schema.Constraints()[4]; strings.Join(c.Columns, ",") != "id,quantity" || fmt.Sprint(c.Check) != "id != quantity" {
+		t.Errorf("constraint after rename = %v %v", c.Columns, c.Check)
+	}
+	if err := cat.AlterTable("orders", SchemaChange{Action: types.AlterDropColumn, ColumnName: "quantity"}); err != nil {
+		t.Fatalf("AlterTable() error = %v", err)
+	}
+	schema, _ = cat.GetTable("orders")
+	if got := len(schema.Constraints()); got != 2 {
+		t.Errorf("constraints after drop = %d, want 2", got)
+	}
+
+	// Constraints added with a column are named and checked
+	added := SchemaChange{
+		Action:      types.AlterAddColumn,
+		Column:      &mockColumnDefinition{name: "note", dataType: types.TypeString},
+		Constraints: []parser.TableConstraint{{Type: types.ConstraintCheck, Columns: []string{"note"}, Check: check("note <> ''")}},
+	}
+	if err := cat.AlterTable("orders", added); err != nil {
+		t.Fatalf("AlterTable() error = %v", err)
+	}
+	schema, _ = cat.GetTable("orders")
+	if got := schema.Constraints()[2].Name; got != "orders_note_check" {
+		t.Errorf("name of added constraint = %s, want orders_note_check", got)
+	}
+
+	invalid := [][]parser.TableConstraint{
+		{{Type: types.ConstraintUnique, Columns: []string{"missing"}}},
+		{{Type: types.ConstraintUnique, Columns: []string{"id", "id"}}},
+		{{Type: types.ConstraintPrimaryKey, Columns: []string{"id"}}, {Type: types.ConstraintPrimaryKey, Columns: []string{"line"}}},
+		{{Name: "dup", Type: types.ConstraintUnique, Columns: []string{"id"}}, {Name: "dup", Type: types.ConstraintUnique, Columns: []string{"line"}}},
+		{{Name: "orders_pkey", Type: types.ConstraintUnique, Columns: []string{"id"}}},
+	}
+	for i, constraints := range invalid {
+		if err := cat.CreateTable(fmt.Sprintf("bad%d", i), cols, constraints...); err == nil {
+			t.Errorf("CreateTable(%+v) error = nil, want error", constraints)
+		}
+	}
+}
+
+func TestMemoryCatalog_ForeignKeys(t *testing.T) {
+	cat := NewCatalog()
+
+	err := cat.CreateTable("customers", []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+		&mockColumnDefinition{name: "email", dataType: types.TypeString},
+	}, parser.TableConstraint{Type: types.ConstraintUnique, Columns: []string{"email"}})
+	if err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	orderCols := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+		&mockColumnDefinition{name: "customer", dataType: types.TypeInt},
+		&mockColumnDefinition{name: "parent", dataType: types.TypeInt},
+	}
+	fks := []parser.TableConstraint{
+		{Type: types.ConstraintForeignKey, Columns: []string{"customer"}, RefTable: "customers", OnDelete: types.ActionCascade},
+		{Name: "sub", Type: types.ConstraintForeignKey, Columns: []string{"parent"}, RefTable: "orders", RefColumns: []string{"id"}},
+	}
+	if err := cat.CreateTable("orders", orderCols, fks...); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	// The referenced columns default to the primary key
+	schema, _ := cat.GetTable("orders")
+	var got []string
+	for _, fk := range ForeignKeys(schema) {
+		got = append(got, fmt.Sprintf("%s %v->%s%v", fk.Name, fk.Columns, fk.RefTable, fk.RefColumns))
+	}
+	if want := "orders_customer_fkey [customer]->customers[id] sub [parent]->orders[id]"; strings.Join(got, " ") != want {
+		t.Errorf("ForeignKeys() = %s, want %s", strings.Join(got, " "), want)
+	}
+	if refs := References(cat, "customers"); len(refs) != 1 || refs[0].Table != "orders" {
+		t.Errorf("References(customers) = %v", refs)
+	}
+
+	if err := cat.DropTable("customers"); err == nil {
+		t.Errorf("DropTable() of a referenced table succeeded")
+	}
+	err = cat.CreateTable("contacts", []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "email", dataType: types.TypeString},
+	}, parser.TableConstraint{Type: types.ConstraintForeignKey, Columns: []string{"email"}, RefTable: "customers", RefColumns: []string{"email"}})
+	if err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	for _, change := range []SchemaChange{
+		{Action: types.AlterDropColumn, ColumnName: "email"},
+		{Action: types.AlterDropConstraint, ConstraintName: "customers_email_key"},
+	} {
+		if err := cat.AlterTable("customers", change); err == nil {
+			t.Errorf("AlterTable(%v) took away a referenced key", change)
+		}
+	}
+	if err := cat.DropTable("contacts"); err != nil {
+		t.Fatalf("DropTable() error = %v", err)
+	}
+
+	// References follow a renamed table and column
+	if err := cat.AlterTable("customers", SchemaChange{Action: types.AlterRenameColumn, ColumnName: "id", NewName: "cid"}); err != nil {
+		t.Fatalf("AlterTable() error = %v", err)
+	}
+	if err := cat.AlterTable("customers", SchemaChange{Action: types.AlterRenameTable, NewName: "clients"}); err != nil {
+		t.Fatalf("AlterTable() error = %v", err)
+	}
+	if err := cat.AlterTable("orders", SchemaChange{Action: types.AlterRenameTable, NewName: "purchases"}); err != nil {
+		t.Fatalf("AlterTable() error = %v", err)
+	}
+	schema, _ = cat.GetTable("purchases")
+	got = nil
+	for _, fk := range ForeignKeys(schema) {
+		got = append(got, fmt.Sprintf("%s%v", fk.RefTable, fk.RefColumns))
+	}
+	if want := "clients[cid] purchases[id]"; strings.Join(got, " ") != want {
+		t.Errorf("references after rename = %s, want %s", strings.Join(got, " "), want)
+	}
+
+	invalid := []parser.TableConstraint{
+		{Type: types.ConstraintForeignKey, Columns: []string{"a"}, RefTable: "missing"},
+		{Type: types.ConstraintForeignKey, Columns: []string{"a"}, RefTable: "clients", RefColumns: []string{"email"}},
+		{Type: types.ConstraintForeignKey, Columns: []string{"a"}, RefTable: "purchases", RefColumns: []string{"customer"}},
+		{Type: types.ConstraintForeignKey, Columns: []string{"a", "b"}, RefTable: "clients"},
+	}
+	for _, fk := range invalid {
+		cols := []parser.ColumnDefinition{
+			&mockColumnDefinition{name: "a", dataType: types.TypeInt},
+			&mockColumnDefinition{name: "b", dataType: types.TypeInt},
+		}
+		if err := cat.CreateTable("bad", cols, fk); err == nil {
+			t.Errorf("CreateTable() with %v succeeded", fk)
+			cat.DropTable("bad")
+		}
+	}
+}
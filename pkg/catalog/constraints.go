@@ -0,0 +1,200 @@
+package catalog
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// UniqueConstraint describes a PRIMARY KEY or UNIQUE constraint on a table
+type UniqueConstraint struct {
+	// Name is the constraint name reported in violation errors
+	Name string
+
+	// Columns lists the constrained columns in key order
+	Columns []string
+
+	// PrimaryKey is true for the table's primary key
+	PrimaryKey bool
+}
+
+// Type returns the constraint kind
+func (c UniqueConstraint) Type() types.Constraint {
+	if c.PrimaryKey {
+		return types.ConstraintPrimaryKey
+	}
+	return types.ConstraintUnique
+}
+
+// PrimaryKeyName returns the name given to a table's primary key constraint
+func PrimaryKeyName(tableName string) string {
+	return tableName + "_pkey"
+}
+
+// UniqueKeyName returns the name given to a UNIQUE constraint
+func UniqueKeyName(tableName, columnName string) string {
+	return tableName + "_" + columnName + "_key"
+}
+
+// CheckName returns the name given to a CHECK constraint
+func CheckName(tableName string, columns []string) string {
+	if len(columns) == 1 {
+		return tableName + "_" + columns[0] + "_check"
+	}
+	return tableName + "_check"
+}
+
+// ForeignKeyName returns the name given to a FOREIGN KEY constraint
+func ForeignKeyName(tableName string, columns []string) string {
+	return tableName + "_" + strings.Join(columns, "_") + "_fkey"
+}
+
+// AutoIncrementSequence returns the sequence an AUTOINCREMENT column takes its values from
+func AutoIncrementSequence(col parser.ColumnDefinition) (string, bool) {
+	if !slices.Contains(col.Constraints(), types.ConstraintAutoIncrement) {
+		return "", false
+	}
+	seq, ok := col.Default().(parser.SequenceExpression)
+	if !ok {
+		return "", false
+	}
+	return seq.Sequence(), true
+}
+
+// UniqueConstraints returns the PRIMARY KEY and UNIQUE constraints of a table
+func UniqueConstraints(schema TableSchema) []UniqueConstraint {
+	var primaryKey []string
+	var result []UniqueConstraint
+
+	for _, col := range schema.Columns() {
+		for _, constraint := range col.Constraints() {
+			switch constraint {
+			case types.ConstraintPrimaryKey:
+				primaryKey = append(primaryKey, col.Name())
+			case types.ConstraintUnique:
+				result = append(result, UniqueConstraint{
+					Name:    UniqueKeyName(schema.Name(), col.Name()),
+					Columns: []string{col.Name()},
+				})
+			}
+		}
+	}
+
+	if len(primaryKey) > 0 {
+		pk := UniqueConstraint{
+			Name:       PrimaryKeyName(schema.Name()),
+			Columns:    primaryKey,
+			PrimaryKey: true,
+		}
+		result = append([]UniqueConstraint{pk}, result...)
+	}
+
+	for _, constraint := range schema.Constraints() {
+		switch constraint.Type {
+		case types.ConstraintPrimaryKey:
+			pk := UniqueConstraint{Name: constraint.Name, Columns: constraint.Columns, PrimaryKey: true}
+			result = append([]UniqueConstraint{pk}, result...)
+		case types.ConstraintUnique:
+			result = append(result, UniqueConstraint{Name: constraint.Name, Columns: constraint.Columns})
+		}
+	}
+
+	return result
+}
+
+// PrimaryKey returns the primary key columns of a table in key order
+func PrimaryKey(schema TableSchema) []string {
+	for _, constraint := range UniqueConstraints(schema) {
+		if constraint.PrimaryKey {
+			return constraint.Columns
+		}
+	}
+	return nil
+}
+
+// defineConstraints checks and names the constraints added to a table and returns all of them
+func defineConstraints(tableName string, columns []parser.ColumnDefinition, defined, added []parser.TableConstraint, tables func(string) (TableSchema, bool)) ([]parser.TableConstraint, error) {
+	schema := &memoryTableSchema{name: tableName, columns: columns, constraints: defined}
+	names := make(map[string]bool)
+	for _, constraint := range UniqueConstraints(schema) {
+		names[constraint.Name] = true
+	}
+	for _, constraint := range defined {
+		names[constraint.Name] = true
+	}
+	hasPrimaryKey := PrimaryKey(schema) != nil
+
+	result := slices.Clone(defined)
+	for _, constraint := range added {
+		for i, col := range constraint.Columns {
+			if !schema.HasColumn(col) {
+				return nil, fmt.Errorf("column '%s' does not exist in table '%s'", col, tableName)
+			}
+			if constraint.Type != types.ConstraintCheck && slices.Contains(constraint.Columns[:i], col) {
+				return nil, fmt.Errorf("column '%s' appears twice in a key of table '%s'", col, tableName)
+			}
+		}
+		if constraint.Type == types.ConstraintPrimaryKey {
+			if hasPrimaryKey {
+				return nil, fmt.Errorf("multiple primary keys for table '%s' are not allowed", tableName)
+			}
+			hasPrimaryKey = true
+		}
+
+		if constraint.Name == "" {
+			constraint.Name = unusedName(names, defaultConstraintName(tableName, constraint))
+		} else if names[constraint.Name] {
+			return nil, fmt.Errorf("constraint '%s' for table '%s' already exists", constraint.Name, tableName)
+		}
+		names[constraint.Name] = true
+		result = append(result, constraint)
+	}
+
+	// A foreign key can reference a key of its own table defined with it
+	defined = result
+	for i := len(result) - len(added); i < len(result); i++ {
+		if result[i].Type != types.ConstraintForeignKey {
+			continue
+		}
+		parent, ok := tables(result[i].RefTable)
+		if result[i].RefTable == tableName {
+			parent, ok = &memoryTableSchema{name: tableName, columns: columns, constraints: defined}, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("table '%s' referenced by constraint '%s' does not exist", result[i].RefTable, result[i].Name)
+		}
+		if err := resolveForeignKey(&result[i], schema, parent); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// defaultConstraintName returns the name a table constraint is given when it has none
+func defaultConstraintName(tableName string, constraint parser.TableConstraint) string {
+	switch constraint.Type {
+	case types.ConstraintPrimaryKey:
+		return PrimaryKeyName(tableName)
+	case types.ConstraintUnique:
+		return UniqueKeyName(tableName, strings.Join(constraint.Columns, "_"))
+	case types.ConstraintForeignKey:
+		return ForeignKeyName(tableName, constraint.Columns)
+	}
+	return CheckName(tableName, constraint.Columns)
+}
+
+// unusedName returns name, or name followed by the first number that makes it free
+func unusedName(taken map[string]bool, name string) string {
+	if !taken[name] {
+		return name
+	}
+	for i := 1; ; i++ {
+		if candidate := name + strconv.Itoa(i); !taken[candidate] {
+			return candidate
+		}
+	}
+}
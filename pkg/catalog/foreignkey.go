@@ -0,0 +1,107 @@
+package catalog
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// ForeignKey is a FOREIGN KEY constraint together with the table it is on
+type ForeignKey struct {
+	Table string
+	parser.TableConstraint
+}
+
+// ForeignKeys returns the FOREIGN KEY constraints of a table
+func ForeignKeys(schema TableSchema) []ForeignKey {
+	var result []ForeignKey
+	for _, constraint := range schema.Constraints() {
+		if constraint.Type == types.ConstraintForeignKey {
+			result = append(result, ForeignKey{Table: schema.Name(), TableConstraint: constraint})
+		}
+	}
+	return result
+}
+
+// References returns the foreign keys that reference a table, ordered by table name
+func References(cat Catalog, tableName string) []ForeignKey {
+	var result []ForeignKey
+	names := cat.ListTables()
+	slices.Sort(names)
+	for _, name := range names {
+		schema, ok := cat.GetTable(name)
+		if !ok {
+			continue
+		}
+		for _, fk := range ForeignKeys(schema) {
+			if fk.RefTable == tableName {
+				result = append(result, fk)
+			}
+		}
+	}
+	return result
+}
+
+// resolveForeignKey checks a foreign key against the table it references
+func resolveForeignKey(fk *parser.TableConstraint, schema, parent TableSchema) error {
+	if len(fk.RefColumns) == 0 {
+		fk.RefColumns = PrimaryKey(parent)
+		if fk.RefColumns == nil {
+			return fmt.Errorf("table '%s' referenced by constraint '%s' has no primary key", parent.Name(), fk.Name)
+		}
+	}
+	if len(fk.RefColumns) != len(fk.Columns) {
+		return fmt.Errorf("number of referencing and referenced columns for constraint '%s' do not match", fk.Name)
+	}
+	for i, col := range fk.Columns {
+		refCol := fk.RefColumns[i]
+		if !parent.HasColumn(refCol) {
+			return fmt.Errorf("column '%s' does not exist in table '%s'", refCol, parent.Name())
+		}
+		if schema.GetColumnType(col) != parent.GetColumnType(refCol) {
+			return fmt.Errorf("constraint '%s' cannot make column '%s' of type %v reference column '%s' of type %v",
+				fk.Name, col, schema.GetColumnType(col), refCol, parent.GetColumnType(refCol))
+		}
+	}
+	if !hasUniqueKey(parent, fk.RefColumns) {
+		return fmt.Errorf("there is no unique constraint matching given keys for referenced table '%s'", parent.Name())
+	}
+	return nil
+}
+
+// hasUniqueKey reports whether a PRIMARY KEY or UNIQUE constraint covers exactly the columns
+func hasUniqueKey(schema TableSchema, columns []string) bool {
+	for _, constraint := range UniqueConstraints(schema) {
+		if len(constraint.Columns) == len(columns) &&
+			!slices.ContainsFunc(columns, func(col string) bool { return !slices.Contains(constraint.Columns, col) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// followReferences makes the foreign keys that reference a changed table follow the change
+func followReferences(constraints []parser.TableConstraint, tableName string, parent TableSchema, change SchemaChange) ([]parser.TableConstraint, bool, error) {
+	result := slices.Clone(constraints)
+	references := false
+	for i, constraint := range result {
+		if constraint.Type != types.ConstraintForeignKey || constraint.RefTable != tableName {
+			continue
+		}
+		refColumns, ok := change.RenameColumns(constraint.RefColumns)
+		if !ok {
+			return nil, false, fmt.Errorf("cannot drop column '%s' of table '%s' referenced by constraint '%s'",
+				change.ColumnName, tableName, constraint.Name)
+		}
+		if !hasUniqueKey(parent, refColumns) {
+			return nil, false, fmt.Errorf("constraint '%s' needs a unique key on (%s) of table '%s'",
+				constraint.Name, strings.Join(refColumns, ", "), tableName)
+		}
+		result[i].RefTable, result[i].RefColumns = parent.Name(), refColumns
+		references = true
+	}
+	return result, references, nil
+}
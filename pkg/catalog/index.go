@@ -0,0 +1,92 @@
+package catalog
+
+import (
+	"slices"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+)
+
+// Index describes an index on a table
+type Index struct {
+	// Name identifies the index across the database
+	Name string
+
+	// Table is the indexed table
+	Table string
+
+	// Columns lists the key parts in order, naming an expression part by its text
+	Columns []string
+
+	// Expressions holds the expression of each expression key part, nil for a column
+	Expressions []parser.Expression
+
+	// Unique is true when no two rows may share a non-NULL key
+	Unique bool
+
+	// Primary is true for the index on the table's primary key
+	Primary bool
+
+	// Constraint is true when the index backs a PRIMARY KEY or UNIQUE constraint
+	Constraint bool
+}
+
+// KeyValues gives the key of a row in the index, with NULL for an expression that fails
+func (index Index) KeyValues(row map[string]parser.Value) []parser.Value {
+	values := make([]parser.Value, len(index.Columns))
+	for i, colName := range index.Columns {
+		if expr := index.Expression(i); expr != nil {
+			val, err := expr.Eval(nil, row)
+			if err != nil {
+				val = parser.NewNullValue()
+			}
+			values[i] = val
+			continue
+		}
+		values[i] = row[colName]
+	}
+	return values
+}
+
+// Expression returns the expression of key part i, nil for a column
+func (index Index) Expression(i int) parser.Expression {
+	if index.Expressions == nil {
+		return nil
+	}
+	return index.Expressions[i]
+}
+
+// Reads reports whether the key of the index depends on a column
+func (index Index) Reads(column string) bool {
+	for i, colName := range index.Columns {
+		if expr := index.Expression(i); expr != nil {
+			if slices.Contains(parser.ColumnsOf(expr), column) {
+				return true
+			}
+		} else if colName == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Index returns the index that enforces the constraint
+func (c UniqueConstraint) Index(tableName string) Index {
+	return Index{
+		Name:       c.Name,
+		Table:      tableName,
+		Columns:    c.Columns,
+		Unique:     true,
+		Primary:    c.PrimaryKey,
+		Constraint: true,
+	}
+}
+
+// KeyIndexes returns the indexes that back the PRIMARY KEY and UNIQUE constraints of a table
+func KeyIndexes(schema TableSchema) []Index {
+	constraints := UniqueConstraints(schema)
+	indexes := make([]Index, len(constraints))
+	for i, constraint := range constraints {
+		indexes[i] = constraint.Index(schema.Name())
+	}
+	return indexes
+}
@@ -7,17 +7,43 @@ import (
 
 // Catalog manages table schemas
 type Catalog interface {
-	// CreateTable creates a new table schema
-	CreateTable(name string, columns []parser.ColumnDefinition) error
+	// CreateTable creates a new table schema. The constraints are the
+	// PRIMARY KEY, UNIQUE, CHECK and FOREIGN KEY constraints given apart
+	// from the plain column constraints; those without a name are given
+	// one.
+	CreateTable(name string, columns []parser.ColumnDefinition, constraints ...parser.TableConstraint) error
 
-	// DropTable removes a table schema
+	// DropTable removes a table schema. A table that other tables
+	// reference cannot be dropped.
 	DropTable(name string) error
 
+	// AlterTable changes the schema of a table, giving it the next version.
+	// Indexes follow the columns they cover, and go away with them; the
+	// foreign keys of other tables follow the table and its columns.
+	AlterTable(name string, change SchemaChange) error
+
 	// GetTable retrieves a table schema
 	GetTable(name string) (TableSchema, bool)
 
 	// ListTables lists all available tables
 	ListTables() []string
+
+	// CreateIndex registers a new index
+	CreateIndex(index Index) error
+
+	// DropIndex removes an index created with CreateIndex
+	DropIndex(name string) error
+
+	// GetIndex retrieves an index by name
+	GetIndex(name string) (Index, bool)
+
+	// TableIndexes lists the indexes of a table, including the ones that
+	// back its PRIMARY KEY and UNIQUE constraints
+	TableIndexes(tableName string) []Index
+
+	// SetTableStats records the statistics of a table, replacing any
+	// collected before
+	SetTableStats(tableName string, stats TableStats) error
 }
 
 // TableSchema represents a table's schema
@@ -36,4 +62,15 @@ type TableSchema interface {
 
 	// GetColumnType gets the data type of a column
 	GetColumnType(name string) types.DataType
+
+	// Constraints returns the named, multi-column and CHECK constraints of
+	// the table, which the plain column constraints do not cover
+	Constraints() []parser.TableConstraint
+
+	// Stats returns the statistics of the table, if it has been analyzed
+	Stats() (TableStats, bool)
+
+	// Version counts the times the table has been altered since it was
+	// created, so a schema can be told from older ones of the same table
+	Version() int
 }
@@ -0,0 +1,24 @@
+package catalog
+
+import "github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+
+// TableStats are the statistics ANALYZE collects about the rows of a table
+type TableStats struct {
+	// RowCount is the number of rows in the table
+	RowCount int64
+
+	// Columns holds the statistics of each column by column name
+	Columns map[string]ColumnStats
+}
+
+// ColumnStats describes the values stored in one column
+type ColumnStats struct {
+	// DistinctCount is the number of distinct non-NULL values
+	DistinctCount int64
+
+	// NullFraction is the fraction of rows in which the column is NULL
+	NullFraction float64
+
+	// Histogram holds the bucket bounds of an equi-depth histogram of the non-NULL values
+	Histogram []parser.Value
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
@@ -13,10 +14,11 @@ import (
 
 // DB represents an in-memory database instance
 type DB struct {
-	parser   parser.Parser
-	catalog  catalog.Catalog
-	storage  storage.Storage
-	executor *executor.Executor
+	parser    parser.Parser
+	functions *parser.FunctionRegistry
+	catalog   catalog.Catalog
+	storage   storage.Storage
+	executor  *executor.Executor
 }
 
 // Result represents a database query result
@@ -37,14 +39,44 @@ type Result struct {
 func New() *DB {
 	cat := catalog.NewCatalog()
 	store := storage.NewMemoryStorage()
+	functions := parser.NewFunctionRegistry()
 	return &DB{
-		parser:   parser.NewParser(),
-		catalog:  cat,
-		storage:  store,
-		executor: executor.NewExecutor(cat, store),
+		parser:    parser.NewParserWithFunctions(functions),
+		functions: functions,
+		catalog:   cat,
+		storage:   store,
+		executor:  executor.NewExecutor(cat, store),
 	}
 }
 
+// RegisterFunction makes a scalar function implemented in Go callable from SQL
+func (db *DB) RegisterFunction(fn parser.ScalarFunction) error {
+	return db.functions.Register(&fn)
+}
+
+// RegisterAggregate makes an aggregate function implemented in Go callable from SQL
+func (db *DB) RegisterAggregate(fn parser.AggregateFunction) error {
+	return db.functions.RegisterAggregate(&fn)
+}
+
+// OpenBlob returns a reader of a BLOB, which must be closed
+func (db *DB) OpenBlob(table, column string, key ...parser.Value) (storage.BlobReader, error) {
+	blobs, ok := db.storage.(storage.BlobStorage)
+	if !ok {
+		return nil, fmt.Errorf("the storage cannot read BLOBs in pieces")
+	}
+	return blobs.OpenBlob(table, column, key)
+}
+
+// WriteBlob replaces a BLOB by the bytes read from r and returns how many there were
+func (db *DB) WriteBlob(table, column string, r io.Reader, key ...parser.Value) (int64, error) {
+	blobs, ok := db.storage.(storage.BlobStorage)
+	if !ok {
+		return 0, fmt.Errorf("the storage cannot write BLOBs in pieces")
+	}
+	return blobs.WriteBlob(table, column, key, r)
+}
+
 // Execute executes a SQL statement and returns the result
 func (db *DB) Execute(sql string) Result {
 	stmt, err := db.parser.Parse(sql)
@@ -105,7 +137,8 @@ func (db *DB) Execute(sql string) Result {
 				case types.TypeFloat:
 					floatVal, _ := val.AsFloat()
 					valStr = fmt.Sprintf("%g", floatVal)
-				case types.TypeString:
+				case types.TypeString, types.TypeDecimal, types.TypeDate, types.TypeTime,
+					types.TypeTimestamp, types.TypeTimestampTZ, types.TypeInterval, types.TypeBlob, types.TypeJSON:
 					valStr, _ = val.AsString()
 				case types.TypeBool:
 					boolVal, _ := val.AsBool()
@@ -119,9 +152,12 @@ func (db *DB) Execute(sql string) Result {
 			result.Rows = append(result.Rows, resultRow)
 		}
 
-		// Extract column names in a deterministic order
-		for col := range columnSet {
-			result.Columns = append(result.Columns, col)
+		// Use the column order of the statement when it has one
+		result.Columns = execResult.Columns()
+		if result.Columns == nil {
+			for col := range columnSet {
+				result.Columns = append(result.Columns, col)
+			}
 		}
 
 		// Close the row iterator
@@ -1,7 +1,14 @@
 package db
 
 import (
+	"bytes"
+	"io"
+	"strings"
 	"testing"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
 )
 
 func TestDB_Execute(t *testing.T) {
@@ -188,6 +195,113 @@ func TestDB_Integration(t *testing.T) {
 	}
 }
 
+func TestDB_Constraints(t *testing.T) {
+	db := New()
+
+	result := db.Execute("CREATE TABLE users (id INT PRIMARY KEY, email TEXT UNIQUE);")
+	if !result.Success {
+		t.Fatalf("Failed to create table: %v", result.Error)
+	}
+
+	result = db.Execute("INSERT INTO users (id, email) VALUES (1, 'a@example.com'), (2, 'b@example.com');")
+	if !result.Success {
+		t.Fatalf("Failed to insert rows: %v", result.Error)
+	}
+
+	tests := []struct {
+		name           string
+		sql            string
+		wantConstraint string
+	}{
+		{
+			name:           "Duplicate primary key",
+			sql:            "INSERT INTO users (id, email) VALUES (1, 'c@example.com');",
+			wantConstraint: "users_pkey",
+		},
+		{
+			name:           "Duplicate unique value",
+			sql:            "INSERT INTO users (id, email) VALUES (3, 'a@example.com');",
+			wantConstraint: "users_email_key",
+		},
+		{
+			name:           "Update to duplicate unique value",
+			sql:            "UPDATE users SET email = 'a@example.com' WHERE id = 2;",
+			wantConstraint: "users_email_key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := db.Execute(tt.sql)
+			if result.Success {
+				t.Fatalf("Execute(%s) = success, want constraint violation", tt.sql)
+			}
+
+			constraintErr, ok := result.Error.(*storage.ConstraintError)
+			if !ok {
+				t.Fatalf("Execute(%s) error = %v, want *storage.ConstraintError", tt.sql, result.Error)
+			}
+			if constraintErr.Constraint != tt.wantConstraint {
+				t.Errorf("Constraint = %s, want %s", constraintErr.Constraint, tt.wantConstraint)
+			}
+		})
+	}
+
+	result = db.Execute("SELECT * FROM users;")
+	if !result.Success || len(result.Rows) != 2 {
+		t.Errorf("Expected 2 rows after rejected writes, got %d (%v)", len(result.Rows), result.Error)
+	}
+}
+
+func TestDB_Indexes(t *testing.T) {
+	db := New()
+
+	statements := []string{
+		"CREATE TABLE products (id INT PRIMARY KEY, category TEXT, price INT);",
+		"INSERT INTO products VALUES (1, 'tools', 30), (2, 'toys', 15), (3, 'tools', 45), (4, 'books', 12);",
+		"CREATE INDEX products_category ON products (category);",
+	}
+	for _, sql := range statements {
+		if result := db.Execute(sql); !result.Success {
+			t.Fatalf("Execute(%s) error = %v", sql, result.Error)
+		}
+	}
+
+	tests := []struct {
+		sql      string
+		wantRows int
+	}{
+		{"SELECT * FROM products WHERE id = 3;", 1},
+		{"SELECT * FROM products WHERE id >= 2 AND id < 4;", 2},
+		{"SELECT * FROM products WHERE category = 'tools';", 2},
+		{"SELECT * FROM products WHERE category = 'tools' AND price > 40;", 1},
+		{"SELECT * FROM products WHERE price < 20 OR category = 'tools';", 4},
+		{"SELECT * FROM products WHERE NOT category = 'tools';", 2},
+	}
+	for _, tt := range tests {
+		result := db.Execute(tt.sql)
+		if !result.Success {
+			t.Errorf("Execute(%s) error = %v", tt.sql, result.Error)
+			continue
+		}
+		if len(result.Rows) != tt.wantRows {
+			t.Errorf("Execute(%s) returned %d rows, want %d", tt.sql, len(result.Rows), tt.wantRows)
+		}
+	}
+
+	result := db.Execute("CREATE UNIQUE INDEX products_category_key ON products (category);")
+	if result.Success {
+		t.Errorf("CREATE UNIQUE INDEX over duplicate values succeeded")
+	}
+
+	if result := db.Execute("DROP INDEX products_category;"); !result.Success {
+		t.Errorf("DROP INDEX error = %v", result.Error)
+	}
+	if result := db.Execute("DROP INDEX products_category;"); result.Success {
+		t.Errorf("DROP INDEX on a missing index succeeded")
+	}
+}
+
 func TestFormatResult(t *testing.T) {
 	// Test a successful result
 	successResult := Result{
@@ -234,3 +348,321 @@ type databaseError struct {
 func (e *databaseError) Error() string {
 	return e.message
 }
+
+func TestDB_Explain(t *testing.T) {
+	db := New()
+
+	db.Execute("CREATE TABLE users (id INT PRIMARY KEY, name TEXT);")
+	db.Execute("INSERT INTO users VALUES (1, 'Alice'), (2, 'Bob');")
+
+	result := db.Execute("EXPLAIN SELECT name FROM users WHERE id = 2;")
+	if !result.Success {
+		t.Fatalf("EXPLAIN error = %v", result.Error)
+	}
+	wantColumns := []string{"operator", "detail", "estimated_rows"}
+	if strings.Join(result.Columns, ",") != strings.Join(wantColumns, ",") {
+		t.Errorf("EXPLAIN columns = %v, want %v", result.Columns, wantColumns)
+	}
+	if len(result.Rows) != 3 || result.Rows[2]["operator"] != "  -> IndexScan" {
+		t.Errorf("EXPLAIN rows = %v", result.Rows)
+	}
+
+	result = db.Execute("EXPLAIN ANALYZE SELECT name FROM users WHERE id = 2;")
+	if !result.Success {
+		t.Fatalf("EXPLAIN ANALYZE error = %v", result.Error)
+	}
+	if len(result.Columns) != 6 || result.Rows[0]["actual_rows"] != "1" || result.Rows[0]["pages_read"] != "0" {
+		t.Errorf("EXPLAIN ANALYZE rows = %v", result.Rows)
+	}
+
+	// Query results keep the selected column order
+	result = db.Execute("SELECT name, id FROM users;")
+	if strings.Join(result.Columns, ",") != "name,id" {
+		t.Errorf("SELECT columns = %v, want [name id]", result.Columns)
+	}
+}
+
+// productAggregator multiplies the values of a group
+type productAggregator struct {
+	product float64
+	seen    bool
+}
+
+func (a *productAggregator) Step(val parser.Value) error {
+	f, _ := val.AsFloat()
+	if !a.seen {
+		a.product, a.seen = 1, true
+	}
+	a.product *= f
+	return nil
+}
+
+func (a *productAggregator) Result() parser.Value {
+	if !a.seen {
+		return parser.NewNullValue()
+	}
+	return parser.NewFloatValue(a.product)
+}
+
+func TestDB_RegisterFunction(t *testing.T) {
+	db := New()
+
+	err := db.RegisterFunction(parser.ScalarFunction{
+		Name: "reverse",
+		Signatures: []parser.Signature{
+			{Args: []types.DataType{types.TypeString}, Returns: types.TypeString},
+		},
+		Eval: func(args []parser.Value) (parser.Value, error) {
+			s, _ := args[0].AsString()
+			chars := []rune(s)
+			for i, j := 0, len(chars)-1; i < j; i, j = i+1, j-1 {
+				chars[i], chars[j] = chars[j], chars[i]
+			}
+			return parser.NewStringValue(string(chars)), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunction error = %v", err)
+	}
+	err = db.RegisterAggregate(parser.AggregateFunction{
+		Name: "PRODUCT",
+		Signatures: []parser.Signature{
+			{Args: []types.DataType{types.TypeFloat}, Returns: types.TypeFloat},
+		},
+		New: func() parser.Aggregator { return &productAggregator{} },
+	})
+	if err != nil {
+		t.Fatalf("RegisterAggregate error = %v", err)
+	}
+
+	db.Execute("CREATE TABLE items (id INT PRIMARY KEY, grp TEXT, name TEXT, qty INT);")
+	db.Execute("INSERT INTO items VALUES (1, 'a', 'bolt', 2), (2, 'a', 'nut', 3), (3, 'b', 'gear', 4), (4, 'b', NULL, NULL);")
+
+	queries := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT REVERSE(name) AS r FROM items WHERE id = 1;", "tlob"},
+		{"SELECT name FROM items WHERE reverse(name) = 'raeg';", "gear"},
+		{"SELECT grp, PRODUCT(qty) AS p FROM items GROUP BY grp ORDER BY grp;", "a,6|b,4"},
+		{"SELECT id, PRODUCT(qty) OVER (ORDER BY id) AS p FROM items WHERE grp = 'a';", "1,2|2,6"},
+		{"SELECT PRODUCT(qty) AS p FROM items WHERE id > 3;", "NULL"},
+	}
+	for _, q := range queries {
+		result := db.Execute(q.sql)
+		if !result.Success {
+			t.Errorf("%s error = %v", q.sql, result.Error)
+			continue
+		}
+		var rows []string
+		for _, row := range result.Rows {
+			var values []string
+			for _, col := range result.Columns {
+				values = append(values, row[col])
+			}
+			rows = append(rows, strings.Join(values, ","))
+		}
+		if got := strings.Join(rows, "|"); got != q.want {
+			t.Errorf("%s = %q, want %q", q.sql, got, q.want)
+		}
+	}
+
+	for _, sql := range []string{
+		"SELECT REVERSE(id) FROM items;",
+		"SELECT PRODUCT(name) FROM items;",
+		"SELECT PRODUCT(qty, qty) FROM items;",
+		"SELECT id FROM items WHERE PRODUCT(qty) > 1;",
+	} {
+		if result := db.Execute(sql); result.Success {
+			t.Errorf("%s succeeded, want error", sql)
+		}
+	}
+
+	invalid := []parser.ScalarFunction{
+		{Name: "upper", Signatures: []parser.Signature{{Returns: types.TypeString}}, Eval: func([]parser.Value) (parser.Value, error) { return nil, nil }},
+		{Name: "count", Signatures: []parser.Signature{{Returns: types.TypeInt}}, Eval: func([]parser.Value) (parser.Value, error) { return nil, nil }},
+		{Name: "product", Signatures: []parser.Signature{{Returns: types.TypeInt}}, Eval: func([]parser.Value) (parser.Value, error) { return nil, nil }},
+		{Name: "two words", Signatures: []parser.Signature{{Returns: types.TypeInt}}, Eval: func([]parser.Value) (parser.Value, error) { return nil, nil }},
+		{Name: "noimpl", Signatures: []parser.Signature{{Returns: types.TypeInt}}},
+		{Name: "nosig", Eval: func([]parser.Value) (parser.Value, error) { return nil, nil }},
+		{Name: "nulltype", Signatures: []parser.Signature{{Returns: types.TypeNull}}, Eval: func([]parser.Value) (parser.Value, error) { return nil, nil }},
+	}
+	for _, fn := range invalid {
+		if err := db.RegisterFunction(fn); err == nil {
+			t.Errorf("RegisterFunction(%s) succeeded, want error", fn.Name)
+		}
+	}
+	err = db.RegisterAggregate(parser.AggregateFunction{
+		Name:       "pair",
+		Signatures: []parser.Signature{{Args: []types.DataType{types.TypeInt, types.TypeInt}, Returns: types.TypeInt}},
+		New:        func() parser.Aggregator { return &productAggregator{} },
+	})
+	if err == nil {
+		t.Errorf("RegisterAggregate(pair) succeeded, want error")
+	}
+
+	// A function that returns a value of the wrong type fails when called
+	db.RegisterFunction(parser.ScalarFunction{
+		Name:       "broken",
+		Signatures: []parser.Signature{{Returns: types.TypeInt}},
+		Volatile:   true,
+		Eval: func([]parser.Value) (parser.Value, error) {
+			return parser.NewStringValue("x"), nil
+		},
+	})
+	if result := db.Execute("SELECT BROKEN() FROM items;"); result.Success {
+		t.Errorf("SELECT BROKEN() succeeded, want error")
+	}
+}
+
+func TestDB_TemporalLiterals(t *testing.T) {
+	db := New()
+	if result := db.Execute("CREATE TABLE shifts (id INT PRIMARY KEY, day DATE NOT NULL, starts TIME);"); !result.Success {
+		t.Fatalf("CREATE TABLE error = %v", result.Error)
+	}
+
+	// An invalid literal is reported as such, not stored as NULL
+	for sql, want := range map[string]string{
+		"INSERT INTO shifts VALUES (1, DATE '2026-02-30', NULL);":         "invalid DATE value",
+		"INSERT INTO shifts VALUES (1, DATE '2026-02-28', TIME '25:00');": "invalid TIME value",
+	} {
+		result := db.Execute(sql)
+		if result.Success || !strings.Contains(result.Error.Error(), want) {
+			t.Errorf("%s error = %v, want %q", sql, result.Error, want)
+		}
+	}
+	if result := db.Execute("SELECT COUNT(*) AS n FROM shifts;"); !result.Success || result.Rows[0]["n"] != "0" {
+		t.Errorf("rows after invalid INSERTs = %v, %v", result.Rows, result.Error)
+	}
+}
+
+func TestDB_OmittedColumns(t *testing.T) {
+	db := New()
+	for _, sql := range []string{
+		"CREATE TABLE s (id INT PRIMARY KEY, a TEXT, b TEXT, c INT DEFAULT 7);",
+		"INSERT INTO s (id, a) VALUES (3, 'x');",
+	} {
+		if result := db.Execute(sql); !result.Success {
+			t.Fatalf("%s error = %v", sql, result.Error)
+		}
+	}
+
+	// A column left out without a default is NULL
+	result := db.Execute("SELECT id, b, c FROM s;")
+	if !result.Success || len(result.Rows) != 1 || result.Rows[0]["b"] != "NULL" || result.Rows[0]["c"] != "7" {
+		t.Errorf("SELECT of omitted columns = %v, %v", result.Rows, result.Error)
+	}
+	if result := db.Execute("SELECT COUNT(b) AS n FROM s;"); !result.Success || result.Rows[0]["n"] != "0" {
+		t.Errorf("COUNT(b) = %v, %v, want 0", result.Rows, result.Error)
+	}
+}
+
+func TestDB_Blobs(t *testing.T) {
+	db := New()
+	for _, sql := range []string{
+		"CREATE TABLE files (id INT PRIMARY KEY, name TEXT, data BLOB);",
+		"INSERT INTO files VALUES (1, 'empty', X''), (2, 'none', NULL);",
+	} {
+		if result := db.Execute(sql); !result.Success {
+			t.Fatalf("%s error = %v", sql, result.Error)
+		}
+	}
+
+	data := bytes.Repeat([]byte{0xca, 0xfe, 0}, 10000)
+	n, err := db.WriteBlob("files", "data", bytes.NewReader(data), parser.NewIntValue(1))
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("WriteBlob() = %d, %v, want %d", n, err, len(data))
+	}
+	result := db.Execute("SELECT LENGTH(data) AS size, SUBSTR(data, 2, 3) AS part FROM files WHERE id = 1;")
+	if !result.Success || result.Rows[0]["size"] != "30000" || result.Rows[0]["part"] != `\xfe00ca` {
+		t.Errorf("SELECT of the written BLOB = %v, %v", result.Rows, result.Error)
+	}
+
+	r, err := db.OpenBlob("files", "data", parser.NewIntValue(1))
+	if err != nil {
+		t.Fatalf("OpenBlob() error = %v", err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("OpenBlob() read %d bytes, %v, want %d", len(got), err, len(data))
+	}
+
+	if _, err := db.OpenBlob("files", "data", parser.NewIntValue(2)); err == nil {
+		t.Errorf("OpenBlob() of NULL error = nil")
+	}
+	if _, err := db.OpenBlob("files", "name", parser.NewIntValue(1)); err == nil {
+		t.Errorf("OpenBlob() of a TEXT column error = nil")
+	}
+
+	if result := db.Execute("INSERT INTO files VALUES (3, 'bad', X'ZZ');"); result.Success || !strings.Contains(result.Error.Error(), "invalid BLOB literal") {
+		t.Errorf("INSERT of an invalid BLOB literal error = %v", result.Error)
+	}
+}
+
+func TestDB_JSON(t *testing.T) {
+	db := New()
+	for _, sql := range []string{
+		"CREATE TABLE events (id INT PRIMARY KEY, payload JSON);",
+		`INSERT INTO events VALUES (1, '{"kind": "click", "at": [1, 2]}'), (2, '{"kind": "view (page)", "n": 2}');`,
+		"CREATE INDEX events_kind ON events ((payload->>'kind'));",
+	} {
+		if result := db.Execute(sql); !result.Success {
+			t.Fatalf("%s error = %v", sql, result.Error)
+		}
+	}
+
+	result := db.Execute("SELECT id, payload, payload->>'kind' AS kind FROM events ORDER BY id;")
+	if !result.Success || len(result.Rows) != 2 {
+		t.Fatalf("SELECT error = %v, rows %v", result.Error, result.Rows)
+	}
+	if got := result.Rows[0]["payload"]; got != `{"at":[1,2],"kind":"click"}` {
+		t.Errorf("payload = %s", got)
+	}
+	if got := result.Rows[1]["kind"]; got != "view (page)" {
+		t.Errorf("kind = %s, want view (page)", got)
+	}
+
+	result = db.Execute("SELECT e.id, t.value AS at FROM events e, json_each(e.payload, '$.at') t;")
+	if !result.Success || len(result.Rows) != 2 || result.Rows[1]["at"] != "2" {
+		t.Errorf("json_each rows = %v, %v", result.Rows, result.Error)
+	}
+
+	if result := db.Execute(`INSERT INTO events VALUES (3, '{"kind": }');`); result.Success {
+		t.Errorf("INSERT of invalid JSON succeeded")
+	}
+	if result := db.Execute(`INSERT INTO events VALUES (3, JSON '{bad');`); result.Success || !strings.Contains(result.Error.Error(), "invalid JSON value") {
+		t.Errorf("INSERT of an invalid JSON literal error = %v", result.Error)
+	}
+}
+
+func TestDB_Collations(t *testing.T) {
+	db := New()
+	for _, sql := range []string{
+		"CREATE TABLE tags (name VARCHAR(8) COLLATE NOCASE PRIMARY KEY, label CHAR(3));",
+		"INSERT INTO tags VALUES ('Red', 'r'), ('blue', 'b  ');",
+	} {
+		if result := db.Execute(sql); !result.Success {
+			t.Fatalf("%s error = %v", sql, result.Error)
+		}
+	}
+
+	result := db.Execute("SELECT name, label FROM tags WHERE name = 'RED';")
+	if !result.Success || len(result.Rows) != 1 || result.Rows[0]["name"] != "Red" {
+		t.Errorf("lookup in another case = %v, %v", result.Rows, result.Error)
+	}
+	result = db.Execute("SELECT name FROM tags ORDER BY name COLLATE BINARY;")
+	if !result.Success || len(result.Rows) != 2 || result.Rows[0]["name"] != "Red" {
+		t.Errorf("binary order = %v, %v", result.Rows, result.Error)
+	}
+
+	for _, sql := range []string{
+		"INSERT INTO tags VALUES ('RED', 'x');",
+		"INSERT INTO tags VALUES ('green', 'long');",
+		"INSERT INTO tags VALUES ('turquoise', 'x');",
+	} {
+		if result := db.Execute(sql); result.Success {
+			t.Errorf("%s succeeded, want an error", sql)
+		}
+	}
+}
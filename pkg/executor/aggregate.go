@@ -0,0 +1,339 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// aggregator accumulates the non-NULL values of one aggregate call over a group
+type aggregator interface {
+	// Step adds a value to the aggregate
+	Step(val parser.Value) error
+
+	// Result returns the aggregate of the values added so far
+	Result() parser.Value
+}
+
+// aggregateFunctions maps each aggregate function name to its aggregator constructor
+var aggregateFunctions = map[string]func() aggregator{
+	"COUNT": func() aggregator { return &countAggregator{} },
+	"SUM":   func() aggregator { return &sumAggregator{} },
+	"AVG":   func() aggregator { return &avgAggregator{} },
+	"MIN":   func() aggregator { return &extremeAggregator{want: -1} },
+	"MAX":   func() aggregator { return &extremeAggregator{want: 1} },
+}
+
+// isAggregate reports whether an expression is a call of an aggregate function
+func isAggregate(expr parser.Expression) bool {
+	call, ok := expr.(parser.FunctionExpression)
+	if !ok {
+		return false
+	}
+	_, ok = aggregateFunctions[call.Name()]
+	return ok || call.Aggregate() != nil
+}
+
+// newAggregator creates the aggregator for a call of an aggregate function
+func newAggregator(call parser.FunctionExpression) aggregator {
+	if fn := call.Aggregate(); fn != nil {
+		return fn.Start()
+	}
+	return aggregateFunctions[call.Name()]()
+}
+
+// countAggregator implements COUNT
+type countAggregator struct {
+	count int64
+}
+
+func (a *countAggregator) Step(val parser.Value) error {
+	a.count++
+	return nil
+}
+
+func (a *countAggregator) Result() parser.Value {
+	return parser.NewIntValue(a.count)
+}
+
+// sumAggregator implements SUM, widening from INT to FLOAT or DECIMAL as needed
+type sumAggregator struct {
+	intSum     int64
+	floatSum   float64
+	decimalSum parser.Decimal
+	isFloat    bool
+	isDecimal  bool
+	seen       bool
+}
+
+func (a *sumAggregator) Step(val parser.Value) error {
+	if val.Type() == types.TypeDecimal && !a.isDecimal {
+		// Carry on from the sum so far
+		a.decimalSum, _ = a.Result().AsDecimal()
+		a.isDecimal = true
+	}
+	if a.isDecimal {
+		d, err := val.AsDecimal()
+		if err != nil || !isNumber(val) {
+			return fmt.Errorf("cannot sum non-numeric value %v", val)
+		}
+		a.decimalSum = a.decimalSum.Add(d)
+		a.seen = true
+		return nil
+	}
+
+	switch val.Type() {
+	case types.TypeInt:
+		i, _ := val.AsInt()
+		a.intSum += i
+		a.floatSum += float64(i)
+	case types.TypeFloat:
+		f, _ := val.AsFloat()
+		a.floatSum += f
+		a.isFloat = true
+	default:
+		return fmt.Errorf("cannot sum non-numeric value %v", val)
+	}
+	a.seen = true
+	return nil
+}
+
+func (a *sumAggregator) Result() parser.Value {
+	switch {
+	case !a.seen:
+		return parser.NewNullValue()
+	case a.isDecimal:
+		return parser.NewDecimalValue(a.decimalSum)
+	case a.isFloat:
+		return parser.NewFloatValue(a.floatSum)
+	}
+	return parser.NewIntValue(a.intSum)
+}
+
+// avgAggregator implements AVG as a FLOAT, or a DECIMAL for DECIMAL values
+type avgAggregator struct {
+	sum   sumAggregator
+	count int64
+}
+
+func (a *avgAggregator) Step(val parser.Value) error {
+	if !isNumber(val) {
+		return fmt.Errorf("cannot average non-numeric value %v", val)
+	}
+	if err := a.sum.Step(val); err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
+
+func (a *avgAggregator) Result() parser.Value {
+	if a.count == 0 {
+		return parser.NewNullValue()
+	}
+	if a.sum.isDecimal {
+		avg, _ := a.sum.decimalSum.Quo(parser.NewDecimal(a.count, 0))
+		return parser.NewDecimalValue(avg)
+	}
+	return parser.NewFloatValue(a.sum.floatSum / float64(a.count))
+}
+
+// isNumber reports whether a value is an INT, FLOAT or DECIMAL
+func isNumber(val parser.Value) bool {
+	return val.Type() == types.TypeInt || val.Type() == types.TypeFloat || val.Type() == types.TypeDecimal
+}
+
+// extremeAggregator implements MIN (want -1) and MAX (want 1)
+type extremeAggregator struct {
+	want int
+	best parser.Value
+}
+
+func (a *extremeAggregator) Step(val parser.Value) error {
+	if a.best == nil {
+		a.best = val
+		return nil
+	}
+
+	cmp, ok := parser.Compare(val, a.best)
+	if !ok {
+		return fmt.Errorf("cannot compare %v with %v", val, a.best)
+	}
+	if cmp*a.want > 0 {
+		a.best = val
+	}
+	return nil
+}
+
+func (a *extremeAggregator) Result() parser.Value {
+	if a.best == nil {
+		return parser.NewNullValue()
+	}
+	return a.best
+}
+
+// aggregateOperator groups rows by the GROUP BY expressions and computes aggregates per group
+type aggregateOperator struct {
+	estimate
+	ctx        parser.EvalContext
+	child      Operator
+	groupBy    []parser.Expression
+	aggregates []parser.FunctionExpression
+	results    []storage.Row
+	pos        int
+}
+
+// aggregateGroup is the state of one group while an aggregateOperator runs
+type aggregateGroup struct {
+	row         storage.Row
+	aggregators []aggregator
+	distinct    []map[string]bool
+}
+
+func (o *aggregateOperator) newGroup(row storage.Row) *aggregateGroup {
+	group := &aggregateGroup{
+		row:         row,
+		aggregators: make([]aggregator, len(o.aggregates)),
+		distinct:    make([]map[string]bool, len(o.aggregates)),
+	}
+	for i, call := range o.aggregates {
+		group.aggregators[i] = newAggregator(call)
+		if call.Distinct() {
+			group.distinct[i] = make(map[string]bool)
+		}
+	}
+	return group
+}
+
+func (o *aggregateOperator) Open() error {
+	if err := o.child.Open(); err != nil {
+		return err
+	}
+
+	var groups []*aggregateGroup
+	groupIndex := make(map[string]*aggregateGroup)
+	for {
+		row, err := o.child.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+
+		// Find the group of the row
+		keyValues := make([]parser.Value, len(o.groupBy))
+		for i, expr := range o.groupBy {
+			if keyValues[i], err = expr.Eval(o.ctx, row); err != nil {
+				return err
+			}
+		}
+		key := parser.HashKey(keyValues)
+		group, ok := groupIndex[key]
+		if !ok {
+			group = o.newGroup(row)
+			groupIndex[key] = group
+			groups = append(groups, group)
+		}
+
+		if err := o.step(group, row); err != nil {
+			return err
+		}
+	}
+
+	if len(groups) == 0 && len(o.groupBy) == 0 {
+		groups = append(groups, o.newGroup(storage.Row{}))
+	}
+
+	o.results = make([]storage.Row, len(groups))
+	for i, group := range groups {
+		result := make(storage.Row, len(group.row)+len(o.aggregates))
+		for colName, val := range group.row {
+			result[colName] = val
+		}
+		for j, call := range o.aggregates {
+			result[fmt.Sprint(call)] = group.aggregators[j].Result()
+		}
+		o.results[i] = result
+	}
+	o.pos = 0
+	return nil
+}
+
+// step adds a row to the aggregates of its group
+func (o *aggregateOperator) step(group *aggregateGroup, row storage.Row) error {
+	for i, call := range o.aggregates {
+		val, err := aggregateInput(o.ctx, call, row)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			continue
+		}
+
+		if seen := group.distinct[i]; seen != nil {
+			key := parser.HashKey([]parser.Value{val})
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+
+		if err := group.aggregators[i].Step(val); err != nil {
+			return fmt.Errorf("%v: %v", call, err)
+		}
+	}
+	return nil
+}
+
+// aggregateInput evaluates the value an aggregate call adds for a row, or nil to skip it
+func aggregateInput(ctx parser.EvalContext, call parser.FunctionExpression, row storage.Row) (parser.Value, error) {
+	if call.Star() {
+		return parser.NewBoolValue(true), nil
+	}
+	val, err := call.Args()[0].Eval(ctx, row)
+	if err != nil || isNullValue(val) {
+		return nil, err
+	}
+	return val, nil
+}
+
+func (o *aggregateOperator) Next() (storage.Row, error) {
+	if o.pos >= len(o.results) {
+		return nil, nil
+	}
+	o.pos++
+	return o.results[o.pos-1], nil
+}
+
+func (o *aggregateOperator) Close() error {
+	o.results = nil
+	return o.child.Close()
+}
+
+func (o *aggregateOperator) Children() []Operator {
+	return []Operator{o.child}
+}
+
+func (o *aggregateOperator) Describe() (string, string) {
+	calls := make([]string, len(o.aggregates))
+	for i, call := range o.aggregates {
+		calls[i] = fmt.Sprint(call)
+	}
+	if len(o.groupBy) == 0 {
+		return "Aggregate", strings.Join(calls, ", ")
+	}
+
+	keys := make([]string, len(o.groupBy))
+	for i, expr := range o.groupBy {
+		keys[i] = fmt.Sprint(expr)
+	}
+	detail := "group by " + strings.Join(keys, ", ")
+	if len(calls) > 0 {
+		detail += ": " + strings.Join(calls, ", ")
+	}
+	return "Aggregate", detail
+}
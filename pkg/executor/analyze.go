@@ -0,0 +1,126 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// histogramBuckets is the number of buckets in the histogram of a column
+const histogramBuckets = 32
+
+// executeAnalyze executes an ANALYZE statement
+func (e *Executor) executeAnalyze(stmt parser.AnalyzeStatement) (Result, error) {
+	tableNames := []string{stmt.TableName()}
+	if stmt.TableName() == "" {
+		tableNames = e.catalog.ListTables()
+		sort.Strings(tableNames)
+	}
+
+	for _, tableName := range tableNames {
+		schema, found := e.catalog.GetTable(tableName)
+		if !found {
+			return &executionResult{
+				resultType: types.ResultError,
+				err:        fmt.Errorf("table '%s' not found", tableName),
+			}, nil
+		}
+
+		stats, err := collectTableStats(e.storage, schema)
+		if err == nil {
+			err = e.catalog.SetTableStats(tableName, stats)
+		}
+		if recorder, ok := e.storage.(storage.StatsRecorder); ok && err == nil {
+			err = recorder.SetTableStats(tableName, stats)
+		}
+		if err != nil {
+			return &executionResult{
+				resultType: types.ResultError,
+				err:        err,
+			}, nil
+		}
+	}
+
+	return &executionResult{
+		resultType:   types.ResultSuccess,
+		rowsAffected: 0,
+	}, nil
+}
+
+// collectTableStats reads every row of a table and summarizes each column
+func collectTableStats(store storage.Storage, schema catalog.TableSchema) (catalog.TableStats, error) {
+	iter, err := store.Select(schema.Name(), []string{"*"}, acceptAll)
+	if err != nil {
+		return catalog.TableStats{}, err
+	}
+	defer iter.Close()
+
+	columns := columnNames(schema)
+	values := make(map[string][]parser.Value, len(columns))
+	nulls := make(map[string]int64, len(columns))
+	var rowCount int64
+	for iter.Next() {
+		row := iter.Row()
+		rowCount++
+		for _, colName := range columns {
+			if val := row[colName]; isNullValue(val) {
+				nulls[colName]++
+			} else {
+				values[colName] = append(values[colName], val)
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return catalog.TableStats{}, err
+	}
+
+	stats := catalog.TableStats{
+		RowCount: rowCount,
+		Columns:  make(map[string]catalog.ColumnStats, len(columns)),
+	}
+	for _, colName := range columns {
+		col := columnStats(values[colName])
+		if rowCount > 0 {
+			col.NullFraction = float64(nulls[colName]) / float64(rowCount)
+		}
+		stats.Columns[colName] = col
+	}
+	return stats, nil
+}
+
+// columnStats counts the distinct values of a column and builds their histogram; it sorts vals
+func columnStats(vals []parser.Value) catalog.ColumnStats {
+	if len(vals) == 0 {
+		return catalog.ColumnStats{}
+	}
+
+	sort.SliceStable(vals, func(i, j int) bool {
+		return compareKeys(vals[i], vals[j]) < 0
+	})
+
+	var distinct int64 = 1
+	for i := 1; i < len(vals); i++ {
+		if compareKeys(vals[i-1], vals[i]) != 0 {
+			distinct++
+		}
+	}
+
+	// Bound i sits at the i-th of buckets evenly spaced positions
+	buckets := histogramBuckets
+	if len(vals)-1 < buckets {
+		buckets = len(vals) - 1
+	}
+	histogram := []parser.Value{vals[0]}
+	for i := 1; i <= buckets; i++ {
+		histogram = append(histogram, vals[i*(len(vals)-1)/buckets])
+	}
+
+	return catalog.ColumnStats{
+		DistinctCount: distinct,
+		Histogram:     histogram,
+	}
+}
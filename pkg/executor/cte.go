@@ -0,0 +1,423 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// Planning assumptions and limits for recursive CTEs
+const (
+	recursiveSteps    = 10
+	maxRecursionSteps = 10000
+)
+
+// cte is a common table expression, computed once per statement
+type cte struct {
+	name   string
+	schema *derivedSchema
+
+	// root produces the rows, keyed by rootColumns in the order of the CTE's columns
+	root        Operator
+	rootColumns []string
+
+	// recursive is set while the recursive term of the CTE is planned
+	recursive bool
+
+	// work holds the rows added by the previous step of a recursive CTE
+	work           []storage.Row
+	selfReferenced bool
+
+	rows []storage.Row
+	done bool
+}
+
+// columns lists the names of the columns of the CTE
+func (c *cte) columns() []string {
+	return columnNames(c.schema)
+}
+
+// materialize computes the rows of the CTE unless that was done already
+func (c *cte) materialize() error {
+	if c.done {
+		return nil
+	}
+	rows, err := drain(c.root)
+	if err != nil {
+		return err
+	}
+	c.rows = renameColumns(rows, c.rootColumns, c.columns())
+	c.done = true
+	return nil
+}
+
+// renameColumns keeps the values of rows under the given names, by position
+func renameColumns(rows []storage.Row, from, to []string) []storage.Row {
+	result := make([]storage.Row, len(rows))
+	for i, row := range rows {
+		renamed := make(storage.Row, len(to))
+		for j, name := range to {
+			renamed[name] = row[from[j]]
+		}
+		result[i] = renamed
+	}
+	return result
+}
+
+// withCTEs returns a planner for a query with the given WITH clause
+func (p *planner) withCTEs(with []parser.CommonTableExpression) (*planner, error) {
+	if len(with) == 0 {
+		return p, nil
+	}
+
+	scoped := *p
+	scoped.ctes = make(map[string]*cte, len(p.ctes)+len(with))
+	for name, c := range p.ctes {
+		scoped.ctes[name] = c
+	}
+	for _, def := range with {
+		c, err := scoped.planCTE(def)
+		if err != nil {
+			return nil, err
+		}
+		scoped.ctes[def.Name] = c
+		p.ctx.ctes = append(p.ctx.ctes, c)
+	}
+	return &scoped, nil
+}
+
+// planCTE compiles the query of a CTE
+func (p *planner) planCTE(def parser.CommonTableExpression) (*cte, error) {
+	sub := &planner{catalog: p.catalog, storage: p.storage, analyze: p.analyze, ctx: p.ctx, ctes: p.ctes}
+	compiled, err := sub.planSelect(def.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	names := compiled.columns
+	if len(def.Columns) > 0 {
+		if len(def.Columns) != len(compiled.columns) {
+			return nil, fmt.Errorf("WITH query '%s' has %d columns available but %d columns specified",
+				def.Name, len(compiled.columns), len(def.Columns))
+		}
+		names = def.Columns
+	}
+	schema := &derivedSchema{name: def.Name}
+	for i, name := range names {
+		if schema.HasColumn(name) {
+			return nil, fmt.Errorf("column '%s' specified more than once in WITH query '%s'", name, def.Name)
+		}
+		schema.columns = append(schema.columns, &derivedColumn{name: name, dataType: compiled.types[i]})
+	}
+
+	schema.rows = compiled.root.EstimatedRows()
+	c := &cte{name: def.Name, schema: schema, root: compiled.root, rootColumns: compiled.columns}
+	if def.Recursive != nil {
+		if err := p.planRecursiveTerm(c, def, compiled); err != nil {
+			return nil, err
+		}
+	}
+	schema.rows = c.root.EstimatedRows()
+	return c, nil
+}
+
+// planRecursiveTerm compiles the recursive term of a CTE
+func (p *planner) planRecursiveTerm(c *cte, def parser.CommonTableExpression, anchor *plan) error {
+	sub := &planner{catalog: p.catalog, storage: p.storage, analyze: p.analyze, ctx: p.ctx, ctes: make(map[string]*cte, len(p.ctes)+1)}
+	for name, other := range p.ctes {
+		sub.ctes[name] = other
+	}
+	sub.ctes[def.Name] = c
+
+	c.recursive = true
+	compiled, err := sub.planSelect(def.Recursive)
+	c.recursive = false
+	if err != nil {
+		return err
+	}
+	if len(compiled.columns) != len(anchor.columns) {
+		return fmt.Errorf("each UNION query of WITH query '%s' must have the same number of columns", def.Name)
+	}
+	for i, col := range c.schema.columns {
+		if _, ok := commonType(col.Type(), compiled.types[i]); !ok {
+			return fmt.Errorf("recursive query '%s' column %d has type %v in the first query but %v in the recursive term",
+				def.Name, i+1, col.Type(), compiled.types[i])
+		}
+	}
+
+	rows := anchor.root.EstimatedRows() + recursiveSteps*compiled.root.EstimatedRows()
+	c.root = p.node(&recursiveUnionOperator{
+		estimate:         estimate{rows: rows},
+		cte:              c,
+		anchor:           anchor.root,
+		recursive:        compiled.root,
+		anchorColumns:    anchor.columns,
+		recursiveColumns: compiled.columns,
+		all:              def.UnionAll,
+	})
+	c.rootColumns = c.columns()
+	return nil
+}
+
+// planCTEInput reads a CTE that is a table of the FROM clause
+func (p *planner) planCTEInput(scope *queryScope, i int, terms []parser.Expression, filter bool) joinInput {
+	table := scope.tables[i]
+	c := table.cte
+	if c.recursive {
+		c.selfReferenced = true
+	}
+
+	// While the recursive term is planned, the row count is that of the
+	// first query, which is also what each step is expected to add
+	rows := c.schema.rows
+	var op Operator = p.node(&cteScanOperator{
+		estimate: estimate{rows: rows},
+		cte:      c,
+		work:     c.recursive,
+		alias:    table.alias,
+		outer:    p.outer,
+	})
+	if filter && len(terms) > 0 {
+		condition := conjunction(terms)
+		rows = estimateRows(rows, estimateSelectivity(scope, condition))
+		op = p.node(newFilterOperator(p.ctx, op, condition, rows))
+	}
+	return joinInput{op: op, rows: rows, tables: map[int]bool{i: true}}
+}
+
+// recursiveUnionOperator computes a recursive CTE step by step until a step adds no rows
+type recursiveUnionOperator struct {
+	estimate
+	cte                             *cte
+	anchor, recursive               Operator
+	anchorColumns, recursiveColumns []string
+	all                             bool
+	rows                            []storage.Row
+	pos                             int
+}
+
+func (o *recursiveUnionOperator) Open() error {
+	columns := o.cte.columns()
+	seen := make(map[string]bool)
+	// add appends the rows not seen before, unless all rows are kept
+	add := func(rows []storage.Row) []storage.Row {
+		var added []storage.Row
+		for _, row := range rows {
+			if !o.all {
+				values := make([]parser.Value, len(columns))
+				for i, name := range columns {
+					values[i] = row[name]
+				}
+				key := parser.HashKey(values)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			added = append(added, row)
+		}
+		o.rows = append(o.rows, added...)
+		return added
+	}
+
+	o.rows, o.pos = nil, 0
+	rows, err := drain(o.anchor)
+	if err != nil {
+		return err
+	}
+	work := add(renameColumns(rows, o.anchorColumns, columns))
+
+	for step := 1; len(work) > 0; step++ {
+		if step > maxRecursionSteps {
+			return fmt.Errorf("recursive query '%s' did not finish after %d steps", o.cte.name, maxRecursionSteps)
+		}
+
+		o.cte.work = work
+		rows, err := drain(o.recursive)
+		o.cte.work = nil
+		if err != nil {
+			return err
+		}
+		work = add(renameColumns(rows, o.recursiveColumns, columns))
+
+		// A recursive term that does not read the CTE adds its rows once
+		if !o.cte.selfReferenced {
+			break
+		}
+	}
+	return nil
+}
+
+func (o *recursiveUnionOperator) Next() (storage.Row, error) {
+	if o.pos >= len(o.rows) {
+		return nil, nil
+	}
+	o.pos++
+	return o.rows[o.pos-1], nil
+}
+
+func (o *recursiveUnionOperator) Close() error {
+	o.rows = nil
+	return nil
+}
+
+func (o *recursiveUnionOperator) Children() []Operator {
+	return []Operator{o.anchor, o.recursive}
+}
+
+func (o *recursiveUnionOperator) Describe() (string, string) {
+	if o.all {
+		return "RecursiveUnion", "all"
+	}
+	return "RecursiveUnion", ""
+}
+
+// cteScanOperator reads the rows of a CTE, or of the previous step of a recursive one
+type cteScanOperator struct {
+	estimate
+	cte   *cte
+	work  bool
+	alias string
+	outer *outerRow
+	rows  []storage.Row
+	pos   int
+}
+
+func (o *cteScanOperator) Open() error {
+	o.pos = 0
+	if o.work {
+		o.rows = o.cte.work
+		return nil
+	}
+	if err := o.cte.materialize(); err != nil {
+		return err
+	}
+	o.rows = o.cte.rows
+	return nil
+}
+
+func (o *cteScanOperator) Next() (storage.Row, error) {
+	if o.pos >= len(o.rows) {
+		return nil, nil
+	}
+	stored := o.rows[o.pos]
+	o.pos++
+
+	row := make(storage.Row, 2*len(stored))
+	if o.outer != nil {
+		for colName, val := range o.outer.row {
+			row[colName] = val
+		}
+	}
+	for colName, val := range stored {
+		row[colName] = val
+		row[o.alias+"."+colName] = val
+	}
+	return row, nil
+}
+
+func (o *cteScanOperator) Close() error {
+	o.rows = nil
+	return nil
+}
+
+func (o *cteScanOperator) Children() []Operator {
+	return nil
+}
+
+func (o *cteScanOperator) Describe() (string, string) {
+	name := "CTEScan"
+	if o.work {
+		name = "WorkTableScan"
+	}
+	if o.alias != o.cte.name {
+		return name, o.cte.name + " " + o.alias
+	}
+	return name, o.cte.name
+}
+
+// derivedSchema describes the columns of a CTE like those of a table
+type derivedSchema struct {
+	name    string
+	columns []parser.ColumnDefinition
+	rows    float64
+}
+
+func (s *derivedSchema) Name() string {
+	return s.name
+}
+
+func (s *derivedSchema) Columns() []parser.ColumnDefinition {
+	return s.columns
+}
+
+func (s *derivedSchema) GetColumn(name string) (parser.ColumnDefinition, bool) {
+	for _, col := range s.columns {
+		if col.Name() == name {
+			return col, true
+		}
+	}
+	return nil, false
+}
+
+func (s *derivedSchema) HasColumn(name string) bool {
+	_, found := s.GetColumn(name)
+	return found
+}
+
+func (s *derivedSchema) GetColumnType(name string) types.DataType {
+	col, found := s.GetColumn(name)
+	if !found {
+		return types.TypeNull
+	}
+	return col.Type()
+}
+
+func (s *derivedSchema) Constraints() []parser.TableConstraint {
+	return nil
+}
+
+func (s *derivedSchema) Stats() (catalog.TableStats, bool) {
+	return catalog.TableStats{RowCount: int64(s.rows)}, true
+}
+
+func (s *derivedSchema) Version() int {
+	return 0
+}
+
+// derivedColumn is a column of a derivedSchema
+type derivedColumn struct {
+	name     string
+	dataType types.DataType
+}
+
+func (c *derivedColumn) Name() string {
+	return c.name
+}
+
+func (c *derivedColumn) Type() types.DataType {
+	return c.dataType
+}
+
+func (c *derivedColumn) TypeParams() []int {
+	return nil
+}
+
+func (c *derivedColumn) TypeName() string {
+	return c.dataType.String()
+}
+
+func (c *derivedColumn) Collation() parser.Collation {
+	return parser.CollateBinary
+}
+
+func (c *derivedColumn) Constraints() []types.Constraint {
+	return nil
+}
+
+func (c *derivedColumn) Default() parser.Expression {
+	return nil
+}
@@ -2,6 +2,7 @@ package executor
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
 	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
@@ -20,6 +21,9 @@ type Result interface {
 	// Rows returns the rows returned by the statement
 	Rows() storage.RowIterator
 
+	// Columns returns the names of the returned columns in order
+	Columns() []string
+
 	// Error returns any error that occurred during execution
 	Error() error
 }
@@ -45,6 +49,12 @@ func (e *Executor) Execute(stmt parser.Statement) (Result, error) {
 		return e.executeCreateTable(stmt.(parser.CreateTableStatement))
 	case types.StmtDrop:
 		return e.executeDropTable(stmt.(parser.DropTableStatement))
+	case types.StmtAlterTable:
+		return e.executeAlterTable(stmt.(parser.AlterTableStatement))
+	case types.StmtCreateSequence:
+		return e.executeCreateSequence(stmt.(parser.CreateSequenceStatement))
+	case types.StmtDropSequence:
+		return e.executeDropSequence(stmt.(parser.DropSequenceStatement))
 	case types.StmtInsert:
 		return e.executeInsert(stmt.(parser.InsertStatement))
 	case types.StmtUpdate:
@@ -53,6 +63,14 @@ func (e *Executor) Execute(stmt parser.Statement) (Result, error) {
 		return e.executeDelete(stmt.(parser.DeleteStatement))
 	case types.StmtSelect:
 		return e.executeSelect(stmt.(parser.SelectStatement))
+	case types.StmtCreateIndex:
+		return e.executeCreateIndex(stmt.(parser.CreateIndexStatement))
+	case types.StmtDropIndex:
+		return e.executeDropIndex(stmt.(parser.DropIndexStatement))
+	case types.StmtExplain:
+		return e.executeExplain(stmt.(parser.ExplainStatement))
+	case types.StmtAnalyze:
+		return e.executeAnalyze(stmt.(parser.AnalyzeStatement))
 	default:
 		return nil, fmt.Errorf("unsupported statement type: %v", stmt.Type())
 	}
@@ -61,7 +79,7 @@ func (e *Executor) Execute(stmt parser.Statement) (Result, error) {
 // executeCreateTable executes a CREATE TABLE statement
 func (e *Executor) executeCreateTable(stmt parser.CreateTableStatement) (Result, error) {
 	// Create the table schema in the catalog
-	err := e.catalog.CreateTable(stmt.TableName(), stmt.Columns())
+	err := e.catalog.CreateTable(stmt.TableName(), stmt.Columns(), stmt.Constraints()...)
 	if err != nil {
 		return &executionResult{
 			resultType: types.ResultError,
@@ -89,6 +107,21 @@ func (e *Executor) executeCreateTable(stmt parser.CreateTableStatement) (Result,
 		}, nil
 	}
 
+	// Create the sequences of AUTOINCREMENT columns
+	for _, col := range schema.Columns() {
+		if name, ok := catalog.AutoIncrementSequence(col); ok {
+			err = e.storage.CreateSequence(storage.Sequence{Name: name, Start: 1, Increment: 1})
+		}
+		if err != nil {
+			e.storage.DropTable(stmt.TableName())
+			e.catalog.DropTable(stmt.TableName())
+			return &executionResult{
+				resultType: types.ResultError,
+				err:        err,
+			}, nil
+		}
+	}
+
 	return &executionResult{
 		resultType:   types.ResultSuccess,
 		rowsAffected: 0,
@@ -98,7 +131,7 @@ func (e *Executor) executeCreateTable(stmt parser.CreateTableStatement) (Result,
 // executeDropTable executes a DROP TABLE statement
 func (e *Executor) executeDropTable(stmt parser.DropTableStatement) (Result, error) {
 	// Check if the table exists
-	_, found := e.catalog.GetTable(stmt.TableName())
+	schema, found := e.catalog.GetTable(stmt.TableName())
 	if !found {
 		return &executionResult{
 			resultType: types.ResultError,
@@ -106,6 +139,18 @@ func (e *Executor) executeDropTable(stmt parser.DropTableStatement) (Result, err
 		}, nil
 	}
 
+	// The catalog refuses to drop a table that others reference, but its
+	// rows must not go before that is known
+	for _, fk := range catalog.References(e.catalog, stmt.TableName()) {
+		if fk.Table != stmt.TableName() {
+			return &executionResult{
+				resultType: types.ResultError,
+				err: fmt.Errorf("cannot drop table '%s' referenced by constraint '%s' of table '%s'",
+					stmt.TableName(), fk.Name, fk.Table),
+			}, nil
+		}
+	}
+
 	// Drop the table from storage
 	err := e.storage.DropTable(stmt.TableName())
 	if err != nil {
@@ -124,115 +169,205 @@ func (e *Executor) executeDropTable(stmt parser.DropTableStatement) (Result, err
 		}, nil
 	}
 
+	// The sequences of AUTOINCREMENT columns go with the table
+	for _, col := range schema.Columns() {
+		if name, ok := catalog.AutoIncrementSequence(col); ok {
+			e.storage.DropSequence(name)
+		}
+	}
+
 	return &executionResult{
 		resultType:   types.ResultSuccess,
 		rowsAffected: 0,
 	}, nil
 }
 
-// executeInsert executes an INSERT statement
-func (e *Executor) executeInsert(stmt parser.InsertStatement) (Result, error) {
-	tableName := stmt.TableName()
+// executeAlterTable executes an ALTER TABLE statement
+func (e *Executor) executeAlterTable(stmt parser.AlterTableStatement) (Result, error) {
+	change := catalog.SchemaChange{
+		Action:      stmt.Action(),
+		Column:      stmt.Column(),
+		Constraints: stmt.Constraints(),
+		ColumnName:  stmt.ColumnName(),
+		NewName:     stmt.NewName(),
 
-	// Check if the table exists
-	schema, found := e.catalog.GetTable(tableName)
-	if !found {
-		return &executionResult{
-			resultType: types.ResultError,
-			err:        fmt.Errorf("table '%s' not found", tableName),
-		}, nil
+		ConstraintName: stmt.ConstraintName(),
 	}
 
-	// Get columns from the statement
-	columns := stmt.Columns()
-
-	// If no columns were specified, use all columns from the schema in order
-	if len(columns) == 0 {
-		// Get all columns from the table schema
-		allColumns := schema.Columns()
-		columns = make([]string, len(allColumns))
-		for i, col := range allColumns {
-			columns[i] = col.Name()
-		}
-	} else {
-		// Validate the specified column names
-		for _, colName := range columns {
-			if !schema.HasColumn(colName) {
+	// A NOT NULL column needs a default to fill the rows already there,
+	// and that default must be a constant
+	if change.Action == types.AlterAddColumn {
+		def := change.Column.Default()
+		_, constant := def.(parser.LiteralExpression)
+		notNull := slices.Contains(change.Column.Constraints(), types.ConstraintNotNull)
+		if !constant && (notNull || def != nil) {
+			empty, err := e.tableEmpty(stmt.TableName())
+			if err == nil && !empty {
+				if def != nil {
+					err = fmt.Errorf("DEFAULT %v of column '%s' is not a constant, so cannot fill the rows of table '%s'",
+						def, change.Column.Name(), stmt.TableName())
+				} else {
+					err = fmt.Errorf("column '%s' cannot be NULL in the rows of table '%s'", change.Column.Name(), stmt.TableName())
+				}
+			}
+			if err != nil {
 				return &executionResult{
 					resultType: types.ResultError,
-					err:        fmt.Errorf("column '%s' not found in table '%s'", colName, tableName),
+					err:        err,
 				}, nil
 			}
 		}
 	}
 
-	rowsAffected := 0
-	// Process each row of values
-	for _, values := range stmt.Values() {
-		if len(values) != len(columns) {
-			return &executionResult{
-				resultType: types.ResultError,
-				err:        fmt.Errorf("column count doesn't match value count"),
-			}, nil
+	oldSchema, _ := e.catalog.GetTable(stmt.TableName())
+	err := e.catalog.AlterTable(stmt.TableName(), change)
+	if err != nil {
+		return &executionResult{
+			resultType: types.ResultError,
+			err:        err,
+		}, nil
+	}
+
+	newName := stmt.TableName()
+	if change.Action == types.AlterRenameTable {
+		newName = change.NewName
+	}
+	schema, _ := e.catalog.GetTable(newName)
+
+	// Roll back the catalog change; a dropped column cannot come back, but
+	// storage only fails to drop one when it cannot write
+	undo := catalog.SchemaChange{Action: change.Action, ColumnName: change.NewName, NewName: change.ColumnName}
+	switch change.Action {
+	case types.AlterAddColumn:
+		undo = catalog.SchemaChange{Action: types.AlterDropColumn, ColumnName: change.Column.Name()}
+	case types.AlterRenameTable:
+		undo.NewName = stmt.TableName()
+	case types.AlterAddConstraint:
+		added := schema.Constraints()
+		undo = catalog.SchemaChange{Action: types.AlterDropConstraint, ConstraintName: added[len(added)-1].Name}
+	case types.AlterDropConstraint:
+		i := slices.IndexFunc(oldSchema.Constraints(), func(c parser.TableConstraint) bool { return c.Name == change.ConstraintName })
+		undo = catalog.SchemaChange{Action: types.AlterAddConstraint, Constraints: oldSchema.Constraints()[i : i+1]}
+	}
+
+	err = e.checkAddedReferences(oldSchema, schema, change)
+	if err == nil {
+		err = e.storage.AlterTable(stmt.TableName(), schema, change)
+	}
+	if err != nil {
+		if change.Action != types.AlterDropColumn {
+			e.catalog.AlterTable(newName, undo)
 		}
+		return &executionResult{
+			resultType: types.ResultError,
+			err:        err,
+		}, nil
+	}
 
-		// Prepare the row
-		row := make(map[string]parser.Value)
-		for i, colName := range columns {
-			row[colName] = values[i]
+	return &executionResult{
+		resultType:   types.ResultSuccess,
+		rowsAffected: 0,
+	}, nil
+}
+
+// checkAddedReferences checks the rows of a table against the foreign keys a change adds
+func (e *Executor) checkAddedReferences(oldSchema, schema catalog.TableSchema, change catalog.SchemaChange) error {
+	var added []catalog.ForeignKey
+	for _, fk := range catalog.ForeignKeys(schema) {
+		if !slices.ContainsFunc(oldSchema.Constraints(), func(c parser.TableConstraint) bool { return c.Name == fk.Name }) {
+			added = append(added, fk)
 		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
 
-		// Insert the row
-		err := e.storage.Insert(tableName, row)
-		if err != nil {
-			return &executionResult{
-				resultType:   types.ResultError,
-				err:          err,
-				rowsAffected: rowsAffected,
-			}, nil
+	writer := &referentialWriter{catalog: e.catalog, storage: e.storage}
+	rows, err := writer.selectRows(oldSchema.Name(), storage.AccessPath{}, acceptAll)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.checkReferences(added, storage.AlterRow(row, change)); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		rowsAffected++
+// executeCreateSequence executes a CREATE SEQUENCE statement
+func (e *Executor) executeCreateSequence(stmt parser.CreateSequenceStatement) (Result, error) {
+	err := e.storage.CreateSequence(storage.Sequence{
+		Name:      stmt.SequenceName(),
+		Start:     stmt.Start(),
+		Increment: stmt.Increment(),
+	})
+	if err != nil {
+		return &executionResult{
+			resultType: types.ResultError,
+			err:        err,
+		}, nil
 	}
 
 	return &executionResult{
 		resultType:   types.ResultSuccess,
-		rowsAffected: rowsAffected,
+		rowsAffected: 0,
 	}, nil
 }
 
-// executeUpdate executes an UPDATE statement
-func (e *Executor) executeUpdate(stmt parser.UpdateStatement) (Result, error) {
-	tableName := stmt.TableName()
+// executeDropSequence executes a DROP SEQUENCE statement
+func (e *Executor) executeDropSequence(stmt parser.DropSequenceStatement) (Result, error) {
+	for _, tableName := range e.catalog.ListTables() {
+		schema, _ := e.catalog.GetTable(tableName)
+		for _, col := range schema.Columns() {
+			if name, ok := catalog.AutoIncrementSequence(col); ok && name == stmt.SequenceName() {
+				return &executionResult{
+					resultType: types.ResultError,
+					err: fmt.Errorf("sequence '%s' belongs to AUTOINCREMENT column '%s' of table '%s'",
+						name, col.Name(), tableName),
+				}, nil
+			}
+		}
+	}
 
-	// Check if the table exists
-	_, found := e.catalog.GetTable(tableName)
-	if !found {
+	err := e.storage.DropSequence(stmt.SequenceName())
+	if err != nil {
 		return &executionResult{
 			resultType: types.ResultError,
-			err:        fmt.Errorf("table '%s' not found", tableName),
+			err:        err,
 		}, nil
 	}
 
-	// Prepare update values
-	updateValues := make(map[string]parser.Value)
-	for colName, expr := range stmt.SetClauses() {
-		// Evaluate the expression
-		val, err := evaluateExpression(expr, nil) // No row context for simple expressions
-		if err != nil {
-			return &executionResult{
-				resultType: types.ResultError,
-				err:        fmt.Errorf("failed to evaluate expression for column '%s': %v", colName, err),
-			}, nil
-		}
-		updateValues[colName] = val
+	return &executionResult{
+		resultType:   types.ResultSuccess,
+		rowsAffected: 0,
+	}, nil
+}
+
+// tableEmpty reports whether a table has no rows
+func (e *Executor) tableEmpty(tableName string) (bool, error) {
+	iter, err := e.storage.Select(tableName, []string{"*"}, func(storage.Row) (bool, error) {
+		return true, nil
+	})
+	if err != nil {
+		return false, err
 	}
+	defer iter.Close()
+	return !iter.Next(), iter.Err()
+}
 
-	// Create filter function from WHERE clause
-	filter := createFilterFunc(stmt.WhereClause())
+// executeCreateIndex executes a CREATE INDEX statement
+func (e *Executor) executeCreateIndex(stmt parser.CreateIndexStatement) (Result, error) {
+	index := catalog.Index{
+		Name:        stmt.IndexName(),
+		Table:       stmt.TableName(),
+		Columns:     stmt.Columns(),
+		Expressions: stmt.Expressions(),
+		Unique:      stmt.Unique(),
+	}
 
-	// Execute the update
-	rowsAffected, err := e.storage.Update(tableName, updateValues, filter)
+	// Register the index in the catalog
+	err := e.catalog.CreateIndex(index)
 	if err != nil {
 		return &executionResult{
 			resultType: types.ResultError,
@@ -240,30 +375,45 @@ func (e *Executor) executeUpdate(stmt parser.UpdateStatement) (Result, error) {
 		}, nil
 	}
 
+	// Build the index in storage
+	err = e.storage.CreateIndex(index.Table, index)
+	if err != nil {
+		// Roll back the catalog change
+		e.catalog.DropIndex(index.Name)
+		return &executionResult{
+			resultType: types.ResultError,
+			err:        err,
+		}, nil
+	}
+
 	return &executionResult{
 		resultType:   types.ResultSuccess,
-		rowsAffected: rowsAffected,
+		rowsAffected: 0,
 	}, nil
 }
 
-// executeDelete executes a DELETE statement
-func (e *Executor) executeDelete(stmt parser.DeleteStatement) (Result, error) {
-	tableName := stmt.TableName()
-
-	// Check if the table exists
-	_, found := e.catalog.GetTable(tableName)
+// executeDropIndex executes a DROP INDEX statement
+func (e *Executor) executeDropIndex(stmt parser.DropIndexStatement) (Result, error) {
+	// Check if the index exists
+	index, found := e.catalog.GetIndex(stmt.IndexName())
 	if !found {
 		return &executionResult{
 			resultType: types.ResultError,
-			err:        fmt.Errorf("table '%s' not found", tableName),
+			err:        fmt.Errorf("index '%s' not found", stmt.IndexName()),
 		}, nil
 	}
 
-	// Create filter function from WHERE clause
-	filter := createFilterFunc(stmt.WhereClause())
+	// Drop the index from catalog first; this refuses constraint indexes
+	err := e.catalog.DropIndex(index.Name)
+	if err != nil {
+		return &executionResult{
+			resultType: types.ResultError,
+			err:        err,
+		}, nil
+	}
 
-	// Execute the delete
-	rowsAffected, err := e.storage.Delete(tableName, filter)
+	// Drop the index from storage
+	err = e.storage.DropIndex(index.Table, index.Name)
 	if err != nil {
 		return &executionResult{
 			resultType: types.ResultError,
@@ -273,28 +423,63 @@ func (e *Executor) executeDelete(stmt parser.DeleteStatement) (Result, error) {
 
 	return &executionResult{
 		resultType:   types.ResultSuccess,
-		rowsAffected: rowsAffected,
+		rowsAffected: 0,
 	}, nil
 }
 
-// executeSelect executes a SELECT statement
-func (e *Executor) executeSelect(stmt parser.SelectStatement) (Result, error) {
-	tableName := stmt.TableName()
+// executeInsert executes an INSERT statement
+func (e *Executor) executeInsert(stmt parser.InsertStatement) (Result, error) {
+	return e.executeModify(stmt)
+}
 
-	// Check if the table exists
-	_, found := e.catalog.GetTable(tableName)
-	if !found {
+// executeUpdate executes an UPDATE statement
+func (e *Executor) executeUpdate(stmt parser.UpdateStatement) (Result, error) {
+	return e.executeModify(stmt)
+}
+
+// executeDelete executes a DELETE statement
+func (e *Executor) executeDelete(stmt parser.DeleteStatement) (Result, error) {
+	return e.executeModify(stmt)
+}
+
+// executeModify plans and runs a statement that changes rows
+func (e *Executor) executeModify(stmt parser.Statement) (Result, error) {
+	p := newPlanner(e.catalog, e.storage, false)
+	compiled, err := p.planStatement(stmt)
+	if err != nil {
 		return &executionResult{
 			resultType: types.ResultError,
-			err:        fmt.Errorf("table '%s' not found", tableName),
+			err:        err,
+		}, nil
+	}
+
+	_, err = drain(compiled.root)
+	if err != nil {
+		return &executionResult{
+			resultType:   types.ResultError,
+			err:          err,
+			rowsAffected: compiled.modify.RowsAffected(),
 		}, nil
 	}
 
-	// Create filter function from WHERE clause
-	filter := createFilterFunc(stmt.WhereClause())
+	return &executionResult{
+		resultType:   types.ResultSuccess,
+		rowsAffected: compiled.modify.RowsAffected(),
+	}, nil
+}
 
-	// Execute the select
-	rows, err := e.storage.Select(tableName, stmt.Columns(), filter)
+// executeSelect executes a SELECT statement
+func (e *Executor) executeSelect(stmt parser.SelectStatement) (Result, error) {
+	p := newPlanner(e.catalog, e.storage, false)
+	compiled, err := p.planStatement(stmt)
+	if err != nil {
+		return &executionResult{
+			resultType: types.ResultError,
+			err:        err,
+		}, nil
+	}
+
+	rows, err := drain(compiled.root)
 	if err != nil {
 		return &executionResult{
 			resultType: types.ResultError,
@@ -304,21 +489,27 @@ func (e *Executor) executeSelect(stmt parser.SelectStatement) (Result, error) {
 
 	return &executionResult{
 		resultType: types.ResultRows,
-		rows:       rows,
+		columns:    compiled.columns,
+		rows:       &rowSliceIterator{rows: rows},
 	}, nil
 }
 
 // Helper functions
 
 // createFilterFunc creates a filter function from an expression
-func createFilterFunc(expr parser.Expression) storage.FilterFunc {
+func createFilterFunc(ctx parser.EvalContext, expr parser.Expression) storage.FilterFunc {
 	return func(row storage.Row) (bool, error) {
 		// Evaluate the expression with the current row
-		result, err := expr.Eval(row)
+		result, err := expr.Eval(ctx, row)
 		if err != nil {
 			return false, err
 		}
 
+		// A NULL condition does not match
+		if isNull, _ := result.AsNull(); isNull {
+			return false, nil
+		}
+
 		// Check if the result is a boolean true
 		boolVal, err := result.AsBool()
 		if err != nil {
@@ -331,8 +522,8 @@ func createFilterFunc(expr parser.Expression) storage.FilterFunc {
 
 // evaluateExpression evaluates an expression using the given row context
 // For literals, the row context is not needed
-func evaluateExpression(expr parser.Expression, row storage.Row) (parser.Value, error) {
-	return expr.Eval(row)
+func evaluateExpression(ctx parser.EvalContext, expr parser.Expression, row storage.Row) (parser.Value, error) {
+	return expr.Eval(ctx, row)
 }
 
 // executionResult is the result of executing a statement
@@ -340,6 +531,7 @@ type executionResult struct {
 	resultType   types.ResultType
 	rowsAffected int
 	rows         storage.RowIterator
+	columns      []string
 	err          error
 }
 
@@ -355,6 +547,10 @@ func (r *executionResult) Rows() storage.RowIterator {
 	return r.rows
 }
 
+func (r *executionResult) Columns() []string {
+	return r.columns
+}
+
 func (r *executionResult) Error() error {
 	return r.err
 }
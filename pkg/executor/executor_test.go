@@ -1,6 +1,10 @@
 package executor
 
 import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
@@ -32,6 +36,10 @@ func (s *mockCreateTableStmt) Columns() []parser.ColumnDefinition {
 	return s.columns
 }
 
+func (s *mockCreateTableStmt) Constraints() []parser.TableConstraint {
+	return nil
+}
+
 type mockDropTableStmt struct {
 	mockStatement
 	tableName string
@@ -56,8 +64,14 @@ func (s *mockInsertStmt) Columns() []string {
 	return s.columns
 }
 
-func (s *mockInsertStmt) Values() [][]parser.Value {
-	return s.values
+func (s *mockInsertStmt) Values() [][]parser.Expression {
+	rows := make([][]parser.Expression, len(s.values))
+	for i, values := range s.values {
+		for _, val := range values {
+			rows[i] = append(rows[i], parser.NewLiteralExpression(val))
+		}
+	}
+	return rows
 }
 
 type mockSelectStmt struct {
@@ -67,6 +81,18 @@ type mockSelectStmt struct {
 	whereExpr parser.Expression
 }
 
+func (s *mockSelectStmt) With() []parser.CommonTableExpression {
+	return nil
+}
+
+func (s *mockSelectStmt) Distinct() bool {
+	return false
+}
+
+func (s *mockSelectStmt) DistinctOn() []parser.Expression {
+	return nil
+}
+
 func (s *mockSelectStmt) TableName() string {
 	return s.tableName
 }
@@ -79,6 +105,42 @@ func (s *mockSelectStmt) WhereClause() parser.Expression {
 	return s.whereExpr
 }
 
+func (s *mockSelectStmt) TableAlias() string {
+	return ""
+}
+
+func (s *mockSelectStmt) TableArgs() []parser.Expression {
+	return nil
+}
+
+func (s *mockSelectStmt) Items() []parser.SelectItem {
+	return nil
+}
+
+func (s *mockSelectStmt) Joins() []parser.JoinClause {
+	return nil
+}
+
+func (s *mockSelectStmt) GroupBy() []parser.Expression {
+	return nil
+}
+
+func (s *mockSelectStmt) Having() parser.Expression {
+	return nil
+}
+
+func (s *mockSelectStmt) OrderBy() []parser.OrderByItem {
+	return nil
+}
+
+func (s *mockSelectStmt) Limit() (int64, bool) {
+	return 0, false
+}
+
+func (s *mockSelectStmt) Offset() int64 {
+	return 0
+}
+
 type mockColumnDefinition struct {
 	name        string
 	dataType    types.DataType
@@ -97,11 +159,27 @@ func (c *mockColumnDefinition) Constraints() []types.Constraint {
 	return c.constraints
 }
 
+func (c *mockColumnDefinition) TypeParams() []int {
+	return nil
+}
+
+func (c *mockColumnDefinition) TypeName() string {
+	return c.dataType.String()
+}
+
+func (c *mockColumnDefinition) Collation() parser.Collation {
+	return parser.CollateBinary
+}
+
+func (c *mockColumnDefinition) Default() parser.Expression {
+	return nil
+}
+
 type mockExpression struct {
 	result parser.Value
 }
 
-func (e *mockExpression) Eval(row map[string]parser.Value) (parser.Value, error) {
+func (e *mockExpression) Eval(ctx parser.EvalContext, row map[string]parser.Value) (parser.Value, error) {
 	return e.result, nil
 }
 
@@ -137,6 +215,131 @@ func (v *mockValue) AsNull() (bool, error) {
 	return v.dataType == types.TypeNull, nil
 }
 
+func (v *mockValue) AsDecimal() (parser.Decimal, error) {
+	if v.dataType == types.TypeFloat {
+		return parser.NewFloatValue(v.floatVal).AsDecimal()
+	}
+	return parser.NewDecimal(v.intVal, 0), nil
+}
+
+func (v *mockValue) AsBytes() ([]byte, error) {
+	return []byte(v.stringVal), nil
+}
+
+// testExec runs SQL text through an executor over an empty catalog and
+// memory storage
+type testExec struct {
+	t        *testing.T
+	parser   parser.Parser
+	catalog  catalog.Catalog
+	executor *Executor
+}
+
+func newTestExec(t *testing.T) *testExec {
+	cat := catalog.NewCatalog()
+	return &testExec{
+		t:        t,
+		parser:   parser.NewParser(),
+		catalog:  cat,
+		executor: NewExecutor(cat, storage.NewMemoryStorage()),
+	}
+}
+
+// run executes a statement, which may fail with a result of type ResultError
+func (e *testExec) run(sql string) Result {
+	e.t.Helper()
+	stmt, err := e.parser.Parse(sql)
+	if err != nil {
+		e.t.Fatalf("Parse(%s) error = %v", sql, err)
+	}
+	result, err := e.executor.Execute(stmt)
+	if err != nil {
+		e.t.Fatalf("Execute(%s) error = %v", sql, err)
+	}
+	return result
+}
+
+// exec executes a statement that has to succeed
+func (e *testExec) exec(sql string) Result {
+	e.t.Helper()
+	result := e.run(sql)
+	if result.Type() == types.ResultError {
+		e.t.Fatalf("Execute(%s) failed: %v", sql, result.Error())
+	}
+	return result
+}
+
+// count returns the number of rows a query returns
+func (e *testExec) count(sql string) int {
+	e.t.Helper()
+	rows := e.exec(sql).Rows()
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	return n
+}
+
+// query returns the rows of a query formatted as "v1,v2" in column order
+func (e *testExec) query(sql string) []string {
+	e.t.Helper()
+	result := e.exec(sql)
+	var lines []string
+	rows := result.Rows()
+	defer rows.Close()
+	for rows.Next() {
+		var values []string
+		for _, col := range result.Columns() {
+			values = append(values, fmt.Sprint(rows.Row()[col]))
+		}
+		lines = append(lines, strings.Join(values, ","))
+	}
+	return lines
+}
+
+// setup executes statements that have to succeed
+func (e *testExec) setup(sqls ...string) {
+	e.t.Helper()
+	for _, sql := range sqls {
+		e.exec(sql)
+	}
+}
+
+// queryTest is a query and the rows it returns, formatted as by query
+type queryTest struct {
+	sql  string
+	want []string
+}
+
+// expect checks the rows every query returns
+func (e *testExec) expect(tests []queryTest) {
+	e.t.Helper()
+	for _, tt := range tests {
+		if got := e.query(tt.sql); strings.Join(got, "; ") != strings.Join(tt.want, "; ") {
+			e.t.Errorf("%s\n got %v\nwant %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+// expectErrors checks that every statement fails
+func (e *testExec) expectErrors(sqls ...string) {
+	e.t.Helper()
+	for _, sql := range sqls {
+		if e.run(sql).Type() != types.ResultError {
+			e.t.Errorf("Execute(%s) succeeded, want error", sql)
+		}
+	}
+}
+
+// expectError checks that a statement fails with an error containing text
+func (e *testExec) expectError(sql, text string) {
+	e.t.Helper()
+	if err := e.run(sql).Error(); err == nil || !strings.Contains(err.Error(), text) {
+		e.t.Errorf("Execute(%s) error = %v, want one containing %s", sql, err, text)
+	}
+}
+
 func TestExecuteCreateTable(t *testing.T) {
 	cat := catalog.NewCatalog()
 	store := storage.NewMemoryStorage()
@@ -326,3 +529,1493 @@ func TestExecuteDropTable(t *testing.T) {
 		t.Errorf("Table 'users' still found in catalog after drop")
 	}
 }
+
+func TestPlanAccess(t *testing.T) {
+	cat := catalog.NewCatalog()
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+		&mockColumnDefinition{name: "email", dataType: types.TypeString, constraints: []types.Constraint{types.ConstraintUnique}},
+		&mockColumnDefinition{name: "city", dataType: types.TypeString},
+		&mockColumnDefinition{name: "age", dataType: types.TypeInt},
+		&mockColumnDefinition{name: "score", dataType: types.TypeFloat},
+	}
+	if err := cat.CreateTable("users", columns); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := cat.CreateIndex(catalog.Index{Name: "users_city_age", Table: "users", Columns: []string{"city", "age"}}); err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+	schema, _ := cat.GetTable("users")
+
+	tests := []struct {
+		where      string
+		wantMethod accessMethod
+		wantIndex  string
+	}{
+		{"id = 1", accessPointLookup, "users_pkey"},
+		{"1 = id", accessPointLookup, "users_pkey"},
+		{"id = '7'", accessPointLookup, "users_pkey"},
+		{"email = 'a@example.com'", accessPointLookup, "users_email_key"},
+		{"id > 10 AND id <= 20", accessRangeScan, "users_pkey"},
+		{"city = 'Oslo'", accessRangeScan, "users_city_age"},
+		{"city = 'Oslo' AND age > 30", accessRangeScan, "users_city_age"},
+		{"city = 'Oslo' AND id = 3", accessPointLookup, "users_pkey"},
+		{"age > 30", accessFullScan, ""},
+		{"id = 1 OR id = 2", accessFullScan, ""},
+		{"id = age", accessFullScan, ""},
+		{"id = 1.5", accessFullScan, ""},
+		{"NOT id = 1", accessFullScan, ""},
+		{"score > 1", accessFullScan, ""},
+		{"id IN (3, 1, 2)", accessPointLookup, "users_pkey"},
+		{"id IN (1, NULL)", accessPointLookup, "users_pkey"},
+		{"id IN (1, 1.5)", accessFullScan, ""},
+		{"id IN (1, age)", accessFullScan, ""},
+		{"id NOT IN (1, 2)", accessFullScan, ""},
+		{"city IN ('Oslo', 'Bergen')", accessRangeScan, "users_city_age"},
+		{"city = 'Oslo' AND age IN (30, 40)", accessRangeScan, "users_city_age"},
+		{"id BETWEEN 10 AND 20", accessRangeScan, "users_pkey"},
+		{"id NOT BETWEEN 10 AND 20", accessFullScan, ""},
+		{"email LIKE 'a%'", accessRangeScan, "users_email_key"},
+		{"email LIKE 'a!%%' ESCAPE '!'", accessRangeScan, "users_email_key"},
+		{"email LIKE '%a'", accessFullScan, ""},
+		{"email ILIKE 'a%'", accessFullScan, ""},
+		{"email NOT LIKE 'a%'", accessFullScan, ""},
+	}
+
+	p := parser.NewParser()
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			stmt, err := p.Parse("SELECT * FROM users WHERE " + tt.where)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			plan := planAccess(schema, cat.TableIndexes("users"), stmt.(parser.SelectStatement).WhereClause())
+			if plan.method != tt.wantMethod {
+				t.Errorf("method = %v, want %v", plan.method, tt.wantMethod)
+			}
+			if plan.path.Index != tt.wantIndex {
+				t.Errorf("index = %q, want %q", plan.path.Index, tt.wantIndex)
+			}
+		})
+	}
+
+	// An IN list reads one range per distinct value, in key order, and a
+	// prefix LIKE the strings from the prefix up to the next prefix
+	ranges := map[string]string{
+		"id IN (3, 1, 2, 3)":                "[1]..[1] [2]..[2] [3]..[3]",
+		"email LIKE 'ab_c%'":                "['ab']..['ac')",
+		"id BETWEEN 20 AND 10":              "[20]..[10]",
+		"city = 'Oslo' AND age IN (40, 30)": "['Oslo' 30]..['Oslo' 30] ['Oslo' 40]..['Oslo' 40]",
+	}
+	for where, want := range ranges {
+		stmt, err := p.Parse("SELECT * FROM users WHERE " + where)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		plan := planAccess(schema, cat.TableIndexes("users"), stmt.(parser.SelectStatement).WhereClause())
+		var got []string
+		for _, r := range plan.path.Ranges {
+			high := fmt.Sprint(r.High)
+			if !r.HighInclusive {
+				high = strings.TrimSuffix(high, "]") + ")"
+			}
+			got = append(got, fmt.Sprint(r.Low)+".."+high)
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("ranges for %s = %s, want %s", where, strings.Join(got, " "), want)
+		}
+	}
+}
+
+func TestExecuteWithIndexes(t *testing.T) {
+	db := newTestExec(t)
+	db.exec("CREATE TABLE items (id INT PRIMARY KEY, category TEXT, price INT)")
+	for i := 1; i <= 20; i++ {
+		category := "odd"
+		if i%2 == 0 {
+			category = "even"
+		}
+		db.exec(fmt.Sprintf("INSERT INTO items VALUES (%d, '%s', %d)", i, category, i*10))
+	}
+	db.exec("CREATE INDEX items_category ON items (category)")
+
+	if n := db.count("SELECT * FROM items WHERE id = 7"); n != 1 {
+		t.Errorf("point lookup returned %d rows, want 1", n)
+	}
+	if n := db.count("SELECT * FROM items WHERE id >= 5 AND id < 10"); n != 5 {
+		t.Errorf("range scan returned %d rows, want 5", n)
+	}
+	if n := db.count("SELECT * FROM items WHERE category = 'even' AND price > 100"); n != 5 {
+		t.Errorf("index scan with residual filter returned %d rows, want 5", n)
+	}
+
+	if affected := db.exec("UPDATE items SET category = 'odd' WHERE id = 2").RowsAffected(); affected != 1 {
+		t.Errorf("UPDATE affected %d rows, want 1", affected)
+	}
+	if n := db.count("SELECT * FROM items WHERE category = 'even'"); n != 9 {
+		t.Errorf("index after UPDATE returned %d rows, want 9", n)
+	}
+
+	if affected := db.exec("DELETE FROM items WHERE id > 15").RowsAffected(); affected != 5 {
+		t.Errorf("DELETE affected %d rows, want 5", affected)
+	}
+	if n := db.count("SELECT * FROM items WHERE category = 'odd'"); n != 9 {
+		t.Errorf("index after DELETE returned %d rows, want 9", n)
+	}
+
+	// A condition with a misspelled column is an error, not a match of no
+	// rows
+	db.expectErrors(
+		"UPDATE items SET category = 'odd' WHERE categroy = 'even'",
+		"DELETE FROM items WHERE categroy = 'even'",
+	)
+
+	db.exec("DROP INDEX items_category")
+	db.expectErrors("DROP INDEX items_pkey")
+}
+
+func TestExecuteExplain(t *testing.T) {
+	db := newTestExec(t)
+
+	explain := func(sql string) []storage.Row {
+		rows := db.exec(sql).Rows()
+		var plan []storage.Row
+		for rows.Next() {
+			plan = append(plan, rows.Row())
+		}
+		rows.Close()
+		return plan
+	}
+	text := func(row storage.Row, column string) string {
+		s, _ := row[column].AsString()
+		return s
+	}
+	number := func(row storage.Row, column string) int64 {
+		n, _ := row[column].AsInt()
+		return n
+	}
+
+	db.exec("CREATE TABLE items (id INT PRIMARY KEY, category TEXT, price INT)")
+	for i := 1; i <= 10; i++ {
+		db.exec(fmt.Sprintf("INSERT INTO items VALUES (%d, 'c%d', %d)", i, i%3, i*10))
+	}
+
+	plan := explain("EXPLAIN SELECT id FROM items WHERE id = 4 AND price > 20")
+	wantOperators := []string{"Project", "-> Filter", "  -> IndexScan"}
+	if len(plan) != len(wantOperators) {
+		t.Fatalf("EXPLAIN returned %d rows, want %d", len(plan), len(wantOperators))
+	}
+	for i, want := range wantOperators {
+		if got := text(plan[i], "operator"); got != want {
+			t.Errorf("operator %d = %q, want %q", i, got, want)
+		}
+	}
+	if got := text(plan[1], "detail"); got != "id = 4 AND price > 20" {
+		t.Errorf("Filter detail = %q", got)
+	}
+	if got := text(plan[2], "detail"); got != "items using items_pkey (point lookup)" {
+		t.Errorf("IndexScan detail = %q", got)
+	}
+	if got := number(plan[2], "estimated_rows"); got != 1 {
+		t.Errorf("point lookup estimated_rows = %d, want 1", got)
+	}
+	if _, ok := plan[0]["actual_rows"]; ok {
+		t.Errorf("EXPLAIN without ANALYZE reported actual rows")
+	}
+
+	plan = explain("EXPLAIN SELECT * FROM items")
+	if len(plan) != 2 || text(plan[1], "detail") != "items (full scan)" {
+		t.Errorf("EXPLAIN of an unfiltered SELECT = %v", plan)
+	}
+
+	plan = explain("EXPLAIN ANALYZE SELECT * FROM items WHERE price >= 50")
+	wantActual := []int64{6, 6, 10}
+	for i, want := range wantActual {
+		if got := number(plan[i], "actual_rows"); got != want {
+			t.Errorf("%s actual_rows = %d, want %d", text(plan[i], "operator"), got, want)
+		}
+		if _, ok := plan[i]["time_ms"]; !ok {
+			t.Errorf("%s has no time_ms", text(plan[i], "operator"))
+		}
+	}
+
+	// EXPLAIN does not run the statement, EXPLAIN ANALYZE does
+	explain("EXPLAIN DELETE FROM items WHERE id > 8")
+	if n := number(explain("EXPLAIN ANALYZE SELECT * FROM items")[1], "actual_rows"); n != 10 {
+		t.Errorf("rows left after EXPLAIN DELETE = %d, want 10", n)
+	}
+	plan = explain("EXPLAIN ANALYZE DELETE FROM items WHERE id > 8")
+	if text(plan[0], "operator") != "Delete" || number(plan[0], "actual_rows") != 2 {
+		t.Errorf("EXPLAIN ANALYZE DELETE = %v", plan)
+	}
+	if affected := db.exec("DELETE FROM items WHERE id > 8").RowsAffected(); affected != 0 {
+		t.Errorf("rows left for DELETE after EXPLAIN ANALYZE = %d, want 0", affected)
+	}
+
+	plan = explain("EXPLAIN INSERT INTO items VALUES (11, 'c2', 110), (12, 'c0', 120)")
+	if len(plan) != 2 || text(plan[0], "operator") != "Insert" || number(plan[1], "estimated_rows") != 2 {
+		t.Errorf("EXPLAIN INSERT = %v", plan)
+	}
+}
+
+func TestExecuteAnalyze(t *testing.T) {
+	db := newTestExec(t)
+
+	// plan returns the operator, detail and estimate of each EXPLAIN row
+	plan := func(sql string) []string {
+		rows := db.exec("EXPLAIN " + sql).Rows()
+		defer rows.Close()
+		var lines []string
+		for rows.Next() {
+			row := rows.Row()
+			operator, _ := row["operator"].AsString()
+			detail, _ := row["detail"].AsString()
+			estimate, _ := row["estimated_rows"].AsInt()
+			lines = append(lines, fmt.Sprintf("%s | %s | %d", strings.TrimLeft(operator, " ->"), detail, estimate))
+		}
+		return lines
+	}
+
+	db.exec("CREATE TABLE items (id INT PRIMARY KEY, category TEXT, price INT)")
+	db.exec("CREATE INDEX items_price ON items (price)")
+	db.exec("CREATE TABLE tags (item_id INT, tag TEXT)")
+	for i := 1; i <= 100; i++ {
+		category := fmt.Sprintf("'c%d'", i%4)
+		if i%10 == 0 {
+			category = "NULL"
+		}
+		db.exec(fmt.Sprintf("INSERT INTO items VALUES (%d, %s, %d)", i, category, i))
+	}
+	db.exec("INSERT INTO tags VALUES (1, 'new'), (2, 'sale'), (3, 'sale')")
+
+	// Without statistics every range looks narrow enough for the index
+	if got := plan("SELECT id FROM items WHERE price > 10")[2]; got != "IndexScan | items using items_price (range scan) | 333" {
+		t.Errorf("scan before ANALYZE = %q", got)
+	}
+
+	db.exec("ANALYZE items")
+	schema, _ := db.catalog.GetTable("items")
+	stats, ok := schema.Stats()
+	if !ok || stats.RowCount != 100 {
+		t.Fatalf("Stats() = %+v, %v, want 100 rows", stats, ok)
+	}
+	category := stats.Columns["category"]
+	if category.DistinctCount != 4 || category.NullFraction != 0.1 {
+		t.Errorf("category stats = %+v, want 4 distinct values and 10%% NULLs", category)
+	}
+	price := stats.Columns["price"]
+	if len(price.Histogram) != histogramBuckets+1 {
+		t.Fatalf("price histogram has %d bounds, want %d", len(price.Histogram), histogramBuckets+1)
+	}
+	if low, _ := price.Histogram[0].AsInt(); low != 1 {
+		t.Errorf("price histogram starts at %d, want 1", low)
+	}
+	if high, _ := price.Histogram[histogramBuckets].AsInt(); high != 100 {
+		t.Errorf("price histogram ends at %d, want 100", high)
+	}
+	tags, _ := db.catalog.GetTable("tags")
+	if _, ok := tags.Stats(); ok {
+		t.Errorf("ANALYZE items also analyzed tags")
+	}
+
+	// With statistics, a wide range is cheaper to read with a full scan
+	tests := []struct {
+		sql  string
+		scan string
+	}{
+		{"SELECT id FROM items WHERE price > 10", "Scan | items (full scan) | 100"},
+		{"SELECT id FROM items WHERE price > 90", "IndexScan | items using items_price (range scan) | 8"},
+		{"SELECT id FROM items WHERE price >= 20 AND price < 30", "IndexScan | items using items_price (range scan) | 10"},
+	}
+	for _, tt := range tests {
+		if got := plan(tt.sql)[2]; got != tt.scan {
+			t.Errorf("%s: scan = %q, want %q", tt.sql, got, tt.scan)
+		}
+	}
+	if got := plan("SELECT id FROM items WHERE category = 'c1'")[1]; got != "Filter | category = 'c1' | 23" {
+		t.Errorf("equality estimate = %q", got)
+	}
+	if got := plan("SELECT category, COUNT(*) FROM items GROUP BY category")[1]; got != "Aggregate | group by category: COUNT(*) | 5" {
+		t.Errorf("group estimate = %q", got)
+	}
+
+	// The smaller table is the build side once both tables are analyzed
+	db.exec("ANALYZE")
+	wantJoin := []string{
+		"Project | i.id AS id, tag | 3",
+		"HashJoin | inner join on t.item_id = i.id | 3",
+		"Scan | items (full scan) | 100",
+		"Scan | tags (full scan) | 3",
+	}
+	got := plan("SELECT i.id, tag FROM items i JOIN tags t ON t.item_id = i.id")
+	if strings.Join(got, "\n") != strings.Join(wantJoin, "\n") {
+		t.Errorf("join plan =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(wantJoin, "\n"))
+	}
+	rows := db.run("SELECT i.id, tag FROM items i JOIN tags t ON t.item_id = i.id").Rows()
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	rows.Close()
+	if count != 3 {
+		t.Errorf("join returned %d rows, want 3", count)
+	}
+
+	db.expectErrors("ANALYZE missing")
+}
+
+func TestExecuteQueryOperators(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT, city TEXT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+		"INSERT INTO users VALUES (1, 'Alice', 'Oslo'), (2, 'Bob', 'Bergen'), (3, 'Carol', 'Oslo'), (4, 'Dan', NULL)",
+		"INSERT INTO orders VALUES (10, 1, 50), (11, 1, 20), (12, 2, 70), (13, 9, 5)",
+	)
+
+	db.expect([]queryTest{
+		{"SELECT name FROM users ORDER BY name DESC", []string{"'Dan'", "'Carol'", "'Bob'", "'Alice'"}},
+		{"SELECT id, city FROM users ORDER BY city, id DESC", []string{"2,'Bergen'", "3,'Oslo'", "1,'Oslo'", "4,NULL"}},
+		{"SELECT id FROM users ORDER BY id LIMIT 2 OFFSET 1", []string{"2", "3"}},
+		{"SELECT id AS key FROM users ORDER BY key DESC LIMIT 1", []string{"4"}},
+		{"SELECT city, COUNT(*) AS n FROM users GROUP BY city ORDER BY n DESC, city", []string{"'Oslo',2", "'Bergen',1", "NULL,1"}},
+		{"SELECT COUNT(*), COUNT(city), COUNT(DISTINCT city), MIN(name), MAX(id) FROM users", []string{"4,3,2,'Alice',4"}},
+		{"SELECT SUM(amount), AVG(amount) FROM orders WHERE amount > 100", []string{"NULL,NULL"}},
+		{"SELECT city FROM users GROUP BY city HAVING COUNT(*) > 1", []string{"'Oslo'"}},
+		{"SELECT u.name, o.amount FROM users u JOIN orders o ON o.user_id = u.id ORDER BY o.amount", []string{"'Alice',20", "'Alice',50", "'Bob',70"}},
+		{"SELECT u.name, SUM(o.amount) FROM users u LEFT JOIN orders o ON o.user_id = u.id GROUP BY u.name ORDER BY 1", []string{"'Alice',70", "'Bob',70", "'Carol',NULL", "'Dan',NULL"}},
+		{"SELECT users.id, orders.id FROM users, orders WHERE users.id = orders.user_id AND orders.amount < 60 ORDER BY 2", []string{"1,10", "1,11"}},
+		{"SELECT COUNT(*) FROM users CROSS JOIN orders", []string{"16"}},
+	})
+
+	// Output column names
+	if columns := db.run("SELECT * FROM users u JOIN orders o ON o.user_id = u.id").Columns(); strings.Join(columns, ",") != "u.id,name,city,o.id,user_id,amount" {
+		t.Errorf("SELECT * over a join has columns %v", columns)
+	}
+
+	db.expectErrors(
+		"SELECT name FROM users GROUP BY city",
+		"SELECT id FROM users u JOIN orders o ON o.user_id = u.id",
+		"SELECT COUNT(*) FROM users WHERE COUNT(*) > 1",
+		"SELECT SUM(COUNT(*)) FROM users",
+		"SELECT LOWER(id) FROM users",
+		"SELECT x.id FROM users",
+		"SELECT * FROM users JOIN users ON id = id",
+		"SELECT id FROM users ORDER BY 3",
+		"SELECT * FROM missing",
+		// An unknown column is an error even next to one that resolves
+		"SELECT name FROM users WHERE nosuch = id",
+		"SELECT u.name FROM users u JOIN orders o ON u.nosuch = o.user_id",
+	)
+}
+
+func TestExecuteSubqueries(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT, city TEXT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+		"INSERT INTO users VALUES (1, 'Alice', 'Oslo'), (2, 'Bob', 'Bergen'), (3, 'Carol', 'Oslo'), (4, 'Dan', NULL)",
+		"INSERT INTO orders VALUES (10, 1, 50), (11, 1, 20), (12, 2, 70), (13, NULL, 5)",
+	)
+
+	db.expect([]queryTest{
+		{"SELECT name FROM users WHERE id IN (SELECT user_id FROM orders) ORDER BY id", []string{"'Alice'", "'Bob'"}},
+		// NULL among the subquery rows makes NOT IN NULL for every non-match
+		{"SELECT name FROM users WHERE id NOT IN (SELECT user_id FROM orders)", nil},
+		{"SELECT name FROM users WHERE id NOT IN (SELECT user_id FROM orders WHERE amount > 10) ORDER BY id", []string{"'Carol'", "'Dan'"}},
+		{"SELECT name FROM users u WHERE EXISTS (SELECT * FROM orders o WHERE o.user_id = u.id AND o.amount > 60)", []string{"'Bob'"}},
+		{"SELECT name FROM users u WHERE NOT EXISTS (SELECT * FROM orders o WHERE o.user_id = u.id) ORDER BY id", []string{"'Carol'", "'Dan'"}},
+		{"SELECT name FROM users u WHERE EXISTS (SELECT * FROM orders o WHERE o.user_id < u.id) ORDER BY id", []string{"'Bob'", "'Carol'", "'Dan'"}},
+		{"SELECT name, (SELECT COUNT(*) FROM orders o WHERE o.user_id = u.id) AS n FROM users u ORDER BY id", []string{"'Alice',2", "'Bob',1", "'Carol',0", "'Dan',0"}},
+		{"SELECT name FROM users WHERE id = (SELECT MAX(user_id) FROM orders)", []string{"'Bob'"}},
+		{"SELECT u.name, o.amount FROM users u JOIN orders o ON o.user_id = u.id WHERE o.amount = (SELECT MAX(amount) FROM orders o2 WHERE o2.user_id = u.id) ORDER BY 2", []string{"'Alice',50", "'Bob',70"}},
+		{"SELECT city FROM users GROUP BY city HAVING COUNT(*) > (SELECT COUNT(*) FROM orders WHERE user_id = 2)", []string{"'Oslo'"}},
+		// Columns of queries further out are visible too
+		{"SELECT name FROM users u WHERE EXISTS (SELECT * FROM orders o WHERE o.user_id = u.id AND EXISTS (SELECT * FROM users u2 WHERE u2.id = o.user_id AND u2.city = u.city))", []string{"'Alice'", "'Bob'"}},
+	})
+
+	// IN and correlated EXISTS run as semi joins; other subqueries run per row
+	plans := []struct {
+		sql  string
+		want []string
+	}{
+		{"SELECT name FROM users WHERE id IN (SELECT user_id FROM orders)", []string{"HashSemiJoin"}},
+		{"SELECT name FROM users u WHERE NOT EXISTS (SELECT * FROM orders o WHERE o.user_id = u.id)", []string{"HashAntiJoin"}},
+		{"SELECT name, (SELECT COUNT(*) FROM orders o WHERE o.user_id = u.id) FROM users u WHERE id > (SELECT MIN(user_id) FROM orders)", []string{"InitPlan 1", "SubPlan 2"}},
+	}
+	for _, tt := range plans {
+		var operators []string
+		for _, line := range db.query("EXPLAIN " + tt.sql) {
+			operators = append(operators, strings.TrimLeft(strings.Split(line, ",")[0], "' ->"))
+		}
+		for _, want := range tt.want {
+			found := false
+			for _, op := range operators {
+				found = found || strings.TrimSuffix(op, "'") == want
+			}
+			if !found {
+				t.Errorf("EXPLAIN %s has operators %v, want %s", tt.sql, operators, want)
+			}
+		}
+	}
+
+	// UPDATE and DELETE conditions can use subqueries too
+	if result := db.exec("UPDATE orders SET amount = 0 WHERE user_id IN (SELECT id FROM users WHERE city = 'Bergen')"); result.RowsAffected() != 1 {
+		t.Errorf("UPDATE affected %d rows, want 1", result.RowsAffected())
+	}
+	if result := db.exec("DELETE FROM users WHERE NOT EXISTS (SELECT * FROM orders WHERE orders.user_id = users.id)"); result.RowsAffected() != 2 {
+		t.Errorf("DELETE affected %d rows, want 2", result.RowsAffected())
+	}
+	if got := db.query("SELECT name, (SELECT SUM(amount) FROM orders WHERE user_id = users.id) FROM users ORDER BY id"); strings.Join(got, ";") != "'Alice',70;'Bob',0" {
+		t.Errorf("after UPDATE and DELETE got %v", got)
+	}
+
+	// Rows whose values only differ in where their NULLs are stay apart
+	db.exec("CREATE TABLE pairs (a INT, b INT)")
+	db.exec("INSERT INTO pairs VALUES (1, NULL), (NULL, 1)")
+	if result := db.exec("DELETE FROM pairs WHERE a = (SELECT MIN(a) FROM pairs)"); result.RowsAffected() != 1 {
+		t.Errorf("DELETE affected %d rows, want 1", result.RowsAffected())
+	}
+	if got := db.query("SELECT a, b FROM pairs"); strings.Join(got, ";") != "NULL,1" {
+		t.Errorf("after DELETE of (1, NULL) got %v", got)
+	}
+
+	db.expectErrors(
+		"SELECT name FROM users WHERE id = (SELECT user_id FROM orders)",
+		"SELECT name FROM users WHERE id IN (SELECT user_id, amount FROM orders)",
+		"SELECT name FROM users WHERE id IN (SELECT missing FROM orders)",
+		"SELECT name FROM users WHERE EXISTS (SELECT * FROM missing)",
+	)
+}
+
+func TestExecuteCTEs(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE staff (id INT PRIMARY KEY, name TEXT, manager INT)",
+		"INSERT INTO staff VALUES (1, 'Ann', 0), (2, 'Bob', 1), (3, 'Cid', 1), (4, 'Dee', 2), (5, 'Eve', 4), (6, 'Fay', 0)",
+		"CREATE TABLE links (src INT, dst INT)",
+		"INSERT INTO links VALUES (1, 2), (2, 3), (3, 1), (3, 4)",
+	)
+
+	db.expect([]queryTest{
+		{"WITH top AS (SELECT id, name FROM staff WHERE manager = 0) SELECT name FROM top ORDER BY id", []string{"'Ann'", "'Fay'"}},
+		// Later CTEs read earlier ones, and a CTE can be read more than once
+		{`WITH reports AS (SELECT manager, COUNT(*) AS n FROM staff GROUP BY manager),
+			busy (who) AS (SELECT manager FROM reports WHERE n > 1)
+			SELECT s.name, r.n FROM staff s JOIN reports r ON r.manager = s.id WHERE s.id IN (SELECT who FROM busy)`, []string{"'Ann',2"}},
+		{"WITH s AS (SELECT id FROM staff) SELECT a.id, b.id FROM s a JOIN s b ON b.id = a.id + 4", []string{"1,5", "2,6"}},
+		// A CTE hides a table of the same name
+		{"WITH links AS (SELECT id AS src FROM staff WHERE id = 6) SELECT src FROM links", []string{"6"}},
+		// CTEs are visible in subqueries, which can also have their own
+		{"WITH top AS (SELECT id FROM staff WHERE manager = 0) SELECT name FROM staff WHERE manager IN (SELECT id FROM top) ORDER BY id", []string{"'Bob'", "'Cid'"}},
+		{"SELECT name FROM staff WHERE id = (WITH m AS (SELECT manager FROM staff WHERE name = 'Eve') SELECT manager FROM m)", []string{"'Dee'"}},
+		// Everyone below Ann, with their depth and path
+		{`WITH RECURSIVE chain (id, name, depth, path) AS (
+				SELECT id, name, 0, name AS root FROM staff WHERE name = 'Ann'
+				UNION ALL
+				SELECT s.id, s.name, c.depth + 1, c.path || '/' || s.name FROM staff s JOIN chain c ON s.manager = c.id
+			) SELECT name, depth, path FROM chain ORDER BY path`,
+			[]string{"'Ann',0,'Ann'", "'Bob',1,'Ann/Bob'", "'Dee',2,'Ann/Bob/Dee'", "'Eve',3,'Ann/Bob/Dee/Eve'", "'Cid',1,'Ann/Cid'"}},
+		{"WITH RECURSIVE n (x) AS (SELECT 1 FROM staff WHERE id = 1 UNION ALL SELECT x + 1 FROM n WHERE x < 5) SELECT SUM(x) FROM n", []string{"15"}},
+		// UNION drops rows seen before, which ends the walk around a cycle
+		{"WITH RECURSIVE reach (node) AS (SELECT 1 FROM staff WHERE id = 1 UNION SELECT l.dst FROM links l JOIN reach r ON l.src = r.node) SELECT node FROM reach ORDER BY node", []string{"1", "2", "3", "4"}},
+		// A recursive term that does not read the CTE adds its rows once
+		{"WITH RECURSIVE r (id) AS (SELECT id FROM staff WHERE id = 1 UNION ALL SELECT id FROM staff WHERE id = 2) SELECT id FROM r", []string{"1", "2"}},
+	})
+
+	var operators []string
+	for _, line := range db.query("EXPLAIN WITH RECURSIVE r (id) AS (SELECT id FROM staff WHERE id = 1 UNION SELECT s.id FROM staff s JOIN r ON s.manager = r.id) SELECT * FROM r") {
+		operators = append(operators, strings.Trim(strings.Split(line, ",")[0], "' ->"))
+	}
+	for _, want := range []string{"CTEScan", "CTE r", "RecursiveUnion", "WorkTableScan"} {
+		found := false
+		for _, op := range operators {
+			found = found || op == want
+		}
+		if !found {
+			t.Errorf("EXPLAIN has operators %v, want %s", operators, want)
+		}
+	}
+
+	db.expectErrors(
+		"WITH a (x, y) AS (SELECT id FROM staff) SELECT * FROM a",
+		"WITH a AS (SELECT id FROM staff) SELECT name FROM a",
+		"WITH a AS (SELECT id FROM b), b AS (SELECT id FROM staff) SELECT * FROM a",
+		"WITH a AS (SELECT * FROM a) SELECT * FROM a",
+		"WITH RECURSIVE a (x) AS (SELECT id FROM staff UNION SELECT id, name FROM staff) SELECT * FROM a",
+		"WITH RECURSIVE a (x) AS (SELECT 1 FROM staff WHERE id = 1 UNION ALL SELECT x FROM a) SELECT * FROM a",
+	)
+}
+
+func TestExecuteSetOperations(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE a (id INT, name TEXT, score FLOAT)",
+		"CREATE TABLE b (id INT, label TEXT)",
+		"INSERT INTO a VALUES (1, 'x', 1.5), (2, 'y', 2.0), (2, 'y', 2.0), (3, NULL, 0.5)",
+		"INSERT INTO b VALUES (2, 'y'), (3, NULL), (4, 'w'), (3, NULL)",
+	)
+
+	db.expect([]queryTest{
+		// NULLs count as equal when rows are compared
+		{"SELECT id, name FROM a UNION SELECT id, label FROM b ORDER BY 1", []string{"1,'x'", "2,'y'", "3,NULL", "4,'w'"}},
+		{"SELECT id FROM a UNION ALL SELECT id FROM b ORDER BY id DESC LIMIT 3 OFFSET 1", []string{"3", "3", "3"}},
+		{"SELECT id, name FROM a INTERSECT SELECT id, label FROM b ORDER BY id", []string{"2,'y'", "3,NULL"}},
+		{"SELECT id FROM a INTERSECT ALL SELECT id FROM b ORDER BY id", []string{"2", "3"}},
+		{"SELECT id FROM a EXCEPT SELECT id FROM b", []string{"1"}},
+		{"SELECT id FROM a EXCEPT ALL SELECT id FROM b ORDER BY id", []string{"1", "2"}},
+		{"SELECT id FROM b EXCEPT ALL SELECT id FROM a ORDER BY id", []string{"3", "4"}},
+		// INTERSECT binds more tightly than UNION
+		{"SELECT id FROM a WHERE id = 1 UNION SELECT id FROM a INTERSECT SELECT id FROM b ORDER BY id", []string{"1", "2", "3"}},
+		{"(SELECT id FROM a WHERE id = 1 UNION SELECT id FROM a) INTERSECT SELECT id FROM b ORDER BY id", []string{"2", "3"}},
+		// INT and FLOAT columns combine into FLOAT; names come from the left query
+		{"SELECT score FROM a UNION SELECT id FROM b ORDER BY score", []string{"0.5", "1.5", "2", "3", "4"}},
+		{"(SELECT id FROM a ORDER BY id DESC LIMIT 1) UNION ALL (SELECT id FROM b ORDER BY id LIMIT 1)", []string{"3", "2"}},
+		// Compound queries work as subqueries and CTEs
+		{"SELECT name FROM a WHERE id IN (SELECT id FROM b WHERE id > 2 UNION SELECT 1 FROM b) ORDER BY id", []string{"'x'", "NULL"}},
+		{"WITH u AS (SELECT id FROM a UNION SELECT id FROM b) SELECT COUNT(*) FROM u", []string{"4"}},
+	})
+
+	db.expectErrors(
+		"SELECT id, name FROM a UNION SELECT id FROM b",
+		"SELECT id FROM a EXCEPT SELECT label FROM b",
+		"SELECT id FROM a UNION SELECT id FROM b ORDER BY id + 1",
+		"SELECT id FROM a UNION SELECT id FROM b ORDER BY 2",
+		"SELECT id FROM a UNION SELECT missing FROM b",
+	)
+}
+
+func TestExecuteDistinct(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE t (id INT, g TEXT, v INT, f FLOAT)",
+		"INSERT INTO t VALUES (1, 'a', 3, 1.0), (2, 'a', 1, 2.0), (3, 'b', 5, 1.0), (4, 'b', 5, NULL), (5, NULL, 2, NULL), (6, NULL, 7, 2.5)",
+	)
+
+	db.expect([]queryTest{
+		// NULLs are alike, and the first row in sort order is kept
+		{"SELECT DISTINCT g FROM t ORDER BY g", []string{"'a'", "'b'", "NULL"}},
+		{"SELECT DISTINCT g, v FROM t ORDER BY v DESC LIMIT 3", []string{"NULL,7", "'b',5", "'a',3"}},
+		{"SELECT DISTINCT f FROM t ORDER BY f", []string{"1", "2", "2.5", "NULL"}},
+		{"SELECT DISTINCT v * 1.0 AS x FROM t WHERE v < 4 UNION SELECT v FROM t WHERE v < 3 ORDER BY x", []string{"1", "2", "3"}},
+		{"SELECT ALL g FROM t WHERE id < 3", []string{"'a'", "'a'"}},
+		{"SELECT DISTINCT COUNT(*) AS n FROM t GROUP BY g", []string{"2"}},
+		{"SELECT COUNT(*) FROM t WHERE v IN (SELECT DISTINCT v FROM t)", []string{"6"}},
+		// DISTINCT ON keeps the first row of each group of the ORDER BY
+		{"SELECT DISTINCT ON (g) g, id FROM t ORDER BY g, v DESC", []string{"'a',1", "'b',3", "NULL,6"}},
+		{"SELECT DISTINCT ON (g) id FROM t ORDER BY g, v", []string{"2", "3", "5"}},
+		{"SELECT DISTINCT ON (1) g, v AS top FROM t ORDER BY g DESC, top DESC", []string{"NULL,7", "'b',5", "'a',3"}},
+		{"SELECT DISTINCT ON (v, g) id FROM t ORDER BY g, v, id DESC", []string{"2", "1", "4", "5", "6"}},
+		{"SELECT DISTINCT ON (COUNT(*)) COUNT(*) AS n FROM t GROUP BY g", []string{"2"}},
+	})
+
+	explain := db.query("EXPLAIN SELECT DISTINCT ON (g) g, id FROM t ORDER BY g, id")
+	if len(explain) != 4 || !strings.Contains(explain[1], "Distinct") || !strings.Contains(explain[1], "on g") {
+		t.Errorf("EXPLAIN = %v, want Distinct on g below Project", explain)
+	}
+
+	db.expectErrors(
+		"SELECT DISTINCT g FROM t ORDER BY v",
+		"SELECT DISTINCT ON (g) id FROM t ORDER BY v",
+		"SELECT DISTINCT ON (5) g FROM t",
+		"SELECT DISTINCT ON (missing) g FROM t",
+		"SELECT DISTINCT ON (v) g FROM t GROUP BY g",
+	)
+}
+
+func TestExecuteWindowFunctions(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE sales (id INT, region TEXT, amount INT)",
+		"INSERT INTO sales VALUES (1, 'east', 10), (2, 'east', 20), (3, 'east', 20), (4, 'west', 5), (5, 'west', NULL), (6, 'north', 7)",
+	)
+
+	db.expect([]queryTest{
+		// Ranking within partitions; NULL sorts first in descending order
+		{`SELECT id, ROW_NUMBER() OVER (PARTITION BY region ORDER BY amount DESC) AS rn,
+			RANK() OVER (PARTITION BY region ORDER BY amount DESC) AS r,
+			DENSE_RANK() OVER (PARTITION BY region ORDER BY amount DESC) AS dr FROM sales ORDER BY id`,
+			[]string{"1,3,3,2", "2,1,1,1", "3,2,1,1", "4,2,2,2", "5,1,1,1", "6,1,1,1"}},
+		// Running totals include the peers of the current row unless the
+		// frame counts rows
+		{`SELECT id, SUM(amount) OVER (ORDER BY id) AS running, SUM(amount) OVER (ORDER BY amount) AS peers,
+			COUNT(*) OVER (ORDER BY amount ROWS UNBOUNDED PRECEDING) AS n, COUNT(amount) OVER () AS total FROM sales ORDER BY id`,
+			[]string{"1,10,22,3,5", "2,30,62,4,5", "3,50,62,5,5", "4,55,5,1,5", "5,55,62,6,5", "6,62,12,2,5"}},
+		{`SELECT id, AVG(amount) OVER (ORDER BY id ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING) AS moving,
+			MAX(amount) OVER (ORDER BY id ROWS 2 PRECEDING) AS recent,
+			MIN(amount) OVER (ORDER BY id ROWS BETWEEN 1 FOLLOWING AND UNBOUNDED FOLLOWING) AS rest FROM sales ORDER BY id`,
+			[]string{"1,15,10,5", "2,16.666666666666668,20,5", "3,15,20,5", "4,12.5,20,7", "5,6,20,7", "6,7,7,NULL"}},
+		{`SELECT id, LAG(amount) OVER (ORDER BY id) AS prev, LEAD(amount, 2, 0) OVER (ORDER BY id) AS next,
+			FIRST_VALUE(id) OVER (PARTITION BY region ORDER BY amount) AS cheapest FROM sales ORDER BY id`,
+			[]string{"1,NULL,20,1", "2,10,5,1", "3,20,NULL,1", "4,20,7,4", "5,5,0,4", "6,NULL,0,6"}},
+		// Windows over groups, and in ORDER BY
+		{`SELECT region, SUM(amount) AS total, RANK() OVER (ORDER BY SUM(amount) DESC) AS r,
+			SUM(SUM(amount)) OVER () AS grand FROM sales GROUP BY region ORDER BY r`,
+			[]string{"'east',50,1,62", "'north',7,2,62", "'west',5,3,62"}},
+		{"SELECT id FROM sales ORDER BY ROW_NUMBER() OVER (PARTITION BY region ORDER BY id DESC), id LIMIT 3",
+			[]string{"3", "5", "6"}},
+		// Top-N per group
+		{`WITH ranked AS (SELECT region, id, ROW_NUMBER() OVER (PARTITION BY region ORDER BY amount DESC) AS rn FROM sales)
+			SELECT region, id FROM ranked WHERE rn <= 2 ORDER BY region, id`,
+			[]string{"'east',2", "'east',3", "'north',6", "'west',4", "'west',5"}},
+		{"SELECT DISTINCT region, COUNT(*) OVER (PARTITION BY region) AS n FROM sales ORDER BY region",
+			[]string{"'east',3", "'north',1", "'west',2"}},
+	})
+
+	// Calls with the same window share an operator and a sort
+	explain := db.exec(`EXPLAIN SELECT ROW_NUMBER() OVER (PARTITION BY region ORDER BY id) AS a,
+		SUM(amount) OVER (PARTITION BY region ORDER BY id) AS b, COUNT(*) OVER () AS c FROM sales`)
+	var operators []string
+	rows := explain.Rows()
+	for rows.Next() {
+		op, _ := rows.Row()["operator"].AsString()
+		operators = append(operators, strings.TrimLeft(op, "-> "))
+	}
+	rows.Close()
+	if got := strings.Join(operators, ","); got != "Project,Window,Window,Sort,Scan" {
+		t.Errorf("EXPLAIN operators = %s, want Project,Window,Window,Sort,Scan", got)
+	}
+
+	db.expectErrors(
+		"SELECT ROW_NUMBER() FROM sales",
+		"SELECT id FROM sales WHERE ROW_NUMBER() OVER () > 1",
+		"SELECT region FROM sales GROUP BY region HAVING RANK() OVER () = 1",
+		"SELECT UPPER(region) OVER () FROM sales",
+		"SELECT SUM(ROW_NUMBER() OVER ()) FROM sales",
+		"SELECT LAG(amount) OVER (ORDER BY LEAD(amount) OVER ()) FROM sales",
+		"SELECT LAG(amount, 1, 0, 1) OVER () FROM sales",
+		"SELECT RANK(id) OVER () FROM sales",
+		"SELECT SUM(DISTINCT amount) OVER () FROM sales",
+		"SELECT region, SUM(amount) OVER (ORDER BY id) FROM sales GROUP BY region",
+		"SELECT LAG(amount, 'x') OVER () FROM sales",
+	)
+}
+
+func TestExecuteConditionalExpressions(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE t (id INT, name TEXT, score FLOAT, ok BOOL, code TEXT)",
+		"INSERT INTO t VALUES (1, 'a', 1.5, TRUE, '10'), (2, NULL, NULL, FALSE, '2.5'), (3, 'c', 3.5, NULL, 'x')",
+	)
+
+	db.expect([]queryTest{
+		{"SELECT id, CASE WHEN score > 2 THEN 'high' WHEN score > 1 THEN 'mid' ELSE 'low' END AS band FROM t ORDER BY id",
+			[]string{"1,'mid'", "2,'low'", "3,'high'"}},
+		{"SELECT id, CASE id WHEN 1 THEN 'one' WHEN 2 THEN 'two' END AS w FROM t ORDER BY id",
+			[]string{"1,'one'", "2,'two'", "3,NULL"}},
+		{"SELECT id, COALESCE(name, 'none') AS n, NULLIF(id, 2) AS x FROM t ORDER BY id",
+			[]string{"1,'a',1", "2,'none',NULL", "3,'c',3"}},
+		// COALESCE of an INT and a FLOAT is a FLOAT
+		{"SELECT COALESCE(score, id) AS c FROM t ORDER BY c", []string{"1.5", "2", "3.5"}},
+		{"SELECT id, CAST(score AS INT) AS i, CAST(id AS TEXT) || '!' AS s, CAST(code AS FLOAT) AS f FROM t WHERE id < 3 ORDER BY id",
+			[]string{"1,2,'1!',10", "2,NULL,'2!',2.5"}},
+		{"SELECT SUM(CASE WHEN ok THEN 1 ELSE 0 END) AS n FROM t", []string{"1"}},
+		// Text compared with a number is read as a number
+		{"SELECT id FROM t WHERE code > 5 ORDER BY id", []string{"1"}},
+		{"SELECT id FROM t WHERE code = 2.5", []string{"2"}},
+	})
+
+	db.expectErrors(
+		"SELECT CAST(code AS INT) FROM t",
+		"SELECT CAST(ok AS FLOAT) FROM t",
+		"SELECT CASE WHEN id = 1 THEN 1 ELSE 'x' END FROM t",
+		"SELECT COALESCE(id, name) FROM t",
+		"SELECT CASE WHEN name THEN 1 END FROM t",
+	)
+}
+
+func TestExecutePredicates(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE t (id INT PRIMARY KEY, name TEXT, score FLOAT)",
+		"CREATE INDEX t_name ON t (name)",
+		"INSERT INTO t VALUES (1, 'apple', 1.5), (2, 'apricot', NULL), (3, 'banana', 3.5), (4, 'Avocado', 2.0), (5, 'a_b%c', 0.0), (6, NULL, 9.0)",
+	)
+
+	db.expect([]queryTest{
+		{"SELECT id FROM t WHERE name LIKE 'ap%' ORDER BY id", []string{"1", "2"}},
+		{"SELECT id FROM t WHERE name LIKE '_pple'", []string{"1"}},
+		{"SELECT id FROM t WHERE name LIKE '%a%a%' ORDER BY id", []string{"3"}},
+		{"SELECT id FROM t WHERE name ILIKE 'a%' ORDER BY id", []string{"1", "2", "4", "5"}},
+		{"SELECT id FROM t WHERE name NOT LIKE 'a%' ORDER BY id", []string{"3", "4"}},
+		{"SELECT id FROM t WHERE name LIKE 'a!_b!%%' ESCAPE '!'", []string{"5"}},
+		{"SELECT id FROM t WHERE id IN (3, 1, 5, 3, NULL) ORDER BY id", []string{"1", "3", "5"}},
+		{"SELECT id FROM t WHERE name IN ('banana', 'apple') ORDER BY id", []string{"1", "3"}},
+		// NOT IN with a NULL in the list is never true
+		{"SELECT id FROM t WHERE id NOT IN (1, 2, NULL)", nil},
+		{"SELECT id FROM t WHERE id NOT IN (1, 2) ORDER BY id", []string{"3", "4", "5", "6"}},
+		{"SELECT id FROM t WHERE score BETWEEN 1 AND 3 ORDER BY id", []string{"1", "4"}},
+		{"SELECT id FROM t WHERE score NOT BETWEEN 1 AND 3 ORDER BY id", []string{"3", "5", "6"}},
+		{"SELECT id FROM t WHERE id BETWEEN 2 AND 4 AND name LIKE 'a%'", []string{"2"}},
+		{"SELECT id, name LIKE 'a%' AS a, id IN (1, 2) AS low FROM t WHERE id < 4 ORDER BY id",
+			[]string{"1,TRUE,TRUE", "2,TRUE,TRUE", "3,FALSE,FALSE"}},
+	})
+
+	db.expectErrors(
+		"SELECT id FROM t WHERE id LIKE '1'",
+		"SELECT id FROM t WHERE name LIKE 'x' ESCAPE 'ab'",
+		"SELECT id FROM t WHERE name LIKE 'x!' ESCAPE '!'",
+	)
+}
+
+func TestExecuteScalarFunctions(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE t (id INT PRIMARY KEY, name TEXT, score FLOAT)",
+		"INSERT INTO t VALUES (1, '  Apple ', 1.5), (2, 'héllo', -2.5), (3, NULL, 9.0), (-4, 'banana', 2.25)",
+	)
+
+	db.expect([]queryTest{
+		{"SELECT id, UPPER(TRIM(name)) AS u, LENGTH(name) AS n FROM t ORDER BY id",
+			[]string{"-4,'BANANA',6", "1,'APPLE',8", "2,'HÉLLO',5", "3,NULL,NULL"}},
+		{"SELECT ABS(id), ROUND(score), FLOOR(score), CEIL(score) FROM t ORDER BY id",
+			[]string{"4,2,2,3", "1,2,1,2", "2,-3,-3,-2", "3,9,9,9"}},
+		{"SELECT id FROM t WHERE INSTR(name, 'an') > 0 OR MOD(id, 2) = 0 ORDER BY ABS(id) DESC", []string{"-4", "2"}},
+		{"SELECT UPPER(SUBSTR(name, 1, 1)) AS initial, COUNT(*) FROM t GROUP BY UPPER(SUBSTR(name, 1, 1)) ORDER BY initial",
+			[]string{"' ',1", "'B',1", "'H',1", "NULL,1"}},
+		{"SELECT SUM(ABS(id)) AS total, ROUND(AVG(score), 1) AS mean FROM t", []string{"10,2.6"}},
+	})
+
+	// Argument types that depend on the columns are checked when the query
+	// is planned
+	db.expectErrors(
+		"SELECT UPPER(id) FROM t",
+		"SELECT SQRT(name) FROM t",
+		"SELECT id FROM t WHERE LENGTH(score) > 1",
+		"SELECT LOWER(ROUND(score)) FROM t",
+		"SELECT SQRT(score) FROM t",
+		"INSERT INTO t VALUES (10, UPPER(name), 1.0)",
+	)
+
+	// VALUES can compute the values it inserts
+	db.exec("INSERT INTO t VALUES (10, LOWER('KIWI') || '!', 1 + 0.5)")
+	if got := db.query("SELECT name, score FROM t WHERE id = 10"); strings.Join(got, ";") != "'kiwi!',1.5" {
+		t.Errorf("computed VALUES = %v, want 'kiwi!',1.5", got)
+	}
+}
+
+// mockRowsOperator produces a fixed list of rows, as the input of the
+// operators under test
+type mockRowsOperator struct {
+	estimate
+	rows []storage.Row
+	pos  int
+}
+
+func (o *mockRowsOperator) Open() error {
+	o.pos = 0
+	return nil
+}
+
+func (o *mockRowsOperator) Next() (storage.Row, error) {
+	if o.pos >= len(o.rows) {
+		return nil, nil
+	}
+	o.pos++
+	return o.rows[o.pos-1], nil
+}
+
+func (o *mockRowsOperator) Close() error {
+	return nil
+}
+
+func (o *mockRowsOperator) Children() []Operator {
+	return nil
+}
+
+func (o *mockRowsOperator) Describe() (string, string) {
+	return "Values", fmt.Sprintf("%d rows", len(o.rows))
+}
+
+func TestExecuteAlterTable(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE items (id INT PRIMARY KEY, name TEXT, qty INT DEFAULT 1)",
+		"INSERT INTO items (id, name) VALUES (1, 'bolt'), (2, 'nut')",
+		"CREATE INDEX items_name ON items (name)",
+		"ALTER TABLE items ADD COLUMN price FLOAT DEFAULT 2",
+		"ALTER TABLE items ADD sku TEXT UNIQUE",
+		"ALTER TABLE items RENAME COLUMN name TO label",
+		"ALTER TABLE items DROP COLUMN qty",
+		"ALTER TABLE items RENAME TO parts",
+		"INSERT INTO parts (id, label, sku) VALUES (3, 'gear', 'G1')",
+	)
+
+	if got, want := db.query("SELECT * FROM parts ORDER BY id"), []string{"1,'bolt',2,NULL", "2,'nut',2,NULL", "3,'gear',2,'G1'"}; !slices.Equal(got, want) {
+		t.Errorf("rows after ALTER TABLE = %v, want %v", got, want)
+	}
+	schema, _ := db.catalog.GetTable("parts")
+	if schema.Version() != 5 {
+		t.Errorf("Version() = %d, want 5", schema.Version())
+	}
+	if index, _ := db.catalog.GetIndex("items_name"); index.Table != "parts" || !slices.Equal(index.Columns, []string{"label"}) {
+		t.Errorf("index after ALTER TABLE = %+v, want on parts (label)", index)
+	}
+	if got := db.query("SELECT id FROM parts WHERE label = 'nut'"); !slices.Equal(got, []string{"2"}) {
+		t.Errorf("lookup through renamed column = %v", got)
+	}
+
+	db.expectErrors(
+		"ALTER TABLE items ADD COLUMN x INT",
+		"ALTER TABLE parts ADD COLUMN label TEXT",
+		"ALTER TABLE parts ADD COLUMN code INT NOT NULL",
+		"ALTER TABLE parts ADD COLUMN code INT UNIQUE DEFAULT 7",
+		"ALTER TABLE parts ADD COLUMN pk INT PRIMARY KEY",
+		"ALTER TABLE parts DROP COLUMN id",
+		"ALTER TABLE parts DROP COLUMN missing",
+		"ALTER TABLE parts RENAME COLUMN label TO price",
+		"SELECT name FROM parts",
+		"INSERT INTO parts (id, sku) VALUES (4, 'G1')",
+	)
+	// A change that storage rejects is rolled back in the catalog
+	schema, _ = db.catalog.GetTable("parts")
+	if got, want := columnNames(schema), []string{"id", "label", "price", "sku"}; !slices.Equal(got, want) {
+		t.Errorf("columns after failed ALTER TABLE = %v, want %v", got, want)
+	}
+}
+
+func TestExecuteSequences(t *testing.T) {
+	db := newTestExec(t)
+
+	// AUTOINCREMENT fills in left out and NULL ids, and continues after
+	// ids given explicitly
+	db.setup(
+		"CREATE TABLE items (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, qty FLOAT DEFAULT 2 * 3, tag TEXT DEFAULT upper('new'))",
+		"INSERT INTO items (name) VALUES ('a'), ('b')",
+		"INSERT INTO items (id, name, tag) VALUES (10, 'c', 'old')",
+		"INSERT INTO items (id, name) VALUES (NULL, 'd'), (5, 'e')",
+		"INSERT INTO items (name) VALUES ('f')",
+	)
+	want := []string{"1,'a',6,'NEW'", "2,'b',6,'NEW'", "5,'e',6,'NEW'", "10,'c',6,'old'", "11,'d',6,'NEW'", "12,'f',6,'NEW'"}
+	if got := db.query("SELECT * FROM items ORDER BY id"); !slices.Equal(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+
+	// A default can take the next value of a sequence; EXPLAIN does not
+	// advance it
+	db.setup(
+		"CREATE SEQUENCE codes START WITH 100 INCREMENT BY 10",
+		"CREATE TABLE orders (id INT, code INT DEFAULT nextval('codes'))",
+		"INSERT INTO orders (id) VALUES (1), (2)",
+		"EXPLAIN INSERT INTO orders (id) VALUES (3)",
+		"INSERT INTO orders (id, code) VALUES (3, 7)",
+		"INSERT INTO orders (id) VALUES (4)",
+	)
+	if got, want := db.query("SELECT id, code FROM orders ORDER BY id"), []string{"1,100", "2,110", "3,7", "4,120"}; !slices.Equal(got, want) {
+		t.Errorf("orders = %v, want %v", got, want)
+	}
+	if got, want := db.query("SELECT id, nextval('codes') FROM orders WHERE id < 3 ORDER BY id"), []string{"1,130", "2,140"}; !slices.Equal(got, want) {
+		t.Errorf("nextval() in a query = %v, want %v", got, want)
+	}
+
+	// nextval() in VALUES runs once per row, in order, and not for EXPLAIN
+	db.exec("EXPLAIN INSERT INTO orders VALUES (nextval('codes'), 0)")
+	db.exec("INSERT INTO orders VALUES (nextval('codes'), 1), (nextval('codes'), 2)")
+	if got, want := db.query("SELECT id, code FROM orders WHERE code < 3 ORDER BY id"), []string{"150,1", "160,2"}; !slices.Equal(got, want) {
+		t.Errorf("nextval() in VALUES = %v, want %v", got, want)
+	}
+
+	db.expectErrors(
+		"CREATE SEQUENCE codes",
+		"DROP SEQUENCE items_id_seq",
+		"DROP SEQUENCE missing",
+		"ALTER TABLE orders ADD COLUMN serial INT DEFAULT nextval('codes')",
+		"SELECT id, nextval('missing') FROM orders",
+	)
+
+	// The sequence of an AUTOINCREMENT column goes with its table
+	db.exec("DROP TABLE items")
+	db.exec("CREATE TABLE items (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)")
+	db.exec("INSERT INTO items (name) VALUES ('a')")
+	if got := db.query("SELECT id FROM items"); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("id after the table was created again = %v, want 1", got)
+	}
+	db.exec("DROP SEQUENCE codes")
+	db.expectErrors("INSERT INTO orders (id) VALUES (5)")
+}
+
+func TestExecuteCheckConstraints(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		`CREATE TABLE items (
+			id INT, line INT,
+			qty INT NOT NULL CHECK (qty > 0),
+			price FLOAT,
+			CONSTRAINT items_key PRIMARY KEY (id, line),
+			CONSTRAINT cheap CHECK (qty * price < 1000))`,
+		"INSERT INTO items (id, line, qty, price) VALUES (1, 1, 5, 10.0)",
+		"INSERT INTO items (id, line, qty) VALUES (1, 2, 500)",
+		"UPDATE items SET qty = 50 WHERE id = 1 AND line = 1",
+	)
+
+	// A violation names the failing constraint; a NULL condition passes
+	violations := []struct {
+		sql        string
+		constraint string
+	}{
+		{"INSERT INTO items (id, line, qty, price) VALUES (2, 1, 0, 1.0)", "items_qty_check"},
+		{"INSERT INTO items (id, line, qty, price) VALUES (2, 1, 200, 10.0)", "cheap"},
+		{"INSERT INTO items (id, line, qty, price) VALUES (1, 1, 1, 1.0)", "items_key"},
+		{"UPDATE items SET qty = -1 WHERE line = 2", "items_qty_check"},
+		{"UPDATE items SET price = 100.0", "cheap"},
+		{"ALTER TABLE items ADD COLUMN weight INT DEFAULT 0 CHECK (weight > 0)", "items_weight_check"},
+	}
+	for _, v := range violations {
+		db.expectError(v.sql, "'"+v.constraint+"'")
+	}
+
+	result := db.run("SELECT qty FROM items ORDER BY line")
+	var got []string
+	for rows := result.Rows(); rows.Next(); {
+		got = append(got, fmt.Sprint(rows.Row()["qty"]))
+	}
+	if !slices.Equal(got, []string{"50", "500"}) {
+		t.Errorf("qty after failed writes = %v, want [50 500]", got)
+	}
+
+	// The failed ALTER TABLE left no column or constraint behind, and a
+	// CHECK follows a renamed column
+	db.exec("ALTER TABLE items ADD COLUMN weight INT DEFAULT 1 CHECK (weight > 0)")
+	db.exec("ALTER TABLE items RENAME COLUMN qty TO quantity")
+	db.expectErrors("INSERT INTO items (id, line, quantity, weight) VALUES (3, 1, -1, 1)")
+	db.exec("INSERT INTO items (id, line, quantity, weight) VALUES (3, 1, 1, 1)")
+}
+
+func TestExecuteForeignKeys(t *testing.T) {
+	db := newTestExec(t)
+
+	column := func(sql, col string) string {
+		var got []string
+		for rows := db.run(sql).Rows(); rows.Next(); {
+			got = append(got, fmt.Sprint(rows.Row()[col]))
+		}
+		return strings.Join(got, " ")
+	}
+
+	db.setup(
+		"CREATE TABLE customers (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, customer INT REFERENCES customers ON DELETE CASCADE ON UPDATE CASCADE)",
+		`CREATE TABLE lines (id INT PRIMARY KEY, order_id INT,
+			CONSTRAINT lines_order FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE SET NULL)`,
+		"CREATE TABLE notes (customer INT REFERENCES customers ON DELETE RESTRICT)",
+		"INSERT INTO customers VALUES (1, 'a'), (2, 'b'), (3, 'c')",
+		"INSERT INTO orders VALUES (10, 1), (11, 2), (12, NULL)",
+		"INSERT INTO lines VALUES (100, 10), (101, 11)",
+		"INSERT INTO notes VALUES (3)",
+	)
+
+	violations := []struct {
+		sql        string
+		constraint string
+	}{
+		{"INSERT INTO orders VALUES (13, 4)", "orders_customer_fkey"},
+		{"UPDATE lines SET order_id = 99", "lines_order"},
+		{"UPDATE orders SET id = 20 WHERE id = 10", "lines_order"},
+		{"DELETE FROM customers WHERE id = 3", "notes_customer_fkey"},
+		{"DROP TABLE customers", "notes_customer_fkey"},
+	}
+	for _, v := range violations {
+		db.expectError(v.sql, "'"+v.constraint+"'")
+	}
+
+	// Updating a key cascades to the orders, and deleting a customer
+	// deletes its orders, whose lines lose their order
+	db.exec("UPDATE customers SET id = 5 WHERE id = 1")
+	if got := column("SELECT customer FROM orders ORDER BY id", "customer"); got != "5 2 NULL" {
+		t.Errorf("orders after cascaded update = %s, want 5 2 NULL", got)
+	}
+	db.exec("DELETE FROM customers WHERE id = 2")
+	if got := column("SELECT id FROM orders ORDER BY id", "id"); got != "10 12" {
+		t.Errorf("orders after cascaded delete = %s, want 10 12", got)
+	}
+	if got := column("SELECT order_id FROM lines ORDER BY id", "order_id"); got != "10 NULL" {
+		t.Errorf("lines after cascaded delete = %s, want 10 NULL", got)
+	}
+
+	// A cascade that a later level restricts changes nothing
+	db.setup(
+		"CREATE TABLE regions (id INT PRIMARY KEY)",
+		"CREATE TABLE stores (id INT PRIMARY KEY REFERENCES regions ON DELETE CASCADE ON UPDATE CASCADE)",
+		"CREATE TABLE staff (store INT REFERENCES stores ON DELETE RESTRICT ON UPDATE RESTRICT)",
+		"INSERT INTO regions VALUES (1), (2)",
+		"INSERT INTO stores VALUES (1), (2)",
+		"INSERT INTO staff VALUES (2)",
+	)
+	for _, sql := range []string{"DELETE FROM regions", "UPDATE regions SET id = id + 10"} {
+		db.expectError(sql, "'staff_store_fkey'")
+		if got := column("SELECT id FROM regions ORDER BY id", "id") + "; " + column("SELECT id FROM stores ORDER BY id", "id"); got != "1 2; 1 2" {
+			t.Errorf("regions; stores after %s = %s, want 1 2; 1 2", sql, got)
+		}
+	}
+
+	// A self-reference can be deleted along with the rows that reference it
+	db.exec("CREATE TABLE tree (id INT PRIMARY KEY, parent INT REFERENCES tree)")
+	db.exec("INSERT INTO tree VALUES (1, 1), (2, 1), (3, 2)")
+	db.expectErrors("DELETE FROM tree WHERE id = 2")
+	db.exec("DELETE FROM tree WHERE id >= 2")
+
+	// Adding a foreign key checks the rows already there
+	db.exec("CREATE TABLE refs (customer INT)")
+	db.exec("INSERT INTO refs VALUES (5), (7)")
+	db.expectErrors("ALTER TABLE refs ADD CONSTRAINT refs_customer FOREIGN KEY (customer) REFERENCES customers")
+	db.expectErrors("ALTER TABLE refs ADD COLUMN other INT DEFAULT 7 REFERENCES customers")
+	db.exec("DELETE FROM refs WHERE customer = 7")
+	db.exec("ALTER TABLE refs ADD CONSTRAINT refs_customer FOREIGN KEY (customer) REFERENCES customers")
+	db.expectErrors("INSERT INTO refs VALUES (7)")
+	db.exec("ALTER TABLE refs DROP CONSTRAINT refs_customer")
+	db.exec("INSERT INTO refs VALUES (7)")
+}
+
+func TestExecuteTypeCoercion(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE prices (id INT PRIMARY KEY, price FLOAT DEFAULT 0)",
+		"INSERT INTO prices VALUES (1, 2)",
+		"INSERT INTO prices (id) VALUES (2.0)",
+		"UPDATE prices SET price = 3 WHERE id = 2",
+	)
+	var got []string
+	for rows := db.run("SELECT id, price FROM prices ORDER BY id").Rows(); rows.Next(); {
+		row := rows.Row()
+		got = append(got, fmt.Sprintf("%v:%v %v:%v", row["id"].Type(), row["id"], row["price"].Type(), row["price"]))
+	}
+	want := fmt.Sprintf("%v:1 %v:2 %v:2 %v:3", types.TypeInt, types.TypeFloat, types.TypeInt, types.TypeFloat)
+	if strings.Join(got, " ") != want {
+		t.Errorf("rows = %s, want %s", strings.Join(got, " "), want)
+	}
+
+	db.expectErrors(
+		"INSERT INTO prices VALUES (3, 'cheap')",
+		"INSERT INTO prices VALUES (3.5, 1)",
+		"UPDATE prices SET price = 'cheap'",
+		"UPDATE prices SET id = 1.5",
+		"UPDATE prices SET missing = 1",
+	)
+}
+
+func TestExecuteUpdateExpressions(t *testing.T) {
+	db := newTestExec(t)
+
+	// The rows have no primary key, and two differ only in case
+	db.setup(
+		"CREATE TABLE counters (n INT, name TEXT COLLATE NOCASE)",
+		"INSERT INTO counters VALUES (1, 'a'), (1, 'A'), (NULL, 'b')",
+	)
+
+	// SET expressions are evaluated against each row, before any is changed
+	updates := []struct {
+		sql      string
+		affected int
+	}{
+		{"UPDATE counters SET n = n + 1", 3},
+		{"UPDATE counters SET name = counters.name || '!'", 3},
+		{"UPDATE counters SET n = n * 10, name = name || n WHERE name = 'a!'", 2},
+		{"UPDATE counters SET n = (SELECT MAX(n) FROM counters) WHERE name = 'B!'", 1},
+	}
+	for _, u := range updates {
+		result := db.run(u.sql)
+		if result.Type() == types.ResultError {
+			t.Fatalf("Execute(%s) failed: %v", u.sql, result.Error())
+		}
+		if result.RowsAffected() != u.affected {
+			t.Errorf("Execute(%s) affected %d rows, want %d", u.sql, result.RowsAffected(), u.affected)
+		}
+	}
+	var got []string
+	for rows := db.run("SELECT n, name FROM counters").Rows(); rows.Next(); {
+		got = append(got, fmt.Sprintf("%v %v", rows.Row()["n"], rows.Row()["name"]))
+	}
+	sort.Strings(got)
+	if want := "20 'A!2'; 20 'a!2'; 20 'b!'"; strings.Join(got, "; ") != want {
+		t.Errorf("rows = %s, want %s", strings.Join(got, "; "), want)
+	}
+
+	// Rows that only differ in where their NULLs are, and identical rows,
+	// each get their own values
+	db.setup(
+		"CREATE TABLE pairs (a INT, b INT)",
+		"INSERT INTO pairs VALUES (1, NULL), (NULL, 1)",
+		"UPDATE pairs SET b = COALESCE(b, 100), a = COALESCE(a, 200)",
+		"CREATE SEQUENCE ticks",
+		"CREATE TABLE clicks (x INT, y INT)",
+		"INSERT INTO clicks VALUES (1, 0), (1, 0), (1, 0)",
+		"UPDATE clicks SET y = nextval('ticks')",
+	)
+	if got, want := strings.Join(db.query("SELECT a, b FROM pairs ORDER BY a"), "; "), "1,100; 200,1"; got != want {
+		t.Errorf("pairs = %s, want %s", got, want)
+	}
+	if got, want := strings.Join(db.query("SELECT x, y FROM clicks ORDER BY y"), "; "), "1,1; 1,2; 1,3"; got != want {
+		t.Errorf("clicks = %s, want %s", got, want)
+	}
+
+	// The expressions are checked even when no row matches
+	db.expectErrors(
+		"UPDATE counters SET n = missing + 1 WHERE n < 0",
+		"UPDATE counters SET n = SUM(n) WHERE n < 0",
+		"UPDATE counters SET missing = n WHERE n < 0",
+	)
+}
+
+func TestExecuteTemporalTypes(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE events (id INT PRIMARY KEY, at TIMESTAMP NOT NULL, day DATE, took INTERVAL, logged TIMESTAMPTZ DEFAULT NOW())",
+		"CREATE INDEX events_at ON events (at)",
+		"INSERT INTO events (id, at, day, took) VALUES (1, '2026-10-16 09:00', '2026-10-16', '90 minutes')",
+		"INSERT INTO events (id, at, day, took) VALUES (2, TIMESTAMP '2026-10-17 10:00', DATE '2026-10-17', INTERVAL '1 day')",
+		"INSERT INTO events (id, at, day) VALUES (3, DATE '2026-10-17', TIMESTAMP '2026-10-17 00:00')",
+		"UPDATE events SET took = INTERVAL '1 hour' * 3 WHERE id = 1",
+	)
+
+	db.expect([]queryTest{
+		{"SELECT id, at + took AS ends FROM events WHERE id < 3 ORDER BY id", []string{"1,TIMESTAMP '2026-10-16 12:00:00'", "2,TIMESTAMP '2026-10-18 10:00:00'"}},
+		{"SELECT id FROM events WHERE at >= '2026-10-17' AND at < TIMESTAMP '2026-10-17 12:00' ORDER BY at DESC", []string{"2", "3"}},
+		{"SELECT DATE_TRUNC('day', at) AS d, COUNT(*) AS n FROM events GROUP BY DATE_TRUNC('day', at) ORDER BY d", []string{"TIMESTAMP '2026-10-16 00:00:00',1", "TIMESTAMP '2026-10-17 00:00:00',2"}},
+		{"SELECT MIN(day) AS first, MAX(day) - MIN(day) AS days FROM events", []string{"DATE '2026-10-16',1"}},
+		{"SELECT COUNT(*) AS n FROM events WHERE logged > NOW() - INTERVAL '1 hour'", []string{"3"}},
+		{"SELECT STRFTIME('%d.%m.%Y', day) AS d FROM events WHERE id = 1", []string{"'16.10.2026'"}},
+	})
+
+	// A time range reads the B+ tree index on the column
+	if got := strings.Join(db.query("EXPLAIN SELECT id FROM events WHERE at BETWEEN '2026-10-17' AND TIMESTAMP '2026-10-18'"), "; "); !strings.Contains(got, "events_at (range scan)") {
+		t.Errorf("EXPLAIN of a time range = %s, want a range scan of events_at", got)
+	}
+
+	db.expectErrors(
+		"INSERT INTO events (id, at) VALUES (4, 'soon')",
+		"INSERT INTO events (id, at, day) VALUES (4, '2026-10-18', TIMESTAMP '2026-10-18 10:00')",
+		"INSERT INTO events (id, at) VALUES (4, 20261018)",
+		"UPDATE events SET took = 5",
+	)
+}
+
+func TestExecuteDecimalType(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE ledger (id INT PRIMARY KEY, account TEXT, amount DECIMAL(10, 2) NOT NULL)",
+		"CREATE INDEX ledger_amount ON ledger (amount)",
+		"INSERT INTO ledger VALUES (1, 'a', 0.1)",
+		"INSERT INTO ledger VALUES (2, 'a', 0.2)",
+		"INSERT INTO ledger VALUES (3, 'b', DECIMAL '19.9')",
+		"INSERT INTO ledger VALUES (4, 'b', '-5')",
+		"INSERT INTO ledger VALUES (5, 'c', 1.50)",
+	)
+
+	db.expect([]queryTest{
+		{"SELECT id, amount FROM ledger ORDER BY amount", []string{"4,DECIMAL '-5.00'", "1,DECIMAL '0.10'", "2,DECIMAL '0.20'", "5,DECIMAL '1.50'", "3,DECIMAL '19.90'"}},
+		{"SELECT account, SUM(amount) AS total FROM ledger GROUP BY account ORDER BY account", []string{"'a',DECIMAL '0.30'", "'b',DECIMAL '14.90'", "'c',DECIMAL '1.50'"}},
+		{"SELECT SUM(amount) = 0.3 AS exact FROM ledger WHERE account = 'a'", []string{"TRUE"}},
+		{"SELECT AVG(amount) AS mean FROM ledger WHERE account = 'a'", []string{"DECIMAL '0.15000000000000000'"}},
+		{"SELECT id FROM ledger WHERE amount = 1.5", []string{"5"}},
+		{"SELECT ROUND(amount / 3, 2, 'half_even') AS third FROM ledger WHERE id = 3", []string{"DECIMAL '6.63'"}},
+		{"SELECT amount * 2 AS twice FROM ledger WHERE id = 2", []string{"DECIMAL '0.40'"}},
+		{"SELECT DISTINCT amount FROM ledger WHERE amount = 1.5 UNION SELECT 1.5 FROM ledger", []string{"DECIMAL '1.50'"}},
+	})
+
+	// A range of amounts reads the B+ tree index on the column
+	if got := strings.Join(db.query("EXPLAIN SELECT id FROM ledger WHERE amount BETWEEN 0 AND 2"), "; "); !strings.Contains(got, "ledger_amount (range scan)") {
+		t.Errorf("EXPLAIN of an amount range = %s, want a range scan of ledger_amount", got)
+	}
+
+	// Number literals keep digits a FLOAT cannot hold when they are
+	// written to or compared with a DECIMAL
+	db.setup(
+		"CREATE TABLE balances (id INT PRIMARY KEY, amount DECIMAL(20, 2), total DECIMAL(25, 0))",
+		"CREATE INDEX balances_amount ON balances (amount)",
+		"INSERT INTO balances VALUES (1, 12345678901234567.89, 1234567890123456789012)",
+		"INSERT INTO balances VALUES (2, -12345678901234567.81, 1e21)",
+		"UPDATE balances SET amount = 12345678901234567.99 WHERE amount = 12345678901234567.89",
+	)
+	db.expect([]queryTest{
+		{"SELECT id, amount, total FROM balances ORDER BY id", []string{"1,DECIMAL '12345678901234567.99',DECIMAL '1234567890123456789012'", "2,DECIMAL '-12345678901234567.81',DECIMAL '1000000000000000000000'"}},
+		{"SELECT id FROM balances WHERE amount > 12345678901234567.98", []string{"1"}},
+		{"SELECT id FROM balances WHERE amount = -12345678901234567.81", []string{"2"}},
+		{"SELECT amount - 12345678901234567.9 AS diff FROM balances WHERE id = 1", []string{"DECIMAL '0.09'"}},
+	})
+
+	db.expectErrors(
+		"INSERT INTO ledger VALUES (6, 'd', 0.001)",
+		"INSERT INTO ledger VALUES (6, 'd', 123456789)",
+		"INSERT INTO ledger VALUES (6, 'd', 'much')",
+		"INSERT INTO ledger VALUES (6, 'd', TRUE)",
+		"ALTER TABLE ledger ADD COLUMN fee DECIMAL(5, 2) DEFAULT 1.234",
+	)
+
+	// The rows already there get the default of an added column at its scale
+	db.exec("ALTER TABLE ledger ADD COLUMN fee DECIMAL(5, 2) DEFAULT 1.5")
+	if got := strings.Join(db.query("SELECT fee FROM ledger WHERE id = 1"), "; "); got != "DECIMAL '1.50'" {
+		t.Errorf("fee = %s, want DECIMAL '1.50'", got)
+	}
+}
+
+func TestExecuteBlobType(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE files (id INT PRIMARY KEY, data BYTEA, name TEXT)",
+		"CREATE INDEX files_data ON files (data)",
+		"INSERT INTO files VALUES (1, X'DEADBEEF', 'a')",
+		"INSERT INTO files VALUES (2, X'00', 'b')",
+		"INSERT INTO files VALUES (3, 'hi', 'c')",
+		"INSERT INTO files VALUES (4, '\\x0000', 'd')",
+		"INSERT INTO files VALUES (5, X'', 'e')",
+	)
+
+	db.expect([]queryTest{
+		{"SELECT id, data FROM files ORDER BY data", []string{"5,X''", "2,X'00'", "4,X'0000'", "3,X'6869'", "1,X'DEADBEEF'"}},
+		{"SELECT LENGTH(data) AS n, SUBSTR(data, 2, 2) AS part FROM files WHERE id = 1", []string{"4,X'ADBE'"}},
+		{"SELECT id FROM files WHERE data = X'deadbeef'", []string{"1"}},
+		{"SELECT id FROM files WHERE data = 'hi'", []string{"3"}},
+		{"SELECT id FROM files WHERE data > X'00' ORDER BY id", []string{"1", "3", "4"}},
+		{"SELECT CAST(data AS TEXT) AS hex FROM files WHERE id = 4", []string{"'\\x0000'"}},
+		{"SELECT COUNT(DISTINCT data) AS n FROM files", []string{"5"}},
+	})
+
+	// An equality on the column reads the B+ tree index on it
+	if got := strings.Join(db.query("EXPLAIN SELECT id FROM files WHERE data = X'00'"), "; "); !strings.Contains(got, "files_data") {
+		t.Errorf("EXPLAIN of a BLOB lookup = %s, want a scan of files_data", got)
+	}
+
+	db.expectErrors(
+		"INSERT INTO files VALUES (6, 1, 'f')",
+		"INSERT INTO files VALUES (6, '\\xzz', 'f')",
+		"SELECT data + 1 FROM files",
+	)
+}
+
+func TestExecuteJSONType(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE items (id INT PRIMARY KEY, attrs JSON)",
+		`INSERT INTO items VALUES (1, '{"status": "active", "tags": ["red", "big"], "size": 3}')`,
+		`INSERT INTO items VALUES (2, '{"status": "closed", "size": 1}')`,
+		`INSERT INTO items VALUES (3, '{"status": "active", "tags": []}')`,
+		"INSERT INTO items VALUES (4, NULL)",
+		"CREATE INDEX items_status ON items ((attrs->>'status'))",
+	)
+
+	db.expect([]queryTest{
+		{"SELECT attrs FROM items WHERE id = 2", []string{`JSON '{"size":1,"status":"closed"}'`}},
+		{"SELECT id FROM items WHERE attrs->>'status' = 'active' ORDER BY id", []string{"1", "3"}},
+		{"SELECT id FROM items WHERE attrs->'size' >= 2", []string{"1"}},
+		{"SELECT attrs->'tags'->>0 AS tag FROM items WHERE id = 1", []string{"'red'"}},
+		{"SELECT JSON_ARRAY_LENGTH(attrs, '$.tags') AS n FROM items ORDER BY id", []string{"2", "NULL", "0", "NULL"}},
+		{"SELECT JSON_SET(attrs, '$.size', 4) ->> 'size' AS size FROM items WHERE id = 2", []string{"'4'"}},
+		{"SELECT key, value, type FROM json_each('[10, \"x\"]')", []string{`0,JSON '10','number'`, `1,JSON '"x"','string'`}},
+		{"SELECT i.id, t.value FROM items i, json_each(i.attrs->'tags') t ORDER BY i.id, t.key", []string{`1,JSON '"red"'`, `1,JSON '"big"'`}},
+		{"SELECT i.id, t.value FROM items i LEFT JOIN json_each(i.attrs->'tags') t ON t.key = 1 ORDER BY i.id", []string{`1,JSON '"big"'`, `2,NULL`, `3,NULL`, `4,NULL`}},
+		{"SELECT id, (SELECT COUNT(*) FROM json_each(items.attrs)) AS n FROM items ORDER BY id", []string{"1,3", "2,2", "3,2", "4,0"}},
+	})
+
+	// A comparison with the indexed expression reads the B+ tree index on it
+	for _, sql := range []string{
+		"EXPLAIN SELECT id FROM items WHERE attrs->>'status' = 'closed'",
+		"EXPLAIN SELECT i.id FROM items i WHERE 'closed' = i.attrs->>'status'",
+	} {
+		if got := strings.Join(db.query(sql), "; "); !strings.Contains(got, "items_status") {
+			t.Errorf("%s = %s, want a scan of items_status", sql, got)
+		}
+	}
+	if got := strings.Join(db.query("SELECT i.id FROM items i WHERE 'closed' = i.attrs->>'status'"), "; "); got != "2" {
+		t.Errorf("lookup through the expression index = %s, want 2", got)
+	}
+
+	// The index follows a renamed column and goes with a dropped one
+	db.run("ALTER TABLE items RENAME COLUMN attrs TO doc")
+	if got := strings.Join(db.query("EXPLAIN SELECT id FROM items WHERE doc->>'status' = 'closed'"), "; "); !strings.Contains(got, "items_status") {
+		t.Errorf("EXPLAIN after renaming the column = %s, want a scan of items_status", got)
+	}
+	if got := strings.Join(db.query("SELECT id FROM items WHERE doc->>'status' = 'closed'"), "; "); got != "2" {
+		t.Errorf("lookup after renaming the column = %s, want 2", got)
+	}
+	db.run("ALTER TABLE items DROP COLUMN doc")
+	if _, ok := db.catalog.GetIndex("items_status"); ok {
+		t.Errorf("index items_status survived dropping its column")
+	}
+
+	db.expectErrors(
+		`SELECT * FROM json_each(1)`,
+		`SELECT * FROM nope('[]')`,
+		`SELECT * FROM json_each(i.doc), items i`,
+		`CREATE INDEX bad ON items ((missing->>'a'))`,
+	)
+	db.run("CREATE TABLE docs (doc JSON)")
+	db.expectErrors(`INSERT INTO docs VALUES ('{"a": 1')`)
+}
+
+func TestExecuteCollations(t *testing.T) {
+	db := newTestExec(t)
+	db.setup(
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(5) COLLATE NOCASE, code CHAR(3), city TEXT COLLATE UNICODE)",
+		"INSERT INTO users VALUES (1, 'Alice', 'ab', 'ÉCOLE'), (2, 'bob', 'abc  ', 'école'), (3, 'ALICE', 'x', 'Paris')",
+		"CREATE INDEX users_name ON users (name)",
+	)
+
+	db.expect([]queryTest{
+		// Spaces over the length are cut off
+		{"SELECT code FROM users WHERE id = 2", []string{"'abc'"}},
+		{"SELECT id FROM users WHERE name = 'alice' ORDER BY id", []string{"1", "3"}},
+		{"SELECT id FROM users WHERE name IN ('ALICE', 'BOB') ORDER BY id", []string{"1", "2", "3"}},
+		{"SELECT id FROM users WHERE name > 'B'", []string{"2"}},
+		{"SELECT name FROM users ORDER BY name DESC, id", []string{"'bob'", "'Alice'", "'ALICE'"}},
+		{"SELECT name, COUNT(*) AS n FROM users GROUP BY name ORDER BY name", []string{"'Alice',2", "'bob',1"}},
+		{"SELECT COUNT(DISTINCT city) AS n FROM users", []string{"2"}},
+		{"SELECT id FROM users WHERE city = 'ÉCOLE' ORDER BY id", []string{"1", "2"}},
+		// An explicit collation takes precedence over the column's
+		{"SELECT id FROM users WHERE name = 'alice' COLLATE BINARY", nil},
+		{"SELECT id FROM users WHERE code = 'AB' COLLATE NOCASE", []string{"1"}},
+		{"SELECT code FROM users ORDER BY code COLLATE NOCASE DESC", []string{"'x'", "'abc'", "'ab'"}},
+		{"SELECT CAST(name AS VARCHAR(2)) AS s FROM users WHERE id = 1", []string{"'Al'"}},
+		{"SELECT a.id, b.id FROM users a JOIN users b ON a.name = b.name AND a.id < b.id", []string{"1,3"}},
+	})
+
+	// The index on a NOCASE column is keyed by the folded text
+	if got := strings.Join(db.query("EXPLAIN SELECT id FROM users WHERE name = 'ALICE'"), "; "); !strings.Contains(got, "users_name") {
+		t.Errorf("EXPLAIN of a lookup in another case = %s, want a scan of users_name", got)
+	}
+	db.run("CREATE TABLE tags (tag TEXT COLLATE NOCASE PRIMARY KEY, flag CHAR)")
+	db.run("INSERT INTO tags VALUES ('red', 'y')")
+
+	// Text too long for a column is reported with the type it was declared
+	// with, and a CHAR without a length holds one character
+	for sql, want := range map[string]string{
+		"INSERT INTO users VALUES (4, 'c', 'abcd', 'x')":               "of type CHAR(3)",
+		"INSERT INTO users VALUES (4, 'Charlie', 'c', 'x')":            "of type VARCHAR(5)",
+		"INSERT INTO tags VALUES ('blue', 'no')":                       "of type CHAR(1)",
+		"ALTER TABLE tags ADD COLUMN code VARCHAR(2) DEFAULT 'abcdef'": "of type VARCHAR(2)",
+	} {
+		db.expectError(sql, want)
+	}
+
+	db.expectErrors(
+		"INSERT INTO users VALUES (4, 'Charlie', 'c', 'x')",
+		"INSERT INTO users VALUES (4, 'c', 'abcd', 'x')",
+		"UPDATE users SET name = 'Charlie' WHERE id = 1",
+		"INSERT INTO tags VALUES ('RED', 'n')",
+		"CREATE UNIQUE INDEX users_city ON users (city)",
+		"SELECT id COLLATE NOCASE FROM users",
+	)
+}
+
+func TestOperators(t *testing.T) {
+	row := func(id int64, name string) storage.Row {
+		return storage.Row{"id": parser.NewIntValue(id), "name": parser.NewStringValue(name)}
+	}
+	values := &mockRowsOperator{rows: []storage.Row{row(3, "c"), row(1, "a"), row(2, "b"), row(1, "z")}}
+
+	// Limit(Sort(Values)) reads the input once and stops early
+	sorted := &sortOperator{
+		child: values,
+		keys: []sortKey{
+			{expr: &columnReference{name: "id"}},
+			{expr: &columnReference{name: "name"}, descending: true},
+		},
+	}
+	limited := &limitOperator{child: sorted, limit: 2, offset: 1}
+
+	rows, err := drain(limited)
+	if err != nil {
+		t.Fatalf("drain() error = %v", err)
+	}
+	var got []string
+	for _, r := range rows {
+		got = append(got, fmt.Sprint(r["id"], r["name"]))
+	}
+	if want := "1 'a';2 'b'"; strings.Join(got, ";") != want {
+		t.Errorf("Limit(Sort(Values)) = %v, want %s", got, want)
+	}
+
+	// Operators can be run again after Close
+	rows, err = drain(limited)
+	if err != nil || len(rows) != 2 {
+		t.Errorf("second run returned %d rows, error %v", len(rows), err)
+	}
+}
+
+func TestJoinOperators(t *testing.T) {
+	value := func(v interface{}) parser.Value {
+		if v == nil {
+			return parser.NewNullValue()
+		}
+		return parser.NewIntValue(int64(v.(int)))
+	}
+	var leftRows, rightRows []storage.Row
+	for i, k := range []interface{}{1, 2, 2, nil, 3, 5, 1} {
+		leftRows = append(leftRows, storage.Row{"lid": value(i), "lk": value(k)})
+	}
+	for i, k := range []interface{}{2, nil, 1, 2, 4, 5, 5} {
+		rightRows = append(rightRows, storage.Row{"rid": value(i), "rk": value(k)})
+	}
+	nullRow := storage.Row{"rid": parser.NewNullValue(), "rk": parser.NewNullValue()}
+
+	lk, rk := &columnReference{name: "lk"}, &columnReference{name: "rk"}
+	condition := parser.NewBinaryExpression("=", lk, rk)
+	keys := []joinKey{{left: lk, right: rk}}
+
+	// run returns the joined rows as sorted "lid-rid" pairs
+	run := func(op Operator) string {
+		rows, err := drain(op)
+		if err != nil {
+			t.Fatalf("drain() error = %v", err)
+		}
+		var pairs []string
+		for _, row := range rows {
+			pairs = append(pairs, fmt.Sprintf("%v-%v", row["lid"], row["rid"]))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, " ")
+	}
+	sorted := func(rows []storage.Row, key parser.Expression) Operator {
+		return &sortOperator{child: &mockRowsOperator{rows: rows}, keys: []sortKey{{expr: key}}}
+	}
+
+	for _, joinType := range []types.JoinType{types.JoinInner, types.JoinLeft} {
+		want := run(newNestedLoopJoinOperator(nil, joinType, &mockRowsOperator{rows: leftRows}, &mockRowsOperator{rows: rightRows}, condition, nullRow, 0))
+
+		hash := newHashJoinOperator(nil, joinType, &mockRowsOperator{rows: leftRows}, &mockRowsOperator{rows: rightRows}, keys, condition, nullRow, 0)
+		if got := run(hash); got != want {
+			t.Errorf("hash join (%v) = %s, want %s", joinType, got, want)
+		}
+
+		hash.budget = 2
+		if got := run(hash); got != want {
+			t.Errorf("spilled hash join (%v) = %s, want %s", joinType, got, want)
+		}
+		if _, detail := hash.Describe(); !strings.Contains(detail, "spilled") {
+			t.Errorf("spilled hash join detail = %q", detail)
+		}
+
+		merge := newMergeJoinOperator(nil, joinType, sorted(leftRows, lk), sorted(rightRows, rk), keys[0], condition, nullRow, 0)
+		if got := run(merge); got != want {
+			t.Errorf("merge join (%v) = %s, want %s", joinType, got, want)
+		}
+	}
+	// The planner merges inputs that index range scans already return sorted
+	db := newTestExec(t)
+	db.exec("CREATE TABLE a (id INT PRIMARY KEY)")
+	db.exec("CREATE TABLE b (id INT PRIMARY KEY, a_id INT)")
+	db.exec("CREATE INDEX b_a_id ON b (a_id)")
+	for i := 1; i <= 20; i++ {
+		db.exec(fmt.Sprintf("INSERT INTO a VALUES (%d)", i))
+		db.exec(fmt.Sprintf("INSERT INTO b VALUES (%d, %d)", i, i%8))
+	}
+
+	query := "SELECT COUNT(*) FROM a JOIN b ON b.a_id = a.id WHERE a.id > 2 AND b.a_id > 2"
+	rows := db.exec("EXPLAIN " + query).Rows()
+	var operators []string
+	for rows.Next() {
+		operator, _ := rows.Row()["operator"].AsString()
+		operators = append(operators, strings.TrimLeft(operator, " ->"))
+	}
+	rows.Close()
+	if len(operators) < 3 || operators[2] != "MergeJoin" {
+		t.Errorf("join plan = %v, want a MergeJoin", operators)
+	}
+
+	rows = db.exec(query).Rows()
+	rows.Next()
+	if count, _ := rows.Row()["COUNT(*)"].AsInt(); count != 12 {
+		t.Errorf("merge join counted %d rows, want 12", count)
+	}
+	rows.Close()
+}
@@ -0,0 +1,167 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// Columns of the rows returned by EXPLAIN and EXPLAIN ANALYZE
+var (
+	explainColumns        = []string{"operator", "detail", "estimated_rows"}
+	explainAnalyzeColumns = []string{"operator", "detail", "estimated_rows", "actual_rows", "time_ms", "pages_read"}
+)
+
+// analyzedOperator records the rows, time and pages of an operator for EXPLAIN ANALYZE
+type analyzedOperator struct {
+	Operator
+	pages storage.PageCounter
+
+	rows      int
+	elapsed   time.Duration
+	pagesRead uint64
+}
+
+func newAnalyzedOperator(op Operator, store storage.Storage) *analyzedOperator {
+	pages, _ := store.(storage.PageCounter)
+	return &analyzedOperator{Operator: op, pages: pages}
+}
+
+func (o *analyzedOperator) Open() error {
+	defer o.measure()()
+	return o.Operator.Open()
+}
+
+func (o *analyzedOperator) Next() (storage.Row, error) {
+	defer o.measure()()
+	row, err := o.Operator.Next()
+	if row != nil {
+		o.rows++
+	}
+	return row, err
+}
+
+func (o *analyzedOperator) Close() error {
+	defer o.measure()()
+	return o.Operator.Close()
+}
+
+// measure starts timing a call and returns the function that ends it
+func (o *analyzedOperator) measure() func() {
+	start := time.Now()
+	pages := o.pageCount()
+	return func() {
+		o.elapsed += time.Since(start)
+		o.pagesRead += o.pageCount() - pages
+	}
+}
+
+func (o *analyzedOperator) pageCount() uint64 {
+	if o.pages == nil {
+		return 0
+	}
+	return o.pages.PagesRead()
+}
+
+// actualRows is the number of rows the operator produced or changed
+func (o *analyzedOperator) actualRows() int {
+	if modify, ok := o.Operator.(modifyOperator); ok {
+		return modify.RowsAffected()
+	}
+	return o.rows
+}
+
+// executeExplain executes an EXPLAIN [ANALYZE] statement
+func (e *Executor) executeExplain(stmt parser.ExplainStatement) (Result, error) {
+	p := newPlanner(e.catalog, e.storage, stmt.Analyze())
+	compiled, err := p.planStatement(stmt.Statement())
+	if err != nil {
+		return &executionResult{
+			resultType: types.ResultError,
+			err:        err,
+		}, nil
+	}
+
+	columns := explainColumns
+	if stmt.Analyze() {
+		columns = explainAnalyzeColumns
+		if _, err := drain(compiled.root); err != nil {
+			return &executionResult{
+				resultType: types.ResultError,
+				err:        err,
+			}, nil
+		}
+	}
+
+	var rows []storage.Row
+	explainOperator(compiled.root, 0, &rows)
+	explainCTEs(p.ctx, &rows)
+	explainSubplans(p.ctx, stmt.Analyze(), &rows)
+
+	return &executionResult{
+		resultType: types.ResultRows,
+		columns:    columns,
+		rows:       &rowSliceIterator{rows: rows},
+	}, nil
+}
+
+// explainCTEs appends the EXPLAIN rows of the CTEs of a statement
+func explainCTEs(ctx *execContext, rows *[]storage.Row) {
+	for _, c := range ctx.ctes {
+		*rows = append(*rows, storage.Row{
+			"operator":       parser.NewStringValue("CTE " + c.name),
+			"detail":         parser.NewStringValue(strings.Join(c.columns(), ", ")),
+			"estimated_rows": parser.NewIntValue(int64(c.root.EstimatedRows())),
+		})
+		explainOperator(c.root, 1, rows)
+	}
+}
+
+// explainSubplans appends the EXPLAIN rows of the subqueries of a statement
+func explainSubplans(ctx *execContext, analyze bool, rows *[]storage.Row) {
+	for i, sub := range ctx.order {
+		name := "SubPlan"
+		if !sub.correlated {
+			name = "InitPlan"
+		}
+		detail := fmt.Sprint(sub.expr)
+		if analyze {
+			detail += fmt.Sprintf(" (%d runs)", sub.runs)
+		}
+
+		*rows = append(*rows, storage.Row{
+			"operator":       parser.NewStringValue(fmt.Sprintf("%s %d", name, i+1)),
+			"detail":         parser.NewStringValue(detail),
+			"estimated_rows": parser.NewIntValue(int64(sub.plan.root.EstimatedRows())),
+		})
+		explainOperator(sub.plan.root, 1, rows)
+	}
+}
+
+// explainOperator appends the EXPLAIN rows of an operator and its children
+func explainOperator(op Operator, depth int, rows *[]storage.Row) {
+	name, detail := op.Describe()
+	if depth > 0 {
+		name = strings.Repeat("  ", depth-1) + "-> " + name
+	}
+
+	row := storage.Row{
+		"operator":       parser.NewStringValue(name),
+		"detail":         parser.NewStringValue(detail),
+		"estimated_rows": parser.NewIntValue(int64(op.EstimatedRows())),
+	}
+	if analyzed, ok := op.(*analyzedOperator); ok {
+		row["actual_rows"] = parser.NewIntValue(int64(analyzed.actualRows()))
+		row["time_ms"] = parser.NewStringValue(fmt.Sprintf("%.3f", float64(analyzed.elapsed.Microseconds())/1000))
+		row["pages_read"] = parser.NewIntValue(int64(analyzed.pagesRead))
+	}
+	*rows = append(*rows, row)
+
+	for _, child := range op.Children() {
+		explainOperator(child, depth+1, rows)
+	}
+}
@@ -0,0 +1,388 @@
+package executor
+
+import (
+	"slices"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// referentialWriter writes rows under the FOREIGN KEY constraints between tables
+type referentialWriter struct {
+	catalog catalog.Catalog
+	storage storage.Storage
+}
+
+// insert inserts a row into a table once its references are checked
+func (w *referentialWriter) insert(table string, row storage.Row) error {
+	if schema, ok := w.catalog.GetTable(table); ok {
+		if err := w.checkReferences(catalog.ForeignKeys(schema), row); err != nil {
+			return err
+		}
+	}
+	return w.storage.Insert(table, row)
+}
+
+// update updates the matching rows of a table and returns how many it changed
+func (w *referentialWriter) update(table string, columns []string, set storage.SetFunc, path storage.AccessPath, match storage.FilterFunc) (int, error) {
+	plan := newWritePlan()
+	if err := w.planUpdate(plan, table, columns, set, path, match, nil); err != nil {
+		return 0, err
+	}
+	return plan.run()
+}
+
+// delete deletes the matching rows of a table and returns how many it deleted
+func (w *referentialWriter) delete(table string, path storage.AccessPath, match storage.FilterFunc) (int, error) {
+	plan := newWritePlan()
+	if err := w.planDelete(plan, table, path, match); err != nil {
+		return 0, err
+	}
+	return plan.run()
+}
+
+// writePlan holds the writes of a statement and of the actions it sets off
+type writePlan struct {
+	writes  []func() (int, error)
+	deleted map[string]bool
+}
+
+func newWritePlan() *writePlan {
+	return &writePlan{deleted: make(map[string]bool)}
+}
+
+// run makes the writes in order and returns how many rows the first changed
+func (p *writePlan) run() (int, error) {
+	affected := 0
+	for i, write := range p.writes {
+		n, err := write()
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 {
+			affected = n
+		}
+	}
+	return affected, nil
+}
+
+// isDeleted reports whether the plan deletes a row of a table
+func (p *writePlan) isDeleted(table string, row storage.Row) bool {
+	return p.deleted[table+"\x00"+rowID(row)]
+}
+
+// planUpdate checks an update and its actions and adds them to a plan
+func (w *referentialWriter) planUpdate(plan *writePlan, table string, columns []string, set storage.SetFunc, path storage.AccessPath, match storage.FilterFunc, via *catalog.ForeignKey) error {
+	var outgoing, incoming []catalog.ForeignKey
+	if schema, ok := w.catalog.GetTable(table); ok {
+		for _, fk := range catalog.ForeignKeys(schema) {
+			// The key a cascade sets is one the referenced table is given
+			if setsAny(columns, fk.Columns) && (via == nil || !sameReference(fk, *via)) {
+				outgoing = append(outgoing, fk)
+			}
+		}
+	}
+	for _, fk := range catalog.References(w.catalog, table) {
+		if setsAny(columns, fk.RefColumns) {
+			incoming = append(incoming, fk)
+		}
+	}
+	if len(outgoing) == 0 && len(incoming) == 0 {
+		plan.writes = append(plan.writes, func() (int, error) {
+			return w.storage.UpdatePath(table, set, path, match)
+		})
+		return nil
+	}
+
+	rows, err := w.selectRows(table, path, match)
+	if err != nil {
+		return err
+	}
+	rows = slices.DeleteFunc(rows, func(r storage.Row) bool {
+		return plan.isDeleted(table, r)
+	})
+	updated := make([]storage.Row, len(rows))
+	matched := make(map[string]storage.Row, len(rows))
+	for i, row := range rows {
+		values, err := set(row)
+		if err != nil {
+			return err
+		}
+		updated[i] = make(storage.Row, len(row))
+		for colName, val := range row {
+			updated[i][colName] = val
+		}
+		for colName, val := range values {
+			updated[i][colName] = val
+		}
+		matched[rowID(row)] = updated[i]
+		if err := w.checkReferences(outgoing, updated[i]); err != nil {
+			return err
+		}
+	}
+	plan.writes = append(plan.writes, func() (int, error) {
+		return w.storage.UpdatePath(table, set, path, func(row storage.Row) (bool, error) {
+			_, ok := matched[rowID(row)]
+			return ok, nil
+		})
+	})
+
+	for _, fk := range incoming {
+		// A key that another row takes on keeps the rows that reference
+		// it valid under NO ACTION
+		newKeys := make(map[string]bool)
+		for _, row := range updated {
+			key, _ := keyOf(row, fk.RefColumns)
+			newKeys[parser.HashKey(key)] = true
+		}
+
+		for i, row := range rows {
+			oldKey, ok := keyOf(row, fk.RefColumns)
+			newKey, _ := keyOf(updated[i], fk.RefColumns)
+			if !ok || parser.HashKey(oldKey) == parser.HashKey(newKey) {
+				continue
+			}
+			referencing, err := w.rowsWithKey(fk.Table, fk.Columns, oldKey)
+			if err != nil {
+				return err
+			}
+			referencing = slices.DeleteFunc(referencing, func(r storage.Row) bool {
+				return plan.isDeleted(fk.Table, r)
+			})
+			if fk.Table == table {
+				// Rows of the table that this update moves to another key
+				// no longer reference the old one
+				referencing = slices.DeleteFunc(referencing, func(r storage.Row) bool {
+					newRow, ok := matched[rowID(r)]
+					if !ok {
+						return false
+					}
+					key, _ := keyOf(newRow, fk.Columns)
+					return parser.HashKey(key) != parser.HashKey(oldKey)
+				})
+			}
+			if len(referencing) == 0 {
+				continue
+			}
+
+			switch fk.OnUpdate {
+			case types.ActionRestrict:
+				return stillReferenced(table, fk, oldKey)
+			case types.ActionNoAction:
+				if !newKeys[parser.HashKey(oldKey)] {
+					return stillReferenced(table, fk, oldKey)
+				}
+			case types.ActionCascade:
+				err = w.planSetKey(plan, fk, oldKey, newKey)
+			case types.ActionSetNull:
+				err = w.planSetKey(plan, fk, oldKey, nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// planDelete checks a delete and its actions and adds them to a plan
+func (w *referentialWriter) planDelete(plan *writePlan, table string, path storage.AccessPath, match storage.FilterFunc) error {
+	incoming := catalog.References(w.catalog, table)
+	if len(incoming) == 0 {
+		plan.writes = append(plan.writes, func() (int, error) {
+			return w.storage.DeletePath(table, path, match)
+		})
+		return nil
+	}
+
+	rows, err := w.selectRows(table, path, match)
+	if err != nil {
+		return err
+	}
+	rows = slices.DeleteFunc(rows, func(r storage.Row) bool {
+		return plan.isDeleted(table, r)
+	})
+	deleted := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		deleted[rowID(row)] = true
+		plan.deleted[table+"\x00"+rowID(row)] = true
+	}
+	plan.writes = append(plan.writes, func() (int, error) {
+		return w.storage.DeletePath(table, path, func(row storage.Row) (bool, error) {
+			return deleted[rowID(row)], nil
+		})
+	})
+
+	for _, fk := range incoming {
+		for _, row := range rows {
+			key, ok := keyOf(row, fk.RefColumns)
+			if !ok {
+				continue
+			}
+			referencing, err := w.rowsWithKey(fk.Table, fk.Columns, key)
+			if err != nil {
+				return err
+			}
+			if fk.OnDelete != types.ActionRestrict {
+				// Rows deleted along with the row they reference are no
+				// trouble
+				referencing = slices.DeleteFunc(referencing, func(r storage.Row) bool {
+					return plan.isDeleted(fk.Table, r)
+				})
+			}
+			if len(referencing) == 0 {
+				continue
+			}
+
+			switch fk.OnDelete {
+			case types.ActionRestrict, types.ActionNoAction:
+				return stillReferenced(table, fk, key)
+			case types.ActionCascade:
+				path, match := w.keyAccess(fk.Table, fk.Columns, key)
+				err = w.planDelete(plan, fk.Table, path, match)
+			case types.ActionSetNull:
+				err = w.planSetKey(plan, fk, key, nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// planSetKey plans the update of the rows referencing oldKey to newKey, or NULL if it is nil
+func (w *referentialWriter) planSetKey(plan *writePlan, fk catalog.ForeignKey, oldKey, newKey []parser.Value) error {
+	values := make(map[string]parser.Value, len(fk.Columns))
+	for i, col := range fk.Columns {
+		if newKey == nil {
+			values[col] = parser.NewNullValue()
+		} else {
+			values[col] = newKey[i]
+		}
+	}
+	path, match := w.keyAccess(fk.Table, fk.Columns, oldKey)
+	return w.planUpdate(plan, fk.Table, fk.Columns, storage.SetValues(values), path, match, &fk)
+}
+
+// sameReference reports whether two foreign keys tie the same columns together
+func sameReference(a, b catalog.ForeignKey) bool {
+	return a.Table == b.Table && a.RefTable == b.RefTable &&
+		slices.Equal(a.Columns, b.Columns) && slices.Equal(a.RefColumns, b.RefColumns)
+}
+
+// checkReferences checks that a row references existing rows through each foreign key
+func (w *referentialWriter) checkReferences(fks []catalog.ForeignKey, row storage.Row) error {
+	for _, fk := range fks {
+		key, ok := keyOf(row, fk.Columns)
+		if !ok {
+			continue
+		}
+		if fk.RefTable == fk.Table {
+			if own, _ := keyOf(row, fk.RefColumns); parser.HashKey(own) == parser.HashKey(key) {
+				continue
+			}
+		}
+		referenced, err := w.rowsWithKey(fk.RefTable, fk.RefColumns, key)
+		if err != nil {
+			return err
+		}
+		if len(referenced) == 0 {
+			return &storage.ConstraintError{
+				Table:      fk.Table,
+				Constraint: fk.Name,
+				Type:       types.ConstraintForeignKey,
+				Columns:    fk.Columns,
+				Values:     key,
+				RefTable:   fk.RefTable,
+			}
+		}
+	}
+	return nil
+}
+
+// stillReferenced is the error for changing a row that rows still reference
+func stillReferenced(table string, fk catalog.ForeignKey, key []parser.Value) error {
+	return &storage.ConstraintError{
+		Table:      table,
+		Constraint: fk.Name,
+		Type:       types.ConstraintForeignKey,
+		Columns:    fk.RefColumns,
+		Values:     key,
+		RefTable:   fk.Table,
+		Referenced: true,
+	}
+}
+
+// rowsWithKey returns the rows of a table whose columns hold a key
+func (w *referentialWriter) rowsWithKey(table string, columns []string, key []parser.Value) ([]storage.Row, error) {
+	path, match := w.keyAccess(table, columns, key)
+	return w.selectRows(table, path, match)
+}
+
+// keyAccess returns how to reach the rows of a table whose columns hold a key
+func (w *referentialWriter) keyAccess(table string, columns []string, key []parser.Value) (storage.AccessPath, storage.FilterFunc) {
+	want := parser.HashKey(key)
+	match := func(row storage.Row) (bool, error) {
+		values, _ := keyOf(row, columns)
+		return parser.HashKey(values) == want, nil
+	}
+
+	for _, index := range w.catalog.TableIndexes(table) {
+		if len(index.Columns) < len(columns) {
+			continue
+		}
+		values := make([]parser.Value, len(columns))
+		for i, col := range index.Columns[:len(columns)] {
+			j := slices.Index(columns, col)
+			if j < 0 {
+				values = nil
+				break
+			}
+			values[i] = key[j]
+		}
+		if values != nil {
+			return storage.AccessPath{Index: index.Name, Ranges: []storage.KeyRange{storage.PointRange(values)}}, match
+		}
+	}
+	return storage.AccessPath{}, match
+}
+
+// selectRows reads the matching rows of a table together with their IDs
+func (w *referentialWriter) selectRows(table string, path storage.AccessPath, match storage.FilterFunc) ([]storage.Row, error) {
+	iter, err := w.storage.SelectPath(table, []string{"*", storage.RowIDColumn}, path, match)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	var rows []storage.Row
+	for iter.Next() {
+		rows = append(rows, iter.Row())
+	}
+	return rows, iter.Err()
+}
+
+// keyOf returns the values of a row for the columns of a key, and whether none is NULL
+func keyOf(row storage.Row, columns []string) ([]parser.Value, bool) {
+	key := make([]parser.Value, len(columns))
+	ok := true
+	for i, col := range columns {
+		key[i] = row[col]
+		if key[i] == nil || isNullValue(key[i]) {
+			ok = false
+		}
+	}
+	return key, ok
+}
+
+// setsAny reports whether an UPDATE of the columns in set sets any of columns
+func setsAny(set []string, columns []string) bool {
+	for _, col := range columns {
+		if slices.Contains(set, col) {
+			return true
+		}
+	}
+	return false
+}
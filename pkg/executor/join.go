@@ -0,0 +1,459 @@
+package executor
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// Hash join memory budget and partition count for spilling to disk
+const (
+	defaultHashJoinBudget = 100000
+	hashJoinPartitions    = 8
+)
+
+// joinKey pairs the expressions over the two inputs of a join that must be equal
+type joinKey struct {
+	left  parser.Expression
+	right parser.Expression
+}
+
+// hashJoinKey encodes the join key of a row for hashing; a NULL key is not ok
+func hashJoinKey(ctx parser.EvalContext, exprs []parser.Expression, row storage.Row) (string, bool, error) {
+	values := make([]parser.Value, len(exprs))
+	for i, expr := range exprs {
+		val, err := expr.Eval(ctx, row)
+		if err != nil {
+			return "", false, err
+		}
+		if isNullValue(val) {
+			return "", false, nil
+		}
+		values[i] = val
+	}
+	return parser.HashKey(values), true, nil
+}
+
+// hashJoinOperator joins its inputs through a hash table on the join keys, spilling to disk when large
+type hashJoinOperator struct {
+	estimate
+	ctx       parser.EvalContext
+	joinType  types.JoinType
+	probe     Operator
+	build     Operator
+	probeKeys []parser.Expression
+	buildKeys []parser.Expression
+	condition parser.Expression
+	match     storage.FilterFunc
+	nullRow   storage.Row
+
+	// budget is the number of build rows kept in memory before spilling
+	budget int
+
+	table     map[string][]storage.Row
+	input     rowSource
+	probeRow  storage.Row
+	matches   []storage.Row
+	pos       int
+	matched   bool
+	spilled   bool
+	partition int
+	builds    []*spillFile
+	probes    []*spillFile
+}
+
+// rowSource is where a hash join reads its probe rows from
+type rowSource interface {
+	Next() (storage.Row, error)
+}
+
+// newHashJoinOperator creates a hash join of probe and build on the given keys
+func newHashJoinOperator(ctx parser.EvalContext, joinType types.JoinType, probe, build Operator, keys []joinKey, condition parser.Expression, nullRow storage.Row, rows float64) *hashJoinOperator {
+	op := &hashJoinOperator{
+		estimate:  estimate{rows: rows},
+		ctx:       ctx,
+		joinType:  joinType,
+		probe:     probe,
+		build:     build,
+		condition: condition,
+		match:     createFilterFunc(ctx, condition),
+		nullRow:   nullRow,
+		budget:    defaultHashJoinBudget,
+	}
+	for _, key := range keys {
+		op.probeKeys = append(op.probeKeys, key.left)
+		op.buildKeys = append(op.buildKeys, key.right)
+	}
+	return op
+}
+
+func (o *hashJoinOperator) Open() error {
+	o.table = make(map[string][]storage.Row)
+	o.probeRow = nil
+	o.spilled = false
+
+	if err := o.build.Open(); err != nil {
+		return err
+	}
+	defer o.build.Close()
+
+	rows := 0
+	for {
+		row, err := o.build.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+
+		key, ok, err := hashJoinKey(o.ctx, o.buildKeys, row)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		if o.spilled {
+			if err := o.builds[partitionOf(key)].write(row); err != nil {
+				return err
+			}
+			continue
+		}
+		o.table[key] = append(o.table[key], row)
+		rows++
+		if rows > o.budget {
+			if err := o.spill(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := o.probe.Open(); err != nil {
+		return err
+	}
+	if !o.spilled {
+		o.input = o.probe
+		return nil
+	}
+
+	// Partition the probe input the same way
+	defer o.probe.Close()
+	for {
+		row, err := o.probe.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+
+		key, _, err := hashJoinKey(o.ctx, o.probeKeys, row)
+		if err != nil {
+			return err
+		}
+		if err := o.probes[partitionOf(key)].write(row); err != nil {
+			return err
+		}
+	}
+
+	o.partition = -1
+	return o.nextPartition()
+}
+
+// spill moves the build rows gathered so far into partition files
+func (o *hashJoinOperator) spill() error {
+	o.spilled = true
+	o.builds = make([]*spillFile, hashJoinPartitions)
+	o.probes = make([]*spillFile, hashJoinPartitions)
+	for i := range o.builds {
+		var err error
+		if o.builds[i], err = newSpillFile(); err != nil {
+			return err
+		}
+		if o.probes[i], err = newSpillFile(); err != nil {
+			return err
+		}
+	}
+
+	for key, rows := range o.table {
+		for _, row := range rows {
+			if err := o.builds[partitionOf(key)].write(row); err != nil {
+				return err
+			}
+		}
+	}
+	o.table = nil
+	return nil
+}
+
+// nextPartition loads the next spilled partition, leaving input nil after the last
+func (o *hashJoinOperator) nextPartition() error {
+	o.input = nil
+	o.partition++
+	if o.partition >= hashJoinPartitions {
+		return nil
+	}
+
+	builds, err := o.builds[o.partition].reader()
+	if err != nil {
+		return err
+	}
+	o.table = make(map[string][]storage.Row)
+	for {
+		row, err := builds.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		key, _, err := hashJoinKey(o.ctx, o.buildKeys, row)
+		if err != nil {
+			return err
+		}
+		o.table[key] = append(o.table[key], row)
+	}
+
+	o.input, err = o.probes[o.partition].reader()
+	return err
+}
+
+// partitionOf picks the spill partition of a join key
+func partitionOf(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % hashJoinPartitions)
+}
+
+func (o *hashJoinOperator) Next() (storage.Row, error) {
+	for {
+		if o.probeRow == nil {
+			if o.input == nil {
+				return nil, nil
+			}
+			row, err := o.input.Next()
+			if err != nil {
+				return nil, err
+			}
+			if row == nil {
+				if !o.spilled {
+					return nil, nil
+				}
+				if err := o.nextPartition(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			key, ok, err := hashJoinKey(o.ctx, o.probeKeys, row)
+			if err != nil {
+				return nil, err
+			}
+			o.probeRow = row
+			o.matches = nil
+			if ok {
+				o.matches = o.table[key]
+			}
+			o.pos = 0
+			o.matched = false
+		}
+
+		for o.pos < len(o.matches) {
+			joined := mergeRows(o.probeRow, o.matches[o.pos])
+			o.pos++
+
+			ok, err := o.match(joined)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				o.matched = true
+				return joined, nil
+			}
+		}
+
+		probeRow := o.probeRow
+		o.probeRow = nil
+		if o.joinType == types.JoinLeft && !o.matched {
+			return mergeRows(probeRow, o.nullRow), nil
+		}
+	}
+}
+
+func (o *hashJoinOperator) Close() error {
+	o.table = nil
+	o.matches = nil
+	for _, file := range append(o.builds, o.probes...) {
+		file.remove()
+	}
+	o.builds, o.probes = nil, nil
+	if o.spilled {
+		// The probe input was closed once it was partitioned
+		return nil
+	}
+	return o.probe.Close()
+}
+
+func (o *hashJoinOperator) Children() []Operator {
+	return []Operator{o.probe, o.build}
+}
+
+func (o *hashJoinOperator) Describe() (string, string) {
+	detail := describeJoin(o.joinType, o.condition)
+	if o.spilled {
+		detail += fmt.Sprintf(" (spilled to %d partitions)", hashJoinPartitions)
+	}
+	return "HashJoin", detail
+}
+
+// mergeJoinOperator joins two inputs that are both sorted on a join key
+type mergeJoinOperator struct {
+	estimate
+	ctx       parser.EvalContext
+	joinType  types.JoinType
+	left      Operator
+	right     Operator
+	key       joinKey
+	condition parser.Expression
+	match     storage.FilterFunc
+	nullRow   storage.Row
+
+	leftRow   storage.Row
+	group     []storage.Row
+	groupKey  parser.Value
+	rightRow  storage.Row
+	rightKey  parser.Value
+	rightDone bool
+	pos       int
+	matched   bool
+}
+
+func newMergeJoinOperator(ctx parser.EvalContext, joinType types.JoinType, left, right Operator, key joinKey, condition parser.Expression, nullRow storage.Row, rows float64) *mergeJoinOperator {
+	return &mergeJoinOperator{
+		estimate:  estimate{rows: rows},
+		ctx:       ctx,
+		joinType:  joinType,
+		left:      left,
+		right:     right,
+		key:       key,
+		condition: condition,
+		match:     createFilterFunc(ctx, condition),
+		nullRow:   nullRow,
+	}
+}
+
+func (o *mergeJoinOperator) Open() error {
+	o.leftRow, o.rightRow = nil, nil
+	o.group, o.groupKey = nil, nil
+	o.rightDone = false
+	if err := o.left.Open(); err != nil {
+		return err
+	}
+	if err := o.right.Open(); err != nil {
+		return err
+	}
+	return o.advanceRight()
+}
+
+// advanceRight reads the next right row and its key
+func (o *mergeJoinOperator) advanceRight() error {
+	row, err := o.right.Next()
+	if err != nil {
+		return err
+	}
+	if row == nil {
+		o.rightRow, o.rightKey, o.rightDone = nil, nil, true
+		return nil
+	}
+	o.rightRow = row
+	o.rightKey, err = o.key.right.Eval(o.ctx, row)
+	return err
+}
+
+// seek collects the right rows whose key equals key
+func (o *mergeJoinOperator) seek(key parser.Value) error {
+	for !o.rightDone && (isNullValue(o.rightKey) || compareSortValues(o.rightKey, key) < 0) {
+		if err := o.advanceRight(); err != nil {
+			return err
+		}
+	}
+
+	o.group, o.groupKey = nil, key
+	for !o.rightDone && !isNullValue(o.rightKey) && compareSortValues(o.rightKey, key) == 0 {
+		o.group = append(o.group, o.rightRow)
+		if err := o.advanceRight(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *mergeJoinOperator) Next() (storage.Row, error) {
+	for {
+		if o.leftRow == nil {
+			row, err := o.left.Next()
+			if row == nil || err != nil {
+				return nil, err
+			}
+			key, err := o.key.left.Eval(o.ctx, row)
+			if err != nil {
+				return nil, err
+			}
+
+			o.leftRow = row
+			o.pos = 0
+			o.matched = false
+			switch {
+			case isNullValue(key):
+				// A NULL key matches nothing
+				o.pos = len(o.group)
+			case o.groupKey == nil || compareSortValues(key, o.groupKey) != 0:
+				if err := o.seek(key); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for o.pos < len(o.group) {
+			joined := mergeRows(o.leftRow, o.group[o.pos])
+			o.pos++
+
+			ok, err := o.match(joined)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				o.matched = true
+				return joined, nil
+			}
+		}
+
+		leftRow := o.leftRow
+		o.leftRow = nil
+		if o.joinType == types.JoinLeft && !o.matched {
+			return mergeRows(leftRow, o.nullRow), nil
+		}
+	}
+}
+
+func (o *mergeJoinOperator) Close() error {
+	o.group = nil
+	leftErr := o.left.Close()
+	if err := o.right.Close(); err != nil {
+		return err
+	}
+	return leftErr
+}
+
+func (o *mergeJoinOperator) Children() []Operator {
+	return []Operator{o.left, o.right}
+}
+
+func (o *mergeJoinOperator) Describe() (string, string) {
+	return "MergeJoin", describeJoin(o.joinType, o.condition)
+}
@@ -0,0 +1,998 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// Operator is a node of a physical query plan, run in the iterator style
+type Operator interface {
+	// Open prepares the operator and its children to produce rows
+	Open() error
+
+	// Next returns the next row, or nil when there are no more rows
+	Next() (storage.Row, error)
+
+	// Close releases the resources held by the operator and its children
+	Close() error
+
+	// Children returns the inputs of the operator
+	Children() []Operator
+
+	// Describe returns the operator name and a summary of its arguments
+	Describe() (string, string)
+
+	// EstimatedRows returns the number of rows the planner expects the
+	// operator to produce
+	EstimatedRows() float64
+}
+
+// modifyOperator is an operator that changes the rows of a table
+type modifyOperator interface {
+	Operator
+
+	// RowsAffected returns the number of rows changed so far
+	RowsAffected() int
+}
+
+// estimate holds the planner's row estimate for an operator
+type estimate struct {
+	rows float64
+}
+
+func (e estimate) EstimatedRows() float64 {
+	return e.rows
+}
+
+// tableCursor reads the rows of a table through an access path
+type tableCursor struct {
+	storage storage.Storage
+	table   string
+	alias   string
+	outer   *outerRow
+	rows    storage.RowIterator
+}
+
+func (c *tableCursor) open(path storage.AccessPath) error {
+	rows, err := c.storage.SelectPath(c.table, []string{"*"}, path, acceptAll)
+	if err != nil {
+		return err
+	}
+	c.rows = rows
+	return nil
+}
+
+func (c *tableCursor) next() (storage.Row, error) {
+	if !c.rows.Next() {
+		return nil, c.rows.Err()
+	}
+
+	stored := c.rows.Row()
+	row := make(storage.Row, 2*len(stored))
+	if c.outer != nil {
+		for colName, val := range c.outer.row {
+			row[colName] = val
+		}
+	}
+	for colName, val := range stored {
+		row[colName] = val
+		row[c.alias+"."+colName] = val
+	}
+	return row, nil
+}
+
+func (c *tableCursor) close() error {
+	if c.rows != nil {
+		c.rows.Close()
+		c.rows = nil
+	}
+	return nil
+}
+
+// scanOperator reads every row of a table
+type scanOperator struct {
+	estimate
+	tableCursor
+}
+
+func (o *scanOperator) Open() error {
+	return o.open(storage.AccessPath{})
+}
+
+func (o *scanOperator) Next() (storage.Row, error) {
+	return o.next()
+}
+
+func (o *scanOperator) Close() error {
+	return o.close()
+}
+
+func (o *scanOperator) Children() []Operator {
+	return nil
+}
+
+func (o *scanOperator) Describe() (string, string) {
+	return "Scan", describeAccess(o.table, accessPlan{method: accessFullScan})
+}
+
+// indexScanOperator reads the rows of a table found in a range of an index
+type indexScanOperator struct {
+	estimate
+	tableCursor
+	access accessPlan
+}
+
+func (o *indexScanOperator) Open() error {
+	return o.open(o.access.path)
+}
+
+func (o *indexScanOperator) Next() (storage.Row, error) {
+	return o.next()
+}
+
+func (o *indexScanOperator) Close() error {
+	return o.close()
+}
+
+func (o *indexScanOperator) Children() []Operator {
+	return nil
+}
+
+func (o *indexScanOperator) Describe() (string, string) {
+	return "IndexScan", describeAccess(o.table, o.access)
+}
+
+// filterOperator passes on the rows of its child that satisfy a condition
+type filterOperator struct {
+	estimate
+	child     Operator
+	condition parser.Expression
+	match     storage.FilterFunc
+}
+
+func newFilterOperator(ctx parser.EvalContext, child Operator, condition parser.Expression, rows float64) *filterOperator {
+	return &filterOperator{
+		estimate:  estimate{rows: rows},
+		child:     child,
+		condition: condition,
+		match:     createFilterFunc(ctx, condition),
+	}
+}
+
+func (o *filterOperator) Open() error {
+	return o.child.Open()
+}
+
+func (o *filterOperator) Next() (storage.Row, error) {
+	for {
+		row, err := o.child.Next()
+		if row == nil || err != nil {
+			return nil, err
+		}
+
+		ok, err := o.match(row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return row, nil
+		}
+	}
+}
+
+func (o *filterOperator) Close() error {
+	return o.child.Close()
+}
+
+func (o *filterOperator) Children() []Operator {
+	return []Operator{o.child}
+}
+
+func (o *filterOperator) Describe() (string, string) {
+	return "Filter", fmt.Sprint(o.condition)
+}
+
+// projection is one output column of a projectOperator
+type projection struct {
+	name string
+	expr parser.Expression
+}
+
+// projectOperator computes the output columns of a query from its input rows
+type projectOperator struct {
+	estimate
+	ctx         parser.EvalContext
+	child       Operator
+	projections []projection
+}
+
+func (o *projectOperator) Open() error {
+	return o.child.Open()
+}
+
+func (o *projectOperator) Next() (storage.Row, error) {
+	row, err := o.child.Next()
+	if row == nil || err != nil {
+		return nil, err
+	}
+
+	projected := make(storage.Row, len(o.projections))
+	for _, proj := range o.projections {
+		val, err := proj.expr.Eval(o.ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		projected[proj.name] = val
+	}
+	return projected, nil
+}
+
+func (o *projectOperator) Close() error {
+	return o.child.Close()
+}
+
+func (o *projectOperator) Children() []Operator {
+	return []Operator{o.child}
+}
+
+func (o *projectOperator) Describe() (string, string) {
+	names := make([]string, len(o.projections))
+	for i, proj := range o.projections {
+		names[i] = proj.name
+		if text := fmt.Sprint(proj.expr); text != proj.name {
+			names[i] = text + " AS " + proj.name
+		}
+	}
+	return "Project", strings.Join(names, ", ")
+}
+
+// sortKey is one key of a sortOperator
+type sortKey struct {
+	expr       parser.Expression
+	descending bool
+}
+
+// sortOperator reads all rows of its child and returns them in order
+type sortOperator struct {
+	estimate
+	ctx   parser.EvalContext
+	child Operator
+	keys  []sortKey
+	rows  []storage.Row
+	pos   int
+}
+
+func (o *sortOperator) Open() error {
+	rows, err := drain(o.child)
+	if err != nil {
+		return err
+	}
+
+	// Evaluate the keys once per row
+	keyValues := make([][]parser.Value, len(rows))
+	for i, row := range rows {
+		keyValues[i] = make([]parser.Value, len(o.keys))
+		for j, key := range o.keys {
+			val, err := key.expr.Eval(o.ctx, row)
+			if err != nil {
+				return err
+			}
+			keyValues[i][j] = val
+		}
+	}
+
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		for j, key := range o.keys {
+			cmp := compareSortValues(keyValues[order[a]][j], keyValues[order[b]][j])
+			if key.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+
+	o.rows = make([]storage.Row, len(rows))
+	for i, idx := range order {
+		o.rows[i] = rows[idx]
+	}
+	o.pos = 0
+	return nil
+}
+
+func (o *sortOperator) Next() (storage.Row, error) {
+	if o.pos >= len(o.rows) {
+		return nil, nil
+	}
+	o.pos++
+	return o.rows[o.pos-1], nil
+}
+
+func (o *sortOperator) Close() error {
+	o.rows = nil
+	return nil
+}
+
+func (o *sortOperator) Children() []Operator {
+	return []Operator{o.child}
+}
+
+func (o *sortOperator) Describe() (string, string) {
+	return "Sort", describeSortKeys(o.keys)
+}
+
+// describeSortKeys lists sort keys, e.g. "name, age DESC"
+func describeSortKeys(keys []sortKey) string {
+	texts := make([]string, len(keys))
+	for i, key := range keys {
+		texts[i] = fmt.Sprint(key.expr)
+		if key.descending {
+			texts[i] += " DESC"
+		}
+	}
+	return strings.Join(texts, ", ")
+}
+
+// compareSortValues orders two values for sorting, with NULL last
+func compareSortValues(a, b parser.Value) int {
+	aNull, bNull := isNullValue(a), isNullValue(b)
+	switch {
+	case aNull && bNull:
+		return 0
+	case aNull:
+		return 1
+	case bNull:
+		return -1
+	}
+
+	if cmp, ok := parser.Compare(a, b); ok {
+		return cmp
+	}
+	return int(a.Type()) - int(b.Type())
+}
+
+// limitOperator skips offset rows and passes on at most limit rows
+type limitOperator struct {
+	estimate
+	child    Operator
+	limit    int64
+	offset   int64
+	returned int64
+}
+
+func (o *limitOperator) Open() error {
+	o.returned = 0
+	if err := o.child.Open(); err != nil {
+		return err
+	}
+
+	for i := int64(0); i < o.offset; i++ {
+		row, err := o.child.Next()
+		if row == nil || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *limitOperator) Next() (storage.Row, error) {
+	if o.limit >= 0 && o.returned >= o.limit {
+		return nil, nil
+	}
+
+	row, err := o.child.Next()
+	if row == nil || err != nil {
+		return nil, err
+	}
+	o.returned++
+	return row, nil
+}
+
+func (o *limitOperator) Close() error {
+	return o.child.Close()
+}
+
+func (o *limitOperator) Children() []Operator {
+	return []Operator{o.child}
+}
+
+func (o *limitOperator) Describe() (string, string) {
+	switch {
+	case o.limit < 0:
+		return "Limit", fmt.Sprintf("offset %d", o.offset)
+	case o.offset > 0:
+		return "Limit", fmt.Sprintf("%d offset %d", o.limit, o.offset)
+	}
+	return "Limit", fmt.Sprintf("%d", o.limit)
+}
+
+// distinctOperator passes on the rows whose expressions have values no earlier row had
+type distinctOperator struct {
+	estimate
+	ctx   parser.EvalContext
+	child Operator
+	exprs []parser.Expression
+	on    bool
+	seen  map[string]bool
+}
+
+func (o *distinctOperator) Open() error {
+	o.seen = make(map[string]bool)
+	return o.child.Open()
+}
+
+func (o *distinctOperator) Next() (storage.Row, error) {
+	values := make([]parser.Value, len(o.exprs))
+	for {
+		row, err := o.child.Next()
+		if row == nil || err != nil {
+			return nil, err
+		}
+
+		for i, expr := range o.exprs {
+			if values[i], err = expr.Eval(o.ctx, row); err != nil {
+				return nil, err
+			}
+		}
+		if key := parser.HashKey(values); !o.seen[key] {
+			o.seen[key] = true
+			return row, nil
+		}
+	}
+}
+
+func (o *distinctOperator) Close() error {
+	o.seen = nil
+	return o.child.Close()
+}
+
+func (o *distinctOperator) Children() []Operator {
+	return []Operator{o.child}
+}
+
+func (o *distinctOperator) Describe() (string, string) {
+	if !o.on {
+		return "Distinct", ""
+	}
+	exprs := make([]string, len(o.exprs))
+	for i, expr := range o.exprs {
+		exprs[i] = fmt.Sprint(expr)
+	}
+	return "Distinct", "on " + strings.Join(exprs, ", ")
+}
+
+// nestedLoopJoinOperator joins two inputs by comparing every pair of rows
+type nestedLoopJoinOperator struct {
+	estimate
+	joinType  types.JoinType
+	left      Operator
+	right     Operator
+	condition parser.Expression
+	match     storage.FilterFunc
+
+	// nullRow holds NULL for every column of the right input
+	nullRow storage.Row
+
+	rightRows []storage.Row
+	leftRow   storage.Row
+	pos       int
+	matched   bool
+}
+
+func newNestedLoopJoinOperator(ctx parser.EvalContext, joinType types.JoinType, left, right Operator, condition parser.Expression, nullRow storage.Row, rows float64) *nestedLoopJoinOperator {
+	op := &nestedLoopJoinOperator{
+		estimate:  estimate{rows: rows},
+		joinType:  joinType,
+		left:      left,
+		right:     right,
+		condition: condition,
+		match:     acceptAll,
+		nullRow:   nullRow,
+	}
+	if condition != nil {
+		op.match = createFilterFunc(ctx, condition)
+	}
+	return op
+}
+
+func (o *nestedLoopJoinOperator) Open() error {
+	rightRows, err := drain(o.right)
+	if err != nil {
+		return err
+	}
+	o.rightRows = rightRows
+	o.leftRow = nil
+	return o.left.Open()
+}
+
+func (o *nestedLoopJoinOperator) Next() (storage.Row, error) {
+	for {
+		if o.leftRow == nil {
+			row, err := o.left.Next()
+			if row == nil || err != nil {
+				return nil, err
+			}
+			o.leftRow = row
+			o.pos = 0
+			o.matched = false
+		}
+
+		for o.pos < len(o.rightRows) {
+			joined := mergeRows(o.leftRow, o.rightRows[o.pos])
+			o.pos++
+
+			ok, err := o.match(joined)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				o.matched = true
+				return joined, nil
+			}
+		}
+
+		leftRow := o.leftRow
+		o.leftRow = nil
+		if o.joinType == types.JoinLeft && !o.matched {
+			return mergeRows(leftRow, o.nullRow), nil
+		}
+	}
+}
+
+func (o *nestedLoopJoinOperator) Close() error {
+	o.rightRows = nil
+	return o.left.Close()
+}
+
+func (o *nestedLoopJoinOperator) Children() []Operator {
+	return []Operator{o.left, o.right}
+}
+
+func (o *nestedLoopJoinOperator) Describe() (string, string) {
+	return "NestedLoopJoin", describeJoin(o.joinType, o.condition)
+}
+
+// describeJoin summarizes the kind and condition of a join
+func describeJoin(joinType types.JoinType, condition parser.Expression) string {
+	switch joinType {
+	case types.JoinLeft:
+		return fmt.Sprintf("left join on %v", condition)
+	case types.JoinCross:
+		return "cross join"
+	}
+	return fmt.Sprintf("inner join on %v", condition)
+}
+
+// mergeRows combines a row of each side of a join into one row
+func mergeRows(left, right storage.Row) storage.Row {
+	row := make(storage.Row, len(left)+len(right))
+	for colName, val := range right {
+		row[colName] = val
+	}
+	for colName, val := range left {
+		row[colName] = val
+	}
+	return row
+}
+
+// isNullValue reports whether a value is missing or SQL NULL
+func isNullValue(val parser.Value) bool {
+	if val == nil {
+		return true
+	}
+	isNull, _ := val.AsNull()
+	return isNull
+}
+
+// valuesOperator produces the rows of the VALUES list of an INSERT, evaluating each as it is read
+type valuesOperator struct {
+	estimate
+	ctx     parser.EvalContext
+	columns []string
+	rows    [][]parser.Expression
+	pos     int
+}
+
+func (o *valuesOperator) Open() error {
+	o.pos = 0
+	return nil
+}
+
+func (o *valuesOperator) Next() (storage.Row, error) {
+	if o.pos >= len(o.rows) {
+		return nil, nil
+	}
+	o.pos++
+	row := make(storage.Row, len(o.columns))
+	for i, colName := range o.columns {
+		val, err := evaluateExpression(o.ctx, o.rows[o.pos-1][i], nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate value for column '%s': %v", colName, err)
+		}
+		row[colName] = val
+	}
+	return row, nil
+}
+
+func (o *valuesOperator) Close() error {
+	return nil
+}
+
+func (o *valuesOperator) Children() []Operator {
+	return nil
+}
+
+func (o *valuesOperator) Describe() (string, string) {
+	return "Values", fmt.Sprintf("%d rows", len(o.rows))
+}
+
+// insertOperator inserts every row produced by its child into a table
+type insertOperator struct {
+	estimate
+	child    Operator
+	ctx      parser.EvalContext
+	storage  storage.Storage
+	writer   *referentialWriter
+	table    string
+	schema   catalog.TableSchema
+	affected int
+}
+
+func (o *insertOperator) Open() error {
+	o.affected = 0
+	return o.child.Open()
+}
+
+func (o *insertOperator) Next() (storage.Row, error) {
+	for {
+		row, err := o.child.Next()
+		if row == nil || err != nil {
+			return nil, err
+		}
+
+		row, err = o.withDefaults(row)
+		if err != nil {
+			return nil, err
+		}
+		if row, err = storage.CoerceRow(o.schema, row); err != nil {
+			return nil, err
+		}
+		if err := o.writer.insert(o.table, row); err != nil {
+			return nil, err
+		}
+		o.affected++
+	}
+}
+
+// withDefaults fills in the columns a row leaves out with their defaults, or NULL
+func (o *insertOperator) withDefaults(row storage.Row) (storage.Row, error) {
+	filled := make(storage.Row, len(row))
+	for colName, val := range row {
+		filled[colName] = val
+	}
+
+	for _, col := range o.schema.Columns() {
+		def := col.Default()
+		val, given := row[col.Name()]
+		seq, autoIncrement := catalog.AutoIncrementSequence(col)
+
+		switch {
+		case autoIncrement && given && !isNullValue(val):
+			if val.Type() == types.TypeInt {
+				n, _ := val.AsInt()
+				if err := o.storage.AdvanceSequence(seq, n); err != nil {
+					return nil, err
+				}
+			}
+		case def != nil && (!given || (autoIncrement && isNullValue(val))):
+			val, err := def.Eval(o.ctx, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compute default of column '%s': %v", col.Name(), err)
+			}
+			filled[col.Name()] = val
+		case !given:
+			filled[col.Name()] = parser.NewNullValue()
+		}
+	}
+	return filled, nil
+}
+
+func (o *insertOperator) Close() error {
+	return o.child.Close()
+}
+
+func (o *insertOperator) Children() []Operator {
+	return []Operator{o.child}
+}
+
+func (o *insertOperator) Describe() (string, string) {
+	return "Insert", o.table
+}
+
+func (o *insertOperator) RowsAffected() int {
+	return o.affected
+}
+
+// updateOperator sets columns of the matching rows of a table to their SET expressions
+type updateOperator struct {
+	estimate
+	ctx       parser.EvalContext
+	storage   storage.Storage
+	writer    *referentialWriter
+	table     string
+	schema    catalog.TableSchema
+	columns   []string
+	set       map[string]parser.Expression
+	access    accessPlan
+	condition parser.Expression
+	affected  int
+	done      bool
+}
+
+func (o *updateOperator) Open() error {
+	o.affected = 0
+	o.done = false
+	return nil
+}
+
+func (o *updateOperator) Next() (storage.Row, error) {
+	if o.done {
+		return nil, nil
+	}
+	o.done = true
+
+	match, err := modifyFilter(o.ctx, o.storage, o.table, o.access.path, o.condition)
+	if err != nil {
+		return nil, err
+	}
+	set, err := o.newValues(match)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := o.writer.update(o.table, o.columns, set, o.access.path, match)
+	if err != nil {
+		return nil, err
+	}
+	o.affected = affected
+	return nil, nil
+}
+
+// newValues evaluates the SET expressions before storage locks the table, by row ID
+func (o *updateOperator) newValues(match storage.FilterFunc) (storage.SetFunc, error) {
+	rows, err := o.storage.SelectPath(o.table, []string{"*", storage.RowIDColumn}, o.access.path, match)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	newValues := make(map[string]map[string]parser.Value)
+	for rows.Next() {
+		row := qualifyRow(o.table, rows.Row())
+		values := make(map[string]parser.Value, len(o.set))
+		for _, colName := range o.columns {
+			val, err := evaluateExpression(o.ctx, o.set[colName], row)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate expression for column '%s': %v", colName, err)
+			}
+			values[colName] = val
+		}
+
+		// Check the values against the schema before any row is changed,
+		// so the rows that reference them see the values that will be
+		// stored
+		values, err = storage.CoerceValues(o.schema, values)
+		if err != nil {
+			return nil, err
+		}
+		newValues[rowID(rows.Row())] = values
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return func(row storage.Row) (map[string]parser.Value, error) {
+		values, ok := newValues[rowID(row)]
+		if !ok {
+			return nil, fmt.Errorf("no values were computed for a row of '%s'", o.table)
+		}
+		return values, nil
+	}, nil
+}
+
+func (o *updateOperator) Close() error {
+	return nil
+}
+
+func (o *updateOperator) Children() []Operator {
+	return nil
+}
+
+func (o *updateOperator) Describe() (string, string) {
+	return "Update", describeModify(o.table, o.access, o.condition)
+}
+
+func (o *updateOperator) RowsAffected() int {
+	return o.affected
+}
+
+// deleteOperator deletes the matching rows of a table
+type deleteOperator struct {
+	estimate
+	ctx       parser.EvalContext
+	storage   storage.Storage
+	writer    *referentialWriter
+	table     string
+	access    accessPlan
+	condition parser.Expression
+	affected  int
+	done      bool
+}
+
+func (o *deleteOperator) Open() error {
+	o.affected = 0
+	o.done = false
+	return nil
+}
+
+func (o *deleteOperator) Next() (storage.Row, error) {
+	if o.done {
+		return nil, nil
+	}
+	o.done = true
+
+	match, err := modifyFilter(o.ctx, o.storage, o.table, o.access.path, o.condition)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := o.writer.delete(o.table, o.access.path, match)
+	if err != nil {
+		return nil, err
+	}
+	o.affected = affected
+	return nil, nil
+}
+
+func (o *deleteOperator) Close() error {
+	return nil
+}
+
+func (o *deleteOperator) Children() []Operator {
+	return nil
+}
+
+func (o *deleteOperator) Describe() (string, string) {
+	return "Delete", describeModify(o.table, o.access, o.condition)
+}
+
+func (o *deleteOperator) RowsAffected() int {
+	return o.affected
+}
+
+// acceptAll is a filter that keeps every row
+func acceptAll(row storage.Row) (bool, error) {
+	return true, nil
+}
+
+// describeAccess summarizes how a table is read, e.g. "users using users_pkey (point lookup)"
+func describeAccess(table string, access accessPlan) string {
+	if access.method == accessFullScan {
+		return fmt.Sprintf("%s (%s)", table, access.method)
+	}
+	return fmt.Sprintf("%s using %s (%s)", table, access.index.Name, access.method)
+}
+
+// describeModify summarizes the rows an UPDATE or DELETE works on
+func describeModify(table string, access accessPlan, condition parser.Expression) string {
+	if isAlwaysTrue(condition) {
+		return describeAccess(table, access)
+	}
+	return fmt.Sprintf("%s where %v", describeAccess(table, access), condition)
+}
+
+// modifyFilter builds the filter UPDATE and DELETE pass to storage for their condition
+func modifyFilter(ctx parser.EvalContext, store storage.Storage, table string, path storage.AccessPath, condition parser.Expression) (storage.FilterFunc, error) {
+	match := createFilterFunc(ctx, condition)
+	qualified := func(row storage.Row) (bool, error) {
+		return match(qualifyRow(table, row))
+	}
+	if !containsSubquery(condition) {
+		return qualified, nil
+	}
+
+	rows, err := store.SelectPath(table, []string{"*", storage.RowIDColumn}, path, acceptAll)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	matched := make(map[string]bool)
+	for rows.Next() {
+		ok, err := qualified(rows.Row())
+		if err != nil {
+			return nil, err
+		}
+		matched[rowID(rows.Row())] = ok
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return func(row storage.Row) (bool, error) {
+		return matched[rowID(row)], nil
+	}, nil
+}
+
+// qualifyRow returns a row with each column also under its name qualified by the table
+func qualifyRow(table string, row storage.Row) storage.Row {
+	qualified := make(storage.Row, 2*len(row))
+	for colName, val := range row {
+		qualified[colName] = val
+		qualified[table+"."+colName] = val
+	}
+	return qualified
+}
+
+// rowID returns the ID that storage gives a row under storage.RowIDColumn, as a map key
+func rowID(row storage.Row) string {
+	return parser.HashKey([]parser.Value{row[storage.RowIDColumn]})
+}
+
+// drain opens an operator, pulls all of its rows and closes it again
+func drain(op Operator) ([]storage.Row, error) {
+	if err := op.Open(); err != nil {
+		op.Close()
+		return nil, err
+	}
+
+	var rows []storage.Row
+	for {
+		row, err := op.Next()
+		if err != nil {
+			op.Close()
+			return nil, err
+		}
+		if row == nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, op.Close()
+}
+
+// rowSliceIterator is a storage.RowIterator over rows already in memory
+type rowSliceIterator struct {
+	rows []storage.Row
+	pos  int
+}
+
+func (i *rowSliceIterator) Next() bool {
+	if i.pos >= len(i.rows) {
+		return false
+	}
+	i.pos++
+	return true
+}
+
+func (i *rowSliceIterator) Row() storage.Row {
+	if i.pos == 0 || i.pos > len(i.rows) {
+		return nil
+	}
+	return i.rows[i.pos-1]
+}
+
+func (i *rowSliceIterator) Err() error {
+	return nil
+}
+
+func (i *rowSliceIterator) Close() {}
@@ -0,0 +1,763 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// accessMethod is the way the planner decided to read a table
+type accessMethod int
+
+const (
+	accessFullScan accessMethod = iota
+	accessPointLookup
+	accessRangeScan
+	accessIndexOrder
+)
+
+func (m accessMethod) String() string {
+	switch m {
+	case accessPointLookup:
+		return "point lookup"
+	case accessRangeScan:
+		return "range scan"
+	case accessIndexOrder:
+		return "full index scan"
+	default:
+		return "full scan"
+	}
+}
+
+// accessPlan is the planner's choice of how to read one table
+type accessPlan struct {
+	method accessMethod
+	index  catalog.Index
+	path   storage.AccessPath
+
+	// selectivity is the estimated fraction of the table the path reads
+	selectivity float64
+}
+
+// columnBounds collects the sargable predicates found for one column
+type columnBounds struct {
+	eq            parser.Value
+	in            []parser.Value
+	low           parser.Value
+	lowInclusive  bool
+	high          parser.Value
+	highInclusive bool
+}
+
+// planAccess chooses how to read the rows of a table that may satisfy a WHERE clause
+func planAccess(schema catalog.TableSchema, indexes []catalog.Index, where parser.Expression) accessPlan {
+	return planTermsAccess(schema, schema.Name(), indexes, splitConjuncts(where))
+}
+
+// Costs of access paths, in units of reading one row in a full scan
+const (
+	indexLookupCost = 4
+	indexRowCost    = 2
+)
+
+// planTermsAccess is planAccess for the AND-ed terms of a condition on an aliased table
+func planTermsAccess(schema catalog.TableSchema, alias string, indexes []catalog.Index, terms []parser.Expression) accessPlan {
+	stats := statisticsOf(schema)
+	bounds := collectBounds(schema, alias, terms)
+	collectExpressionBounds(schema, alias, indexes, terms, bounds)
+	best := accessPlan{method: accessFullScan, selectivity: 1}
+	if len(bounds) == 0 {
+		return best
+	}
+
+	bestCost := stats.rows()
+	bestScore := 0
+	for _, index := range indexes {
+		keyRanges, method, score, selectivity := matchIndex(index, bounds, stats)
+		if score == 0 {
+			continue
+		}
+
+		cost := indexLookupCost*float64(len(keyRanges)) + indexRowCost*estimateRows(stats.rows(), selectivity)
+		if cost < bestCost || (cost == bestCost && score > bestScore && best.method != accessFullScan) {
+			bestCost = cost
+			bestScore = score
+			best = accessPlan{
+				method: method,
+				index:  index,
+				path: storage.AccessPath{
+					Index:  index.Name,
+					Ranges: keyRanges,
+				},
+				selectivity: selectivity,
+			}
+		}
+	}
+
+	return best
+}
+
+// matchIndex works out the key ranges, score and selectivity of an index for the bounds
+func matchIndex(index catalog.Index, bounds map[string]*columnBounds, stats tableStatistics) ([]storage.KeyRange, accessMethod, int, float64) {
+	// Equality on a prefix of the index columns
+	var prefix []parser.Value
+	selectivity := 1.0
+	for _, colName := range index.Columns {
+		b, ok := bounds[colName]
+		if !ok || b.eq == nil {
+			break
+		}
+		prefix = append(prefix, b.eq)
+		selectivity *= stats.equalSelectivity(colName, b.eq)
+	}
+
+	if len(prefix) == len(index.Columns) {
+		if index.Unique {
+			return []storage.KeyRange{storage.PointRange(prefix)}, accessPointLookup, 1000, 0
+		}
+		return []storage.KeyRange{storage.PointRange(prefix)}, accessRangeScan, 10 * len(prefix), selectivity
+	}
+
+	// An IN list on the column after the equality prefix reads one range
+	// per value, in key order
+	colName := index.Columns[len(prefix)]
+	if b, ok := bounds[colName]; ok && b.in != nil {
+		keyRanges := make([]storage.KeyRange, len(b.in))
+		listSelectivity := 0.0
+		for i, val := range b.in {
+			keyRanges[i] = storage.PointRange(appendValue(prefix, val))
+			listSelectivity += stats.equalSelectivity(colName, val)
+		}
+		selectivity *= math.Min(1, listSelectivity)
+		if len(prefix)+1 == len(index.Columns) && index.Unique {
+			return keyRanges, accessPointLookup, 1000, selectivity
+		}
+		return keyRanges, accessRangeScan, 10*len(prefix) + 5, selectivity
+	}
+
+	keyRange := storage.KeyRange{}
+	score := 10 * len(prefix)
+	if len(prefix) > 0 {
+		keyRange = storage.PointRange(prefix)
+	}
+
+	// A range on the column after the equality prefix
+	if b, ok := bounds[colName]; ok && (b.low != nil || b.high != nil) {
+		if b.low != nil {
+			keyRange.Low = appendValue(prefix, b.low)
+			keyRange.LowInclusive = b.lowInclusive
+			score += 5
+		}
+		if b.high != nil {
+			keyRange.High = appendValue(prefix, b.high)
+			keyRange.HighInclusive = b.highInclusive
+			score += 5
+		}
+		selectivity *= stats.rangeSelectivity(colName, b.low, b.lowInclusive, b.high, b.highInclusive)
+	}
+
+	return []storage.KeyRange{keyRange}, accessRangeScan, score, selectivity
+}
+
+// appendValue returns prefix followed by val without sharing prefix's array
+func appendValue(prefix []parser.Value, val parser.Value) []parser.Value {
+	result := make([]parser.Value, 0, len(prefix)+1)
+	result = append(result, prefix...)
+	return append(result, val)
+}
+
+// collectBounds gathers the comparisons of columns with constants among the terms of a WHERE clause
+func collectBounds(schema catalog.TableSchema, alias string, terms []parser.Expression) map[string]*columnBounds {
+	bounds := make(map[string]*columnBounds)
+	boundsOf := func(colName string) *columnBounds {
+		b := bounds[colName]
+		if b == nil {
+			b = &columnBounds{}
+			bounds[colName] = b
+		}
+		return b
+	}
+
+	for _, term := range terms {
+		if colName, values, ok := columnInList(schema, alias, term); ok {
+			if b := boundsOf(colName); b.in == nil {
+				b.in = values
+			}
+			continue
+		}
+		for _, pred := range rangePredicates(schema, alias, term) {
+			boundsOf(pred.colName).add(pred.op, pred.val)
+		}
+	}
+
+	return bounds
+}
+
+// collectExpressionBounds gathers the comparisons of indexed expressions with constants
+func collectExpressionBounds(schema catalog.TableSchema, alias string, indexes []catalog.Index, terms []parser.Expression, bounds map[string]*columnBounds) {
+	for _, index := range indexes {
+		for i, text := range index.Columns {
+			expr := index.Expression(i)
+			if expr == nil || bounds[text] != nil {
+				continue
+			}
+			scope := tableScope(nil, schema)
+			exprType, collation := expressionType(scope, expr), expressionCollation(scope, expr)
+			b := &columnBounds{}
+			for _, term := range terms {
+				bin, ok := term.(parser.BinaryExpression)
+				if !ok {
+					continue
+				}
+				op, ok := flippedOperators[bin.Operator()]
+				if !ok || op == "!=" {
+					continue
+				}
+				other := bin.Left()
+				if tableExpression(alias, bin.Left(), text) {
+					op, other = bin.Operator(), bin.Right()
+				} else if !tableExpression(alias, bin.Right(), text) {
+					continue
+				}
+				if val, ok := constantKey(exprType, other); ok {
+					b.add(op, parser.Collate(val, collation))
+				}
+			}
+			if b.eq != nil || b.low != nil || b.high != nil {
+				bounds[text] = b
+			}
+		}
+	}
+}
+
+// tableExpression reports whether an expression computes an indexed expression given by its text
+func tableExpression(alias string, expr parser.Expression, text string) bool {
+	if _, ok := expr.(parser.LiteralExpression); ok {
+		return false
+	}
+	for _, colName := range parser.ColumnsOf(expr) {
+		qualifier, name, ok := strings.Cut(colName, ".")
+		if !ok {
+			continue
+		}
+		if qualifier != alias {
+			return false
+		}
+		expr = parser.RenameColumn(expr, colName, name)
+	}
+	return fmt.Sprint(expr) == text
+}
+
+// add narrows the bounds by a comparison of the column with a constant
+func (b *columnBounds) add(op string, val parser.Value) {
+	switch op {
+	case "=":
+		if b.eq == nil {
+			b.eq = val
+		}
+	case ">", ">=":
+		if b.low == nil || compareKeys(val, b.low) > 0 || (compareKeys(val, b.low) == 0 && op == ">") {
+			b.low = val
+			b.lowInclusive = op == ">="
+		}
+	case "<", "<=":
+		if b.high == nil || compareKeys(val, b.high) < 0 || (compareKeys(val, b.high) == 0 && op == "<") {
+			b.high = val
+			b.highInclusive = op == "<="
+		}
+	}
+}
+
+// columnPredicate is a comparison of a column with a constant
+type columnPredicate struct {
+	colName string
+	op      string
+	val     parser.Value
+}
+
+// rangePredicates turns a sargable comparison, BETWEEN or prefix LIKE into comparisons with constants
+func rangePredicates(schema catalog.TableSchema, alias string, expr parser.Expression) []columnPredicate {
+	switch e := expr.(type) {
+	case parser.BetweenExpression:
+		column, ok := tableColumn(schema, alias, e.Operand())
+		if !ok {
+			return nil
+		}
+		low, lowOK := columnKey(column, e.Low())
+		high, highOK := columnKey(column, e.High())
+		if !lowOK || !highOK {
+			return nil
+		}
+		return []columnPredicate{{column.Name(), ">=", low}, {column.Name(), "<=", high}}
+
+	case parser.LikeExpression:
+		return likePredicates(schema, alias, e)
+	}
+
+	if colName, op, val, ok := sargablePredicate(schema, alias, expr); ok {
+		return []columnPredicate{{colName, op, val}}
+	}
+	return nil
+}
+
+// likePredicates turns a LIKE with a constant prefix into the range of strings with that prefix
+func likePredicates(schema catalog.TableSchema, alias string, like parser.LikeExpression) []columnPredicate {
+	if like.CaseInsensitive() {
+		return nil
+	}
+	column, ok := tableColumn(schema, alias, like.Operand())
+	if !ok || column.Type() != types.TypeString || column.Collation() != parser.CollateBinary {
+		return nil
+	}
+	pattern, ok := constantText(like.Pattern())
+	if !ok {
+		return nil
+	}
+	escape := ""
+	if like.Escape() != nil {
+		if escape, ok = constantText(like.Escape()); !ok {
+			return nil
+		}
+	}
+	prefix, ok := parser.LikePrefix(pattern, escape)
+	if !ok || prefix == "" {
+		return nil
+	}
+
+	preds := []columnPredicate{{column.Name(), ">=", parser.NewStringValue(prefix)}}
+	end := []byte(prefix)
+	for len(end) > 0 && end[len(end)-1] == 0xFF {
+		end = end[:len(end)-1]
+	}
+	if len(end) > 0 {
+		end[len(end)-1]++
+		preds = append(preds, columnPredicate{column.Name(), "<", parser.NewStringValue(string(end))})
+	}
+	return preds
+}
+
+// columnInList recognizes a column tested with IN against a list of constants
+func columnInList(schema catalog.TableSchema, alias string, expr parser.Expression) (string, []parser.Value, bool) {
+	in, ok := expr.(parser.InListExpression)
+	if !ok {
+		return "", nil, false
+	}
+	column, ok := tableColumn(schema, alias, in.Operand())
+	if !ok {
+		return "", nil, false
+	}
+
+	values := make([]parser.Value, 0, len(in.List()))
+	for _, expr := range in.List() {
+		if lit, ok := expr.(parser.LiteralExpression); ok && lit.Value().Type() == types.TypeNull {
+			continue
+		}
+		val, ok := columnKey(column, expr)
+		if !ok {
+			return "", nil, false
+		}
+		values = append(values, val)
+	}
+
+	sort.Slice(values, func(i, j int) bool { return compareKeys(values[i], values[j]) < 0 })
+	distinct := values[:0]
+	for _, val := range values {
+		if len(distinct) == 0 || compareKeys(distinct[len(distinct)-1], val) != 0 {
+			distinct = append(distinct, val)
+		}
+	}
+	return column.Name(), distinct, true
+}
+
+// constantKey converts a constant expression to the type of a column for use as a key
+func constantKey(colType types.DataType, expr parser.Expression) (parser.Value, bool) {
+	lit, ok := expr.(parser.LiteralExpression)
+	if !ok {
+		return nil, false
+	}
+	return keyValueFor(colType, lit.Value())
+}
+
+// columnKey converts a constant compared with a column to a key of the column
+func columnKey(column parser.ColumnDefinition, expr parser.Expression) (parser.Value, bool) {
+	val, ok := constantKey(column.Type(), expr)
+	if !ok {
+		return nil, false
+	}
+	return parser.Collate(val, column.Collation()), true
+}
+
+// constantText returns the text of a constant string expression
+func constantText(expr parser.Expression) (string, bool) {
+	lit, ok := expr.(parser.LiteralExpression)
+	if !ok || lit.Value().Type() != types.TypeString {
+		return "", false
+	}
+	s, _ := lit.Value().AsString()
+	return s, true
+}
+
+// tableColumn resolves an expression that reads a column of the table
+func tableColumn(schema catalog.TableSchema, alias string, expr parser.Expression) (parser.ColumnDefinition, bool) {
+	col, ok := expr.(parser.ColumnExpression)
+	if !ok {
+		return nil, false
+	}
+	colName := col.ColumnName()
+	if qualifier, name, ok := strings.Cut(colName, "."); ok {
+		if qualifier != alias {
+			return nil, false
+		}
+		colName = name
+	}
+	return schema.GetColumn(colName)
+}
+
+// compareKeys orders two values of the same column type by their key encoding
+func compareKeys(a, b parser.Value) int {
+	return bytes.Compare(storage.EncodeKey([]parser.Value{a}), storage.EncodeKey([]parser.Value{b}))
+}
+
+// splitConjuncts flattens a tree of AND expressions into its terms
+func splitConjuncts(expr parser.Expression) []parser.Expression {
+	if bin, ok := expr.(parser.BinaryExpression); ok && bin.Operator() == "AND" {
+		return append(splitConjuncts(bin.Left()), splitConjuncts(bin.Right())...)
+	}
+	return []parser.Expression{expr}
+}
+
+// flippedOperators gives the operator to use when the operands of a comparison are swapped
+var flippedOperators = map[string]string{
+	"=":  "=",
+	"!=": "!=",
+	"<":  ">",
+	"<=": ">=",
+	">":  "<",
+	">=": "<=",
+}
+
+// sargablePredicate recognizes comparisons between a column and a constant that an index can answer
+func sargablePredicate(schema catalog.TableSchema, alias string, expr parser.Expression) (string, string, parser.Value, bool) {
+	colName, op, val, ok := columnComparison(schema, alias, expr)
+	if !ok || op == "!=" {
+		return "", "", nil, false
+	}
+	return colName, op, val, true
+}
+
+// columnComparison recognizes a comparison between a column of a table and a constant
+func columnComparison(schema catalog.TableSchema, alias string, expr parser.Expression) (string, string, parser.Value, bool) {
+	bin, ok := expr.(parser.BinaryExpression)
+	if !ok {
+		return "", "", nil, false
+	}
+	op, ok := flippedOperators[bin.Operator()]
+	if !ok {
+		return "", "", nil, false
+	}
+
+	column, colOK := tableColumn(schema, alias, bin.Left())
+	lit := bin.Right()
+	if colOK {
+		op = bin.Operator()
+	} else {
+		column, colOK = tableColumn(schema, alias, bin.Right())
+		lit = bin.Left()
+		if !colOK {
+			return "", "", nil, false
+		}
+	}
+
+	val, ok := columnKey(column, lit)
+	if !ok {
+		return "", "", nil, false
+	}
+	return column.Name(), op, val, true
+}
+
+// keyValueFor converts a constant to the type of the column it is compared with
+func keyValueFor(colType types.DataType, val parser.Value) (parser.Value, bool) {
+	if val == nil {
+		return nil, false
+	}
+	if isNull, _ := val.AsNull(); isNull {
+		return nil, false
+	}
+
+	if val.Type() == colType {
+		return val, true
+	}
+
+	switch colType {
+	case types.TypeFloat:
+		if val.Type() == types.TypeInt {
+			i, _ := val.AsInt()
+			return parser.NewFloatValue(float64(i)), true
+		}
+	case types.TypeInt:
+		if val.Type() == types.TypeString {
+			s, _ := val.AsString()
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return parser.NewIntValue(i), true
+			}
+		}
+	case types.TypeDecimal:
+		// Numbers compare with a DECIMAL exactly, as the DECIMAL they are
+		// written as
+		switch val.Type() {
+		case types.TypeInt, types.TypeFloat, types.TypeString:
+			if converted, err := parser.Cast(val, colType); err == nil {
+				return converted, true
+			}
+		}
+	case types.TypeDate, types.TypeTime, types.TypeInterval, types.TypeBlob, types.TypeJSON:
+		if val.Type() == types.TypeString {
+			if converted, err := parser.Cast(val, colType); err == nil {
+				return converted, true
+			}
+		}
+	case types.TypeTimestamp, types.TypeTimestampTZ:
+		// A DATE compares as its midnight, and the two kinds of timestamps
+		// as times in UTC
+		switch val.Type() {
+		case types.TypeString, types.TypeDate, types.TypeTimestamp, types.TypeTimestampTZ:
+			if converted, err := parser.Cast(val, colType); err == nil {
+				return converted, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// planner compiles statements into operator trees
+type planner struct {
+	catalog catalog.Catalog
+	storage storage.Storage
+
+	// analyze wraps every operator to record what it does at run time
+	analyze bool
+
+	// ctx runs the subqueries of the statement and is shared with their planners
+	ctx *execContext
+
+	// parent and outer are the scope and row of the enclosing query, nil for the statement
+	parent *queryScope
+	outer  *outerRow
+
+	// ctes holds the common table expressions the query can read by name
+	ctes map[string]*cte
+}
+
+// newPlanner creates a planner for one statement
+func newPlanner(cat catalog.Catalog, store storage.Storage, analyze bool) *planner {
+	return &planner{catalog: cat, storage: store, analyze: analyze, ctx: newExecContext(store)}
+}
+
+// plan is a statement compiled into an operator tree
+type plan struct {
+	root Operator
+
+	// columns names the columns of the rows produced by root, and types gives their types
+	columns []string
+	types   []types.DataType
+
+	// modify is the operator that changes rows, or nil for a query
+	modify modifyOperator
+
+	// scope resolves the columns of a SELECT statement
+	scope *queryScope
+}
+
+// node registers an operator with the planner as it is added to the tree
+func (p *planner) node(op Operator) Operator {
+	if p.analyze {
+		return newAnalyzedOperator(op, p.storage)
+	}
+	return op
+}
+
+// planStatement compiles a query or data modification statement
+func (p *planner) planStatement(stmt parser.Statement) (*plan, error) {
+	switch stmt.Type() {
+	case types.StmtSelect:
+		return p.planSelect(stmt.(parser.SelectStatement))
+	case types.StmtInsert:
+		return p.planInsert(stmt.(parser.InsertStatement))
+	case types.StmtUpdate:
+		return p.planUpdate(stmt.(parser.UpdateStatement))
+	case types.StmtDelete:
+		return p.planDelete(stmt.(parser.DeleteStatement))
+	default:
+		return nil, fmt.Errorf("statement type %v cannot be planned", stmt.Type())
+	}
+}
+
+// planInsert compiles an INSERT statement into Insert(Values)
+func (p *planner) planInsert(stmt parser.InsertStatement) (*plan, error) {
+	tableName := stmt.TableName()
+	schema, found := p.catalog.GetTable(tableName)
+	if !found {
+		return nil, fmt.Errorf("table '%s' not found", tableName)
+	}
+
+	// If no columns were specified, use all columns from the schema in order
+	columns := stmt.Columns()
+	if len(columns) == 0 {
+		columns = columnNames(schema)
+	} else {
+		for _, colName := range columns {
+			if !schema.HasColumn(colName) {
+				return nil, fmt.Errorf("column '%s' not found in table '%s'", colName, tableName)
+			}
+		}
+	}
+
+	// VALUES are computed before there is a row, so they cannot read columns
+	scope := &queryScope{ctx: p.ctx}
+	for _, values := range stmt.Values() {
+		if len(values) != len(columns) {
+			return nil, fmt.Errorf("column count doesn't match value count")
+		}
+		for _, expr := range values {
+			if err := scope.check(expr, "VALUES", false); err != nil {
+				return nil, err
+			}
+			if err := p.prepareSubqueries(nil, expr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	count := float64(len(stmt.Values()))
+	values := &valuesOperator{estimate: estimate{rows: count}, ctx: p.ctx, columns: columns, rows: stmt.Values()}
+	insert := &insertOperator{
+		estimate: estimate{rows: count},
+		child:    p.node(values),
+		ctx:      p.ctx,
+		storage:  p.storage,
+		writer:   p.writer(),
+		table:    tableName,
+		schema:   schema,
+	}
+
+	return &plan{root: p.node(insert), modify: insert}, nil
+}
+
+// planUpdate compiles an UPDATE statement
+func (p *planner) planUpdate(stmt parser.UpdateStatement) (*plan, error) {
+	tableName := stmt.TableName()
+	schema, found := p.catalog.GetTable(tableName)
+	if !found {
+		return nil, fmt.Errorf("table '%s' not found", tableName)
+	}
+
+	// The SET expressions are evaluated for each row, and may read its
+	// columns
+	scope := tableScope(p.ctx, schema)
+	columns := make([]string, 0, len(stmt.SetClauses()))
+	for colName, expr := range stmt.SetClauses() {
+		if !schema.HasColumn(colName) {
+			return nil, fmt.Errorf("column '%s' not found in table '%s'", colName, tableName)
+		}
+		if err := p.prepareSubqueries(scope, expr); err != nil {
+			return nil, err
+		}
+		if err := scope.check(expr, "SET", false); err != nil {
+			return nil, err
+		}
+		columns = append(columns, colName)
+	}
+	sort.Strings(columns)
+
+	where := stmt.WhereClause()
+	if err := p.prepareSubqueries(scope, where); err != nil {
+		return nil, err
+	}
+	if err := scope.check(where, "WHERE", false); err != nil {
+		return nil, err
+	}
+	access := planAccess(schema, p.catalog.TableIndexes(tableName), where)
+	update := &updateOperator{
+		estimate:  estimate{rows: estimateModifiedRows(schema, access, where)},
+		ctx:       p.ctx,
+		storage:   p.storage,
+		writer:    p.writer(),
+		table:     tableName,
+		schema:    schema,
+		columns:   columns,
+		set:       stmt.SetClauses(),
+		access:    access,
+		condition: where,
+	}
+
+	return &plan{root: p.node(update), modify: update}, nil
+}
+
+// planDelete compiles a DELETE statement
+func (p *planner) planDelete(stmt parser.DeleteStatement) (*plan, error) {
+	tableName := stmt.TableName()
+	schema, found := p.catalog.GetTable(tableName)
+	if !found {
+		return nil, fmt.Errorf("table '%s' not found", tableName)
+	}
+
+	where := stmt.WhereClause()
+	scope := tableScope(p.ctx, schema)
+	if err := p.prepareSubqueries(scope, where); err != nil {
+		return nil, err
+	}
+	if err := scope.check(where, "WHERE", false); err != nil {
+		return nil, err
+	}
+	access := planAccess(schema, p.catalog.TableIndexes(tableName), where)
+	del := &deleteOperator{
+		estimate:  estimate{rows: estimateModifiedRows(schema, access, where)},
+		ctx:       p.ctx,
+		storage:   p.storage,
+		writer:    p.writer(),
+		table:     tableName,
+		access:    access,
+		condition: where,
+	}
+
+	return &plan{root: p.node(del), modify: del}, nil
+}
+
+// writer returns the writer INSERT, UPDATE and DELETE make their changes through
+func (p *planner) writer() *referentialWriter {
+	return &referentialWriter{catalog: p.catalog, storage: p.storage}
+}
+
+// estimateModifiedRows estimates how many rows an UPDATE or DELETE changes
+func estimateModifiedRows(schema catalog.TableSchema, access accessPlan, where parser.Expression) float64 {
+	scope := tableScope(nil, schema)
+	rows := statisticsOf(schema).rows()
+	return math.Min(estimateRows(rows, access.selectivity),
+		estimateRows(rows, estimateSelectivity(scope, where)))
+}
+
+// tableScope is the scope of a statement that works on a single table
+func tableScope(ctx *execContext, schema catalog.TableSchema) *queryScope {
+	return &queryScope{
+		tables: []queryTable{{name: schema.Name(), alias: schema.Name(), schema: schema}},
+		ctx:    ctx,
+	}
+}
+
+// columnNames lists the columns of a table in schema order
+func columnNames(schema catalog.TableSchema) []string {
+	columns := make([]string, 0, len(schema.Columns()))
+	for _, col := range schema.Columns() {
+		columns = append(columns, col.Name())
+	}
+	return columns
+}
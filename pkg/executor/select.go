@@ -0,0 +1,1355 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// defaultGroupFraction is the fraction of its input rows GROUP BY is assumed to leave
+const defaultGroupFraction = 0.1
+
+// queryTable is a table in the FROM clause of a query
+type queryTable struct {
+	name   string
+	alias  string
+	schema catalog.TableSchema
+
+	// cte is the common table expression the table reads, if it is one
+	cte *cte
+
+	// function is the table function the table calls, if it is one
+	function *parser.TableFunction
+	args     []parser.Expression
+
+	// joinType and condition tell how the table is joined to the tables before it
+	joinType  types.JoinType
+	condition parser.Expression
+}
+
+// queryScope resolves the column references of a query against the tables of its FROM clause
+type queryScope struct {
+	tables []queryTable
+	parent *queryScope
+
+	// ctx holds the subqueries planned for the query
+	ctx *execContext
+
+	// outerTables lists the parent tables the query refers to
+	outerTables map[int]bool
+	correlated  bool
+}
+
+// columnRef is a resolved column reference
+type columnRef struct {
+	table  int
+	column string
+	depth  int
+}
+
+// resolve finds the table and column a possibly qualified column name refers to
+func (s *queryScope) resolve(name string) (columnRef, error) {
+	ref, found, err := s.resolveLocal(name)
+	if found || s.parent == nil {
+		return ref, err
+	}
+
+	outer, outerErr := s.parent.resolve(name)
+	if outerErr != nil {
+		return ref, err
+	}
+	if outer.depth == 0 {
+		if s.outerTables == nil {
+			s.outerTables = make(map[int]bool)
+		}
+		s.outerTables[outer.table] = true
+	}
+	s.correlated = true
+	outer.depth++
+	return outer, nil
+}
+
+// local resolves a column name that must belong to one of the query's own tables
+func (s *queryScope) local(name string) (columnRef, bool) {
+	ref, err := s.resolve(name)
+	return ref, err == nil && ref.depth == 0
+}
+
+// resolveLocal resolves a column name against the query's own tables
+func (s *queryScope) resolveLocal(name string) (columnRef, bool, error) {
+	if qualifier, colName, ok := strings.Cut(name, "."); ok {
+		for i, table := range s.tables {
+			if table.alias != qualifier {
+				continue
+			}
+			if !table.schema.HasColumn(colName) {
+				return columnRef{}, true, fmt.Errorf("column '%s' does not exist in table '%s'", colName, table.name)
+			}
+			return columnRef{table: i, column: colName}, true, nil
+		}
+		return columnRef{}, false, fmt.Errorf("table '%s' is not in the FROM clause", qualifier)
+	}
+
+	found := -1
+	for i, table := range s.tables {
+		if !table.schema.HasColumn(name) {
+			continue
+		}
+		if found >= 0 {
+			return columnRef{}, true, fmt.Errorf("column reference '%s' is ambiguous", name)
+		}
+		found = i
+	}
+
+	if found < 0 {
+		if len(s.tables) == 1 {
+			return columnRef{}, false, fmt.Errorf("column '%s' does not exist in table '%s'", name, s.tables[0].name)
+		}
+		return columnRef{}, false, fmt.Errorf("column '%s' does not exist", name)
+	}
+	return columnRef{table: found, column: name}, true, nil
+}
+
+// table returns the table of a resolved column
+func (s *queryScope) table(ref columnRef) queryTable {
+	scope := s
+	for i := 0; i < ref.depth; i++ {
+		scope = scope.parent
+	}
+	return scope.tables[ref.table]
+}
+
+// qualifiedName returns the row key of a resolved column, e.g. "u.id"
+func (s *queryScope) qualifiedName(ref columnRef) string {
+	return s.table(ref).alias + "." + ref.column
+}
+
+// columnKey returns the qualified row key of a column reference
+func (s *queryScope) columnKey(expr parser.Expression) (string, bool) {
+	col, ok := expr.(parser.ColumnExpression)
+	if !ok {
+		return "", false
+	}
+	ref, ok := s.local(col.ColumnName())
+	if !ok {
+		return "", false
+	}
+	return s.qualifiedName(ref), true
+}
+
+// check validates the column references and function calls of an expression
+func (s *queryScope) check(expr parser.Expression, clause string, allowAggregates bool) error {
+	var err error
+	walkExpression(expr, func(e parser.Expression) bool {
+		// The walk goes on to the siblings of an expression it stopped
+		// at, so keep the first error
+		if err != nil {
+			return false
+		}
+		switch e := e.(type) {
+		case parser.ColumnExpression:
+			_, err = s.resolve(e.ColumnName())
+		case parser.WindowExpression:
+			if err = s.checkWindow(e, clause, allowAggregates); err != nil {
+				break
+			}
+			return false
+		case parser.FunctionExpression:
+			// Calls have Args too, so they must be told from COALESCE first
+			if fn := e.Scalar(); fn != nil {
+				_, err = fn.Resolve(expressionTypes(s, e.Args()))
+				break
+			}
+			if err = checkFunctionCall(e, clause, allowAggregates); err != nil {
+				break
+			}
+			if isAggregate(e) {
+				// The arguments are evaluated per row and cannot hold aggregates
+				for _, arg := range e.Args() {
+					if err = s.check(arg, "", false); err != nil {
+						break
+					}
+				}
+				if err == nil {
+					err = s.checkAggregateType(e)
+				}
+				return false
+			}
+		case parser.CaseExpression:
+			if _, ok := commonExpressionType(s, caseResults(e)); !ok {
+				err = fmt.Errorf("CASE results have types that cannot be matched: %v", e)
+			}
+		case parser.CoalesceExpression:
+			if _, ok := commonExpressionType(s, e.Args()); !ok {
+				err = fmt.Errorf("COALESCE arguments have types that cannot be matched: %v", e)
+			}
+		case parser.CastExpression:
+			if from := expressionType(s, e.Operand()); !parser.CanCast(from, e.TargetType()) {
+				err = fmt.Errorf("cannot cast %v to %v", from, e.TargetType())
+			}
+		case parser.CollateExpression:
+			if t := expressionType(s, e.Operand()); t != types.TypeString && t != types.TypeNull {
+				err = fmt.Errorf("COLLATE %v applies to TEXT, not %v", e.Collation(), t)
+			}
+		case parser.LikeExpression:
+			for _, operand := range []parser.Expression{e.Operand(), e.Pattern(), e.Escape()} {
+				if t := expressionType(s, operand); operand != nil && t != types.TypeString && t != types.TypeNull {
+					err = fmt.Errorf("%v needs TEXT operands, got %v", e, t)
+				}
+			}
+		}
+		return err == nil
+	})
+	return err
+}
+
+// checkWindow validates a window function used in the given clause
+func (s *queryScope) checkWindow(window parser.WindowExpression, clause string, allowAggregates bool) error {
+	switch {
+	case clause == "" || clause == windowClause:
+		return fmt.Errorf("window function calls cannot be nested")
+	case !windowClauses[clause]:
+		return fmt.Errorf("window functions are not allowed in %s", clause)
+	}
+	if err := checkWindowCall(window); err != nil {
+		return err
+	}
+
+	var exprs []parser.Expression
+	exprs = append(exprs, window.Function().Args()...)
+	exprs = append(exprs, window.PartitionBy()...)
+	for _, item := range window.OrderBy() {
+		exprs = append(exprs, item.Expr)
+	}
+	for _, expr := range exprs {
+		if err := s.check(expr, windowClause, allowAggregates); err != nil {
+			return err
+		}
+	}
+	return s.checkAggregateType(window.Function())
+}
+
+// checkAggregateType checks the argument of a registered aggregate function call
+func (s *queryScope) checkAggregateType(call parser.FunctionExpression) error {
+	fn := call.Aggregate()
+	if fn == nil {
+		return nil
+	}
+	_, err := fn.Resolve(expressionType(s, call.Args()[0]))
+	return err
+}
+
+// tablesOf lists the tables an expression refers to, including through correlated subqueries
+func (s *queryScope) tablesOf(expr parser.Expression) map[int]bool {
+	tables := make(map[int]bool)
+	walkExpression(expr, func(e parser.Expression) bool {
+		switch e := e.(type) {
+		case parser.ColumnExpression:
+			if ref, ok := s.local(e.ColumnName()); ok {
+				tables[ref.table] = true
+			}
+		case parser.SubqueryExpression:
+			if sub := s.ctx.subplan(e.Query()); sub != nil {
+				for table := range sub.outerTables {
+					tables[table] = true
+				}
+			}
+		}
+		return true
+	})
+	return tables
+}
+
+// checkFunctionCall validates a function call used in the given clause
+func checkFunctionCall(call parser.FunctionExpression, clause string, allowAggregates bool) error {
+	if _, ok := windowFunctions[call.Name()]; ok {
+		return fmt.Errorf("window function %s requires an OVER clause", call.Name())
+	}
+	if !isAggregate(call) {
+		return fmt.Errorf("function %s does not exist", call.Name())
+	}
+	if clause == "" {
+		return fmt.Errorf("aggregate function calls cannot be nested")
+	}
+	if !allowAggregates {
+		return fmt.Errorf("aggregate functions are not allowed in %s", clause)
+	}
+	if call.Star() {
+		if call.Name() != "COUNT" {
+			return fmt.Errorf("%s(*) is not supported", call.Name())
+		}
+		return nil
+	}
+	if len(call.Args()) != 1 {
+		return fmt.Errorf("function %s takes exactly one argument", call.Name())
+	}
+	return nil
+}
+
+// walkExpression calls visit for an expression and its subexpressions while visit returns true
+func walkExpression(expr parser.Expression, visit func(parser.Expression) bool) {
+	if expr == nil || !visit(expr) {
+		return
+	}
+
+	switch e := expr.(type) {
+	case parser.BinaryExpression:
+		walkExpression(e.Left(), visit)
+		walkExpression(e.Right(), visit)
+	case parser.UnaryExpression:
+		walkExpression(e.Operand(), visit)
+	case parser.FunctionExpression:
+		for _, arg := range e.Args() {
+			walkExpression(arg, visit)
+		}
+	case parser.WindowExpression:
+		// The call itself is computed over the window, not as an aggregate
+		for _, arg := range e.Function().Args() {
+			walkExpression(arg, visit)
+		}
+		for _, expr := range e.PartitionBy() {
+			walkExpression(expr, visit)
+		}
+		for _, item := range e.OrderBy() {
+			walkExpression(item.Expr, visit)
+		}
+	case parser.SubqueryExpression:
+		// The subquery itself is planned on its own
+		walkExpression(e.Operand(), visit)
+	case parser.CaseExpression:
+		walkExpression(e.Operand(), visit)
+		for _, when := range e.Whens() {
+			walkExpression(when.When, visit)
+			walkExpression(when.Then, visit)
+		}
+		walkExpression(e.Else(), visit)
+	case parser.CoalesceExpression:
+		for _, arg := range e.Args() {
+			walkExpression(arg, visit)
+		}
+	case parser.NullIfExpression:
+		walkExpression(e.Left(), visit)
+		walkExpression(e.Right(), visit)
+	case parser.CastExpression:
+		walkExpression(e.Operand(), visit)
+	case parser.CollateExpression:
+		walkExpression(e.Operand(), visit)
+	case parser.InListExpression:
+		walkExpression(e.Operand(), visit)
+		for _, expr := range e.List() {
+			walkExpression(expr, visit)
+		}
+	case parser.BetweenExpression:
+		walkExpression(e.Operand(), visit)
+		walkExpression(e.Low(), visit)
+		walkExpression(e.High(), visit)
+	case parser.LikeExpression:
+		walkExpression(e.Operand(), visit)
+		walkExpression(e.Pattern(), visit)
+		walkExpression(e.Escape(), visit)
+	}
+}
+
+// columnReference is a column expression built by the planner for the columns * expands to
+type columnReference struct {
+	name string
+}
+
+func (c *columnReference) Eval(ctx parser.EvalContext, row map[string]parser.Value) (parser.Value, error) {
+	if val, ok := row[c.name]; ok {
+		return val, nil
+	}
+	return parser.NewNullValue(), nil
+}
+
+func (c *columnReference) ColumnName() string {
+	return c.name
+}
+
+func (c *columnReference) String() string {
+	return c.name
+}
+
+// planSelect compiles a SELECT statement
+func (p *planner) planSelect(stmt parser.SelectStatement) (*plan, error) {
+	p, err := p.withCTEs(stmt.With())
+	if err != nil {
+		return nil, err
+	}
+	if compound, ok := stmt.(parser.CompoundSelectStatement); ok {
+		return p.planCompound(compound)
+	}
+	scope, err := p.selectScope(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the clauses evaluated per input row
+	where := stmt.WhereClause()
+	if err := scope.check(where, "WHERE", false); err != nil {
+		return nil, err
+	}
+	for _, table := range scope.tables[1:] {
+		if err := scope.check(table.condition, "JOIN conditions", false); err != nil {
+			return nil, err
+		}
+	}
+	for i := range scope.tables {
+		if err := scope.checkTableFunction(i); err != nil {
+			return nil, err
+		}
+	}
+	for _, expr := range stmt.GroupBy() {
+		if err := scope.check(expr, "GROUP BY", false); err != nil {
+			return nil, err
+		}
+	}
+
+	projections, err := p.projections(scope, selectItems(stmt))
+	if err != nil {
+		return nil, err
+	}
+	having := stmt.Having()
+	if err := scope.check(having, "HAVING", true); err != nil {
+		return nil, err
+	}
+	keys, err := orderByKeys(scope, "ORDER BY", stmt.OrderBy(), projections)
+	if err != nil {
+		return nil, err
+	}
+	distinctOn, err := distinctKeys(scope, stmt, projections, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Turn the IN and EXISTS terms of WHERE into semi joins where possible,
+	// and plan the other subqueries to run per row
+	where, semiJoins, err := p.decorrelate(scope, where)
+	if err != nil {
+		return nil, err
+	}
+	clauses := append([]parser.Expression{where, having}, stmt.GroupBy()...)
+	for _, table := range scope.tables[1:] {
+		clauses = append(clauses, table.condition)
+	}
+	for _, table := range scope.tables {
+		clauses = append(clauses, table.args...)
+	}
+	for _, proj := range projections {
+		clauses = append(clauses, proj.expr)
+	}
+	for _, key := range append(keys, distinctOn...) {
+		clauses = append(clauses, key.expr)
+	}
+	for _, expr := range clauses {
+		if err := p.prepareSubqueries(scope, expr); err != nil {
+			return nil, err
+		}
+	}
+
+	// Collect the aggregate calls of the clauses evaluated per group
+	var aggregates []parser.FunctionExpression
+	seen := make(map[string]bool)
+	collect := func(expr parser.Expression) {
+		walkExpression(expr, func(e parser.Expression) bool {
+			if isAggregate(e) {
+				if text := fmt.Sprint(e); !seen[text] {
+					seen[text] = true
+					aggregates = append(aggregates, e.(parser.FunctionExpression))
+				}
+				return false
+			}
+			return true
+		})
+	}
+	for _, proj := range projections {
+		collect(proj.expr)
+	}
+	collect(having)
+	for _, key := range append(keys, distinctOn...) {
+		collect(key.expr)
+	}
+
+	// Collect the window function calls, which are computed after grouping
+	var windows []parser.WindowExpression
+	collectWindows := func(expr parser.Expression) {
+		walkExpression(expr, func(e parser.Expression) bool {
+			if window, ok := e.(parser.WindowExpression); ok && !seen[fmt.Sprint(e)] {
+				seen[fmt.Sprint(e)] = true
+				windows = append(windows, window)
+			}
+			return true
+		})
+	}
+	for _, proj := range projections {
+		collectWindows(proj.expr)
+	}
+	for _, key := range append(keys, distinctOn...) {
+		collectWindows(key.expr)
+	}
+
+	grouped := len(stmt.GroupBy()) > 0 || len(aggregates) > 0 || having != nil
+	if grouped {
+		if err := checkGrouping(scope, stmt.GroupBy(), projections, having, append(keys, distinctOn...)); err != nil {
+			return nil, err
+		}
+	}
+
+	// FROM and WHERE
+	root, rows := p.planFrom(scope, where)
+	for _, semi := range semiJoins {
+		rows = estimateRows(rows, defaultSelectivity)
+		root = p.node(newSemiJoinOperator(p.ctx, root, semi, rows))
+	}
+
+	// GROUP BY and HAVING
+	if grouped {
+		rows = estimateGroups(scope, stmt.GroupBy(), rows)
+		root = p.node(&aggregateOperator{
+			estimate:   estimate{rows: rows},
+			ctx:        p.ctx,
+			child:      root,
+			groupBy:    stmt.GroupBy(),
+			aggregates: aggregates,
+		})
+		if having != nil {
+			rows = estimateRows(rows, estimateSelectivity(scope, having))
+			root = p.node(newFilterOperator(p.ctx, root, having, rows))
+		}
+	}
+
+	// Window functions
+	if len(windows) > 0 {
+		root = p.planWindows(root, rows, windows)
+	}
+
+	// ORDER BY, DISTINCT ON, the select list, DISTINCT, then LIMIT. Both
+	// kinds of DISTINCT keep the first row of those that are alike, which
+	// is the first in the sort order.
+	if len(keys) > 0 {
+		root = p.node(&sortOperator{estimate: estimate{rows: rows}, ctx: p.ctx, child: root, keys: keys})
+	}
+	if len(distinctOn) > 0 {
+		exprs := make([]parser.Expression, len(distinctOn))
+		for i, key := range distinctOn {
+			exprs[i] = key.expr
+		}
+		rows = estimateDistinct(scope, grouped, exprs, rows)
+		root = p.node(&distinctOperator{estimate: estimate{rows: rows}, ctx: p.ctx, child: root, exprs: exprs, on: true})
+	}
+	root = p.node(&projectOperator{estimate: estimate{rows: rows}, ctx: p.ctx, child: root, projections: projections})
+	if stmt.Distinct() && len(distinctOn) == 0 {
+		inputs := make([]parser.Expression, len(projections))
+		exprs := make([]parser.Expression, len(projections))
+		for i, proj := range projections {
+			inputs[i] = proj.expr
+			exprs[i] = &columnReference{name: proj.name}
+		}
+		rows = estimateDistinct(scope, grouped, inputs, rows)
+		root = p.node(&distinctOperator{estimate: estimate{rows: rows}, ctx: p.ctx, child: root, exprs: exprs})
+	}
+
+	root, _ = p.planLimit(stmt, root, rows)
+
+	columns := make([]string, len(projections))
+	columnTypes := make([]types.DataType, len(projections))
+	for i, proj := range projections {
+		columns[i] = proj.name
+		columnTypes[i] = expressionType(scope, proj.expr)
+	}
+	return &plan{root: root, columns: columns, types: columnTypes, scope: scope}, nil
+}
+
+// planLimit adds the LIMIT and OFFSET of a query on top of its operators
+func (p *planner) planLimit(stmt parser.SelectStatement, root Operator, rows float64) (Operator, float64) {
+	limit, hasLimit := stmt.Limit()
+	if !hasLimit && stmt.Offset() == 0 {
+		return root, rows
+	}
+
+	if !hasLimit {
+		limit = -1
+	}
+	rows = math.Max(0, rows-float64(stmt.Offset()))
+	if hasLimit {
+		rows = math.Min(rows, float64(limit))
+	}
+	return p.node(&limitOperator{estimate: estimate{rows: rows}, child: root, limit: limit, offset: stmt.Offset()}), rows
+}
+
+// expressionType works out the type of an expression, or NULL when it is not known
+func expressionType(scope *queryScope, expr parser.Expression) types.DataType {
+	switch e := expr.(type) {
+	case parser.LiteralExpression:
+		return e.Value().Type()
+	case parser.SequenceExpression:
+		return types.TypeInt
+	case parser.WindowExpression:
+		return windowType(scope, e)
+	case parser.ColumnExpression:
+		if ref, err := scope.resolve(e.ColumnName()); err == nil {
+			return scope.table(ref).schema.GetColumnType(ref.column)
+		}
+	case parser.BinaryExpression:
+		switch e.Operator() {
+		case "||", "->>":
+			return types.TypeString
+		case "->":
+			return types.TypeJSON
+		case "+", "-", "*", "/", "%":
+			return parser.ArithmeticType(e.Operator(), expressionType(scope, e.Left()), expressionType(scope, e.Right()))
+		}
+		return types.TypeBool
+	case parser.UnaryExpression:
+		if e.Operator() == "NOT" {
+			return types.TypeBool
+		}
+		return expressionType(scope, e.Operand())
+	case parser.FunctionExpression:
+		if fn := e.Scalar(); fn != nil {
+			return fn.ReturnType(expressionTypes(scope, e.Args()))
+		}
+		if fn := e.Aggregate(); fn != nil {
+			return fn.ReturnType(expressionType(scope, e.Args()[0]))
+		}
+		switch e.Name() {
+		case "COUNT":
+			return types.TypeInt
+		case "AVG":
+			if len(e.Args()) == 1 && expressionType(scope, e.Args()[0]) == types.TypeDecimal {
+				return types.TypeDecimal
+			}
+			return types.TypeFloat
+		case "SUM", "MIN", "MAX":
+			if len(e.Args()) == 1 {
+				return expressionType(scope, e.Args()[0])
+			}
+		}
+	case parser.SubqueryExpression:
+		if e.Kind() != parser.SubqueryScalar {
+			return types.TypeBool
+		}
+	case parser.CaseExpression:
+		colType, _ := commonExpressionType(scope, caseResults(e))
+		return colType
+	case parser.CoalesceExpression:
+		colType, _ := commonExpressionType(scope, e.Args())
+		return colType
+	case parser.NullIfExpression:
+		return expressionType(scope, e.Left())
+	case parser.CastExpression:
+		return e.TargetType()
+	case parser.CollateExpression:
+		return types.TypeString
+	case parser.InListExpression, parser.BetweenExpression, parser.LikeExpression:
+		return types.TypeBool
+	}
+	return types.TypeNull
+}
+
+// expressionCollation works out the collation that the text of an expression compares under
+func expressionCollation(scope *queryScope, expr parser.Expression) parser.Collation {
+	switch e := expr.(type) {
+	case parser.CollateExpression:
+		return e.Collation()
+	case parser.ColumnExpression:
+		if ref, err := scope.resolve(e.ColumnName()); err == nil {
+			if col, ok := scope.table(ref).schema.GetColumn(ref.column); ok {
+				return col.Collation()
+			}
+		}
+	}
+	return parser.CollateBinary
+}
+
+// expressionTypes gives the types of a list of expressions
+func expressionTypes(scope *queryScope, exprs []parser.Expression) []types.DataType {
+	result := make([]types.DataType, len(exprs))
+	for i, expr := range exprs {
+		result[i] = expressionType(scope, expr)
+	}
+	return result
+}
+
+// commonExpressionType works out the type that expressions combined into one take
+func commonExpressionType(scope *queryScope, exprs []parser.Expression) (types.DataType, bool) {
+	result := types.TypeNull
+	for _, expr := range exprs {
+		var ok bool
+		if result, ok = commonType(result, expressionType(scope, expr)); !ok {
+			return types.TypeNull, false
+		}
+	}
+	return result, true
+}
+
+// caseResults lists the expressions a CASE expression can return
+func caseResults(expr parser.CaseExpression) []parser.Expression {
+	var results []parser.Expression
+	for _, when := range expr.Whens() {
+		results = append(results, when.Then)
+	}
+	if expr.Else() != nil {
+		results = append(results, expr.Else())
+	}
+	return results
+}
+
+// selectScope looks up the tables of the FROM clause of a query
+func (p *planner) selectScope(stmt parser.SelectStatement) (*queryScope, error) {
+	scope := &queryScope{parent: p.parent, ctx: p.ctx}
+
+	add := func(name string, args []parser.Expression, alias string, joinType types.JoinType, condition parser.Expression) error {
+		var schema catalog.TableSchema
+		var fn *parser.TableFunction
+		c, found := p.ctes[name]
+		switch {
+		case args != nil:
+			if fn, found = parser.LookupTableFunction(name); !found {
+				return fmt.Errorf("table function %s does not exist", name)
+			}
+			schema = tableFunctionSchema(name, fn)
+			c = nil
+		case found:
+			schema = c.schema
+		default:
+			if schema, found = p.catalog.GetTable(name); !found {
+				return fmt.Errorf("table '%s' not found", name)
+			}
+		}
+		if alias == "" {
+			alias = name
+		}
+		for _, table := range scope.tables {
+			if table.alias == alias {
+				return fmt.Errorf("table name '%s' specified more than once", alias)
+			}
+		}
+
+		scope.tables = append(scope.tables, queryTable{
+			name:      name,
+			alias:     alias,
+			schema:    schema,
+			cte:       c,
+			function:  fn,
+			args:      args,
+			joinType:  joinType,
+			condition: condition,
+		})
+		return nil
+	}
+
+	if err := add(stmt.TableName(), stmt.TableArgs(), stmt.TableAlias(), types.JoinInner, nil); err != nil {
+		return nil, err
+	}
+	for _, join := range stmt.Joins() {
+		if err := add(join.Table, join.Args, join.Alias, join.Type, join.Condition); err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
+
+// selectItems returns the select list of a statement
+func selectItems(stmt parser.SelectStatement) []parser.SelectItem {
+	if items := stmt.Items(); len(items) > 0 {
+		return items
+	}
+
+	var items []parser.SelectItem
+	for _, name := range stmt.Columns() {
+		if name == "*" {
+			items = append(items, parser.SelectItem{Star: true})
+		} else {
+			items = append(items, parser.SelectItem{Expr: &columnReference{name: name}})
+		}
+	}
+	if len(items) == 0 {
+		items = append(items, parser.SelectItem{Star: true})
+	}
+	return items
+}
+
+// projections works out the output columns of a select list
+func (p *planner) projections(scope *queryScope, items []parser.SelectItem) ([]projection, error) {
+	var projections []projection
+	var qualified []string
+
+	for _, item := range items {
+		if item.Star {
+			found := false
+			for _, table := range scope.tables {
+				if item.Table != "" && item.Table != table.alias {
+					continue
+				}
+				found = true
+				for _, colName := range columnNames(table.schema) {
+					name := table.alias + "." + colName
+					projections = append(projections, projection{name: colName, expr: &columnReference{name: name}})
+					qualified = append(qualified, name)
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("table '%s' is not in the FROM clause", item.Table)
+			}
+			continue
+		}
+
+		if err := scope.check(item.Expr, "the select list", true); err != nil {
+			return nil, err
+		}
+
+		proj := projection{name: item.Alias, expr: item.Expr}
+		qualifiedName := ""
+		if col, ok := item.Expr.(parser.ColumnExpression); ok {
+			ref, _ := scope.resolve(col.ColumnName())
+			qualifiedName = scope.qualifiedName(ref)
+			if proj.name == "" {
+				proj.name = ref.column
+			}
+		}
+		if proj.name == "" {
+			proj.name = fmt.Sprint(item.Expr)
+		}
+		if item.Alias != "" {
+			qualifiedName = ""
+		}
+		projections = append(projections, proj)
+		qualified = append(qualified, qualifiedName)
+	}
+
+	// Qualify the names of columns that would clash
+	counts := make(map[string]int)
+	for _, proj := range projections {
+		counts[proj.name]++
+	}
+	for i := range projections {
+		if counts[projections[i].name] > 1 && qualified[i] != "" {
+			projections[i].name = qualified[i]
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, proj := range projections {
+		if names[proj.name] {
+			return nil, fmt.Errorf("column '%s' appears more than once in the select list", proj.name)
+		}
+		names[proj.name] = true
+	}
+	return projections, nil
+}
+
+// orderByKeys resolves the sort keys of an ORDER BY clause
+func orderByKeys(scope *queryScope, clause string, orderBy []parser.OrderByItem, projections []projection) ([]sortKey, error) {
+	keys := make([]sortKey, 0, len(orderBy))
+	for _, item := range orderBy {
+		key := sortKey{expr: item.Expr, descending: item.Descending}
+
+		if lit, ok := item.Expr.(parser.LiteralExpression); ok && lit.Value().Type() == types.TypeInt {
+			pos, _ := lit.Value().AsInt()
+			if pos < 1 || pos > int64(len(projections)) {
+				return nil, fmt.Errorf("%s position %d is not in select list", clause, pos)
+			}
+			key.expr = projections[pos-1].expr
+		} else if col, ok := item.Expr.(parser.ColumnExpression); ok && projectionNamed(projections, col.ColumnName()) != nil {
+			key.expr = projectionNamed(projections, col.ColumnName()).expr
+		} else if err := scope.check(item.Expr, clause, true); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// distinctKeys resolves the expressions of DISTINCT ON and checks them against ORDER BY
+func distinctKeys(scope *queryScope, stmt parser.SelectStatement, projections []projection, orderBy []sortKey) ([]sortKey, error) {
+	if !stmt.Distinct() {
+		return nil, nil
+	}
+	if len(stmt.DistinctOn()) == 0 {
+		for _, key := range orderBy {
+			found := false
+			for _, proj := range projections {
+				found = found || fmt.Sprint(proj.expr) == fmt.Sprint(key.expr)
+			}
+			if !found {
+				return nil, fmt.Errorf("for SELECT DISTINCT, ORDER BY expressions must appear in select list")
+			}
+		}
+		return nil, nil
+	}
+
+	items := make([]parser.OrderByItem, len(stmt.DistinctOn()))
+	for i, expr := range stmt.DistinctOn() {
+		items[i] = parser.OrderByItem{Expr: expr}
+	}
+	keys, err := orderByKeys(scope, "DISTINCT ON", items, projections)
+	if err != nil {
+		return nil, err
+	}
+
+	on := make(map[string]bool)
+	for _, key := range keys {
+		on[fmt.Sprint(key.expr)] = false
+	}
+	unused := len(on)
+	for _, key := range orderBy {
+		if unused == 0 {
+			break
+		}
+		used, ok := on[fmt.Sprint(key.expr)]
+		if !ok {
+			return nil, fmt.Errorf("SELECT DISTINCT ON expressions must match initial ORDER BY expressions")
+		}
+		if !used {
+			on[fmt.Sprint(key.expr)] = true
+			unused--
+		}
+	}
+	return keys, nil
+}
+
+// projectionNamed finds the output column with the given name
+func projectionNamed(projections []projection, name string) *projection {
+	for i := range projections {
+		if projections[i].name == name {
+			return &projections[i]
+		}
+	}
+	return nil
+}
+
+// checkGrouping checks that the clauses evaluated per group only read grouped values
+func checkGrouping(scope *queryScope, groupBy []parser.Expression, projections []projection, having parser.Expression, keys []sortKey) error {
+	groupExprs := make(map[string]bool)
+	groupColumns := make(map[columnRef]bool)
+	for _, expr := range groupBy {
+		groupExprs[fmt.Sprint(expr)] = true
+		if col, ok := expr.(parser.ColumnExpression); ok {
+			if ref, err := scope.resolve(col.ColumnName()); err == nil {
+				groupColumns[ref] = true
+			}
+		}
+	}
+
+	check := func(expr parser.Expression) error {
+		var err error
+		walkExpression(expr, func(e parser.Expression) bool {
+			if groupExprs[fmt.Sprint(e)] || isAggregate(e) {
+				return false
+			}
+			if col, ok := e.(parser.ColumnExpression); ok {
+				ref, resolveErr := scope.resolve(col.ColumnName())
+				if resolveErr == nil && ref.depth == 0 && !groupColumns[ref] {
+					err = fmt.Errorf("column '%s' must appear in the GROUP BY clause or be used in an aggregate function", col.ColumnName())
+				}
+			}
+			return err == nil
+		})
+		return err
+	}
+
+	for _, proj := range projections {
+		if err := check(proj.expr); err != nil {
+			return err
+		}
+	}
+	if err := check(having); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := check(key.expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planFrom builds the scans and joins of the FROM clause and applies the WHERE clause
+func (p *planner) planFrom(scope *queryScope, where parser.Expression) (Operator, float64) {
+	var whereTerms []parser.Expression
+	if !isAlwaysTrue(where) {
+		whereTerms = splitConjuncts(where)
+	}
+
+	for i, table := range scope.tables {
+		if (i > 0 && table.joinType == types.JoinLeft) || table.function != nil {
+			return p.planJoinsAsWritten(scope, where, whereTerms)
+		}
+	}
+	return p.planInnerJoins(scope, whereTerms)
+}
+
+// planInnerJoins orders inner and cross joins greedily into a left-deep tree
+func (p *planner) planInnerJoins(scope *queryScope, whereTerms []parser.Expression) (Operator, float64) {
+	terms := whereTerms
+	for _, table := range scope.tables[1:] {
+		if table.condition != nil {
+			terms = append(terms, splitConjuncts(table.condition)...)
+		}
+	}
+
+	var joinTerms, constantTerms []parser.Expression
+	for _, term := range terms {
+		switch len(scope.tablesOf(term)) {
+		case 0:
+			constantTerms = append(constantTerms, term)
+		case 1:
+		default:
+			joinTerms = append(joinTerms, term)
+		}
+	}
+
+	// Read each table with the terms that only involve it
+	inputs := make([]joinInput, len(scope.tables))
+	for i := range scope.tables {
+		inputs[i] = p.planTableInput(scope, i, singleTableTerms(scope, i, terms), true)
+	}
+
+	first := 0
+	for i := range inputs {
+		if inputs[i].rows < inputs[first].rows {
+			first = i
+		}
+	}
+	result := inputs[first]
+	used := make([]bool, len(joinTerms))
+
+	for len(result.tables) < len(inputs) {
+		next, nextRows, nextConnected := -1, 0.0, false
+		var nextTerms []int
+		for i := range inputs {
+			if result.tables[i] {
+				continue
+			}
+
+			// The unused join terms that become available with this table
+			var available []int
+			for j, term := range joinTerms {
+				if used[j] || !scope.tablesOf(term)[i] {
+					continue
+				}
+				ready := true
+				for table := range scope.tablesOf(term) {
+					if table != i && !result.tables[table] {
+						ready = false
+					}
+				}
+				if ready {
+					available = append(available, j)
+				}
+			}
+
+			joinRows := result.rows * inputs[i].rows
+			if len(available) > 0 {
+				joinRows = estimateRows(joinRows, estimateSelectivity(scope, conjunction(pickTerms(joinTerms, available))))
+			}
+			connected := len(available) > 0
+			if next < 0 || (connected && !nextConnected) || (connected == nextConnected && joinRows < nextRows) {
+				next, nextRows, nextConnected, nextTerms = i, joinRows, connected, available
+			}
+		}
+
+		for _, j := range nextTerms {
+			used[j] = true
+		}
+		if nextConnected {
+			result = p.planJoin(scope, types.JoinInner, result, inputs[next], conjunction(pickTerms(joinTerms, nextTerms)), nil, nextRows)
+		} else {
+			result = p.planJoin(scope, types.JoinCross, result, inputs[next], nil, nil, nextRows)
+		}
+	}
+
+	root, rows := result.op, result.rows
+	if len(constantTerms) > 0 {
+		condition := conjunction(constantTerms)
+		rows = estimateRows(rows, estimateSelectivity(scope, condition))
+		root = p.node(newFilterOperator(p.ctx, root, condition, rows))
+	}
+	return root, rows
+}
+
+// planJoinsAsWritten joins the tables of a FROM clause in the order they are written
+func (p *planner) planJoinsAsWritten(scope *queryScope, where parser.Expression, whereTerms []parser.Expression) (Operator, float64) {
+	var result joinInput
+	var unfiltered float64
+	for i, table := range scope.tables {
+		if table.function != nil {
+			result, unfiltered = p.planTableFunction(scope, i, result, unfiltered)
+			continue
+		}
+
+		// Terms that only read this table
+		var terms []parser.Expression
+		if table.joinType != types.JoinLeft {
+			terms = append(terms, singleTableTerms(scope, i, whereTerms)...)
+		}
+		if i > 0 && table.condition != nil {
+			terms = append(terms, singleTableTerms(scope, i, splitConjuncts(table.condition))...)
+		}
+
+		input := p.planTableInput(scope, i, terms, false)
+		tableRows := statisticsOf(table.schema).rows()
+		if i == 0 {
+			result, unfiltered = input, tableRows
+			continue
+		}
+
+		joinRows := result.rows * input.rows
+		unfiltered *= tableRows
+		if table.condition != nil {
+			selectivity := estimateSelectivity(scope, table.condition)
+			joinRows = estimateRows(joinRows, selectivity)
+			unfiltered = estimateRows(unfiltered, selectivity)
+		}
+		if table.joinType == types.JoinLeft {
+			joinRows = math.Max(joinRows, result.rows)
+		}
+
+		nullRow := make(storage.Row)
+		for _, colName := range columnNames(table.schema) {
+			nullRow[colName] = parser.NewNullValue()
+			nullRow[table.alias+"."+colName] = parser.NewNullValue()
+		}
+		result = p.planJoin(scope, table.joinType, result, input, table.condition, nullRow, joinRows)
+	}
+
+	root, rows := result.op, result.rows
+	if !isAlwaysTrue(where) {
+		rows = math.Min(rows, estimateRows(unfiltered, estimateSelectivity(scope, where)))
+		root = p.node(newFilterOperator(p.ctx, root, where, rows))
+	}
+	return root, rows
+}
+
+// joinInput is an input of a join while the joins are planned
+type joinInput struct {
+	op     Operator
+	rows   float64
+	tables map[int]bool
+
+	// orderedBy is the row key of the column the rows come sorted on, or empty
+	orderedBy string
+
+	// indexOrdered rebuilds the input to read through an index sorted on a column, if it can
+	indexOrdered func(column string) (Operator, bool)
+}
+
+// Costs of the join algorithms, in the units of the scan costs
+const (
+	hashBuildCost = 2
+	spillCost     = 2
+)
+
+// planJoin joins two inputs with the cheapest join algorithm that applies
+func (p *planner) planJoin(scope *queryScope, joinType types.JoinType, left, right joinInput, condition parser.Expression, nullRow storage.Row, rows float64) joinInput {
+	result := joinInput{rows: rows, tables: make(map[int]bool)}
+	for table := range left.tables {
+		result.tables[table] = true
+	}
+	for table := range right.tables {
+		result.tables[table] = true
+	}
+
+	// A nested loop join works for every condition
+	result.op = newNestedLoopJoinOperator(p.ctx, joinType, left.op, right.op, condition, nullRow, rows)
+	result.orderedBy = left.orderedBy
+	keys := equiJoinKeys(scope, left.tables, right.tables, condition)
+	if joinType == types.JoinCross || len(keys) == 0 {
+		result.op = p.node(result.op)
+		return result
+	}
+	bestCost := left.rows * right.rows
+
+	// A hash join builds on the smaller input when the join allows it
+	probe, build, hashKeys := left, right, keys
+	if joinType == types.JoinInner && right.rows > left.rows {
+		probe, build = right, left
+		hashKeys = make([]joinKey, len(keys))
+		for i, key := range keys {
+			hashKeys[i] = joinKey{left: key.right, right: key.left}
+		}
+	}
+	cost := probe.rows + hashBuildCost*build.rows
+	if build.rows > defaultHashJoinBudget {
+		cost += spillCost * (probe.rows + build.rows)
+	}
+	if cost < bestCost {
+		bestCost = cost
+		result.op = newHashJoinOperator(p.ctx, joinType, probe.op, build.op, hashKeys, condition, nullRow, rows)
+		result.orderedBy = ""
+	}
+
+	// A merge join needs both inputs sorted on a pair of compared columns
+	for _, key := range keys {
+		leftColumn, leftOK := scope.columnKey(key.left)
+		rightColumn, rightOK := scope.columnKey(key.right)
+		if !leftOK || !rightOK {
+			continue
+		}
+
+		leftOp, leftCost := p.orderedInput(left, leftColumn, key.left)
+		rightOp, rightCost := p.orderedInput(right, rightColumn, key.right)
+		if cost := left.rows + right.rows + leftCost + rightCost; cost < bestCost {
+			bestCost = cost
+			result.op = newMergeJoinOperator(p.ctx, joinType, leftOp, rightOp, key, condition, nullRow, rows)
+			result.orderedBy = leftColumn
+		}
+	}
+
+	result.op = p.node(result.op)
+	return result
+}
+
+// orderedInput returns an input sorted on a column, along with the cost of sorting it
+func (p *planner) orderedInput(input joinInput, column string, expr parser.Expression) (Operator, float64) {
+	if input.orderedBy == column {
+		return input.op, 0
+	}
+	if input.indexOrdered != nil {
+		if op, ok := input.indexOrdered(column); ok {
+			return op, (indexRowCost-1)*input.rows + indexLookupCost
+		}
+	}
+
+	sort := &sortOperator{estimate: estimate{rows: input.rows}, ctx: p.ctx, child: input.op, keys: []sortKey{{expr: expr}}}
+	return p.node(sort), input.rows * math.Log2(math.Max(2, input.rows))
+}
+
+// equiJoinKeys finds the equality terms of a join condition between the left and right tables
+func equiJoinKeys(scope *queryScope, leftTables, rightTables map[int]bool, condition parser.Expression) []joinKey {
+	if condition == nil {
+		return nil
+	}
+
+	within := func(tables, side map[int]bool) bool {
+		for table := range tables {
+			if !side[table] {
+				return false
+			}
+		}
+		return len(tables) > 0
+	}
+
+	var keys []joinKey
+	for _, term := range splitConjuncts(condition) {
+		bin, ok := term.(parser.BinaryExpression)
+		if !ok || bin.Operator() != "=" {
+			continue
+		}
+		// Keys hash under the collation of their own text, so sides that
+		// compare under different collations cannot be hashed
+		if expressionCollation(scope, bin.Left()) != expressionCollation(scope, bin.Right()) {
+			continue
+		}
+		leftOf, rightOf := scope.tablesOf(bin.Left()), scope.tablesOf(bin.Right())
+		switch {
+		case within(leftOf, leftTables) && within(rightOf, rightTables):
+			keys = append(keys, joinKey{left: bin.Left(), right: bin.Right()})
+		case within(rightOf, leftTables) && within(leftOf, rightTables):
+			keys = append(keys, joinKey{left: bin.Right(), right: bin.Left()})
+		}
+	}
+	return keys
+}
+
+// pickTerms returns the terms at the given positions
+func pickTerms(terms []parser.Expression, positions []int) []parser.Expression {
+	result := make([]parser.Expression, len(positions))
+	for i, pos := range positions {
+		result[i] = terms[pos]
+	}
+	return result
+}
+
+// conjunction joins terms with AND, or returns nil when there are none
+func conjunction(terms []parser.Expression) parser.Expression {
+	var result parser.Expression
+	for _, term := range terms {
+		if result == nil {
+			result = term
+		} else {
+			result = parser.NewBinaryExpression("AND", result, term)
+		}
+	}
+	return result
+}
+
+// singleTableTerms returns the terms that read columns of the given table and of no other
+func singleTableTerms(scope *queryScope, table int, terms []parser.Expression) []parser.Expression {
+	var result []parser.Expression
+	for _, term := range terms {
+		tables := scope.tablesOf(term)
+		if len(tables) == 1 && tables[table] {
+			result = append(result, term)
+		}
+	}
+	return result
+}
+
+// planTableInput chooses between a full scan and an index scan of a table
+func (p *planner) planTableInput(scope *queryScope, i int, terms []parser.Expression, filter bool) joinInput {
+	table := scope.tables[i]
+	if table.cte != nil {
+		return p.planCTEInput(scope, i, terms, filter)
+	}
+	indexes := p.catalog.TableIndexes(table.name)
+	access := planTermsAccess(table.schema, table.alias, indexes, terms)
+	tableRows := statisticsOf(table.schema).rows()
+	scanRows := estimateRows(tableRows, access.selectivity)
+
+	rows := scanRows
+	var condition parser.Expression
+	if filter && len(terms) > 0 {
+		condition = conjunction(terms)
+		rows = math.Min(rows, estimateRows(tableRows, estimateSelectivity(scope, condition)))
+	}
+
+	build := func(access accessPlan) Operator {
+		cursor := tableCursor{storage: p.storage, table: table.name, alias: table.alias, outer: p.outer}
+		var op Operator
+		if access.method == accessFullScan {
+			op = p.node(&scanOperator{estimate: estimate{rows: scanRows}, tableCursor: cursor})
+		} else {
+			op = p.node(&indexScanOperator{estimate: estimate{rows: scanRows}, tableCursor: cursor, access: access})
+		}
+		if condition != nil {
+			op = p.node(newFilterOperator(p.ctx, op, condition, rows))
+		}
+		return op
+	}
+
+	input := joinInput{op: build(access), rows: rows, tables: map[int]bool{i: true}}
+	if access.method != accessFullScan {
+		// Index paths return rows in key order
+		if access.index.Expression(0) == nil {
+			input.orderedBy = table.alias + "." + access.index.Columns[0]
+		}
+		return input
+	}
+
+	input.indexOrdered = func(column string) (Operator, bool) {
+		for _, index := range indexes {
+			if index.Expression(0) != nil || table.alias+"."+index.Columns[0] != column {
+				continue
+			}
+			return build(accessPlan{
+				method: accessIndexOrder,
+				index:  index,
+				path: storage.AccessPath{
+					Index:  index.Name,
+					Ranges: []storage.KeyRange{{}},
+				},
+				selectivity: 1,
+			}), true
+		}
+		return nil, false
+	}
+	return input
+}
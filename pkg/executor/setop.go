@@ -0,0 +1,240 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// planCompound compiles a query that combines two queries with a set operator
+func (p *planner) planCompound(stmt parser.CompoundSelectStatement) (*plan, error) {
+	left, err := p.planSelect(stmt.Left())
+	if err != nil {
+		return nil, err
+	}
+	right, err := p.planSelect(stmt.Right())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(left.columns) != len(right.columns) {
+		return nil, fmt.Errorf("each %s query must have the same number of columns", stmt.Operator())
+	}
+	columnTypes := make([]types.DataType, len(left.columns))
+	for i := range left.columns {
+		colType, ok := commonType(left.types[i], right.types[i])
+		if !ok {
+			return nil, fmt.Errorf("%s types %v and %v cannot be matched", stmt.Operator(), left.types[i], right.types[i])
+		}
+		columnTypes[i] = colType
+	}
+
+	var rows float64
+	switch stmt.Operator() {
+	case "UNION":
+		rows = left.root.EstimatedRows() + right.root.EstimatedRows()
+	case "INTERSECT":
+		rows = math.Min(left.root.EstimatedRows(), right.root.EstimatedRows())
+	default:
+		rows = left.root.EstimatedRows()
+	}
+	root := p.node(&setOperator{
+		estimate:     estimate{rows: rows},
+		operator:     stmt.Operator(),
+		all:          stmt.All(),
+		left:         left.root,
+		right:        right.root,
+		leftColumns:  left.columns,
+		rightColumns: right.columns,
+		columns:      left.columns,
+		types:        columnTypes,
+	})
+
+	if len(stmt.OrderBy()) > 0 {
+		keys := make([]sortKey, len(stmt.OrderBy()))
+		for i, item := range stmt.OrderBy() {
+			name, ok := resultColumn(left.columns, item.Expr)
+			if !ok {
+				return nil, fmt.Errorf("ORDER BY of a %s query can only use result column names or positions, not %v", stmt.Operator(), item.Expr)
+			}
+			keys[i] = sortKey{expr: &columnReference{name: name}, descending: item.Descending}
+		}
+		root = p.node(&sortOperator{estimate: estimate{rows: rows}, ctx: p.ctx, child: root, keys: keys})
+	}
+	root, _ = p.planLimit(stmt, root, rows)
+
+	// As a subquery, the query refers to the outer columns either side does
+	scope := &queryScope{parent: p.parent, ctx: p.ctx, correlated: left.scope.correlated || right.scope.correlated}
+	for _, side := range []*queryScope{left.scope, right.scope} {
+		for table := range side.outerTables {
+			if scope.outerTables == nil {
+				scope.outerTables = make(map[int]bool)
+			}
+			scope.outerTables[table] = true
+		}
+	}
+	return &plan{root: root, columns: left.columns, types: columnTypes, scope: scope}, nil
+}
+
+// resultColumn finds the result column an ORDER BY key of a compound query names
+func resultColumn(columns []string, expr parser.Expression) (string, bool) {
+	if lit, ok := expr.(parser.LiteralExpression); ok && lit.Value().Type() == types.TypeInt {
+		pos, _ := lit.Value().AsInt()
+		if pos < 1 || pos > int64(len(columns)) {
+			return "", false
+		}
+		return columns[pos-1], true
+	}
+	if col, ok := expr.(parser.ColumnExpression); ok {
+		for _, name := range columns {
+			if name == col.ColumnName() {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// commonType returns the type two columns combined into one take, or false
+func commonType(a, b types.DataType) (types.DataType, bool) {
+	switch {
+	case a == b || b == types.TypeNull:
+		return a, true
+	case a == types.TypeNull:
+		return b, true
+	case (a == types.TypeInt && b == types.TypeFloat) || (a == types.TypeFloat && b == types.TypeInt):
+		return types.TypeFloat, true
+	case (a == types.TypeDecimal && (b == types.TypeInt || b == types.TypeFloat)) ||
+		(b == types.TypeDecimal && (a == types.TypeInt || a == types.TypeFloat)):
+		return types.TypeDecimal, true
+	}
+	return types.TypeNull, false
+}
+
+// setOperator combines the rows of two queries with UNION, INTERSECT or EXCEPT
+type setOperator struct {
+	estimate
+	operator string
+	all      bool
+	left     Operator
+	right    Operator
+
+	// Input rows are keyed by their own column names and returned keyed by columns
+	leftColumns  []string
+	rightColumns []string
+	columns      []string
+	types        []types.DataType
+
+	rows []storage.Row
+	pos  int
+}
+
+func (o *setOperator) Open() error {
+	o.rows, o.pos = nil, 0
+
+	left, err := drain(o.left)
+	if err != nil {
+		return err
+	}
+	right, err := drain(o.right)
+	if err != nil {
+		return err
+	}
+	left = o.convert(renameColumns(left, o.leftColumns, o.columns))
+	right = o.convert(renameColumns(right, o.rightColumns, o.columns))
+
+	if o.operator == "UNION" {
+		if o.all {
+			o.rows = append(left, right...)
+			return nil
+		}
+		seen := make(map[string]bool)
+		for _, row := range append(left, right...) {
+			if key := o.key(row); !seen[key] {
+				seen[key] = true
+				o.rows = append(o.rows, row)
+			}
+		}
+		return nil
+	}
+
+	// Count the rows of the right query, then let each row of the left one
+	// use up a count
+	counts := make(map[string]int)
+	for _, row := range right {
+		counts[o.key(row)]++
+	}
+	returned := make(map[string]bool)
+	for _, row := range left {
+		key := o.key(row)
+		if !o.all && returned[key] {
+			continue
+		}
+
+		found := counts[key] > 0
+		if o.all && found {
+			counts[key]--
+		}
+		if found == (o.operator == "INTERSECT") {
+			o.rows = append(o.rows, row)
+			returned[key] = true
+		}
+	}
+	return nil
+}
+
+// convert changes the values of rows to the types of the result columns
+func (o *setOperator) convert(rows []storage.Row) []storage.Row {
+	for _, row := range rows {
+		for i, name := range o.columns {
+			val := row[name]
+			if val == nil || isNullValue(val) || val.Type() == o.types[i] {
+				continue
+			}
+			switch o.types[i] {
+			case types.TypeFloat, types.TypeDecimal:
+				if converted, err := parser.Cast(val, o.types[i]); err == nil {
+					row[name] = converted
+				}
+			}
+		}
+	}
+	return rows
+}
+
+// key encodes the values of a row to compare it with others
+func (o *setOperator) key(row storage.Row) string {
+	values := make([]parser.Value, len(o.columns))
+	for i, name := range o.columns {
+		values[i] = row[name]
+	}
+	return parser.HashKey(values)
+}
+
+func (o *setOperator) Next() (storage.Row, error) {
+	if o.pos >= len(o.rows) {
+		return nil, nil
+	}
+	o.pos++
+	return o.rows[o.pos-1], nil
+}
+
+func (o *setOperator) Close() error {
+	o.rows = nil
+	return nil
+}
+
+func (o *setOperator) Children() []Operator {
+	return []Operator{o.left, o.right}
+}
+
+func (o *setOperator) Describe() (string, string) {
+	name := map[string]string{"UNION": "Union", "INTERSECT": "Intersect", "EXCEPT": "Except"}[o.operator]
+	if o.all {
+		return name, "all"
+	}
+	return name, ""
+}
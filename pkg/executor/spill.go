@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+)
+
+// spillFile is a temporary file that operators write rows to when they do not fit in memory
+type spillFile struct {
+	file   *os.File
+	writer *bufio.Writer
+	enc    *json.Encoder
+}
+
+// newSpillFile creates an empty spill file in the temporary directory
+func newSpillFile() (*spillFile, error) {
+	file, err := os.CreateTemp("", "sqldb-spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	return &spillFile{file: file, writer: writer, enc: json.NewEncoder(writer)}, nil
+}
+
+// write appends a row to the file
+func (f *spillFile) write(row storage.Row) error {
+	encoded := make(map[string]storage.EncodedValue, len(row))
+	for colName, val := range row {
+		ev, err := storage.EncodeValue(val)
+		if err != nil {
+			return fmt.Errorf("failed to write spill file: %w", err)
+		}
+		encoded[colName] = ev
+	}
+	return f.enc.Encode(encoded)
+}
+
+// reader finishes writing and returns a source of the rows in the file
+func (f *spillFile) reader() (rowSource, error) {
+	if err := f.writer.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &spillReader{dec: json.NewDecoder(bufio.NewReader(f.file))}, nil
+}
+
+// remove closes and deletes the file
+func (f *spillFile) remove() {
+	f.file.Close()
+	os.Remove(f.file.Name())
+}
+
+// spillReader reads back the rows of a spill file
+type spillReader struct {
+	dec *json.Decoder
+}
+
+func (r *spillReader) Next() (storage.Row, error) {
+	var encoded map[string]storage.EncodedValue
+	if err := r.dec.Decode(&encoded); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read spill file: %w", err)
+	}
+
+	row := make(storage.Row, len(encoded))
+	for colName, ev := range encoded {
+		row[colName] = ev.Value()
+	}
+	return row, nil
+}
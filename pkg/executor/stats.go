@@ -0,0 +1,333 @@
+package executor
+
+import (
+	"math"
+	"sort"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// Row estimates for tables that have not been analyzed
+const (
+	defaultTableRows      = 1000
+	equalitySelectivity   = 0.005
+	rangeBoundSelectivity = 1.0 / 3
+	defaultSelectivity    = 0.5
+)
+
+// tableStatistics answers the planner's questions about the rows of a table
+type tableStatistics struct {
+	stats    catalog.TableStats
+	analyzed bool
+}
+
+// statisticsOf returns the statistics of a table
+func statisticsOf(schema catalog.TableSchema) tableStatistics {
+	stats, ok := schema.Stats()
+	return tableStatistics{stats: stats, analyzed: ok}
+}
+
+// rows estimates the number of rows in the table
+func (t tableStatistics) rows() float64 {
+	if !t.analyzed {
+		return defaultTableRows
+	}
+	return float64(t.stats.RowCount)
+}
+
+// column returns the statistics of a column, if the table was analyzed
+func (t tableStatistics) column(colName string) (catalog.ColumnStats, bool) {
+	if !t.analyzed {
+		return catalog.ColumnStats{}, false
+	}
+	col, ok := t.stats.Columns[colName]
+	return col, ok
+}
+
+// nullFraction estimates the fraction of rows in which a column is NULL
+func (t tableStatistics) nullFraction(colName string) float64 {
+	col, _ := t.column(colName)
+	return col.NullFraction
+}
+
+// equalSelectivity estimates the fraction of rows in which a column equals a constant
+func (t tableStatistics) equalSelectivity(colName string, val parser.Value) float64 {
+	col, ok := t.column(colName)
+	if !ok {
+		return equalitySelectivity
+	}
+	if col.DistinctCount == 0 || outsideHistogram(col.Histogram, val) {
+		return 0
+	}
+	return (1 - col.NullFraction) / float64(col.DistinctCount)
+}
+
+// rangeSelectivity estimates the fraction of rows in which a column lies between two constants
+func (t tableStatistics) rangeSelectivity(colName string, low parser.Value, lowInclusive bool, high parser.Value, highInclusive bool) float64 {
+	col, ok := t.column(colName)
+	if !ok {
+		selectivity := 1.0
+		if low != nil {
+			selectivity *= rangeBoundSelectivity
+		}
+		if high != nil {
+			selectivity *= rangeBoundSelectivity
+		}
+		return selectivity
+	}
+	if len(col.Histogram) == 0 {
+		return 0
+	}
+
+	upper := 1.0
+	if high != nil {
+		upper = fractionBelow(col, high, highInclusive)
+	}
+	lower := 0.0
+	if low != nil {
+		lower = fractionBelow(col, low, !lowInclusive)
+	}
+	return math.Max(0, upper-lower) * (1 - col.NullFraction)
+}
+
+// outsideHistogram reports whether a value lies outside the range a histogram covers
+func outsideHistogram(hist []parser.Value, val parser.Value) bool {
+	if len(hist) == 0 {
+		return true
+	}
+	return compareKeys(val, hist[0]) < 0 || compareKeys(val, hist[len(hist)-1]) > 0
+}
+
+// fractionBelow estimates the fraction of the non-NULL values of a column below val
+func fractionBelow(col catalog.ColumnStats, val parser.Value, inclusive bool) float64 {
+	hist := col.Histogram
+	last := len(hist) - 1
+	if compareKeys(val, hist[0]) < 0 {
+		return 0
+	}
+	if compareKeys(val, hist[last]) > 0 {
+		return 1
+	}
+
+	fraction := 0.0
+	if last > 0 {
+		// The first bucket whose upper bound is not below val
+		i := sort.Search(last, func(i int) bool {
+			return compareKeys(hist[i+1], val) >= 0
+		})
+		fraction = (float64(i) + interpolate(hist[i], hist[i+1], val)) / float64(last)
+	}
+	if inclusive && col.DistinctCount > 0 {
+		fraction += 1 / float64(col.DistinctCount)
+	}
+	return math.Min(1, fraction)
+}
+
+// interpolate estimates how far into the bucket from low to high a value lies
+func interpolate(low, high, val parser.Value) float64 {
+	if compareKeys(val, low) == 0 {
+		return 0
+	}
+	if compareKeys(val, high) == 0 {
+		return 1
+	}
+
+	lowNum, lowOK := numericValue(low)
+	highNum, highOK := numericValue(high)
+	num, ok := numericValue(val)
+	if !lowOK || !highOK || !ok || highNum <= lowNum {
+		return 0.5
+	}
+	return (num - lowNum) / (highNum - lowNum)
+}
+
+// numericValue returns an INT, FLOAT, DECIMAL or temporal value as a float64
+func numericValue(val parser.Value) (float64, bool) {
+	switch val.Type() {
+	case types.TypeInt:
+		i, _ := val.AsInt()
+		return float64(i), true
+	case types.TypeFloat, types.TypeDecimal, types.TypeDate, types.TypeTime, types.TypeTimestamp, types.TypeTimestampTZ:
+		f, _ := val.AsFloat()
+		return f, true
+	}
+	return 0, false
+}
+
+// estimateSelectivity guesses the fraction of rows a condition keeps
+func estimateSelectivity(scope *queryScope, expr parser.Expression) float64 {
+	switch e := expr.(type) {
+	case parser.LiteralExpression:
+		if isAlwaysTrue(e) {
+			return 1
+		}
+		return 0
+	case parser.UnaryExpression:
+		if e.Operator() == "NOT" {
+			return 1 - estimateSelectivity(scope, e.Operand())
+		}
+	case parser.BinaryExpression:
+		switch e.Operator() {
+		case "AND":
+			return estimateSelectivity(scope, e.Left()) * estimateSelectivity(scope, e.Right())
+		case "OR":
+			left, right := estimateSelectivity(scope, e.Left()), estimateSelectivity(scope, e.Right())
+			return left + right - left*right
+		case "=", "!=", "<", "<=", ">", ">=":
+			return comparisonSelectivity(scope, e)
+		}
+	case parser.InListExpression, parser.BetweenExpression, parser.LikeExpression:
+		return predicateSelectivity(scope, e)
+	}
+	return defaultSelectivity
+}
+
+// predicateSelectivity estimates the fraction of rows an IN list, BETWEEN or LIKE keeps
+func predicateSelectivity(scope *queryScope, expr parser.Expression) float64 {
+	if scope != nil {
+		for _, table := range scope.tables {
+			stats := statisticsOf(table.schema)
+			if colName, values, ok := columnInList(table.schema, table.alias, expr); ok {
+				selectivity := 0.0
+				for _, val := range values {
+					selectivity += stats.equalSelectivity(colName, val)
+				}
+				return math.Min(1, selectivity)
+			}
+			if preds := rangePredicates(table.schema, table.alias, expr); len(preds) > 0 {
+				b := &columnBounds{}
+				for _, pred := range preds {
+					b.add(pred.op, pred.val)
+				}
+				return stats.rangeSelectivity(preds[0].colName, b.low, b.lowInclusive, b.high, b.highInclusive)
+			}
+		}
+	}
+
+	switch e := expr.(type) {
+	case parser.InListExpression:
+		return math.Min(1, equalitySelectivity*float64(len(e.List())))
+	case parser.BetweenExpression:
+		return rangeBoundSelectivity * rangeBoundSelectivity
+	}
+	return defaultSelectivity
+}
+
+// comparisonSelectivity estimates the fraction of rows a comparison keeps
+func comparisonSelectivity(scope *queryScope, cmp parser.BinaryExpression) float64 {
+	if scope != nil {
+		for _, table := range scope.tables {
+			colName, op, val, ok := columnComparison(table.schema, table.alias, cmp)
+			if !ok {
+				continue
+			}
+
+			stats := statisticsOf(table.schema)
+			switch op {
+			case "=":
+				return stats.equalSelectivity(colName, val)
+			case "!=":
+				return math.Max(0, 1-stats.equalSelectivity(colName, val)-stats.nullFraction(colName))
+			case "<", "<=":
+				return stats.rangeSelectivity(colName, nil, false, val, op == "<=")
+			default:
+				return stats.rangeSelectivity(colName, val, op == ">=", nil, false)
+			}
+		}
+
+		if cmp.Operator() == "=" {
+			if selectivity, ok := scope.columnEqualitySelectivity(cmp); ok {
+				return selectivity
+			}
+		}
+	}
+
+	switch cmp.Operator() {
+	case "=":
+		return equalitySelectivity
+	case "!=":
+		return 1 - equalitySelectivity
+	}
+	return rangeBoundSelectivity
+}
+
+// columnEqualitySelectivity estimates the fraction of row pairs for which two columns are equal
+func (s *queryScope) columnEqualitySelectivity(cmp parser.BinaryExpression) (float64, bool) {
+	var distinct, nonNull []float64
+	for _, operand := range []parser.Expression{cmp.Left(), cmp.Right()} {
+		col, ok := operand.(parser.ColumnExpression)
+		if !ok {
+			return 0, false
+		}
+		ref, ok := s.local(col.ColumnName())
+		if !ok {
+			return 0, false
+		}
+		stats, ok := statisticsOf(s.tables[ref.table].schema).column(ref.column)
+		if !ok {
+			return 0, false
+		}
+		distinct = append(distinct, float64(stats.DistinctCount))
+		nonNull = append(nonNull, 1-stats.NullFraction)
+	}
+
+	most := math.Max(distinct[0], distinct[1])
+	if most == 0 {
+		return 0, true
+	}
+	return nonNull[0] * nonNull[1] / most, true
+}
+
+// estimateGroups estimates the number of groups GROUP BY forms out of rows input rows
+func estimateGroups(scope *queryScope, groupBy []parser.Expression, rows float64) float64 {
+	groups := 1.0
+	for _, expr := range groupBy {
+		col, ok := expr.(parser.ColumnExpression)
+		if !ok {
+			return estimateRows(rows, defaultGroupFraction)
+		}
+		ref, ok := scope.local(col.ColumnName())
+		if !ok {
+			return estimateRows(rows, defaultGroupFraction)
+		}
+		stats, ok := statisticsOf(scope.tables[ref.table].schema).column(ref.column)
+		if !ok {
+			return estimateRows(rows, defaultGroupFraction)
+		}
+
+		values := float64(stats.DistinctCount)
+		if stats.NullFraction > 0 {
+			values++
+		}
+		groups *= values
+	}
+	return math.Max(1, math.Min(rows, groups))
+}
+
+// estimateDistinct estimates how many rows are left after DISTINCT
+func estimateDistinct(scope *queryScope, grouped bool, exprs []parser.Expression, rows float64) float64 {
+	if grouped {
+		return rows
+	}
+	return estimateGroups(scope, exprs, rows)
+}
+
+// estimateRows turns a fraction of a table into a row count of at least one
+func estimateRows(tableRows, selectivity float64) float64 {
+	return math.Max(1, math.Round(tableRows*selectivity))
+}
+
+// isAlwaysTrue reports whether a condition is missing or the constant TRUE
+func isAlwaysTrue(expr parser.Expression) bool {
+	if expr == nil {
+		return true
+	}
+	lit, ok := expr.(parser.LiteralExpression)
+	if !ok || lit.Value() == nil || lit.Value().Type() != types.TypeBool {
+		return false
+	}
+	b, err := lit.Value().AsBool()
+	return err == nil && b
+}
@@ -0,0 +1,410 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+)
+
+// execContext is the parser.EvalContext the operators of a statement evaluate expressions with
+type execContext struct {
+	storage    storage.Storage
+	subqueries map[parser.SelectStatement]*subplan
+
+	// order lists the subqueries in the order they were planned
+	order []*subplan
+
+	// ctes lists the common table expressions of the statement
+	ctes []*cte
+}
+
+func newExecContext(store storage.Storage) *execContext {
+	return &execContext{storage: store, subqueries: make(map[parser.SelectStatement]*subplan)}
+}
+
+// outerRow holds the row of the enclosing query that a subquery runs for
+type outerRow struct {
+	row storage.Row
+}
+
+// subplan is a subquery compiled to run once per row of the enclosing query
+type subplan struct {
+	expr  parser.SubqueryExpression
+	plan  *plan
+	outer *outerRow
+
+	// outerTables lists the tables of the enclosing query the subquery refers to
+	outerTables map[int]bool
+	correlated  bool
+
+	runs   int
+	result [][]parser.Value
+}
+
+// subplan returns the compiled plan of a subquery, or nil when it has not been planned
+func (c *execContext) subplan(query parser.SelectStatement) *subplan {
+	if c == nil {
+		return nil
+	}
+	return c.subqueries[query]
+}
+
+// add registers a compiled subquery
+func (c *execContext) add(sub *subplan) {
+	c.subqueries[sub.expr.Query()] = sub
+	c.order = append(c.order, sub)
+}
+
+// Query runs a subquery for a row of the enclosing query
+func (c *execContext) Query(query parser.SelectStatement, outer map[string]parser.Value) ([][]parser.Value, error) {
+	sub := c.subplan(query)
+	if sub == nil {
+		return nil, fmt.Errorf("subquery has not been planned")
+	}
+	if !sub.correlated && sub.runs > 0 {
+		return sub.result, nil
+	}
+
+	sub.outer.row = outer
+	rows, err := drain(sub.plan.root)
+	sub.outer.row = nil
+	sub.runs++
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([][]parser.Value, len(rows))
+	for i, row := range rows {
+		result[i] = make([]parser.Value, len(sub.plan.columns))
+		for j, colName := range sub.plan.columns {
+			result[i][j] = row[colName]
+		}
+	}
+	sub.result = result
+	return result, nil
+}
+
+// NextValue advances a sequence and returns its new value
+func (c *execContext) NextValue(sequence string) (int64, error) {
+	return c.storage.NextValue(sequence)
+}
+
+// subplanner returns a planner for the subqueries of a query with the given scope
+func (p *planner) subplanner(scope *queryScope) *planner {
+	return &planner{
+		catalog: p.catalog,
+		storage: p.storage,
+		analyze: p.analyze,
+		ctx:     p.ctx,
+		parent:  scope,
+		outer:   &outerRow{},
+		ctes:    p.ctes,
+	}
+}
+
+// planSubquery compiles the subquery of an expression of the query with the given scope
+func (p *planner) planSubquery(scope *queryScope, expr parser.SubqueryExpression) (*subplan, error) {
+	sub := p.subplanner(scope)
+	compiled, err := sub.planSelect(expr.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	if expr.Kind() == parser.SubqueryExists {
+		rows := math.Min(1, compiled.root.EstimatedRows())
+		compiled.root = sub.node(&limitOperator{estimate: estimate{rows: rows}, child: compiled.root, limit: 1})
+	} else if len(compiled.columns) != 1 {
+		return nil, fmt.Errorf("subquery must return only one column")
+	}
+
+	return &subplan{
+		expr:        expr,
+		plan:        compiled,
+		outer:       sub.outer,
+		outerTables: compiled.scope.outerTables,
+		correlated:  compiled.scope.correlated,
+	}, nil
+}
+
+// prepareSubqueries compiles the subqueries of an expression that have not been planned yet
+func (p *planner) prepareSubqueries(scope *queryScope, expr parser.Expression) error {
+	var err error
+	walkExpression(expr, func(e parser.Expression) bool {
+		subquery, ok := e.(parser.SubqueryExpression)
+		if ok && p.ctx.subplan(subquery.Query()) == nil {
+			var sub *subplan
+			if sub, err = p.planSubquery(scope, subquery); err == nil {
+				p.ctx.add(sub)
+			}
+		}
+		return err == nil
+	})
+	return err
+}
+
+// containsSubquery reports whether an expression holds a subquery
+func containsSubquery(expr parser.Expression) bool {
+	found := false
+	walkExpression(expr, func(e parser.Expression) bool {
+		_, found = e.(parser.SubqueryExpression)
+		return !found
+	})
+	return found
+}
+
+// semiJoin is a WHERE term that the planner runs as a semi join or an anti join
+type semiJoin struct {
+	anti  bool
+	input Operator
+	keys  []joinKey
+}
+
+// decorrelate takes the IN and EXISTS subqueries that can run as semi joins out of a WHERE clause
+func (p *planner) decorrelate(scope *queryScope, where parser.Expression) (parser.Expression, []semiJoin, error) {
+	if isAlwaysTrue(where) {
+		return where, nil, nil
+	}
+
+	var rest []parser.Expression
+	var semiJoins []semiJoin
+	for _, term := range splitConjuncts(where) {
+		semi, ok, err := p.semiJoinFor(scope, term)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			semiJoins = append(semiJoins, semi)
+		} else {
+			rest = append(rest, term)
+		}
+	}
+	return conjunction(rest), semiJoins, nil
+}
+
+// semiJoinFor turns a WHERE term into a semi join if it can
+func (p *planner) semiJoinFor(scope *queryScope, term parser.Expression) (semiJoin, bool, error) {
+	var semi semiJoin
+	expr := term
+	if not, ok := term.(parser.UnaryExpression); ok && not.Operator() == "NOT" {
+		expr, semi.anti = not.Operand(), true
+	}
+	subquery, ok := expr.(parser.SubqueryExpression)
+	if !ok || subquery.Kind() == parser.SubqueryScalar {
+		return semi, false, nil
+	}
+
+	sub, err := p.planSubquery(scope, subquery)
+	if err != nil {
+		return semi, false, err
+	}
+
+	switch {
+	case subquery.Kind() == parser.SubqueryIn && !semi.anti && !sub.correlated &&
+		expressionCollation(scope, subquery.Operand()) == subqueryCollation(sub):
+		// NOT IN is left to run per row, since a NULL among the subquery
+		// rows makes it NULL where an anti join would keep the row
+		if err := p.prepareSubqueries(scope, subquery.Operand()); err != nil {
+			return semi, false, err
+		}
+		semi.input = sub.plan.root
+		semi.keys = []joinKey{{left: subquery.Operand(), right: &columnReference{name: sub.plan.columns[0]}}}
+		return semi, true, nil
+
+	case subquery.Kind() == parser.SubqueryExists && sub.correlated:
+		if semi.input, semi.keys, ok = p.decorrelateExists(scope, sub); ok {
+			return semi, true, nil
+		}
+	}
+
+	p.ctx.add(sub)
+	return semi, false, nil
+}
+
+// subqueryCollation works out the collation of the column an IN subquery returns
+func subqueryCollation(sub *subplan) parser.Collation {
+	query := sub.expr.Query()
+	if _, compound := query.(parser.CompoundSelectStatement); compound || sub.plan.scope == nil {
+		return parser.CollateBinary
+	}
+	items := selectItems(query)
+	if len(items) == 0 || items[0].Star {
+		return parser.CollateBinary
+	}
+	return expressionCollation(sub.plan.scope, items[0].Expr)
+}
+
+// decorrelateExists splits the WHERE clause of a correlated EXISTS into join keys and filters
+func (p *planner) decorrelateExists(scope *queryScope, sub *subplan) (Operator, []joinKey, bool) {
+	query := sub.expr.Query()
+	inner := sub.plan.scope
+	if _, compound := query.(parser.CompoundSelectStatement); compound {
+		return nil, nil, false
+	}
+	if _, hasLimit := query.Limit(); hasLimit || query.Offset() > 0 || len(query.GroupBy()) > 0 || query.Having() != nil {
+		return nil, nil, false
+	}
+
+	// The select list does not matter to EXISTS unless it aggregates
+	for _, item := range selectItems(query) {
+		if _, _, ok := inner.columnScopes(item.Expr); !ok {
+			return nil, nil, false
+		}
+	}
+	for _, table := range inner.tables[1:] {
+		if _, outer, ok := inner.columnScopes(table.condition); !ok || outer {
+			return nil, nil, false
+		}
+	}
+
+	var terms []parser.Expression
+	var keys []joinKey
+	if !isAlwaysTrue(query.WhereClause()) {
+		for _, term := range splitConjuncts(query.WhereClause()) {
+			_, outer, ok := inner.columnScopes(term)
+			if !ok {
+				return nil, nil, false
+			}
+			if !outer {
+				terms = append(terms, term)
+				continue
+			}
+
+			bin, isBinary := term.(parser.BinaryExpression)
+			if !isBinary || bin.Operator() != "=" {
+				return nil, nil, false
+			}
+			if expressionCollation(inner, bin.Left()) != expressionCollation(inner, bin.Right()) {
+				return nil, nil, false
+			}
+			leftLocal, leftOuter, _ := inner.columnScopes(bin.Left())
+			rightLocal, rightOuter, _ := inner.columnScopes(bin.Right())
+			switch {
+			case leftLocal && !leftOuter && rightOuter && !rightLocal:
+				keys = append(keys, joinKey{left: bin.Right(), right: bin.Left()})
+			case rightLocal && !rightOuter && leftOuter && !leftLocal:
+				keys = append(keys, joinKey{left: bin.Left(), right: bin.Right()})
+			default:
+				return nil, nil, false
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil, false
+	}
+
+	input, _ := p.subplanner(scope).planFrom(inner, conjunction(terms))
+	return input, keys, true
+}
+
+// columnScopes reports whether an expression reads the query's own columns and the outer query's
+func (s *queryScope) columnScopes(expr parser.Expression) (bool, bool, bool) {
+	local, outer, ok := false, false, true
+	walkExpression(expr, func(e parser.Expression) bool {
+		switch e := e.(type) {
+		case parser.ColumnExpression:
+			ref, err := s.resolve(e.ColumnName())
+			switch {
+			case err != nil || ref.depth > 1:
+				ok = false
+			case ref.depth == 1:
+				outer = true
+			default:
+				local = true
+			}
+		case parser.SubqueryExpression:
+			ok = false
+		default:
+			if isAggregate(e) {
+				ok = false
+			}
+		}
+		return ok
+	})
+	return local, outer, ok
+}
+
+// semiJoinOperator passes on the rows of its child that have a match in the subquery, or none
+type semiJoinOperator struct {
+	estimate
+	ctx       parser.EvalContext
+	child     Operator
+	subquery  Operator
+	leftKeys  []parser.Expression
+	rightKeys []parser.Expression
+	anti      bool
+	keys      map[string]bool
+}
+
+func newSemiJoinOperator(ctx parser.EvalContext, child Operator, semi semiJoin, rows float64) *semiJoinOperator {
+	op := &semiJoinOperator{
+		estimate: estimate{rows: rows},
+		ctx:      ctx,
+		child:    child,
+		subquery: semi.input,
+		anti:     semi.anti,
+	}
+	for _, key := range semi.keys {
+		op.leftKeys = append(op.leftKeys, key.left)
+		op.rightKeys = append(op.rightKeys, key.right)
+	}
+	return op
+}
+
+func (o *semiJoinOperator) Open() error {
+	rows, err := drain(o.subquery)
+	if err != nil {
+		return err
+	}
+
+	o.keys = make(map[string]bool)
+	for _, row := range rows {
+		key, ok, err := hashJoinKey(o.ctx, o.rightKeys, row)
+		if err != nil {
+			return err
+		}
+		if ok {
+			o.keys[key] = true
+		}
+	}
+	return o.child.Open()
+}
+
+func (o *semiJoinOperator) Next() (storage.Row, error) {
+	for {
+		row, err := o.child.Next()
+		if row == nil || err != nil {
+			return nil, err
+		}
+
+		key, ok, err := hashJoinKey(o.ctx, o.leftKeys, row)
+		if err != nil {
+			return nil, err
+		}
+		if matched := ok && o.keys[key]; matched != o.anti {
+			return row, nil
+		}
+	}
+}
+
+func (o *semiJoinOperator) Close() error {
+	o.keys = nil
+	return o.child.Close()
+}
+
+func (o *semiJoinOperator) Children() []Operator {
+	return []Operator{o.child, o.subquery}
+}
+
+func (o *semiJoinOperator) Describe() (string, string) {
+	conditions := make([]string, len(o.leftKeys))
+	for i := range o.leftKeys {
+		conditions[i] = fmt.Sprintf("%v = %v", o.leftKeys[i], o.rightKeys[i])
+	}
+	if o.anti {
+		return "HashAntiJoin", "on " + strings.Join(conditions, " AND ")
+	}
+	return "HashSemiJoin", "on " + strings.Join(conditions, " AND ")
+}
@@ -0,0 +1,231 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// tableFunctionRows is the number of rows the planner expects a table function call to give
+const tableFunctionRows = 10
+
+// tableFunctionSchema describes the columns of a table function like those of a table
+func tableFunctionSchema(name string, fn *parser.TableFunction) *derivedSchema {
+	schema := &derivedSchema{name: name, rows: tableFunctionRows}
+	for i, colName := range fn.Columns {
+		schema.columns = append(schema.columns, &derivedColumn{name: colName, dataType: fn.ColumnTypes[i]})
+	}
+	return schema
+}
+
+// checkTableFunction validates the table function call at position i of the FROM clause, if any
+func (s *queryScope) checkTableFunction(i int) error {
+	table := s.tables[i]
+	if table.function == nil {
+		return nil
+	}
+	for _, arg := range table.args {
+		if err := s.check(arg, "FROM", false); err != nil {
+			return err
+		}
+		for t := range s.tablesOf(arg) {
+			if t >= i {
+				return fmt.Errorf("the arguments of table function %s can only read the tables before it", table.name)
+			}
+		}
+	}
+	_, err := table.function.Resolve(expressionTypes(s, table.args))
+	return err
+}
+
+// planTableFunction joins the table function at position i of the FROM clause to the tables before it
+func (p *planner) planTableFunction(scope *queryScope, i int, left joinInput, unfiltered float64) (joinInput, float64) {
+	table := scope.tables[i]
+	op := &tableFunctionOperator{
+		ctx:      p.ctx,
+		name:     table.name,
+		function: table.function,
+		args:     table.args,
+		alias:    table.alias,
+		joinType: table.joinType,
+		match:    acceptAll,
+		outer:    p.outer,
+	}
+	rows := float64(tableFunctionRows)
+	if i == 0 {
+		op.estimate = estimate{rows: rows}
+		return joinInput{op: p.node(op), rows: rows, tables: map[int]bool{i: true}}, rows
+	}
+
+	op.child = left.op
+	rows *= left.rows
+	unfiltered *= tableFunctionRows
+	if table.condition != nil {
+		selectivity := estimateSelectivity(scope, table.condition)
+		rows = estimateRows(rows, selectivity)
+		unfiltered = estimateRows(unfiltered, selectivity)
+		op.condition = table.condition
+		op.match = createFilterFunc(p.ctx, table.condition)
+	}
+	if table.joinType == types.JoinLeft {
+		rows = math.Max(rows, left.rows)
+		op.nullRow = make(storage.Row)
+		for _, colName := range table.function.Columns {
+			op.nullRow[colName] = parser.NewNullValue()
+			op.nullRow[table.alias+"."+colName] = parser.NewNullValue()
+		}
+	}
+	op.estimate = estimate{rows: rows}
+
+	tables := map[int]bool{i: true}
+	for t := range left.tables {
+		tables[t] = true
+	}
+	return joinInput{op: p.node(op), rows: rows, tables: tables}, unfiltered
+}
+
+// tableFunctionOperator calls a table function for each row of its child and joins the results
+type tableFunctionOperator struct {
+	estimate
+	ctx       parser.EvalContext
+	child     Operator
+	name      string
+	function  *parser.TableFunction
+	args      []parser.Expression
+	alias     string
+	joinType  types.JoinType
+	condition parser.Expression
+	match     storage.FilterFunc
+	nullRow   storage.Row
+	outer     *outerRow
+
+	// input is the row the function was last called for, and rows the rows of that call
+	input   storage.Row
+	rows    []storage.Row
+	pos     int
+	matched bool
+	called  bool
+}
+
+func (o *tableFunctionOperator) Open() error {
+	o.input, o.rows, o.pos, o.called = nil, nil, 0, false
+	if o.child != nil {
+		return o.child.Open()
+	}
+	return nil
+}
+
+func (o *tableFunctionOperator) Next() (storage.Row, error) {
+	for {
+		for o.pos < len(o.rows) {
+			row := o.rows[o.pos]
+			o.pos++
+			ok, err := o.match(row)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				o.matched = true
+				return row, nil
+			}
+		}
+
+		if input := o.input; input != nil {
+			o.input = nil
+			if o.joinType == types.JoinLeft && !o.matched {
+				return mergeRows(input, o.nullRow), nil
+			}
+		}
+
+		input, err := o.nextInput()
+		if input == nil || err != nil {
+			return nil, err
+		}
+		if o.rows, err = o.call(input); err != nil {
+			return nil, err
+		}
+		o.input, o.pos, o.matched = input, 0, false
+	}
+}
+
+// nextInput returns the next row to call the function for
+func (o *tableFunctionOperator) nextInput() (storage.Row, error) {
+	if o.child != nil {
+		return o.child.Next()
+	}
+	if o.called {
+		return nil, nil
+	}
+	o.called = true
+	input := make(storage.Row)
+	if o.outer != nil {
+		for colName, val := range o.outer.row {
+			input[colName] = val
+		}
+	}
+	return input, nil
+}
+
+// call calls the function for an input row and joins the rows it gives to it
+func (o *tableFunctionOperator) call(input storage.Row) ([]storage.Row, error) {
+	args := make([]parser.Value, len(o.args))
+	for i, arg := range o.args {
+		val, err := arg.Eval(o.ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+	results, err := o.function.Call(args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]storage.Row, len(results))
+	for i, values := range results {
+		row := make(storage.Row, len(input)+2*len(values))
+		for colName, val := range input {
+			row[colName] = val
+		}
+		for j, colName := range o.function.Columns {
+			row[colName] = values[j]
+			row[o.alias+"."+colName] = values[j]
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+func (o *tableFunctionOperator) Close() error {
+	o.input, o.rows = nil, nil
+	if o.child != nil {
+		return o.child.Close()
+	}
+	return nil
+}
+
+func (o *tableFunctionOperator) Children() []Operator {
+	if o.child == nil {
+		return nil
+	}
+	return []Operator{o.child}
+}
+
+func (o *tableFunctionOperator) Describe() (string, string) {
+	args := make([]string, len(o.args))
+	for i, arg := range o.args {
+		args[i] = fmt.Sprint(arg)
+	}
+	call := o.name + "(" + strings.Join(args, ", ") + ")"
+	if o.alias != o.name {
+		call += " " + o.alias
+	}
+	if o.child == nil {
+		return "TableFunction", call
+	}
+	return "TableFunction", call + ", " + describeJoin(o.joinType, o.condition)
+}
@@ -0,0 +1,422 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// windowClause is the clause name used to check the parts of a window function
+const windowClause = "a window"
+
+// windowClauses are the clauses that may call window functions
+var windowClauses = map[string]bool{
+	"the select list": true,
+	"ORDER BY":        true,
+	"DISTINCT ON":     true,
+}
+
+// windowFunctions maps the functions that need an OVER clause to their argument counts
+var windowFunctions = map[string][2]int{
+	"ROW_NUMBER":  {0, 0},
+	"RANK":        {0, 0},
+	"DENSE_RANK":  {0, 0},
+	"LAG":         {1, 3},
+	"LEAD":        {1, 3},
+	"FIRST_VALUE": {1, 1},
+}
+
+// checkWindowCall validates the function called by a window expression
+func checkWindowCall(window parser.WindowExpression) error {
+	call := window.Function()
+	arity, ok := windowFunctions[call.Name()]
+	switch {
+	case !ok && !isAggregate(call):
+		return fmt.Errorf("%s is not a window function or an aggregate function", call.Name())
+	case call.Distinct():
+		return fmt.Errorf("DISTINCT is not supported for window functions")
+	case !ok:
+		return checkFunctionCall(call, windowClause, true)
+	case call.Star():
+		return fmt.Errorf("%s(*) is not supported", call.Name())
+	case arity[1] == 0 && len(call.Args()) > 0:
+		return fmt.Errorf("function %s takes no arguments", call.Name())
+	case arity[0] == arity[1] && len(call.Args()) != arity[0]:
+		return fmt.Errorf("function %s takes exactly one argument", call.Name())
+	case len(call.Args()) < arity[0] || len(call.Args()) > arity[1]:
+		return fmt.Errorf("function %s takes %d to %d arguments", call.Name(), arity[0], arity[1])
+	}
+	return nil
+}
+
+// windowType works out the type of the values of a window function
+func windowType(scope *queryScope, window parser.WindowExpression) types.DataType {
+	call := window.Function()
+	switch call.Name() {
+	case "ROW_NUMBER", "RANK", "DENSE_RANK":
+		return types.TypeInt
+	case "LAG", "LEAD", "FIRST_VALUE":
+		return expressionType(scope, call.Args()[0])
+	}
+	return expressionType(scope, call)
+}
+
+// windowSortKeys returns the order a window reads the rows of its input in
+func windowSortKeys(window parser.WindowExpression) []sortKey {
+	var keys []sortKey
+	for _, expr := range window.PartitionBy() {
+		keys = append(keys, sortKey{expr: expr})
+	}
+	for _, item := range window.OrderBy() {
+		keys = append(keys, sortKey{expr: item.Expr, descending: item.Descending})
+	}
+	return keys
+}
+
+// planWindows computes the window functions of a query over the rows root produces
+func (p *planner) planWindows(root Operator, rows float64, windows []parser.WindowExpression) Operator {
+	var specs []string
+	calls := make(map[string][]parser.WindowExpression)
+	for _, window := range windows {
+		keys := windowSortKeys(window)
+		spec := fmt.Sprint(len(window.PartitionBy()), describeSortKeys(keys))
+		if _, ok := calls[spec]; !ok {
+			specs = append(specs, spec)
+		}
+		calls[spec] = append(calls[spec], window)
+	}
+
+	sorted := ""
+	for _, spec := range specs {
+		window := calls[spec][0]
+		keys := windowSortKeys(window)
+		if len(keys) > 0 && spec != sorted {
+			root = p.node(&sortOperator{estimate: estimate{rows: rows}, ctx: p.ctx, child: root, keys: keys})
+			sorted = spec
+		}
+
+		orderBy := keys[len(window.PartitionBy()):]
+		root = p.node(&windowOperator{
+			estimate:    estimate{rows: rows},
+			ctx:         p.ctx,
+			child:       root,
+			partitionBy: window.PartitionBy(),
+			orderBy:     orderBy,
+			calls:       calls[spec],
+		})
+	}
+	return root
+}
+
+// windowOperator computes window functions over rows sorted by partition and window order
+type windowOperator struct {
+	estimate
+	ctx         parser.EvalContext
+	child       Operator
+	partitionBy []parser.Expression
+	orderBy     []sortKey
+	calls       []parser.WindowExpression
+
+	// next is the first row of the next partition, read ahead
+	next    storage.Row
+	nextKey string
+	rows    []storage.Row
+	pos     int
+}
+
+func (o *windowOperator) Open() error {
+	o.next, o.rows, o.pos = nil, nil, 0
+	if err := o.child.Open(); err != nil {
+		return err
+	}
+	return o.readAhead()
+}
+
+// readAhead reads the next row of the child and its partition key
+func (o *windowOperator) readAhead() error {
+	row, err := o.child.Next()
+	if row == nil || err != nil {
+		o.next = nil
+		return err
+	}
+
+	values := make([]parser.Value, len(o.partitionBy))
+	for i, expr := range o.partitionBy {
+		if values[i], err = expr.Eval(o.ctx, row); err != nil {
+			return err
+		}
+	}
+	o.next, o.nextKey = row, parser.HashKey(values)
+	return nil
+}
+
+func (o *windowOperator) Next() (storage.Row, error) {
+	if o.pos >= len(o.rows) {
+		if err := o.loadPartition(); err != nil {
+			return nil, err
+		}
+		if len(o.rows) == 0 {
+			return nil, nil
+		}
+	}
+	o.pos++
+	return o.rows[o.pos-1], nil
+}
+
+// loadPartition reads the rows of the next partition and computes the window functions for them
+func (o *windowOperator) loadPartition() error {
+	o.rows, o.pos = nil, 0
+	if o.next == nil {
+		return nil
+	}
+
+	key := o.nextKey
+	for o.next != nil && o.nextKey == key {
+		row := make(storage.Row, len(o.next)+len(o.calls))
+		for colName, val := range o.next {
+			row[colName] = val
+		}
+		o.rows = append(o.rows, row)
+		if err := o.readAhead(); err != nil {
+			return err
+		}
+	}
+	return o.compute()
+}
+
+// compute adds the results of the calls to the rows of a partition
+func (o *windowOperator) compute() error {
+	// The peers of a row are the rows with the same ORDER BY values, which
+	// are next to it; without ORDER BY all rows are peers
+	n := len(o.rows)
+	peerStart, peerEnd := make([]int, n), make([]int, n)
+	var previous []parser.Value
+	for i, row := range o.rows {
+		values := make([]parser.Value, len(o.orderBy))
+		for j, key := range o.orderBy {
+			val, err := key.expr.Eval(o.ctx, row)
+			if err != nil {
+				return err
+			}
+			values[j] = val
+		}
+
+		peerStart[i] = i
+		if i > 0 && equalSortValues(previous, values) {
+			peerStart[i] = peerStart[i-1]
+		}
+		previous = values
+	}
+	for i := n - 1; i >= 0; i-- {
+		peerEnd[i] = i
+		if i < n-1 && peerStart[i+1] == peerStart[i] {
+			peerEnd[i] = peerEnd[i+1]
+		}
+	}
+
+	for _, window := range o.calls {
+		results, err := o.evaluate(window, peerStart, peerEnd)
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprint(window)
+		for i, row := range o.rows {
+			row[name] = results[i]
+		}
+	}
+	return nil
+}
+
+// evaluate computes a window function for each row of the partition
+func (o *windowOperator) evaluate(window parser.WindowExpression, peerStart, peerEnd []int) ([]parser.Value, error) {
+	call := window.Function()
+	results := make([]parser.Value, len(o.rows))
+
+	switch call.Name() {
+	case "ROW_NUMBER":
+		for i := range o.rows {
+			results[i] = parser.NewIntValue(int64(i + 1))
+		}
+
+	case "RANK":
+		for i := range o.rows {
+			results[i] = parser.NewIntValue(int64(peerStart[i] + 1))
+		}
+
+	case "DENSE_RANK":
+		rank := int64(0)
+		for i := range o.rows {
+			if peerStart[i] == i {
+				rank++
+			}
+			results[i] = parser.NewIntValue(rank)
+		}
+
+	case "LAG", "LEAD":
+		for i, row := range o.rows {
+			val, err := o.shift(call, i, row)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = val
+		}
+
+	case "FIRST_VALUE":
+		for i := range o.rows {
+			lo, hi := frameRows(window.Frame(), i, len(o.rows), peerStart, peerEnd)
+			results[i] = parser.NewNullValue()
+			if lo <= hi {
+				val, err := call.Args()[0].Eval(o.ctx, o.rows[lo])
+				if err != nil {
+					return nil, err
+				}
+				results[i] = val
+			}
+		}
+
+	default:
+		return o.aggregate(window, peerStart, peerEnd)
+	}
+	return results, nil
+}
+
+// shift computes LAG or LEAD for a row
+func (o *windowOperator) shift(call parser.FunctionExpression, i int, row storage.Row) (parser.Value, error) {
+	offset := int64(1)
+	if len(call.Args()) > 1 {
+		val, err := call.Args()[1].Eval(o.ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil || val.Type() != types.TypeInt {
+			return nil, fmt.Errorf("%s offset must be an integer, not %v", call.Name(), val)
+		}
+		offset, _ = val.AsInt()
+	}
+	if call.Name() == "LAG" {
+		offset = -offset
+	}
+
+	if j := int64(i) + offset; j >= 0 && j < int64(len(o.rows)) {
+		return call.Args()[0].Eval(o.ctx, o.rows[j])
+	}
+	if len(call.Args()) > 2 {
+		return call.Args()[2].Eval(o.ctx, row)
+	}
+	return parser.NewNullValue(), nil
+}
+
+// aggregate computes an aggregate function over the frame of each row
+func (o *windowOperator) aggregate(window parser.WindowExpression, peerStart, peerEnd []int) ([]parser.Value, error) {
+	call := window.Function()
+	inputs := make([]parser.Value, len(o.rows))
+	for i, row := range o.rows {
+		val, err := aggregateInput(o.ctx, call, row)
+		if err != nil {
+			return nil, err
+		}
+		inputs[i] = val
+	}
+
+	frame := window.Frame()
+	cumulative := frame == nil || frame.Start.Type == parser.FrameUnboundedPreceding
+	results := make([]parser.Value, len(o.rows))
+	agg := newAggregator(call)
+	added := -1
+	for i := range o.rows {
+		lo, hi := frameRows(frame, i, len(o.rows), peerStart, peerEnd)
+		if !cumulative {
+			agg, added = newAggregator(call), lo-1
+		}
+		for ; added < hi; added++ {
+			if val := inputs[added+1]; val != nil {
+				if err := agg.Step(val); err != nil {
+					return nil, fmt.Errorf("%v: %v", call, err)
+				}
+			}
+		}
+		results[i] = agg.Result()
+	}
+	return results, nil
+}
+
+// frameRows returns the first and last row of the frame of row i, empty when lo > hi
+func frameRows(frame *parser.WindowFrame, i, n int, peerStart, peerEnd []int) (lo, hi int) {
+	if frame == nil {
+		frame = &parser.WindowFrame{
+			Start: parser.FrameBound{Type: parser.FrameUnboundedPreceding},
+			End:   parser.FrameBound{Type: parser.FrameCurrentRow},
+		}
+	}
+
+	position := func(bound parser.FrameBound, current int) int {
+		// Offsets beyond the partition all mean the same
+		offset := int(min(bound.Offset, int64(n)))
+		switch bound.Type {
+		case parser.FrameUnboundedPreceding:
+			return 0
+		case parser.FramePreceding:
+			return i - offset
+		case parser.FrameFollowing:
+			return i + offset
+		case parser.FrameUnboundedFollowing:
+			return n - 1
+		}
+		return current
+	}
+	start, end := peerStart[i], peerEnd[i]
+	if frame.Rows {
+		start, end = i, i
+	}
+	return max(position(frame.Start, start), 0), min(position(frame.End, end), n-1)
+}
+
+// equalSortValues reports whether two rows sort equal by their keys
+func equalSortValues(a, b []parser.Value) bool {
+	for i := range a {
+		if compareSortValues(a[i], b[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *windowOperator) Close() error {
+	o.next, o.rows = nil, nil
+	return o.child.Close()
+}
+
+func (o *windowOperator) Children() []Operator {
+	return []Operator{o.child}
+}
+
+func (o *windowOperator) Describe() (string, string) {
+	calls := make([]string, len(o.calls))
+	for i, call := range o.calls {
+		calls[i] = fmt.Sprint(call.Function())
+	}
+	detail := strings.Join(calls, ", ")
+	if len(o.partitionBy) > 0 || len(o.orderBy) > 0 {
+		detail += " over (" + describeWindow(o.partitionBy, o.orderBy) + ")"
+	}
+	return "Window", detail
+}
+
+// describeWindow describes the PARTITION BY and ORDER BY of a window
+func describeWindow(partitionBy []parser.Expression, orderBy []sortKey) string {
+	var parts []string
+	if len(partitionBy) > 0 {
+		exprs := make([]string, len(partitionBy))
+		for i, expr := range partitionBy {
+			exprs[i] = fmt.Sprint(expr)
+		}
+		parts = append(parts, "partition by "+strings.Join(exprs, ", "))
+	}
+	if len(orderBy) > 0 {
+		parts = append(parts, "order by "+describeSortKeys(orderBy))
+	}
+	return strings.Join(parts, " ")
+}
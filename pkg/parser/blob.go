@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// BlobValue is a BLOB, a string of bytes that need not be text
+type BlobValue struct {
+	value []byte
+}
+
+// NewBlobValue creates a BLOB value holding data, which the caller must not change
+func NewBlobValue(data []byte) Value {
+	return &BlobValue{value: data}
+}
+
+func (v *BlobValue) Type() types.DataType {
+	return types.TypeBlob
+}
+
+func (v *BlobValue) AsInt() (int64, error) {
+	return 0, fmt.Errorf("cannot convert BLOB to int")
+}
+
+// AsString returns the bytes written in hex after \x
+func (v *BlobValue) AsString() (string, error) {
+	return `\x` + hex.EncodeToString(v.value), nil
+}
+
+func (v *BlobValue) AsBool() (bool, error) {
+	return false, fmt.Errorf("cannot convert BLOB to bool")
+}
+
+func (v *BlobValue) AsFloat() (float64, error) {
+	return 0, fmt.Errorf("cannot convert BLOB to float")
+}
+
+func (v *BlobValue) AsDecimal() (Decimal, error) {
+	return Decimal{}, fmt.Errorf("cannot convert BLOB to decimal")
+}
+
+// AsBytes returns the bytes of the BLOB, which the caller must not change
+func (v *BlobValue) AsBytes() ([]byte, error) {
+	return v.value, nil
+}
+
+func (v *BlobValue) AsNull() (bool, error) {
+	return false, nil
+}
+
+// String returns the BLOB as a literal, such as X'DEADBEEF'
+func (v *BlobValue) String() string {
+	return "X'" + strings.ToUpper(hex.EncodeToString(v.value)) + "'"
+}
+
+// parseBlobLiteral decodes the hex digits of a literal such as X'DEADBEEF'
+func parseBlobLiteral(digits string) (Value, error) {
+	data, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BLOB literal X'%s'", digits)
+	}
+	return &BlobValue{value: data}, nil
+}
+
+// parseBlobText converts text to a BLOB, reading hex after \x
+func parseBlobText(s string) (Value, error) {
+	if digits, ok := strings.CutPrefix(s, `\x`); ok {
+		data, err := hex.DecodeString(digits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BLOB value: '%s'", s)
+		}
+		return &BlobValue{value: data}, nil
+	}
+	return &BlobValue{value: []byte(s)}, nil
+}
+
+// bytesOf returns the bytes of a BLOB
+func bytesOf(val Value) []byte {
+	b, _ := val.AsBytes()
+	return b
+}
@@ -0,0 +1,280 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// Shorthands for the signatures of the built-in functions
+const (
+	tInt         = types.TypeInt
+	tFloat       = types.TypeFloat
+	tDecimal     = types.TypeDecimal
+	tText        = types.TypeString
+	tDate        = types.TypeDate
+	tTime        = types.TypeTime
+	tTimestamp   = types.TypeTimestamp
+	tTimestampTZ = types.TypeTimestampTZ
+	tInterval    = types.TypeInterval
+	tBlob        = types.TypeBlob
+	tBool        = types.TypeBool
+	tJSON        = types.TypeJSON
+)
+
+func sig(returns types.DataType, args ...types.DataType) Signature {
+	return Signature{Args: args, Returns: returns}
+}
+
+// builtinFunctions are the scalar functions every registry starts with
+var builtinFunctions = []*ScalarFunction{
+	{Name: "UPPER", Signatures: []Signature{sig(tText, tText)}, Eval: textFunction(strings.ToUpper)},
+	{Name: "LOWER", Signatures: []Signature{sig(tText, tText)}, Eval: textFunction(strings.ToLower)},
+	{Name: "LENGTH", Signatures: []Signature{sig(tInt, tText), sig(tInt, tBlob)}, Eval: evalLength},
+	{Name: "SUBSTR", Signatures: []Signature{
+		sig(tText, tText, tInt), sig(tText, tText, tInt, tInt),
+		sig(tBlob, tBlob, tInt), sig(tBlob, tBlob, tInt, tInt),
+	}, Eval: evalSubstr},
+	{Name: "TRIM", Signatures: []Signature{sig(tText, tText), sig(tText, tText, tText)}, Eval: evalTrim},
+	{Name: "REPLACE", Signatures: []Signature{sig(tText, tText, tText, tText)}, Eval: evalReplace},
+	{Name: "INSTR", Signatures: []Signature{sig(tInt, tText, tText)}, Eval: evalInstr},
+
+	{Name: "ABS", Signatures: []Signature{sig(tInt, tInt), sig(tDecimal, tDecimal), sig(tFloat, tFloat)}, Eval: evalAbs},
+	{Name: "ROUND", Signatures: []Signature{
+		sig(tInt, tInt), sig(tDecimal, tDecimal), sig(tFloat, tFloat),
+		sig(tInt, tInt, tInt), sig(tDecimal, tDecimal, tInt), sig(tFloat, tFloat, tInt),
+		sig(tDecimal, tDecimal, tInt, tText), sig(tFloat, tFloat, tInt, tText),
+	}, Eval: evalRound},
+	{Name: "FLOOR", Signatures: []Signature{sig(tInt, tInt), sig(tDecimal, tDecimal), sig(tFloat, tFloat)}, Eval: roundingFunction(math.Floor, RoundFloor)},
+	{Name: "CEIL", Signatures: []Signature{sig(tInt, tInt), sig(tDecimal, tDecimal), sig(tFloat, tFloat)}, Eval: roundingFunction(math.Ceil, RoundCeiling)},
+	{Name: "POWER", Signatures: []Signature{sig(tFloat, tFloat, tFloat)}, Eval: evalPower},
+	{Name: "SQRT", Signatures: []Signature{sig(tFloat, tFloat)}, Eval: evalSqrt},
+	{Name: "MOD", Signatures: []Signature{sig(tInt, tInt, tInt), sig(tDecimal, tDecimal, tDecimal), sig(tFloat, tFloat, tFloat)}, Eval: evalMod},
+
+	{Name: "NOW", Signatures: []Signature{sig(tTimestampTZ)}, Volatile: true, Eval: evalNow},
+	{Name: "DATE_TRUNC", Signatures: []Signature{sig(tTimestamp, tText, tTimestamp), sig(tTimestampTZ, tText, tTimestampTZ), sig(tTimestamp, tText, tDate)}, Eval: evalDateTrunc},
+	{Name: "EXTRACT", Signatures: extractSignatures, Eval: evalExtract},
+	{Name: "DATE_PART", Signatures: extractSignatures, Eval: evalExtract},
+	{Name: "STRFTIME", Signatures: []Signature{sig(tText, tText, tTimestamp), sig(tText, tText, tTimestampTZ), sig(tText, tText, tDate), sig(tText, tText, tTime)}, Eval: evalStrftime},
+	{Name: "TIMEZONE", Signatures: []Signature{sig(tTimestamp, tText, tTimestampTZ), sig(tTimestampTZ, tText, tTimestamp)}, Eval: evalTimezone},
+
+	{Name: "JSON_EXTRACT", Signatures: []Signature{sig(tJSON, tJSON, tText)}, Eval: evalJSONExtract},
+	{Name: "JSON_SET", Signatures: jsonSetSignatures, Eval: evalJSONSet},
+	{Name: "JSON_ARRAY_LENGTH", Signatures: []Signature{sig(tInt, tJSON), sig(tInt, tJSON, tText)}, Eval: evalJSONArrayLength},
+}
+
+func textOf(val Value) string {
+	s, _ := val.AsString()
+	return s
+}
+
+func intOf(val Value) int64 {
+	i, _ := val.AsInt()
+	return i
+}
+
+func textValue(s string) Value {
+	return &literalValue{dataType: types.TypeString, stringVal: s}
+}
+
+func intValue(i int64) Value {
+	return &literalValue{dataType: types.TypeInt, intVal: i}
+}
+
+func floatValue(f float64) Value {
+	return &literalValue{dataType: types.TypeFloat, floatVal: f}
+}
+
+// textFunction makes a function of one TEXT argument from a Go function
+func textFunction(fn func(string) string) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		return textValue(fn(textOf(args[0]))), nil
+	}
+}
+
+// roundingFunction makes a function that rounds a number to a whole number
+func roundingFunction(fn func(float64) float64, mode RoundingMode) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		switch args[0].Type() {
+		case types.TypeInt:
+			return args[0], nil
+		case types.TypeDecimal:
+			return NewDecimalValue(decimalOf(args[0]).Round(0, mode)), nil
+		}
+		return floatValue(fn(floatOf(args[0]))), nil
+	}
+}
+
+// evalLength counts the characters of a string or the bytes of a BLOB
+func evalLength(args []Value) (Value, error) {
+	if args[0].Type() == types.TypeBlob {
+		return intValue(int64(len(bytesOf(args[0])))), nil
+	}
+	return intValue(int64(utf8.RuneCountInString(textOf(args[0])))), nil
+}
+
+// evalSubstr returns part of a string, or of the bytes of a BLOB
+func evalSubstr(args []Value) (Value, error) {
+	if args[0].Type() == types.TypeBlob {
+		data := bytesOf(args[0])
+		from, to, err := substrBounds(int64(len(data)), args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return &BlobValue{value: data[from:to]}, nil
+	}
+	chars := []rune(textOf(args[0]))
+	from, to, err := substrBounds(int64(len(chars)), args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return textValue(string(chars[from:to])), nil
+}
+
+// substrBounds turns the arguments of SUBSTR into the bounds of a slice of n elements
+func substrBounds(n int64, args []Value) (int64, int64, error) {
+	start := intOf(args[0])
+	end := n + 1
+	if len(args) > 1 {
+		length := intOf(args[1])
+		if length < 0 {
+			return 0, 0, fmt.Errorf("negative substring length not allowed")
+		}
+		end = min(end, start+length)
+	}
+	start = max(start, 1)
+	if start >= end {
+		return 0, 0, nil
+	}
+	return start - 1, end - 1, nil
+}
+
+// evalTrim removes spaces, or the given characters, from both ends of a string
+func evalTrim(args []Value) (Value, error) {
+	cutset := " "
+	if len(args) > 1 {
+		cutset = textOf(args[1])
+	}
+	return textValue(strings.Trim(textOf(args[0]), cutset)), nil
+}
+
+func evalReplace(args []Value) (Value, error) {
+	s, from := textOf(args[0]), textOf(args[1])
+	if from == "" {
+		return args[0], nil
+	}
+	return textValue(strings.ReplaceAll(s, from, textOf(args[2]))), nil
+}
+
+// evalInstr returns the position of a string in another, or 0 when it is not there
+func evalInstr(args []Value) (Value, error) {
+	s := textOf(args[0])
+	i := strings.Index(s, textOf(args[1]))
+	if i < 0 {
+		return intValue(0), nil
+	}
+	return intValue(int64(utf8.RuneCountInString(s[:i])) + 1), nil
+}
+
+func evalAbs(args []Value) (Value, error) {
+	if args[0].Type() == types.TypeInt {
+		i := intOf(args[0])
+		if i == math.MinInt64 {
+			return nil, fmt.Errorf("INT value %d is out of range for ABS", i)
+		}
+		if i < 0 {
+			i = -i
+		}
+		return intValue(i), nil
+	}
+	if args[0].Type() == types.TypeDecimal {
+		return NewDecimalValue(decimalOf(args[0]).Abs()), nil
+	}
+	return floatValue(math.Abs(floatOf(args[0]))), nil
+}
+
+// evalRound rounds to a number of decimal places, with an optional rounding mode for DECIMALs
+func evalRound(args []Value) (Value, error) {
+	places := int64(0)
+	if len(args) > 1 {
+		places = intOf(args[1])
+	}
+
+	if args[0].Type() == types.TypeDecimal || len(args) > 2 {
+		mode := RoundHalfUp
+		if len(args) > 2 {
+			name := strings.ToLower(strings.TrimSpace(textOf(args[2])))
+			var ok bool
+			if mode, ok = roundingModes[name]; !ok {
+				return nil, fmt.Errorf("ROUND does not know the rounding mode '%s'", name)
+			}
+		}
+		if places > maxDecimalPrecision || places < -maxDecimalPrecision {
+			return nil, fmt.Errorf("ROUND cannot round to %d decimal places", places)
+		}
+		d, err := args[0].AsDecimal()
+		if err != nil {
+			return nil, err
+		}
+		rounded := d.Round(int(places), mode)
+		if args[0].Type() == types.TypeFloat {
+			return floatValue(rounded.Float64()), nil
+		}
+		return NewDecimalValue(rounded), nil
+	}
+
+	if args[0].Type() == types.TypeInt {
+		if places >= 0 {
+			return args[0], nil
+		}
+		if places < -18 {
+			return intValue(0), nil
+		}
+		scale := int64(math.Pow10(int(-places)))
+		i := intOf(args[0])
+		rounded := (i / scale) * scale
+		if rem := i % scale; rem*2 >= scale {
+			rounded += scale
+		} else if rem*2 <= -scale {
+			rounded -= scale
+		}
+		return intValue(rounded), nil
+	}
+
+	f := floatOf(args[0])
+	if places > 308 || places < -308 {
+		if places > 0 {
+			return args[0], nil
+		}
+		return floatValue(0), nil
+	}
+	scale := math.Pow10(int(places))
+	return floatValue(math.Round(f*scale) / scale), nil
+}
+
+func evalPower(args []Value) (Value, error) {
+	base, exponent := floatOf(args[0]), floatOf(args[1])
+	if base == 0 && exponent < 0 {
+		return nil, fmt.Errorf("zero raised to a negative power is undefined")
+	}
+	if base < 0 && exponent != math.Trunc(exponent) {
+		return nil, fmt.Errorf("a negative number raised to a fractional power is not a real number")
+	}
+	return floatValue(math.Pow(base, exponent)), nil
+}
+
+func evalSqrt(args []Value) (Value, error) {
+	f := floatOf(args[0])
+	if f < 0 {
+		return nil, fmt.Errorf("cannot take the square root of a negative number")
+	}
+	return floatValue(math.Sqrt(f)), nil
+}
+
+// evalMod returns the remainder of a division, with the sign of the dividend
+func evalMod(args []Value) (Value, error) {
+	return evalArithmetic("%", args[0], args[1])
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// CanCast reports whether values of one type can be converted to another with CAST
+func CanCast(from, to types.DataType) bool {
+	switch {
+	case from == types.TypeNull || from == to:
+		return true
+	case to == types.TypeNull:
+		return false
+	case holdsTime(from) || holdsTime(to):
+		return from == types.TypeString || to == types.TypeString || temporalCasts[[2]types.DataType{from, to}]
+	case from == types.TypeBlob || to == types.TypeBlob, from == types.TypeJSON || to == types.TypeJSON:
+		return from == types.TypeString || to == types.TypeString
+	case (from == types.TypeFloat || from == types.TypeDecimal) && to == types.TypeBool:
+		return false
+	case from == types.TypeBool && (to == types.TypeFloat || to == types.TypeDecimal):
+		return false
+	}
+	return true
+}
+
+// Cast converts a value to a type by the rules of CAST
+func Cast(val Value, to types.DataType) (Value, error) {
+	if isNull(val) {
+		return &literalValue{dataType: types.TypeNull}, nil
+	}
+	from := val.Type()
+	if !CanCast(from, to) {
+		return nil, fmt.Errorf("cannot cast %v to %v", from, to)
+	}
+	if from == to {
+		return val, nil
+	}
+	if holdsTime(from) {
+		return castTemporal(val, to)
+	}
+
+	switch from {
+	case types.TypeInt:
+		i, _ := val.AsInt()
+		switch to {
+		case types.TypeFloat:
+			return &literalValue{dataType: types.TypeFloat, floatVal: float64(i)}, nil
+		case types.TypeDecimal:
+			return NewDecimalValue(NewDecimal(i, 0)), nil
+		case types.TypeString:
+			return &literalValue{dataType: types.TypeString, stringVal: strconv.FormatInt(i, 10)}, nil
+		case types.TypeBool:
+			return newBoolValue(i != 0), nil
+		}
+
+	case types.TypeFloat:
+		f, _ := val.AsFloat()
+		switch to {
+		case types.TypeInt:
+			rounded := math.Round(f)
+			if math.IsNaN(f) || rounded < math.MinInt64 || rounded >= math.MaxInt64 {
+				return nil, fmt.Errorf("FLOAT value %v is out of range for INT", f)
+			}
+			return &literalValue{dataType: types.TypeInt, intVal: int64(rounded)}, nil
+		case types.TypeDecimal:
+			// A literal converts with the digits it is written with
+			d, err := val.AsDecimal()
+			if err != nil {
+				return nil, err
+			}
+			return NewDecimalValue(d), nil
+		case types.TypeString:
+			return &literalValue{dataType: types.TypeString, stringVal: strconv.FormatFloat(f, 'g', -1, 64)}, nil
+		}
+
+	case types.TypeDecimal:
+		d := decimalOf(val)
+		switch to {
+		case types.TypeInt:
+			i, ok := d.Round(0, RoundHalfUp).Int64()
+			if !ok {
+				return nil, fmt.Errorf("DECIMAL value %v is out of range for INT", d)
+			}
+			return &literalValue{dataType: types.TypeInt, intVal: i}, nil
+		case types.TypeFloat:
+			return &literalValue{dataType: types.TypeFloat, floatVal: d.Float64()}, nil
+		case types.TypeString:
+			return &literalValue{dataType: types.TypeString, stringVal: d.String()}, nil
+		}
+
+	case types.TypeBool:
+		b, _ := val.AsBool()
+		switch to {
+		case types.TypeInt:
+			if b {
+				return &literalValue{dataType: types.TypeInt, intVal: 1}, nil
+			}
+			return &literalValue{dataType: types.TypeInt, intVal: 0}, nil
+		case types.TypeString:
+			return &literalValue{dataType: types.TypeString, stringVal: strconv.FormatBool(b)}, nil
+		}
+
+	case types.TypeBlob, types.TypeJSON:
+		s, _ := val.AsString()
+		return &literalValue{dataType: types.TypeString, stringVal: s}, nil
+
+	case types.TypeString:
+		s, _ := val.AsString()
+		return castText(s, to)
+	}
+	return nil, fmt.Errorf("cannot cast %v to %v", from, to)
+}
+
+// castText parses text as a value of a type
+func castText(s string, to types.DataType) (Value, error) {
+	text := strings.TrimSpace(s)
+	if holdsTime(to) {
+		return parseTemporal(s, to)
+	}
+	switch to {
+	case types.TypeInt:
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return &literalValue{dataType: types.TypeInt, intVal: i}, nil
+		}
+	case types.TypeFloat:
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return &literalValue{dataType: types.TypeFloat, floatVal: f}, nil
+		}
+	case types.TypeDecimal:
+		d, err := ParseDecimal(s)
+		if err != nil {
+			return nil, err
+		}
+		return NewDecimalValue(d), nil
+	case types.TypeBlob:
+		return parseBlobText(s)
+	case types.TypeJSON:
+		return ParseJSON(s)
+	case types.TypeBool:
+		switch strings.ToLower(text) {
+		case "true", "t", "yes", "on", "1":
+			return newBoolValue(true), nil
+		case "false", "f", "no", "off", "0":
+			return newBoolValue(false), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %v value: '%s'", to, s)
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// Collation is a way of comparing text
+type Collation int
+
+const (
+	// CollateBinary compares text byte by byte; it is the default
+	CollateBinary Collation = iota
+
+	// CollateNoCase ignores the case of the ASCII letters A to Z
+	CollateNoCase
+
+	// CollateUnicode ignores the case of letters in any script, by Unicode
+	// case mapping
+	CollateUnicode
+)
+
+// LookupCollation finds a collation by its name, in any case
+func LookupCollation(name string) (Collation, bool) {
+	switch strings.ToUpper(name) {
+	case "BINARY":
+		return CollateBinary, true
+	case "NOCASE":
+		return CollateNoCase, true
+	case "UNICODE":
+		return CollateUnicode, true
+	}
+	return CollateBinary, false
+}
+
+func (c Collation) String() string {
+	switch c {
+	case CollateNoCase:
+		return "NOCASE"
+	case CollateUnicode:
+		return "UNICODE"
+	}
+	return "BINARY"
+}
+
+// Key returns the text that compares byte by byte the way s compares under the collation
+func (c Collation) Key(s string) string {
+	switch c {
+	case CollateNoCase:
+		return strings.Map(func(r rune) rune {
+			if 'A' <= r && r <= 'Z' {
+				return r + 'a' - 'A'
+			}
+			return r
+		}, s)
+	case CollateUnicode:
+		return strings.Map(func(r rune) rune {
+			if r < utf8.RuneSelf {
+				return unicode.ToLower(r)
+			}
+			// Going through upper case maps the variants of a letter, such
+			// as the two lower case forms of sigma, to one
+			return unicode.ToLower(unicode.ToUpper(r))
+		}, s)
+	}
+	return s
+}
+
+// collatedValue is text that compares under a collation
+type collatedValue struct {
+	Value
+	collation Collation
+	explicit  bool
+}
+
+func (v *collatedValue) String() string {
+	return fmt.Sprint(v.Value)
+}
+
+// Collate returns text that compares under the collation of its column
+func Collate(val Value, c Collation) Value {
+	if val == nil || val.Type() != types.TypeString {
+		return val
+	}
+	if cv, ok := val.(*collatedValue); ok {
+		val = cv.Value
+	}
+	if c == CollateBinary {
+		return val
+	}
+	return &collatedValue{Value: val, collation: c}
+}
+
+// CollationOf returns the collation a value compares under
+func CollationOf(val Value) Collation {
+	if cv, ok := val.(*collatedValue); ok {
+		return cv.collation
+	}
+	return CollateBinary
+}
+
+// comparisonCollation works out the collation two strings compare under
+func comparisonCollation(left, right Value) Collation {
+	l, leftOK := left.(*collatedValue)
+	r, rightOK := right.(*collatedValue)
+	switch {
+	case leftOK && l.explicit:
+		return l.collation
+	case rightOK && r.explicit:
+		return r.collation
+	case leftOK:
+		return l.collation
+	case rightOK:
+		return r.collation
+	}
+	return CollateBinary
+}
+
+// collateExpression is operand COLLATE name
+type collateExpression struct {
+	operand   Expression
+	collation Collation
+}
+
+func (e *collateExpression) Operand() Expression {
+	return e.operand
+}
+
+func (e *collateExpression) Collation() Collation {
+	return e.collation
+}
+
+func (e *collateExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	val, err := e.operand.Eval(ctx, row)
+	if err != nil || isNull(val) {
+		return val, err
+	}
+	if val.Type() != types.TypeString {
+		return nil, fmt.Errorf("COLLATE %v applies to TEXT, not %v", e.collation, val.Type())
+	}
+	if cv, ok := val.(*collatedValue); ok {
+		val = cv.Value
+	}
+	return &collatedValue{Value: val, collation: e.collation, explicit: true}, nil
+}
+
+func (e *collateExpression) String() string {
+	return fmt.Sprintf("%v COLLATE %v", e.operand, e.collation)
+}
@@ -0,0 +1,280 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// The date and time functions among the built-in functions. A TIMESTAMPTZ
+// is taken in UTC, unless TIMEZONE converts it to the time in a zone first.
+
+// extractSignatures are the signatures of EXTRACT and DATE_PART
+var extractSignatures = []Signature{
+	sig(tFloat, tText, tTimestamp), sig(tFloat, tText, tTimestampTZ), sig(tFloat, tText, tDate),
+	sig(tFloat, tText, tTime), sig(tFloat, tText, tInterval),
+}
+
+// fieldName normalizes the name of a field of a date or time
+func fieldName(val Value) string {
+	return strings.ToLower(strings.TrimSpace(textOf(val)))
+}
+
+// evalNow gives the current time
+func evalNow(args []Value) (Value, error) {
+	return NewTemporalValue(types.TypeTimestampTZ, time.Now().UnixMicro()), nil
+}
+
+// evalDateTrunc truncates a timestamp to the start of a unit of time
+func evalDateTrunc(args []Value) (Value, error) {
+	field, val := fieldName(args[0]), args[1]
+	resultType := types.TypeTimestamp
+	if val.Type() == types.TypeTimestampTZ {
+		resultType = types.TypeTimestampTZ
+	}
+
+	t := time.UnixMicro(timestampMicros(val)).UTC()
+	year, month, day := t.Date()
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	switch field {
+	case "microseconds", "microsecond":
+	case "milliseconds", "millisecond":
+		t = t.Truncate(time.Millisecond)
+	case "second":
+		t = t.Truncate(time.Second)
+	case "minute":
+		t = t.Truncate(time.Minute)
+	case "hour":
+		t = t.Truncate(time.Hour)
+	case "day":
+		t = date(year, month, day)
+	case "week":
+		t = date(year, month, day-(int(t.Weekday())+6)%7)
+	case "month":
+		t = date(year, month, 1)
+	case "quarter":
+		t = date(year, month-(month-1)%3, 1)
+	case "year":
+		t = date(year, 1, 1)
+	case "decade":
+		t = date(year-int(floorMod(int64(year), 10)), 1, 1)
+	case "century":
+		t = date(int(floorDiv(int64(year)-1, 100))*100+1, 1, 1)
+	case "millennium":
+		t = date(int(floorDiv(int64(year)-1, 1000))*1000+1, 1, 1)
+	default:
+		return nil, fmt.Errorf("DATE_TRUNC does not know the field '%s'", field)
+	}
+	return NewTemporalValue(resultType, t.UnixMicro()), nil
+}
+
+// evalExtract takes a field out of a date, time or interval, as a FLOAT
+func evalExtract(args []Value) (Value, error) {
+	field, val := fieldName(args[0]), args[1]
+	if val.Type() == types.TypeInterval {
+		return extractInterval(field, intervalOf(val))
+	}
+
+	var micros int64
+	if val.Type() == types.TypeTime {
+		micros = intOf(val)
+	} else {
+		micros = timestampMicros(val)
+	}
+	t := time.UnixMicro(micros).UTC()
+	seconds := float64(t.Second()) + float64(t.Nanosecond())/1e9
+
+	switch field {
+	case "microseconds":
+		return floatValue(seconds * 1e6), nil
+	case "milliseconds":
+		return floatValue(seconds * 1e3), nil
+	case "second":
+		return floatValue(seconds), nil
+	case "minute":
+		return floatValue(float64(t.Minute())), nil
+	case "hour":
+		return floatValue(float64(t.Hour())), nil
+	case "epoch":
+		return floatValue(float64(micros) / 1e6), nil
+	}
+	if val.Type() == types.TypeTime {
+		return nil, fmt.Errorf("cannot extract '%s' from a TIME", field)
+	}
+
+	year := int64(t.Year())
+	isoYear, isoWeek := t.ISOWeek()
+	var result int64
+	switch field {
+	case "day":
+		result = int64(t.Day())
+	case "month":
+		result = int64(t.Month())
+	case "quarter":
+		result = int64(t.Month()-1)/3 + 1
+	case "year":
+		result = year
+	case "decade":
+		result = floorDiv(year, 10)
+	case "century":
+		result = floorDiv(year-1, 100) + 1
+	case "millennium":
+		result = floorDiv(year-1, 1000) + 1
+	case "dow":
+		result = int64(t.Weekday())
+	case "isodow":
+		result = int64(t.Weekday()+6)%7 + 1
+	case "doy":
+		result = int64(t.YearDay())
+	case "week":
+		result = int64(isoWeek)
+	case "isoyear":
+		result = int64(isoYear)
+	default:
+		return nil, fmt.Errorf("cannot extract '%s' from a %v", field, val.Type())
+	}
+	return floatValue(float64(result)), nil
+}
+
+// extractInterval takes a field out of an interval
+func extractInterval(field string, iv Interval) (Value, error) {
+	clock := iv.Micros % (60 * 60 * microsPerSecond)
+	var result float64
+	switch field {
+	case "microseconds":
+		result = float64(clock % (60 * microsPerSecond))
+	case "milliseconds":
+		result = float64(clock%(60*microsPerSecond)) / 1e3
+	case "second":
+		result = float64(clock%(60*microsPerSecond)) / 1e6
+	case "minute":
+		result = float64(clock / (60 * microsPerSecond))
+	case "hour":
+		result = float64(iv.Micros / (60 * 60 * microsPerSecond))
+	case "day":
+		result = float64(iv.Days)
+	case "month":
+		result = float64(iv.Months % 12)
+	case "quarter":
+		result = float64(iv.Months%12/3 + 1)
+	case "year":
+		result = float64(iv.Months / 12)
+	case "decade":
+		result = float64(iv.Months / 120)
+	case "century":
+		result = float64(iv.Months / 1200)
+	case "millennium":
+		result = float64(iv.Months / 12000)
+	case "epoch":
+		// A year counts as 365.25 days and a month as 30
+		days := float64(iv.Months/12)*365.25 + float64(iv.Months%12*daysPerMonth+iv.Days)
+		result = days*86400 + float64(iv.Micros)/1e6
+	default:
+		return nil, fmt.Errorf("cannot extract '%s' from an INTERVAL", field)
+	}
+	return floatValue(result), nil
+}
+
+// evalStrftime formats a date or time by the directives of SQLite's strftime
+func evalStrftime(args []Value) (Value, error) {
+	format, val := textOf(args[0]), args[1]
+	var micros int64
+	if val.Type() == types.TypeTime {
+		micros = intOf(val)
+	} else {
+		micros = timestampMicros(val)
+	}
+	t := time.UnixMicro(micros).UTC()
+	hour12 := (t.Hour()+11)%12 + 1
+	isoYear, isoWeek := t.ISOWeek()
+
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			sb.WriteByte(format[i])
+			continue
+		}
+		if i++; i == len(format) {
+			return nil, fmt.Errorf("STRFTIME format '%s' ends in %%", format)
+		}
+		switch format[i] {
+		case 'd':
+			fmt.Fprintf(&sb, "%02d", t.Day())
+		case 'e':
+			fmt.Fprintf(&sb, "%2d", t.Day())
+		case 'f':
+			fmt.Fprintf(&sb, "%02d.%03d", t.Second(), t.Nanosecond()/int(time.Millisecond))
+		case 'F':
+			sb.WriteString(t.Format("2006-01-02"))
+		case 'H':
+			fmt.Fprintf(&sb, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&sb, "%02d", hour12)
+		case 'j':
+			fmt.Fprintf(&sb, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&sb, "%2d", t.Hour())
+		case 'l':
+			fmt.Fprintf(&sb, "%2d", hour12)
+		case 'm':
+			fmt.Fprintf(&sb, "%02d", int(t.Month()))
+		case 'M':
+			fmt.Fprintf(&sb, "%02d", t.Minute())
+		case 'p':
+			sb.WriteString(t.Format("PM"))
+		case 'P':
+			sb.WriteString(strings.ToLower(t.Format("PM")))
+		case 'R':
+			sb.WriteString(t.Format("15:04"))
+		case 's':
+			fmt.Fprintf(&sb, "%d", floorDiv(micros, microsPerSecond))
+		case 'S':
+			fmt.Fprintf(&sb, "%02d", t.Second())
+		case 'T':
+			sb.WriteString(t.Format("15:04:05"))
+		case 'u':
+			fmt.Fprintf(&sb, "%d", (int(t.Weekday())+6)%7+1)
+		case 'w':
+			fmt.Fprintf(&sb, "%d", int(t.Weekday()))
+		case 'W':
+			// Weeks start on Monday, and the days before the first one are
+			// in week 0
+			fmt.Fprintf(&sb, "%02d", (t.YearDay()-1+7-(int(t.Weekday())+6)%7)/7)
+		case 'V':
+			fmt.Fprintf(&sb, "%02d", isoWeek)
+		case 'G':
+			fmt.Fprintf(&sb, "%04d", isoYear)
+		case 'g':
+			fmt.Fprintf(&sb, "%02d", isoYear%100)
+		case 'Y':
+			fmt.Fprintf(&sb, "%04d", t.Year())
+		case '%':
+			sb.WriteByte('%')
+		default:
+			return nil, fmt.Errorf("STRFTIME format '%s' has unknown directive %%%c", format, format[i])
+		}
+	}
+	return textValue(sb.String()), nil
+}
+
+// evalTimezone converts between a TIMESTAMPTZ and the local TIMESTAMP in a zone
+func evalTimezone(args []Value) (Value, error) {
+	zone, err := loadZone(textOf(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	micros := intOf(args[1])
+	if args[1].Type() == types.TypeTimestampTZ {
+		_, offset := time.UnixMicro(micros).In(zone).Zone()
+		return NewTemporalValue(types.TypeTimestamp, micros+int64(offset)*microsPerSecond), nil
+	}
+
+	wall := time.UnixMicro(micros).UTC()
+	year, month, day := wall.Date()
+	local := time.Date(year, month, day, wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), zone)
+	return NewTemporalValue(types.TypeTimestampTZ, local.UnixMicro()), nil
+}
@@ -0,0 +1,421 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// Limits of the precision and exponent of DECIMAL numbers
+const (
+	maxDecimalPrecision = 1000
+	maxDecimalExponent  = 1000
+
+	// minQuotientDigits is the least number of significant digits of a DECIMAL quotient
+	minQuotientDigits = 16
+)
+
+// Decimal is an exact decimal number that keeps its scale
+type Decimal struct {
+	unscaled *big.Int
+	scale    int
+}
+
+// NewDecimal makes the decimal number unscaled × 10^-scale
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return newDecimal(big.NewInt(unscaled), scale)
+}
+
+// newDecimal makes a decimal number from a whole number of units, which it takes over
+func newDecimal(unscaled *big.Int, scale int) Decimal {
+	if scale < 0 {
+		unscaled.Mul(unscaled, pow10(-scale))
+		scale = 0
+	}
+	return Decimal{unscaled: unscaled, scale: scale}
+}
+
+// decimalPattern matches a number written in decimal, with an optional exponent
+var decimalPattern = regexp.MustCompile(`^([+-]?)([0-9]*)(?:\.([0-9]*))?(?:[eE]([+-]?[0-9]+))?$`)
+
+// ParseDecimal reads a number written in decimal, such as 19.99, -0.5 or 1.5e3
+func ParseDecimal(s string) (Decimal, error) {
+	m := decimalPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || m[2]+m[3] == "" {
+		return Decimal{}, fmt.Errorf("invalid DECIMAL value: '%s'", s)
+	}
+	exponent := 0
+	if m[4] != "" {
+		e, err := strconv.Atoi(m[4])
+		if err != nil || e < -maxDecimalExponent || e > maxDecimalExponent {
+			return Decimal{}, fmt.Errorf("DECIMAL value '%s' is out of range", s)
+		}
+		exponent = e
+	}
+
+	unscaled, _ := new(big.Int).SetString(m[2]+m[3], 10)
+	if m[1] == "-" {
+		unscaled.Neg(unscaled)
+	}
+	return newDecimal(unscaled, len(m[3])-exponent), nil
+}
+
+// decimalFromFloat converts a FLOAT to the shortest decimal number that reads back as it
+func decimalFromFloat(f float64) (Decimal, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}, fmt.Errorf("FLOAT value %v cannot be converted to DECIMAL", f)
+	}
+	return ParseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// coefficient returns the whole number of units, which must not be changed
+func (d Decimal) coefficient() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// Unscaled returns the whole number of units of 10^-scale the number is
+func (d Decimal) Unscaled() *big.Int {
+	return new(big.Int).Set(d.coefficient())
+}
+
+// Scale returns the number of digits after the decimal point
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// Sign returns -1, 0 or 1 as the number is negative, zero or positive
+func (d Decimal) Sign() int {
+	return d.coefficient().Sign()
+}
+
+// Precision returns the number of significant digits of the unscaled number
+func (d Decimal) Precision() int {
+	return len(new(big.Int).Abs(d.coefficient()).Text(10))
+}
+
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.coefficient()).Text(10)
+	if d.scale > 0 {
+		if len(digits) <= d.scale {
+			digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+	if d.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// rescaled returns the unscaled number for a scale at least as large
+func (d Decimal) rescaled(scale int) *big.Int {
+	if scale == d.scale {
+		return d.coefficient()
+	}
+	return new(big.Int).Mul(d.coefficient(), pow10(scale-d.scale))
+}
+
+// aligned returns the unscaled numbers of two decimals at the larger of their scales
+func aligned(a, b Decimal) (*big.Int, *big.Int, int) {
+	scale := max(a.scale, b.scale)
+	return a.rescaled(scale), b.rescaled(scale), scale
+}
+
+// Cmp compares two numbers, returning -1, 0 or 1
+func (d Decimal) Cmp(e Decimal) int {
+	a, b, _ := aligned(d, e)
+	return a.Cmp(b)
+}
+
+// Add returns d + e, with the larger of their scales
+func (d Decimal) Add(e Decimal) Decimal {
+	a, b, scale := aligned(d, e)
+	return Decimal{unscaled: new(big.Int).Add(a, b), scale: scale}
+}
+
+// Sub returns d - e, with the larger of their scales
+func (d Decimal) Sub(e Decimal) Decimal {
+	a, b, scale := aligned(d, e)
+	return Decimal{unscaled: new(big.Int).Sub(a, b), scale: scale}
+}
+
+// Mul returns d × e, with the sum of their scales
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.coefficient(), e.coefficient()), scale: d.scale + e.scale}
+}
+
+// Neg returns -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(d.coefficient()), scale: d.scale}
+}
+
+// Abs returns the absolute value of d
+func (d Decimal) Abs() Decimal {
+	return Decimal{unscaled: new(big.Int).Abs(d.coefficient()), scale: d.scale}
+}
+
+// Quo returns d / e, rounded to at least 16 significant digits
+func (d Decimal) Quo(e Decimal) (Decimal, error) {
+	if e.Sign() == 0 {
+		return Decimal{}, fmt.Errorf("division by zero")
+	}
+	// The leading digit of the quotient is about as many places from the
+	// decimal point as those of the operands are apart
+	magnitude := (d.Precision() - d.scale) - (e.Precision() - e.scale)
+	scale := max(minQuotientDigits-magnitude, d.scale, e.scale)
+	return d.QuoRound(e, min(scale, maxDecimalPrecision), RoundHalfUp)
+}
+
+// QuoRound returns d / e rounded to a scale with a rounding mode
+func (d Decimal) QuoRound(e Decimal, scale int, mode RoundingMode) (Decimal, error) {
+	if e.Sign() == 0 {
+		return Decimal{}, fmt.Errorf("division by zero")
+	}
+	num, den := d.Unscaled(), e.Unscaled()
+	if shift := scale - d.scale + e.scale; shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+	return Decimal{unscaled: roundQuo(num, den, mode), scale: scale}, nil
+}
+
+// Rem returns the remainder of d / e, with the sign of d
+func (d Decimal) Rem(e Decimal) (Decimal, error) {
+	if e.Sign() == 0 {
+		return Decimal{}, fmt.Errorf("division by zero")
+	}
+	a, b, scale := aligned(d, e)
+	return Decimal{unscaled: new(big.Int).Rem(a, b), scale: scale}, nil
+}
+
+// Round rounds to a number of digits after the decimal point with a rounding mode
+func (d Decimal) Round(scale int, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return Decimal{unscaled: d.rescaled(scale), scale: scale}
+	}
+	rounded := roundQuo(d.coefficient(), pow10(d.scale-scale), mode)
+	return newDecimal(rounded, scale)
+}
+
+// Fit rounds to a scale and checks the result fits DECIMAL(precision, scale)
+func (d Decimal) Fit(precision, scale int, mode RoundingMode) (Decimal, error) {
+	rounded := d.Round(scale, mode)
+	if rounded.Precision() > precision {
+		return Decimal{}, fmt.Errorf("%v does not fit DECIMAL(%d, %d)", d, precision, scale)
+	}
+	return rounded, nil
+}
+
+// Int64 returns the number with any fraction dropped, and whether it fits in an int64
+func (d Decimal) Int64() (int64, bool) {
+	whole := new(big.Int).Quo(d.coefficient(), pow10(d.scale))
+	return whole.Int64(), whole.IsInt64()
+}
+
+// Float64 returns the FLOAT nearest to the number
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+// Rat returns the number as a fraction
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.coefficient(), pow10(d.scale))
+}
+
+// RoundingMode is the way a number is rounded to fewer digits
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds to the nearest number, and halves away from zero
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds to the nearest number, and halves to the one
+	// with an even last digit
+	RoundHalfEven
+	// RoundHalfDown rounds to the nearest number, and halves toward zero
+	RoundHalfDown
+	// RoundUp rounds away from zero
+	RoundUp
+	// RoundDown rounds toward zero, cutting off the digits
+	RoundDown
+	// RoundCeiling rounds toward positive infinity
+	RoundCeiling
+	// RoundFloor rounds toward negative infinity
+	RoundFloor
+)
+
+// roundingModes are the names ROUND takes for the rounding modes
+var roundingModes = map[string]RoundingMode{
+	"half_up": RoundHalfUp, "half_even": RoundHalfEven, "half_down": RoundHalfDown,
+	"up": RoundUp, "down": RoundDown, "ceiling": RoundCeiling, "floor": RoundFloor,
+}
+
+// roundQuo divides two whole numbers, rounding the quotient with a mode
+func roundQuo(num, den *big.Int, mode RoundingMode) *big.Int {
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 {
+		return quo
+	}
+
+	negative := num.Sign() != den.Sign()
+	away := false
+	switch mode {
+	case RoundUp:
+		away = true
+	case RoundCeiling:
+		away = !negative
+	case RoundFloor:
+		away = negative
+	case RoundHalfUp, RoundHalfEven, RoundHalfDown:
+		half := new(big.Int).Abs(rem)
+		switch half.Lsh(half, 1).CmpAbs(den) {
+		case 1:
+			away = true
+		case 0:
+			away = mode == RoundHalfUp || (mode == RoundHalfEven && quo.Bit(0) == 1)
+		}
+	}
+	if !away {
+		return quo
+	}
+	if negative {
+		return quo.Sub(quo, big.NewInt(1))
+	}
+	return quo.Add(quo, big.NewInt(1))
+}
+
+// DecimalValue is a DECIMAL value
+type DecimalValue struct {
+	value Decimal
+}
+
+// NewDecimalValue creates a DECIMAL value
+func NewDecimalValue(value Decimal) Value {
+	return &DecimalValue{value: value}
+}
+
+func (v *DecimalValue) Type() types.DataType {
+	return types.TypeDecimal
+}
+
+func (v *DecimalValue) AsInt() (int64, error) {
+	i, ok := v.value.Int64()
+	if !ok {
+		return 0, fmt.Errorf("DECIMAL value %v is out of range for INT", v.value)
+	}
+	return i, nil
+}
+
+func (v *DecimalValue) AsString() (string, error) {
+	return v.value.String(), nil
+}
+
+func (v *DecimalValue) AsBool() (bool, error) {
+	return v.value.Sign() != 0, nil
+}
+
+func (v *DecimalValue) AsFloat() (float64, error) {
+	return v.value.Float64(), nil
+}
+
+func (v *DecimalValue) AsDecimal() (Decimal, error) {
+	return v.value, nil
+}
+
+func (v *DecimalValue) AsBytes() ([]byte, error) {
+	return nil, fmt.Errorf("cannot convert DECIMAL to BLOB")
+}
+
+func (v *DecimalValue) AsNull() (bool, error) {
+	return false, nil
+}
+
+func (v *DecimalValue) String() string {
+	return fmt.Sprintf("DECIMAL '%v'", v.value)
+}
+
+// decimalOf returns a number as a DECIMAL
+func decimalOf(val Value) Decimal {
+	d, _ := val.AsDecimal()
+	return d
+}
+
+// evalDecimalArithmetic applies an arithmetic operator to numbers where one is a DECIMAL
+func evalDecimalArithmetic(operator string, left, right Value) (Value, error) {
+	l, err := left.AsDecimal()
+	if err != nil {
+		return nil, err
+	}
+	r, err := right.AsDecimal()
+	if err != nil {
+		return nil, err
+	}
+
+	var result Decimal
+	switch operator {
+	case "+":
+		result = l.Add(r)
+	case "-":
+		result = l.Sub(r)
+	case "*":
+		result = l.Mul(r)
+	case "/":
+		result, err = l.Quo(r)
+	case "%":
+		result, err = l.Rem(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewDecimalValue(result), nil
+}
+
+// compareDecimals orders two numbers exactly, at least one of which is a DECIMAL
+func compareDecimals(left, right Value) int {
+	l, errLeft := left.AsDecimal()
+	r, errRight := right.AsDecimal()
+	if errLeft != nil || errRight != nil {
+		return compareFloats(floatOf(left), floatOf(right))
+	}
+	return l.Cmp(r)
+}
+
+// appendDecimalHash appends the HashKey encoding of a DECIMAL, matching equal INTs and FLOATs
+func appendDecimalHash(buf []byte, d Decimal) []byte {
+	if i, ok := d.Int64(); ok && d.Cmp(NewDecimal(i, 0)) == 0 {
+		return strconv.AppendInt(append(buf, 'i'), i, 10)
+	}
+	f := d.Float64()
+	if written, err := decimalFromFloat(f); err == nil && written.Cmp(d) == 0 {
+		return strconv.AppendFloat(append(buf, 'f'), f, 'g', -1, 64)
+	}
+	return append(append(buf, 'd'), d.trimmed().String()...)
+}
+
+// trimmed removes the zeros at the end of the digits after the decimal point
+func (d Decimal) trimmed() Decimal {
+	unscaled, scale := d.Unscaled(), d.scale
+	ten, rem := big.NewInt(10), new(big.Int)
+	for scale > 0 {
+		quo, _ := new(big.Int).QuoRem(unscaled, ten, rem)
+		if rem.Sign() != 0 {
+			break
+		}
+		unscaled, scale = quo, scale-1
+	}
+	return Decimal{unscaled: unscaled, scale: scale}
+}
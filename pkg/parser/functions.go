@@ -0,0 +1,358 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// ScalarFunction is a function that SQL can call by name, computed for each row
+type ScalarFunction struct {
+	Name       string
+	Signatures []Signature
+
+	// Volatile marks a function whose result can differ between calls with the same arguments
+	Volatile bool
+
+	// Eval computes the result from non-NULL arguments converted to the matched signature
+	Eval func(args []Value) (Value, error)
+}
+
+// Signature is one combination of argument types a function takes, and its result type
+type Signature struct {
+	Args    []types.DataType
+	Returns types.DataType
+}
+
+func (s Signature) String() string {
+	args := make([]string, len(s.Args))
+	for i, arg := range s.Args {
+		args[i] = arg.String()
+	}
+	return "(" + strings.Join(args, ", ") + ")"
+}
+
+// accepts reports whether an argument of one type can be passed for a parameter of another
+func accepts(param, arg types.DataType) bool {
+	switch {
+	case arg == types.TypeNull || arg == param:
+		return true
+	case arg == types.TypeInt:
+		return param == types.TypeFloat || param == types.TypeDecimal
+	case arg == types.TypeDecimal:
+		return param == types.TypeFloat
+	case arg == types.TypeString:
+		return param == types.TypeJSON
+	}
+	return false
+}
+
+// Resolve finds the first signature that takes arguments of the given types
+func (f *ScalarFunction) Resolve(args []types.DataType) (Signature, error) {
+	var arities []string
+	wrongArity := 0
+	for _, sig := range f.Signatures {
+		if len(sig.Args) != len(args) {
+			wrongArity++
+			if n := fmt.Sprint(len(sig.Args)); !slices.Contains(arities, n) {
+				arities = append(arities, n)
+			}
+			continue
+		}
+		matches := true
+		for i, param := range sig.Args {
+			matches = matches && accepts(param, args[i])
+		}
+		if matches {
+			return sig, nil
+		}
+	}
+
+	if wrongArity == len(f.Signatures) {
+		return Signature{}, fmt.Errorf("function %s takes %s arguments, got %d", f.Name, strings.Join(arities, " or "), len(args))
+	}
+	sigs := make([]string, len(f.Signatures))
+	for i, sig := range f.Signatures {
+		sigs[i] = sig.String()
+	}
+	return Signature{}, fmt.Errorf("function %s cannot take %v, only %s", f.Name, Signature{Args: args}, strings.Join(sigs, " or "))
+}
+
+// ReturnType gives the result type of a call, or NULL when it is not known yet
+func (f *ScalarFunction) ReturnType(args []types.DataType) types.DataType {
+	sig, err := f.Resolve(args)
+	if err != nil {
+		return types.TypeNull
+	}
+	if !slices.Contains(args, types.TypeNull) {
+		return sig.Returns
+	}
+
+	// Every signature the arguments might turn out to match must agree
+	for _, other := range f.Signatures {
+		if len(other.Args) != len(args) || other.Returns == sig.Returns {
+			continue
+		}
+		matches := true
+		for i, param := range other.Args {
+			matches = matches && accepts(param, args[i])
+		}
+		if matches {
+			return types.TypeNull
+		}
+	}
+	return sig.Returns
+}
+
+// staticTypes gives the types of expressions known from the expressions alone
+func staticTypes(exprs []Expression) []types.DataType {
+	result := make([]types.DataType, len(exprs))
+	for i, expr := range exprs {
+		switch e := expr.(type) {
+		case *literalExpression:
+			result[i] = e.val.Type()
+		case *castExpression:
+			result[i] = e.targetType
+		case *collateExpression:
+			result[i] = types.TypeString
+		case *sequenceExpression:
+			result[i] = types.TypeInt
+		case *functionExpression:
+			if e.scalar != nil {
+				result[i] = e.scalar.ReturnType(staticTypes(e.args))
+			}
+		case *binaryExpression:
+			switch e.operator {
+			case "||", "->>":
+				result[i] = types.TypeString
+			case "->":
+				result[i] = types.TypeJSON
+			}
+		}
+	}
+	return result
+}
+
+// Call applies the function to argument values
+func (f *ScalarFunction) Call(args []Value) (Value, error) {
+	argTypes := make([]types.DataType, len(args))
+	for i, arg := range args {
+		if isNull(arg) {
+			return &literalValue{dataType: types.TypeNull}, nil
+		}
+		argTypes[i] = arg.Type()
+	}
+	sig, err := f.Resolve(argTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	converted := make([]Value, len(args))
+	for i, arg := range args {
+		if converted[i], err = Cast(arg, sig.Args[i]); err != nil {
+			return nil, err
+		}
+	}
+	result, err := f.Eval(converted)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil || (!isNull(result) && result.Type() != sig.Returns) {
+		return nil, fmt.Errorf("function %s returned %v, not %v", f.Name, result, sig.Returns)
+	}
+	return result, nil
+}
+
+// AggregateFunction is a function computed over the non-NULL values of a group, such as SUM(price)
+type AggregateFunction struct {
+	Name       string
+	Signatures []Signature
+	Volatile   bool
+
+	// New creates the state of the function for one group
+	New func() Aggregator
+}
+
+// Aggregator accumulates the values of an aggregate function over the rows of a group
+type Aggregator interface {
+	// Step adds the value of the argument for a row, which is not NULL
+	Step(val Value) error
+	// Result returns the aggregate of the values added so far, of the type
+	// of the signature, or NULL
+	Result() Value
+}
+
+// scalar gives the function as a scalar function for resolving calls
+func (f *AggregateFunction) scalar() *ScalarFunction {
+	return &ScalarFunction{Name: f.Name, Signatures: f.Signatures, Volatile: f.Volatile}
+}
+
+// Resolve finds the first signature that takes an argument of the given type
+func (f *AggregateFunction) Resolve(arg types.DataType) (Signature, error) {
+	return f.scalar().Resolve([]types.DataType{arg})
+}
+
+// ReturnType gives the result type for an argument type, or NULL when it is not known yet
+func (f *AggregateFunction) ReturnType(arg types.DataType) types.DataType {
+	return f.scalar().ReturnType([]types.DataType{arg})
+}
+
+// Start creates the state of the function for one group
+func (f *AggregateFunction) Start() Aggregator {
+	return &convertingAggregator{fn: f, state: f.New()}
+}
+
+type convertingAggregator struct {
+	fn    *AggregateFunction
+	state Aggregator
+}
+
+func (a *convertingAggregator) Step(val Value) error {
+	sig, err := a.fn.Resolve(val.Type())
+	if err != nil {
+		return err
+	}
+	if val, err = Cast(val, sig.Args[0]); err != nil {
+		return err
+	}
+	return a.state.Step(val)
+}
+
+func (a *convertingAggregator) Result() Value {
+	if result := a.state.Result(); result != nil {
+		return result
+	}
+	return &literalValue{dataType: types.TypeNull}
+}
+
+// FunctionRegistry holds the functions statements can call, safe for concurrent use
+type FunctionRegistry struct {
+	mu         sync.RWMutex
+	functions  map[string]*ScalarFunction
+	aggregates map[string]*AggregateFunction
+}
+
+// NewFunctionRegistry creates a registry holding the built-in functions
+func NewFunctionRegistry() *FunctionRegistry {
+	r := &FunctionRegistry{
+		functions:  make(map[string]*ScalarFunction),
+		aggregates: make(map[string]*AggregateFunction),
+	}
+	for _, fn := range builtinFunctions {
+		r.functions[fn.Name] = fn
+	}
+	return r
+}
+
+// Register adds a scalar function to the registry
+func (r *FunctionRegistry) Register(fn *ScalarFunction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name, err := r.checkNew(fn.Name, fn.Signatures, -1)
+	if err != nil {
+		return err
+	}
+	if fn.Eval == nil {
+		return fmt.Errorf("function %s needs an implementation", name)
+	}
+	registered := *fn
+	registered.Name = name
+	r.functions[name] = &registered
+	return nil
+}
+
+// RegisterAggregate adds an aggregate function to the registry
+func (r *FunctionRegistry) RegisterAggregate(fn *AggregateFunction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name, err := r.checkNew(fn.Name, fn.Signatures, 1)
+	if err != nil {
+		return err
+	}
+	if fn.New == nil {
+		return fmt.Errorf("function %s needs an implementation", name)
+	}
+	registered := *fn
+	registered.Name = name
+	r.aggregates[name] = &registered
+	return nil
+}
+
+// checkNew checks a function to be registered and returns its upper-case name; the caller must hold r.mu
+func (r *FunctionRegistry) checkNew(name string, signatures []Signature, args int) (string, error) {
+	name = strings.ToUpper(name)
+	if !isIdentifier(name) || reservedWords[name] {
+		return "", fmt.Errorf("invalid function name %q", name)
+	}
+	_, scalar := r.functions[name]
+	_, aggregate := r.aggregates[name]
+	if scalar || aggregate || executorFunctions[name] || name == sequenceFunction {
+		return "", fmt.Errorf("function %s already exists", name)
+	}
+
+	if len(signatures) == 0 {
+		return "", fmt.Errorf("function %s needs a signature", name)
+	}
+	for _, sig := range signatures {
+		if args >= 0 && len(sig.Args) != args {
+			return "", fmt.Errorf("function %s must take %d arguments, not %v", name, args, sig)
+		}
+		for _, t := range append([]types.DataType{sig.Returns}, sig.Args...) {
+			if !valueTypes[t] {
+				return "", fmt.Errorf("function %s has invalid type %v in signature %v", name, t, sig)
+			}
+		}
+	}
+	return name, nil
+}
+
+// valueTypes are the types that function arguments and results can have
+var valueTypes = map[types.DataType]bool{
+	types.TypeInt: true, types.TypeFloat: true, types.TypeString: true, types.TypeBool: true,
+	types.TypeDate: true, types.TypeTime: true, types.TypeTimestamp: true, types.TypeTimestampTZ: true,
+	types.TypeInterval: true, types.TypeDecimal: true, types.TypeBlob: true, types.TypeJSON: true,
+}
+
+// isIdentifier reports whether a name can be written unquoted in SQL
+func isIdentifier(name string) bool {
+	for i, c := range name {
+		letter := c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// Lookup finds a scalar function by name, ignoring case
+func (r *FunctionRegistry) Lookup(name string) (*ScalarFunction, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fn, ok := r.functions[strings.ToUpper(name)]
+	return fn, ok
+}
+
+// LookupAggregate finds a registered aggregate function by name, ignoring case
+func (r *FunctionRegistry) LookupAggregate(name string) (*AggregateFunction, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fn, ok := r.aggregates[strings.ToUpper(name)]
+	return fn, ok
+}
+
+// sequenceFunction is nextval(), which the parser turns into a sequenceExpression
+const sequenceFunction = "NEXTVAL"
+
+// executorFunctions are the aggregate and window functions the executor computes itself
+var executorFunctions = map[string]bool{
+	"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true,
+	"ROW_NUMBER": true, "RANK": true, "DENSE_RANK": true,
+	"LAG": true, "LEAD": true, "FIRST_VALUE": true,
+}
@@ -19,6 +19,7 @@ type CreateTableStatement interface {
 	Statement
 	TableName() string
 	Columns() []ColumnDefinition
+	Constraints() []TableConstraint
 }
 
 // DropTableStatement represents a DROP TABLE statement
@@ -27,12 +28,38 @@ type DropTableStatement interface {
 	TableName() string
 }
 
+// AlterTableStatement represents an ALTER TABLE statement
+type AlterTableStatement interface {
+	Statement
+	TableName() string
+	Action() types.AlterAction
+	Column() ColumnDefinition
+	Constraints() []TableConstraint
+	ColumnName() string
+	NewName() string
+	ConstraintName() string
+}
+
+// CreateSequenceStatement represents a CREATE SEQUENCE statement
+type CreateSequenceStatement interface {
+	Statement
+	SequenceName() string
+	Start() int64
+	Increment() int64
+}
+
+// DropSequenceStatement represents a DROP SEQUENCE statement
+type DropSequenceStatement interface {
+	Statement
+	SequenceName() string
+}
+
 // InsertStatement represents an INSERT statement
 type InsertStatement interface {
 	Statement
 	TableName() string
 	Columns() []string
-	Values() [][]Value
+	Values() [][]Expression
 }
 
 // UpdateStatement represents an UPDATE statement
@@ -53,21 +80,309 @@ type DeleteStatement interface {
 // SelectStatement represents a SELECT statement
 type SelectStatement interface {
 	Statement
+	With() []CommonTableExpression
+	Distinct() bool
+	DistinctOn() []Expression
 	TableName() string
 	Columns() []string
 	WhereClause() Expression
+	TableAlias() string
+	TableArgs() []Expression
+	Items() []SelectItem
+	Joins() []JoinClause
+	GroupBy() []Expression
+	Having() Expression
+	OrderBy() []OrderByItem
+	Limit() (int64, bool)
+	Offset() int64
+}
+
+// CompoundSelectStatement combines the rows of two queries with UNION, INTERSECT or EXCEPT
+type CompoundSelectStatement interface {
+	SelectStatement
+	Operator() string
+	All() bool
+	Left() SelectStatement
+	Right() SelectStatement
+}
+
+// CommonTableExpression is a named query of a WITH clause
+type CommonTableExpression struct {
+	Name      string
+	Columns   []string
+	Query     SelectStatement
+	Recursive SelectStatement
+	UnionAll  bool
+}
+
+// SelectItem is one entry of a select list: an expression with an optional alias, or *
+type SelectItem struct {
+	Expr  Expression
+	Alias string
+	Star  bool
+	Table string
+}
+
+// JoinClause joins another table or table function to the FROM clause
+type JoinClause struct {
+	Type      types.JoinType
+	Table     string
+	Alias     string
+	Condition Expression
+	Args      []Expression
+}
+
+// OrderByItem is one sort key of an ORDER BY clause
+type OrderByItem struct {
+	Expr       Expression
+	Descending bool
+}
+
+// CreateIndexStatement represents a CREATE [UNIQUE] INDEX statement
+type CreateIndexStatement interface {
+	Statement
+	IndexName() string
+	TableName() string
+	Columns() []string
+	Expressions() []Expression
+	Unique() bool
+}
+
+// DropIndexStatement represents a DROP INDEX statement
+type DropIndexStatement interface {
+	Statement
+	IndexName() string
+}
+
+// ExplainStatement represents an EXPLAIN [ANALYZE] statement
+type ExplainStatement interface {
+	Statement
+	Statement() Statement
+	Analyze() bool
+}
+
+// AnalyzeStatement represents an ANALYZE [table] statement
+type AnalyzeStatement interface {
+	Statement
+	// TableName is empty when every table is to be analyzed
+	TableName() string
 }
 
 // ColumnDefinition represents a column definition in CREATE TABLE
 type ColumnDefinition interface {
 	Name() string
 	Type() types.DataType
+
+	// TypeParams returns the numbers written in parentheses after the type
+	// name, such as the precision and scale of DECIMAL(10, 2) or the
+	// length of VARCHAR(255), or nil
+	TypeParams() []int
+
+	// TypeName writes the type with its numbers, such as DECIMAL(10, 2),
+	// telling text of a fixed length, CHAR(n), from VARCHAR(n)
+	TypeName() string
+
+	// Collation returns how text in the column compares, CollateBinary
+	// unless the column was declared with COLLATE
+	Collation() Collation
+
 	Constraints() []types.Constraint
+	Default() Expression
+}
+
+// TableConstraint is a PRIMARY KEY, UNIQUE, CHECK or FOREIGN KEY constraint of a table
+type TableConstraint struct {
+	Name       string
+	Type       types.Constraint
+	Columns    []string
+	Check      Expression
+	RefTable   string
+	RefColumns []string
+	OnDelete   types.ReferentialAction
+	OnUpdate   types.ReferentialAction
 }
 
 // Expression represents an expression in SQL statements
 type Expression interface {
-	Eval(row map[string]Value) (Value, error)
+	Eval(ctx EvalContext, row map[string]Value) (Value, error)
+}
+
+// EvalContext is what expressions need from the statement they are evaluated for
+type EvalContext interface {
+	// Query runs a subquery for a row of the enclosing query, whose columns
+	// the subquery may refer to. Each result row holds the values of the
+	// subquery's select list in order.
+	Query(query SelectStatement, outer map[string]Value) ([][]Value, error)
+
+	// NextValue advances a sequence and returns its new value
+	NextValue(sequence string) (int64, error)
+}
+
+// ColumnExpression is an expression that reads a column of the current row
+type ColumnExpression interface {
+	Expression
+	ColumnName() string
+}
+
+// LiteralExpression is an expression with a constant value
+type LiteralExpression interface {
+	Expression
+	Value() Value
+}
+
+// SequenceExpression is nextval('sequence'), which advances a sequence
+type SequenceExpression interface {
+	Expression
+	Sequence() string
+}
+
+// BinaryExpression applies an operator to two operands
+type BinaryExpression interface {
+	Expression
+	Operator() string
+	Left() Expression
+	Right() Expression
+}
+
+// UnaryExpression applies NOT or unary minus to a single operand
+type UnaryExpression interface {
+	Expression
+	Operator() string
+	Operand() Expression
+}
+
+// CaseExpression is CASE [operand] WHEN ... THEN ... [ELSE ...] END
+type CaseExpression interface {
+	Expression
+	Operand() Expression
+	Whens() []WhenClause
+	Else() Expression
+}
+
+// WhenClause is one WHEN ... THEN ... of a CASE expression
+type WhenClause struct {
+	When Expression
+	Then Expression
+}
+
+// CoalesceExpression is COALESCE(args), the first argument that is not NULL
+type CoalesceExpression interface {
+	Expression
+	Args() []Expression
+}
+
+// NullIfExpression is NULLIF(left, right)
+type NullIfExpression interface {
+	Expression
+	Left() Expression
+	Right() Expression
+}
+
+// CastExpression is CAST(operand AS type)
+type CastExpression interface {
+	Expression
+	Operand() Expression
+	TargetType() types.DataType
+}
+
+// CollateExpression is operand COLLATE name
+type CollateExpression interface {
+	Expression
+	Operand() Expression
+	Collation() Collation
+}
+
+// InListExpression is operand IN (list)
+type InListExpression interface {
+	Expression
+	Operand() Expression
+	List() []Expression
+}
+
+// BetweenExpression is operand BETWEEN low AND high
+type BetweenExpression interface {
+	Expression
+	Operand() Expression
+	Low() Expression
+	High() Expression
+}
+
+// LikeExpression is operand LIKE pattern [ESCAPE escape], or ILIKE
+type LikeExpression interface {
+	Expression
+	Operand() Expression
+	Pattern() Expression
+	Escape() Expression
+	CaseInsensitive() bool
+}
+
+// FunctionExpression is a call of a function, such as COUNT(*) or UPPER(name)
+type FunctionExpression interface {
+	Expression
+	Name() string
+	Args() []Expression
+	Star() bool
+	Distinct() bool
+	Scalar() *ScalarFunction
+	Aggregate() *AggregateFunction
+}
+
+// WindowExpression is a function call with an OVER clause
+type WindowExpression interface {
+	Expression
+	Function() FunctionExpression
+	PartitionBy() []Expression
+	OrderBy() []OrderByItem
+	Frame() *WindowFrame
+}
+
+// WindowFrame is the frame clause of a window
+type WindowFrame struct {
+	Rows  bool
+	Start FrameBound
+	End   FrameBound
+}
+
+// FrameBound is one end of a window frame
+type FrameBound struct {
+	Type   FrameBoundType
+	Offset int64
+}
+
+// FrameBoundType is the kind of a FrameBound, ordered from the start of the partition
+type FrameBoundType int
+
+const (
+	// FrameUnboundedPreceding is UNBOUNDED PRECEDING, the first row
+	FrameUnboundedPreceding FrameBoundType = iota
+	// FramePreceding is n PRECEDING
+	FramePreceding
+	// FrameCurrentRow is CURRENT ROW
+	FrameCurrentRow
+	// FrameFollowing is n FOLLOWING
+	FrameFollowing
+	// FrameUnboundedFollowing is UNBOUNDED FOLLOWING, the last row
+	FrameUnboundedFollowing
+)
+
+// SubqueryKind tells how a subquery is used in an expression
+type SubqueryKind int
+
+const (
+	// SubqueryScalar is (SELECT ...) used as a value
+	SubqueryScalar SubqueryKind = iota
+	// SubqueryExists is EXISTS (SELECT ...)
+	SubqueryExists
+	// SubqueryIn is operand IN (SELECT ...)
+	SubqueryIn
+)
+
+// SubqueryExpression is a SELECT statement nested in an expression
+type SubqueryExpression interface {
+	Expression
+	Kind() SubqueryKind
+	Query() SelectStatement
+	Operand() Expression
 }
 
 // Value represents a SQL value
@@ -78,4 +393,12 @@ type Value interface {
 	AsString() (string, error)
 	AsBool() (bool, error)
 	AsNull() (bool, error)
+
+	// AsDecimal returns a number as an exact DECIMAL. A FLOAT gives the
+	// decimal number it is written as, and text is read as a number.
+	AsDecimal() (Decimal, error)
+
+	// AsBytes returns the bytes of a BLOB, or of text, which the caller
+	// must not change
+	AsBytes() ([]byte, error)
 }
@@ -0,0 +1,514 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// JSONValue is a JSON document, kept as its canonical text
+type JSONValue struct {
+	text string
+	doc  any
+}
+
+// ParseJSON reads a JSON document from text
+func ParseJSON(s string) (Value, error) {
+	doc, err := decodeJSON(s)
+	if err != nil {
+		return nil, err
+	}
+	return newJSONValue(doc)
+}
+
+// decodeJSON parses the text of a JSON document, keeping numbers as json.Number
+func decodeJSON(s string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON value: '%s'", s)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON value: '%s'", s)
+	}
+	return doc, nil
+}
+
+// newJSONValue creates a JSON value holding a decoded document, which the caller must not change
+func newJSONValue(doc any) (*JSONValue, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("cannot convert to JSON: %v", err)
+	}
+	return &JSONValue{text: strings.TrimSuffix(buf.String(), "\n"), doc: doc}, nil
+}
+
+func (v *JSONValue) Type() types.DataType {
+	return types.TypeJSON
+}
+
+func (v *JSONValue) AsInt() (int64, error) {
+	return 0, fmt.Errorf("cannot convert JSON to int")
+}
+
+// AsString returns the canonical text of the document
+func (v *JSONValue) AsString() (string, error) {
+	return v.text, nil
+}
+
+func (v *JSONValue) AsBool() (bool, error) {
+	return false, fmt.Errorf("cannot convert JSON to bool")
+}
+
+func (v *JSONValue) AsFloat() (float64, error) {
+	return 0, fmt.Errorf("cannot convert JSON to float")
+}
+
+func (v *JSONValue) AsDecimal() (Decimal, error) {
+	return Decimal{}, fmt.Errorf("cannot convert JSON to decimal")
+}
+
+func (v *JSONValue) AsBytes() ([]byte, error) {
+	return nil, fmt.Errorf("cannot convert JSON to BLOB")
+}
+
+func (v *JSONValue) AsNull() (bool, error) {
+	return false, nil
+}
+
+// String returns the document as a literal, such as JSON '{"a":1}'
+func (v *JSONValue) String() string {
+	return "JSON '" + strings.ReplaceAll(v.text, "'", "''") + "'"
+}
+
+// jsonDocument returns the document a JSON value holds, or that text holds
+func jsonDocument(val Value) (any, error) {
+	switch val.Type() {
+	case types.TypeJSON:
+		if j, ok := val.(*JSONValue); ok {
+			return j.doc, nil
+		}
+		return decodeJSON(textOf(val))
+	case types.TypeString:
+		return decodeJSON(textOf(val))
+	}
+	return nil, fmt.Errorf("cannot convert %v to JSON", val.Type())
+}
+
+// jsonOf converts a value to the JSON it stands for in a document
+func jsonOf(val Value) (any, error) {
+	switch val.Type() {
+	case types.TypeJSON:
+		return jsonDocument(val)
+	case types.TypeString:
+		return textOf(val), nil
+	case types.TypeInt:
+		return json.Number(strconv.FormatInt(intOf(val), 10)), nil
+	case types.TypeFloat:
+		f := floatOf(val)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("cannot convert %v to JSON", val)
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	case types.TypeDecimal:
+		return json.Number(decimalOf(val).String()), nil
+	case types.TypeBool:
+		b, _ := val.AsBool()
+		return b, nil
+	}
+	return valueText(val), nil
+}
+
+// jsonText converts a part of a document to TEXT the way ->> gives it
+func jsonText(doc any) (Value, error) {
+	switch d := doc.(type) {
+	case nil:
+		return &literalValue{dataType: types.TypeNull}, nil
+	case string:
+		return textValue(d), nil
+	}
+	j, err := newJSONValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	return textValue(j.text), nil
+}
+
+// jsonScalar converts a JSON string, number or boolean to the SQL value it holds
+func jsonScalar(doc any) (Value, bool) {
+	switch d := doc.(type) {
+	case string:
+		return textValue(d), true
+	case bool:
+		return newBoolValue(d), true
+	case json.Number:
+		if i, err := d.Int64(); err == nil {
+			return intValue(i), true
+		}
+		if dec, err := ParseDecimal(string(d)); err == nil {
+			return NewDecimalValue(dec), true
+		}
+		if f, err := d.Float64(); err == nil {
+			return floatValue(f), true
+		}
+	}
+	return nil, false
+}
+
+// jsonStep is one step of a path into a JSON document
+type jsonStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// jsonPath is a path into a JSON document
+type jsonPath []jsonStep
+
+// parseJSONPath reads the path a JSON operator or function is given
+func parseJSONPath(val Value) (jsonPath, error) {
+	switch val.Type() {
+	case types.TypeInt:
+		return jsonPath{{index: int(intOf(val)), isIndex: true}}, nil
+	case types.TypeString:
+	default:
+		return nil, fmt.Errorf("JSON path must be TEXT or INT, got %v", val.Type())
+	}
+
+	text := textOf(val)
+	rest, ok := strings.CutPrefix(text, "$")
+	if !ok {
+		return jsonPath{{key: text}}, nil
+	}
+	invalid := fmt.Errorf("invalid JSON path: '%s'", text)
+
+	var path jsonPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.IndexByte(rest[1:], '"')
+				if end < 0 {
+					return nil, invalid
+				}
+				path = append(path, jsonStep{key: rest[1 : end+1]})
+				rest = rest[end+2:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, invalid
+			}
+			path = append(path, jsonStep{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, invalid
+			}
+			i, err := strconv.Atoi(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return nil, invalid
+			}
+			path = append(path, jsonStep{index: i, isIndex: true})
+			rest = rest[end+1:]
+		default:
+			return nil, invalid
+		}
+	}
+	return path, nil
+}
+
+// position turns the index of a step into a position in an array of n elements
+func (s jsonStep) position(n int) (int, bool) {
+	i := s.index
+	if i < 0 {
+		i += n
+	}
+	return i, i >= 0 && i < n
+}
+
+// find returns the part of a document at the path, reporting whether the document has it
+func (path jsonPath) find(doc any) (any, bool) {
+	for _, step := range path {
+		switch d := doc.(type) {
+		case map[string]any:
+			if step.isIndex {
+				return nil, false
+			}
+			member, ok := d[step.key]
+			if !ok {
+				return nil, false
+			}
+			doc = member
+		case []any:
+			i, ok := step.position(len(d))
+			if !step.isIndex || !ok {
+				return nil, false
+			}
+			doc = d[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// set returns a copy of a document with the part at the path replaced by val
+func (path jsonPath) set(doc any, val any) any {
+	if len(path) == 0 {
+		return val
+	}
+	step, rest := path[0], path[1:]
+
+	switch d := doc.(type) {
+	case map[string]any:
+		if step.isIndex {
+			return doc
+		}
+		member, ok := d[step.key]
+		if !ok {
+			if len(rest) > 0 && rest[0].isIndex {
+				return doc
+			}
+			member = map[string]any{}
+		}
+		result := maps.Clone(d)
+		result[step.key] = rest.set(member, val)
+		return result
+
+	case []any:
+		if !step.isIndex {
+			return doc
+		}
+		if step.index == len(d) && len(rest) == 0 {
+			return append(slices.Clone(d), val)
+		}
+		i, ok := step.position(len(d))
+		if !ok {
+			return doc
+		}
+		result := slices.Clone(d)
+		result[i] = rest.set(d[i], val)
+		return result
+	}
+	return doc
+}
+
+// evalJSONAccess applies -> or ->> to a JSON document and a path
+func evalJSONAccess(operator string, left, right Value) (Value, error) {
+	doc, err := jsonDocument(left)
+	if err != nil {
+		return nil, fmt.Errorf("operator %s: %v", operator, err)
+	}
+	path, err := parseJSONPath(right)
+	if err != nil {
+		return nil, err
+	}
+	part, ok := path.find(doc)
+	if !ok {
+		return &literalValue{dataType: types.TypeNull}, nil
+	}
+	if operator == "->" {
+		return newJSONValue(part)
+	}
+	return jsonText(part)
+}
+
+// The JSON functions among the built-in functions. Their paths are given
+// as parseJSONPath reads them.
+
+// jsonSetSignatures are the signatures of JSON_SET
+var jsonSetSignatures = []Signature{
+	sig(tJSON, tJSON, tText, tText), sig(tJSON, tJSON, tText, tInt), sig(tJSON, tJSON, tText, tDecimal),
+	sig(tJSON, tJSON, tText, tFloat), sig(tJSON, tJSON, tText, tBool), sig(tJSON, tJSON, tText, tJSON),
+}
+
+// evalJSONExtract returns the part of a document at a path, or NULL
+func evalJSONExtract(args []Value) (Value, error) {
+	return evalJSONAccess("->", args[0], args[1])
+}
+
+// evalJSONSet puts a value at a path of a document, as jsonPath.set does
+func evalJSONSet(args []Value) (Value, error) {
+	doc, err := jsonDocument(args[0])
+	if err != nil {
+		return nil, err
+	}
+	path, err := parseJSONPath(args[1])
+	if err != nil {
+		return nil, err
+	}
+	val, err := jsonOf(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return newJSONValue(path.set(doc, val))
+}
+
+// evalJSONArrayLength counts the elements of an array, found at a path when one is given
+func evalJSONArrayLength(args []Value) (Value, error) {
+	doc, err := jsonDocument(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 1 {
+		path, err := parseJSONPath(args[1])
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if doc, ok = path.find(doc); !ok {
+			return &literalValue{dataType: types.TypeNull}, nil
+		}
+	}
+	array, _ := doc.([]any)
+	return intValue(int64(len(array))), nil
+}
+
+// TableFunction is a function that a FROM clause reads like a table, such as json_each(doc)
+type TableFunction struct {
+	Name       string
+	Signatures []Signature
+
+	// Columns names the columns of the rows, and ColumnTypes gives their types
+	Columns     []string
+	ColumnTypes []types.DataType
+
+	// Eval computes the rows from non-NULL arguments converted to the matched signature
+	Eval func(args []Value) ([][]Value, error)
+}
+
+// Resolve finds the signature that takes arguments of the given types
+func (f *TableFunction) Resolve(args []types.DataType) (Signature, error) {
+	return (&ScalarFunction{Name: f.Name, Signatures: f.Signatures}).Resolve(args)
+}
+
+// Call computes the rows for argument values; a NULL argument gives no rows
+func (f *TableFunction) Call(args []Value) ([][]Value, error) {
+	argTypes := make([]types.DataType, len(args))
+	for i, arg := range args {
+		if isNull(arg) {
+			return nil, nil
+		}
+		argTypes[i] = arg.Type()
+	}
+	sig, err := f.Resolve(argTypes)
+	if err != nil {
+		return nil, err
+	}
+	converted := make([]Value, len(args))
+	for i, arg := range args {
+		if converted[i], err = Cast(arg, sig.Args[i]); err != nil {
+			return nil, err
+		}
+	}
+	return f.Eval(converted)
+}
+
+// tableFunctions are the table functions, by upper-case name
+var tableFunctions = map[string]*TableFunction{
+	"JSON_EACH": {
+		Name:        "JSON_EACH",
+		Signatures:  []Signature{sig(types.TypeNull, tJSON), sig(types.TypeNull, tJSON, tText)},
+		Columns:     []string{"key", "value", "type"},
+		ColumnTypes: []types.DataType{types.TypeNull, tJSON, tText},
+		Eval:        evalJSONEach,
+	},
+}
+
+// LookupTableFunction finds a table function by name, ignoring case
+func LookupTableFunction(name string) (*TableFunction, bool) {
+	fn, ok := tableFunctions[strings.ToUpper(name)]
+	return fn, ok
+}
+
+// evalJSONEach lists the members of an object or the elements of an array
+func evalJSONEach(args []Value) ([][]Value, error) {
+	doc, err := jsonDocument(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 1 {
+		path, err := parseJSONPath(args[1])
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if doc, ok = path.find(doc); !ok {
+			return nil, nil
+		}
+	}
+
+	row := func(key Value, part any) ([]Value, error) {
+		val, err := newJSONValue(part)
+		if err != nil {
+			return nil, err
+		}
+		return []Value{key, val, textValue(jsonTypeName(part))}, nil
+	}
+	var rows [][]Value
+	switch d := doc.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(d))
+		for key := range d {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			r, err := row(textValue(key), d[key])
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, r)
+		}
+	case []any:
+		for i, element := range d {
+			r, err := row(intValue(int64(i)), element)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, r)
+		}
+	default:
+		r, err := row(&literalValue{dataType: types.TypeNull}, doc)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
+
+// jsonTypeName names the JSON type of a part of a document
+func jsonTypeName(doc any) string {
+	switch doc.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
@@ -0,0 +1,279 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenType identifies the kind of a lexical token
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenBlob
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenDot
+	tokenSemicolon
+)
+
+// token is a single lexical token of a SQL string
+type token struct {
+	typ  tokenType
+	text string
+	pos  int
+}
+
+// tokenize splits a SQL string into tokens
+func tokenize(sql string) ([]token, error) {
+	var tokens []token
+	runes := []rune(sql)
+	i := 0
+
+	for i < len(runes) {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			// Line comment
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case (r == 'x' || r == 'X') && i+1 < len(runes) && runes[i+1] == '\'':
+			// BLOB literal, X'DEADBEEF'; the token text is the hex digits
+			start := i
+			i += 2
+			for i < len(runes) && runes[i] != '\'' {
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated BLOB literal at position %d", start)
+			}
+			tokens = append(tokens, token{typ: tokenBlob, text: string(runes[start+2 : i]), pos: start})
+			i++
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{typ: tokenIdent, text: string(runes[start:i]), pos: start})
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			// Exponent, as in 1.5e10
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				if j < len(runes) && unicode.IsDigit(runes[j]) {
+					i = j
+					for i < len(runes) && unicode.IsDigit(runes[i]) {
+						i++
+					}
+				}
+			}
+			tokens = append(tokens, token{typ: tokenNumber, text: string(runes[start:i]), pos: start})
+
+		case r == '\'' || r == '"':
+			quote := r
+			start := i
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(runes) {
+				if runes[i] == quote {
+					if i+1 < len(runes) && runes[i+1] == quote {
+						sb.WriteRune(quote)
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string literal at position %d", start)
+			}
+			tokens = append(tokens, token{typ: tokenString, text: sb.String(), pos: start})
+
+		case r == '(':
+			tokens = append(tokens, token{typ: tokenLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{typ: tokenRParen, text: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{typ: tokenComma, text: ",", pos: i})
+			i++
+		case r == '.':
+			tokens = append(tokens, token{typ: tokenDot, text: ".", pos: i})
+			i++
+		case r == ';':
+			tokens = append(tokens, token{typ: tokenSemicolon, text: ";", pos: i})
+			i++
+
+		default:
+			// Longer operators first
+			if i+2 < len(runes) && string(runes[i:i+3]) == "->>" {
+				tokens = append(tokens, token{typ: tokenOperator, text: "->>", pos: i})
+				i += 3
+				continue
+			}
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				switch two {
+				case "<=", ">=", "<>", "!=", "||", "->":
+					tokens = append(tokens, token{typ: tokenOperator, text: two, pos: i})
+					i += 2
+					continue
+				}
+			}
+			if strings.ContainsRune("=<>+-*/%", r) {
+				tokens = append(tokens, token{typ: tokenOperator, text: string(r), pos: i})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i)
+		}
+	}
+
+	tokens = append(tokens, token{typ: tokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// tokenParser walks a token list for the recursive-descent parts of the parser
+type tokenParser struct {
+	tokens []token
+	pos    int
+
+	// source is the tokenized text, which token positions index
+	source []rune
+
+	// functions resolves the scalar functions that expressions call
+	functions *FunctionRegistry
+}
+
+// newTokenParser tokenizes a SQL fragment and returns a parser positioned at its start
+func newTokenParser(sql string, functions *FunctionRegistry) (*tokenParser, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenParser{tokens: tokens, source: []rune(sql), functions: functions}, nil
+}
+
+// peek returns the current token without consuming it
+func (p *tokenParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// peekAt returns the token n positions ahead of the current one
+func (p *tokenParser) peekAt(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+// next consumes and returns the current token
+func (p *tokenParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.typ != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// atEnd reports whether only an optional trailing semicolon is left
+func (p *tokenParser) atEnd() bool {
+	tok := p.peek()
+	return tok.typ == tokenEOF || (tok.typ == tokenSemicolon && p.peekAt(1).typ == tokenEOF)
+}
+
+// isKeyword reports whether the current token is the given keyword
+func (p *tokenParser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.typ == tokenIdent && strings.EqualFold(tok.text, keyword)
+}
+
+// matchKeyword consumes the current token if it is the given keyword
+func (p *tokenParser) matchKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expectKeyword consumes the given keyword or fails
+func (p *tokenParser) expectKeyword(keyword string) error {
+	if !p.matchKeyword(keyword) {
+		return p.errorf("expected %s", keyword)
+	}
+	return nil
+}
+
+// matchOperator consumes the current token if it is the given operator
+func (p *tokenParser) matchOperator(op string) bool {
+	tok := p.peek()
+	if tok.typ == tokenOperator && tok.text == op {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// match consumes the current token if it has the given type
+func (p *tokenParser) match(typ tokenType) bool {
+	if p.peek().typ == typ {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expect consumes a token of the given type or fails
+func (p *tokenParser) expect(typ tokenType, what string) (token, error) {
+	tok := p.peek()
+	if tok.typ != typ {
+		return tok, p.errorf("expected %s", what)
+	}
+	return p.next(), nil
+}
+
+// expectIdent consumes an identifier and returns its text
+func (p *tokenParser) expectIdent(what string) (string, error) {
+	tok, err := p.expect(tokenIdent, what)
+	if err != nil {
+		return "", err
+	}
+	return tok.text, nil
+}
+
+// errorf builds a syntax error that points at the current token
+func (p *tokenParser) errorf(format string, args ...interface{}) error {
+	tok := p.peek()
+	near := tok.text
+	if tok.typ == tokenEOF {
+		near = "end of input"
+	}
+	return fmt.Errorf("syntax error near '%s': %s", near, fmt.Sprintf(format, args...))
+}
@@ -4,17 +4,27 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
 )
 
 // SimpleParser implements the Parser interface
-type SimpleParser struct{}
+type SimpleParser struct {
+	// functions holds the functions statements can call
+	functions *FunctionRegistry
+}
 
-// NewParser creates a new SimpleParser
+// NewParser creates a new SimpleParser that knows the built-in functions
 func NewParser() Parser {
-	return &SimpleParser{}
+	return NewParserWithFunctions(NewFunctionRegistry())
+}
+
+// NewParserWithFunctions creates a new SimpleParser that resolves calls with a registry
+func NewParserWithFunctions(functions *FunctionRegistry) Parser {
+	return &SimpleParser{functions: functions}
 }
 
 // Parse parses a SQL statement and returns a Statement interface
@@ -22,62 +32,256 @@ func (p *SimpleParser) Parse(sql string) (Statement, error) {
 	sql = strings.TrimSpace(sql)
 	sql = strings.TrimRight(sql, ";")
 
-	if strings.HasPrefix(strings.ToUpper(sql), "CREATE TABLE") {
+	if explainRegex.MatchString(sql) {
+		return p.parseExplain(sql)
+	} else if analyzeRegex.MatchString(sql) {
+		return p.parseAnalyze(sql)
+	} else if createSequenceRegex.MatchString(sql) {
+		return p.parseCreateSequence(sql)
+	} else if dropSequenceRegex.MatchString(sql) {
+		return p.parseDropSequence(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "CREATE TABLE") {
 		return p.parseCreateTable(sql)
+	} else if createIndexRegex.MatchString(sql) {
+		return p.parseCreateIndex(sql)
+	} else if alterTableRegex.MatchString(sql) {
+		return p.parseAlterTable(sql)
 	} else if strings.HasPrefix(strings.ToUpper(sql), "DROP TABLE") {
 		return p.parseDropTable(sql)
+	} else if strings.HasPrefix(strings.ToUpper(sql), "DROP INDEX") {
+		return p.parseDropIndex(sql)
 	} else if strings.HasPrefix(strings.ToUpper(sql), "INSERT INTO") {
 		return p.parseInsert(sql)
 	} else if strings.HasPrefix(strings.ToUpper(sql), "UPDATE") {
 		return p.parseUpdate(sql)
 	} else if strings.HasPrefix(strings.ToUpper(sql), "DELETE FROM") {
 		return p.parseDelete(sql)
-	} else if strings.HasPrefix(strings.ToUpper(sql), "SELECT") {
+	} else if strings.HasPrefix(strings.ToUpper(sql), "SELECT") || withRegex.MatchString(sql) || strings.HasPrefix(sql, "(") {
 		return p.parseSelect(sql)
 	}
 
 	return nil, errors.New("unsupported SQL statement")
 }
 
-// parseCreateTable parses a CREATE TABLE statement
-func (p *SimpleParser) parseCreateTable(sql string) (CreateTableStatement, error) {
-	// Basic regex for CREATE TABLE name (col1 type, col2 type, ...)
-	r := regexp.MustCompile(`(?i)CREATE\s+TABLE\s+(\w+)\s*\((.*)\)`)
-	matches := r.FindStringSubmatch(sql)
+// Regular expressions for CREATE SEQUENCE and DROP SEQUENCE
+var (
+	createSequenceRegex = regexp.MustCompile(`(?i)^CREATE\s+SEQUENCE\b`)
+	sequenceRegex       = regexp.MustCompile(`(?i)^CREATE\s+SEQUENCE\s+(\w+)((?:\s+(?:START|INCREMENT)(?:\s+(?:WITH|BY))?\s+[-+]?\d+)*)$`)
+	sequenceOptionRegex = regexp.MustCompile(`(?i)(START|INCREMENT)(?:\s+(?:WITH|BY))?\s+([-+]?\d+)`)
+	dropSequenceRegex   = regexp.MustCompile(`(?i)^DROP\s+SEQUENCE\b`)
+)
 
-	if len(matches) != 3 {
-		return nil, errors.New("invalid CREATE TABLE syntax")
+// parseCreateSequence parses a CREATE SEQUENCE statement
+func (p *SimpleParser) parseCreateSequence(sql string) (CreateSequenceStatement, error) {
+	matches := sequenceRegex.FindStringSubmatch(sql)
+	if matches == nil {
+		return nil, errors.New("invalid CREATE SEQUENCE syntax")
 	}
 
-	tableName := matches[1]
-	columnDefs := matches[2]
+	stmt := &createSequenceStatement{sequenceName: matches[1], start: 1, increment: 1}
+	seen := make(map[string]bool)
+	for _, option := range sequenceOptionRegex.FindAllStringSubmatch(matches[2], -1) {
+		name := strings.ToUpper(option[1])
+		if seen[name] {
+			return nil, fmt.Errorf("%s given more than once for sequence %s", name, stmt.sequenceName)
+		}
+		seen[name] = true
 
-	// Split column definitions
-	colParts := splitIgnoringParentheses(columnDefs, ',')
-	columns := make([]ColumnDefinition, 0, len(colParts))
+		n, err := strconv.ParseInt(option[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for sequence %s: %s", name, stmt.sequenceName, option[2])
+		}
+		if name == "START" {
+			stmt.start = n
+		} else {
+			stmt.increment = n
+		}
+	}
+	if stmt.increment == 0 {
+		return nil, fmt.Errorf("INCREMENT of sequence %s cannot be 0", stmt.sequenceName)
+	}
+	return stmt, nil
+}
 
-	for _, colStr := range colParts {
-		colStr = strings.TrimSpace(colStr)
-		parts := strings.Fields(colStr)
+// parseDropSequence parses a DROP SEQUENCE statement
+func (p *SimpleParser) parseDropSequence(sql string) (DropSequenceStatement, error) {
+	matches := regexp.MustCompile(`(?i)^DROP\s+SEQUENCE\s+(\w+)$`).FindStringSubmatch(sql)
+	if matches == nil {
+		return nil, errors.New("invalid DROP SEQUENCE syntax")
+	}
+	return &dropSequenceStatement{sequenceName: matches[1]}, nil
+}
 
-		if len(parts) < 2 {
-			return nil, fmt.Errorf("invalid column definition: %s", colStr)
+// Regular expressions for the forms of ALTER TABLE
+var (
+	alterTableRegex     = regexp.MustCompile(`(?i)^ALTER\s+TABLE\b`)
+	addColumnRegex      = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\w+)\s+ADD\s+(COLUMN\s+)?(.+)$`)
+	dropConstraintRegex = regexp.MustCompile(`(?i)^ALTER\s+TABLE\s+(\w+)\s+DROP\s+CONSTRAINT\s+(\w+)$`)
+	dropColumnRegex     = regexp.MustCompile(`(?i)^ALTER\s+TABLE\s+(\w+)\s+DROP\s+(?:COLUMN\s+)?(\w+)$`)
+	renameTableRegex    = regexp.MustCompile(`(?i)^ALTER\s+TABLE\s+(\w+)\s+RENAME\s+TO\s+(\w+)$`)
+	renameColumnRegex   = regexp.MustCompile(`(?i)^ALTER\s+TABLE\s+(\w+)\s+RENAME\s+(?:COLUMN\s+)?(\w+)\s+TO\s+(\w+)$`)
+)
+
+// parseAlterTable parses an ALTER TABLE statement
+func (p *SimpleParser) parseAlterTable(sql string) (AlterTableStatement, error) {
+	if m := renameTableRegex.FindStringSubmatch(sql); m != nil {
+		return &alterTableStatement{tableName: m[1], action: types.AlterRenameTable, newName: m[2]}, nil
+	}
+	if m := renameColumnRegex.FindStringSubmatch(sql); m != nil {
+		return &alterTableStatement{tableName: m[1], action: types.AlterRenameColumn, columnName: m[2], newName: m[3]}, nil
+	}
+	if m := dropConstraintRegex.FindStringSubmatch(sql); m != nil {
+		return &alterTableStatement{tableName: m[1], action: types.AlterDropConstraint, constraint: m[2]}, nil
+	}
+	if m := dropColumnRegex.FindStringSubmatch(sql); m != nil {
+		if strings.EqualFold(m[2], "CONSTRAINT") {
+			return nil, errors.New("DROP CONSTRAINT needs a constraint name")
 		}
+		return &alterTableStatement{tableName: m[1], action: types.AlterDropColumn, columnName: m[2]}, nil
+	}
+	if m := addColumnRegex.FindStringSubmatch(sql); m != nil {
+		tp, err := newTokenParser(m[3], p.functions)
+		if err != nil {
+			return nil, err
+		}
+		if m[2] == "" && tp.startsTableConstraint() {
+			constraint, err := tp.parseTableConstraint()
+			if err != nil {
+				return nil, err
+			}
+			if !tp.atEnd() {
+				return nil, tp.errorf("unexpected token")
+			}
+			return &alterTableStatement{tableName: m[1], action: types.AlterAddConstraint, constraints: []TableConstraint{constraint}}, nil
+		}
+		col, constraints, err := tp.parseColumnDefinition()
+		if err != nil {
+			return nil, err
+		}
+		if !tp.atEnd() {
+			return nil, tp.errorf("unexpected token")
+		}
+		if slices.Contains(col.constraints, types.ConstraintAutoIncrement) {
+			return nil, fmt.Errorf("cannot add AUTOINCREMENT column %s", col.Name())
+		}
+		return &alterTableStatement{tableName: m[1], action: types.AlterAddColumn, column: col, constraints: constraints}, nil
+	}
+	return nil, errors.New("invalid ALTER TABLE syntax")
+}
 
-		name := parts[0]
-		dataType := parseDataType(parts[1])
-		constraints := parseConstraints(parts[2:])
+// createIndexRegex recognizes the start of a CREATE [UNIQUE] INDEX statement
+var createIndexRegex = regexp.MustCompile(`(?i)^CREATE\s+(UNIQUE\s+)?INDEX\b`)
+
+// parseCreateIndex parses a CREATE [UNIQUE] INDEX statement
+func (p *SimpleParser) parseCreateIndex(sql string) (CreateIndexStatement, error) {
+	// CREATE [UNIQUE] INDEX name ON table (part1, part2, ...)
+	r := regexp.MustCompile(`(?is)^CREATE\s+(UNIQUE\s+)?INDEX\s+(\w+)\s+ON\s+(\w+)\s*\((.+)\)$`)
+	matches := r.FindStringSubmatch(sql)
 
-		columns = append(columns, &columnDefinition{
-			name:        name,
-			dataType:    dataType,
-			constraints: constraints,
-		})
+	if len(matches) != 5 {
+		return nil, errors.New("invalid CREATE INDEX syntax")
 	}
 
-	return &createTableStatement{
-		tableName: tableName,
-		columns:   columns,
+	stmt := &createIndexStatement{
+		indexName: matches[2],
+		tableName: matches[3],
+		unique:    matches[1] != "",
+	}
+	for _, part := range splitAndTrim(matches[4], ',') {
+		if identifierRegex.MatchString(part) {
+			stmt.columns = append(stmt.columns, part)
+			stmt.expressions = append(stmt.expressions, nil)
+			continue
+		}
+		expr, err := p.parseIndexExpression(part)
+		if err != nil {
+			return nil, err
+		}
+		if col, ok := expr.(*columnExpression); ok {
+			stmt.columns = append(stmt.columns, col.columnName)
+			stmt.expressions = append(stmt.expressions, nil)
+			continue
+		}
+		stmt.columns = append(stmt.columns, fmt.Sprint(expr))
+		stmt.expressions = append(stmt.expressions, expr)
+	}
+	if !slices.ContainsFunc(stmt.expressions, func(expr Expression) bool { return expr != nil }) {
+		stmt.expressions = nil
+	}
+	return stmt, nil
+}
+
+// parseIndexExpression parses a key part of an index that is not a plain column
+func (p *SimpleParser) parseIndexExpression(part string) (Expression, error) {
+	expr, err := p.parseExpression(part)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index column: %s", part)
+	}
+	columns, volatile, err := checkStored(expr)
+	if err != nil {
+		return nil, fmt.Errorf("index expression %v", err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("index expression %v must refer to a column", expr)
+	}
+	if volatile {
+		return nil, fmt.Errorf("index expression %v must give the same result each time", expr)
+	}
+	return expr, nil
+}
+
+// parseDropIndex parses a DROP INDEX statement
+func (p *SimpleParser) parseDropIndex(sql string) (DropIndexStatement, error) {
+	r := regexp.MustCompile(`(?i)^DROP\s+INDEX\s+(\w+)$`)
+	matches := r.FindStringSubmatch(sql)
+
+	if len(matches) != 2 {
+		return nil, errors.New("invalid DROP INDEX syntax")
+	}
+
+	return &dropIndexStatement{
+		indexName: matches[1],
+	}, nil
+}
+
+// explainRegex matches EXPLAIN [ANALYZE] followed by the statement to explain
+var explainRegex = regexp.MustCompile(`(?is)^EXPLAIN\s+(ANALYZE\s+)?(.*)$`)
+
+// parseExplain parses an EXPLAIN [ANALYZE] statement
+func (p *SimpleParser) parseExplain(sql string) (ExplainStatement, error) {
+	matches := explainRegex.FindStringSubmatch(sql)
+
+	stmt, err := p.Parse(matches[2])
+	if err != nil {
+		return nil, err
+	}
+
+	switch stmt.Type() {
+	case types.StmtSelect, types.StmtInsert, types.StmtUpdate, types.StmtDelete:
+	default:
+		return nil, errors.New("EXPLAIN supports only SELECT, INSERT, UPDATE and DELETE")
+	}
+
+	return &explainStatement{
+		stmt:    stmt,
+		analyze: matches[1] != "",
+	}, nil
+}
+
+// analyzeRegex recognizes the start of an ANALYZE statement
+var analyzeRegex = regexp.MustCompile(`(?i)^ANALYZE\b`)
+
+// parseAnalyze parses an ANALYZE [table] statement
+func (p *SimpleParser) parseAnalyze(sql string) (AnalyzeStatement, error) {
+	r := regexp.MustCompile(`(?i)^ANALYZE(?:\s+(\w+))?$`)
+	matches := r.FindStringSubmatch(sql)
+
+	if len(matches) != 2 {
+		return nil, errors.New("invalid ANALYZE syntax")
+	}
+
+	return &analyzeStatement{
+		tableName: matches[1],
 	}, nil
 }
 
@@ -110,7 +314,10 @@ func (p *SimpleParser) parseInsert(sql string) (InsertStatement, error) {
 
 		// Parse values
 		valuesStr := matches[3]
-		valueGroups := parseValueLists(valuesStr)
+		valueGroups, err := p.parseValueLists(valuesStr)
+		if err != nil {
+			return nil, err
+		}
 
 		return &insertStatement{
 			tableName: tableName,
@@ -128,7 +335,10 @@ func (p *SimpleParser) parseInsert(sql string) (InsertStatement, error) {
 
 		// Parse values
 		valuesStr := matches[2]
-		valueGroups := parseValueLists(valuesStr)
+		valueGroups, err := p.parseValueLists(valuesStr)
+		if err != nil {
+			return nil, err
+		}
 
 		return &insertStatement{
 			tableName: tableName,
@@ -142,49 +352,55 @@ func (p *SimpleParser) parseInsert(sql string) (InsertStatement, error) {
 
 // parseUpdate parses an UPDATE statement
 func (p *SimpleParser) parseUpdate(sql string) (UpdateStatement, error) {
-	// Basic implementation for UPDATE table SET col=val WHERE condition
-	r := regexp.MustCompile(`(?i)UPDATE\s+(\w+)\s+SET\s+(.+?)(?:\s+WHERE\s+(.+))?$`)
-	matches := r.FindStringSubmatch(sql)
-
-	if len(matches) < 3 {
-		return nil, errors.New("invalid UPDATE syntax")
+	tp, err := newTokenParser(sql, p.functions)
+	if err != nil {
+		return nil, err
+	}
+	if err := tp.expectKeyword("UPDATE"); err != nil {
+		return nil, err
+	}
+	tableName, err := tp.expectIdent("table name")
+	if err != nil {
+		return nil, err
+	}
+	if err := tp.expectKeyword("SET"); err != nil {
+		return nil, err
 	}
-
-	tableName := matches[1]
-	setClauses := make(map[string]Expression)
 
 	// Parse SET clauses
-	setStr := matches[2]
-	setParts := splitIgnoringParentheses(setStr, ',')
-
-	for _, part := range setParts {
-		part = strings.TrimSpace(part)
-		eqParts := strings.SplitN(part, "=", 2)
-		if len(eqParts) != 2 {
-			return nil, fmt.Errorf("invalid SET clause: %s", part)
+	setClauses := make(map[string]Expression)
+	for {
+		colName, err := tp.expectIdent("column name")
+		if err != nil {
+			return nil, err
 		}
-
-		colName := strings.TrimSpace(eqParts[0])
-		valExpr, err := parseExpression(strings.TrimSpace(eqParts[1]))
+		if !tp.matchOperator("=") {
+			return nil, tp.errorf("expected =")
+		}
+		valExpr, err := tp.parseExpr()
 		if err != nil {
 			return nil, err
 		}
-
 		setClauses[colName] = valExpr
+
+		if !tp.match(tokenComma) {
+			break
+		}
 	}
 
-	var whereExpr Expression
 	// Parse WHERE clause if present
-	if len(matches) > 3 && len(matches[3]) > 0 {
-		var err error
-		whereExpr, err = parseExpression(matches[3])
-		if err != nil {
+	var whereExpr Expression
+	if tp.matchKeyword("WHERE") {
+		if whereExpr, err = tp.parseExpr(); err != nil {
 			return nil, err
 		}
 	} else {
 		// No WHERE clause, means all rows
 		whereExpr = &literalExpression{val: &literalValue{dataType: types.TypeBool, boolVal: true}}
 	}
+	if !tp.atEnd() {
+		return nil, tp.errorf("unexpected token")
+	}
 
 	return &updateStatement{
 		tableName:  tableName,
@@ -209,7 +425,7 @@ func (p *SimpleParser) parseDelete(sql string) (DeleteStatement, error) {
 	// Parse WHERE clause if present
 	if len(matches) > 2 && len(matches[2]) > 0 {
 		var err error
-		whereExpr, err = parseExpression(matches[2])
+		whereExpr, err = p.parseExpression(matches[2])
 		if err != nil {
 			return nil, err
 		}
@@ -224,76 +440,159 @@ func (p *SimpleParser) parseDelete(sql string) (DeleteStatement, error) {
 	}, nil
 }
 
-// parseSelect parses a SELECT statement
-func (p *SimpleParser) parseSelect(sql string) (SelectStatement, error) {
-	// SELECT col1, col2 FROM table WHERE condition
-	r := regexp.MustCompile(`(?i)SELECT\s+(.+?)\s+FROM\s+(\w+)(?:\s+WHERE\s+(.+))?$`)
-	matches := r.FindStringSubmatch(sql)
+// Helper functions for parsing
 
-	if len(matches) < 3 {
-		return nil, errors.New("invalid SELECT syntax")
+// parseDataType converts string type to DataType
+func parseDataType(typeStr string) types.DataType {
+	if dataType, ok := lookupDataType(typeStr); ok {
+		return dataType
 	}
+	return types.TypeString // default to string
+}
 
-	colsStr := matches[1]
-	tableName := matches[2]
+// lookupDataType finds the DataType a type name stands for
+func lookupDataType(typeStr string) (types.DataType, bool) {
+	switch strings.ToUpper(typeStr) {
+	case "INT", "INTEGER":
+		return types.TypeInt, true
+	case "FLOAT", "REAL", "DOUBLE":
+		return types.TypeFloat, true
+	case "TEXT", "VARCHAR", "CHAR", "STRING":
+		return types.TypeString, true
+	case "BOOL", "BOOLEAN":
+		return types.TypeBool, true
+	case "DATE":
+		return types.TypeDate, true
+	case "TIME":
+		return types.TypeTime, true
+	case "TIMESTAMP", "DATETIME":
+		return types.TypeTimestamp, true
+	case "TIMESTAMPTZ":
+		return types.TypeTimestampTZ, true
+	case "INTERVAL":
+		return types.TypeInterval, true
+	case "DECIMAL", "NUMERIC":
+		return types.TypeDecimal, true
+	case "BLOB", "BYTEA":
+		return types.TypeBlob, true
+	case "JSON", "JSONB":
+		return types.TypeJSON, true
+	}
+	return types.TypeNull, false
+}
 
-	columns := splitAndTrim(colsStr, ',')
+// parseTypeName parses the name of a type, including TIMESTAMP WITH TIME ZONE
+func (p *tokenParser) parseTypeName(what string) (string, error) {
+	name, err := p.expectIdent(what)
+	if err != nil {
+		return "", err
+	}
+	upper := strings.ToUpper(name)
+	with := p.isKeyword("WITH")
+	if (upper != "TIMESTAMP" && upper != "TIME") || (!with && !p.isKeyword("WITHOUT")) {
+		return name, nil
+	}
 
-	var whereExpr Expression
-	// Parse WHERE clause if present
-	if len(matches) > 3 && len(matches[3]) > 0 {
-		var err error
-		whereExpr, err = parseExpression(matches[3])
-		if err != nil {
+	p.next()
+	if err := p.expectKeyword("TIME"); err != nil {
+		return "", err
+	}
+	if err := p.expectKeyword("ZONE"); err != nil {
+		return "", err
+	}
+	if !with {
+		return name, nil
+	}
+	if upper == "TIME" {
+		return "", fmt.Errorf("TIME WITH TIME ZONE is not supported")
+	}
+	return "TIMESTAMPTZ", nil
+}
+
+// parseTypeParams parses the numbers in parentheses that may follow the name of a type
+func (p *tokenParser) parseTypeParams(typeName string, dataType types.DataType) ([]int, error) {
+	if !p.match(tokenLParen) {
+		if isCharType(typeName) {
+			return []int{1}, nil
+		}
+		return nil, nil
+	}
+	var params []int
+	for {
+		tok := p.next()
+		n, err := strconv.Atoi(tok.text)
+		if tok.typ != tokenNumber || err != nil {
+			return nil, p.errorf("invalid size of type %s", typeName)
+		}
+		params = append(params, n)
+		if p.match(tokenRParen) {
+			break
+		}
+		if _, err := p.expect(tokenComma, ","); err != nil {
 			return nil, err
 		}
-	} else {
-		// No WHERE clause, means all rows
-		whereExpr = &literalExpression{val: &literalValue{dataType: types.TypeBool, boolVal: true}}
 	}
 
-	return &selectStatement{
-		tableName: tableName,
-		columns:   columns,
-		whereExpr: whereExpr,
-	}, nil
+	if dataType == types.TypeString {
+		if !isCharType(typeName) && !strings.EqualFold(typeName, "VARCHAR") {
+			return nil, fmt.Errorf("%s takes no length; use VARCHAR(n)", strings.ToUpper(typeName))
+		}
+		if len(params) > 1 || params[0] < 1 {
+			return nil, fmt.Errorf("%s takes one length of at least 1", typeName)
+		}
+	}
+	if dataType == types.TypeDecimal {
+		switch {
+		case len(params) > 2:
+			return nil, fmt.Errorf("%s takes a precision and a scale, not %d numbers", typeName, len(params))
+		case params[0] < 1 || params[0] > maxDecimalPrecision:
+			return nil, fmt.Errorf("%s precision must be between 1 and %d, not %d", typeName, maxDecimalPrecision, params[0])
+		case len(params) == 2 && params[1] > params[0]:
+			return nil, fmt.Errorf("%s scale %d is larger than its precision %d", typeName, params[1], params[0])
+		}
+	}
+	return params, nil
 }
 
-// Helper functions for parsing
-
-// parseDataType converts string type to DataType
-func parseDataType(typeStr string) types.DataType {
-	switch strings.ToUpper(typeStr) {
-	case "INT", "INTEGER":
-		return types.TypeInt
-	case "FLOAT", "REAL", "DOUBLE":
-		return types.TypeFloat
-	case "TEXT", "VARCHAR", "CHAR", "STRING":
-		return types.TypeString
-	case "BOOL", "BOOLEAN":
-		return types.TypeBool
-	default:
-		return types.TypeString // default to string
+// parseCollation parses the name of a collation after COLLATE
+func (p *tokenParser) parseCollation() (Collation, error) {
+	name, err := p.expectIdent("collation name")
+	if err != nil {
+		return CollateBinary, err
+	}
+	collation, ok := LookupCollation(name)
+	if !ok {
+		return CollateBinary, fmt.Errorf("collation %s does not exist; use BINARY, NOCASE or UNICODE", name)
 	}
+	return collation, nil
 }
 
-// parseConstraints extracts constraints from string tokens
-func parseConstraints(constraintStrs []string) []types.Constraint {
-	result := []types.Constraint{}
+// isCharType reports whether a type name is CHAR
+func isCharType(typeName string) bool {
+	return strings.EqualFold(typeName, "CHAR")
+}
 
-	for _, str := range constraintStrs {
-		str = strings.ToUpper(strings.TrimSpace(str))
-		switch str {
-		case "NOT NULL":
-			result = append(result, types.ConstraintNotNull)
-		case "UNIQUE":
-			result = append(result, types.ConstraintUnique)
-		case "PRIMARY KEY":
-			result = append(result, types.ConstraintPrimaryKey)
-		}
+// declaredTypeName writes a type as TypeName does, but fixed-length text as CHAR(n)
+func declaredTypeName(dataType types.DataType, params []int, char bool) string {
+	if char && len(params) > 0 {
+		return fmt.Sprintf("CHAR(%d)", params[0])
 	}
+	return TypeName(dataType, params)
+}
 
-	return result
+// TypeName writes a type with the numbers given after its name, such as DECIMAL(10, 2)
+func TypeName(dataType types.DataType, params []int) string {
+	if len(params) == 0 {
+		return dataType.String()
+	}
+	if dataType == types.TypeString {
+		return fmt.Sprintf("VARCHAR(%d)", params[0])
+	}
+	parts := make([]string, len(params))
+	for i, n := range params {
+		parts[i] = strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%v(%s)", dataType, strings.Join(parts, ", "))
 }
 
 // splitAndTrim splits a string by a separator and trims whitespace
@@ -310,15 +609,24 @@ func splitIgnoringParentheses(s string, sep rune) []string {
 	var result []string
 	var current strings.Builder
 	depth := 0
+	var quote rune
 
 	for _, r := range s {
-		if r == '(' {
+		switch {
+		case quote != 0:
+			// A doubled quote ends the string and starts it again
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(':
 			depth++
-		} else if r == ')' {
+		case r == ')':
 			depth--
 		}
 
-		if r == sep && depth == 0 {
+		if r == sep && depth == 0 && quote == 0 {
 			result = append(result, current.String())
 			current.Reset()
 		} else {
@@ -334,141 +642,846 @@ func splitIgnoringParentheses(s string, sep rune) []string {
 }
 
 // parseValueLists parses the VALUES part of an INSERT
-func parseValueLists(valuesStr string) [][]Value {
-	valueGroups := [][]Value{}
-
-	// Extract each value group (val1, val2), (val3, val4)
-	groupRegex := regexp.MustCompile(`\(([^)]+)\)`)
-	matches := groupRegex.FindAllStringSubmatch(valuesStr, -1)
-
-	for _, match := range matches {
-		valueList := splitIgnoringParentheses(match[1], ',')
-		values := make([]Value, 0, len(valueList))
+func (p *SimpleParser) parseValueLists(valuesStr string) ([][]Expression, error) {
+	var valueGroups [][]Expression
+
+	// Each value group (val1, val2), (val3, val4) lies between parentheses
+	for _, group := range splitAndTrim(valuesStr, ',') {
+		inner, ok := strings.CutPrefix(group, "(")
+		if inner, ok = strings.CutSuffix(inner, ")"); !ok || strings.TrimSpace(inner) == "" {
+			return nil, fmt.Errorf("invalid VALUES list: %s", group)
+		}
 
-		for _, val := range valueList {
-			val = strings.TrimSpace(val)
-			// Parse each value
-			expr, err := parseExpression(val)
+		var values []Expression
+		for _, val := range splitAndTrim(inner, ',') {
+			expr, err := p.parseExpression(val)
 			if err != nil {
-				// Just create a NULL value if there's an error
-				values = append(values, &literalValue{dataType: types.TypeNull})
-				continue
-			}
-
-			if litExpr, ok := expr.(*literalExpression); ok {
-				values = append(values, litExpr.val)
-			} else {
-				// For simplicity, only support literals in INSERT
-				values = append(values, &literalValue{dataType: types.TypeNull})
+				return nil, err
 			}
+			values = append(values, expr)
 		}
-
 		valueGroups = append(valueGroups, values)
 	}
 
-	return valueGroups
+	return valueGroups, nil
+}
+
+// identifierRegex matches a plain SQL identifier
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// ParseExpression parses an expression that calls only the built-in functions
+func ParseExpression(expr string) (Expression, error) {
+	return ParseExpressionWithFunctions(expr, NewFunctionRegistry())
+}
+
+// ParseExpressionWithFunctions parses an expression that may call registered functions
+func ParseExpressionWithFunctions(expr string, functions *FunctionRegistry) (Expression, error) {
+	return (&SimpleParser{functions: functions}).parseExpression(expr)
 }
 
 // parseExpression parses an expression string
-func parseExpression(expr string) (Expression, error) {
-	expr = strings.TrimSpace(expr)
-
-	// Handle basic operators
-	if strings.Contains(expr, "=") {
-		parts := strings.SplitN(expr, "=", 2)
-		if len(parts) == 2 {
-			left, err := parseExpression(parts[0])
-			if err != nil {
-				return nil, err
+func (p *SimpleParser) parseExpression(expr string) (Expression, error) {
+	tp, err := newTokenParser(expr, p.functions)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tp.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !tp.atEnd() {
+		return nil, tp.errorf("unexpected token")
+	}
+	return result, nil
+}
+
+// comparisonOperators maps comparison tokens to the operator names of binaryExpression
+var comparisonOperators = map[string]string{
+	"=":  "=",
+	"!=": "!=",
+	"<>": "!=",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+}
+
+// parseExpr parses an expression
+func (p *tokenParser) parseExpr() (Expression, error) {
+	return p.parseOr()
+}
+
+// parseOr parses a chain of OR operands
+func (p *tokenParser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.matchKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpression{left: left, right: right, operator: "OR"}
+	}
+
+	return left, nil
+}
+
+// parseAnd parses a chain of AND operands
+func (p *tokenParser) parseAnd() (Expression, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.matchKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpression{left: left, right: right, operator: "AND"}
+	}
+
+	return left, nil
+}
+
+// parseNot parses an optionally negated comparison
+func (p *tokenParser) parseNot() (Expression, error) {
+	if p.matchKeyword("NOT") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpression{operand: operand, operator: "NOT"}, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses an operand optionally compared with another or tested
+func (p *tokenParser) parseComparison() (Expression, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if expr, ok, err := p.parsePredicate(left); ok || err != nil {
+		return expr, err
+	}
+
+	tok := p.peek()
+	if tok.typ != tokenOperator {
+		return left, nil
+	}
+	op, ok := comparisonOperators[tok.text]
+	if !ok {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryExpression{left: left, right: right, operator: op}, nil
+}
+
+// predicateKeywords are the keywords that test an operand
+var predicateKeywords = map[string]bool{"IN": true, "LIKE": true, "ILIKE": true, "BETWEEN": true}
+
+// parsePredicate parses the [NOT] IN, LIKE, ILIKE or BETWEEN test of an operand, if any
+func (p *tokenParser) parsePredicate(operand Expression) (Expression, bool, error) {
+	tok := p.peek()
+	if p.isKeyword("NOT") {
+		tok = p.peekAt(1)
+	}
+	keyword := strings.ToUpper(tok.text)
+	if tok.typ != tokenIdent || !predicateKeywords[keyword] {
+		return nil, false, nil
+	}
+	negated := p.matchKeyword("NOT")
+	p.next()
+
+	var expr Expression
+	var err error
+	switch keyword {
+	case "IN":
+		expr, err = p.parseIn(operand)
+	case "BETWEEN":
+		expr, err = p.parseBetween(operand)
+	default:
+		expr, err = p.parseLike(operand, keyword == "ILIKE")
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	if negated {
+		expr = &unaryExpression{operand: expr, operator: "NOT"}
+	}
+	return expr, true, nil
+}
+
+// parseIn parses a subquery or a parenthesized list of values after IN
+func (p *tokenParser) parseIn(operand Expression) (Expression, error) {
+	if p.peekAt(1).typ == tokenIdent && startsQuery(p.peekAt(1).text) {
+		query, text, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return &subqueryExpression{kind: SubqueryIn, query: query, operand: operand, text: text}, nil
+	}
+
+	if _, err := p.expect(tokenLParen, "("); err != nil {
+		return nil, err
+	}
+	list, err := p.parseExpressionList()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenRParen, ")"); err != nil {
+		return nil, err
+	}
+	return &inListExpression{operand: operand, list: list}, nil
+}
+
+// parseBetween parses the bounds after BETWEEN: low AND high
+func (p *tokenParser) parseBetween(operand Expression) (Expression, error) {
+	low, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AND"); err != nil {
+		return nil, err
+	}
+	high, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &betweenExpression{operand: operand, low: low, high: high}, nil
+}
+
+// parseLike parses the pattern after LIKE or ILIKE and an optional ESCAPE character
+func (p *tokenParser) parseLike(operand Expression, caseInsensitive bool) (Expression, error) {
+	pattern, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	expr := &likeExpression{operand: operand, pattern: pattern, caseInsensitive: caseInsensitive}
+	if p.matchKeyword("ESCAPE") {
+		if expr.escape, err = p.parseAdditive(); err != nil {
+			return nil, err
+		}
+	}
+	return expr, nil
+}
+
+// parseAdditive parses a chain of +, - and || operands
+func (p *tokenParser) parseAdditive() (Expression, error) {
+	return p.parseArithmetic(p.parseMultiplicative, "+", "-", "||")
+}
+
+// parseMultiplicative parses a chain of *, / and % operands
+func (p *tokenParser) parseMultiplicative() (Expression, error) {
+	return p.parseArithmetic(p.parseJSONAccess, "*", "/", "%")
+}
+
+// parseJSONAccess parses a chain of -> and ->> operands
+func (p *tokenParser) parseJSONAccess() (Expression, error) {
+	return p.parseArithmetic(p.parseUnary, "->", "->>")
+}
+
+// parseArithmetic parses a left-associative chain of operands joined by the given operators
+func (p *tokenParser) parseArithmetic(operand func() (Expression, error), operators ...string) (Expression, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		found := false
+		for _, op := range operators {
+			found = found || (tok.typ == tokenOperator && tok.text == op)
+		}
+		if !found {
+			return left, nil
+		}
+		p.next()
+
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpression{left: left, right: right, operator: tok.text}
+	}
+}
+
+// parseUnary parses an operand with an optional leading minus sign
+func (p *tokenParser) parseUnary() (Expression, error) {
+	if p.matchOperator("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		// Fold negative numeric literals so they stay literals
+		if lit, ok := operand.(*literalExpression); ok {
+			if negated, err := (&unaryExpression{operand: lit, operator: "-"}).Eval(nil, nil); err == nil {
+				return &literalExpression{val: negated}, nil
 			}
-			right, err := parseExpression(parts[1])
+		}
+		return &unaryExpression{operand: operand, operator: "-"}, nil
+	}
+	return p.parsePostfix()
+}
+
+// parsePostfix parses an operand followed by AT TIME ZONE and COLLATE clauses
+func (p *tokenParser) parsePostfix() (Expression, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	isWord := func(tok token, word string) bool {
+		return tok.typ == tokenIdent && strings.EqualFold(tok.text, word)
+	}
+	for {
+		if p.matchKeyword("COLLATE") {
+			collation, err := p.parseCollation()
 			if err != nil {
 				return nil, err
 			}
-			return &binaryExpression{
-				left:     left,
-				right:    right,
-				operator: "=",
-			}, nil
+			expr = &collateExpression{operand: expr, collation: collation}
+			continue
+		}
+		if !p.isKeyword("AT") || !isWord(p.peekAt(1), "TIME") || !isWord(p.peekAt(2), "ZONE") {
+			return expr, nil
+		}
+		p.pos += 3
+		zone, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		call := &functionExpression{name: "TIMEZONE", args: []Expression{zone, expr}}
+		if err := p.resolveFunction(call); err != nil {
+			return nil, err
 		}
+		expr = call
 	}
+}
+
+// parsePrimary parses a literal, a column reference, a subquery or a parenthesized expression
+func (p *tokenParser) parsePrimary() (Expression, error) {
+	tok := p.peek()
 
-	// Handle literals
-	if isStringLiteral(expr) {
-		// Remove quotes from string literals
+	switch tok.typ {
+	case tokenString:
+		p.next()
 		return &literalExpression{
 			val: &literalValue{
 				dataType:  types.TypeString,
-				stringVal: expr[1 : len(expr)-1],
+				stringVal: tok.text,
 			},
 		}, nil
-	} else if isNumericLiteral(expr) {
-		// Check if it's a float or int
-		if strings.Contains(expr, ".") {
+
+	case tokenBlob:
+		val, err := parseBlobLiteral(tok.text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.next()
+		return &literalExpression{val: val}, nil
+
+	case tokenNumber:
+		p.next()
+		return parseNumber(tok.text)
+
+	case tokenLParen:
+		if p.peekAt(1).typ == tokenIdent && startsQuery(p.peekAt(1).text) {
+			query, text, err := p.parseSubquery()
+			if err != nil {
+				return nil, err
+			}
+			return &subqueryExpression{kind: SubqueryScalar, query: query, text: text}, nil
+		}
+
+		p.next()
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+
+	case tokenIdent:
+		p.next()
+		switch strings.ToUpper(tok.text) {
+		case "NULL":
 			return &literalExpression{
 				val: &literalValue{
-					dataType: types.TypeFloat,
-					floatVal: parseFloat(expr),
+					dataType: types.TypeNull,
 				},
 			}, nil
-		} else {
+		case "TRUE":
 			return &literalExpression{
 				val: &literalValue{
-					dataType: types.TypeInt,
-					intVal:   parseInt(expr),
+					dataType: types.TypeBool,
+					boolVal:  true,
+				},
+			}, nil
+		case "FALSE":
+			return &literalExpression{
+				val: &literalValue{
+					dataType: types.TypeBool,
+					boolVal:  false,
 				},
 			}, nil
 		}
-	} else if strings.EqualFold(expr, "NULL") {
-		return &literalExpression{
-			val: &literalValue{
-				dataType: types.TypeNull,
-			},
-		}, nil
-	} else if strings.EqualFold(expr, "TRUE") {
-		return &literalExpression{
-			val: &literalValue{
-				dataType: types.TypeBool,
-				boolVal:  true,
-			},
-		}, nil
-	} else if strings.EqualFold(expr, "FALSE") {
-		return &literalExpression{
-			val: &literalValue{
-				dataType: types.TypeBool,
-				boolVal:  false,
-			},
+
+		if dataType, ok := lookupDataType(tok.text); ok && (holdsTime(dataType) || dataType == types.TypeDecimal || dataType == types.TypeJSON) {
+			if lit, ok, err := p.parseTypedLiteral(); ok {
+				return lit, err
+			}
+		}
+
+		if strings.EqualFold(tok.text, "CASE") {
+			return p.parseCase()
+		}
+		if p.peek().typ == tokenLParen {
+			switch word := strings.ToUpper(tok.text); word {
+			case "CAST":
+				return p.parseCast()
+			case "COALESCE", "NULLIF":
+				return p.parseConditional(word)
+			case "EXTRACT":
+				if p.peekAt(1).typ == tokenIdent && p.peekAt(2).typ == tokenIdent && strings.EqualFold(p.peekAt(2).text, "FROM") {
+					return p.parseExtract()
+				}
+			}
+		}
+
+		if strings.EqualFold(tok.text, "EXISTS") && p.peek().typ == tokenLParen {
+			query, text, err := p.parseSubquery()
+			if err != nil {
+				return nil, err
+			}
+			return &subqueryExpression{kind: SubqueryExists, query: query, text: text}, nil
+		}
+
+		if reservedWords[strings.ToUpper(tok.text)] {
+			p.pos--
+			return nil, p.errorf("expected an expression")
+		}
+
+		// Function call
+		if p.peek().typ == tokenLParen {
+			return p.parseFunctionCall(tok.text)
+		}
+
+		// Column reference, optionally qualified by a table name
+		if p.peek().typ == tokenDot && p.peekAt(1).typ == tokenIdent {
+			p.next()
+			column := p.next()
+			return &columnExpression{
+				columnName: tok.text + "." + column.text,
+			}, nil
+		}
+
+		return &columnExpression{
+			columnName: tok.text,
 		}, nil
 	}
 
-	// If it's not a literal, assume it's a column reference
-	return &columnExpression{
-		columnName: expr,
-	}, nil
+	return nil, p.errorf("expected an expression")
 }
 
-// isStringLiteral checks if expr is a string literal
-func isStringLiteral(expr string) bool {
-	return (strings.HasPrefix(expr, "'") && strings.HasSuffix(expr, "'")) ||
-		(strings.HasPrefix(expr, "\"") && strings.HasSuffix(expr, "\""))
+// reservedWords are keywords that can not be used as column names
+var reservedWords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "HAVING": true,
+	"ORDER": true, "BY": true, "LIMIT": true, "OFFSET": true, "AS": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "CROSS": true, "OUTER": true,
+	"ON": true, "AND": true, "OR": true, "NOT": true, "ASC": true, "DESC": true,
+	"DISTINCT": true, "IN": true, "EXISTS": true, "UNION": true,
+	"INTERSECT": true, "EXCEPT": true, "ALL": true, "OVER": true,
+	"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "END": true,
+	"LIKE": true, "ILIKE": true, "BETWEEN": true, "COLLATE": true,
 }
 
-// isNumericLiteral checks if expr is a numeric literal
-func isNumericLiteral(expr string) bool {
-	_, err := fmt.Sscanf(expr, "%f", new(float64))
-	return err == nil
+// startsQuery reports whether a word can start a SELECT statement
+func startsQuery(word string) bool {
+	return strings.EqualFold(word, "SELECT") || strings.EqualFold(word, "WITH")
 }
 
-// parseInt converts string to int64
-func parseInt(s string) int64 {
-	var result int64
-	fmt.Sscanf(s, "%d", &result)
-	return result
+// parseSubquery parses a parenthesized SELECT statement and returns it with its text
+func (p *tokenParser) parseSubquery() (SelectStatement, string, error) {
+	open, err := p.expect(tokenLParen, "(")
+	if err != nil {
+		return nil, "", err
+	}
+	if !p.isKeyword("SELECT") && !p.isKeyword("WITH") {
+		return nil, "", p.errorf("expected a subquery")
+	}
+	query, err := p.parseSelect()
+	if err != nil {
+		return nil, "", err
+	}
+	end, err := p.expect(tokenRParen, ")")
+	if err != nil {
+		return nil, "", err
+	}
+	return query, string(p.source[open.pos : end.pos+1]), nil
 }
 
-// parseFloat converts string to float64
-func parseFloat(s string) float64 {
-	var result float64
-	fmt.Sscanf(s, "%f", &result)
-	return result
+// parseCase parses a CASE expression after CASE
+func (p *tokenParser) parseCase() (Expression, error) {
+	expr := &caseExpression{}
+	var err error
+	if !p.isKeyword("WHEN") {
+		if expr.operand, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	for p.matchKeyword("WHEN") {
+		var when WhenClause
+		if when.When, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		if when.Then, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		expr.whens = append(expr.whens, when)
+	}
+	if len(expr.whens) == 0 {
+		return nil, p.errorf("expected WHEN in CASE expression")
+	}
+
+	if p.matchKeyword("ELSE") {
+		if expr.elseExpr, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("END"); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// parseTypedLiteral parses a literal such as DATE '2026-10-16' after the first word of its type
+func (p *tokenParser) parseTypedLiteral() (Expression, bool, error) {
+	start := p.pos
+	p.pos--
+	name, err := p.parseTypeName("type name")
+	if err != nil || p.peek().typ != tokenString {
+		p.pos = start
+		return nil, false, nil
+	}
+
+	dataType, _ := lookupDataType(name)
+	val, err := castText(p.peek().text, dataType)
+	if err != nil {
+		return nil, true, p.errorf("%v", err)
+	}
+	p.next()
+	return &literalExpression{val: val}, true, nil
+}
+
+// parseExtract parses (field FROM expr) after EXTRACT
+func (p *tokenParser) parseExtract() (Expression, error) {
+	p.next()
+	field := p.next()
+	p.next()
+	source, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenRParen, ")"); err != nil {
+		return nil, err
+	}
+
+	call := &functionExpression{name: "EXTRACT", args: []Expression{&literalExpression{val: textValue(strings.ToLower(field.text))}, source}}
+	if err := p.resolveFunction(call); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// parseCast parses (expr AS type) after CAST
+func (p *tokenParser) parseCast() (Expression, error) {
+	if _, err := p.expect(tokenLParen, "("); err != nil {
+		return nil, err
+	}
+	operand, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseTypeName("type name")
+	if err != nil {
+		return nil, err
+	}
+	targetType, ok := lookupDataType(name)
+	if !ok {
+		p.pos--
+		return nil, p.errorf("unknown type %s", name)
+	}
+	params, err := p.parseTypeParams(name, targetType)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenRParen, ")"); err != nil {
+		return nil, err
+	}
+	return &castExpression{operand: operand, targetType: targetType, typeParams: params, char: isCharType(name)}, nil
+}
+
+// parseConditional parses the arguments of COALESCE or NULLIF
+func (p *tokenParser) parseConditional(name string) (Expression, error) {
+	if _, err := p.expect(tokenLParen, "("); err != nil {
+		return nil, err
+	}
+	args, err := p.parseExpressionList()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenRParen, ")"); err != nil {
+		return nil, err
+	}
+
+	if name == "COALESCE" {
+		return &coalesceExpression{args: args}, nil
+	}
+	if len(args) != 2 {
+		return nil, p.errorf("NULLIF takes exactly two arguments")
+	}
+	return &nullIfExpression{left: args[0], right: args[1]}, nil
+}
+
+// parseFunctionCall parses the argument list of a call of the named function
+func (p *tokenParser) parseFunctionCall(name string) (Expression, error) {
+	if _, err := p.expect(tokenLParen, "("); err != nil {
+		return nil, err
+	}
+	call := &functionExpression{name: strings.ToUpper(name)}
+
+	if p.matchOperator("*") {
+		call.star = true
+	} else if p.peek().typ != tokenRParen {
+		call.distinct = p.matchKeyword("DISTINCT")
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+
+			if !p.match(tokenComma) {
+				break
+			}
+		}
+	}
+
+	if _, err := p.expect(tokenRParen, ")"); err != nil {
+		return nil, err
+	}
+	if call.name == sequenceFunction {
+		return sequenceCall(call)
+	}
+	if err := p.resolveFunction(call); err != nil {
+		return nil, err
+	}
+	if p.matchKeyword("OVER") {
+		return p.parseWindow(call)
+	}
+	return call, nil
+}
+
+// sequenceCall checks a nextval() call
+func sequenceCall(call *functionExpression) (Expression, error) {
+	if call.star || call.distinct || len(call.args) != 1 {
+		return nil, fmt.Errorf("function %s takes 1 argument", call.name)
+	}
+	lit, ok := call.args[0].(*literalExpression)
+	if !ok || lit.val.Type() != types.TypeString {
+		return nil, fmt.Errorf("function %s needs the name of a sequence as a string", call.name)
+	}
+	name, _ := lit.val.AsString()
+	return &sequenceExpression{sequence: name}, nil
+}
+
+// resolveFunction looks up the function a call refers to and checks its arguments
+func (p *tokenParser) resolveFunction(call *functionExpression) error {
+	if agg, ok := p.functions.LookupAggregate(call.name); ok {
+		if call.star || len(call.args) != 1 {
+			return fmt.Errorf("function %s takes 1 argument", call.name)
+		}
+		if _, err := agg.Resolve(staticTypes(call.args)[0]); err != nil {
+			return err
+		}
+		call.aggregate = agg
+		return nil
+	}
+
+	fn, ok := p.functions.Lookup(call.name)
+	if !ok {
+		if executorFunctions[call.name] {
+			return nil
+		}
+		return fmt.Errorf("function %s does not exist", call.name)
+	}
+
+	switch {
+	case call.star:
+		return fmt.Errorf("%s(*) is not supported", call.name)
+	case call.distinct:
+		return fmt.Errorf("DISTINCT is only supported for aggregate functions, not %s", call.name)
+	}
+	if _, err := fn.Resolve(staticTypes(call.args)); err != nil {
+		return err
+	}
+	call.scalar = fn
+	return nil
+}
+
+// parseWindow parses the window of a function call after OVER
+func (p *tokenParser) parseWindow(call *functionExpression) (Expression, error) {
+	if _, err := p.expect(tokenLParen, "("); err != nil {
+		return nil, err
+	}
+	window := &windowExpression{function: call}
+
+	var err error
+	if p.matchKeyword("PARTITION") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if window.partitionBy, err = p.parseExpressionList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.matchKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if window.orderBy, err = p.parseOrderBy(); err != nil {
+			return nil, err
+		}
+	}
+	if p.isKeyword("ROWS") || p.isKeyword("RANGE") {
+		if window.frame, err = p.parseFrame(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.expect(tokenRParen, ")"); err != nil {
+		return nil, err
+	}
+	return window, nil
+}
+
+// parseFrame parses the frame clause of a window
+func (p *tokenParser) parseFrame() (*WindowFrame, error) {
+	frame := &WindowFrame{Rows: p.matchKeyword("ROWS")}
+	if !frame.Rows {
+		p.matchKeyword("RANGE")
+	}
+
+	var err error
+	frame.End = FrameBound{Type: FrameCurrentRow}
+	if p.matchKeyword("BETWEEN") {
+		if frame.Start, err = p.parseFrameBound(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		if frame.End, err = p.parseFrameBound(); err != nil {
+			return nil, err
+		}
+	} else if frame.Start, err = p.parseFrameBound(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case frame.Start.Type == FrameUnboundedFollowing:
+		return nil, p.errorf("frame start cannot be UNBOUNDED FOLLOWING")
+	case frame.End.Type == FrameUnboundedPreceding:
+		return nil, p.errorf("frame end cannot be UNBOUNDED PRECEDING")
+	case frame.Start.Type > frame.End.Type:
+		return nil, p.errorf("frame starting from %s cannot end with %s", frame.Start, frame.End)
+	case !frame.Rows && (frame.Start.Type == FramePreceding || frame.Start.Type == FrameFollowing ||
+		frame.End.Type == FramePreceding || frame.End.Type == FrameFollowing):
+		return nil, p.errorf("RANGE frames only support UNBOUNDED and CURRENT ROW bounds")
+	}
+	return frame, nil
+}
+
+// parseFrameBound parses one bound of a window frame
+func (p *tokenParser) parseFrameBound() (FrameBound, error) {
+	if p.matchKeyword("CURRENT") {
+		return FrameBound{Type: FrameCurrentRow}, p.expectKeyword("ROW")
+	}
+
+	var bound FrameBound
+	unbounded := p.matchKeyword("UNBOUNDED")
+	if !unbounded {
+		tok := p.peek()
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if tok.typ != tokenNumber || err != nil || n < 0 {
+			return bound, p.errorf("expected UNBOUNDED, CURRENT ROW or a non-negative row count in frame bound")
+		}
+		p.next()
+		bound.Offset = n
+	}
+	switch {
+	case p.matchKeyword("PRECEDING"):
+		bound.Type = FramePreceding
+		if unbounded {
+			bound.Type = FrameUnboundedPreceding
+		}
+	case p.matchKeyword("FOLLOWING"):
+		bound.Type = FrameFollowing
+		if unbounded {
+			bound.Type = FrameUnboundedFollowing
+		}
+	default:
+		return bound, p.errorf("expected PRECEDING or FOLLOWING in frame bound")
+	}
+	return bound, nil
+}
+
+// parseNumber turns a numeric token into an INT or FLOAT literal
+func parseNumber(text string) (Expression, error) {
+	if !strings.ContainsAny(text, ".eE") {
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return &literalExpression{
+				val: &literalValue{
+					dataType: types.TypeInt,
+					intVal:   i,
+				},
+			}, nil
+		}
+	}
+
+	// Other numbers are FLOATs that keep their digits for a DECIMAL
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number: %s", text)
+	}
+	return &literalExpression{
+		val: &literalValue{
+			dataType: types.TypeFloat,
+			floatVal: f,
+			text:     text,
+		},
+	}, nil
 }
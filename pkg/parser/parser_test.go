@@ -1,6 +1,11 @@
 package parser
 
 import (
+	"bytes"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
@@ -106,6 +111,23 @@ func TestParseInsert(t *testing.T) {
 			sql:     "INSERT users (id, name) VALUES (1, 'Alice');",
 			wantErr: true,
 		},
+		{
+			name:      "Computed values",
+			sql:       "INSERT INTO users (id, name) VALUES (1 + 1, UPPER('bob')), (3, CAST('7' AS TEXT));",
+			wantTable: "users",
+			wantCols:  2,
+			wantRows:  2,
+		},
+		{
+			name:    "Unknown function in VALUES",
+			sql:     "INSERT INTO users (id, name) VALUES (1, FOO(1));",
+			wantErr: true,
+		},
+		{
+			name:    "Empty VALUES list",
+			sql:     "INSERT INTO users (id, name) VALUES (1, 'Alice'), ();",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -144,6 +166,53 @@ func TestParseInsert(t *testing.T) {
 	}
 }
 
+func TestParseUpdate(t *testing.T) {
+	p := NewParser()
+
+	// WHERE inside a subquery or a string does not end the SET clause
+	tests := []struct {
+		sql   string
+		set   map[string]string
+		where string
+	}{
+		{"UPDATE s SET a = 1, b = b + 1", map[string]string{"a": "1", "b": "b + 1"}, "TRUE"},
+		{"UPDATE s SET a = (SELECT b FROM s WHERE id = 1) WHERE id = 2;", map[string]string{"a": "(SELECT b FROM s WHERE id = 1)"}, "id = 2"},
+		{"UPDATE s SET a = 'x WHERE id = 2'", map[string]string{"a": "'x WHERE id = 2'"}, "TRUE"},
+		{"update s set a = 'y, z' where b = 'w'", map[string]string{"a": "'y, z'"}, "b = 'w'"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse(tt.sql)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.sql, err)
+		}
+		update := stmt.(UpdateStatement)
+		if update.TableName() != "s" {
+			t.Errorf("Parse(%s) table = %s, want s", tt.sql, update.TableName())
+		}
+		got := make(map[string]string)
+		for col, expr := range update.SetClauses() {
+			got[col] = fmt.Sprint(expr)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.set) {
+			t.Errorf("Parse(%s) SET = %v, want %v", tt.sql, got, tt.set)
+		}
+		if where := fmt.Sprint(update.WhereClause()); where != tt.where {
+			t.Errorf("Parse(%s) WHERE = %s, want %s", tt.sql, where, tt.where)
+		}
+	}
+
+	for _, sql := range []string{
+		"UPDATE s SET",
+		"UPDATE s SET a 1",
+		"UPDATE s SET a = 1 b = 2",
+		"UPDATE s SET a = 1 WHERE",
+	} {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
 func TestParseSelect(t *testing.T) {
 	p := NewParser()
 
@@ -206,3 +275,1730 @@ func TestParseSelect(t *testing.T) {
 		})
 	}
 }
+
+func TestParseColumnConstraints(t *testing.T) {
+	p := NewParser()
+
+	stmt, err := p.Parse("CREATE TABLE users (id INT PRIMARY KEY, name TEXT NOT NULL, email TEXT UNIQUE NOT NULL, age INT);")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := map[string][]types.Constraint{
+		"id":    {types.ConstraintPrimaryKey},
+		"name":  {types.ConstraintNotNull},
+		"email": {types.ConstraintUnique, types.ConstraintNotNull},
+		"age":   {},
+	}
+
+	for _, col := range stmt.(CreateTableStatement).Columns() {
+		got := col.Constraints()
+		if len(got) != len(want[col.Name()]) {
+			t.Errorf("column %s constraints = %v, want %v", col.Name(), got, want[col.Name()])
+			continue
+		}
+		for i := range got {
+			if got[i] != want[col.Name()][i] {
+				t.Errorf("column %s constraints = %v, want %v", col.Name(), got, want[col.Name()])
+				break
+			}
+		}
+	}
+}
+
+func TestParseTableConstraints(t *testing.T) {
+	p := NewParser()
+
+	stmt, err := p.Parse(`CREATE TABLE orders (
+		id INT, line INT,
+		sku VARCHAR(20) CONSTRAINT orders_sku UNIQUE NOT NULL,
+		qty INT DEFAULT 1 CHECK (qty > 0),
+		price DECIMAL(10, 2) NULL,
+		PRIMARY KEY (id, line),
+		CONSTRAINT cheap CHECK (qty * price < 1000),
+		UNIQUE (sku, line))`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	create := stmt.(CreateTableStatement)
+
+	var columns []string
+	for _, col := range create.Columns() {
+		columns = append(columns, fmt.Sprintf("%s %s %v", col.Name(), TypeName(col.Type(), col.TypeParams()), col.Constraints()))
+	}
+	want := fmt.Sprintf("id %v [] line %v [] sku VARCHAR(20) [%d] qty %v [] price %v(10, 2) []",
+		types.TypeInt, types.TypeInt, types.ConstraintNotNull, types.TypeInt, types.TypeDecimal)
+	if got := strings.Join(columns, " "); got != want {
+		t.Errorf("columns = %s, want %s", got, want)
+	}
+
+	var constraints []string
+	for _, c := range create.Constraints() {
+		constraints = append(constraints, fmt.Sprintf("%s %d %v %v", c.Name, c.Type, c.Columns, c.Check))
+	}
+	want = strings.Join([]string{
+		fmt.Sprintf("orders_sku %d [sku] <nil>", types.ConstraintUnique),
+		fmt.Sprintf(" %d [qty] qty > 0", types.ConstraintCheck),
+		fmt.Sprintf(" %d [id line] <nil>", types.ConstraintPrimaryKey),
+		fmt.Sprintf("cheap %d [qty price] qty * price < 1000", types.ConstraintCheck),
+		fmt.Sprintf(" %d [sku line] <nil>", types.ConstraintUnique),
+	}, "; ")
+	if got := strings.Join(constraints, "; "); got != want {
+		t.Errorf("constraints = %s, want %s", got, want)
+	}
+
+	// A table primary key makes an AUTOINCREMENT column valid
+	stmt, err = p.Parse("CREATE TABLE t (id INT AUTOINCREMENT, PRIMARY KEY (id))")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := stmt.(CreateTableStatement).Columns()[0].Default().(SequenceExpression); !ok {
+		t.Errorf("AUTOINCREMENT with a table primary key has no sequence")
+	}
+
+	stmt, err = p.Parse("ALTER TABLE t ADD COLUMN w INT CONSTRAINT w_positive CHECK (w > 0)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := stmt.(AlterTableStatement).Constraints(); len(got) != 1 || got[0].Name != "w_positive" {
+		t.Errorf("ALTER TABLE ADD COLUMN constraints = %v", got)
+	}
+
+	invalid := []string{
+		"CREATE TABLE t (a INT FOO)",
+		"CREATE TABLE t (a INT CONSTRAINT x NOT NULL)",
+		"CREATE TABLE t (a INT, PRIMARY KEY a)",
+		"CREATE TABLE t (a INT, UNIQUE ())",
+		"CREATE TABLE t (a INT, CHECK a > 0)",
+		"CREATE TABLE t (a INT CHECK (a > (SELECT 1 FROM u)))",
+		"CREATE TABLE t (a INT CHECK (count(a) > 0))",
+		"CREATE TABLE t (a INT CHECK (a > nextval('s')))",
+		"CREATE TABLE t (a INT DEFAULT 1 DEFAULT 2)",
+		"CREATE TABLE t (a INT DEFAULT b)",
+		"CREATE TABLE t (CHECK (1 > 0))",
+		"CREATE TABLE t (id INT AUTOINCREMENT, b INT, PRIMARY KEY (id, b))",
+	}
+	for _, sql := range invalid {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestParseForeignKeys(t *testing.T) {
+	p := NewParser()
+
+	stmt, err := p.Parse(`CREATE TABLE lines (
+		id INT PRIMARY KEY,
+		order_id INT NOT NULL REFERENCES orders ON DELETE CASCADE,
+		sku TEXT CONSTRAINT lines_item REFERENCES items (sku) ON UPDATE SET NULL ON DELETE RESTRICT,
+		a INT, b INT,
+		FOREIGN KEY (a, b) REFERENCES pairs (x, y) ON DELETE NO ACTION)`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	var got []string
+	for _, c := range stmt.(CreateTableStatement).Constraints() {
+		got = append(got, fmt.Sprintf("%s %v %s %v %d %d", c.Name, c.Columns, c.RefTable, c.RefColumns, c.OnDelete, c.OnUpdate))
+	}
+	want := strings.Join([]string{
+		fmt.Sprintf(" [order_id] orders [] %d %d", types.ActionCascade, types.ActionNoAction),
+		fmt.Sprintf("lines_item [sku] items [sku] %d %d", types.ActionRestrict, types.ActionSetNull),
+		fmt.Sprintf(" [a b] pairs [x y] %d %d", types.ActionNoAction, types.ActionNoAction),
+	}, "; ")
+	if strings.Join(got, "; ") != want {
+		t.Errorf("foreign keys = %s, want %s", strings.Join(got, "; "), want)
+	}
+
+	stmt, err = p.Parse("ALTER TABLE lines ADD CONSTRAINT fk FOREIGN KEY (a) REFERENCES pairs (x) ON DELETE SET NULL")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	alter := stmt.(AlterTableStatement)
+	if alter.Action() != types.AlterAddConstraint || len(alter.Constraints()) != 1 ||
+		alter.Constraints()[0].Name != "fk" || alter.Constraints()[0].OnDelete != types.ActionSetNull {
+		t.Errorf("ADD CONSTRAINT = %v %v", alter.Action(), alter.Constraints())
+	}
+	stmt, err = p.Parse("ALTER TABLE lines ADD UNIQUE (a, b)")
+	if err != nil || stmt.(AlterTableStatement).Action() != types.AlterAddConstraint {
+		t.Errorf("ADD UNIQUE = %v, %v", stmt, err)
+	}
+	stmt, err = p.Parse("ALTER TABLE lines DROP CONSTRAINT fk")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if alter := stmt.(AlterTableStatement); alter.Action() != types.AlterDropConstraint || alter.ConstraintName() != "fk" {
+		t.Errorf("DROP CONSTRAINT = %v %s", alter.Action(), alter.ConstraintName())
+	}
+
+	invalid := []string{
+		"CREATE TABLE t (a INT REFERENCES)",
+		"CREATE TABLE t (a INT REFERENCES u ON DELETE)",
+		"CREATE TABLE t (a INT REFERENCES u ON DELETE SET DEFAULT)",
+		"CREATE TABLE t (a INT REFERENCES u ON DELETE CASCADE ON DELETE CASCADE)",
+		"CREATE TABLE t (a INT, FOREIGN KEY a REFERENCES u)",
+		"CREATE TABLE t (a INT, FOREIGN KEY (a) u)",
+		"ALTER TABLE t ADD CONSTRAINT fk",
+		"ALTER TABLE t DROP CONSTRAINT",
+	}
+	for _, sql := range invalid {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestParseWhereExpressions(t *testing.T) {
+	p := NewParser()
+
+	row := map[string]Value{
+		"id":    NewIntValue(5),
+		"name":  NewStringValue("bob"),
+		"score": NewFloatValue(7.5),
+		"note":  NewNullValue(),
+	}
+
+	tests := []struct {
+		where string
+		want  bool
+	}{
+		{"id = 5", true},
+		{"id != 5", false},
+		{"id <> 4", true},
+		{"id < 6", true},
+		{"id <= 5", true},
+		{"id > 5", false},
+		{"id >= 5", true},
+		{"5 = id", true},
+		{"score > 7", true},
+		{"id = '5'", true},
+		{"name = 'bob'", true},
+		{"name < 'carol'", true},
+		{"id > -1", true},
+		{"id > 1 AND name = 'bob'", true},
+		{"id > 10 OR name = 'bob'", true},
+		{"NOT id = 5", false},
+		{"id = 1 OR id = 2 AND name = 'bob'", false},
+		{"(id = 1 OR id = 5) AND name = 'bob'", true},
+		{"note = 1", false},
+		{"NOT note = 1", false},
+		{"note = 1 OR id = 5", true},
+		{"id + 1 = 6", true},
+		{"id - 2 * 2 = 1", true},
+		{"(id - 2) * 2 = 6", true},
+		{"id / 2 = 2 AND id % 2 = 1", true},
+		{"score * 2 = 15", true},
+		{"id / 2.0 = 2.5", true},
+		{"name || '!' = 'bob!'", true},
+		{"note + 1 = 1", false},
+		// Strings compared with numbers must hold the whole number
+		{"id = ' 5 '", true},
+		{"id = '5.0'", true},
+		{"id = '5abc'", false},
+		{"id != '5abc'", true},
+		{"score < '7.6'", true},
+		{"CASE WHEN id > 3 THEN 'big' ELSE 'small' END = 'big'", true},
+		{"CASE name WHEN 'ann' THEN 1 WHEN 'bob' THEN 2 END = 2", true},
+		{"CASE note WHEN NULL THEN 1 ELSE 0 END = 0", true},
+		{"CASE WHEN note = 1 THEN TRUE END", false},
+		{"COALESCE(note, score, id) = 7.5", true},
+		{"NULLIF(id, 5) = 5", false},
+		{"NULLIF(id, 4) = 5", true},
+		{"CAST(score AS INT) = 8", true},
+		{"CAST(id AS TEXT) || 'x' = '5x'", true},
+		{"CAST('on' AS BOOLEAN)", true},
+		{"name LIKE 'b%'", true},
+		{"name LIKE 'B%'", false},
+		{"name ILIKE 'B%'", true},
+		{"name LIKE '_o_'", true},
+		{"name LIKE '%o'", false},
+		{"name NOT LIKE '%x%'", true},
+		{"'50%' LIKE '50#%' ESCAPE '#'", true},
+		{"'500' LIKE '50#%' ESCAPE '#'", false},
+		{"note LIKE '%'", false},
+		{"NOT note LIKE '%'", false},
+		{"id IN (1, 5)", true},
+		{"id IN (1.0, 5.0)", true},
+		{"id NOT IN (1, 2)", true},
+		{"id IN (1, NULL)", false},
+		{"id NOT IN (1, NULL)", false},
+		{"id IN (5, NULL)", true},
+		{"id BETWEEN 1 AND 5", true},
+		{"id BETWEEN 6 AND 10", false},
+		{"id NOT BETWEEN 6 AND 10", true},
+		{"score BETWEEN id + 2 AND id * 2", true},
+		{"id BETWEEN note AND 4", false},
+		{"NOT id BETWEEN note AND 4", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			stmt, err := p.Parse("SELECT * FROM users WHERE " + tt.where)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			result, err := stmt.(SelectStatement).WhereClause().Eval(nil, row)
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+
+			got := false
+			if isNull, _ := result.AsNull(); !isNull {
+				got, _ = result.AsBool()
+			}
+			if got != tt.want {
+				t.Errorf("WHERE %s = %v, want %v", tt.where, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := p.Parse("SELECT * FROM users WHERE id = = 1"); err == nil {
+		t.Errorf("Parse() with malformed WHERE error = nil, want error")
+	}
+
+	for _, where := range []string{"id / 0 = 1", "name + 1 = 1", "CAST(name AS INT) = 1", "CASE WHEN name THEN 1 END = 1"} {
+		stmt, err := p.Parse("SELECT * FROM users WHERE " + where)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if _, err := stmt.(SelectStatement).WhereClause().Eval(nil, row); err == nil {
+			t.Errorf("Eval() of %s error = nil, want error", where)
+		}
+	}
+
+	// INT arithmetic does not wrap around
+	for _, where := range []string{
+		"id + 9223372036854775807 = 1",
+		"0 - 9223372036854775807 - id = 1",
+		"id * 4611686018427387904 = 1",
+		"(0 - 9223372036854775807 - 1) * (0 - 1) = 1",
+		"(0 - 9223372036854775807 - 1) / (0 - 1) = 1",
+	} {
+		stmt, err := p.Parse("SELECT * FROM users WHERE " + where)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if _, err := stmt.(SelectStatement).WhereClause().Eval(nil, row); err == nil || !strings.Contains(err.Error(), "integer out of range") {
+			t.Errorf("Eval() of %s error = %v, want integer out of range", where, err)
+		}
+	}
+}
+
+func TestParseIndexStatements(t *testing.T) {
+	p := NewParser()
+
+	stmt, err := p.Parse("CREATE UNIQUE INDEX users_name_age ON users (name, age);")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	createStmt, ok := stmt.(CreateIndexStatement)
+	if !ok {
+		t.Fatalf("Parse() returned %T, want CreateIndexStatement", stmt)
+	}
+	if createStmt.IndexName() != "users_name_age" || createStmt.TableName() != "users" || !createStmt.Unique() {
+		t.Errorf("CREATE INDEX parsed as %s on %s (unique %v)", createStmt.IndexName(), createStmt.TableName(), createStmt.Unique())
+	}
+	if cols := createStmt.Columns(); len(cols) != 2 || cols[0] != "name" || cols[1] != "age" {
+		t.Errorf("Columns() = %v, want [name age]", cols)
+	}
+
+	stmt, err = p.Parse("CREATE INDEX users_age ON users (age)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if stmt.(CreateIndexStatement).Unique() {
+		t.Errorf("Unique() = true for a plain index")
+	}
+
+	stmt, err = p.Parse("DROP INDEX users_age;")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if stmt.Type() != types.StmtDropIndex || stmt.(DropIndexStatement).IndexName() != "users_age" {
+		t.Errorf("DROP INDEX parsed incorrectly")
+	}
+
+	if _, err := p.Parse("CREATE INDEX ON users (age)"); err == nil {
+		t.Errorf("Parse() without index name error = nil, want error")
+	}
+
+	// Key parts can be expressions computed from the columns
+	stmt, err = p.Parse("CREATE INDEX docs_status ON docs (id, (doc->>'status'), (name))")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	createStmt = stmt.(CreateIndexStatement)
+	if cols := createStmt.Columns(); !slices.Equal(cols, []string{"id", "doc ->> 'status'", "name"}) {
+		t.Errorf("Columns() = %q", cols)
+	}
+	if exprs := createStmt.Expressions(); len(exprs) != 3 || exprs[0] != nil || fmt.Sprint(exprs[1]) != "doc ->> 'status'" || exprs[2] != nil {
+		t.Errorf("Expressions() = %v", exprs)
+	}
+	for _, sql := range []string{
+		"CREATE INDEX i ON docs ((random()))",
+		"CREATE INDEX i ON docs ((1 + 2))",
+		"CREATE INDEX i ON docs ((SELECT 1))",
+		"CREATE INDEX i ON docs ((doc->>))",
+	} {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestParseAlterTable(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		sql        string
+		action     types.AlterAction
+		columnName string
+		newName    string
+	}{
+		{"ALTER TABLE users ADD COLUMN city TEXT NOT NULL DEFAULT 'New York'", types.AlterAddColumn, "city", ""},
+		{"alter table users add age INT;", types.AlterAddColumn, "age", ""},
+		{"ALTER TABLE users DROP COLUMN city", types.AlterDropColumn, "city", ""},
+		{"ALTER TABLE users DROP city", types.AlterDropColumn, "city", ""},
+		{"ALTER TABLE users RENAME COLUMN city TO town", types.AlterRenameColumn, "city", "town"},
+		{"ALTER TABLE users RENAME city TO town", types.AlterRenameColumn, "city", "town"},
+		{"ALTER TABLE users RENAME TO people", types.AlterRenameTable, "", "people"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse(tt.sql)
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", tt.sql, err)
+			continue
+		}
+		alter, ok := stmt.(AlterTableStatement)
+		if !ok || stmt.Type() != types.StmtAlterTable {
+			t.Errorf("Parse(%s) returned %T, want AlterTableStatement", tt.sql, stmt)
+			continue
+		}
+		columnName := alter.ColumnName()
+		if alter.Action() == types.AlterAddColumn {
+			columnName = alter.Column().Name()
+		}
+		if alter.TableName() != "users" || alter.Action() != tt.action || columnName != tt.columnName || alter.NewName() != tt.newName {
+			t.Errorf("Parse(%s) = %s %v %s %s", tt.sql, alter.TableName(), alter.Action(), columnName, alter.NewName())
+		}
+	}
+
+	stmt, _ := p.Parse("ALTER TABLE users ADD COLUMN city TEXT NOT NULL DEFAULT 'New York'")
+	col := stmt.(AlterTableStatement).Column()
+	if col.Type() != types.TypeString || len(col.Constraints()) != 1 || col.Constraints()[0] != types.ConstraintNotNull {
+		t.Errorf("added column = %v %v, want TEXT NOT NULL", col.Type(), col.Constraints())
+	}
+	if def := col.Default(); fmt.Sprint(def) != "'New York'" {
+		t.Errorf("Default() = %v, want 'New York'", def)
+	}
+
+	// Defaults are constants of the column type; an INT is taken for a FLOAT
+	stmt, err := p.Parse("CREATE TABLE t (a INT DEFAULT -1 NOT NULL, b FLOAT DEFAULT 2, c TEXT DEFAULT NULL, d BOOL)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	columns := stmt.(CreateTableStatement).Columns()
+	var defaults []string
+	for _, col := range columns {
+		defaults = append(defaults, fmt.Sprint(col.Default()))
+	}
+	if got := strings.Join(defaults, ","); got != "-1,2,NULL,<nil>" {
+		t.Errorf("defaults = %s, want -1,2,NULL,<nil>", got)
+	}
+	if def := columns[1].Default().(LiteralExpression).Value(); def.Type() != types.TypeFloat || len(columns[0].Constraints()) != 1 {
+		t.Errorf("column a = %v, b default type = %v", columns[0].Constraints(), def.Type())
+	}
+
+	invalid := []string{
+		"ALTER TABLE users",
+		"ALTER TABLE users ADD COLUMN",
+		"ALTER TABLE users RENAME COLUMN city",
+		"ALTER TABLE users ADD COLUMN n INT DEFAULT 'x'",
+		"ALTER TABLE users ADD COLUMN n INT DEFAULT id",
+		"CREATE TABLE t (a INT DEFAULT)",
+	}
+	for _, sql := range invalid {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestParseExplain(t *testing.T) {
+	p := NewParser()
+
+	stmt, err := p.Parse("EXPLAIN SELECT * FROM users WHERE id = 1;")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	explainStmt, ok := stmt.(ExplainStatement)
+	if !ok {
+		t.Fatalf("Parse() returned %T, want ExplainStatement", stmt)
+	}
+	if explainStmt.Analyze() {
+		t.Errorf("Analyze() = true for plain EXPLAIN")
+	}
+	if explainStmt.Statement().Type() != types.StmtSelect {
+		t.Errorf("Statement().Type() = %v, want %v", explainStmt.Statement().Type(), types.StmtSelect)
+	}
+
+	stmt, err = p.Parse("explain analyze DELETE FROM users WHERE age > 30")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	explainStmt = stmt.(ExplainStatement)
+	if !explainStmt.Analyze() || explainStmt.Statement().Type() != types.StmtDelete {
+		t.Errorf("EXPLAIN ANALYZE DELETE parsed incorrectly")
+	}
+
+	if _, err := p.Parse("EXPLAIN DROP TABLE users"); err == nil {
+		t.Errorf("Parse() of EXPLAIN DROP TABLE error = nil, want error")
+	}
+}
+
+func TestParseAnalyze(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		sql   string
+		table string
+	}{
+		{"ANALYZE", ""},
+		{"analyze users;", "users"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse(tt.sql)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.sql, err)
+		}
+		analyzeStmt, ok := stmt.(AnalyzeStatement)
+		if !ok {
+			t.Fatalf("Parse(%s) returned %T, want AnalyzeStatement", tt.sql, stmt)
+		}
+		if analyzeStmt.TableName() != tt.table {
+			t.Errorf("Parse(%s) TableName() = %q, want %q", tt.sql, analyzeStmt.TableName(), tt.table)
+		}
+	}
+
+	if _, err := p.Parse("ANALYZE users orders"); err == nil {
+		t.Errorf("Parse() of ANALYZE with two tables error = nil, want error")
+	}
+}
+
+func TestExpressionString(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		where string
+		want  string
+	}{
+		{"id=1", "id = 1"},
+		{"name <> 'O''Brien'", "name != 'O''Brien'"},
+		{"(a = 1 OR b = 2) AND c >= -1.5", "(a = 1 OR b = 2) AND c >= -1.5"},
+		{"a = 1 OR b = 2 AND c = 3", "a = 1 OR b = 2 AND c = 3"},
+		{"NOT (a = TRUE)", "NOT (a = TRUE)"},
+		{"a+b*c = (a+b)*c", "a + b * c = (a + b) * c"},
+		{"a - (b - c) = a - b - c", "a - (b - c) = a - b - c"},
+	}
+
+	for _, tt := range tests {
+		stmt, err := p.Parse("SELECT * FROM t WHERE " + tt.where)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.where, err)
+		}
+
+		got := fmt.Sprint(stmt.(SelectStatement).WhereClause())
+		if got != tt.want {
+			t.Errorf("String() of %s = %q, want %q", tt.where, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelectClauses(t *testing.T) {
+	p := NewParser()
+
+	sql := `SELECT u.city, COUNT(*) AS n, SUM(DISTINCT o.amount) total
+		FROM users u
+		JOIN orders o ON o.user_id = u.id
+		LEFT OUTER JOIN items ON items.order_id = o.id
+		CROSS JOIN tags
+		WHERE u.age >= 18
+		GROUP BY u.city
+		HAVING COUNT(*) > 1
+		ORDER BY n DESC, u.city
+		LIMIT 10 OFFSET 5;`
+	stmt, err := p.Parse(sql)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	selectStmt := stmt.(SelectStatement)
+
+	if selectStmt.TableName() != "users" || selectStmt.TableAlias() != "u" {
+		t.Errorf("FROM = %s %s, want users u", selectStmt.TableName(), selectStmt.TableAlias())
+	}
+
+	wantColumns := []string{"u.city", "n", "total"}
+	if got := selectStmt.Columns(); fmt.Sprint(got) != fmt.Sprint(wantColumns) {
+		t.Errorf("Columns() = %v, want %v", got, wantColumns)
+	}
+	items := selectStmt.Items()
+	if got := fmt.Sprint(items[2].Expr); got != "SUM(DISTINCT o.amount)" {
+		t.Errorf("third item = %s", got)
+	}
+	if call, ok := items[1].Expr.(FunctionExpression); !ok || call.Name() != "COUNT" || !call.Star() {
+		t.Errorf("second item = %v, want COUNT(*)", items[1].Expr)
+	}
+
+	joins := selectStmt.Joins()
+	if len(joins) != 3 {
+		t.Fatalf("len(Joins()) = %d, want 3", len(joins))
+	}
+	wantJoins := []struct {
+		joinType types.JoinType
+		table    string
+		alias    string
+	}{
+		{types.JoinInner, "orders", "o"},
+		{types.JoinLeft, "items", ""},
+		{types.JoinCross, "tags", ""},
+	}
+	for i, want := range wantJoins {
+		if joins[i].Type != want.joinType || joins[i].Table != want.table || joins[i].Alias != want.alias {
+			t.Errorf("join %d = %+v, want %+v", i, joins[i], want)
+		}
+	}
+	if joins[2].Condition != nil {
+		t.Errorf("CROSS JOIN has a condition")
+	}
+
+	if got := fmt.Sprint(selectStmt.WhereClause()); got != "u.age >= 18" {
+		t.Errorf("WhereClause() = %s", got)
+	}
+	if groupBy := selectStmt.GroupBy(); len(groupBy) != 1 || fmt.Sprint(groupBy[0]) != "u.city" {
+		t.Errorf("GroupBy() = %v", groupBy)
+	}
+	if got := fmt.Sprint(selectStmt.Having()); got != "COUNT(*) > 1" {
+		t.Errorf("Having() = %s", got)
+	}
+	orderBy := selectStmt.OrderBy()
+	if len(orderBy) != 2 || !orderBy[0].Descending || orderBy[1].Descending {
+		t.Errorf("OrderBy() = %v", orderBy)
+	}
+	if limit, ok := selectStmt.Limit(); !ok || limit != 10 || selectStmt.Offset() != 5 {
+		t.Errorf("Limit() = %d, %v; Offset() = %d", limit, ok, selectStmt.Offset())
+	}
+
+	invalid := []string{
+		"SELECT * FROM users LIMIT -1",
+		"SELECT * FROM users ORDER name",
+		"SELECT * FROM users JOIN orders",
+		"SELECT * FROM users RIGHT JOIN orders ON orders.user_id = users.id",
+		"SELECT * FROM users u FULL OUTER JOIN orders o ON o.user_id = u.id",
+		"SELECT * FROM users WHERE",
+		"SELECT id FROM users extra tokens",
+		"SELECT COUNT( FROM users",
+	}
+	for _, sql := range invalid {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestParseSubqueries(t *testing.T) {
+	p := NewParser()
+
+	sql := `SELECT name, (SELECT COUNT(*) FROM orders o WHERE o.user_id = u.id) AS n
+		FROM users u
+		WHERE id NOT IN (SELECT user_id FROM banned) AND EXISTS (SELECT * FROM orders WHERE total > 10)`
+	stmt, err := p.Parse(sql)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	selectStmt := stmt.(SelectStatement)
+
+	scalar, ok := selectStmt.Items()[1].Expr.(SubqueryExpression)
+	if !ok || scalar.Kind() != SubqueryScalar || scalar.Query().TableName() != "orders" {
+		t.Fatalf("second item = %v, want a scalar subquery over orders", selectStmt.Items()[1].Expr)
+	}
+	if got := fmt.Sprint(scalar.Query().WhereClause()); got != "o.user_id = u.id" {
+		t.Errorf("subquery WHERE = %s", got)
+	}
+
+	where := selectStmt.WhereClause().(BinaryExpression)
+	not, ok := where.Left().(UnaryExpression)
+	if !ok || not.Operator() != "NOT" {
+		t.Fatalf("left term = %v, want NOT IN", where.Left())
+	}
+	in, ok := not.Operand().(SubqueryExpression)
+	if !ok || in.Kind() != SubqueryIn || fmt.Sprint(in.Operand()) != "id" || in.Query().TableName() != "banned" {
+		t.Errorf("NOT operand = %v, want id IN subquery over banned", not.Operand())
+	}
+	if exists, ok := where.Right().(SubqueryExpression); !ok || exists.Kind() != SubqueryExists {
+		t.Errorf("right term = %v, want EXISTS", where.Right())
+	}
+
+	want := "NOT id IN (SELECT user_id FROM banned) AND EXISTS (SELECT * FROM orders WHERE total > 10)"
+	if got := fmt.Sprint(where); got != want {
+		t.Errorf("WhereClause() = %q, want %q", got, want)
+	}
+
+	// Subqueries can only be run by the executor
+	if _, err := scalar.Eval(nil, nil); err == nil {
+		t.Errorf("Eval() without a context error = nil, want error")
+	}
+
+	invalid := []string{
+		"SELECT * FROM users WHERE id IN (SELECT user_id FROM orders",
+		"SELECT * FROM users WHERE EXISTS (SELECT * FROM orders",
+		"SELECT * FROM users WHERE id IN SELECT user_id FROM orders",
+	}
+	for _, sql := range invalid {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestParseWith(t *testing.T) {
+	p := NewParser()
+
+	sql := `WITH big AS (SELECT * FROM orders WHERE total > 100),
+		totals (user_id, sum) AS (SELECT user_id, SUM(total) FROM big GROUP BY user_id)
+		SELECT * FROM totals`
+	stmt, err := p.Parse(sql)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	with := stmt.(SelectStatement).With()
+	if len(with) != 2 {
+		t.Fatalf("With() has %d CTEs, want 2", len(with))
+	}
+	if with[0].Name != "big" || with[0].Query.TableName() != "orders" || with[0].Columns != nil || with[0].Recursive != nil {
+		t.Errorf("first CTE = %+v", with[0])
+	}
+	if with[1].Name != "totals" || strings.Join(with[1].Columns, ",") != "user_id,sum" || with[1].Query.TableName() != "big" {
+		t.Errorf("second CTE = %+v", with[1])
+	}
+
+	sql = `WITH RECURSIVE tree (id, depth) AS (
+			SELECT id, 0 FROM nodes WHERE parent = 0
+			UNION ALL
+			SELECT n.id, t.depth + 1 FROM nodes n JOIN tree t ON n.parent = t.id
+		) SELECT * FROM tree`
+	stmt, err = p.Parse(sql)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	tree := stmt.(SelectStatement).With()[0]
+	if tree.Query.TableName() != "nodes" || tree.Recursive == nil || !tree.UnionAll {
+		t.Fatalf("recursive CTE = %+v", tree)
+	}
+	if join := tree.Recursive.Joins(); len(join) != 1 || join[0].Table != "tree" {
+		t.Errorf("recursive term joins = %+v, want a join with tree", join)
+	}
+
+	// WITH also works in subqueries
+	stmt, err = p.Parse("SELECT * FROM users WHERE id IN (WITH o AS (SELECT * FROM orders) SELECT user_id FROM o)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	in := stmt.(SelectStatement).WhereClause().(SubqueryExpression)
+	if with := in.Query().With(); len(with) != 1 || with[0].Name != "o" {
+		t.Errorf("subquery With() = %+v", with)
+	}
+
+	invalid := []string{
+		"WITH SELECT * FROM users",
+		"WITH a AS SELECT * FROM users SELECT * FROM a",
+		"WITH a AS (SELECT * FROM users) SELECT * FROM a, b AS (SELECT * FROM a)",
+		"WITH a AS (SELECT * FROM users), a AS (SELECT * FROM orders) SELECT * FROM a",
+		"WITH RECURSIVE a AS (SELECT * FROM users UNION) SELECT * FROM a",
+	}
+	for _, sql := range invalid {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestParseSetOperations(t *testing.T) {
+	p := NewParser()
+
+	// INTERSECT binds more tightly than UNION and EXCEPT, which are
+	// left-associative; ORDER BY and LIMIT apply to the whole query
+	sql := `SELECT id FROM a UNION ALL SELECT id FROM b INTERSECT SELECT id FROM c
+		EXCEPT SELECT id FROM d ORDER BY id DESC LIMIT 3`
+	stmt, err := p.Parse(sql)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	except, ok := stmt.(CompoundSelectStatement)
+	if !ok || except.Operator() != "EXCEPT" || except.All() || except.Right().TableName() != "d" {
+		t.Fatalf("top = %+v, want EXCEPT with d", stmt)
+	}
+	if limit, ok := except.Limit(); !ok || limit != 3 || len(except.OrderBy()) != 1 || !except.OrderBy()[0].Descending {
+		t.Errorf("ORDER BY and LIMIT of the whole query are missing")
+	}
+	union, ok := except.Left().(CompoundSelectStatement)
+	if !ok || union.Operator() != "UNION" || !union.All() || union.Left().TableName() != "a" {
+		t.Fatalf("left of EXCEPT = %+v, want UNION ALL with a", except.Left())
+	}
+	intersect, ok := union.Right().(CompoundSelectStatement)
+	if !ok || intersect.Operator() != "INTERSECT" || intersect.Left().TableName() != "b" || intersect.Right().TableName() != "c" {
+		t.Errorf("right of UNION = %+v, want b INTERSECT c", union.Right())
+	}
+	if len(union.Left().OrderBy()) != 0 {
+		t.Errorf("ORDER BY was parsed as part of the first query")
+	}
+	if got := strings.Join(except.Columns(), ","); got != "id" {
+		t.Errorf("Columns() = %s, want id", got)
+	}
+
+	// Parentheses group queries and hold their own ORDER BY and LIMIT
+	stmt, err = p.Parse("(SELECT id FROM a ORDER BY id LIMIT 1) UNION DISTINCT (SELECT id FROM b UNION SELECT id FROM c)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	grouped := stmt.(CompoundSelectStatement)
+	if _, ok := grouped.Left().Limit(); !ok || grouped.All() {
+		t.Errorf("left query lost its LIMIT")
+	}
+	if _, ok := grouped.Right().(CompoundSelectStatement); !ok {
+		t.Errorf("right query = %+v, want a compound query", grouped.Right())
+	}
+
+	// Compound queries work as subqueries and CTEs
+	stmt, err = p.Parse("SELECT * FROM users WHERE id IN (SELECT id FROM a EXCEPT SELECT id FROM b)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := stmt.(SelectStatement).WhereClause().(SubqueryExpression).Query().(CompoundSelectStatement); !ok {
+		t.Errorf("IN subquery is not a compound query")
+	}
+	stmt, err = p.Parse("WITH RECURSIVE r (n) AS (SELECT 1 FROM a UNION SELECT 2 FROM b UNION ALL SELECT n FROM r) SELECT * FROM r")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if r := stmt.(SelectStatement).With()[0]; !r.UnionAll || r.Recursive.TableName() != "r" {
+		t.Errorf("recursive CTE = %+v, want the last query as its recursive term", r)
+	} else if _, ok := r.Query.(CompoundSelectStatement); !ok {
+		t.Errorf("first query of recursive CTE = %+v, want a UNION", r.Query)
+	}
+
+	invalid := []string{
+		"SELECT id FROM a UNION",
+		"SELECT id FROM a ORDER BY id UNION SELECT id FROM b",
+		"SELECT id FROM a UNION ALL ALL SELECT id FROM b",
+		"(SELECT id FROM a ORDER BY id) ORDER BY id",
+		"(SELECT id FROM a",
+	}
+	for _, sql := range invalid {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestParseDistinct(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		sql        string
+		distinct   bool
+		distinctOn string
+		columns    string
+	}{
+		{"SELECT name FROM users", false, "", "name"},
+		{"SELECT ALL name FROM users", false, "", "name"},
+		{"SELECT DISTINCT name, age FROM users", true, "", "name,age"},
+		{"select distinct on (name, age + 1) name, id FROM users ORDER BY name", true, "name,age + 1", "name,id"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse(tt.sql)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.sql, err)
+		}
+		selectStmt := stmt.(SelectStatement)
+		var on []string
+		for _, expr := range selectStmt.DistinctOn() {
+			on = append(on, fmt.Sprint(expr))
+		}
+		if selectStmt.Distinct() != tt.distinct || strings.Join(on, ",") != tt.distinctOn {
+			t.Errorf("Parse(%s) distinct = %v on %v, want %v on %s", tt.sql, selectStmt.Distinct(), on, tt.distinct, tt.distinctOn)
+		}
+		if got := strings.Join(selectStmt.Columns(), ","); got != tt.columns {
+			t.Errorf("Parse(%s) columns = %s, want %s", tt.sql, got, tt.columns)
+		}
+	}
+
+	invalid := []string{
+		"SELECT DISTINCT FROM users",
+		"SELECT DISTINCT ON name FROM users",
+		"SELECT DISTINCT ON () name FROM users",
+		"SELECT ALL DISTINCT name FROM users",
+	}
+	for _, sql := range invalid {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestValueEqual(t *testing.T) {
+	tests := []struct {
+		a, b Value
+		want bool
+	}{
+		{NewIntValue(1), NewIntValue(1), true},
+		{NewIntValue(1), NewFloatValue(1.0), true},
+		{NewFloatValue(0), NewFloatValue(math.Copysign(0, -1)), true},
+		{NewIntValue(1), NewFloatValue(1.5), false},
+		{NewIntValue(1), NewStringValue("1"), false},
+		{NewIntValue(1), NewBoolValue(true), false},
+		{NewNullValue(), nil, true},
+		{NewNullValue(), NewStringValue("NULL"), false},
+		{NewStringValue("a"), NewStringValue("a"), true},
+		{NewStringValue("a"), NewStringValue("A"), false},
+	}
+	for _, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.want {
+			t.Errorf("Equal(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	// Separators inside strings do not make different tuples alike
+	a := HashKey([]Value{NewStringValue("a;s1:b"), NewStringValue("c")})
+	b := HashKey([]Value{NewStringValue("a"), NewStringValue("b;s1:c")})
+	if a == b {
+		t.Errorf("HashKey() gave different tuples the same key %q", a)
+	}
+}
+
+func TestParseWindowFunctions(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT ROW_NUMBER() OVER () FROM t", "ROW_NUMBER() OVER ()"},
+		{"SELECT rank() over (partition by a, b order by c desc) FROM t",
+			"RANK() OVER (PARTITION BY a, b ORDER BY c DESC)"},
+		{"SELECT SUM(x) OVER (ORDER BY id ROWS BETWEEN 2 PRECEDING AND 1 FOLLOWING) FROM t",
+			"SUM(x) OVER (ORDER BY id ROWS BETWEEN 2 PRECEDING AND 1 FOLLOWING)"},
+		{"SELECT COUNT(*) OVER (ORDER BY id ROWS UNBOUNDED PRECEDING) FROM t",
+			"COUNT(*) OVER (ORDER BY id ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW)"},
+		{"SELECT MAX(x) OVER (RANGE BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING) FROM t",
+			"MAX(x) OVER (RANGE BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING)"},
+		{"SELECT LAG(x, 2, 0) OVER (ORDER BY id) + 1 FROM t", "LAG(x, 2, 0) OVER (ORDER BY id) + 1"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse(tt.sql)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.sql, err)
+		}
+		if got := fmt.Sprint(stmt.(SelectStatement).Items()[0].Expr); got != tt.want {
+			t.Errorf("Parse(%s) = %s, want %s", tt.sql, got, tt.want)
+		}
+	}
+
+	stmt, err := p.Parse("SELECT SUM(x) OVER (PARTITION BY g ORDER BY id ROWS BETWEEN 3 PRECEDING AND CURRENT ROW) AS s FROM t")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	window, ok := stmt.(SelectStatement).Items()[0].Expr.(WindowExpression)
+	if !ok {
+		t.Fatalf("select item is not a window expression")
+	}
+	frame := window.Frame()
+	if window.Function().Name() != "SUM" || len(window.PartitionBy()) != 1 || len(window.OrderBy()) != 1 ||
+		frame == nil || !frame.Rows || frame.Start != (FrameBound{Type: FramePreceding, Offset: 3}) || frame.End.Type != FrameCurrentRow {
+		t.Errorf("window = %v, want SUM over g by id from 3 rows before", window)
+	}
+	if _, err := window.Eval(nil, map[string]Value{}); err == nil {
+		t.Errorf("Eval() of a window function outside a window succeeded")
+	}
+
+	invalid := []string{
+		"SELECT SUM(x) OVER FROM t",
+		"SELECT SUM(x) OVER (ORDER BY id ROWS) FROM t",
+		"SELECT SUM(x) OVER (ROWS BETWEEN UNBOUNDED FOLLOWING AND CURRENT ROW) FROM t",
+		"SELECT SUM(x) OVER (ROWS BETWEEN CURRENT ROW AND UNBOUNDED PRECEDING) FROM t",
+		"SELECT SUM(x) OVER (ROWS BETWEEN 1 FOLLOWING AND 1 PRECEDING) FROM t",
+		"SELECT SUM(x) OVER (ROWS BETWEEN -1 PRECEDING AND CURRENT ROW) FROM t",
+		"SELECT SUM(x) OVER (RANGE 1 PRECEDING) FROM t",
+		"SELECT SUM(x) OVER (ORDER BY id PARTITION BY g) FROM t",
+	}
+	for _, sql := range invalid {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestParseConditionalExpressions(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"case when a > 1 then 'x' when a > 0 then 'y' else 'z' end", "CASE WHEN a > 1 THEN 'x' WHEN a > 0 THEN 'y' ELSE 'z' END"},
+		{"CASE a + 1 WHEN 2 THEN b END", "CASE a + 1 WHEN 2 THEN b END"},
+		{"coalesce(a, b, 0)", "COALESCE(a, b, 0)"},
+		{"NULLIF(a, '')", "NULLIF(a, '')"},
+		{"cast(a as integer) + 1", "CAST(a AS INT) + 1"},
+		{"CAST(CASE WHEN a THEN 1 END AS TEXT)", "CAST(CASE WHEN a THEN 1 END AS TEXT)"},
+		{"a like 'x%' escape '!'", "a LIKE 'x%' ESCAPE '!'"},
+		{"a || b ilike c", "a || b ILIKE c"},
+		{"a not in (1, b + 1)", "NOT a IN (1, b + 1)"},
+		{"a between 1 and b and c", "a BETWEEN 1 AND b AND c"},
+		{"(a = b) IN (TRUE)", "(a = b) IN (TRUE)"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse("SELECT " + tt.expr + " FROM t")
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tt.expr, err)
+		}
+		if got := fmt.Sprint(stmt.(SelectStatement).Items()[0].Expr); got != tt.want {
+			t.Errorf("Parse(%s) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	invalid := []string{
+		"CASE a END",
+		"CASE WHEN a THEN 1",
+		"CASE WHEN a 1 END",
+		"COALESCE()",
+		"NULLIF(a)",
+		"NULLIF(a, b, c)",
+		"CAST(a AS GEOMETRY)",
+		"CAST(a INT)",
+		"a IN ()",
+		"a IN 1, 2",
+		"a BETWEEN 1",
+		"a BETWEEN 1 OR 2",
+		"a NOT 1",
+		"a LIKE",
+	}
+	for _, expr := range invalid {
+		if _, err := p.Parse("SELECT " + expr + " FROM t"); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", expr)
+		}
+	}
+}
+
+func TestCast(t *testing.T) {
+	tests := []struct {
+		val  Value
+		to   types.DataType
+		want string
+	}{
+		{NewIntValue(3), types.TypeFloat, "3"},
+		{NewIntValue(-12), types.TypeString, "'-12'"},
+		{NewIntValue(0), types.TypeBool, "FALSE"},
+		{NewIntValue(7), types.TypeBool, "TRUE"},
+		{NewFloatValue(2.5), types.TypeInt, "3"},
+		{NewFloatValue(-2.5), types.TypeInt, "-3"},
+		{NewFloatValue(2.4), types.TypeInt, "2"},
+		{NewFloatValue(0.1), types.TypeString, "'0.1'"},
+		{NewBoolValue(true), types.TypeInt, "1"},
+		{NewBoolValue(false), types.TypeString, "'false'"},
+		{NewStringValue(" 42 "), types.TypeInt, "42"},
+		{NewStringValue("1e3"), types.TypeFloat, "1000"},
+		{NewStringValue("Off"), types.TypeBool, "FALSE"},
+		{NewStringValue("t"), types.TypeBool, "TRUE"},
+		{NewNullValue(), types.TypeInt, "NULL"},
+	}
+	for _, tt := range tests {
+		got, err := Cast(tt.val, tt.to)
+		if err != nil {
+			t.Errorf("Cast(%v, %v) error = %v", tt.val, tt.to, err)
+			continue
+		}
+		if got.Type() != tt.to && got.Type() != types.TypeNull {
+			t.Errorf("Cast(%v, %v) type = %v", tt.val, tt.to, got.Type())
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("Cast(%v, %v) = %v, want %s", tt.val, tt.to, got, tt.want)
+		}
+	}
+
+	invalid := []struct {
+		val Value
+		to  types.DataType
+	}{
+		{NewStringValue("12abc"), types.TypeInt},
+		{NewStringValue("2.5"), types.TypeInt},
+		{NewStringValue(""), types.TypeFloat},
+		{NewStringValue("maybe"), types.TypeBool},
+		{NewFloatValue(1e19), types.TypeInt},
+		{NewFloatValue(math.NaN()), types.TypeInt},
+		{NewFloatValue(1), types.TypeBool},
+		{NewBoolValue(true), types.TypeFloat},
+	}
+	for _, tt := range invalid {
+		if got, err := Cast(tt.val, tt.to); err == nil {
+			t.Errorf("Cast(%v, %v) = %v, want error", tt.val, tt.to, got)
+		}
+	}
+}
+
+func TestParseFunctionCalls(t *testing.T) {
+	p := NewParser()
+
+	stmt, err := p.Parse("SELECT upper(name), Round(score, 1), COUNT(*) FROM users GROUP BY name")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	items := stmt.(SelectStatement).Items()
+	for i, want := range []string{"UPPER(name)", "ROUND(score, 1)", "COUNT(*)"} {
+		if got := fmt.Sprint(items[i].Expr); got != want {
+			t.Errorf("item %d = %s, want %s", i, got, want)
+		}
+	}
+	if call := items[0].Expr.(FunctionExpression); call.Scalar() == nil || call.Scalar().Name != "UPPER" {
+		t.Errorf("UPPER(name) is not resolved to the UPPER function")
+	}
+	if call := items[2].Expr.(FunctionExpression); call.Scalar() != nil {
+		t.Errorf("COUNT(*) resolved to a scalar function")
+	}
+
+	// Unknown functions, and arguments that do not fit, fail to parse as
+	// far as their types are known without the tables
+	invalid := map[string]string{
+		"FOO(name)":              "function FOO does not exist",
+		"UPPER(name, 1)":         "function UPPER takes 1 arguments, got 2",
+		"SUBSTR(name)":           "function SUBSTR takes 2 or 3 arguments, got 1",
+		"UPPER(1)":               "function UPPER cannot take (INT), only (TEXT)",
+		"SUBSTR(name, '1')":      "function SUBSTR cannot take (NULL, TEXT), only (TEXT, INT) or (TEXT, INT, INT) or (BLOB, INT) or (BLOB, INT, INT)",
+		"UPPER(LENGTH(name))":    "function UPPER cannot take (INT), only (TEXT)",
+		"LOWER(CAST(id AS INT))": "function LOWER cannot take (INT), only (TEXT)",
+		"UPPER(*)":               "UPPER(*) is not supported",
+		"ABS(DISTINCT id)":       "DISTINCT is only supported for aggregate functions, not ABS",
+	}
+	for expr, want := range invalid {
+		_, err := p.Parse("SELECT " + expr + " FROM users")
+		if err == nil || err.Error() != want {
+			t.Errorf("Parse(%s) error = %v, want %s", expr, err, want)
+		}
+	}
+
+	// Types that depend on the table are checked when the query is planned
+	for _, expr := range []string{"UPPER(id)", "ROUND(score) || 'x'", "UPPER(NULL)", "ABS(ROUND(score))"} {
+		if _, err := p.Parse("SELECT " + expr + " FROM users"); err != nil {
+			t.Errorf("Parse(%s) error = %v", expr, err)
+		}
+	}
+}
+
+func TestFunctionRegistryConcurrentUse(t *testing.T) {
+	functions := NewFunctionRegistry()
+	p := NewParserWithFunctions(functions)
+
+	// Functions can be registered while statements are parsed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			err := functions.Register(&ScalarFunction{
+				Name:       fmt.Sprintf("f%d", i),
+				Signatures: []Signature{{Args: []types.DataType{types.TypeInt}, Returns: types.TypeInt}},
+				Eval:       func(args []Value) (Value, error) { return args[0], nil },
+			})
+			if err != nil {
+				t.Errorf("Register() error = %v", err)
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if _, err := p.Parse("SELECT UPPER(name) FROM users"); err != nil {
+			t.Errorf("Parse() error = %v", err)
+		}
+	}
+	<-done
+
+	if _, ok := functions.Lookup("F49"); !ok {
+		t.Errorf("Lookup(F49) = false, want the registered function")
+	}
+}
+
+func TestParseSequences(t *testing.T) {
+	p := NewParser()
+
+	stmt, err := p.Parse("CREATE SEQUENCE codes START WITH -5 INCREMENT BY 10")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	seq := stmt.(CreateSequenceStatement)
+	if seq.SequenceName() != "codes" || seq.Start() != -5 || seq.Increment() != 10 {
+		t.Errorf("sequence = %s %d %d, want codes -5 10", seq.SequenceName(), seq.Start(), seq.Increment())
+	}
+	stmt, err = p.Parse("create sequence ids")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if seq := stmt.(CreateSequenceStatement); seq.Start() != 1 || seq.Increment() != 1 {
+		t.Errorf("default start and increment = %d %d, want 1 1", seq.Start(), seq.Increment())
+	}
+	stmt, err = p.Parse("DROP SEQUENCE codes")
+	if err != nil || stmt.(DropSequenceStatement).SequenceName() != "codes" {
+		t.Errorf("Parse(DROP SEQUENCE codes) = %v, %v", stmt, err)
+	}
+
+	// An AUTOINCREMENT column takes its default from a sequence of its own,
+	// and a default that can change is kept as an expression
+	stmt, err = p.Parse("CREATE TABLE items (id INTEGER PRIMARY KEY AUTOINCREMENT, code INT DEFAULT nextval('codes') NOT NULL)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	columns := stmt.(CreateTableStatement).Columns()
+	if seq, ok := columns[0].Default().(SequenceExpression); !ok || seq.Sequence() != "items_id_seq" {
+		t.Errorf("default of id = %v, want nextval('items_id_seq')", columns[0].Default())
+	}
+	if got := fmt.Sprint(columns[1].Default()); got != "nextval('codes')" || len(columns[1].Constraints()) != 1 {
+		t.Errorf("column code = %s %v, want nextval('codes') NOT NULL", got, columns[1].Constraints())
+	}
+
+	invalid := []string{
+		"CREATE SEQUENCE codes INCREMENT BY 0",
+		"CREATE SEQUENCE codes START 1 START 2",
+		"CREATE SEQUENCE codes MAXVALUE 10",
+		"DROP SEQUENCE",
+		"CREATE TABLE t (id TEXT PRIMARY KEY AUTOINCREMENT)",
+		"CREATE TABLE t (id INT AUTOINCREMENT)",
+		"CREATE TABLE t (a INT PRIMARY KEY AUTOINCREMENT, b INT PRIMARY KEY)",
+		"CREATE TABLE t (id INT PRIMARY KEY AUTOINCREMENT DEFAULT 1)",
+		"CREATE TABLE t (id INT DEFAULT nextval(codes))",
+		"CREATE TABLE t (id TEXT DEFAULT nextval('codes'))",
+		"CREATE TABLE t (id INT DEFAULT (SELECT 1 FROM u))",
+		"CREATE TABLE t (id INT DEFAULT 1 / 0)",
+		"ALTER TABLE t ADD COLUMN id INT PRIMARY KEY AUTOINCREMENT",
+	}
+	for _, sql := range invalid {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil, want error", sql)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"UPPER('héllo')", "'HÉLLO'"},
+		{"LOWER('MiXeD')", "'mixed'"},
+		{"LENGTH('héllo')", "5"},
+		{"SUBSTR('hello', 2)", "'ello'"},
+		{"SUBSTR('hello', 2, 3)", "'ell'"},
+		{"SUBSTR('hello', 0, 3)", "'he'"},
+		{"SUBSTR('hello', 9)", "''"},
+		{"TRIM('  a b  ')", "'a b'"},
+		{"TRIM('xxaxx', 'x')", "'a'"},
+		{"REPLACE('banana', 'an', 'o')", "'booa'"},
+		{"REPLACE('abc', '', 'x')", "'abc'"},
+		{"INSTR('héllo', 'l')", "3"},
+		{"INSTR('hello', 'z')", "0"},
+		{"ABS(-3)", "3"},
+		{"ABS(-2.5)", "2.5"},
+		{"ROUND(2.5)", "3"},
+		{"ROUND(-2.5)", "-3"},
+		{"ROUND(3.14159, 2)", "3.14"},
+		{"ROUND(7)", "7"},
+		{"ROUND(1250, -2)", "1300"},
+		{"ROUND(-1249, -2)", "-1200"},
+		{"FLOOR(-1.5)", "-2"},
+		{"CEIL(1.2)", "2"},
+		{"FLOOR(4)", "4"},
+		{"POWER(2, 10)", "1024"},
+		{"POWER(4, 0.5)", "2"},
+		{"SQRT(2.25)", "1.5"},
+		{"MOD(7, 3)", "1"},
+		{"MOD(-7, 3)", "-1"},
+		{"MOD(7.5, 2)", "1.5"},
+		{"UPPER(NULL)", "NULL"},
+		{"SUBSTR('abc', NULL)", "NULL"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse("SELECT " + tt.expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", tt.expr, err)
+			continue
+		}
+		got, err := stmt.(SelectStatement).Items()[0].Expr.Eval(nil, nil)
+		if err != nil {
+			t.Errorf("%s error = %v", tt.expr, err)
+			continue
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s = %v, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"SQRT(-1)", "SUBSTR('abc', 1, -1)", "MOD(1, 0)", "POWER(0, -1)", "POWER(-8, 0.5)", "ABS(-9223372036854775807 - 1)"} {
+		stmt, err := p.Parse("SELECT " + expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", expr, err)
+			continue
+		}
+		if got, err := stmt.(SelectStatement).Items()[0].Expr.Eval(nil, nil); err == nil {
+			t.Errorf("%s = %v, want error", expr, got)
+		}
+	}
+}
+
+func TestTemporalExpressions(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"DATE '2026-10-16'", "DATE '2026-10-16'"},
+		{"TIME '7:05'", "TIME '07:05:00'"},
+		{"TIMESTAMP '2026-10-16T10:00:00.250'", "TIMESTAMP '2026-10-16 10:00:00.25'"},
+		{"TIMESTAMP WITH TIME ZONE '2026-10-16 10:00 -05:30'", "TIMESTAMPTZ '2026-10-16 15:30:00+00'"},
+		{"TIMESTAMPTZ '2026-07-01 12:00 Europe/Paris'", "TIMESTAMPTZ '2026-07-01 10:00:00+00'"},
+		{"INTERVAL '1 year 14 months -3 days 2:30'", "INTERVAL '2 years 2 mons -3 days 02:30:00'"},
+		{"INTERVAL '1.5 months'", "INTERVAL '1 mon 15 days'"},
+		{"INTERVAL '2 hours ago'", "INTERVAL '-02:00:00'"},
+		{"CAST('2026-10-16' AS DATE)", "DATE '2026-10-16'"},
+		{"CAST(TIMESTAMP '2026-10-16 23:59' AS DATE)", "DATE '2026-10-16'"},
+		{"CAST(TIMESTAMP '1969-12-31 23:00' AS TIME)", "TIME '23:00:00'"},
+		{"CAST(DATE '2026-10-16' AS TEXT)", "'2026-10-16'"},
+		{"DATE '2024-01-31' + INTERVAL '1 month'", "TIMESTAMP '2024-02-29 00:00:00'"},
+		{"DATE '2026-10-16' - 20", "DATE '2026-09-26'"},
+		{"7 + DATE '2026-10-16'", "DATE '2026-10-23'"},
+		{"DATE '2026-10-16' - DATE '2025-10-16'", "365"},
+		{"DATE '2026-10-16' + TIME '08:00'", "TIMESTAMP '2026-10-16 08:00:00'"},
+		{"TIMESTAMPTZ '2026-10-16 00:00Z' - INTERVAL '1 day 1 second'", "TIMESTAMPTZ '2026-10-14 23:59:59+00'"},
+		{"TIMESTAMP '2026-10-16 06:00' - TIMESTAMP '2026-10-17 08:30'", "INTERVAL '-1 days -02:30:00'"},
+		{"TIME '01:00' - INTERVAL '2 hours'", "TIME '23:00:00'"},
+		{"INTERVAL '1 day' * 1.5", "INTERVAL '1 day 12:00:00'"},
+		{"2 * INTERVAL '1 mon 1 day'", "INTERVAL '2 mons 2 days'"},
+		{"INTERVAL '1 mon' / 4", "INTERVAL '7 days 12:00:00'"},
+		{"-INTERVAL '1 day'", "INTERVAL '-1 days'"},
+		{"INTERVAL '1 mon' = INTERVAL '30 days'", "TRUE"},
+		{"DATE '2026-10-16' = TIMESTAMP '2026-10-16 00:00'", "TRUE"},
+		{"TIMESTAMP '2026-10-16 12:00' < TIMESTAMPTZ '2026-10-16 13:00+02'", "FALSE"},
+		{"DATE '2026-10-16' BETWEEN '2026-10-01' AND '2026-10-31'", "TRUE"},
+		{"DATE '2026-10-16' || ' (Fri)'", "'2026-10-16 (Fri)'"},
+		{"EXTRACT(YEAR FROM TIMESTAMP '2026-10-16 10:00')", "2026"},
+		{"EXTRACT(isodow FROM DATE '2026-10-18')", "7"},
+		{"EXTRACT(second FROM TIME '10:00:05.5')", "5.5"},
+		{"EXTRACT(epoch FROM TIMESTAMPTZ '1970-01-02 00:00+01')", "82800"},
+		{"EXTRACT(hour FROM INTERVAL '1 day 26:00')", "26"},
+		{"DATE_PART('century', DATE '2000-12-31')", "20"},
+		{"DATE_TRUNC('quarter', TIMESTAMPTZ '2026-11-20 15:00Z')", "TIMESTAMPTZ '2026-10-01 00:00:00+00'"},
+		{"DATE_TRUNC('hour', TIMESTAMP '1969-12-31 23:59:59')", "TIMESTAMP '1969-12-31 23:00:00'"},
+		{"DATE_TRUNC('week', DATE '2026-10-18')", "TIMESTAMP '2026-10-12 00:00:00'"},
+		{"STRFTIME('%Y-%m-%d %H:%M %j %u %%', TIMESTAMP '2026-01-05 07:08')", "'2026-01-05 07:08 005 1 %'"},
+		{"STRFTIME('%I:%M %p', TIME '15:04')", "'03:04 PM'"},
+		{"STRFTIME('%s', DATE '1970-01-02')", "'86400'"},
+		{"TIMESTAMPTZ '2026-01-15 12:00Z' AT TIME ZONE 'America/New_York'", "TIMESTAMP '2026-01-15 07:00:00'"},
+		{"TIMESTAMP '2026-07-15 12:00' AT TIME ZONE 'America/New_York'", "TIMESTAMPTZ '2026-07-15 16:00:00+00'"},
+		{"TIMEZONE('+05:30', TIMESTAMPTZ '2026-01-01 00:00Z')", "TIMESTAMP '2026-01-01 05:30:00'"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse("SELECT " + tt.expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", tt.expr, err)
+			continue
+		}
+		expr := stmt.(SelectStatement).Items()[0].Expr
+		got, err := expr.Eval(nil, nil)
+		if err != nil {
+			t.Errorf("%s error = %v", tt.expr, err)
+			continue
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s = %v, want %s", tt.expr, got, tt.want)
+		}
+
+		// The text of the expression parses back to the same expression
+		again, err := p.Parse(fmt.Sprintf("SELECT %v FROM t", expr))
+		if err != nil {
+			t.Errorf("Parse(%v) error = %v", expr, err)
+		} else if s := fmt.Sprint(again.(SelectStatement).Items()[0].Expr); s != fmt.Sprint(expr) {
+			t.Errorf("%v parsed back as %s", expr, s)
+		}
+	}
+
+	for _, expr := range []string{
+		"DATE '2026-02-29'", "DATE '2026-10-16 10:00'", "TIME '24:00'", "TIMESTAMPTZ '2026-10-16 10:00 Mars/Olympus'",
+		"INTERVAL '3 fortnights'", "TIME WITH TIME ZONE '10:00'",
+	} {
+		if _, err := p.Parse("SELECT " + expr + " FROM t"); err == nil {
+			t.Errorf("Parse(%s) error = nil", expr)
+		}
+	}
+	for _, expr := range []string{
+		"DATE '2026-10-16' + TIMESTAMP '2026-10-16'", "TIME '10:00' * 2", "INTERVAL '1 day' / 0",
+		"EXTRACT(month FROM TIME '10:00')", "DATE_TRUNC('fortnight', DATE '2026-10-16')",
+		"STRFTIME('%Q', DATE '2026-10-16')", "TIMEZONE('Nowhere/Land', TIMESTAMP '2026-10-16')",
+	} {
+		stmt, err := p.Parse("SELECT " + expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", expr, err)
+			continue
+		}
+		if got, err := stmt.(SelectStatement).Items()[0].Expr.Eval(nil, nil); err == nil {
+			t.Errorf("%s = %v, want error", expr, got)
+		}
+	}
+}
+
+func TestDecimalExpressions(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"DECIMAL '19.90'", "DECIMAL '19.90'"},
+		{"NUMERIC '-.5'", "DECIMAL '-0.5'"},
+		{"DECIMAL '1.5e-3'", "DECIMAL '0.0015'"},
+		{"DECIMAL '0.1' + 0.2", "DECIMAL '0.3'"},
+		{"DECIMAL '0.1' + 0.2 = 0.3", "TRUE"},
+		{"DECIMAL '12345678901234567890.5' * 2", "DECIMAL '24691357802469135781.0'"},
+		{"DECIMAL '1.25' - 3", "DECIMAL '-1.75'"},
+		{"DECIMAL '1' / 3", "DECIMAL '0.3333333333333333'"},
+		{"DECIMAL '7.5' % 2", "DECIMAL '1.5'"},
+		{"-DECIMAL '2.50'", "DECIMAL '-2.50'"},
+		{"DECIMAL '1.50' = DECIMAL '1.5'", "TRUE"},
+		{"DECIMAL '1.5' = 1.5", "TRUE"},
+		{"DECIMAL '3' > 2.9", "TRUE"},
+		{"DECIMAL '0.1' = '0.10'", "TRUE"},
+		{"CAST(1.005 AS DECIMAL(5, 2))", "DECIMAL '1.01'"},
+		{"CAST('2' AS NUMERIC(4, 1))", "DECIMAL '2.0'"},
+		{"CAST(DECIMAL '2.5' AS INT)", "3"},
+		{"CAST(DECIMAL '2.5' AS FLOAT)", "2.5"},
+		{"CAST(DECIMAL '2.50' AS TEXT)", "'2.50'"},
+		{"ROUND(DECIMAL '2.345', 2)", "DECIMAL '2.35'"},
+		{"ROUND(DECIMAL '2.5', 0, 'half_even')", "DECIMAL '2'"},
+		{"ROUND(DECIMAL '3.5', 0, 'half_even')", "DECIMAL '4'"},
+		{"ROUND(DECIMAL '-2.5', 0, 'half_down')", "DECIMAL '-2'"},
+		{"ROUND(DECIMAL '2.01', 0, 'ceiling')", "DECIMAL '3'"},
+		{"ROUND(DECIMAL '-2.01', 0, 'floor')", "DECIMAL '-3'"},
+		{"ROUND(DECIMAL '1234.5', -2)", "DECIMAL '1200'"},
+		{"ROUND(DECIMAL '1.5', 3)", "DECIMAL '1.500'"},
+		{"ROUND(2.5, 0, 'half_even')", "2"},
+		{"ABS(DECIMAL '-1.10')", "DECIMAL '1.10'"},
+		{"FLOOR(DECIMAL '-1.5')", "DECIMAL '-2'"},
+		{"CEIL(DECIMAL '1.2')", "DECIMAL '2'"},
+		{"DECIMAL '0.01' + 12345678901234567.89", "DECIMAL '12345678901234567.90'"},
+		{"12345678901234567.89 = DECIMAL '12345678901234567.89'", "TRUE"},
+		{"CAST(-12345678901234567.89 AS DECIMAL(20, 2))", "DECIMAL '-12345678901234567.89'"},
+		{"CAST(99999999999999999999 AS DECIMAL)", "DECIMAL '99999999999999999999'"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse("SELECT " + tt.expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", tt.expr, err)
+			continue
+		}
+		got, err := stmt.(SelectStatement).Items()[0].Expr.Eval(nil, nil)
+		if err != nil {
+			t.Errorf("%s error = %v", tt.expr, err)
+			continue
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s = %v, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	// A number literal is written back with all its digits, as a stored
+	// DEFAULT is
+	for _, expr := range []string{"12345678901234567.89", "-12345678901234567.89", "- -1.50", "1e21"} {
+		parsed, err := ParseExpression(expr)
+		if err != nil {
+			t.Errorf("ParseExpression(%s) error = %v", expr, err)
+			continue
+		}
+		if want := strings.ReplaceAll(expr, "- -", ""); fmt.Sprint(parsed) != want {
+			t.Errorf("ParseExpression(%s) = %s, want %s", expr, parsed, want)
+		}
+	}
+
+	for _, expr := range []string{
+		"DECIMAL 'abc'", "CAST(1 AS DECIMAL(0))", "CAST(1 AS DECIMAL(2, 3))", "CAST(1 AS DECIMAL(1, 2, 3))",
+	} {
+		if _, err := p.Parse("SELECT " + expr + " FROM t"); err == nil {
+			t.Errorf("Parse(%s) error = nil", expr)
+		}
+	}
+	for _, expr := range []string{
+		"DECIMAL '1' / 0", "CAST(DECIMAL '123.4' AS DECIMAL(3, 1))", "CAST(DECIMAL '1e30' AS INT)",
+		"ROUND(DECIMAL '1.5', 0, 'sideways')",
+	} {
+		stmt, err := p.Parse("SELECT " + expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", expr, err)
+			continue
+		}
+		if got, err := stmt.(SelectStatement).Items()[0].Expr.Eval(nil, nil); err == nil {
+			t.Errorf("%s = %v, want error", expr, got)
+		}
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	a, err := ParseDecimal("10.25")
+	if err != nil {
+		t.Fatalf("ParseDecimal error = %v", err)
+	}
+	b := NewDecimal(-4, 0)
+	if got := a.Add(b).String(); got != "6.25" {
+		t.Errorf("Add = %s, want 6.25", got)
+	}
+	if got := a.Mul(b).String(); got != "-41.00" {
+		t.Errorf("Mul = %s, want -41.00", got)
+	}
+	if got, err := a.QuoRound(b, 2, RoundHalfEven); err != nil || got.String() != "-2.56" {
+		t.Errorf("QuoRound = %v, %v, want -2.56", got, err)
+	}
+	if a.Cmp(NewDecimal(102500, 4)) != 0 {
+		t.Errorf("10.25 and 10.2500 compare unequal")
+	}
+	if a.Precision() != 4 || a.Scale() != 2 {
+		t.Errorf("Precision, Scale = %d, %d, want 4, 2", a.Precision(), a.Scale())
+	}
+	if got, err := a.Fit(5, 3, RoundHalfUp); err != nil || got.String() != "10.250" {
+		t.Errorf("Fit(5, 3) = %v, %v, want 10.250", got, err)
+	}
+	if _, err := a.Fit(3, 2, RoundHalfUp); err == nil {
+		t.Errorf("Fit(3, 2) error = nil")
+	}
+}
+
+func TestBlobExpressions(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"X'DEADBEEF'", "X'DEADBEEF'"},
+		{"x'00ff'", "X'00FF'"},
+		{"X''", "X''"},
+		{"LENGTH(X'DEADBEEF')", "4"},
+		{"LENGTH(X'')", "0"},
+		{"SUBSTR(X'DEADBEEF', 2)", "X'ADBEEF'"},
+		{"SUBSTR(X'DEADBEEF', 2, 2)", "X'ADBE'"},
+		{"SUBSTR(X'DEADBEEF', 10)", "X''"},
+		{"X'DEADBEEF' = X'deadbeef'", "TRUE"},
+		{"X'00' < X'0000'", "TRUE"},
+		{"X'FF' > X'00FF'", "TRUE"},
+		{"X'6869' = 'hi'", "TRUE"},
+		{"X'DEAD' = '\\xdead'", "TRUE"},
+		{"CAST(X'DEAD' AS TEXT)", "'\\xdead'"},
+		{"CAST('hi' AS BLOB)", "X'6869'"},
+		{"CAST('\\x00ff' AS BYTEA)", "X'00FF'"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse("SELECT " + tt.expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", tt.expr, err)
+			continue
+		}
+		got, err := stmt.(SelectStatement).Items()[0].Expr.Eval(nil, nil)
+		if err != nil {
+			t.Errorf("%s error = %v", tt.expr, err)
+			continue
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s = %v, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"X'ABC'", "X'GG'", "X'00"} {
+		if _, err := p.Parse("SELECT " + expr + " FROM t"); err == nil {
+			t.Errorf("Parse(%s) error = nil", expr)
+		}
+	}
+	for _, expr := range []string{"X'00' + 1", "CAST(1 AS BLOB)", "CAST('\\xzz' AS BLOB)", "SUBSTR(X'00', 1, -1)"} {
+		stmt, err := p.Parse("SELECT " + expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", expr, err)
+			continue
+		}
+		if got, err := stmt.(SelectStatement).Items()[0].Expr.Eval(nil, nil); err == nil {
+			t.Errorf("%s = %v, want error", expr, got)
+		}
+	}
+
+	data := []byte{0, 1, 2}
+	val := NewBlobValue(data)
+	if got, err := val.AsBytes(); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("AsBytes = %v, %v, want %v", got, err, data)
+	}
+	if _, err := val.AsInt(); err == nil {
+		t.Errorf("AsInt of a BLOB error = nil")
+	}
+}
+
+func TestJSONExpressions(t *testing.T) {
+	p := NewParser()
+
+	doc := `'{"status": "active", "tags": ["a", "b"], "n": 1.50, "owner": {"name": "ann"}, "none": null}'`
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`JSON ` + doc, `JSON '{"n":1.50,"none":null,"owner":{"name":"ann"},"status":"active","tags":["a","b"]}'`},
+		{`CAST(` + doc + ` AS JSON) ->> 'status'`, "'active'"},
+		{`CAST(` + doc + ` AS JSON) -> 'status'`, `JSON '"active"'`},
+		{`CAST(` + doc + ` AS JSON) -> 'tags' ->> 1`, "'b'"},
+		{`CAST(` + doc + ` AS JSON) -> 'tags' ->> -1`, "'b'"},
+		{`CAST(` + doc + ` AS JSON) ->> '$.owner.name'`, "'ann'"},
+		{`CAST(` + doc + ` AS JSON) ->> '$.tags[0]'`, "'a'"},
+		{`CAST(` + doc + ` AS JSON) ->> 'none'`, "NULL"},
+		{`CAST(` + doc + ` AS JSON) -> 'missing'`, "NULL"},
+		{`JSON_EXTRACT(` + doc + `, '$.n')`, `JSON '1.50'`},
+		{`JSON_EXTRACT(` + doc + `, '$.owner')`, `JSON '{"name":"ann"}'`},
+		{`JSON_EXTRACT(` + doc + `, '$.tags[1]')`, `JSON '"b"'`},
+		{`JSON_ARRAY_LENGTH(` + doc + `, '$.tags')`, "2"},
+		{`JSON_ARRAY_LENGTH('[1, [2, 3]]')`, "2"},
+		{`JSON_ARRAY_LENGTH('{}')`, "0"},
+		{`JSON_SET('{"a": 1}', '$.a', 2)`, `JSON '{"a":2}'`},
+		{`JSON_SET('{"a": 1}', '$.b.c', 'x')`, `JSON '{"a":1,"b":{"c":"x"}}'`},
+		{`JSON_SET('[1]', '$[1]', TRUE)`, `JSON '[1,true]'`},
+		{`JSON_SET('{"a": 1}', '$.a.b', 2)`, `JSON '{"a":1}'`},
+		{`JSON '{"a": 1, "b": 2}' = '{"b":2,"a":1}'`, "TRUE"},
+		{`JSON '[1, 2]' = JSON '[2, 1]'`, "FALSE"},
+		{`CAST(JSON '{"a": [1]}' AS TEXT)`, `'{"a":[1]}'`},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse("SELECT " + tt.expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", tt.expr, err)
+			continue
+		}
+		got, err := stmt.(SelectStatement).Items()[0].Expr.Eval(nil, nil)
+		if err != nil {
+			t.Errorf("%s error = %v", tt.expr, err)
+			continue
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s = %v, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, text := range []string{`{"a":`, `[1] [2]`, `{a: 1}`, ``} {
+		if _, err := ParseJSON(text); err == nil {
+			t.Errorf("ParseJSON(%q) error = nil", text)
+		}
+	}
+	for _, expr := range []string{`CAST('{bad' AS JSON)`, `JSON_EXTRACT('{}', '$[')`, `JSON '1' + 1`} {
+		stmt, err := p.Parse("SELECT " + expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", expr, err)
+			continue
+		}
+		if got, err := stmt.(SelectStatement).Items()[0].Expr.Eval(nil, nil); err == nil {
+			t.Errorf("%s = %v, want error", expr, got)
+		}
+	}
+
+	// json_each lists the members of an object in key order
+	fn, ok := LookupTableFunction("json_each")
+	if !ok {
+		t.Fatalf("LookupTableFunction(json_each) not found")
+	}
+	doc1, _ := ParseJSON(`{"b": [1], "a": "x"}`)
+	rows, err := fn.Call([]Value{doc1})
+	if err != nil {
+		t.Fatalf("json_each error = %v", err)
+	}
+	if got := fmt.Sprint(rows); got != `[['a' JSON '"x"' 'string'] ['b' JSON '[1]' 'array']]` {
+		t.Errorf("json_each = %s", got)
+	}
+}
+
+func TestCollations(t *testing.T) {
+	p := NewParser()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"'abc' COLLATE NOCASE = 'ABC'", "TRUE"},
+		{"'abc' = 'ABC' COLLATE NOCASE", "TRUE"},
+		{"'abc' = 'ABC'", "FALSE"},
+		{"'straße' COLLATE NOCASE = 'STRASSE'", "FALSE"},
+		{"'ÉCOLE' COLLATE NOCASE = 'école'", "FALSE"},
+		{"'ÉCOLE' COLLATE UNICODE = 'école'", "TRUE"},
+		{"'a' COLLATE NOCASE < 'B'", "TRUE"},
+		{"'a' < 'B'", "FALSE"},
+		{"('a' COLLATE NOCASE) COLLATE BINARY = 'A'", "FALSE"},
+		{"CAST('abcdef' AS VARCHAR(3))", "'abc'"},
+		{"CAST('äöü' AS CHAR(2))", "'äö'"},
+		{"CAST('äöü' AS CHAR)", "'ä'"},
+		{"NULL COLLATE NOCASE", "NULL"},
+	}
+	for _, tt := range tests {
+		stmt, err := p.Parse("SELECT " + tt.expr + " FROM t")
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", tt.expr, err)
+			continue
+		}
+		got, err := stmt.(SelectStatement).Items()[0].Expr.Eval(nil, nil)
+		if err != nil {
+			t.Errorf("%s error = %v", tt.expr, err)
+			continue
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s = %v, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	// Text that differs only in case is one value in GROUP BY and DISTINCT
+	// under a collation that ignores case
+	a, b := Collate(NewStringValue("Σίσυφος"), CollateUnicode), Collate(NewStringValue("ΣΊΣΥΦΟΣ"), CollateUnicode)
+	if !Equal(a, b) {
+		t.Errorf("Equal(%v, %v) under UNICODE = false", a, b)
+	}
+	if Equal(NewStringValue("a"), NewStringValue("A")) {
+		t.Errorf("Equal('a', 'A') = true")
+	}
+
+	stmt, err := p.Parse("CREATE TABLE t (id INT, name VARCHAR(20) COLLATE nocase NOT NULL, code CHAR(2), flag char, note TEXT)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	columns := stmt.(CreateTableStatement).Columns()
+	if got := columns[1].Collation(); got != CollateNoCase {
+		t.Errorf("collation of name = %v, want NOCASE", got)
+	}
+	var typeNames []string
+	for _, col := range columns[1:] {
+		typeNames = append(typeNames, col.TypeName())
+	}
+	if want := []string{"VARCHAR(20)", "CHAR(2)", "CHAR(1)", "TEXT"}; !slices.Equal(typeNames, want) {
+		t.Errorf("column types = %v, want %v", typeNames, want)
+	}
+	cast, err := ParseExpression("CAST(name AS CHAR)")
+	if err != nil || fmt.Sprint(cast) != "CAST(name AS CHAR(1))" {
+		t.Errorf("ParseExpression(CAST(name AS CHAR)) = %v, %v, want CAST(name AS CHAR(1))", cast, err)
+	}
+
+	for _, sql := range []string{
+		"CREATE TABLE t (n INT COLLATE NOCASE)",
+		"CREATE TABLE t (s TEXT COLLATE GERMAN)",
+		"CREATE TABLE t (s VARCHAR(0))",
+		"CREATE TABLE t (s VARCHAR(10, 2))",
+		"CREATE TABLE t (s TEXT(3))",
+		"CREATE TABLE t (s STRING(3))",
+		"SELECT CAST(s AS TEXT(3)) FROM t",
+		"SELECT s COLLATE FROM t",
+	} {
+		if _, err := p.Parse(sql); err == nil {
+			t.Errorf("Parse(%s) error = nil", sql)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// withRegex matches the start of a SELECT statement with a WITH clause
+var withRegex = regexp.MustCompile(`(?i)^WITH\b`)
+
+// parseSelect parses a SELECT statement
+func (p *SimpleParser) parseSelect(sql string) (SelectStatement, error) {
+	tp, err := newTokenParser(sql, p.functions)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tp.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	if !tp.atEnd() {
+		return nil, tp.errorf("unexpected input after SELECT statement")
+	}
+	return stmt, nil
+}
+
+// parseSelect parses a query from the current token
+func (p *tokenParser) parseSelect() (SelectStatement, error) {
+	var with []CommonTableExpression
+	if p.matchKeyword("WITH") {
+		var err error
+		if with, err = p.parseWith(); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt, err := p.parseSetOperation()
+	if err != nil {
+		return nil, err
+	}
+	clauses := stmt.clauses()
+	if with != nil {
+		if clauses.with != nil {
+			return nil, p.errorf("multiple WITH clauses not allowed")
+		}
+		clauses.with = with
+	}
+
+	if p.matchKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if clauses.orderBy != nil {
+			return nil, p.errorf("multiple ORDER BY clauses not allowed")
+		}
+		if clauses.orderBy, err = p.parseOrderBy(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.matchKeyword("LIMIT") {
+		if clauses.hasLimit {
+			return nil, p.errorf("multiple LIMIT clauses not allowed")
+		}
+		if clauses.limit, err = p.parseCount("LIMIT"); err != nil {
+			return nil, err
+		}
+		clauses.hasLimit = true
+	}
+	if p.matchKeyword("OFFSET") {
+		if clauses.offset > 0 {
+			return nil, p.errorf("multiple OFFSET clauses not allowed")
+		}
+		if clauses.offset, err = p.parseCount("OFFSET"); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmt, nil
+}
+
+// parseSetOperation parses queries joined by UNION, EXCEPT and INTERSECT
+func (p *tokenParser) parseSetOperation() (queryStatement, error) {
+	left, err := p.parseIntersect()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("UNION") || p.isKeyword("EXCEPT") {
+		operator := strings.ToUpper(p.next().text)
+		all := p.parseSetQuantifier()
+		right, err := p.parseIntersect()
+		if err != nil {
+			return nil, err
+		}
+		left = &compoundSelectStatement{operator: operator, all: all, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseIntersect parses queries joined by INTERSECT
+func (p *tokenParser) parseIntersect() (queryStatement, error) {
+	left, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.matchKeyword("INTERSECT") {
+		all := p.parseSetQuantifier()
+		right, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = &compoundSelectStatement{operator: "INTERSECT", all: all, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseSetQuantifier parses the optional ALL or DISTINCT after a set operator
+func (p *tokenParser) parseSetQuantifier() bool {
+	if p.matchKeyword("ALL") {
+		return true
+	}
+	p.matchKeyword("DISTINCT")
+	return false
+}
+
+// parseSetOperand parses a SELECT without the clauses of a whole query, or a parenthesized query
+func (p *tokenParser) parseSetOperand() (queryStatement, error) {
+	if p.peek().typ == tokenLParen {
+		p.next()
+		stmt, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return stmt.(queryStatement), nil
+	}
+
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	stmt := &selectStatement{}
+
+	if p.matchKeyword("DISTINCT") {
+		stmt.distinct = true
+		if p.matchKeyword("ON") {
+			if _, err := p.expect(tokenLParen, "("); err != nil {
+				return nil, err
+			}
+			var err error
+			if stmt.distinctOn, err = p.parseExpressionList(); err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokenRParen, ")"); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		p.matchKeyword("ALL")
+	}
+
+	// Select list
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.items = append(stmt.items, item)
+		stmt.columns = append(stmt.columns, selectItemName(item))
+
+		if !p.match(tokenComma) {
+			break
+		}
+	}
+
+	// FROM clause
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	tableName, args, alias, err := p.parseTableReference()
+	if err != nil {
+		return nil, err
+	}
+	stmt.tableName = tableName
+	stmt.tableArgs = args
+	stmt.tableAlias = alias
+
+	for {
+		join, ok, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		stmt.joins = append(stmt.joins, join)
+	}
+
+	// WHERE clause; no WHERE clause means all rows
+	stmt.whereExpr = &literalExpression{val: &literalValue{dataType: types.TypeBool, boolVal: true}}
+	if p.matchKeyword("WHERE") {
+		if stmt.whereExpr, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.matchKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if stmt.groupBy, err = p.parseExpressionList(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.matchKeyword("HAVING") {
+		if stmt.having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmt, nil
+}
+
+// parseWith parses the common table expressions of a WITH clause
+func (p *tokenParser) parseWith() ([]CommonTableExpression, error) {
+	recursive := p.matchKeyword("RECURSIVE")
+
+	var ctes []CommonTableExpression
+	for {
+		var cte CommonTableExpression
+		var err error
+		if cte.Name, err = p.expectIdent("CTE name"); err != nil {
+			return nil, err
+		}
+		for _, other := range ctes {
+			if strings.EqualFold(other.Name, cte.Name) {
+				return nil, p.errorf("WITH query name '%s' specified more than once", cte.Name)
+			}
+		}
+
+		if p.match(tokenLParen) {
+			for {
+				col, err := p.expectIdent("column name")
+				if err != nil {
+					return nil, err
+				}
+				cte.Columns = append(cte.Columns, col)
+				if !p.match(tokenComma) {
+					break
+				}
+			}
+			if _, err := p.expect(tokenRParen, ")"); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := p.expectKeyword("AS"); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenLParen, "("); err != nil {
+			return nil, err
+		}
+		if cte.Query, err = p.parseSelect(); err != nil {
+			return nil, err
+		}
+		if compound, ok := cte.Query.(*compoundSelectStatement); ok && recursive && compound.operator == "UNION" &&
+			compound.orderBy == nil && !compound.hasLimit && compound.offset == 0 && compound.with == nil {
+			cte.Query, cte.Recursive, cte.UnionAll = compound.left, compound.right, compound.all
+		}
+		if _, err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+
+		ctes = append(ctes, cte)
+		if !p.match(tokenComma) {
+			return ctes, nil
+		}
+	}
+}
+
+// parseSelectItem parses *, table.* or an expression with an optional alias
+func (p *tokenParser) parseSelectItem() (SelectItem, error) {
+	if p.matchOperator("*") {
+		return SelectItem{Star: true}, nil
+	}
+	if p.peek().typ == tokenIdent && p.peekAt(1).typ == tokenDot &&
+		p.peekAt(2).typ == tokenOperator && p.peekAt(2).text == "*" {
+		table := p.next().text
+		p.next()
+		p.next()
+		return SelectItem{Star: true, Table: table}, nil
+	}
+
+	expr, err := p.parseExpr()
+	if err != nil {
+		return SelectItem{}, err
+	}
+	alias, err := p.parseAlias()
+	if err != nil {
+		return SelectItem{}, err
+	}
+	return SelectItem{Expr: expr, Alias: alias}, nil
+}
+
+// parseAlias parses an optional [AS] alias
+func (p *tokenParser) parseAlias() (string, error) {
+	if p.matchKeyword("AS") {
+		return p.expectIdent("alias")
+	}
+	tok := p.peek()
+	if tok.typ == tokenIdent && !reservedWords[strings.ToUpper(tok.text)] && !p.isUnsupportedJoin() {
+		p.next()
+		return tok.text, nil
+	}
+	return "", nil
+}
+
+// isUnsupportedJoin reports whether a RIGHT or FULL join starts at the current token
+func (p *tokenParser) isUnsupportedJoin() bool {
+	if !p.isKeyword("RIGHT") && !p.isKeyword("FULL") {
+		return false
+	}
+	next := p.peekAt(1)
+	return next.typ == tokenIdent && (strings.EqualFold(next.text, "JOIN") || strings.EqualFold(next.text, "OUTER"))
+}
+
+// parseTableReference parses a table name or table function call with an optional alias
+func (p *tokenParser) parseTableReference() (string, []Expression, string, error) {
+	tok := p.peek()
+	if tok.typ != tokenIdent || reservedWords[strings.ToUpper(tok.text)] {
+		return "", nil, "", p.errorf("expected table name")
+	}
+	p.next()
+
+	var args []Expression
+	if p.match(tokenLParen) {
+		args = []Expression{}
+		if p.peek().typ != tokenRParen {
+			var err error
+			if args, err = p.parseExpressionList(); err != nil {
+				return "", nil, "", err
+			}
+		}
+		if _, err := p.expect(tokenRParen, ")"); err != nil {
+			return "", nil, "", err
+		}
+	}
+
+	alias, err := p.parseAlias()
+	if err != nil {
+		return "", nil, "", err
+	}
+	return tok.text, args, alias, nil
+}
+
+// parseJoin parses the next join of a FROM clause, if there is one
+func (p *tokenParser) parseJoin() (JoinClause, bool, error) {
+	var join JoinClause
+
+	switch {
+	case p.match(tokenComma):
+		join.Type = types.JoinCross
+	case p.matchKeyword("CROSS"):
+		if err := p.expectKeyword("JOIN"); err != nil {
+			return join, false, err
+		}
+		join.Type = types.JoinCross
+	case p.matchKeyword("LEFT"):
+		p.matchKeyword("OUTER")
+		if err := p.expectKeyword("JOIN"); err != nil {
+			return join, false, err
+		}
+		join.Type = types.JoinLeft
+	case p.matchKeyword("INNER"):
+		if err := p.expectKeyword("JOIN"); err != nil {
+			return join, false, err
+		}
+		join.Type = types.JoinInner
+	case p.matchKeyword("JOIN"):
+		join.Type = types.JoinInner
+	case p.isUnsupportedJoin():
+		return join, false, p.errorf("%s JOIN is not supported", strings.ToUpper(p.peek().text))
+	default:
+		return join, false, nil
+	}
+
+	var err error
+	if join.Table, join.Args, join.Alias, err = p.parseTableReference(); err != nil {
+		return join, false, err
+	}
+
+	if join.Type != types.JoinCross {
+		if err := p.expectKeyword("ON"); err != nil {
+			return join, false, err
+		}
+		if join.Condition, err = p.parseExpr(); err != nil {
+			return join, false, err
+		}
+	}
+	return join, true, nil
+}
+
+// parseExpressionList parses a comma-separated list of expressions
+func (p *tokenParser) parseExpressionList() ([]Expression, error) {
+	var exprs []Expression
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+
+		if !p.match(tokenComma) {
+			return exprs, nil
+		}
+	}
+}
+
+// parseOrderBy parses the sort keys of an ORDER BY clause
+func (p *tokenParser) parseOrderBy() ([]OrderByItem, error) {
+	var items []OrderByItem
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item := OrderByItem{Expr: expr}
+		if p.matchKeyword("DESC") {
+			item.Descending = true
+		} else {
+			p.matchKeyword("ASC")
+		}
+		items = append(items, item)
+
+		if !p.match(tokenComma) {
+			return items, nil
+		}
+	}
+}
+
+// parseCount parses the non-negative row count of LIMIT or OFFSET
+func (p *tokenParser) parseCount(clause string) (int64, error) {
+	tok := p.peek()
+	if tok.typ != tokenNumber {
+		return 0, p.errorf("expected a row count after %s", clause)
+	}
+	n, err := strconv.ParseInt(tok.text, 10, 64)
+	if err != nil || n < 0 {
+		return 0, p.errorf("%s must be a non-negative integer", clause)
+	}
+	p.next()
+	return n, nil
+}
+
+// selectItemName is the name a select item is listed under in Columns
+func selectItemName(item SelectItem) string {
+	switch {
+	case item.Star && item.Table != "":
+		return item.Table + ".*"
+	case item.Star:
+		return "*"
+	case item.Alias != "":
+		return item.Alias
+	}
+	if col, ok := item.Expr.(*columnExpression); ok {
+		return col.columnName
+	}
+	return fmt.Sprint(item.Expr)
+}
@@ -1,8 +1,13 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
 )
@@ -11,8 +16,9 @@ import (
 
 // createTableStatement implements CreateTableStatement
 type createTableStatement struct {
-	tableName string
-	columns   []ColumnDefinition
+	tableName   string
+	columns     []ColumnDefinition
+	constraints []TableConstraint
 }
 
 func (s *createTableStatement) Type() types.StatementType {
@@ -27,6 +33,10 @@ func (s *createTableStatement) Columns() []ColumnDefinition {
 	return s.columns
 }
 
+func (s *createTableStatement) Constraints() []TableConstraint {
+	return s.constraints
+}
+
 // dropTableStatement implements DropTableStatement
 type dropTableStatement struct {
 	tableName string
@@ -40,11 +50,90 @@ func (s *dropTableStatement) TableName() string {
 	return s.tableName
 }
 
+// alterTableStatement implements AlterTableStatement
+type alterTableStatement struct {
+	tableName   string
+	action      types.AlterAction
+	column      ColumnDefinition
+	constraints []TableConstraint
+	columnName  string
+	newName     string
+	constraint  string
+}
+
+func (s *alterTableStatement) Type() types.StatementType {
+	return types.StmtAlterTable
+}
+
+func (s *alterTableStatement) TableName() string {
+	return s.tableName
+}
+
+func (s *alterTableStatement) Action() types.AlterAction {
+	return s.action
+}
+
+func (s *alterTableStatement) Column() ColumnDefinition {
+	return s.column
+}
+
+func (s *alterTableStatement) Constraints() []TableConstraint {
+	return s.constraints
+}
+
+func (s *alterTableStatement) ColumnName() string {
+	return s.columnName
+}
+
+func (s *alterTableStatement) NewName() string {
+	return s.newName
+}
+
+func (s *alterTableStatement) ConstraintName() string {
+	return s.constraint
+}
+
+// createSequenceStatement implements CreateSequenceStatement
+type createSequenceStatement struct {
+	sequenceName string
+	start        int64
+	increment    int64
+}
+
+func (s *createSequenceStatement) Type() types.StatementType {
+	return types.StmtCreateSequence
+}
+
+func (s *createSequenceStatement) SequenceName() string {
+	return s.sequenceName
+}
+
+func (s *createSequenceStatement) Start() int64 {
+	return s.start
+}
+
+func (s *createSequenceStatement) Increment() int64 {
+	return s.increment
+}
+
+// dropSequenceStatement implements DropSequenceStatement
+type dropSequenceStatement struct {
+	sequenceName string
+}
+
+func (s *dropSequenceStatement) Type() types.StatementType {
+	return types.StmtDropSequence
+}
+
+func (s *dropSequenceStatement) SequenceName() string {
+	return s.sequenceName
+}
+
 // insertStatement implements InsertStatement
 type insertStatement struct {
 	tableName string
 	columns   []string
-	values    [][]Value
+	values    [][]Expression
 }
 
 func (s *insertStatement) Type() types.StatementType {
@@ -59,7 +148,7 @@ func (s *insertStatement) Columns() []string {
 	return s.columns
 }
 
-func (s *insertStatement) Values() [][]Value {
+func (s *insertStatement) Values() [][]Expression {
 	return s.values
 }
 
@@ -104,17 +193,69 @@ func (s *deleteStatement) WhereClause() Expression {
 	return s.whereExpr
 }
 
+// queryClauses holds the clauses that apply to all the rows of a query
+type queryClauses struct {
+	with     []CommonTableExpression
+	orderBy  []OrderByItem
+	limit    int64
+	hasLimit bool
+	offset   int64
+}
+
+func (c *queryClauses) clauses() *queryClauses {
+	return c
+}
+
+func (c *queryClauses) With() []CommonTableExpression {
+	return c.with
+}
+
+func (c *queryClauses) OrderBy() []OrderByItem {
+	return c.orderBy
+}
+
+func (c *queryClauses) Limit() (int64, bool) {
+	return c.limit, c.hasLimit
+}
+
+func (c *queryClauses) Offset() int64 {
+	return c.offset
+}
+
+// queryStatement is a SelectStatement whose whole-query clauses are filled in last
+type queryStatement interface {
+	SelectStatement
+	clauses() *queryClauses
+}
+
 // selectStatement implements SelectStatement
 type selectStatement struct {
-	tableName string
-	columns   []string
-	whereExpr Expression
+	queryClauses
+	distinct   bool
+	distinctOn []Expression
+	tableName  string
+	tableArgs  []Expression
+	tableAlias string
+	columns    []string
+	items      []SelectItem
+	joins      []JoinClause
+	whereExpr  Expression
+	groupBy    []Expression
+	having     Expression
 }
 
 func (s *selectStatement) Type() types.StatementType {
 	return types.StmtSelect
 }
 
+func (s *selectStatement) Distinct() bool {
+	return s.distinct
+}
+
+func (s *selectStatement) DistinctOn() []Expression {
+	return s.distinctOn
+}
+
 func (s *selectStatement) TableName() string {
 	return s.tableName
 }
@@ -127,11 +268,189 @@ func (s *selectStatement) WhereClause() Expression {
 	return s.whereExpr
 }
 
+func (s *selectStatement) TableAlias() string {
+	return s.tableAlias
+}
+
+func (s *selectStatement) TableArgs() []Expression {
+	return s.tableArgs
+}
+
+func (s *selectStatement) Items() []SelectItem {
+	return s.items
+}
+
+func (s *selectStatement) Joins() []JoinClause {
+	return s.joins
+}
+
+func (s *selectStatement) GroupBy() []Expression {
+	return s.groupBy
+}
+
+func (s *selectStatement) Having() Expression {
+	return s.having
+}
+
+// compoundSelectStatement implements CompoundSelectStatement
+type compoundSelectStatement struct {
+	queryClauses
+	operator string
+	all      bool
+	left     SelectStatement
+	right    SelectStatement
+}
+
+func (s *compoundSelectStatement) Type() types.StatementType {
+	return types.StmtSelect
+}
+
+func (s *compoundSelectStatement) Distinct() bool {
+	return false
+}
+
+func (s *compoundSelectStatement) DistinctOn() []Expression {
+	return nil
+}
+
+func (s *compoundSelectStatement) TableName() string {
+	return s.left.TableName()
+}
+
+func (s *compoundSelectStatement) Columns() []string {
+	return s.left.Columns()
+}
+
+func (s *compoundSelectStatement) WhereClause() Expression {
+	return nil
+}
+
+func (s *compoundSelectStatement) TableAlias() string {
+	return ""
+}
+
+func (s *compoundSelectStatement) TableArgs() []Expression {
+	return nil
+}
+
+func (s *compoundSelectStatement) Items() []SelectItem {
+	return nil
+}
+
+func (s *compoundSelectStatement) Joins() []JoinClause {
+	return nil
+}
+
+func (s *compoundSelectStatement) GroupBy() []Expression {
+	return nil
+}
+
+func (s *compoundSelectStatement) Having() Expression {
+	return nil
+}
+
+func (s *compoundSelectStatement) Operator() string {
+	return s.operator
+}
+
+func (s *compoundSelectStatement) All() bool {
+	return s.all
+}
+
+func (s *compoundSelectStatement) Left() SelectStatement {
+	return s.left
+}
+
+func (s *compoundSelectStatement) Right() SelectStatement {
+	return s.right
+}
+
+// createIndexStatement implements CreateIndexStatement
+type createIndexStatement struct {
+	indexName   string
+	tableName   string
+	columns     []string
+	expressions []Expression
+	unique      bool
+}
+
+func (s *createIndexStatement) Type() types.StatementType {
+	return types.StmtCreateIndex
+}
+
+func (s *createIndexStatement) IndexName() string {
+	return s.indexName
+}
+
+func (s *createIndexStatement) TableName() string {
+	return s.tableName
+}
+
+func (s *createIndexStatement) Columns() []string {
+	return s.columns
+}
+
+func (s *createIndexStatement) Expressions() []Expression {
+	return s.expressions
+}
+
+func (s *createIndexStatement) Unique() bool {
+	return s.unique
+}
+
+// dropIndexStatement implements DropIndexStatement
+type dropIndexStatement struct {
+	indexName string
+}
+
+func (s *dropIndexStatement) Type() types.StatementType {
+	return types.StmtDropIndex
+}
+
+func (s *dropIndexStatement) IndexName() string {
+	return s.indexName
+}
+
+// analyzeStatement implements AnalyzeStatement
+type analyzeStatement struct {
+	tableName string
+}
+
+func (s *analyzeStatement) Type() types.StatementType {
+	return types.StmtAnalyze
+}
+
+func (s *analyzeStatement) TableName() string {
+	return s.tableName
+}
+
+// explainStatement implements ExplainStatement
+type explainStatement struct {
+	stmt    Statement
+	analyze bool
+}
+
+func (s *explainStatement) Type() types.StatementType {
+	return types.StmtExplain
+}
+
+func (s *explainStatement) Statement() Statement {
+	return s.stmt
+}
+
+func (s *explainStatement) Analyze() bool {
+	return s.analyze
+}
+
 // Column definition implementation
 type columnDefinition struct {
 	name        string
 	dataType    types.DataType
+	typeParams  []int
+	char        bool
+	collation   Collation
 	constraints []types.Constraint
+	defaultExpr Expression
 }
 
 func (c *columnDefinition) Name() string {
@@ -142,10 +461,26 @@ func (c *columnDefinition) Type() types.DataType {
 	return c.dataType
 }
 
+func (c *columnDefinition) TypeParams() []int {
+	return c.typeParams
+}
+
+func (c *columnDefinition) TypeName() string {
+	return declaredTypeName(c.dataType, c.typeParams, c.char)
+}
+
+func (c *columnDefinition) Collation() Collation {
+	return c.collation
+}
+
 func (c *columnDefinition) Constraints() []types.Constraint {
 	return c.constraints
 }
 
+func (c *columnDefinition) Default() Expression {
+	return c.defaultExpr
+}
+
 // Expression implementations
 
 // literalValue implements Value
@@ -155,6 +490,9 @@ type literalValue struct {
 	floatVal  float64
 	stringVal string
 	boolVal   bool
+
+	// text is a non-INT number literal as written, which a DECIMAL takes with all its digits
+	text string
 }
 
 func (v *literalValue) Type() types.DataType {
@@ -169,6 +507,33 @@ func (v *literalValue) AsFloat() (float64, error) {
 	return v.floatVal, nil
 }
 
+func (v *literalValue) AsDecimal() (Decimal, error) {
+	switch v.dataType {
+	case types.TypeInt:
+		return NewDecimal(v.intVal, 0), nil
+	case types.TypeFloat:
+		if v.text != "" {
+			return ParseDecimal(v.text)
+		}
+		return decimalFromFloat(v.floatVal)
+	case types.TypeString:
+		return ParseDecimal(v.stringVal)
+	case types.TypeBool:
+		if v.boolVal {
+			return NewDecimal(1, 0), nil
+		}
+		return NewDecimal(0, 0), nil
+	}
+	return Decimal{}, fmt.Errorf("cannot convert %v to decimal", v.dataType)
+}
+
+func (v *literalValue) AsBytes() ([]byte, error) {
+	if v.dataType != types.TypeString {
+		return nil, fmt.Errorf("cannot convert %v to BLOB", v.dataType)
+	}
+	return []byte(v.stringVal), nil
+}
+
 func (v *literalValue) AsString() (string, error) {
 	return v.stringVal, nil
 }
@@ -181,21 +546,55 @@ func (v *literalValue) AsNull() (bool, error) {
 	return v.dataType == types.TypeNull, nil
 }
 
+func (v *literalValue) String() string {
+	switch v.dataType {
+	case types.TypeInt:
+		return strconv.FormatInt(v.intVal, 10)
+	case types.TypeFloat:
+		return strconv.FormatFloat(v.floatVal, 'g', -1, 64)
+	case types.TypeString:
+		return "'" + strings.ReplaceAll(v.stringVal, "'", "''") + "'"
+	case types.TypeBool:
+		if v.boolVal {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return "NULL"
+}
+
 // literalExpression represents a literal value in an expression
 type literalExpression struct {
 	val Value
 }
 
-func (e *literalExpression) Eval(row map[string]Value) (Value, error) {
+// NewLiteralExpression builds an expression with a constant value outside of the parser
+func NewLiteralExpression(val Value) LiteralExpression {
+	return &literalExpression{val: val}
+}
+
+func (e *literalExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
 	return e.val, nil
 }
 
+func (e *literalExpression) Value() Value {
+	return e.val
+}
+
+// String writes a number literal as it was written
+func (e *literalExpression) String() string {
+	if lit, ok := e.val.(*literalValue); ok && lit.text != "" {
+		return lit.text
+	}
+	return fmt.Sprint(e.val)
+}
+
 // columnExpression represents a column reference in an expression
 type columnExpression struct {
 	columnName string
 }
 
-func (e *columnExpression) Eval(row map[string]Value) (Value, error) {
+func (e *columnExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
 	val, ok := row[e.columnName]
 	if !ok {
 		return &literalValue{dataType: types.TypeNull}, nil
@@ -203,6 +602,38 @@ func (e *columnExpression) Eval(row map[string]Value) (Value, error) {
 	return val, nil
 }
 
+func (e *columnExpression) ColumnName() string {
+	return e.columnName
+}
+
+func (e *columnExpression) String() string {
+	return e.columnName
+}
+
+// sequenceExpression represents a nextval() call
+type sequenceExpression struct {
+	sequence string
+}
+
+func (e *sequenceExpression) Sequence() string {
+	return e.sequence
+}
+
+func (e *sequenceExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("nextval cannot be used here")
+	}
+	val, err := ctx.NextValue(e.sequence)
+	if err != nil {
+		return nil, err
+	}
+	return NewIntValue(val), nil
+}
+
+func (e *sequenceExpression) String() string {
+	return fmt.Sprintf("nextval(%v)", NewStringValue(e.sequence))
+}
+
 // binaryExpression represents a binary operation in an expression
 type binaryExpression struct {
 	left     Expression
@@ -210,85 +641,1155 @@ type binaryExpression struct {
 	operator string
 }
 
-func (e *binaryExpression) Eval(row map[string]Value) (Value, error) {
-	leftVal, err := e.left.Eval(row)
+// NewBinaryExpression builds a binary expression outside of the parser
+func NewBinaryExpression(operator string, left, right Expression) BinaryExpression {
+	return &binaryExpression{left: left, right: right, operator: operator}
+}
+
+func (e *binaryExpression) Operator() string {
+	return e.operator
+}
+
+func (e *binaryExpression) Left() Expression {
+	return e.left
+}
+
+func (e *binaryExpression) Right() Expression {
+	return e.right
+}
+
+func (e *binaryExpression) String() string {
+	return fmt.Sprintf("%s %s %s", e.operandString(e.left, false), e.operator, e.operandString(e.right, true))
+}
+
+// operandString formats an operand, parenthesizing it when it binds less tightly
+func (e *binaryExpression) operandString(operand Expression, right bool) string {
+	if bin, ok := operand.(*binaryExpression); ok {
+		inner, outer := precedence(bin.operator), precedence(e.operator)
+		if inner < outer || (right && inner == outer && outer > 2) {
+			return "(" + bin.String() + ")"
+		}
+	}
+	return fmt.Sprint(operand)
+}
+
+// precedence ranks binary operators from loosest to tightest binding
+func precedence(operator string) int {
+	switch operator {
+	case "OR":
+		return 1
+	case "AND":
+		return 2
+	case "+", "-", "||":
+		return 4
+	case "*", "/", "%":
+		return 5
+	case "->", "->>":
+		return 6
+	}
+	return 3
+}
+
+func (e *binaryExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	if e.operator == "AND" || e.operator == "OR" {
+		return e.evalLogical(ctx, row)
+	}
+
+	leftVal, err := e.left.Eval(ctx, row)
 	if err != nil {
 		return nil, err
 	}
 
-	rightVal, err := e.right.Eval(row)
+	rightVal, err := e.right.Eval(ctx, row)
 	if err != nil {
 		return nil, err
 	}
 
-	// For simplicity, only implement equality comparison
-	if e.operator == "=" {
-		// Handle different type combinations
-		switch leftVal.Type() {
-		case types.TypeInt:
-			leftInt, _ := leftVal.AsInt()
-
-			switch rightVal.Type() {
-			case types.TypeInt:
-				rightInt, _ := rightVal.AsInt()
-				return &literalValue{
-					dataType: types.TypeBool,
-					boolVal:  leftInt == rightInt,
-				}, nil
-			case types.TypeString:
-				// Try to convert string to int for comparison
-				rightStr, _ := rightVal.AsString()
-				var rightInt int64
-				if _, err := fmt.Sscanf(rightStr, "%d", &rightInt); err == nil {
-					return &literalValue{
-						dataType: types.TypeBool,
-						boolVal:  leftInt == rightInt,
-					}, nil
-				}
-			}
+	// Comparing anything with NULL, or computing with it, gives NULL
+	if isNull(leftVal) || isNull(rightVal) {
+		return &literalValue{dataType: types.TypeNull}, nil
+	}
+	if e.operator == "->" || e.operator == "->>" {
+		return evalJSONAccess(e.operator, leftVal, rightVal)
+	}
+	if precedence(e.operator) > 3 {
+		return evalArithmetic(e.operator, leftVal, rightVal)
+	}
 
-		case types.TypeString:
-			leftStr, _ := leftVal.AsString()
-
-			switch rightVal.Type() {
-			case types.TypeString:
-				rightStr, _ := rightVal.AsString()
-				return &literalValue{
-					dataType: types.TypeBool,
-					boolVal:  leftStr == rightStr,
-				}, nil
-			case types.TypeInt:
-				// Try to convert string to int for comparison
-				rightInt, _ := rightVal.AsInt()
-				leftIntStr := fmt.Sprintf("%d", rightInt)
-				return &literalValue{
-					dataType: types.TypeBool,
-					boolVal:  leftStr == leftIntStr,
-				}, nil
-			}
+	return evalComparison(e.operator, leftVal, rightVal)
+}
+
+// evalComparison applies a comparison operator to two non-NULL values
+func evalComparison(operator string, left, right Value) (Value, error) {
+	cmp, ok := compareValues(left, right)
+	if !ok {
+		// Values that cannot be compared are never equal
+		return newBoolValue(operator == "!="), nil
+	}
+
+	switch operator {
+	case "=":
+		return newBoolValue(cmp == 0), nil
+	case "!=":
+		return newBoolValue(cmp != 0), nil
+	case "<":
+		return newBoolValue(cmp < 0), nil
+	case "<=":
+		return newBoolValue(cmp <= 0), nil
+	case ">":
+		return newBoolValue(cmp > 0), nil
+	case ">=":
+		return newBoolValue(cmp >= 0), nil
+	}
+
+	return nil, fmt.Errorf("unsupported operator: %s", operator)
+}
+
+// evalArithmetic applies an arithmetic operator to two numbers, or || to two values
+func evalArithmetic(operator string, left, right Value) (Value, error) {
+	if operator == "||" {
+		return &literalValue{dataType: types.TypeString, stringVal: valueText(left) + valueText(right)}, nil
+	}
+
+	if holdsTime(left.Type()) || holdsTime(right.Type()) {
+		return evalTemporalArithmetic(operator, left, right)
+	}
+	if !isNumeric(left) || !isNumeric(right) {
+		return nil, fmt.Errorf("operator %s needs numeric operands, got %v and %v", operator, left, right)
+	}
+	if left.Type() == types.TypeDecimal || right.Type() == types.TypeDecimal {
+		return evalDecimalArithmetic(operator, left, right)
+	}
 
-		case types.TypeBool:
-			leftBool, _ := leftVal.AsBool()
-
-			switch rightVal.Type() {
-			case types.TypeBool:
-				rightBool, _ := rightVal.AsBool()
-				return &literalValue{
-					dataType: types.TypeBool,
-					boolVal:  leftBool == rightBool,
-				}, nil
-			case types.TypeString:
-				// Try to convert string to bool for comparison
-				rightStr, _ := rightVal.AsString()
-				rightBool := strings.EqualFold(rightStr, "true")
-				return &literalValue{
-					dataType: types.TypeBool,
-					boolVal:  leftBool == rightBool,
-				}, nil
+	if left.Type() == types.TypeInt && right.Type() == types.TypeInt {
+		l, _ := left.AsInt()
+		r, _ := right.AsInt()
+		var result int64
+		overflow := false
+		switch operator {
+		case "+":
+			result = l + r
+			overflow = (r > 0 && result < l) || (r < 0 && result > l)
+		case "-":
+			result = l - r
+			overflow = (r < 0 && result < l) || (r > 0 && result > l)
+		case "*":
+			result = l * r
+			overflow = l != 0 && (result/l != r || (l == -1 && r == math.MinInt64))
+		case "/", "%":
+			if r == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if operator == "/" {
+				result = l / r
+				overflow = l == math.MinInt64 && r == -1
+			} else {
+				result = l % r
 			}
 		}
+		if overflow {
+			return nil, fmt.Errorf("integer out of range: %d %s %d", l, operator, r)
+		}
+		return &literalValue{dataType: types.TypeInt, intVal: result}, nil
+	}
+
+	l, r := floatOf(left), floatOf(right)
+	var result float64
+	switch operator {
+	case "+":
+		result = l + r
+	case "-":
+		result = l - r
+	case "*":
+		result = l * r
+	case "/", "%":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if operator == "/" {
+			result = l / r
+		} else {
+			result = math.Mod(l, r)
+		}
+	}
+	return &literalValue{dataType: types.TypeFloat, floatVal: result}, nil
+}
+
+// isNumeric reports whether a value is an INT, a FLOAT or a DECIMAL
+func isNumeric(val Value) bool {
+	return val.Type() == types.TypeInt || val.Type() == types.TypeFloat || val.Type() == types.TypeDecimal
+}
+
+// floatOf returns a numeric value as a float
+func floatOf(val Value) float64 {
+	if val.Type() == types.TypeInt {
+		i, _ := val.AsInt()
+		return float64(i)
+	}
+	f, _ := val.AsFloat()
+	return f
+}
+
+// valueText returns a value as text
+func valueText(val Value) string {
+	if t := val.Type(); t == types.TypeString || t == types.TypeDecimal || t == types.TypeBlob || t == types.TypeJSON || holdsTime(t) {
+		s, _ := val.AsString()
+		return s
+	}
+	return fmt.Sprint(val)
+}
+
+// evalLogical evaluates AND and OR using three-valued logic
+func (e *binaryExpression) evalLogical(ctx EvalContext, row map[string]Value) (Value, error) {
+	leftVal, err := e.left.Eval(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	left, leftNull, err := truthValue(leftVal)
+	if err != nil {
+		return nil, err
 	}
 
-	// Default to false for unsupported operations or type combinations
-	return &literalValue{dataType: types.TypeBool, boolVal: false}, nil
+	// Short-circuit when the left side decides the result
+	if !leftNull && left == (e.operator == "OR") {
+		return newBoolValue(left), nil
+	}
+
+	rightVal, err := e.right.Eval(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	right, rightNull, err := truthValue(rightVal)
+	if err != nil {
+		return nil, err
+	}
+
+	if !rightNull && right == (e.operator == "OR") {
+		return newBoolValue(right), nil
+	}
+	if leftNull || rightNull {
+		return &literalValue{dataType: types.TypeNull}, nil
+	}
+	return newBoolValue(right), nil
+}
+
+// unaryExpression represents NOT or unary minus applied to an expression
+type unaryExpression struct {
+	operand  Expression
+	operator string
+}
+
+func (e *unaryExpression) Operator() string {
+	return e.operator
+}
+
+func (e *unaryExpression) Operand() Expression {
+	return e.operand
+}
+
+func (e *unaryExpression) String() string {
+	if _, ok := e.operand.(*binaryExpression); ok {
+		return fmt.Sprintf("%s (%s)", e.operator, e.operand)
+	}
+	if e.operator == "NOT" {
+		return fmt.Sprintf("NOT %s", e.operand)
+	}
+	return fmt.Sprintf("%s%s", e.operator, e.operand)
+}
+
+func (e *unaryExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	val, err := e.operand.Eval(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	if isNull(val) {
+		return &literalValue{dataType: types.TypeNull}, nil
+	}
+
+	switch e.operator {
+	case "NOT":
+		b, _, err := truthValue(val)
+		if err != nil {
+			return nil, err
+		}
+		return newBoolValue(!b), nil
+
+	case "-":
+		switch val.Type() {
+		case types.TypeInt:
+			i, _ := val.AsInt()
+			return &literalValue{dataType: types.TypeInt, intVal: -i}, nil
+		case types.TypeFloat:
+			f, _ := val.AsFloat()
+			negated := &literalValue{dataType: types.TypeFloat, floatVal: -f}
+			if lit, ok := val.(*literalValue); ok && lit.text != "" {
+				if text, found := strings.CutPrefix(lit.text, "-"); found {
+					negated.text = text
+				} else {
+					negated.text = "-" + lit.text
+				}
+			}
+			return negated, nil
+		case types.TypeDecimal:
+			return NewDecimalValue(decimalOf(val).Neg()), nil
+		case types.TypeInterval:
+			return NewIntervalValue(intervalOf(val).negate()), nil
+		}
+		return nil, fmt.Errorf("cannot negate a non-numeric value")
+	}
+
+	return nil, fmt.Errorf("unsupported operator: %s", e.operator)
+}
+
+// caseExpression represents a CASE expression
+type caseExpression struct {
+	operand  Expression
+	whens    []WhenClause
+	elseExpr Expression
+}
+
+func (e *caseExpression) Operand() Expression {
+	return e.operand
+}
+
+func (e *caseExpression) Whens() []WhenClause {
+	return e.whens
+}
+
+func (e *caseExpression) Else() Expression {
+	return e.elseExpr
+}
+
+func (e *caseExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	var operand Value
+	if e.operand != nil {
+		var err error
+		if operand, err = e.operand.Eval(ctx, row); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, when := range e.whens {
+		val, err := when.When.Eval(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := false
+		if e.operand == nil {
+			b, null, err := truthValue(val)
+			if err != nil {
+				return nil, err
+			}
+			matched = b && !null
+		} else if !isNull(operand) && !isNull(val) {
+			cmp, ok := compareValues(operand, val)
+			matched = ok && cmp == 0
+		}
+		if matched {
+			return when.Then.Eval(ctx, row)
+		}
+	}
+
+	if e.elseExpr != nil {
+		return e.elseExpr.Eval(ctx, row)
+	}
+	return &literalValue{dataType: types.TypeNull}, nil
+}
+
+func (e *caseExpression) String() string {
+	parts := []string{"CASE"}
+	if e.operand != nil {
+		parts = append(parts, fmt.Sprint(e.operand))
+	}
+	for _, when := range e.whens {
+		parts = append(parts, fmt.Sprintf("WHEN %v THEN %v", when.When, when.Then))
+	}
+	if e.elseExpr != nil {
+		parts = append(parts, fmt.Sprintf("ELSE %v", e.elseExpr))
+	}
+	return strings.Join(append(parts, "END"), " ")
+}
+
+// coalesceExpression represents COALESCE(args)
+type coalesceExpression struct {
+	args []Expression
+}
+
+func (e *coalesceExpression) Args() []Expression {
+	return e.args
+}
+
+// Eval evaluates the arguments in order until one is not NULL
+func (e *coalesceExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	for _, arg := range e.args {
+		val, err := arg.Eval(ctx, row)
+		if err != nil || !isNull(val) {
+			return val, err
+		}
+	}
+	return &literalValue{dataType: types.TypeNull}, nil
+}
+
+func (e *coalesceExpression) String() string {
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		args[i] = fmt.Sprint(arg)
+	}
+	return "COALESCE(" + strings.Join(args, ", ") + ")"
+}
+
+// nullIfExpression represents NULLIF(left, right)
+type nullIfExpression struct {
+	left  Expression
+	right Expression
+}
+
+func (e *nullIfExpression) Left() Expression {
+	return e.left
+}
+
+func (e *nullIfExpression) Right() Expression {
+	return e.right
+}
+
+func (e *nullIfExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	left, err := e.left.Eval(ctx, row)
+	if err != nil || isNull(left) {
+		return left, err
+	}
+	right, err := e.right.Eval(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	if !isNull(right) {
+		if cmp, ok := compareValues(left, right); ok && cmp == 0 {
+			return &literalValue{dataType: types.TypeNull}, nil
+		}
+	}
+	return left, nil
+}
+
+func (e *nullIfExpression) String() string {
+	return fmt.Sprintf("NULLIF(%v, %v)", e.left, e.right)
+}
+
+// castExpression represents CAST(operand AS type)
+type castExpression struct {
+	operand    Expression
+	targetType types.DataType
+	typeParams []int
+	char       bool
+}
+
+func (e *castExpression) Operand() Expression {
+	return e.operand
+}
+
+func (e *castExpression) TargetType() types.DataType {
+	return e.targetType
+}
+
+func (e *castExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	val, err := e.operand.Eval(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	val, err = Cast(val, e.targetType)
+	if err != nil || len(e.typeParams) == 0 || isNull(val) {
+		return val, err
+	}
+
+	// Unlike storing in a column, a CAST cuts text to the length of the type
+	if e.targetType == types.TypeString {
+		s, _ := val.AsString()
+		if n := e.typeParams[0]; utf8.RuneCountInString(s) > n {
+			s = string([]rune(s)[:n])
+		}
+		return NewStringValue(s), nil
+	}
+	if e.targetType != types.TypeDecimal {
+		return val, nil
+	}
+
+	// Unlike storing in a column, a CAST rounds to the scale of the type
+	precision, scale := e.typeParams[0], 0
+	if len(e.typeParams) > 1 {
+		scale = e.typeParams[1]
+	}
+	d, err := decimalOf(val).Fit(precision, scale, RoundHalfUp)
+	if err != nil {
+		return nil, err
+	}
+	return NewDecimalValue(d), nil
+}
+
+func (e *castExpression) String() string {
+	return fmt.Sprintf("CAST(%v AS %s)", e.operand, declaredTypeName(e.targetType, e.typeParams, e.char))
+}
+
+// inListExpression represents operand IN (list)
+type inListExpression struct {
+	operand Expression
+	list    []Expression
+}
+
+func (e *inListExpression) Operand() Expression {
+	return e.operand
+}
+
+func (e *inListExpression) List() []Expression {
+	return e.list
+}
+
+func (e *inListExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	operand, err := e.operand.Eval(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	if isNull(operand) {
+		return &literalValue{dataType: types.TypeNull}, nil
+	}
+
+	sawNull := false
+	for _, expr := range e.list {
+		val, err := expr.Eval(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		if isNull(val) {
+			sawNull = true
+			continue
+		}
+		if cmp, ok := compareValues(operand, val); ok && cmp == 0 {
+			return newBoolValue(true), nil
+		}
+	}
+	if sawNull {
+		return &literalValue{dataType: types.TypeNull}, nil
+	}
+	return newBoolValue(false), nil
+}
+
+func (e *inListExpression) String() string {
+	values := make([]string, len(e.list))
+	for i, expr := range e.list {
+		values[i] = fmt.Sprint(expr)
+	}
+	return fmt.Sprintf("%s IN (%s)", predicateOperand(e.operand), strings.Join(values, ", "))
+}
+
+// betweenExpression represents operand BETWEEN low AND high
+type betweenExpression struct {
+	operand Expression
+	low     Expression
+	high    Expression
+}
+
+func (e *betweenExpression) Operand() Expression {
+	return e.operand
+}
+
+func (e *betweenExpression) Low() Expression {
+	return e.low
+}
+
+func (e *betweenExpression) High() Expression {
+	return e.high
+}
+
+// Eval compares the operand with both bounds, evaluating it only once
+func (e *betweenExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	var vals [3]Value
+	for i, expr := range []Expression{e.operand, e.low, e.high} {
+		val, err := expr.Eval(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+
+	// NULL AND FALSE is FALSE, so one known bound can rule a value out
+	sawNull := false
+	for i, op := range []string{">=", "<="} {
+		if isNull(vals[0]) || isNull(vals[i+1]) {
+			sawNull = true
+			continue
+		}
+		result, err := evalComparison(op, vals[0], vals[i+1])
+		if err != nil {
+			return nil, err
+		}
+		if b, _ := result.AsBool(); !b {
+			return newBoolValue(false), nil
+		}
+	}
+	if sawNull {
+		return &literalValue{dataType: types.TypeNull}, nil
+	}
+	return newBoolValue(true), nil
+}
+
+func (e *betweenExpression) String() string {
+	return fmt.Sprintf("%s BETWEEN %s AND %s", predicateOperand(e.operand), predicateOperand(e.low), predicateOperand(e.high))
+}
+
+// likeExpression represents operand LIKE pattern [ESCAPE escape], or ILIKE
+type likeExpression struct {
+	operand         Expression
+	pattern         Expression
+	escape          Expression
+	caseInsensitive bool
+}
+
+func (e *likeExpression) Operand() Expression {
+	return e.operand
+}
+
+func (e *likeExpression) Pattern() Expression {
+	return e.pattern
+}
+
+func (e *likeExpression) Escape() Expression {
+	return e.escape
+}
+
+func (e *likeExpression) CaseInsensitive() bool {
+	return e.caseInsensitive
+}
+
+func (e *likeExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	exprs := []Expression{e.operand, e.pattern}
+	if e.escape != nil {
+		exprs = append(exprs, e.escape)
+	}
+
+	texts := make([]string, len(exprs))
+	for i, expr := range exprs {
+		val, err := expr.Eval(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		if isNull(val) {
+			return &literalValue{dataType: types.TypeNull}, nil
+		}
+		if val.Type() != types.TypeString {
+			return nil, fmt.Errorf("%s needs TEXT operands, got %v", e.keyword(), val)
+		}
+		texts[i], _ = val.AsString()
+	}
+
+	escape := ""
+	if len(texts) > 2 {
+		escape = texts[2]
+	}
+	pattern, err := compileLike(texts[1], escape)
+	if err != nil {
+		return nil, err
+	}
+
+	text := texts[0]
+	if e.caseInsensitive {
+		text = strings.ToLower(text)
+		for i := range pattern {
+			pattern[i].char = unicode.ToLower(pattern[i].char)
+		}
+	}
+	return newBoolValue(matchLike([]rune(text), pattern)), nil
+}
+
+// keyword returns LIKE or ILIKE
+func (e *likeExpression) keyword() string {
+	if e.caseInsensitive {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+func (e *likeExpression) String() string {
+	s := fmt.Sprintf("%s %s %s", predicateOperand(e.operand), e.keyword(), predicateOperand(e.pattern))
+	if e.escape != nil {
+		s += " ESCAPE " + predicateOperand(e.escape)
+	}
+	return s
+}
+
+// predicateOperand formats an operand of IN, BETWEEN or LIKE
+func predicateOperand(operand Expression) string {
+	if bin, ok := operand.(*binaryExpression); ok && precedence(bin.operator) <= 3 {
+		return "(" + bin.String() + ")"
+	}
+	return fmt.Sprint(operand)
+}
+
+// likeToken is one element of a compiled LIKE pattern
+type likeToken struct {
+	kind likeTokenKind
+	char rune
+}
+
+type likeTokenKind int
+
+const (
+	likeChar likeTokenKind = iota
+	likeAnyChar
+	likeAnyString
+)
+
+// compileLike splits a LIKE pattern into characters and wildcards
+func compileLike(pattern, escape string) ([]likeToken, error) {
+	escapeChar := rune(-1)
+	if escape != "" {
+		chars := []rune(escape)
+		if len(chars) != 1 {
+			return nil, fmt.Errorf("ESCAPE must be a single character, got '%s'", escape)
+		}
+		escapeChar = chars[0]
+	}
+
+	var tokens []likeToken
+	chars := []rune(pattern)
+	for i := 0; i < len(chars); i++ {
+		switch c := chars[i]; {
+		case c == escapeChar:
+			if i++; i == len(chars) {
+				return nil, fmt.Errorf("LIKE pattern must not end with the escape character: '%s'", pattern)
+			}
+			tokens = append(tokens, likeToken{kind: likeChar, char: chars[i]})
+		case c == '%':
+			tokens = append(tokens, likeToken{kind: likeAnyString})
+		case c == '_':
+			tokens = append(tokens, likeToken{kind: likeAnyChar})
+		default:
+			tokens = append(tokens, likeToken{kind: likeChar, char: c})
+		}
+	}
+	return tokens, nil
+}
+
+// matchLike reports whether text matches a compiled LIKE pattern
+func matchLike(text []rune, pattern []likeToken) bool {
+	t, p := 0, 0
+	star, mark := -1, 0
+	for t < len(text) {
+		switch {
+		case p < len(pattern) && pattern[p].kind == likeAnyString:
+			star, mark = p, t
+			p++
+		case p < len(pattern) && (pattern[p].kind == likeAnyChar || pattern[p].char == text[t]):
+			p++
+			t++
+		case star >= 0:
+			mark++
+			p, t = star+1, mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p].kind == likeAnyString {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// LikePrefix returns the text every value matching a LIKE pattern starts with
+func LikePrefix(pattern, escape string) (string, bool) {
+	tokens, err := compileLike(pattern, escape)
+	if err != nil {
+		return "", false
+	}
+	var prefix []rune
+	for _, tok := range tokens {
+		if tok.kind != likeChar {
+			break
+		}
+		prefix = append(prefix, tok.char)
+	}
+	return string(prefix), true
+}
+
+// functionExpression represents a function call in an expression
+type functionExpression struct {
+	name     string
+	args     []Expression
+	star     bool
+	distinct bool
+
+	// scalar is the function called, or nil for an aggregate or window function
+	scalar *ScalarFunction
+	// aggregate is the registered aggregate function called, if it is one
+	aggregate *AggregateFunction
+}
+
+func (e *functionExpression) Name() string {
+	return e.name
+}
+
+func (e *functionExpression) Args() []Expression {
+	return e.args
+}
+
+func (e *functionExpression) Star() bool {
+	return e.star
+}
+
+func (e *functionExpression) Distinct() bool {
+	return e.distinct
+}
+
+func (e *functionExpression) Scalar() *ScalarFunction {
+	return e.scalar
+}
+
+func (e *functionExpression) Aggregate() *AggregateFunction {
+	return e.aggregate
+}
+
+// Eval calls a scalar function, or looks an aggregate call up in the row
+func (e *functionExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	if val, ok := row[e.String()]; ok {
+		return val, nil
+	}
+	if e.scalar == nil {
+		return nil, fmt.Errorf("function %s cannot be used here", e.name)
+	}
+
+	args := make([]Value, len(e.args))
+	for i, arg := range e.args {
+		val, err := arg.Eval(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+	return e.scalar.Call(args)
+}
+
+func (e *functionExpression) String() string {
+	if e.star {
+		return e.name + "(*)"
+	}
+
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		args[i] = fmt.Sprint(arg)
+	}
+	if e.distinct {
+		return e.name + "(DISTINCT " + strings.Join(args, ", ") + ")"
+	}
+	return e.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// windowExpression represents a function call with an OVER clause
+type windowExpression struct {
+	function    *functionExpression
+	partitionBy []Expression
+	orderBy     []OrderByItem
+	frame       *WindowFrame
+}
+
+func (e *windowExpression) Function() FunctionExpression {
+	return e.function
+}
+
+func (e *windowExpression) PartitionBy() []Expression {
+	return e.partitionBy
+}
+
+func (e *windowExpression) OrderBy() []OrderByItem {
+	return e.orderBy
+}
+
+func (e *windowExpression) Frame() *WindowFrame {
+	return e.frame
+}
+
+// Eval looks the call up in the row, where the executor stores window results
+func (e *windowExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	if val, ok := row[e.String()]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("window function %s cannot be used here", e.function.name)
+}
+
+func (e *windowExpression) String() string {
+	var clauses []string
+	if len(e.partitionBy) > 0 {
+		exprs := make([]string, len(e.partitionBy))
+		for i, expr := range e.partitionBy {
+			exprs[i] = fmt.Sprint(expr)
+		}
+		clauses = append(clauses, "PARTITION BY "+strings.Join(exprs, ", "))
+	}
+	if len(e.orderBy) > 0 {
+		items := make([]string, len(e.orderBy))
+		for i, item := range e.orderBy {
+			items[i] = fmt.Sprint(item.Expr)
+			if item.Descending {
+				items[i] += " DESC"
+			}
+		}
+		clauses = append(clauses, "ORDER BY "+strings.Join(items, ", "))
+	}
+	if e.frame != nil {
+		mode := "RANGE"
+		if e.frame.Rows {
+			mode = "ROWS"
+		}
+		clauses = append(clauses, mode+" BETWEEN "+e.frame.Start.String()+" AND "+e.frame.End.String())
+	}
+	return e.function.String() + " OVER (" + strings.Join(clauses, " ") + ")"
+}
+
+func (b FrameBound) String() string {
+	switch b.Type {
+	case FrameUnboundedPreceding:
+		return "UNBOUNDED PRECEDING"
+	case FramePreceding:
+		return fmt.Sprintf("%d PRECEDING", b.Offset)
+	case FrameFollowing:
+		return fmt.Sprintf("%d FOLLOWING", b.Offset)
+	case FrameUnboundedFollowing:
+		return "UNBOUNDED FOLLOWING"
+	}
+	return "CURRENT ROW"
+}
+
+// subqueryExpression represents a scalar, EXISTS or IN subquery
+type subqueryExpression struct {
+	kind    SubqueryKind
+	query   SelectStatement
+	operand Expression
+
+	// text is the subquery as written, parentheses included
+	text string
+}
+
+func (e *subqueryExpression) Kind() SubqueryKind {
+	return e.kind
+}
+
+func (e *subqueryExpression) Query() SelectStatement {
+	return e.query
+}
+
+func (e *subqueryExpression) Operand() Expression {
+	return e.operand
+}
+
+// Eval runs the subquery through the context
+func (e *subqueryExpression) Eval(ctx EvalContext, row map[string]Value) (Value, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("subqueries cannot be used here")
+	}
+
+	var operand Value
+	if e.kind == SubqueryIn {
+		var err error
+		if operand, err = e.operand.Eval(ctx, row); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := ctx.Query(e.query, row)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.kind {
+	case SubqueryExists:
+		return newBoolValue(len(rows) > 0), nil
+
+	case SubqueryIn:
+		if len(rows) == 0 {
+			return newBoolValue(false), nil
+		}
+		sawNull := isNull(operand)
+		for _, values := range rows {
+			if sawNull || isNull(values[0]) {
+				sawNull = true
+				continue
+			}
+			if cmp, ok := compareValues(operand, values[0]); ok && cmp == 0 {
+				return newBoolValue(true), nil
+			}
+		}
+		if sawNull {
+			return &literalValue{dataType: types.TypeNull}, nil
+		}
+		return newBoolValue(false), nil
+	}
+
+	switch len(rows) {
+	case 0:
+		return &literalValue{dataType: types.TypeNull}, nil
+	case 1:
+		return rows[0][0], nil
+	}
+	return nil, fmt.Errorf("more than one row returned by a subquery used as an expression")
+}
+
+func (e *subqueryExpression) String() string {
+	switch e.kind {
+	case SubqueryExists:
+		return "EXISTS " + e.text
+	case SubqueryIn:
+		return fmt.Sprintf("%v IN %s", e.operand, e.text)
+	}
+	return e.text
+}
+
+// newBoolValue wraps a Go bool as a Value
+func newBoolValue(b bool) Value {
+	return &literalValue{dataType: types.TypeBool, boolVal: b}
+}
+
+// isNull reports whether a value is missing or SQL NULL
+func isNull(val Value) bool {
+	if val == nil {
+		return true
+	}
+	null, _ := val.AsNull()
+	return null
+}
+
+// truthValue interprets a value as a condition result, reporting NULL separately
+func truthValue(val Value) (bool, bool, error) {
+	if isNull(val) {
+		return false, true, nil
+	}
+	if val.Type() != types.TypeBool {
+		return false, false, fmt.Errorf("expected a boolean condition")
+	}
+	b, err := val.AsBool()
+	return b, false, err
+}
+
+// Compare orders two values the way comparison operators do
+func Compare(left, right Value) (int, bool) {
+	return compareValues(left, right)
+}
+
+// compareValues orders two non-NULL values, or returns false when they cannot be compared
+func compareValues(left, right Value) (int, bool) {
+	switch left.Type() {
+	case types.TypeInt:
+		leftInt, _ := left.AsInt()
+		switch right.Type() {
+		case types.TypeInt:
+			rightInt, _ := right.AsInt()
+			return compareInts(leftInt, rightInt), true
+		case types.TypeFloat:
+			rightFloat, _ := right.AsFloat()
+			return compareFloats(float64(leftInt), rightFloat), true
+		case types.TypeDecimal:
+			return compareDecimals(left, right), true
+		}
+
+	case types.TypeFloat:
+		leftFloat, _ := left.AsFloat()
+		switch right.Type() {
+		case types.TypeInt:
+			rightInt, _ := right.AsInt()
+			return compareFloats(leftFloat, float64(rightInt)), true
+		case types.TypeFloat:
+			rightFloat, _ := right.AsFloat()
+			return compareFloats(leftFloat, rightFloat), true
+		case types.TypeDecimal:
+			return compareDecimals(left, right), true
+		}
+
+	case types.TypeDecimal:
+		if isNumeric(right) {
+			return compareDecimals(left, right), true
+		}
+
+	case types.TypeString:
+		leftStr, _ := left.AsString()
+		if right.Type() == types.TypeString {
+			rightStr, _ := right.AsString()
+			c := comparisonCollation(left, right)
+			return strings.Compare(c.Key(leftStr), c.Key(rightStr)), true
+		}
+		// Compare the other way round and flip the result
+		cmp, ok := compareValues(right, left)
+		return -cmp, ok
+
+	case types.TypeBool:
+		leftBool, _ := left.AsBool()
+		if right.Type() == types.TypeBool {
+			rightBool, _ := right.AsBool()
+			return compareBools(leftBool, rightBool), true
+		}
+
+	case types.TypeDate, types.TypeTime, types.TypeTimestamp, types.TypeTimestampTZ, types.TypeInterval:
+		if holdsTime(right.Type()) {
+			return compareTemporal(left, right)
+		}
+
+	case types.TypeBlob:
+		if right.Type() == types.TypeBlob {
+			return bytes.Compare(bytesOf(left), bytesOf(right)), true
+		}
+
+	case types.TypeJSON:
+		switch right.Type() {
+		case types.TypeJSON:
+			return strings.Compare(textOf(left), textOf(right)), true
+		case types.TypeString:
+		default:
+			doc, _ := jsonDocument(left)
+			if scalar, ok := jsonScalar(doc); ok {
+				return compareValues(scalar, right)
+			}
+			return 0, false
+		}
+	}
+
+	if right.Type() == types.TypeJSON {
+		cmp, ok := compareValues(right, left)
+		return -cmp, ok
+	}
+
+	if right.Type() == types.TypeString {
+		// A string compared with an INT may hold a fraction
+		converted, err := Cast(right, left.Type())
+		if err != nil && left.Type() == types.TypeInt {
+			converted, err = Cast(right, types.TypeFloat)
+		}
+		if err == nil {
+			return compareValues(left, converted)
+		}
+	}
+	return 0, false
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	}
+	return 1
 }
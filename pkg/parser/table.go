@@ -0,0 +1,408 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// createTableRegex splits a CREATE TABLE statement into its name and definitions
+var createTableRegex = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(\w+)\s*\((.*)\)\s*;?$`)
+
+// parseCreateTable parses a CREATE TABLE statement
+func (p *SimpleParser) parseCreateTable(sql string) (CreateTableStatement, error) {
+	matches := createTableRegex.FindStringSubmatch(strings.TrimSpace(sql))
+	if matches == nil {
+		return nil, errors.New("invalid CREATE TABLE syntax")
+	}
+
+	stmt := &createTableStatement{tableName: matches[1]}
+	for _, item := range splitIgnoringParentheses(matches[2], ',') {
+		tp, err := newTokenParser(item, p.functions)
+		if err != nil {
+			return nil, err
+		}
+		if tp.startsTableConstraint() {
+			constraint, err := tp.parseTableConstraint()
+			if err != nil {
+				return nil, err
+			}
+			stmt.constraints = append(stmt.constraints, constraint)
+		} else {
+			col, constraints, err := tp.parseColumnDefinition()
+			if err != nil {
+				return nil, err
+			}
+			stmt.columns = append(stmt.columns, col)
+			stmt.constraints = append(stmt.constraints, constraints...)
+		}
+		if !tp.atEnd() {
+			return nil, tp.errorf("unexpected token")
+		}
+	}
+	if len(stmt.columns) == 0 {
+		return nil, fmt.Errorf("table %s needs at least one column", stmt.tableName)
+	}
+
+	if err := addAutoIncrement(stmt); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// addAutoIncrement gives the AUTOINCREMENT column of a table a sequence of its own
+func addAutoIncrement(stmt *createTableStatement) error {
+	var autoIncrement *columnDefinition
+	var primaryKey []string
+	for _, c := range stmt.columns {
+		col := c.(*columnDefinition)
+		if slices.Contains(col.constraints, types.ConstraintPrimaryKey) {
+			primaryKey = append(primaryKey, col.name)
+		}
+		if slices.Contains(col.constraints, types.ConstraintAutoIncrement) {
+			if autoIncrement != nil {
+				return fmt.Errorf("table %s has more than one AUTOINCREMENT column", stmt.tableName)
+			}
+			autoIncrement = col
+		}
+	}
+	if autoIncrement == nil {
+		return nil
+	}
+	for _, c := range stmt.constraints {
+		if c.Type == types.ConstraintPrimaryKey {
+			primaryKey = append(primaryKey, c.Columns...)
+		}
+	}
+
+	switch {
+	case autoIncrement.dataType != types.TypeInt || !slices.Contains(primaryKey, autoIncrement.name):
+		return fmt.Errorf("AUTOINCREMENT is only allowed on an INTEGER PRIMARY KEY, not column %s", autoIncrement.name)
+	case len(primaryKey) > 1:
+		return fmt.Errorf("AUTOINCREMENT column %s must be the only PRIMARY KEY column", autoIncrement.name)
+	case autoIncrement.defaultExpr != nil:
+		return fmt.Errorf("AUTOINCREMENT column %s cannot have a DEFAULT", autoIncrement.name)
+	}
+	autoIncrement.defaultExpr = &sequenceExpression{sequence: stmt.tableName + "_" + autoIncrement.name + "_seq"}
+	return nil
+}
+
+// startsTableConstraint reports whether a table constraint comes next
+func (p *tokenParser) startsTableConstraint() bool {
+	followedByKey := p.peekAt(1).typ == tokenIdent && strings.EqualFold(p.peekAt(1).text, "KEY")
+	return p.isKeyword("CONSTRAINT") || p.isKeyword("UNIQUE") || p.isKeyword("CHECK") ||
+		((p.isKeyword("PRIMARY") || p.isKeyword("FOREIGN")) && followedByKey)
+}
+
+// parseTableConstraint parses a table constraint of CREATE TABLE or ALTER TABLE ADD
+func (p *tokenParser) parseTableConstraint() (TableConstraint, error) {
+	var constraint TableConstraint
+	var err error
+	if p.matchKeyword("CONSTRAINT") {
+		if constraint.Name, err = p.expectIdent("constraint name"); err != nil {
+			return constraint, err
+		}
+	}
+
+	switch {
+	case p.matchKeyword("PRIMARY"):
+		if err := p.expectKeyword("KEY"); err != nil {
+			return constraint, err
+		}
+		constraint.Type = types.ConstraintPrimaryKey
+		constraint.Columns, err = p.parseColumnList()
+	case p.matchKeyword("UNIQUE"):
+		constraint.Type = types.ConstraintUnique
+		constraint.Columns, err = p.parseColumnList()
+	case p.matchKeyword("CHECK"):
+		constraint.Type = types.ConstraintCheck
+		constraint.Check, constraint.Columns, err = p.parseCheck()
+	case p.matchKeyword("FOREIGN"):
+		if err := p.expectKeyword("KEY"); err != nil {
+			return constraint, err
+		}
+		constraint.Type = types.ConstraintForeignKey
+		if constraint.Columns, err = p.parseColumnList(); err != nil {
+			return constraint, err
+		}
+		if err := p.expectKeyword("REFERENCES"); err != nil {
+			return constraint, err
+		}
+		err = p.parseReferences(&constraint)
+	default:
+		err = p.errorf("expected PRIMARY KEY, UNIQUE, CHECK or FOREIGN KEY")
+	}
+	return constraint, err
+}
+
+// parseReferences parses what follows REFERENCES in a foreign key
+func (p *tokenParser) parseReferences(constraint *TableConstraint) error {
+	var err error
+	if constraint.RefTable, err = p.expectIdent("table name"); err != nil {
+		return err
+	}
+	if p.peek().typ == tokenLParen {
+		if constraint.RefColumns, err = p.parseColumnList(); err != nil {
+			return err
+		}
+	}
+
+	onDelete, onUpdate := false, false
+	for p.matchKeyword("ON") {
+		var action *types.ReferentialAction
+		switch {
+		case p.matchKeyword("DELETE") && !onDelete:
+			action, onDelete = &constraint.OnDelete, true
+		case p.matchKeyword("UPDATE") && !onUpdate:
+			action, onUpdate = &constraint.OnUpdate, true
+		default:
+			return p.errorf("expected ON DELETE or ON UPDATE, each at most once")
+		}
+		if *action, err = p.parseReferentialAction(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseReferentialAction parses the action of ON DELETE or ON UPDATE
+func (p *tokenParser) parseReferentialAction() (types.ReferentialAction, error) {
+	switch {
+	case p.matchKeyword("NO"):
+		return types.ActionNoAction, p.expectKeyword("ACTION")
+	case p.matchKeyword("RESTRICT"):
+		return types.ActionRestrict, nil
+	case p.matchKeyword("CASCADE"):
+		return types.ActionCascade, nil
+	case p.matchKeyword("SET"):
+		return types.ActionSetNull, p.expectKeyword("NULL")
+	}
+	return types.ActionNoAction, p.errorf("expected NO ACTION, RESTRICT, CASCADE or SET NULL")
+}
+
+// parseColumnList parses the parenthesized columns of a key
+func (p *tokenParser) parseColumnList() ([]string, error) {
+	if _, err := p.expect(tokenLParen, "("); err != nil {
+		return nil, err
+	}
+	var columns []string
+	for {
+		col, err := p.expectIdent("column name")
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+		if !p.match(tokenComma) {
+			break
+		}
+	}
+	if _, err := p.expect(tokenRParen, ")"); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// parseCheck parses the condition of a CHECK constraint and the columns it refers to
+func (p *tokenParser) parseCheck() (Expression, []string, error) {
+	if _, err := p.expect(tokenLParen, "("); err != nil {
+		return nil, nil, err
+	}
+	cond, err := p.parseExpr()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := p.expect(tokenRParen, ")"); err != nil {
+		return nil, nil, err
+	}
+
+	columns, volatile, err := checkStored(cond)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CHECK constraint %v", err)
+	}
+	if volatile {
+		return nil, nil, fmt.Errorf("CHECK constraint %v must give the same result each time", cond)
+	}
+	return cond, columns, nil
+}
+
+// parseColumnDefinition parses a column definition and the table constraints it declares
+func (p *tokenParser) parseColumnDefinition() (*columnDefinition, []TableConstraint, error) {
+	name, err := p.expectIdent("column name")
+	if err != nil {
+		return nil, nil, err
+	}
+	typeName, err := p.parseTypeName("column type")
+	if err != nil {
+		return nil, nil, err
+	}
+	col := &columnDefinition{name: name, dataType: parseDataType(typeName), char: isCharType(typeName)}
+	if col.typeParams, err = p.parseTypeParams(typeName, col.dataType); err != nil {
+		return nil, nil, err
+	}
+
+	var constraints []TableConstraint
+	hasDefault := false
+	for !p.atEnd() {
+		constraintName := ""
+		if p.matchKeyword("CONSTRAINT") {
+			if constraintName, err = p.expectIdent("constraint name"); err != nil {
+				return nil, nil, err
+			}
+			if !p.isKeyword("PRIMARY") && !p.isKeyword("UNIQUE") && !p.isKeyword("CHECK") && !p.isKeyword("REFERENCES") {
+				return nil, nil, p.errorf("expected PRIMARY KEY, UNIQUE, CHECK or REFERENCES after CONSTRAINT %s", constraintName)
+			}
+		}
+
+		var constraint types.Constraint
+		switch {
+		case p.matchKeyword("NOT"):
+			if err := p.expectKeyword("NULL"); err != nil {
+				return nil, nil, err
+			}
+			constraint = types.ConstraintNotNull
+		case p.matchKeyword("NULL"):
+			continue
+		case p.matchKeyword("PRIMARY"):
+			if err := p.expectKeyword("KEY"); err != nil {
+				return nil, nil, err
+			}
+			constraint = types.ConstraintPrimaryKey
+		case p.matchKeyword("UNIQUE"):
+			constraint = types.ConstraintUnique
+		case p.matchKeyword("AUTOINCREMENT"):
+			constraint = types.ConstraintAutoIncrement
+		case p.matchKeyword("CHECK"):
+			cond, columns, err := p.parseCheck()
+			if err != nil {
+				return nil, nil, err
+			}
+			constraints = append(constraints, TableConstraint{
+				Name: constraintName, Type: types.ConstraintCheck, Columns: columns, Check: cond,
+			})
+			continue
+		case p.matchKeyword("REFERENCES"):
+			constraint := TableConstraint{Name: constraintName, Type: types.ConstraintForeignKey, Columns: []string{col.name}}
+			if err := p.parseReferences(&constraint); err != nil {
+				return nil, nil, err
+			}
+			constraints = append(constraints, constraint)
+			continue
+		case p.matchKeyword("COLLATE"):
+			if col.dataType != types.TypeString {
+				return nil, nil, fmt.Errorf("COLLATE applies to TEXT columns, not column %s of type %v", col.name, col.dataType)
+			}
+			if col.collation, err = p.parseCollation(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		case p.matchKeyword("DEFAULT"):
+			if hasDefault {
+				return nil, nil, fmt.Errorf("DEFAULT given more than once for column %s", col.name)
+			}
+			hasDefault = true
+			if col.defaultExpr, err = p.parseDefault(col); err != nil {
+				return nil, nil, err
+			}
+			continue
+		default:
+			return nil, nil, p.errorf("unexpected in definition of column %s", col.name)
+		}
+
+		if constraintName != "" {
+			constraints = append(constraints, TableConstraint{
+				Name: constraintName, Type: constraint, Columns: []string{col.name},
+			})
+		} else {
+			col.constraints = append(col.constraints, constraint)
+		}
+	}
+	return col, constraints, nil
+}
+
+// parseDefault parses the expression of the DEFAULT clause of a column
+func (p *tokenParser) parseDefault(col *columnDefinition) (Expression, error) {
+	if p.atEnd() {
+		return nil, fmt.Errorf("DEFAULT for column %s needs a value", col.name)
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid DEFAULT for column %s: %v", col.name, err)
+	}
+
+	columns, volatile, err := checkStored(expr)
+	if err != nil {
+		return nil, fmt.Errorf("DEFAULT for column %s %v", col.name, err)
+	}
+	if len(columns) > 0 {
+		return nil, fmt.Errorf("DEFAULT for column %s cannot refer to column %s", col.name, columns[0])
+	}
+	if volatile {
+		if t := staticTypes([]Expression{expr})[0]; !defaultTypeMatches(t, col.dataType) {
+			return nil, fmt.Errorf("DEFAULT %v does not match type %v of column %s", expr, col.dataType, col.name)
+		}
+		return expr, nil
+	}
+
+	val, err := expr.Eval(nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DEFAULT for column %s: %v", col.name, err)
+	}
+	if !defaultTypeMatches(val.Type(), col.dataType) {
+		return nil, fmt.Errorf("DEFAULT %v does not match type %v of column %s", val, col.dataType, col.name)
+	}
+	if val.Type() != col.dataType && !isNull(val) {
+		if val, err = Cast(val, col.dataType); err != nil {
+			return nil, err
+		}
+	}
+	return &literalExpression{val: val}, nil
+}
+
+// defaultTypeMatches reports whether a DEFAULT of one type can fill a column of another
+func defaultTypeMatches(valType, colType types.DataType) bool {
+	return valType == types.TypeNull || valType == colType ||
+		(valType == types.TypeInt && colType == types.TypeFloat) ||
+		(colType == types.TypeDecimal && (valType == types.TypeInt || valType == types.TypeFloat || valType == types.TypeString)) ||
+		(valType == types.TypeString && (holdsTime(colType) || colType == types.TypeBlob || colType == types.TypeJSON)) ||
+		(isInstantType(valType) && colType != types.TypeDate && isInstantType(colType))
+}
+
+// checkStored checks a DEFAULT or CHECK expression stored with a table
+func checkStored(expr Expression) ([]string, bool, error) {
+	var columns []string
+	volatile := false
+
+	switch e := expr.(type) {
+	case *sequenceExpression:
+		volatile = true
+	case *columnExpression:
+		columns = append(columns, e.columnName)
+	case *subqueryExpression:
+		return nil, false, fmt.Errorf("cannot contain a subquery")
+	case *windowExpression:
+		return nil, false, fmt.Errorf("cannot call window function %s", e.function.name)
+	case *functionExpression:
+		if e.scalar == nil {
+			return nil, false, fmt.Errorf("cannot call aggregate function %s", e.name)
+		}
+		volatile = e.scalar.Volatile
+	}
+
+	for _, child := range children(expr) {
+		childColumns, childVolatile, err := checkStored(child)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, col := range childColumns {
+			if !slices.Contains(columns, col) {
+				columns = append(columns, col)
+			}
+		}
+		volatile = volatile || childVolatile
+	}
+	return columns, volatile, nil
+}
@@ -0,0 +1,646 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // time zone names work without the zone database of the system
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+const (
+	microsPerSecond = int64(time.Second / time.Microsecond)
+	microsPerDay    = 24 * 60 * 60 * microsPerSecond
+
+	// daysPerMonth is how many days a month of an interval counts for
+	daysPerMonth = 30
+)
+
+// TemporalValue is a DATE, TIME, TIMESTAMP or TIMESTAMPTZ, held as a count from an epoch
+type TemporalValue struct {
+	dataType types.DataType
+	value    int64
+}
+
+// NewTemporalValue creates a DATE, TIME, TIMESTAMP or TIMESTAMPTZ value from its count
+func NewTemporalValue(dataType types.DataType, value int64) Value {
+	return &TemporalValue{dataType: dataType, value: value}
+}
+
+func (v *TemporalValue) Type() types.DataType {
+	return v.dataType
+}
+
+func (v *TemporalValue) AsInt() (int64, error) {
+	return v.value, nil
+}
+
+func (v *TemporalValue) AsString() (string, error) {
+	return formatTemporal(v.dataType, v.value), nil
+}
+
+func (v *TemporalValue) AsBool() (bool, error) {
+	return false, fmt.Errorf("cannot convert %v to bool", v.dataType)
+}
+
+func (v *TemporalValue) AsFloat() (float64, error) {
+	return float64(v.value), nil
+}
+
+func (v *TemporalValue) AsDecimal() (Decimal, error) {
+	return NewDecimal(v.value, 0), nil
+}
+
+func (v *TemporalValue) AsBytes() ([]byte, error) {
+	return nil, fmt.Errorf("cannot convert %v to BLOB", v.dataType)
+}
+
+func (v *TemporalValue) AsNull() (bool, error) {
+	return false, nil
+}
+
+func (v *TemporalValue) String() string {
+	return fmt.Sprintf("%v '%s'", v.dataType, formatTemporal(v.dataType, v.value))
+}
+
+// Time returns the value as a time in UTC. A TIME is taken on 1970-01-01.
+func (v *TemporalValue) Time() time.Time {
+	if v.dataType == types.TypeDate {
+		return time.UnixMicro(v.value * microsPerDay).UTC()
+	}
+	return time.UnixMicro(v.value).UTC()
+}
+
+// Interval is a span of time in months, days and microseconds
+type Interval struct {
+	Months int64
+	Days   int64
+	Micros int64
+}
+
+// String formats an interval the way INTERVAL literals are written
+func (iv Interval) String() string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	var parts []string
+	if years := iv.Months / 12; years != 0 {
+		parts = append(parts, plural(years, "year"))
+	}
+	if months := iv.Months % 12; months != 0 {
+		parts = append(parts, plural(months, "mon"))
+	}
+	if iv.Days != 0 {
+		parts = append(parts, plural(iv.Days, "day"))
+	}
+	if iv.Micros != 0 || len(parts) == 0 {
+		parts = append(parts, formatClock(iv.Micros))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Length gives the length of an interval in microseconds, with a month counting as 30 days
+func (iv Interval) Length() int64 {
+	return (iv.Months*daysPerMonth+iv.Days)*microsPerDay + iv.Micros
+}
+
+func (iv Interval) add(other Interval) Interval {
+	return Interval{Months: iv.Months + other.Months, Days: iv.Days + other.Days, Micros: iv.Micros + other.Micros}
+}
+
+func (iv Interval) negate() Interval {
+	return Interval{Months: -iv.Months, Days: -iv.Days, Micros: -iv.Micros}
+}
+
+// IntervalValue is a value of type INTERVAL
+type IntervalValue struct {
+	interval Interval
+}
+
+// NewIntervalValue creates an INTERVAL value
+func NewIntervalValue(interval Interval) Value {
+	return &IntervalValue{interval: interval}
+}
+
+// Interval returns the span of time the value holds
+func (v *IntervalValue) Interval() Interval {
+	return v.interval
+}
+
+func (v *IntervalValue) Type() types.DataType {
+	return types.TypeInterval
+}
+
+func (v *IntervalValue) AsInt() (int64, error) {
+	return 0, fmt.Errorf("cannot convert INTERVAL to int")
+}
+
+func (v *IntervalValue) AsString() (string, error) {
+	return v.interval.String(), nil
+}
+
+func (v *IntervalValue) AsBool() (bool, error) {
+	return false, fmt.Errorf("cannot convert INTERVAL to bool")
+}
+
+func (v *IntervalValue) AsFloat() (float64, error) {
+	return 0, fmt.Errorf("cannot convert INTERVAL to float")
+}
+
+func (v *IntervalValue) AsDecimal() (Decimal, error) {
+	return Decimal{}, fmt.Errorf("cannot convert INTERVAL to decimal")
+}
+
+func (v *IntervalValue) AsBytes() ([]byte, error) {
+	return nil, fmt.Errorf("cannot convert INTERVAL to BLOB")
+}
+
+func (v *IntervalValue) AsNull() (bool, error) {
+	return false, nil
+}
+
+func (v *IntervalValue) String() string {
+	return fmt.Sprintf("INTERVAL '%s'", v.interval)
+}
+
+// intervalOf returns the span of time an INTERVAL value holds
+func intervalOf(val Value) Interval {
+	if v, ok := val.(interface{ Interval() Interval }); ok {
+		return v.Interval()
+	}
+	return Interval{}
+}
+
+// holdsTime reports whether a type is one of the temporal types or INTERVAL
+func holdsTime(t types.DataType) bool {
+	return t.IsTemporal() || t == types.TypeInterval
+}
+
+// isInstantType reports whether a type is DATE, TIMESTAMP or TIMESTAMPTZ
+func isInstantType(t types.DataType) bool {
+	return t == types.TypeDate || t == types.TypeTimestamp || t == types.TypeTimestampTZ
+}
+
+// timestampMicros returns a DATE, TIMESTAMP or TIMESTAMPTZ as microseconds since 1970
+func timestampMicros(val Value) int64 {
+	i, _ := val.AsInt()
+	if val.Type() == types.TypeDate {
+		return i * microsPerDay
+	}
+	return i
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func floorMod(a, b int64) int64 {
+	return a - floorDiv(a, b)*b
+}
+
+// Formats of the text of temporal values
+var (
+	timestampPattern     = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})(?:(?:\s+|T)(\d{1,2}):(\d{2})(?::(\d{2})(?:\.(\d+))?)?)?\s*(\S*)$`)
+	clockPattern         = regexp.MustCompile(`^(\d{1,2}):(\d{2})(?::(\d{2})(?:\.(\d+))?)?$`)
+	intervalClockPattern = regexp.MustCompile(`^([+-]?)(\d+):(\d{2})(?::(\d{2})(?:\.(\d+))?)?$`)
+	zoneOffsetPattern    = regexp.MustCompile(`^([+-])(\d{1,2})(?::?(\d{2}))?$`)
+)
+
+// parseTemporal parses text as a value of a temporal type or INTERVAL
+func parseTemporal(s string, to types.DataType) (Value, error) {
+	text := strings.TrimSpace(s)
+	invalid := fmt.Errorf("invalid %v value: '%s'", to, s)
+
+	switch to {
+	case types.TypeInterval:
+		iv, err := parseInterval(text)
+		if err != nil {
+			return nil, invalid
+		}
+		return NewIntervalValue(iv), nil
+	case types.TypeTime:
+		m := clockPattern.FindStringSubmatch(text)
+		if m == nil {
+			return nil, invalid
+		}
+		micros, ok := clockMicros(m[1], m[2], m[3], m[4])
+		if !ok {
+			return nil, invalid
+		}
+		return NewTemporalValue(types.TypeTime, micros), nil
+	}
+
+	m := timestampPattern.FindStringSubmatch(text)
+	if m == nil || (to == types.TypeDate && (m[4] != "" || m[8] != "")) {
+		return nil, invalid
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Month() != time.Month(month) || date.Day() != day {
+		return nil, invalid
+	}
+	if to == types.TypeDate {
+		return NewTemporalValue(types.TypeDate, date.Unix()/(microsPerDay/microsPerSecond)), nil
+	}
+
+	var clock int64
+	if m[4] != "" {
+		var ok bool
+		if clock, ok = clockMicros(m[4], m[5], m[6], m[7]); !ok {
+			return nil, invalid
+		}
+	}
+	zone := time.UTC
+	if m[8] != "" {
+		var err error
+		if zone, err = loadZone(m[8]); err != nil {
+			return nil, fmt.Errorf("%v: %v", invalid, err)
+		}
+	}
+	if to == types.TypeTimestamp {
+		return NewTemporalValue(types.TypeTimestamp, date.UnixMicro()+clock), nil
+	}
+
+	// The wall clock time in the zone gives the instant
+	wall := time.UnixMicro(date.UnixMicro() + clock).UTC()
+	instant := time.Date(year, time.Month(month), day, wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), zone)
+	return NewTemporalValue(types.TypeTimestampTZ, instant.UnixMicro()), nil
+}
+
+// clockMicros gives the microseconds since midnight of a time of day
+func clockMicros(hours, minutes, seconds, fraction string) (int64, bool) {
+	h, _ := strconv.ParseInt(hours, 10, 64)
+	m, _ := strconv.ParseInt(minutes, 10, 64)
+	s, _ := strconv.ParseInt(seconds, 10, 64)
+	if h > 23 || m > 59 || s > 59 {
+		return 0, false
+	}
+	// Digits beyond microseconds are dropped
+	frac, _ := strconv.ParseInt((fraction + "000000")[:6], 10, 64)
+	return ((h*60+m)*60+s)*microsPerSecond + frac, true
+}
+
+// loadZone finds a time zone by name or by its offset east of UTC
+func loadZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if m := zoneOffsetPattern.FindStringSubmatch(name); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3])
+		if hours > 15 || minutes > 59 {
+			return nil, fmt.Errorf("time zone offset '%s' is out of range", name)
+		}
+		offset := (hours*60 + minutes) * 60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	}
+	if strings.EqualFold(name, "Z") || strings.EqualFold(name, "UTC") || strings.EqualFold(name, "GMT") {
+		return time.UTC, nil
+	}
+	zone, err := time.LoadLocation(name)
+	if err != nil || name == "" || name == "Local" {
+		return nil, fmt.Errorf("unknown time zone '%s'", name)
+	}
+	return zone, nil
+}
+
+// formatTemporal formats the count of a temporal value as text
+func formatTemporal(dataType types.DataType, value int64) string {
+	switch dataType {
+	case types.TypeDate:
+		return time.UnixMicro(value * microsPerDay).UTC().Format("2006-01-02")
+	case types.TypeTime:
+		return time.UnixMicro(value).UTC().Format("15:04:05.999999")
+	case types.TypeTimestamp:
+		return time.UnixMicro(value).UTC().Format("2006-01-02 15:04:05.999999")
+	}
+	return time.UnixMicro(value).UTC().Format("2006-01-02 15:04:05.999999-07")
+}
+
+// formatClock formats microseconds as hours, minutes and seconds
+func formatClock(micros int64) string {
+	sign := ""
+	if micros < 0 {
+		sign, micros = "-", -micros
+	}
+	seconds := micros / microsPerSecond
+	text := fmt.Sprintf("%s%02d:%02d:%02d", sign, seconds/3600, seconds/60%60, seconds%60)
+	if frac := micros % microsPerSecond; frac != 0 {
+		text += strings.TrimRight(fmt.Sprintf(".%06d", frac), "0")
+	}
+	return text
+}
+
+// intervalUnit is how many months, days and microseconds a unit of an interval stands for
+type intervalUnit struct {
+	months, days, micros float64
+}
+
+// intervalUnits are the units of intervals by name
+var intervalUnits = map[string]intervalUnit{
+	"microsecond": {micros: 1}, "us": {micros: 1}, "usec": {micros: 1},
+	"millisecond": {micros: 1e3}, "ms": {micros: 1e3}, "msec": {micros: 1e3},
+	"second": {micros: 1e6}, "s": {micros: 1e6}, "sec": {micros: 1e6},
+	"minute": {micros: 60e6}, "m": {micros: 60e6}, "min": {micros: 60e6},
+	"hour": {micros: 3600e6}, "h": {micros: 3600e6}, "hr": {micros: 3600e6},
+	"day": {days: 1}, "d": {days: 1},
+	"week": {days: 7}, "w": {days: 7},
+	"month": {months: 1}, "mon": {months: 1},
+	"year": {months: 12}, "y": {months: 12}, "yr": {months: 12},
+	"decade":  {months: 120},
+	"century": {months: 1200}, "centuries": {months: 1200},
+	"millennium": {months: 12000}, "millennia": {months: 12000},
+}
+
+// parseInterval parses the text of an interval, such as '1 year 2 months'
+func parseInterval(text string) (Interval, error) {
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) > 0 && fields[0] == "@" {
+		fields = fields[1:]
+	}
+	ago := len(fields) > 0 && fields[len(fields)-1] == "ago"
+	if ago {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		return Interval{}, fmt.Errorf("empty interval")
+	}
+
+	var months, days, micros float64
+	for i := 0; i < len(fields); i++ {
+		if m := intervalClockPattern.FindStringSubmatch(fields[i]); m != nil {
+			minutes, _ := strconv.ParseInt(m[3], 10, 64)
+			seconds, _ := strconv.ParseInt(m[4], 10, 64)
+			if minutes > 59 || seconds > 59 {
+				return Interval{}, fmt.Errorf("invalid time %s", fields[i])
+			}
+			hours, err := strconv.ParseInt(m[2], 10, 64)
+			if err != nil {
+				return Interval{}, err
+			}
+			clock, _ := clockMicros("0", m[3], m[4], m[5])
+			clock += float64ToMicros(float64(hours) * 3600e6)
+			if m[1] == "-" {
+				clock = -clock
+			}
+			micros += float64(clock)
+			continue
+		}
+
+		amount, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+			return Interval{}, fmt.Errorf("invalid amount %s", fields[i])
+		}
+		unit := intervalUnit{micros: 1e6}
+		if i+1 < len(fields) && intervalClockPattern.MatchString(fields[i+1]) {
+			unit = intervalUnits["day"]
+		} else if i+1 < len(fields) {
+			i++
+			name := fields[i]
+			u, ok := intervalUnits[name]
+			if !ok {
+				u, ok = intervalUnits[strings.TrimSuffix(name, "s")]
+			}
+			if !ok {
+				return Interval{}, fmt.Errorf("unknown unit %s", name)
+			}
+			unit = u
+		}
+		months += amount * unit.months
+		days += amount * unit.days
+		micros += amount * unit.micros
+	}
+
+	iv, err := spillInterval(months, days, micros)
+	if err != nil {
+		return Interval{}, err
+	}
+	if ago {
+		iv = iv.negate()
+	}
+	return iv, nil
+}
+
+// float64ToMicros rounds a number of microseconds to a whole one
+func float64ToMicros(f float64) int64 {
+	return int64(math.Round(f))
+}
+
+// spillInterval makes an interval of amounts that may have fractions
+func spillInterval(months, days, micros float64) (Interval, error) {
+	wholeMonths := math.Trunc(months)
+	days += (months - wholeMonths) * daysPerMonth
+	wholeDays := math.Trunc(days)
+	micros += (days - wholeDays) * float64(microsPerDay)
+
+	const limit = 1 << 62
+	if math.Abs(wholeMonths) >= limit || math.Abs(wholeDays) >= limit || math.Abs(micros) >= limit ||
+		math.IsNaN(micros) {
+		return Interval{}, fmt.Errorf("interval out of range")
+	}
+	return Interval{Months: int64(wholeMonths), Days: int64(wholeDays), Micros: float64ToMicros(micros)}, nil
+}
+
+// temporalCasts are the conversions CAST makes between temporal types and INTERVAL
+var temporalCasts = map[[2]types.DataType]bool{
+	{types.TypeDate, types.TypeTimestamp}:        true,
+	{types.TypeDate, types.TypeTimestampTZ}:      true,
+	{types.TypeTimestamp, types.TypeDate}:        true,
+	{types.TypeTimestamp, types.TypeTime}:        true,
+	{types.TypeTimestamp, types.TypeTimestampTZ}: true,
+	{types.TypeTimestampTZ, types.TypeDate}:      true,
+	{types.TypeTimestampTZ, types.TypeTime}:      true,
+	{types.TypeTimestampTZ, types.TypeTimestamp}: true,
+	{types.TypeTime, types.TypeInterval}:         true,
+}
+
+// castTemporal converts a value of a temporal type or INTERVAL to another type
+func castTemporal(val Value, to types.DataType) (Value, error) {
+	switch to {
+	case types.TypeString:
+		s, _ := val.AsString()
+		return textValue(s), nil
+	case types.TypeDate:
+		return NewTemporalValue(types.TypeDate, floorDiv(timestampMicros(val), microsPerDay)), nil
+	case types.TypeTime:
+		return NewTemporalValue(types.TypeTime, floorMod(timestampMicros(val), microsPerDay)), nil
+	case types.TypeTimestamp, types.TypeTimestampTZ:
+		return NewTemporalValue(to, timestampMicros(val)), nil
+	case types.TypeInterval:
+		return NewIntervalValue(Interval{Micros: intOf(val)}), nil
+	}
+	return nil, fmt.Errorf("cannot cast %v to %v", val.Type(), to)
+}
+
+// ArithmeticType gives the result type of an arithmetic operator, or NULL
+func ArithmeticType(operator string, left, right types.DataType) types.DataType {
+	if operator == "||" {
+		return types.TypeString
+	}
+	if holdsTime(left) || holdsTime(right) {
+		if left == types.TypeNull || right == types.TypeNull {
+			return types.TypeNull
+		}
+		return temporalArithmeticType(operator, left, right)
+	}
+	if left == types.TypeDecimal || right == types.TypeDecimal {
+		return types.TypeDecimal
+	}
+	if left == types.TypeFloat || right == types.TypeFloat {
+		return types.TypeFloat
+	}
+	if left == types.TypeInt && right == types.TypeInt {
+		return types.TypeInt
+	}
+	return types.TypeNull
+}
+
+// commutes reports whether the operands of a temporal operator are swapped
+func commutes(operator string, left, right types.DataType) bool {
+	switch operator {
+	case "+":
+		return (right.IsTemporal() && !left.IsTemporal()) || (left == types.TypeTime && right == types.TypeDate)
+	case "*":
+		return left != types.TypeInterval
+	}
+	return false
+}
+
+func temporalArithmeticType(operator string, left, right types.DataType) types.DataType {
+	if commutes(operator, left, right) {
+		left, right = right, left
+	}
+	numeric := right == types.TypeInt || right == types.TypeFloat || right == types.TypeDecimal
+
+	switch operator {
+	case "+", "-":
+		switch {
+		case left == types.TypeDate && right == types.TypeInt:
+			return types.TypeDate
+		case left == types.TypeDate && right == types.TypeDate && operator == "-":
+			return types.TypeInt
+		case left == types.TypeDate && (right == types.TypeInterval || (right == types.TypeTime && operator == "+")):
+			return types.TypeTimestamp
+		case left != types.TypeDate && left.IsTemporal() && right == types.TypeInterval:
+			return left
+		case isInstantType(left) && isInstantType(right) && operator == "-":
+			return types.TypeInterval
+		case left == types.TypeTime && right == types.TypeTime && operator == "-":
+			return types.TypeInterval
+		case left == types.TypeInterval && right == types.TypeInterval:
+			return types.TypeInterval
+		}
+	case "*", "/":
+		if left == types.TypeInterval && numeric {
+			return types.TypeInterval
+		}
+	}
+	return types.TypeNull
+}
+
+// evalTemporalArithmetic applies an arithmetic operator to temporal values or INTERVALs
+func evalTemporalArithmetic(operator string, left, right Value) (Value, error) {
+	result := ArithmeticType(operator, left.Type(), right.Type())
+	if result == types.TypeNull {
+		return nil, fmt.Errorf("operator %s cannot be applied to %v and %v", operator, left.Type(), right.Type())
+	}
+	if commutes(operator, left.Type(), right.Type()) {
+		left, right = right, left
+	}
+	sign := int64(1)
+	if operator == "-" {
+		sign = -1
+	}
+
+	switch {
+	case operator == "*" || operator == "/":
+		return scaleInterval(intervalOf(left), right, operator == "/")
+	case left.Type() == types.TypeInterval:
+		iv := intervalOf(right)
+		if sign < 0 {
+			iv = iv.negate()
+		}
+		return NewIntervalValue(intervalOf(left).add(iv)), nil
+	case left.Type() == types.TypeTime && right.Type() == types.TypeTime:
+		return NewIntervalValue(Interval{Micros: intOf(left) - intOf(right)}), nil
+	case left.Type() == types.TypeTime:
+		return NewTemporalValue(types.TypeTime, floorMod(intOf(left)+sign*intervalOf(right).Micros, microsPerDay)), nil
+	case right.Type() == types.TypeInt:
+		return NewTemporalValue(types.TypeDate, intOf(left)+sign*intOf(right)), nil
+	case result == types.TypeInt:
+		return intValue(intOf(left) - intOf(right)), nil
+	case right.Type() == types.TypeTime:
+		return NewTemporalValue(types.TypeTimestamp, timestampMicros(left)+intOf(right)), nil
+	case right.Type() == types.TypeInterval:
+		iv := intervalOf(right)
+		if sign < 0 {
+			iv = iv.negate()
+		}
+		return NewTemporalValue(result, addInterval(timestampMicros(left), iv)), nil
+	}
+
+	diff := timestampMicros(left) - timestampMicros(right)
+	return NewIntervalValue(Interval{Days: diff / microsPerDay, Micros: diff % microsPerDay}), nil
+}
+
+// addInterval adds an interval to a timestamp in microseconds
+func addInterval(micros int64, iv Interval) int64 {
+	if iv.Months != 0 {
+		year, month, day := time.UnixMicro(micros).UTC().Date()
+		months := int64(year)*12 + int64(month-1) + iv.Months
+		year, month = int(floorDiv(months, 12)), time.Month(floorMod(months, 12)+1)
+		if last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day(); day > last {
+			day = last
+		}
+		micros = time.Date(year, month, day, 0, 0, 0, 0, time.UTC).UnixMicro() + floorMod(micros, microsPerDay)
+	}
+	return micros + iv.Days*microsPerDay + iv.Micros
+}
+
+// scaleInterval multiplies or divides an interval by a number
+func scaleInterval(iv Interval, factor Value, divide bool) (Value, error) {
+	if factor.Type() == types.TypeInt && !divide {
+		k := intOf(factor)
+		return NewIntervalValue(Interval{Months: iv.Months * k, Days: iv.Days * k, Micros: iv.Micros * k}), nil
+	}
+	f := floatOf(factor)
+	if divide {
+		if f == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		f = 1 / f
+	}
+	scaled, err := spillInterval(float64(iv.Months)*f, float64(iv.Days)*f, float64(iv.Micros)*f)
+	if err != nil {
+		return nil, err
+	}
+	return NewIntervalValue(scaled), nil
+}
+
+// compareTemporal orders two values of temporal types or INTERVALs
+func compareTemporal(left, right Value) (int, bool) {
+	switch {
+	case isInstantType(left.Type()) && isInstantType(right.Type()):
+		return compareInts(timestampMicros(left), timestampMicros(right)), true
+	case left.Type() == types.TypeTime && right.Type() == types.TypeTime:
+		return compareInts(intOf(left), intOf(right)), true
+	case left.Type() == types.TypeInterval && right.Type() == types.TypeInterval:
+		return compareInts(intervalOf(left).Length(), intervalOf(right).Length()), true
+	}
+	return 0, false
+}
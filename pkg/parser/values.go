@@ -3,6 +3,7 @@ package parser
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
@@ -38,6 +39,14 @@ func (v *IntValue) AsFloat() (float64, error) {
 	return float64(v.value), nil
 }
 
+func (v *IntValue) AsDecimal() (Decimal, error) {
+	return NewDecimal(v.value, 0), nil
+}
+
+func (v *IntValue) AsBytes() ([]byte, error) {
+	return nil, fmt.Errorf("cannot convert INT to BLOB")
+}
+
 func (v *IntValue) AsNull() (bool, error) {
 	return false, nil
 }
@@ -94,6 +103,14 @@ func (v *StringValue) AsFloat() (float64, error) {
 	return f, nil
 }
 
+func (v *StringValue) AsDecimal() (Decimal, error) {
+	return ParseDecimal(v.value)
+}
+
+func (v *StringValue) AsBytes() ([]byte, error) {
+	return []byte(v.value), nil
+}
+
 func (v *StringValue) AsNull() (bool, error) {
 	return false, nil
 }
@@ -138,6 +155,15 @@ func (v *BoolValue) AsFloat() (float64, error) {
 	return 0.0, nil
 }
 
+func (v *BoolValue) AsDecimal() (Decimal, error) {
+	i, _ := v.AsInt()
+	return NewDecimal(i, 0), nil
+}
+
+func (v *BoolValue) AsBytes() ([]byte, error) {
+	return nil, fmt.Errorf("cannot convert BOOL to BLOB")
+}
+
 func (v *BoolValue) AsNull() (bool, error) {
 	return false, nil
 }
@@ -176,6 +202,14 @@ func (v *FloatValue) AsFloat() (float64, error) {
 	return v.value, nil
 }
 
+func (v *FloatValue) AsDecimal() (Decimal, error) {
+	return decimalFromFloat(v.value)
+}
+
+func (v *FloatValue) AsBytes() ([]byte, error) {
+	return nil, fmt.Errorf("cannot convert FLOAT to BLOB")
+}
+
 func (v *FloatValue) AsNull() (bool, error) {
 	return false, nil
 }
@@ -212,6 +246,14 @@ func (v *NullValue) AsFloat() (float64, error) {
 	return 0, fmt.Errorf("cannot convert NULL to float")
 }
 
+func (v *NullValue) AsDecimal() (Decimal, error) {
+	return Decimal{}, fmt.Errorf("cannot convert NULL to decimal")
+}
+
+func (v *NullValue) AsBytes() ([]byte, error) {
+	return nil, fmt.Errorf("cannot convert NULL to BLOB")
+}
+
 func (v *NullValue) AsNull() (bool, error) {
 	return true, nil
 }
@@ -219,3 +261,63 @@ func (v *NullValue) AsNull() (bool, error) {
 func (v *NullValue) String() string {
 	return "NULL"
 }
+
+// Equal reports whether two values are the same in the sense of DISTINCT and GROUP BY
+func Equal(a, b Value) bool {
+	return HashKey([]Value{a}) == HashKey([]Value{b})
+}
+
+// HashKey encodes a tuple of values so that Equal tuples have the same key
+func HashKey(values []Value) string {
+	var buf []byte
+	for _, val := range values {
+		if val == nil {
+			buf = append(buf, 'n', ';')
+			continue
+		}
+
+		switch val.Type() {
+		case types.TypeInt:
+			i, _ := val.AsInt()
+			buf = strconv.AppendInt(append(buf, 'i'), i, 10)
+		case types.TypeFloat:
+			f, _ := val.AsFloat()
+			// A whole number is encoded like the INT with its value, which
+			// also makes 0 and -0 the same
+			if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+				buf = strconv.AppendInt(append(buf, 'i'), int64(f), 10)
+			} else {
+				buf = strconv.AppendFloat(append(buf, 'f'), f, 'g', -1, 64)
+			}
+		case types.TypeDecimal:
+			buf = appendDecimalHash(buf, decimalOf(val))
+		case types.TypeString:
+			s, _ := val.AsString()
+			s = CollationOf(val).Key(s)
+			// The length keeps strings that contain separators apart
+			buf = strconv.AppendInt(append(buf, 's'), int64(len(s)), 10)
+			buf = append(append(buf, ':'), s...)
+		case types.TypeBlob:
+			b := bytesOf(val)
+			buf = strconv.AppendInt(append(buf, 'x'), int64(len(b)), 10)
+			buf = append(append(buf, ':'), b...)
+		case types.TypeJSON:
+			s, _ := val.AsString()
+			buf = strconv.AppendInt(append(buf, 'j'), int64(len(s)), 10)
+			buf = append(append(buf, ':'), s...)
+		case types.TypeBool:
+			b, _ := val.AsBool()
+			buf = strconv.AppendBool(append(buf, 'b'), b)
+		case types.TypeDate, types.TypeTimestamp, types.TypeTimestampTZ:
+			buf = strconv.AppendInt(append(buf, 'T'), timestampMicros(val), 10)
+		case types.TypeTime:
+			buf = strconv.AppendInt(append(buf, 't'), intOf(val), 10)
+		case types.TypeInterval:
+			buf = strconv.AppendInt(append(buf, 'v'), intervalOf(val).Length(), 10)
+		default:
+			buf = append(buf, 'n')
+		}
+		buf = append(buf, ';')
+	}
+	return string(buf)
+}
@@ -0,0 +1,122 @@
+package parser
+
+import "slices"
+
+// children returns the expressions an expression is computed from
+func children(expr Expression) []Expression {
+	switch e := expr.(type) {
+	case *functionExpression:
+		return e.args
+	case *windowExpression:
+		result := append([]Expression{e.function}, e.partitionBy...)
+		for _, item := range e.orderBy {
+			result = append(result, item.Expr)
+		}
+		return result
+	case *subqueryExpression:
+		return []Expression{e.operand}
+	case *binaryExpression:
+		return []Expression{e.left, e.right}
+	case *unaryExpression:
+		return []Expression{e.operand}
+	case *caseExpression:
+		result := []Expression{e.operand, e.elseExpr}
+		for _, when := range e.whens {
+			result = append(result, when.When, when.Then)
+		}
+		return result
+	case *coalesceExpression:
+		return e.args
+	case *nullIfExpression:
+		return []Expression{e.left, e.right}
+	case *castExpression:
+		return []Expression{e.operand}
+	case *collateExpression:
+		return []Expression{e.operand}
+	case *inListExpression:
+		return append([]Expression{e.operand}, e.list...)
+	case *betweenExpression:
+		return []Expression{e.operand, e.low, e.high}
+	case *likeExpression:
+		return []Expression{e.operand, e.pattern, e.escape}
+	}
+	return nil
+}
+
+// RenameColumn returns a copy of expr that refers to column to instead of from
+func RenameColumn(expr Expression, from, to string) Expression {
+	rename := func(e Expression) Expression {
+		return RenameColumn(e, from, to)
+	}
+	renameAll := func(exprs []Expression) []Expression {
+		result := make([]Expression, len(exprs))
+		for i, e := range exprs {
+			result[i] = rename(e)
+		}
+		return result
+	}
+
+	switch e := expr.(type) {
+	case *columnExpression:
+		if e.columnName == from {
+			return &columnExpression{columnName: to}
+		}
+	case *functionExpression:
+		c := *e
+		c.args = renameAll(e.args)
+		return &c
+	case *binaryExpression:
+		c := *e
+		c.left, c.right = rename(e.left), rename(e.right)
+		return &c
+	case *unaryExpression:
+		c := *e
+		c.operand = rename(e.operand)
+		return &c
+	case *caseExpression:
+		c := *e
+		c.operand, c.elseExpr = rename(e.operand), rename(e.elseExpr)
+		c.whens = make([]WhenClause, len(e.whens))
+		for i, when := range e.whens {
+			c.whens[i] = WhenClause{When: rename(when.When), Then: rename(when.Then)}
+		}
+		return &c
+	case *coalesceExpression:
+		return &coalesceExpression{args: renameAll(e.args)}
+	case *nullIfExpression:
+		return &nullIfExpression{left: rename(e.left), right: rename(e.right)}
+	case *castExpression:
+		c := *e
+		c.operand = rename(e.operand)
+		return &c
+	case *collateExpression:
+		return &collateExpression{operand: rename(e.operand), collation: e.collation}
+	case *inListExpression:
+		return &inListExpression{operand: rename(e.operand), list: renameAll(e.list)}
+	case *betweenExpression:
+		return &betweenExpression{operand: rename(e.operand), low: rename(e.low), high: rename(e.high)}
+	case *likeExpression:
+		c := *e
+		c.operand, c.pattern, c.escape = rename(e.operand), rename(e.pattern), rename(e.escape)
+		return &c
+	}
+	return expr
+}
+
+// ColumnsOf returns the columns an expression refers to, each once, in order
+func ColumnsOf(expr Expression) []string {
+	var columns []string
+	var walk func(Expression)
+	walk = func(e Expression) {
+		if col, ok := e.(*columnExpression); ok && !slices.Contains(columns, col.columnName) {
+			columns = append(columns, col.columnName)
+		}
+		for _, child := range children(e) {
+			if child != nil {
+				walk(child)
+			}
+		}
+	}
+	walk(expr)
+	return columns
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+)
+
+// AccessPath tells a storage engine how to find the candidate rows of a query
+type AccessPath struct {
+	// Index names the index to read through; empty means a full table scan
+	Index string
+
+	// Ranges lists the index key ranges to read, each returned in index order
+	Ranges []KeyRange
+}
+
+// IsFullScan reports whether the path reads the whole table
+func (p AccessPath) IsFullScan() bool {
+	return p.Index == ""
+}
+
+// KeyRange is a range of index keys over a prefix of the index columns
+type KeyRange struct {
+	Low           []parser.Value
+	LowInclusive  bool
+	High          []parser.Value
+	HighInclusive bool
+}
+
+// PointRange returns the range of keys that start with the given values
+func PointRange(values []parser.Value) KeyRange {
+	return KeyRange{
+		Low:           values,
+		LowInclusive:  true,
+		High:          values,
+		HighInclusive: true,
+	}
+}
+
+// IsPoint reports whether the range matches a single key prefix
+func (r KeyRange) IsPoint() bool {
+	return r.Low != nil && r.High != nil && r.LowInclusive && r.HighInclusive &&
+		bytes.Equal(EncodeKey(r.Low), EncodeKey(r.High))
+}
+
+// KeyBounds is a KeyRange encoded for comparison against index keys
+type KeyBounds struct {
+	low           []byte
+	high          []byte
+	lowInclusive  bool
+	highInclusive bool
+}
+
+// Bounds encodes the range with EncodeKey
+func (r KeyRange) Bounds() KeyBounds {
+	b := KeyBounds{
+		lowInclusive:  r.LowInclusive,
+		highInclusive: r.HighInclusive,
+	}
+	if r.Low != nil {
+		b.low = EncodeKey(r.Low)
+	}
+	if r.High != nil {
+		b.high = EncodeKey(r.High)
+	}
+	return b
+}
+
+// Start returns the smallest key that can be in the range, or nil when it is open below
+func (b KeyBounds) Start() []byte {
+	return b.low
+}
+
+// Compare reports whether an encoded key sorts before (-1), inside (0) or after (1) the range
+func (b KeyBounds) Compare(key []byte) int {
+	if b.low != nil {
+		cmp := bytes.Compare(truncateKey(key, len(b.low)), b.low)
+		if cmp < 0 || (cmp == 0 && !b.lowInclusive) {
+			return -1
+		}
+	}
+	if b.high != nil {
+		cmp := bytes.Compare(truncateKey(key, len(b.high)), b.high)
+		if cmp > 0 || (cmp == 0 && !b.highInclusive) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// truncateKey cuts a key down to at most n bytes
+func truncateKey(key []byte, n int) []byte {
+	if len(key) > n {
+		return key[:n]
+	}
+	return key
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// BlobStorage is implemented by storage engines that read and write BLOBs in pieces
+type BlobStorage interface {
+	// OpenBlob returns a reader of the BLOB in a column of the row of a
+	// table with the given primary key. The table may not be changed until
+	// the reader is closed.
+	OpenBlob(tableName, column string, key []parser.Value) (BlobReader, error)
+
+	// WriteBlob replaces the value of a BLOB column of the row of a table
+	// with the given primary key by the bytes read from r, and returns how
+	// many there were. The column must not be covered by an index or a
+	// constraint, which would need the whole value.
+	WriteBlob(tableName, column string, key []parser.Value, r io.Reader) (int64, error)
+}
+
+// BlobReader reads a stored BLOB from its start
+type BlobReader interface {
+	io.ReadCloser
+
+	// Size returns the length of the BLOB in bytes
+	Size() int64
+}
+
+// BlobKey checks that a column holds BLOBs and converts the primary key that finds a row
+func BlobKey(schema catalog.TableSchema, column string, key []parser.Value) ([]parser.Value, error) {
+	col, ok := schema.GetColumn(column)
+	if !ok {
+		return nil, fmt.Errorf("column '%s' does not exist in table '%s'", column, schema.Name())
+	}
+	if col.Type() != types.TypeBlob {
+		return nil, fmt.Errorf("column '%s' of table '%s' is %v, not BLOB", column, schema.Name(), col.Type())
+	}
+
+	primaryKey := catalog.PrimaryKey(schema)
+	if len(primaryKey) == 0 {
+		return nil, fmt.Errorf("table '%s' has no primary key to find rows by", schema.Name())
+	}
+	if len(key) != len(primaryKey) {
+		return nil, fmt.Errorf("the primary key of table '%s' has %d columns, not %d", schema.Name(), len(primaryKey), len(key))
+	}
+	converted := make([]parser.Value, len(key))
+	for i, colName := range primaryKey {
+		keyCol, _ := schema.GetColumn(colName)
+		val, err := CoerceValue(keyCol, key[i])
+		if err != nil {
+			return nil, err
+		}
+		converted[i] = val
+	}
+	return converted, nil
+}
+
+// CheckBlobWrite checks that no index or constraint covers a BLOB column written in pieces
+func CheckBlobWrite(schema catalog.TableSchema, indexes []catalog.Index, column string) error {
+	for _, index := range indexes {
+		if index.Reads(column) {
+			return fmt.Errorf("column '%s' of table '%s' is covered by index '%s' and cannot be written in pieces", column, schema.Name(), index.Name)
+		}
+	}
+	for _, constraint := range schema.Constraints() {
+		if slices.Contains(constraint.Columns, column) {
+			return fmt.Errorf("column '%s' of table '%s' is covered by constraint '%s' and cannot be written in pieces", column, schema.Name(), constraint.Name)
+		}
+	}
+	return nil
+}
+
+// noBlobRow is the error for a key that finds no row
+func noBlobRow(tableName string, key []parser.Value) error {
+	return fmt.Errorf("table '%s' has no row with primary key %v", tableName, key)
+}
+
+// memoryBlobReader reads a BLOB held in memory
+type memoryBlobReader struct {
+	*bytes.Reader
+}
+
+func (r memoryBlobReader) Close() error {
+	return nil
+}
+
+// OpenBlob returns a reader of the BLOB in a column of the row with the given primary key
+func (s *MemoryStorage) OpenBlob(tableName, column string, key []parser.Value) (BlobReader, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	table, row, err := s.blobRow(tableName, column, key)
+	if err != nil {
+		return nil, err
+	}
+	val := row.values[column]
+	if isNullValue(val) {
+		return nil, fmt.Errorf("column '%s' of the row of table '%s' is NULL", column, table.schema.Name())
+	}
+	data, err := val.AsBytes()
+	if err != nil {
+		return nil, err
+	}
+	return memoryBlobReader{bytes.NewReader(data)}, nil
+}
+
+// WriteBlob replaces the BLOB in a column of a row by the bytes read from r
+func (s *MemoryStorage) WriteBlob(tableName, column string, key []parser.Value, r io.Reader) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table, row, err := s.blobRow(tableName, column, key)
+	if err != nil {
+		return 0, err
+	}
+	if err := CheckBlobWrite(table.schema, table.indexDefs(), column); err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	row.values = mergeRow(row.values, map[string]parser.Value{column: parser.NewBlobValue(data)})
+	return int64(len(data)), nil
+}
+
+// blobRow finds the row of a table with the given primary key; the caller must hold s.mu
+func (s *MemoryStorage) blobRow(tableName, column string, key []parser.Value) (*memoryTable, *memoryRow, error) {
+	table, exists := s.tables[tableName]
+	if !exists {
+		return nil, nil, fmt.Errorf("table '%s' does not exist", tableName)
+	}
+	key, err := BlobKey(table.schema, column, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, index := range table.indexes {
+		if !index.def.Primary {
+			continue
+		}
+		encoded := EncodeKey(key)
+		if pos := index.search(encoded); pos < len(index.entries) && bytes.Equal(index.entries[pos].key, encoded) {
+			return table, index.entries[pos].row, nil
+		}
+	}
+	return nil, nil, noBlobRow(tableName, key)
+}
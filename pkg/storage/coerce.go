@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// CoerceValue converts a value written to a column to the type of the column
+func CoerceValue(col parser.ColumnDefinition, val parser.Value) (parser.Value, error) {
+	if isNullValue(val) {
+		return val, nil
+	}
+	if col.Type() == types.TypeDecimal {
+		return coerceDecimal(col, val)
+	}
+	if col.Type() == types.TypeString && val.Type() == types.TypeString {
+		return coerceText(col, val)
+	}
+	if col.Type() == types.TypeFloat && val.Type() == types.TypeFloat {
+		// A literal keeps its digits only until it is stored as a FLOAT
+		f, _ := val.AsFloat()
+		return parser.NewFloatValue(f), nil
+	}
+	if val.Type() == col.Type() {
+		return val, nil
+	}
+
+	lossless := false
+	instant := func(t types.DataType) bool {
+		return t == types.TypeDate || t == types.TypeTimestamp || t == types.TypeTimestampTZ
+	}
+	switch {
+	case val.Type() == types.TypeString && (col.Type().IsTemporal() || col.Type() == types.TypeInterval || col.Type() == types.TypeBlob || col.Type() == types.TypeJSON):
+		converted, err := parser.Cast(val, col.Type())
+		if err != nil {
+			return nil, fmt.Errorf("value %v for column '%s': %v", val, col.Name(), err)
+		}
+		return converted, nil
+	case instant(val.Type()) && instant(col.Type()):
+		converted, _ := parser.Cast(val, col.Type())
+		back, _ := parser.Cast(converted, val.Type())
+		lossless = parser.Equal(back, val)
+	case val.Type() == types.TypeInt && col.Type() == types.TypeFloat:
+		i, _ := val.AsInt()
+		f := float64(i)
+		lossless = f < math.MaxInt64 && int64(f) == i
+	case val.Type() == types.TypeFloat && col.Type() == types.TypeInt:
+		f, _ := val.AsFloat()
+		lossless = f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+	case val.Type() == types.TypeDecimal && (col.Type() == types.TypeInt || col.Type() == types.TypeFloat):
+		converted, err := parser.Cast(val, col.Type())
+		if err != nil {
+			return nil, fmt.Errorf("value %v for column '%s': %v", val, col.Name(), err)
+		}
+		lossless = parser.Equal(converted, val)
+	default:
+		return nil, fmt.Errorf("type mismatch for column '%s': cannot store %v value %v as %v",
+			col.Name(), val.Type(), val, col.Type())
+	}
+	if !lossless {
+		return nil, fmt.Errorf("value %v for column '%s' cannot be stored as %v without losing precision",
+			val, col.Name(), col.Type())
+	}
+	return parser.Cast(val, col.Type())
+}
+
+// coerceDecimal converts a number, or text holding one, to the precision and scale of a column
+func coerceDecimal(col parser.ColumnDefinition, val parser.Value) (parser.Value, error) {
+	switch val.Type() {
+	case types.TypeDecimal, types.TypeInt, types.TypeFloat, types.TypeString:
+	default:
+		return nil, fmt.Errorf("type mismatch for column '%s': cannot store %v value %v as %v",
+			col.Name(), val.Type(), val, col.Type())
+	}
+	d, err := val.AsDecimal()
+	if err != nil {
+		return nil, fmt.Errorf("value %v for column '%s': %v", val, col.Name(), err)
+	}
+
+	params := col.TypeParams()
+	if len(params) == 0 {
+		return parser.NewDecimalValue(d), nil
+	}
+	precision, scale := params[0], 0
+	if len(params) > 1 {
+		scale = params[1]
+	}
+	typeName := col.TypeName()
+	if d.Round(scale, parser.RoundDown).Cmp(d) != 0 {
+		return nil, fmt.Errorf("value %v for column '%s' cannot be stored as %s without losing precision",
+			d, col.Name(), typeName)
+	}
+	fitted, err := d.Fit(precision, scale, parser.RoundDown)
+	if err != nil {
+		return nil, fmt.Errorf("value %v for column '%s' is out of range for %s", d, col.Name(), typeName)
+	}
+	return parser.NewDecimalValue(fitted), nil
+}
+
+// coerceText checks the length of text written to a column and gives it the column's collation
+func coerceText(col parser.ColumnDefinition, val parser.Value) (parser.Value, error) {
+	if params := col.TypeParams(); len(params) > 0 {
+		s, _ := val.AsString()
+		if limit := params[0]; utf8.RuneCountInString(s) > limit {
+			trimmed := strings.TrimRight(s, " ")
+			if utf8.RuneCountInString(trimmed) > limit {
+				return nil, fmt.Errorf("value %v is too long for column '%s' of type %s",
+					val, col.Name(), col.TypeName())
+			}
+			val = parser.NewStringValue(string([]rune(s)[:limit]))
+		}
+	}
+	return parser.Collate(val, col.Collation()), nil
+}
+
+// CoerceDefault returns a column whose constant default has the column's type
+func CoerceDefault(col parser.ColumnDefinition) (parser.ColumnDefinition, error) {
+	lit, ok := col.Default().(parser.LiteralExpression)
+	if !ok {
+		return col, nil
+	}
+	val, err := CoerceValue(col, lit.Value())
+	if err != nil {
+		return nil, fmt.Errorf("DEFAULT of column '%s': %v", col.Name(), err)
+	}
+	return coercedColumn{ColumnDefinition: col, def: parser.NewLiteralExpression(val)}, nil
+}
+
+// coercedColumn is a column with its default converted to its type
+type coercedColumn struct {
+	parser.ColumnDefinition
+	def parser.Expression
+}
+
+func (c coercedColumn) Default() parser.Expression {
+	return c.def
+}
+
+// CoerceRow converts the values of a row to the types of their columns and checks NOT NULL
+func CoerceRow(schema catalog.TableSchema, row Row) (Row, error) {
+	coerced := make(Row, len(row))
+	for colName, val := range row {
+		coerced[colName] = val
+	}
+	for _, col := range schema.Columns() {
+		val := row[col.Name()]
+		if isNullValue(val) {
+			if slices.Contains(col.Constraints(), types.ConstraintNotNull) {
+				return nil, fmt.Errorf("column '%s' cannot be NULL", col.Name())
+			}
+			continue
+		}
+		converted, err := CoerceValue(col, val)
+		if err != nil {
+			return nil, err
+		}
+		coerced[col.Name()] = converted
+	}
+	return coerced, nil
+}
+
+// CoerceValues checks the values an UPDATE sets like CoerceRow does
+func CoerceValues(schema catalog.TableSchema, values map[string]parser.Value) (map[string]parser.Value, error) {
+	coerced := make(map[string]parser.Value, len(values))
+	for colName, val := range values {
+		col, exists := schema.GetColumn(colName)
+		if !exists {
+			return nil, fmt.Errorf("column '%s' does not exist in table '%s'", colName, schema.Name())
+		}
+		if isNullValue(val) {
+			if slices.Contains(col.Constraints(), types.ConstraintNotNull) {
+				return nil, fmt.Errorf("column '%s' cannot be NULL", colName)
+			}
+			coerced[colName] = val
+			continue
+		}
+		converted, err := CoerceValue(col, val)
+		if err != nil {
+			return nil, err
+		}
+		coerced[colName] = converted
+	}
+	return coerced, nil
+}
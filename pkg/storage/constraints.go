@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// ConstraintError is returned when a write would violate a table constraint
+type ConstraintError struct {
+	// Table is the table the write was made against
+	Table string
+
+	// Constraint is the name of the violated constraint
+	Constraint string
+
+	// Type is the kind of the violated constraint
+	Type types.Constraint
+
+	// Columns lists the columns covered by the constraint
+	Columns []string
+
+	// Values holds the offending values, in the same order as Columns
+	Values []parser.Value
+
+	// RefTable is the other table of a FOREIGN KEY
+	RefTable   string
+	Referenced bool
+}
+
+// CheckRow checks a row against the CHECK constraints of a table
+func CheckRow(schema catalog.TableSchema, row Row) error {
+	for _, constraint := range schema.Constraints() {
+		if constraint.Type != types.ConstraintCheck {
+			continue
+		}
+		val, err := constraint.Check.Eval(nil, row)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate check constraint '%s': %w", constraint.Name, err)
+		}
+		if val.Type() != types.TypeBool {
+			continue
+		}
+		if ok, _ := val.AsBool(); !ok {
+			values := make([]parser.Value, len(constraint.Columns))
+			for i, col := range constraint.Columns {
+				values[i] = row[col]
+			}
+			return &ConstraintError{
+				Table:      schema.Name(),
+				Constraint: constraint.Name,
+				Type:       types.ConstraintCheck,
+				Columns:    constraint.Columns,
+				Values:     values,
+			}
+		}
+	}
+	return nil
+}
+
+// Error implements the error interface
+func (e *ConstraintError) Error() string {
+	switch e.Type {
+	case types.ConstraintPrimaryKey, types.ConstraintUnique:
+		return fmt.Sprintf("duplicate key %s violates unique constraint '%s' on table '%s'",
+			e.describeKey(), e.Constraint, e.Table)
+	case types.ConstraintCheck:
+		return fmt.Sprintf("new row for table '%s' violates check constraint '%s'", e.Table, e.Constraint)
+	case types.ConstraintForeignKey:
+		if e.Referenced {
+			return fmt.Sprintf("update or delete on table '%s' violates foreign key constraint '%s' on table '%s': key %s is still referenced",
+				e.Table, e.Constraint, e.RefTable, e.describeKey())
+		}
+		return fmt.Sprintf("insert or update on table '%s' violates foreign key constraint '%s': key %s is not present in table '%s'",
+			e.Table, e.Constraint, e.describeKey(), e.RefTable)
+	default:
+		return fmt.Sprintf("constraint '%s' violated on table '%s'", e.Constraint, e.Table)
+	}
+}
+
+// describeKey formats the offending key as (col1, col2)=(val1, val2)
+func (e *ConstraintError) describeKey() string {
+	vals := make([]string, len(e.Values))
+	for i, val := range e.Values {
+		if val.Type() == types.TypeString {
+			vals[i], _ = val.AsString()
+		} else {
+			vals[i] = fmt.Sprint(val)
+		}
+	}
+	return fmt.Sprintf("(%s)=(%s)", strings.Join(e.Columns, ", "), strings.Join(vals, ", "))
+}
+
+// UniqueChecker detects rows that share a PRIMARY KEY or UNIQUE key
+type UniqueChecker struct {
+	table   string
+	indexes []catalog.Index
+	seen    []map[string]bool
+}
+
+// NewUniqueChecker creates a checker for the unique constraints of a table
+func NewUniqueChecker(schema catalog.TableSchema) *UniqueChecker {
+	return NewIndexUniqueChecker(schema.Name(), catalog.KeyIndexes(schema))
+}
+
+// NewIndexUniqueChecker creates a checker for the unique indexes among the given ones
+func NewIndexUniqueChecker(table string, indexes []catalog.Index) *UniqueChecker {
+	var unique []catalog.Index
+	for _, index := range indexes {
+		if index.Unique {
+			unique = append(unique, index)
+		}
+	}
+
+	seen := make([]map[string]bool, len(unique))
+	for i := range seen {
+		seen[i] = make(map[string]bool)
+	}
+
+	return &UniqueChecker{
+		table:   table,
+		indexes: unique,
+		seen:    seen,
+	}
+}
+
+// Empty reports whether the table has no unique constraints to check
+func (c *UniqueChecker) Empty() bool {
+	return len(c.indexes) == 0
+}
+
+// Add records the keys of a row, failing when one was already seen
+func (c *UniqueChecker) Add(row Row) error {
+	for i, index := range c.indexes {
+		keyValues, hasNull, err := UniqueKey(index, row)
+		if err != nil {
+			return err
+		}
+		if hasNull {
+			continue
+		}
+
+		key := string(EncodeKey(keyValues))
+		if c.seen[i][key] {
+			return NewUniqueViolation(c.table, index, keyValues)
+		}
+		c.seen[i][key] = true
+	}
+
+	return nil
+}
+
+// UniqueKey extracts the key of a row for a unique index, reporting whether it holds a NULL
+func UniqueKey(index catalog.Index, row Row) ([]parser.Value, bool, error) {
+	keyValues := index.KeyValues(row)
+	hasNull := false
+
+	for j, val := range keyValues {
+		if isNullValue(val) {
+			if index.Primary {
+				return nil, false, fmt.Errorf("column '%s' cannot be NULL", index.Columns[j])
+			}
+			hasNull = true
+		}
+	}
+
+	return keyValues, hasNull, nil
+}
+
+// NewUniqueViolation builds the error for a duplicate key in a unique index
+func NewUniqueViolation(table string, index catalog.Index, keyValues []parser.Value) *ConstraintError {
+	constraintType := types.ConstraintUnique
+	if index.Primary {
+		constraintType = types.ConstraintPrimaryKey
+	}
+	return &ConstraintError{
+		Table:      table,
+		Constraint: index.Name,
+		Type:       constraintType,
+		Columns:    index.Columns,
+		Values:     keyValues,
+	}
+}
+
+// isNullValue reports whether a value is missing or SQL NULL
+func isNullValue(val parser.Value) bool {
+	if val == nil {
+		return true
+	}
+	isNull, _ := val.AsNull()
+	return isNull
+}
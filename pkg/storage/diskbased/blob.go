@@ -0,0 +1,331 @@
+package diskbased
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+const (
+	// InlineBlobSize is the size up to which a BLOB is stored inside its row
+	InlineBlobSize = 256
+
+	// blobPageHeaderSize is the size of the next page ID and byte count of an overflow page
+	blobPageHeaderSize = 8
+)
+
+// diskBlob is the stored form of a BLOB kept in overflow pages
+type diskBlob struct {
+	Page PageID `json:"page"`
+	Size int64  `json:"size"`
+}
+
+// writeBlob stores the bytes read from r in a chain of new overflow pages
+func writeBlob(pm *PageManager, r io.Reader) (diskBlob, error) {
+	var blob diskBlob
+	var prev *Page
+	buf := make([]byte, PageSize-blobPageHeaderSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			page, allocErr := pm.AllocatePage()
+			if allocErr != nil {
+				err = allocErr
+			} else {
+				data := page.Data()
+				binary.LittleEndian.PutUint32(data[4:8], uint32(n))
+				copy(data[blobPageHeaderSize:], buf[:n])
+				page.MarkDirty()
+				if prev == nil {
+					blob.Page = page.ID()
+				} else {
+					binary.LittleEndian.PutUint32(prev.Data()[0:4], uint32(page.ID()))
+					prev.MarkDirty()
+					if releaseErr := pm.ReleasePage(prev); releaseErr != nil {
+						err = releaseErr
+					}
+				}
+				prev = page
+				blob.Size += int64(n)
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			if prev != nil {
+				pm.ReleasePage(prev)
+			}
+			freeBlob(pm, blob)
+			return diskBlob{}, err
+		}
+	}
+
+	if prev != nil {
+		if err := pm.ReleasePage(prev); err != nil {
+			return diskBlob{}, err
+		}
+	}
+	return blob, nil
+}
+
+// freeBlob returns the overflow pages of a BLOB to the free list
+func freeBlob(pm *PageManager, blob diskBlob) error {
+	for id := blob.Page; id != 0; {
+		page, err := pm.GetPage(id)
+		if err != nil {
+			return err
+		}
+		next := PageID(binary.LittleEndian.Uint32(page.Data()[0:4]))
+		page.Unpin()
+		if err := pm.FreePage(id); err != nil {
+			return err
+		}
+		id = next
+	}
+	return nil
+}
+
+// readBlob reads a whole BLOB from its overflow pages
+func readBlob(pm *PageManager, blob diskBlob) ([]byte, error) {
+	pages, err := blobPages(pm, blob)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, blob.Size)
+	if _, err := io.ReadFull(&blobReader{pm: pm, pages: pages, size: blob.Size}, data); err != nil {
+		return nil, fmt.Errorf("failed to read BLOB: %w", err)
+	}
+	return data, nil
+}
+
+// blobPages returns the IDs of the overflow pages of a BLOB in order
+func blobPages(pm *PageManager, blob diskBlob) ([]PageID, error) {
+	var pages []PageID
+	for id := blob.Page; id != 0; {
+		page, err := pm.GetPage(id)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, id)
+		id = PageID(binary.LittleEndian.Uint32(page.Data()[0:4]))
+		if err := pm.ReleasePage(page); err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+// blobReader reads a BLOB page by page from its overflow pages
+type blobReader struct {
+	pm    *PageManager
+	pages []PageID
+	size  int64
+
+	// held is set when the pages are held until they are read
+	held bool
+
+	// chunk holds the bytes of the current page that were not read yet
+	chunk []byte
+	buf   []byte
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if len(r.pages) == 0 {
+			return 0, io.EOF
+		}
+		id := r.pages[0]
+		page, err := r.pm.GetPage(id)
+		if err != nil {
+			return 0, err
+		}
+		data := page.Data()
+		n := binary.LittleEndian.Uint32(data[4:8])
+		r.buf = append(r.buf[:0], data[blobPageHeaderSize:blobPageHeaderSize+n]...)
+		r.chunk = r.buf
+		if err := r.pm.ReleasePage(page); err != nil {
+			return 0, err
+		}
+		r.pages = r.pages[1:]
+		if r.held {
+			if err := r.pm.UnholdPage(id); err != nil {
+				return 0, err
+			}
+		}
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// Size returns the length of the BLOB in bytes
+func (r *blobReader) Size() int64 {
+	return r.size
+}
+
+// Close lets go of the pages that were not read
+func (r *blobReader) Close() error {
+	var firstErr error
+	if r.held {
+		for _, id := range r.pages {
+			if err := r.pm.UnholdPage(id); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	r.pages = nil
+	return firstErr
+}
+
+// inlineBlobReader reads a BLOB stored inside its row
+type inlineBlobReader struct {
+	*bytes.Reader
+}
+
+func (r inlineBlobReader) Close() error {
+	return nil
+}
+
+// freeBlobs frees the overflow pages of the BLOBs of the row stored under rowID
+func (tableInfo *TableInfo) freeBlobs(rowID []byte) error {
+	if !hasBlobColumn(tableInfo) {
+		return nil
+	}
+	data, err := tableInfo.IndexTree.Get(rowID)
+	if err != nil {
+		return err
+	}
+	var encoded map[string]diskValue
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	for _, dv := range encoded {
+		if dv.Blob != nil {
+			if err := freeBlob(tableInfo.IndexTree.pageManager, *dv.Blob); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasBlobColumn reports whether a table has a BLOB column
+func hasBlobColumn(tableInfo *TableInfo) bool {
+	for _, col := range tableInfo.Schema.Columns() {
+		if col.Type() == types.TypeBlob {
+			return true
+		}
+	}
+	return false
+}
+
+// blobRow finds the stored row with the given primary key; the caller must hold ds.mu
+func (ds *DiskStorage) blobRow(tableName, column string, key []parser.Value) (*TableInfo, []byte, map[string]diskValue, error) {
+	tableInfo, exists := ds.tables[tableName]
+	if !exists {
+		return nil, nil, nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	key, err := storage.BlobKey(tableInfo.Schema, column, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rowID := storage.EncodeKey(key)
+	data, err := tableInfo.IndexTree.Get(rowID)
+	if err == ErrKeyNotFound {
+		return nil, nil, nil, fmt.Errorf("table %s has no row with primary key %v", tableName, key)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var encoded map[string]diskValue
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, nil, nil, err
+	}
+	return tableInfo, rowID, encoded, nil
+}
+
+// OpenBlob returns a reader of a BLOB that reads its overflow pages one at a time
+func (ds *DiskStorage) OpenBlob(tableName, column string, key []parser.Value) (storage.BlobReader, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	tableInfo, _, encoded, err := ds.blobRow(tableName, column, key)
+	if err != nil {
+		return nil, err
+	}
+
+	dv, ok := encoded[column]
+	switch {
+	case !ok || dv.Type == types.TypeNull:
+		return nil, fmt.Errorf("column %s of the row of table %s is NULL", column, tableName)
+	case dv.Blob == nil:
+		return inlineBlobReader{bytes.NewReader(dv.Bytes)}, nil
+	}
+
+	// The pages are held rather than the lock, so the table can be changed
+	// while the BLOB is read
+	pm := tableInfo.IndexTree.pageManager
+	pages, err := blobPages(pm, *dv.Blob)
+	if err != nil {
+		return nil, err
+	}
+	pm.HoldPages(pages)
+	return &blobReader{pm: pm, pages: pages, size: dv.Blob.Size, held: true}, nil
+}
+
+// WriteBlob replaces a BLOB by the bytes read from r, writing overflow pages as it reads
+func (ds *DiskStorage) WriteBlob(tableName, column string, key []parser.Value, r io.Reader) (int64, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tableInfo, rowID, encoded, err := ds.blobRow(tableName, column, key)
+	if err != nil {
+		return 0, err
+	}
+	if err := storage.CheckBlobWrite(tableInfo.Schema, tableInfo.indexDefs(), column); err != nil {
+		return 0, err
+	}
+
+	// A BLOB that turns out to be small is kept in the row
+	head := make([]byte, InlineBlobSize+1)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	dv, size := diskValue{EncodedValue: storage.EncodedValue{Type: types.TypeBlob, Bytes: head[:n]}}, int64(n)
+	if n > InlineBlobSize {
+		blob, err := writeBlob(tableInfo.IndexTree.pageManager, io.MultiReader(bytes.NewReader(head), r))
+		if err != nil {
+			return 0, err
+		}
+		dv, size = diskValue{EncodedValue: storage.EncodedValue{Type: types.TypeBlob}, Blob: &blob}, blob.Size
+	}
+
+	old := encoded[column]
+	encoded[column] = dv
+	rowData, err := json.Marshal(encoded)
+	if err == nil {
+		err = tableInfo.IndexTree.Insert(rowID, rowData)
+	}
+	if err != nil {
+		if dv.Blob != nil {
+			freeBlob(tableInfo.IndexTree.pageManager, *dv.Blob)
+		}
+		return 0, err
+	}
+	if old.Blob != nil {
+		if err := freeBlob(tableInfo.IndexTree.pageManager, *old.Blob); err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
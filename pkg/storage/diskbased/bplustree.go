@@ -21,6 +21,9 @@ const (
 	NodeHeaderSize = 9 // 1 byte for node type + 4 bytes for number of keys + 4 bytes for next page
 )
 
+// ErrKeyNotFound is returned when a key is not present in the tree
+var ErrKeyNotFound = errors.New("key not found")
+
 // BPlusTree is a B+ tree implementation that stores data on disk
 type BPlusTree struct {
 	pageManager *PageManager
@@ -70,13 +73,16 @@ func CreateNewTree(pageManager *PageManager) (*BPlusTree, error) {
 	return NewBPlusTree(pageManager, rootPage.ID())
 }
 
-// Insert inserts a key-value pair into the B+ tree
+// Insert inserts a key-value pair into the B+ tree, replacing the value of an existing key
 func (t *BPlusTree) Insert(key []byte, value []byte) error {
+	if NodeHeaderSize+leafEntrySize(key, value) > PageSize {
+		return fmt.Errorf("entry of %d bytes does not fit in a page", leafEntrySize(key, value))
+	}
 	return t.insert(t.rootPageID, key, value, nil)
 }
 
-// insert recursively inserts a key-value pair into the tree
-func (t *BPlusTree) insert(nodeID PageID, key []byte, value []byte, parentID *PageID) error {
+// insert recursively inserts a key-value pair, with path holding the non-leaf nodes visited
+func (t *BPlusTree) insert(nodeID PageID, key []byte, value []byte, path []PageID) error {
 	node, err := t.pageManager.GetPage(nodeID)
 	if err != nil {
 		return err
@@ -84,36 +90,10 @@ func (t *BPlusTree) insert(nodeID PageID, key []byte, value []byte, parentID *Pa
 
 	nodeData := node.Data()
 	nodeType := nodeData[0]
-	numKeys := binary.LittleEndian.Uint32(nodeData[1:5])
 
 	switch nodeType {
 	case NodeTypeLeaf:
-		// Check if key already exists
-		keys, _, err := t.getLeafNodeEntries(nodeID)
-		if err != nil {
-			return err
-		}
-
-		// Check for duplicate key
-		for i, existingKey := range keys {
-			if bytes.Equal(existingKey, key) {
-				// Update existing key
-				index := NodeHeaderSize + (i * (len(existingKey) + 8)) + 4 + len(existingKey)
-				binary.LittleEndian.PutUint32(nodeData[index:index+4], uint32(len(value)))
-				copy(nodeData[index+4:index+4+len(value)], value)
-				node.MarkDirty()
-				return nil
-			}
-		}
-
-		// If node is not full, insert key here
-		if numKeys < uint32(t.order-1) {
-			err = t.insertIntoLeaf(nodeID, key, value)
-			return err
-		}
-
-		// Node is full, need to split
-		return t.splitLeafNode(nodeID, key, value, parentID)
+		return t.insertIntoLeaf(nodeID, key, value, path)
 
 	case NodeTypeNonLeaf:
 		// Find the appropriate child
@@ -123,7 +103,7 @@ func (t *BPlusTree) insert(nodeID PageID, key []byte, value []byte, parentID *Pa
 		}
 
 		// Recursively insert into the child node
-		return t.insert(childID, key, value, &nodeID)
+		return t.insert(childID, key, value, append(path, nodeID))
 	}
 
 	return fmt.Errorf("unknown node type: %d", nodeType)
@@ -166,7 +146,7 @@ func (t *BPlusTree) Get(key []byte) ([]byte, error) {
 		offset += int(valueLen)
 	}
 
-	return nil, errors.New("key not found")
+	return nil, ErrKeyNotFound
 }
 
 // Delete removes a key-value pair from the B+ tree
@@ -234,6 +214,48 @@ func (t *BPlusTree) FindRange(startKey, endKey []byte) ([][]byte, error) {
 	return results, nil
 }
 
+// Scan calls fn for every entry whose key is >= start, in key order, until fn returns false
+func (t *BPlusTree) Scan(start []byte, fn func(key, value []byte) (bool, error)) error {
+	var leafNodeID PageID
+	var err error
+	if start == nil {
+		leafNodeID, err = t.firstLeafNode()
+	} else {
+		leafNodeID, err = t.findLeafNode(t.rootPageID, start)
+	}
+	if err != nil {
+		return err
+	}
+
+	for leafNodeID != 0 {
+		keys, values, err := t.getLeafNodeEntries(leafNodeID)
+		if err != nil {
+			return err
+		}
+
+		for i, key := range keys {
+			if start != nil && bytes.Compare(key, start) < 0 {
+				continue
+			}
+			more, err := fn(key, values[i])
+			if err != nil {
+				return err
+			}
+			if !more {
+				return nil
+			}
+		}
+
+		node, err := t.pageManager.GetPage(leafNodeID)
+		if err != nil {
+			return err
+		}
+		leafNodeID = PageID(binary.LittleEndian.Uint32(node.Data()[5:9]))
+	}
+
+	return nil
+}
+
 // Helper functions
 
 // findLeafNode finds the leaf node that should contain the key
@@ -341,168 +363,196 @@ func (t *BPlusTree) getLeafNodeEntries(nodeID PageID) ([][]byte, [][]byte, error
 	return keys, values, nil
 }
 
-// insertIntoLeaf inserts a key-value pair into a leaf node
-func (t *BPlusTree) insertIntoLeaf(nodeID PageID, key []byte, value []byte) error {
+// readNonLeafNode gets the keys and child pointers from a non-leaf node
+func (t *BPlusTree) readNonLeafNode(nodeID PageID) ([][]byte, []uint32, error) {
 	node, err := t.pageManager.GetPage(nodeID)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	nodeData := node.Data()
 	numKeys := binary.LittleEndian.Uint32(nodeData[1:5])
 
-	// Find insertion position (keep keys sorted)
-	keys, values, err := t.getLeafNodeEntries(nodeID)
-	if err != nil {
-		return err
-	}
+	keys := make([][]byte, numKeys)
+	childPtrs := make([]uint32, numKeys+1)
+
+	offset := NodeHeaderSize
+	childPtrs[0] = binary.LittleEndian.Uint32(nodeData[offset : offset+4])
+	offset += 4
 
-	insertPosition := numKeys
 	for i := uint32(0); i < numKeys; i++ {
-		if bytes.Compare(key, keys[i]) < 0 {
-			insertPosition = i
-			break
-		}
+		keyLen := binary.LittleEndian.Uint32(nodeData[offset : offset+4])
+		offset += 4
+
+		keys[i] = append([]byte{}, nodeData[offset:offset+int(keyLen)]...)
+		offset += int(keyLen)
+
+		childPtrs[i+1] = binary.LittleEndian.Uint32(nodeData[offset : offset+4])
+		offset += 4
 	}
 
-	// Insert the new key-value pair
-	newKeys := make([][]byte, numKeys+1)
-	newValues := make([][]byte, numKeys+1)
+	return keys, childPtrs, nil
+}
 
-	copy(newKeys[:insertPosition], keys[:insertPosition])
-	copy(newValues[:insertPosition], values[:insertPosition])
+// writeLeafNode writes keys and values into a leaf page, keeping its next pointer
+func writeLeafNode(node *Page, keys [][]byte, values [][]byte) {
+	nodeData := node.Data()
+	nodeData[0] = NodeTypeLeaf
+	binary.LittleEndian.PutUint32(nodeData[1:5], uint32(len(keys)))
 
-	newKeys[insertPosition] = key
-	newValues[insertPosition] = value
+	offset := NodeHeaderSize
+	for i := range keys {
+		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(keys[i])))
+		offset += 4
+		copy(nodeData[offset:offset+len(keys[i])], keys[i])
+		offset += len(keys[i])
 
-	copy(newKeys[insertPosition+1:], keys[insertPosition:])
-	copy(newValues[insertPosition+1:], values[insertPosition:])
+		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(values[i])))
+		offset += 4
+		copy(nodeData[offset:offset+len(values[i])], values[i])
+		offset += len(values[i])
+	}
 
-	// Write back to page
 	node.MarkDirty()
+}
+
+// writeNonLeafNode writes keys and child pointers into a non-leaf page
+func writeNonLeafNode(node *Page, keys [][]byte, childPtrs []uint32) {
+	nodeData := node.Data()
+	nodeData[0] = NodeTypeNonLeaf
+	binary.LittleEndian.PutUint32(nodeData[1:5], uint32(len(keys)))
+
 	offset := NodeHeaderSize
+	binary.LittleEndian.PutUint32(nodeData[offset:offset+4], childPtrs[0])
+	offset += 4
 
-	binary.LittleEndian.PutUint32(nodeData[1:5], numKeys+1) // Update number of keys
+	for i := range keys {
+		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(keys[i])))
+		offset += 4
+		copy(nodeData[offset:offset+len(keys[i])], keys[i])
+		offset += len(keys[i])
 
-	for i := uint32(0); i < numKeys+1; i++ {
-		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(newKeys[i])))
+		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], childPtrs[i+1])
 		offset += 4
+	}
 
-		copy(nodeData[offset:offset+len(newKeys[i])], newKeys[i])
-		offset += len(newKeys[i])
+	node.MarkDirty()
+}
 
-		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(newValues[i])))
-		offset += 4
+// leafEntrySize returns the number of bytes a key-value pair takes in a leaf
+func leafEntrySize(key, value []byte) int {
+	return 4 + len(key) + 4 + len(value)
+}
 
-		copy(nodeData[offset:offset+len(newValues[i])], newValues[i])
-		offset += len(newValues[i])
+// leafNodeSize returns the number of bytes needed to store a leaf node
+func leafNodeSize(keys [][]byte, values [][]byte) int {
+	size := NodeHeaderSize
+	for i := range keys {
+		size += leafEntrySize(keys[i], values[i])
 	}
+	return size
+}
 
-	return nil
+// nonLeafNodeSize returns the number of bytes needed to store a non-leaf node
+func nonLeafNodeSize(keys [][]byte) int {
+	size := NodeHeaderSize + 4
+	for _, key := range keys {
+		size += 4 + len(key) + 4
+	}
+	return size
 }
 
-// splitLeafNode splits a leaf node when it becomes full
-func (t *BPlusTree) splitLeafNode(nodeID PageID, newKey []byte, newValue []byte, parentID *PageID) error {
+// insertIntoLeaf inserts a key-value pair into a leaf node, splitting it when full
+func (t *BPlusTree) insertIntoLeaf(nodeID PageID, key []byte, value []byte, path []PageID) error {
 	node, err := t.pageManager.GetPage(nodeID)
 	if err != nil {
 		return err
 	}
 
-	// Get all keys and values from the node, including the new one
 	keys, values, err := t.getLeafNodeEntries(nodeID)
 	if err != nil {
 		return err
 	}
 
-	// Find where to insert the new key
+	// Find insertion position (keep keys sorted)
 	insertPosition := len(keys)
-	for i := 0; i < len(keys); i++ {
-		if bytes.Compare(newKey, keys[i]) < 0 {
+	for i := range keys {
+		cmp := bytes.Compare(key, keys[i])
+		if cmp == 0 {
+			// Key already exists, replace its value
+			insertPosition = -1
+			values[i] = value
+			break
+		}
+		if cmp < 0 {
 			insertPosition = i
 			break
 		}
 	}
 
-	// Insert the new key and value
-	newKeys := make([][]byte, len(keys)+1)
-	newValues := make([][]byte, len(values)+1)
+	if insertPosition >= 0 {
+		keys = append(keys, nil)
+		values = append(values, nil)
+		copy(keys[insertPosition+1:], keys[insertPosition:])
+		copy(values[insertPosition+1:], values[insertPosition:])
+		keys[insertPosition] = key
+		values[insertPosition] = value
+	}
 
-	copy(newKeys[:insertPosition], keys[:insertPosition])
-	copy(newValues[:insertPosition], values[:insertPosition])
+	if len(keys) <= t.order-1 && leafNodeSize(keys, values) <= PageSize {
+		writeLeafNode(node, keys, values)
+		return nil
+	}
 
-	newKeys[insertPosition] = newKey
-	newValues[insertPosition] = newValue
+	// Node is full, need to split
+	return t.splitLeafNode(nodeID, keys, values, path)
+}
 
-	copy(newKeys[insertPosition+1:], keys[insertPosition:])
-	copy(newValues[insertPosition+1:], values[insertPosition:])
+// splitLeafNode splits an overfull leaf node in two
+func (t *BPlusTree) splitLeafNode(nodeID PageID, keys [][]byte, values [][]byte, path []PageID) error {
+	node, err := t.pageManager.GetPage(nodeID)
+	if err != nil {
+		return err
+	}
+
+	// Pick the split point that balances the two halves by size
+	splitPoint := 1
+	bestSize := PageSize * 2
+	for i := 1; i < len(keys); i++ {
+		left := leafNodeSize(keys[:i], values[:i])
+		right := leafNodeSize(keys[i:], values[i:])
+		larger := left
+		if right > larger {
+			larger = right
+		}
+		if larger < bestSize {
+			bestSize = larger
+			splitPoint = i
+		}
+	}
+	if bestSize > PageSize {
+		return errors.New("leaf entries too large to split across two pages")
+	}
 
 	// Allocate a new page for the second half of the keys
 	newNode, err := t.pageManager.AllocatePage()
 	if err != nil {
 		return err
 	}
-
 	newNodeID := newNode.ID()
-	newNodeData := newNode.Data()
-
-	// Setup new leaf node
-	newNodeData[0] = NodeTypeLeaf
-
-	// Split point - middle of the keys
-	splitPoint := len(newKeys) / 2
 
-	// Update the original node to contain only the first half
+	// Link the new node into the leaf chain after the original node
 	nodeData := node.Data()
-	binary.LittleEndian.PutUint32(nodeData[1:5], uint32(splitPoint)) // Update number of keys
-
-	// Get the next node pointer from the original node and set it for the new node
+	newNodeData := newNode.Data()
 	nextNodeID := binary.LittleEndian.Uint32(nodeData[5:9])
 	binary.LittleEndian.PutUint32(newNodeData[5:9], nextNodeID)
-
-	// Update the next pointer of the original node to point to the new node
 	binary.LittleEndian.PutUint32(nodeData[5:9], uint32(newNodeID))
 
-	// Write first half to original node
-	offset := NodeHeaderSize
-	for i := 0; i < splitPoint; i++ {
-		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(newKeys[i])))
-		offset += 4
-		copy(nodeData[offset:offset+len(newKeys[i])], newKeys[i])
-		offset += len(newKeys[i])
-		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(newValues[i])))
-		offset += 4
-		copy(nodeData[offset:offset+len(newValues[i])], newValues[i])
-		offset += len(newValues[i])
-	}
+	writeLeafNode(node, keys[:splitPoint], values[:splitPoint])
+	writeLeafNode(newNode, keys[splitPoint:], values[splitPoint:])
 
-	// Write second half to new node
-	binary.LittleEndian.PutUint32(newNodeData[1:5], uint32(len(newKeys)-splitPoint)) // Number of keys
-	offset = NodeHeaderSize
-	for i := splitPoint; i < len(newKeys); i++ {
-		binary.LittleEndian.PutUint32(newNodeData[offset:offset+4], uint32(len(newKeys[i])))
-		offset += 4
-		copy(newNodeData[offset:offset+len(newKeys[i])], newKeys[i])
-		offset += len(newKeys[i])
-		binary.LittleEndian.PutUint32(newNodeData[offset:offset+4], uint32(len(newValues[i])))
-		offset += 4
-		copy(newNodeData[offset:offset+len(newValues[i])], newValues[i])
-		offset += len(newValues[i])
-	}
-
-	// Mark both nodes as dirty
-	node.MarkDirty()
-	newNode.MarkDirty()
-
-	// Update parent node or create new root if necessary
-	splitKey := newKeys[splitPoint] // The first key of the second node is the split key
-
-	if parentID == nil {
-		// This was the root node, create new root
-		return t.createNewRoot(nodeID, newNodeID, splitKey)
-	} else {
-		// Add split key to parent
-		return t.insertIntoParent(*parentID, nodeID, newNodeID, splitKey)
-	}
+	// The first key of the second node is the split key
+	return t.insertIntoParent(path, nodeID, newNodeID, keys[splitPoint])
 }
 
 // createNewRoot creates a new root node when the current root splits
@@ -513,243 +563,81 @@ func (t *BPlusTree) createNewRoot(leftChildID, rightChildID PageID, key []byte)
 		return err
 	}
 
-	// Setup as non-leaf node
-	rootData := rootPage.Data()
-	rootData[0] = NodeTypeNonLeaf                   // Node type
-	binary.LittleEndian.PutUint32(rootData[1:5], 1) // One key
-
 	// Structure: left_child_ptr, key, right_child_ptr
-	offset := NodeHeaderSize
-
-	// Write left child pointer
-	binary.LittleEndian.PutUint32(rootData[offset:offset+4], uint32(leftChildID))
-	offset += 4
-
-	// Write key
-	binary.LittleEndian.PutUint32(rootData[offset:offset+4], uint32(len(key)))
-	offset += 4
-	copy(rootData[offset:offset+len(key)], key)
-	offset += len(key)
-
-	// Write right child pointer
-	binary.LittleEndian.PutUint32(rootData[offset:offset+4], uint32(rightChildID))
+	writeNonLeafNode(rootPage, [][]byte{key}, []uint32{uint32(leftChildID), uint32(rightChildID)})
 
 	// Update the tree's root pageID
 	t.rootPageID = rootPage.ID()
-	rootPage.MarkDirty()
 
 	return nil
 }
 
-// insertIntoParent inserts a key and child pointer into a non-leaf node
-func (t *BPlusTree) insertIntoParent(parentID, leftChildID, rightChildID PageID, key []byte) error {
+// insertIntoParent inserts a separator key and new right child into the parent of a split node
+func (t *BPlusTree) insertIntoParent(path []PageID, leftChildID, rightChildID PageID, key []byte) error {
+	if len(path) == 0 {
+		return t.createNewRoot(leftChildID, rightChildID, key)
+	}
+
+	parentID := path[len(path)-1]
 	parent, err := t.pageManager.GetPage(parentID)
 	if err != nil {
 		return err
 	}
 
-	parentData := parent.Data()
-	numKeys := binary.LittleEndian.Uint32(parentData[1:5])
-
-	// If parent has space, insert the key
-	if numKeys < uint32(t.order-1) {
-		return t.insertIntoNonLeaf(parentID, rightChildID, key)
-	}
-
-	// Parent is full, need to split
-	return t.splitNonLeafNode(parentID, rightChildID, key, nil)
-}
-
-// insertIntoNonLeaf inserts a key and right child pointer into a non-leaf node
-func (t *BPlusTree) insertIntoNonLeaf(nodeID, rightChildID PageID, key []byte) error {
-	node, err := t.pageManager.GetPage(nodeID)
+	keys, childPtrs, err := t.readNonLeafNode(parentID)
 	if err != nil {
 		return err
 	}
 
-	nodeData := node.Data()
-	numKeys := binary.LittleEndian.Uint32(nodeData[1:5])
-	node.MarkDirty()
-
-	// Extract all keys and child pointers
-	keys := make([][]byte, numKeys)
-	childPtrs := make([]uint32, numKeys+1)
-
-	offset := NodeHeaderSize
-	childPtrs[0] = binary.LittleEndian.Uint32(nodeData[offset : offset+4])
-	offset += 4
-
-	for i := uint32(0); i < numKeys; i++ {
-		keyLen := binary.LittleEndian.Uint32(nodeData[offset : offset+4])
-		offset += 4
-
-		keys[i] = make([]byte, keyLen)
-		copy(keys[i], nodeData[offset:offset+int(keyLen)])
-		offset += int(keyLen)
-
-		childPtrs[i+1] = binary.LittleEndian.Uint32(nodeData[offset : offset+4])
-		offset += 4
-	}
-
 	// Find insertion position for the new key
-	insertPos := numKeys
-	for i := uint32(0); i < numKeys; i++ {
+	insertPos := len(keys)
+	for i := range keys {
 		if bytes.Compare(key, keys[i]) < 0 {
 			insertPos = i
 			break
 		}
 	}
 
-	// Make room for the new key and pointer
-	newKeys := make([][]byte, numKeys+1)
-	newChildPtrs := make([]uint32, numKeys+2)
-
-	copy(newKeys[:insertPos], keys[:insertPos])
-	copy(newChildPtrs[:insertPos+1], childPtrs[:insertPos+1])
+	keys = append(keys, nil)
+	copy(keys[insertPos+1:], keys[insertPos:])
+	keys[insertPos] = key
 
-	newKeys[insertPos] = key
-	newChildPtrs[insertPos+1] = uint32(rightChildID)
+	childPtrs = append(childPtrs, 0)
+	copy(childPtrs[insertPos+2:], childPtrs[insertPos+1:])
+	childPtrs[insertPos+1] = uint32(rightChildID)
 
-	copy(newKeys[insertPos+1:], keys[insertPos:])
-	copy(newChildPtrs[insertPos+2:], childPtrs[insertPos+1:])
-
-	// Write back to the page
-	binary.LittleEndian.PutUint32(nodeData[1:5], numKeys+1) // Update the number of keys
-
-	offset = NodeHeaderSize
-	binary.LittleEndian.PutUint32(nodeData[offset:offset+4], newChildPtrs[0])
-	offset += 4
-
-	for i := uint32(0); i < numKeys+1; i++ {
-		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(newKeys[i])))
-		offset += 4
-
-		copy(nodeData[offset:offset+len(newKeys[i])], newKeys[i])
-		offset += len(newKeys[i])
-
-		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], newChildPtrs[i+1])
-		offset += 4
+	// If parent has space, we are done
+	if len(keys) <= t.order-1 && nonLeafNodeSize(keys) <= PageSize {
+		writeNonLeafNode(parent, keys, childPtrs)
+		return nil
 	}
 
-	return nil
+	// Parent is full, need to split
+	return t.splitNonLeafNode(path, keys, childPtrs)
 }
 
-// splitNonLeafNode splits a non-leaf node when it becomes full
-func (t *BPlusTree) splitNonLeafNode(nodeID, newChildID PageID, newKey []byte, parentID *PageID) error {
+// splitNonLeafNode splits an overfull non-leaf node, the last entry of path
+func (t *BPlusTree) splitNonLeafNode(path []PageID, keys [][]byte, childPtrs []uint32) error {
+	nodeID := path[len(path)-1]
 	node, err := t.pageManager.GetPage(nodeID)
 	if err != nil {
 		return err
 	}
 
-	nodeData := node.Data()
-	numKeys := binary.LittleEndian.Uint32(nodeData[1:5])
-
-	// Extract all keys and child pointers
-	keys := make([][]byte, numKeys)
-	childPtrs := make([]uint32, numKeys+1)
-
-	offset := NodeHeaderSize
-	childPtrs[0] = binary.LittleEndian.Uint32(nodeData[offset : offset+4])
-	offset += 4
-
-	for i := uint32(0); i < numKeys; i++ {
-		keyLen := binary.LittleEndian.Uint32(nodeData[offset : offset+4])
-		offset += 4
-
-		keys[i] = make([]byte, keyLen)
-		copy(keys[i], nodeData[offset:offset+int(keyLen)])
-		offset += int(keyLen)
-
-		childPtrs[i+1] = binary.LittleEndian.Uint32(nodeData[offset : offset+4])
-		offset += 4
-	}
-
-	// Find insertion position for the new key
-	insertPos := numKeys
-	for i := uint32(0); i < numKeys; i++ {
-		if bytes.Compare(newKey, keys[i]) < 0 {
-			insertPos = i
-			break
-		}
-	}
-
-	// Insert new key and child pointer
-	newKeys := make([][]byte, numKeys+1)
-	newChildPtrs := make([]uint32, numKeys+2)
-
-	copy(newKeys[:insertPos], keys[:insertPos])
-	copy(newChildPtrs[:insertPos+1], childPtrs[:insertPos+1])
-
-	newKeys[insertPos] = newKey
-	newChildPtrs[insertPos+1] = uint32(newChildID)
-
-	copy(newKeys[insertPos+1:], keys[insertPos:])
-	copy(newChildPtrs[insertPos+2:], childPtrs[insertPos+1:])
-
 	// Create new node for the split
 	newNode, err := t.pageManager.AllocatePage()
 	if err != nil {
 		return err
 	}
-	newNodeData := newNode.Data()
-	newNode.MarkDirty()
-
-	// Set up new non-leaf node
-	newNodeData[0] = NodeTypeNonLeaf
-
-	// Split point - middle of the keys
-	splitPoint := (len(newKeys)) / 2
 
 	// The middle key will go up to the parent
-	middleKey := newKeys[splitPoint]
-
-	// Update the original node to contain only the first half
-	binary.LittleEndian.PutUint32(nodeData[1:5], uint32(splitPoint))
-
-	// Write first half to original node
-	offset = NodeHeaderSize
-	binary.LittleEndian.PutUint32(nodeData[offset:offset+4], newChildPtrs[0])
-	offset += 4
+	splitPoint := len(keys) / 2
+	middleKey := keys[splitPoint]
 
-	for i := 0; i < splitPoint; i++ {
-		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(newKeys[i])))
-		offset += 4
-
-		copy(nodeData[offset:offset+len(newKeys[i])], newKeys[i])
-		offset += len(newKeys[i])
-
-		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], newChildPtrs[i+1])
-		offset += 4
-	}
-
-	// Write second half to new node (skip the middle key that goes up)
-	binary.LittleEndian.PutUint32(newNodeData[1:5], uint32(len(newKeys)-(splitPoint+1)))
-
-	offset = NodeHeaderSize
-	binary.LittleEndian.PutUint32(newNodeData[offset:offset+4], newChildPtrs[splitPoint+1])
-	offset += 4
-
-	for i := splitPoint + 1; i < len(newKeys); i++ {
-		binary.LittleEndian.PutUint32(newNodeData[offset:offset+4], uint32(len(newKeys[i])))
-		offset += 4
-
-		copy(newNodeData[offset:offset+len(newKeys[i])], newKeys[i])
-		offset += len(newKeys[i])
-
-		binary.LittleEndian.PutUint32(newNodeData[offset:offset+4], newChildPtrs[i+1])
-		offset += 4
-	}
-
-	node.MarkDirty()
+	writeNonLeafNode(node, keys[:splitPoint], childPtrs[:splitPoint+1])
+	writeNonLeafNode(newNode, keys[splitPoint+1:], childPtrs[splitPoint+1:])
 
-	// Update parent or create new root
-	if parentID == nil {
-		// This was the root node, create a new root
-		return t.createNewRoot(nodeID, newNode.ID(), middleKey)
-	} else {
-		// Add middle key to parent
-		return t.insertIntoParent(*parentID, nodeID, newNode.ID(), middleKey)
-	}
+	return t.insertIntoParent(path[:len(path)-1], nodeID, newNode.ID(), middleKey)
 }
 
 // deleteFromLeaf deletes a key from a leaf node
@@ -759,9 +647,6 @@ func (t *BPlusTree) deleteFromLeaf(nodeID PageID, key []byte) error {
 		return err
 	}
 
-	nodeData := node.Data()
-	numKeys := binary.LittleEndian.Uint32(nodeData[1:5])
-
 	// Get all keys and values
 	keys, values, err := t.getLeafNodeEntries(nodeID)
 	if err != nil {
@@ -778,39 +663,59 @@ func (t *BPlusTree) deleteFromLeaf(nodeID PageID, key []byte) error {
 	}
 
 	if keyPosition == -1 {
-		return errors.New("key not found")
+		return ErrKeyNotFound
 	}
 
-	// Remove the key-value pair
-	newKeys := make([][]byte, numKeys-1)
-	newValues := make([][]byte, numKeys-1)
-
-	copy(newKeys[:keyPosition], keys[:keyPosition])
-	copy(newValues[:keyPosition], values[:keyPosition])
+	// Remove the key-value pair and write back to the page
+	keys = append(keys[:keyPosition], keys[keyPosition+1:]...)
+	values = append(values[:keyPosition], values[keyPosition+1:]...)
+	writeLeafNode(node, keys, values)
 
-	copy(newKeys[keyPosition:], keys[keyPosition+1:])
-	copy(newValues[keyPosition:], values[keyPosition+1:])
+	return nil
+}
 
-	// Write back to the page
-	binary.LittleEndian.PutUint32(nodeData[1:5], numKeys-1) // Update number of keys
+// firstLeafNode returns the leftmost leaf node of the tree
+func (t *BPlusTree) firstLeafNode() (PageID, error) {
+	nodeID := t.rootPageID
+	for {
+		node, err := t.pageManager.GetPage(nodeID)
+		if err != nil {
+			return 0, err
+		}
 
-	offset := NodeHeaderSize
-	for i := uint32(0); i < numKeys-1; i++ {
-		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(newKeys[i])))
-		offset += 4
+		nodeData := node.Data()
+		if nodeData[0] == NodeTypeLeaf {
+			return nodeID, nil
+		}
+		nodeID = PageID(binary.LittleEndian.Uint32(nodeData[NodeHeaderSize : NodeHeaderSize+4]))
+	}
+}
 
-		copy(nodeData[offset:offset+len(newKeys[i])], newKeys[i])
-		offset += len(newKeys[i])
+// LastKey returns the largest key in the tree, or nil if the tree is empty
+func (t *BPlusTree) LastKey() ([]byte, error) {
+	leafNodeID, err := t.firstLeafNode()
+	if err != nil {
+		return nil, err
+	}
 
-		binary.LittleEndian.PutUint32(nodeData[offset:offset+4], uint32(len(newValues[i])))
-		offset += 4
+	var lastKey []byte
+	for leafNodeID != 0 {
+		keys, _, err := t.getLeafNodeEntries(leafNodeID)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			lastKey = keys[len(keys)-1]
+		}
 
-		copy(nodeData[offset:offset+len(newValues[i])], newValues[i])
-		offset += len(newValues[i])
+		node, err := t.pageManager.GetPage(leafNodeID)
+		if err != nil {
+			return nil, err
+		}
+		leafNodeID = PageID(binary.LittleEndian.Uint32(node.Data()[5:9]))
 	}
 
-	node.MarkDirty()
-	return nil
+	return lastKey, nil
 }
 
 // Close flushes all dirty pages to disk
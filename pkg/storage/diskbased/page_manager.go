@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -70,6 +71,13 @@ type PageManager struct {
 	freePages  []PageID
 	pageCache  map[PageID]*Page
 	cacheMutex sync.RWMutex
+
+	// held counts the open readers of each page
+	held      map[PageID]int
+	freeLater map[PageID]bool
+
+	// pagesRead counts GetPage calls, whether or not they hit the cache
+	pagesRead atomic.Uint64
 }
 
 // NewPageManager creates a new page manager
@@ -98,6 +106,8 @@ func NewPageManager(filename string) (*PageManager, error) {
 		numPages:  numPages,
 		freePages: []PageID{},
 		pageCache: make(map[PageID]*Page),
+		held:      make(map[PageID]int),
+		freeLater: make(map[PageID]bool),
 	}
 
 	// If this is a new file, initialize the header page
@@ -173,29 +183,31 @@ func (pm *PageManager) loadFreePageList() error {
 	return nil
 }
 
-// updateFreePageList updates the free page list in the header page
+// updateFreePageList updates the free page list in the header page; the caller must hold cacheMutex
 func (pm *PageManager) updateFreePageList() error {
-	headerPage, err := pm.GetPage(0)
-	if err != nil {
-		return err
+	headerPage, exists := pm.pageCache[0]
+	if !exists {
+		var err error
+		headerPage, err = pm.loadPageFromDisk(0)
+		if err != nil {
+			return err
+		}
+		pm.pageCache[0] = headerPage
 	}
 
 	// Update number of pages
 	binary.LittleEndian.PutUint32(headerPage.data[0:4], pm.numPages)
 
-	// Update number of free pages
-	numFreePages := uint32(len(pm.freePages))
+	// If the free page list overflows the header page, we would need
+	// additional pages to store it. For simplicity, we limit the number of
+	// free pages tracked on disk; the others are lost when the file is
+	// reopened.
+	numFreePages := min(uint32(len(pm.freePages)), (PageSize-8)/4)
 	binary.LittleEndian.PutUint32(headerPage.data[4:8], numFreePages)
 
 	// Write free page IDs
-	for i, pageID := range pm.freePages {
+	for i, pageID := range pm.freePages[:numFreePages] {
 		offset := 8 + (uint32(i) * 4)
-		if offset+4 > PageSize {
-			// If free page list overflows the header page, we would need
-			// additional pages to store it. For simplicity, we limit the
-			// number of free pages tracked.
-			break
-		}
 		binary.LittleEndian.PutUint32(headerPage.data[offset:offset+4], uint32(pageID))
 	}
 
@@ -258,6 +270,7 @@ func (pm *PageManager) GetPage(pageID PageID) (*Page, error) {
 	if pageID >= PageID(pm.numPages) {
 		return nil, fmt.Errorf("page ID %d out of range (max: %d)", pageID, pm.numPages-1)
 	}
+	pm.pagesRead.Add(1)
 
 	// First check the cache
 	pm.cacheMutex.RLock()
@@ -292,6 +305,11 @@ func (pm *PageManager) GetPage(pageID PageID) (*Page, error) {
 	return page, nil
 }
 
+// PagesRead returns the number of pages requested through GetPage
+func (pm *PageManager) PagesRead() uint64 {
+	return pm.pagesRead.Load()
+}
+
 // loadPageFromDisk loads a page from disk into memory
 func (pm *PageManager) loadPageFromDisk(pageID PageID) (*Page, error) {
 	offset := int64(pageID) * int64(PageSize)
@@ -323,6 +341,40 @@ func (pm *PageManager) FreePage(pageID PageID) error {
 	pm.cacheMutex.Lock()
 	defer pm.cacheMutex.Unlock()
 
+	if pm.held[pageID] > 0 {
+		pm.freeLater[pageID] = true
+		return nil
+	}
+	return pm.freePage(pageID)
+}
+
+// HoldPages keeps pages from being freed until UnholdPage is called
+func (pm *PageManager) HoldPages(pageIDs []PageID) {
+	pm.cacheMutex.Lock()
+	defer pm.cacheMutex.Unlock()
+	for _, id := range pageIDs {
+		pm.held[id]++
+	}
+}
+
+// UnholdPage undoes HoldPages for one page, freeing it if FreePage was called
+func (pm *PageManager) UnholdPage(pageID PageID) error {
+	pm.cacheMutex.Lock()
+	defer pm.cacheMutex.Unlock()
+
+	if pm.held[pageID]--; pm.held[pageID] > 0 {
+		return nil
+	}
+	delete(pm.held, pageID)
+	if !pm.freeLater[pageID] {
+		return nil
+	}
+	delete(pm.freeLater, pageID)
+	return pm.freePage(pageID)
+}
+
+// freePage adds a page to the free list. The caller must hold cacheMutex.
+func (pm *PageManager) freePage(pageID PageID) error {
 	// Check if the page is in cache
 	page, exists := pm.pageCache[pageID]
 	if exists {
@@ -342,6 +394,24 @@ func (pm *PageManager) FreePage(pageID PageID) error {
 	return pm.updateFreePageList()
 }
 
+// ReleasePage unpins a page and drops it from the cache once nothing has it pinned
+func (pm *PageManager) ReleasePage(page *Page) error {
+	page.Unpin()
+	if page.pinCount > 0 {
+		return nil
+	}
+	if err := pm.FlushPage(page.id); err != nil {
+		return err
+	}
+
+	pm.cacheMutex.Lock()
+	defer pm.cacheMutex.Unlock()
+	if page.pinCount == 0 {
+		delete(pm.pageCache, page.id)
+	}
+	return nil
+}
+
 // FlushPage writes a page to disk if it's dirty
 func (pm *PageManager) FlushPage(pageID PageID) error {
 	pm.cacheMutex.RLock()
@@ -3,7 +3,6 @@ package diskbased
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"strconv"
 
@@ -355,26 +354,13 @@ type TableRowIDGenerator struct {
 
 // NewTableRowIDGenerator creates a generator for a specific table
 func NewTableRowIDGenerator(schema catalog.TableSchema) *TableRowIDGenerator {
-	primaryKeys := []string{}
-	hasPrimaryKey := false
-
-	// Identify primary key columns
-	for _, col := range schema.Columns() {
-		// Check if this column has a primary key constraint
-		for _, constraint := range col.Constraints() {
-			if constraint == types.ConstraintPrimaryKey {
-				primaryKeys = append(primaryKeys, col.Name())
-				hasPrimaryKey = true
-				break
-			}
-		}
-	}
+	primaryKeys := catalog.PrimaryKey(schema)
 
 	return &TableRowIDGenerator{
 		Schema:           schema,
 		AutoID:           1, // Start auto-increment from 1
 		PrimaryKeyFields: primaryKeys,
-		HasPrimaryKey:    hasPrimaryKey,
+		HasPrimaryKey:    len(primaryKeys) > 0,
 	}
 }
 
@@ -485,12 +471,10 @@ func (g *TableRowIDGenerator) UpdateAutoID(existingID int64) {
 
 // SerializeRow converts a row to bytes for storage
 func SerializeRow(row map[string]parser.Value) ([]byte, error) {
-	return json.Marshal(row)
+	return serializeRow(row, nil)
 }
 
 // DeserializeRow converts bytes back to a row
 func DeserializeRow(data []byte) (map[string]parser.Value, error) {
-	var row map[string]parser.Value
-	err := json.Unmarshal(data, &row)
-	return row, err
+	return deserializeRow(data, nil, nil)
 }
@@ -0,0 +1,384 @@
+package diskbased
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// diskTableSchema is the stored form of a table schema, usable directly once loaded
+type diskTableSchema struct {
+	TableName        string            `json:"name"`
+	Cols             []*diskColumn     `json:"columns"`
+	TableConstraints []*diskConstraint `json:"constraints,omitempty"`
+	Ver              int               `json:"version,omitempty"`
+	TableStats       *diskTableStats   `json:"stats,omitempty"`
+}
+
+// diskColumn is the stored form of a column definition
+type diskColumn struct {
+	ColName        string             `json:"name"`
+	DataType       types.DataType     `json:"type"`
+	Params         []int              `json:"type_params,omitempty"`
+	ColConstraints []types.Constraint `json:"constraints,omitempty"`
+	DefaultValue   *diskValue         `json:"default,omitempty"`
+
+	// DeclaredType is the name of a type that parser.TypeName does not write as declared
+	DeclaredType string `json:"type_name,omitempty"`
+
+	// CollationName names the collation of a TEXT column other than BINARY
+	CollationName string `json:"collation,omitempty"`
+
+	// DefaultExpr is the text of a default that is not a constant
+	DefaultExpr string `json:"default_expr,omitempty"`
+	defaultExpr parser.Expression
+}
+
+// diskConstraint is the stored form of a table constraint
+type diskConstraint struct {
+	Name       string                  `json:"name"`
+	Type       types.Constraint        `json:"type"`
+	Columns    []string                `json:"columns,omitempty"`
+	Check      string                  `json:"check,omitempty"`
+	RefTable   string                  `json:"ref_table,omitempty"`
+	RefColumns []string                `json:"ref_columns,omitempty"`
+	OnDelete   types.ReferentialAction `json:"on_delete,omitempty"`
+	OnUpdate   types.ReferentialAction `json:"on_update,omitempty"`
+	check      parser.Expression
+}
+
+// newDiskTableSchema copies any table schema into its stored form
+func newDiskTableSchema(schema catalog.TableSchema) (*diskTableSchema, error) {
+	if ds, ok := schema.(*diskTableSchema); ok {
+		return ds, nil
+	}
+
+	result := &diskTableSchema{TableName: schema.Name(), Ver: schema.Version()}
+	for _, col := range schema.Columns() {
+		stored, err := newDiskColumn(col)
+		if err != nil {
+			return nil, err
+		}
+		result.Cols = append(result.Cols, stored)
+	}
+	for _, constraint := range schema.Constraints() {
+		stored := &diskConstraint{
+			Name:       constraint.Name,
+			Type:       constraint.Type,
+			Columns:    constraint.Columns,
+			RefTable:   constraint.RefTable,
+			RefColumns: constraint.RefColumns,
+			OnDelete:   constraint.OnDelete,
+			OnUpdate:   constraint.OnUpdate,
+			check:      constraint.Check,
+		}
+		if constraint.Check != nil {
+			stored.Check = fmt.Sprint(constraint.Check)
+		}
+		result.TableConstraints = append(result.TableConstraints, stored)
+	}
+	if stats, ok := schema.Stats(); ok {
+		stored, err := newDiskTableStats(stats)
+		if err != nil {
+			return nil, err
+		}
+		result.TableStats = stored
+	}
+	return result, nil
+}
+
+// withColumn returns the stored form of a schema with a column replaced
+func withColumn(schema catalog.TableSchema, col parser.ColumnDefinition) (*diskTableSchema, error) {
+	stored, err := newDiskTableSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	copied := *stored
+	copied.Cols = slices.Clone(stored.Cols)
+	for i, c := range copied.Cols {
+		if c.ColName == col.Name() {
+			if copied.Cols[i], err = newDiskColumn(col); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &copied, nil
+}
+
+// newDiskColumn copies a column definition into its stored form
+func newDiskColumn(col parser.ColumnDefinition) (*diskColumn, error) {
+	stored := &diskColumn{
+		ColName:        col.Name(),
+		DataType:       col.Type(),
+		Params:         col.TypeParams(),
+		ColConstraints: col.Constraints(),
+	}
+	if name := col.TypeName(); name != parser.TypeName(col.Type(), col.TypeParams()) {
+		stored.DeclaredType = name
+	}
+	if c := col.Collation(); c != parser.CollateBinary {
+		stored.CollationName = c.String()
+	}
+	switch def := col.Default().(type) {
+	case nil:
+	case parser.LiteralExpression:
+		dv, err := newDiskValue(def.Value())
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize default of column %s: %w", col.Name(), err)
+		}
+		stored.DefaultValue = &dv
+	default:
+		stored.DefaultExpr, stored.defaultExpr = fmt.Sprint(def), def
+	}
+	return stored, nil
+}
+
+// Name returns the table name
+func (s *diskTableSchema) Name() string {
+	return s.TableName
+}
+
+// Columns returns all column definitions
+func (s *diskTableSchema) Columns() []parser.ColumnDefinition {
+	columns := make([]parser.ColumnDefinition, len(s.Cols))
+	for i, col := range s.Cols {
+		columns[i] = col
+	}
+	return columns
+}
+
+// GetColumn retrieves a column by name
+func (s *diskTableSchema) GetColumn(name string) (parser.ColumnDefinition, bool) {
+	for _, col := range s.Cols {
+		if col.ColName == name {
+			return col, true
+		}
+	}
+	return nil, false
+}
+
+// HasColumn checks if a column exists
+func (s *diskTableSchema) HasColumn(name string) bool {
+	_, found := s.GetColumn(name)
+	return found
+}
+
+// GetColumnType gets the data type of a column
+func (s *diskTableSchema) GetColumnType(name string) types.DataType {
+	col, found := s.GetColumn(name)
+	if !found {
+		return types.TypeNull
+	}
+	return col.Type()
+}
+
+// Constraints returns the named, multi-column and CHECK constraints
+func (s *diskTableSchema) Constraints() []parser.TableConstraint {
+	constraints := make([]parser.TableConstraint, len(s.TableConstraints))
+	for i, c := range s.TableConstraints {
+		constraints[i] = parser.TableConstraint{
+			Name: c.Name, Type: c.Type, Columns: c.Columns, Check: c.check,
+			RefTable: c.RefTable, RefColumns: c.RefColumns, OnDelete: c.OnDelete, OnUpdate: c.OnUpdate,
+		}
+	}
+	return constraints
+}
+
+// Version counts the times the table has been altered
+func (s *diskTableSchema) Version() int {
+	return s.Ver
+}
+
+// Stats returns the statistics of the table, if it has been analyzed
+func (s *diskTableSchema) Stats() (catalog.TableStats, bool) {
+	if s.TableStats == nil {
+		return catalog.TableStats{}, false
+	}
+	return s.TableStats.tableStats(), true
+}
+
+// Name returns the column name
+func (c *diskColumn) Name() string {
+	return c.ColName
+}
+
+// Type returns the column data type
+func (c *diskColumn) Type() types.DataType {
+	return c.DataType
+}
+
+// TypeParams returns the numbers given with the type
+func (c *diskColumn) TypeParams() []int {
+	return c.Params
+}
+
+// TypeName writes the type of the column as it was declared
+func (c *diskColumn) TypeName() string {
+	if c.DeclaredType != "" {
+		return c.DeclaredType
+	}
+	return parser.TypeName(c.DataType, c.Params)
+}
+
+// Constraints returns the column constraints
+func (c *diskColumn) Constraints() []types.Constraint {
+	return c.ColConstraints
+}
+
+// Collation returns the collation of the text in the column
+func (c *diskColumn) Collation() parser.Collation {
+	collation, _ := parser.LookupCollation(c.CollationName)
+	return collation
+}
+
+// Default returns the expression that gives the column its value in rows that do not give one
+func (c *diskColumn) Default() parser.Expression {
+	switch {
+	case c.defaultExpr != nil:
+		return c.defaultExpr
+	case c.DefaultValue != nil:
+		return parser.NewLiteralExpression(c.DefaultValue.value())
+	}
+	return nil
+}
+
+// parseExpressions parses the stored defaults and CHECK conditions of a schema
+func (s *diskTableSchema) parseExpressions(functions *parser.FunctionRegistry) error {
+	for _, col := range s.Cols {
+		if col.DefaultExpr == "" {
+			continue
+		}
+		expr, err := parser.ParseExpressionWithFunctions(col.DefaultExpr, functions)
+		if err != nil {
+			return fmt.Errorf("invalid default of column %s: %w", col.ColName, err)
+		}
+		col.defaultExpr = expr
+	}
+	for _, constraint := range s.TableConstraints {
+		if constraint.Check == "" {
+			continue
+		}
+		expr, err := parser.ParseExpressionWithFunctions(constraint.Check, functions)
+		if err != nil {
+			return fmt.Errorf("invalid check constraint %s: %w", constraint.Name, err)
+		}
+		constraint.check = expr
+	}
+	return nil
+}
+
+// diskTableStats is the stored form of the statistics of a table
+type diskTableStats struct {
+	RowCount int64                       `json:"row_count"`
+	Columns  map[string]*diskColumnStats `json:"columns,omitempty"`
+}
+
+// diskColumnStats is the stored form of the statistics of a column
+type diskColumnStats struct {
+	DistinctCount int64       `json:"distinct,omitempty"`
+	NullFraction  float64     `json:"null_fraction,omitempty"`
+	Histogram     []diskValue `json:"histogram,omitempty"`
+}
+
+// newDiskTableStats copies table statistics into their stored form
+func newDiskTableStats(stats catalog.TableStats) (*diskTableStats, error) {
+	result := &diskTableStats{RowCount: stats.RowCount, Columns: make(map[string]*diskColumnStats, len(stats.Columns))}
+	for name, colStats := range stats.Columns {
+		stored := &diskColumnStats{DistinctCount: colStats.DistinctCount, NullFraction: colStats.NullFraction}
+		for _, bound := range colStats.Histogram {
+			dv, err := newDiskValue(bound)
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize histogram of column %s: %w", name, err)
+			}
+			stored.Histogram = append(stored.Histogram, dv)
+		}
+		result.Columns[name] = stored
+	}
+	return result, nil
+}
+
+// tableStats converts stored statistics back
+func (s *diskTableStats) tableStats() catalog.TableStats {
+	stats := catalog.TableStats{RowCount: s.RowCount, Columns: make(map[string]catalog.ColumnStats, len(s.Columns))}
+	for name, stored := range s.Columns {
+		colStats := catalog.ColumnStats{DistinctCount: stored.DistinctCount, NullFraction: stored.NullFraction}
+		for _, dv := range stored.Histogram {
+			colStats.Histogram = append(colStats.Histogram, dv.value())
+		}
+		stats.Columns[name] = colStats
+	}
+	return stats
+}
+
+// diskTableEntry is the catalog record of a table
+type diskTableEntry struct {
+	Schema  *diskTableSchema  `json:"schema"`
+	Indexes []*diskIndexEntry `json:"indexes,omitempty"`
+}
+
+// diskSequenceEntry is the catalog record of a sequence
+type diskSequenceEntry struct {
+	Name      string `json:"name"`
+	Start     int64  `json:"start"`
+	Increment int64  `json:"increment"`
+	Value     int64  `json:"value"`
+	Called    bool   `json:"called,omitempty"`
+}
+
+// diskIndexEntry is the catalog record of a secondary index
+type diskIndexEntry struct {
+	Name        string   `json:"name"`
+	Columns     []string `json:"columns"`
+	Expressions []string `json:"expressions,omitempty"`
+	Unique      bool     `json:"unique,omitempty"`
+	Constraint  bool     `json:"constraint,omitempty"`
+	RootPageID  PageID   `json:"root"`
+}
+
+// newDiskIndexEntry builds the catalog record of an index
+func newDiskIndexEntry(index *diskIndex) *diskIndexEntry {
+	entry := &diskIndexEntry{
+		Name:       index.Def.Name,
+		Columns:    index.Def.Columns,
+		Unique:     index.Def.Unique,
+		Constraint: index.Def.Constraint,
+		RootPageID: index.Tree.rootPageID,
+	}
+	if index.Def.Expressions != nil {
+		entry.Expressions = make([]string, len(index.Def.Expressions))
+		for i, expr := range index.Def.Expressions {
+			if expr != nil {
+				entry.Expressions[i] = fmt.Sprint(expr)
+			}
+		}
+	}
+	return entry
+}
+
+// definition gives the index an entry records
+func (e *diskIndexEntry) definition(tableName string, functions *parser.FunctionRegistry) (catalog.Index, error) {
+	def := catalog.Index{
+		Name:       e.Name,
+		Table:      tableName,
+		Columns:    e.Columns,
+		Unique:     e.Unique,
+		Constraint: e.Constraint,
+	}
+	if e.Expressions != nil {
+		def.Expressions = make([]parser.Expression, len(e.Expressions))
+		for i, text := range e.Expressions {
+			if text == "" {
+				continue
+			}
+			expr, err := parser.ParseExpressionWithFunctions(text, functions)
+			if err != nil {
+				return catalog.Index{}, fmt.Errorf("invalid expression of index %s: %w", e.Name, err)
+			}
+			def.Expressions[i] = expr
+		}
+	}
+	return def, nil
+}
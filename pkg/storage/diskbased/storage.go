@@ -2,11 +2,13 @@
 package diskbased
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
@@ -31,7 +33,14 @@ type DiskStorage struct {
 	dbDir       string
 	pageManager *PageManager
 	tables      map[string]*TableInfo
+	sequences   map[string]*storage.Sequence
 	mu          sync.RWMutex
+
+	// functions resolves the function calls in the stored expressions
+	functions *parser.FunctionRegistry
+
+	// droppedPagesRead keeps the page reads of dropped tables in PagesRead
+	droppedPagesRead uint64
 }
 
 // TableInfo stores information about a table
@@ -39,10 +48,27 @@ type TableInfo struct {
 	Schema     catalog.TableSchema
 	IndexTree  *BPlusTree
 	RootPageID PageID
+
+	// RowIDs hands out keys for tables without a primary key
+	RowIDs *TableRowIDGenerator
+
+	// Indexes holds the secondary indexes of the table
+	Indexes []*diskIndex
+}
+
+// diskIndex is a secondary index, stored as its own B+ tree in the table's file
+type diskIndex struct {
+	Def  catalog.Index
+	Tree *BPlusTree
 }
 
 // NewDiskStorage creates a new disk-based storage engine
 func NewDiskStorage(dbDir string) (*DiskStorage, error) {
+	return NewDiskStorageWithFunctions(dbDir, parser.NewFunctionRegistry())
+}
+
+// NewDiskStorageWithFunctions creates a disk-based storage engine that can call registered functions
+func NewDiskStorageWithFunctions(dbDir string, functions *parser.FunctionRegistry) (*DiskStorage, error) {
 	// Create database directory if it doesn't exist
 	if _, err := os.Stat(dbDir); os.IsNotExist(err) {
 		err := os.MkdirAll(dbDir, 0755)
@@ -62,6 +88,8 @@ func NewDiskStorage(dbDir string) (*DiskStorage, error) {
 		dbDir:       dbDir,
 		pageManager: pageManager,
 		tables:      make(map[string]*TableInfo),
+		sequences:   make(map[string]*storage.Sequence),
+		functions:   functions,
 	}
 
 	// Load existing tables from catalog
@@ -81,14 +109,17 @@ func (ds *DiskStorage) loadCatalog() error {
 		return nil
 	}
 
-	// Get catalog root page
-	page, err := ds.pageManager.GetPage(1)
-	if err != nil {
-		return err
+	// The catalog runs across the pages after the header, in order
+	var data []byte
+	for pageID := PageID(1); pageID < PageID(ds.pageManager.numPages); pageID++ {
+		page, err := ds.pageManager.GetPage(pageID)
+		if err != nil {
+			return err
+		}
+		data = append(data, page.Data()...)
 	}
 
 	// Read catalog data
-	data := page.Data()
 	numTables := binary.LittleEndian.Uint32(data[0:4])
 	offset := 4
 
@@ -112,11 +143,15 @@ func (ds *DiskStorage) loadCatalog() error {
 		offset += int(schemaLen)
 
 		// Unmarshal schema
-		var schema catalog.TableSchema
-		err = json.Unmarshal(schemaJSON, &schema)
+		entry := &diskTableEntry{}
+		err := json.Unmarshal(schemaJSON, entry)
 		if err != nil {
 			return err
 		}
+		schema := entry.Schema
+		if err := schema.parseExpressions(ds.functions); err != nil {
+			return err
+		}
 
 		// Open table file
 		tableFile := filepath.Join(ds.dbDir, tableName+".db")
@@ -131,11 +166,62 @@ func (ds *DiskStorage) loadCatalog() error {
 			return err
 		}
 
+		// Continue auto-generated row IDs after the largest one in use
+		rowIDs := NewTableRowIDGenerator(schema)
+		if !rowIDs.HasPrimaryKey {
+			lastKey, err := tree.LastKey()
+			if err != nil {
+				return err
+			}
+			if len(lastKey) == 8 {
+				rowIDs.UpdateAutoID(int64(binary.BigEndian.Uint64(lastKey)))
+			}
+		}
+
+		// Reopen the secondary indexes, which live in the same file
+		var indexes []*diskIndex
+		for _, indexEntry := range entry.Indexes {
+			indexTree, err := NewBPlusTree(tablePageManager, indexEntry.RootPageID)
+			if err != nil {
+				return err
+			}
+			def, err := indexEntry.definition(tableName, ds.functions)
+			if err != nil {
+				return err
+			}
+			indexes = append(indexes, &diskIndex{Def: def, Tree: indexTree})
+		}
+
 		// Add table to tables map
 		ds.tables[tableName] = &TableInfo{
 			Schema:     schema,
 			IndexTree:  tree,
 			RootPageID: rootPageID,
+			RowIDs:     rowIDs,
+			Indexes:    indexes,
+		}
+	}
+
+	// The sequences follow the tables, as a JSON list
+	if offset+4 > len(data) {
+		return nil
+	}
+	sequencesLen := binary.LittleEndian.Uint32(data[offset : offset+4])
+	offset += 4
+	if sequencesLen == 0 {
+		return nil
+	}
+	var sequences []*diskSequenceEntry
+	if err := json.Unmarshal(data[offset:offset+int(sequencesLen)], &sequences); err != nil {
+		return err
+	}
+	for _, seq := range sequences {
+		ds.sequences[seq.Name] = &storage.Sequence{
+			Name:      seq.Name,
+			Start:     seq.Start,
+			Increment: seq.Increment,
+			Value:     seq.Value,
+			Called:    seq.Called,
 		}
 	}
 
@@ -144,61 +230,117 @@ func (ds *DiskStorage) loadCatalog() error {
 
 // saveCatalog saves the catalog to disk
 func (ds *DiskStorage) saveCatalog() error {
-	// Get catalog page
-	page, err := ds.pageManager.GetPage(1)
-	if err != nil {
-		// Create page if it doesn't exist
-		page, err = ds.pageManager.AllocatePage()
-		if err != nil {
-			return err
-		}
-	}
-
-	// Write catalog data
-	data := page.Data()
-	numTables := uint32(len(ds.tables))
-	binary.LittleEndian.PutUint32(data[0:4], numTables)
-	offset := 4
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(ds.tables)))
 
 	for tableName, table := range ds.tables {
 		// Write table name
-		tableNameLen := uint32(len(tableName))
-		binary.LittleEndian.PutUint32(data[offset:offset+4], tableNameLen)
-		offset += 4
-		copy(data[offset:offset+int(tableNameLen)], tableName)
-		offset += int(tableNameLen)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(tableName)))
+		data = append(data, tableName...)
 
-		// Write root page ID
-		binary.LittleEndian.PutUint32(data[offset:offset+4], uint32(table.RootPageID))
-		offset += 4
+		// Write root page ID, which moves whenever the root node splits
+		table.RootPageID = table.IndexTree.rootPageID
+		data = binary.LittleEndian.AppendUint32(data, uint32(table.RootPageID))
 
-		// Marshal schema
-		schemaJSON, err := json.Marshal(table.Schema)
+		// Marshal schema and indexes
+		schema, err := newDiskTableSchema(table.Schema)
+		if err != nil {
+			return err
+		}
+		entry := &diskTableEntry{Schema: schema}
+		for _, index := range table.Indexes {
+			entry.Indexes = append(entry.Indexes, newDiskIndexEntry(index))
+		}
+		schemaJSON, err := json.Marshal(entry)
 		if err != nil {
 			return err
 		}
 
-		// Write schema length
-		schemaLen := uint32(len(schemaJSON))
-		binary.LittleEndian.PutUint32(data[offset:offset+4], schemaLen)
-		offset += 4
-
-		// Write schema JSON
-		copy(data[offset:offset+int(schemaLen)], schemaJSON)
-		offset += int(schemaLen)
+		// Write schema length and JSON
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(schemaJSON)))
+		data = append(data, schemaJSON...)
 	}
 
-	// Mark page as dirty
-	page.MarkDirty()
+	// Write the sequences
+	var sequences []*diskSequenceEntry
+	for _, seq := range ds.sequences {
+		sequences = append(sequences, &diskSequenceEntry{
+			Name:      seq.Name,
+			Start:     seq.Start,
+			Increment: seq.Increment,
+			Value:     seq.Value,
+			Called:    seq.Called,
+		})
+	}
+	sequencesJSON := []byte{}
+	if len(sequences) > 0 {
+		var err error
+		if sequencesJSON, err = json.Marshal(sequences); err != nil {
+			return err
+		}
+	}
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(sequencesJSON)))
+	data = append(data, sequencesJSON...)
+
+	// Spread the catalog across as many pages after the header as it
+	// needs, and clear what an older, longer catalog left behind it
+	for pageID := PageID(1); len(data) > 0 || pageID < PageID(ds.pageManager.numPages); pageID++ {
+		var page *Page
+		var err error
+		if pageID < PageID(ds.pageManager.numPages) {
+			page, err = ds.pageManager.GetPage(pageID)
+		} else {
+			page, err = ds.pageManager.AllocatePage()
+		}
+		if err != nil {
+			return err
+		}
+		n := copy(page.Data(), data)
+		clear(page.Data()[n:])
+		data = data[n:]
+		page.MarkDirty()
+	}
 
 	// Flush all dirty pages
 	return ds.pageManager.FlushAllPages()
 }
 
-// serializeRow serializes a row into a byte slice
-func serializeRow(values map[string]parser.Value, schema catalog.TableSchema) ([]byte, error) {
+// diskValue is the JSON form of a single column value, with large BLOBs in overflow pages
+type diskValue struct {
+	storage.EncodedValue
+	Blob *diskBlob `json:"blob,omitempty"`
+}
+
+// newDiskValue converts a value to its JSON form
+func newDiskValue(val parser.Value) (diskValue, error) {
+	ev, err := storage.EncodeValue(val)
+	return diskValue{EncodedValue: ev}, err
+}
+
+// value converts a value back from its JSON form
+func (dv diskValue) value() parser.Value {
+	return dv.EncodedValue.Value()
+}
+
+// serializeRow serializes a row into a byte slice, writing large BLOBs to pm
+func serializeRow(values map[string]parser.Value, pm *PageManager) ([]byte, error) {
 	// Serialize as JSON for simplicity
-	return json.Marshal(values)
+	encoded := make(map[string]diskValue, len(values))
+	for colName, val := range values {
+		dv, err := newDiskValue(val)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize column %s: %w", colName, err)
+		}
+		if pm != nil && len(dv.Bytes) > InlineBlobSize {
+			blob, err := writeBlob(pm, bytes.NewReader(dv.Bytes))
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize column %s: %w", colName, err)
+			}
+			dv.Bytes, dv.Blob = nil, &blob
+		}
+		encoded[colName] = dv
+	}
+
+	return json.Marshal(encoded)
 }
 
 // Close closes the storage and releases resources
@@ -206,75 +348,97 @@ func (ds *DiskStorage) Close() error {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	// Save catalog before closing
+	// Save catalog before closing, but close the files even if that fails,
+	// so the database can be opened again
 	err := ds.saveCatalog()
-	if err != nil {
-		return err
-	}
 
 	// Close page manager
 	if ds.pageManager != nil {
-		err := ds.pageManager.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close catalog page manager: %w", err)
+		if closeErr := ds.pageManager.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close catalog page manager: %w", closeErr)
 		}
 	}
 
 	// Close all table page managers
 	for tableName, table := range ds.tables {
 		if table.IndexTree != nil && table.IndexTree.pageManager != nil {
-			err := table.IndexTree.pageManager.Close()
-			if err != nil {
-				return fmt.Errorf("failed to close table %s page manager: %w", tableName, err)
+			if closeErr := table.IndexTree.pageManager.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("failed to close table %s page manager: %w", tableName, closeErr)
 			}
 		}
 	}
 
-	return nil
-}
-
-// deserializeRow deserializes a byte slice into a row
-func deserializeRow(data []byte, schema catalog.TableSchema) (map[string]parser.Value, error) {
-	var values map[string]parser.Value
-	err := json.Unmarshal(data, &values)
-	return values, err
+	return err
 }
 
-// createRowID creates a row ID from values
-func createRowID(values map[string]parser.Value, schema catalog.TableSchema) ([]byte, error) {
-	// Find primary key columns
-	primaryKeyColumns := getPrimaryKeyColumns(schema)
+// PagesRead returns the number of pages read from the catalog and table files
+func (ds *DiskStorage) PagesRead() uint64 {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
 
-	// Use primary key if available
-	if len(primaryKeyColumns) > 0 {
-		return serializeCompositePrimaryKey(values, primaryKeyColumns)
+	total := ds.droppedPagesRead + ds.pageManager.PagesRead()
+	for _, table := range ds.tables {
+		total += table.IndexTree.pageManager.PagesRead()
 	}
-
-	// Otherwise, use all values
-	return serializeRow(values, schema)
+	return total
 }
 
-// Helper function to get primary key columns from schema
-func getPrimaryKeyColumns(schema catalog.TableSchema) []string {
-	var primaryKeyColumns []string
+// deserializeRow deserializes a byte slice into a row of a schema
+func deserializeRow(data []byte, schema catalog.TableSchema, pm *PageManager) (map[string]parser.Value, error) {
+	var encoded map[string]diskValue
+	err := json.Unmarshal(data, &encoded)
+	if err != nil {
+		return nil, err
+	}
 
-	// Go through all columns and check for primary key constraint
+	values := make(map[string]parser.Value, len(encoded))
+	for colName, dv := range encoded {
+		if dv.Blob != nil {
+			if pm == nil {
+				return nil, fmt.Errorf("column %s holds a BLOB stored in overflow pages", colName)
+			}
+			if dv.Bytes, err = readBlob(pm, *dv.Blob); err != nil {
+				return nil, err
+			}
+		}
+		values[colName] = dv.value()
+	}
 	for _, col := range schema.Columns() {
-		for _, constraint := range col.Constraints() {
-			if constraint == types.ConstraintPrimaryKey {
-				primaryKeyColumns = append(primaryKeyColumns, col.Name())
-				break
+		val, ok := values[col.Name()]
+		if !ok {
+			lit, isLiteral := col.Default().(parser.LiteralExpression)
+			if !isLiteral {
+				continue
 			}
+			val = lit.Value()
 		}
+		values[col.Name()] = parser.Collate(val, col.Collation())
 	}
 
-	return primaryKeyColumns
+	return values, nil
+}
+
+// createRowID creates the B+ tree key for a new row
+func createRowID(values map[string]parser.Value, tableInfo *TableInfo) ([]byte, error) {
+	// Find primary key columns
+	primaryKeyColumns := catalog.PrimaryKey(tableInfo.Schema)
+
+	// Use primary key if available
+	if len(primaryKeyColumns) > 0 {
+		return serializeCompositePrimaryKey(values, primaryKeyColumns)
+	}
+
+	// Otherwise, use an auto-generated ID
+	rowID, err := tableInfo.RowIDs.Generate(values)
+	if err != nil {
+		return nil, err
+	}
+	return rowID.Bytes(), nil
 }
 
 // Helper function to serialize primary key values
 func serializeCompositePrimaryKey(values map[string]parser.Value, primaryKey []string) ([]byte, error) {
 	pkValues := make([]parser.Value, 0, len(primaryKey))
-	pkTypes := make([]types.DataType, 0, len(primaryKey))
 
 	for _, colName := range primaryKey {
 		val, ok := values[colName]
@@ -283,12 +447,9 @@ func serializeCompositePrimaryKey(values map[string]parser.Value, primaryKey []s
 		}
 
 		pkValues = append(pkValues, val)
-		pkTypes = append(pkTypes, val.Type())
 	}
 
-	// Create composite row ID with values and types
-	key := NewCompositeRowID(pkValues, pkTypes)
-	return key.Bytes(), nil
+	return storage.EncodeKey(pkValues), nil
 }
 
 // CreateTable creates a new table in storage
@@ -314,15 +475,36 @@ func (ds *DiskStorage) CreateTable(tableName string, schema catalog.TableSchema)
 		return err
 	}
 
-	// Add table to tables map
-	ds.tables[tableName] = &TableInfo{
+	tableInfo := &TableInfo{
 		Schema:     schema,
 		IndexTree:  tree,
 		RootPageID: tree.rootPageID,
+		RowIDs:     NewTableRowIDGenerator(schema),
 	}
 
-	// Save catalog
-	return ds.saveCatalog()
+	// UNIQUE constraints are enforced through secondary indexes
+	for _, def := range catalog.KeyIndexes(schema) {
+		if def.Primary {
+			continue
+		}
+		indexTree, err := CreateNewTree(tablePageManager)
+		if err != nil {
+			return err
+		}
+		tableInfo.Indexes = append(tableInfo.Indexes, &diskIndex{Def: def, Tree: indexTree})
+	}
+
+	// Add table to tables map
+	ds.tables[tableName] = tableInfo
+
+	// Save catalog, leaving the table out again if that fails
+	if err := ds.saveCatalog(); err != nil {
+		delete(ds.tables, tableName)
+		tablePageManager.Close()
+		os.Remove(tableFile)
+		return err
+	}
+	return nil
 }
 
 // DropTable removes a table from storage
@@ -338,6 +520,7 @@ func (ds *DiskStorage) DropTable(tableName string) error {
 
 	// Close B+ tree
 	if tableInfo.IndexTree != nil && tableInfo.IndexTree.pageManager != nil {
+		ds.droppedPagesRead += tableInfo.IndexTree.pageManager.PagesRead()
 		tableInfo.IndexTree.pageManager.Close()
 	}
 
@@ -366,24 +549,166 @@ func (ds *DiskStorage) Insert(tableName string, values map[string]parser.Value)
 		return fmt.Errorf("table %s does not exist", tableName)
 	}
 
+	values, err := storage.CoerceRow(tableInfo.Schema, values)
+	if err != nil {
+		return err
+	}
+	if err := storage.CheckRow(tableInfo.Schema, values); err != nil {
+		return err
+	}
+
+	// Check PRIMARY KEY and UNIQUE constraints
+	err = ds.checkUnique(tableInfo, values)
+	if err != nil {
+		return err
+	}
+
 	// Create row ID
-	rowID, err := createRowID(values, tableInfo.Schema)
+	rowID, err := createRowID(values, tableInfo)
 	if err != nil {
 		return err
 	}
 
+	return insertRow(tableInfo, rowID, values)
+}
+
+// insertRow stores a row under its key and adds it to every secondary index
+func insertRow(tableInfo *TableInfo, rowID []byte, row storage.Row) error {
 	// Serialize row
-	rowData, err := serializeRow(values, tableInfo.Schema)
+	rowData, err := serializeRow(row, tableInfo.IndexTree.pageManager)
 	if err != nil {
 		return err
 	}
 
 	// Insert into B+ tree
-	return tableInfo.IndexTree.Insert(rowID, rowData)
+	err = tableInfo.IndexTree.Insert(rowID, rowData)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range tableInfo.Indexes {
+		err = index.Tree.Insert(index.entryKey(row, rowID), rowID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRow removes a row and its secondary index entries
+func deleteRow(tableInfo *TableInfo, rowID []byte, row storage.Row) error {
+	err := tableInfo.freeBlobs(rowID)
+	if err != nil {
+		return err
+	}
+	err = tableInfo.IndexTree.Delete(rowID)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range tableInfo.Indexes {
+		err = index.Tree.Delete(index.entryKey(row, rowID))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexDefs returns the definitions of every index of a table, including the primary key
+func (tableInfo *TableInfo) indexDefs() []catalog.Index {
+	var defs []catalog.Index
+	for _, def := range catalog.KeyIndexes(tableInfo.Schema) {
+		if def.Primary {
+			defs = append(defs, def)
+		}
+	}
+	for _, index := range tableInfo.Indexes {
+		defs = append(defs, index.Def)
+	}
+	return defs
+}
+
+// index finds a secondary index by name
+func (tableInfo *TableInfo) index(name string) *diskIndex {
+	for _, index := range tableInfo.Indexes {
+		if index.Def.Name == name {
+			return index
+		}
+	}
+	return nil
+}
+
+// keyPrefix encodes the index key of a row
+func (index *diskIndex) keyPrefix(row storage.Row) []byte {
+	return storage.EncodeKey(index.Def.KeyValues(row))
+}
+
+// entryKey builds the index entry key of a row
+func (index *diskIndex) entryKey(row storage.Row, rowID []byte) []byte {
+	return append(index.keyPrefix(row), rowID...)
+}
+
+// containsPrefix reports whether any entry of the index starts with prefix
+func (index *diskIndex) containsPrefix(prefix []byte) (bool, error) {
+	found := false
+	err := index.Tree.Scan(prefix, func(key, value []byte) (bool, error) {
+		found = bytes.HasPrefix(key, prefix)
+		return false, nil
+	})
+	return found, err
+}
+
+// checkUnique verifies that inserting row would not violate a PRIMARY KEY or UNIQUE constraint
+func (ds *DiskStorage) checkUnique(tableInfo *TableInfo, row storage.Row) error {
+	for _, def := range tableInfo.indexDefs() {
+		if !def.Unique {
+			continue
+		}
+
+		keyValues, hasNull, err := storage.UniqueKey(def, row)
+		if err != nil {
+			return err
+		}
+		if hasNull {
+			continue
+		}
+
+		exists := false
+		if def.Primary {
+			// The primary key is the B+ tree key, so a point lookup is enough
+			key, err := serializeCompositePrimaryKey(row, def.Columns)
+			if err != nil {
+				return err
+			}
+			_, err = tableInfo.IndexTree.Get(key)
+			if err != nil && err != ErrKeyNotFound {
+				return err
+			}
+			exists = err == nil
+		} else {
+			index := tableInfo.index(def.Name)
+			exists, err = index.containsPrefix(index.keyPrefix(row))
+			if err != nil {
+				return err
+			}
+		}
+
+		if exists {
+			return storage.NewUniqueViolation(tableInfo.Schema.Name(), def, keyValues)
+		}
+	}
+
+	return nil
 }
 
 // Update updates rows in a table that match a condition
 func (ds *DiskStorage) Update(tableName string, values map[string]parser.Value, condition storage.FilterFunc) (int, error) {
+	return ds.UpdatePath(tableName, storage.SetValues(values), storage.AccessPath{}, condition)
+}
+
+// UpdatePath updates the rows reached through path that match a condition
+func (ds *DiskStorage) UpdatePath(tableName string, set storage.SetFunc, path storage.AccessPath, condition storage.FilterFunc) (int, error) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
@@ -393,70 +718,103 @@ func (ds *DiskStorage) Update(tableName string, values map[string]parser.Value,
 		return 0, fmt.Errorf("table %s does not exist", tableName)
 	}
 
-	// Get all rows from the table
-	iter, err := ds.Select(tableName, nil, nil)
+	// Find the matching rows
+	iter, err := ds.scanTable(tableInfo, []string{"*", storage.RowIDColumn}, path, condition)
 	if err != nil {
 		return 0, err
 	}
 	defer iter.Close()
 
-	// Update matching rows
-	count := 0
-	for iter.Next() {
-		row := iter.Row()
+	if len(iter.keys) == 0 {
+		return 0, nil
+	}
 
-		// Apply condition if provided
-		if condition != nil {
-			match, err := condition(row)
-			if err != nil {
-				return count, err
-			}
-			if !match {
-				continue
-			}
+	oldKeys := iter.keys
+	oldRows := iter.originalRows
+	newRows := make([]storage.Row, len(oldRows))
+	matched := make(map[string]storage.Row, len(oldKeys))
+	for i, row := range oldRows {
+		values, err := set(row)
+		if err != nil {
+			return 0, err
 		}
-
-		// Update values
-		for key, value := range values {
-			row[key] = value
+		values, err = storage.CoerceValues(tableInfo.Schema, values)
+		if err != nil {
+			return 0, err
 		}
+		newRows[i] = storage.Row(mergeRow(row, values))
+		matched[string(oldKeys[i])] = newRows[i]
+		if err := storage.CheckRow(tableInfo.Schema, newRows[i]); err != nil {
+			return 0, err
+		}
+	}
 
-		// Delete old row
-		oldRowID, err := createRowID(iter.(*DiskRowIterator).originalRow, tableInfo.Schema)
+	// Make sure the table still satisfies its unique indexes afterwards,
+	// before changing anything
+	checker := storage.NewIndexUniqueChecker(tableName, tableInfo.indexDefs())
+	if !checker.Empty() {
+		all, err := ds.scanTable(tableInfo, nil, storage.AccessPath{}, nil)
 		if err != nil {
-			return count, err
+			return 0, err
 		}
-		err = tableInfo.IndexTree.Delete(oldRowID)
-		if err != nil {
-			return count, err
+		for i, row := range all.originalRows {
+			if newRow, ok := matched[string(all.keys[i])]; ok {
+				row = newRow
+			}
+			if err := checker.Add(row); err != nil {
+				return 0, err
+			}
 		}
+	}
 
-		// Insert updated row
-		newRowID, err := createRowID(row, tableInfo.Schema)
+	// Delete old rows first, so rows can trade primary key values
+	for i, oldKey := range oldKeys {
+		err = deleteRow(tableInfo, oldKey, oldRows[i])
 		if err != nil {
-			return count, err
+			return 0, err
 		}
-		rowData, err := serializeRow(row, tableInfo.Schema)
-		if err != nil {
-			return count, err
+	}
+
+	// Insert updated rows
+	hasPrimaryKey := len(catalog.PrimaryKey(tableInfo.Schema)) > 0
+	for i, row := range newRows {
+		newRowID := oldKeys[i]
+		if hasPrimaryKey {
+			newRowID, err = createRowID(row, tableInfo)
+			if err != nil {
+				return i, err
+			}
 		}
-		err = tableInfo.IndexTree.Insert(newRowID, rowData)
+		err = insertRow(tableInfo, newRowID, row)
 		if err != nil {
-			return count, err
+			return i, err
 		}
-
-		count++
 	}
 
-	if iter.Err() != nil {
-		return count, iter.Err()
-	}
+	return len(newRows), nil
+}
 
-	return count, nil
+// mergeRow returns a copy of row with values applied on top of it, without the row ID
+func mergeRow(row storage.Row, values map[string]parser.Value) map[string]parser.Value {
+	merged := make(map[string]parser.Value, len(row)+len(values))
+	for colName, val := range row {
+		if colName != storage.RowIDColumn {
+			merged[colName] = val
+		}
+	}
+	for colName, val := range values {
+		merged[colName] = val
+	}
+	return merged
 }
 
 // Delete deletes rows from a table that match a condition
 func (ds *DiskStorage) Delete(tableName string, condition storage.FilterFunc) (int, error) {
+	return ds.DeletePath(tableName, storage.AccessPath{}, condition)
+}
+
+// DeletePath deletes the rows reached through path that match a condition
+func (ds *DiskStorage) DeletePath(tableName string, path storage.AccessPath, condition storage.FilterFunc) (int, error) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
@@ -466,8 +824,8 @@ func (ds *DiskStorage) Delete(tableName string, condition storage.FilterFunc) (i
 		return 0, fmt.Errorf("table %s does not exist", tableName)
 	}
 
-	// Get all rows from the table
-	iter, err := ds.Select(tableName, nil, nil)
+	// Get all matching rows from the table
+	iter, err := ds.scanTable(tableInfo, []string{"*", storage.RowIDColumn}, path, condition)
 	if err != nil {
 		return 0, err
 	}
@@ -475,26 +833,8 @@ func (ds *DiskStorage) Delete(tableName string, condition storage.FilterFunc) (i
 
 	// Delete matching rows
 	count := 0
-	for iter.Next() {
-		row := iter.Row()
-
-		// Apply condition if provided
-		if condition != nil {
-			match, err := condition(row)
-			if err != nil {
-				return count, err
-			}
-			if !match {
-				continue
-			}
-		}
-
-		// Delete row
-		rowID, err := createRowID(row, tableInfo.Schema)
-		if err != nil {
-			return count, err
-		}
-		err = tableInfo.IndexTree.Delete(rowID)
+	for i, rowID := range iter.keys {
+		err = deleteRow(tableInfo, rowID, iter.originalRows[i])
 		if err != nil {
 			return count, err
 		}
@@ -502,15 +842,16 @@ func (ds *DiskStorage) Delete(tableName string, condition storage.FilterFunc) (i
 		count++
 	}
 
-	if iter.Err() != nil {
-		return count, iter.Err()
-	}
-
 	return count, nil
 }
 
 // Select selects rows from a table that match a condition
 func (ds *DiskStorage) Select(tableName string, columns []string, condition storage.FilterFunc) (storage.RowIterator, error) {
+	return ds.SelectPath(tableName, columns, storage.AccessPath{}, condition)
+}
+
+// SelectPath selects the rows reached through path that match a condition
+func (ds *DiskStorage) SelectPath(tableName string, columns []string, path storage.AccessPath, condition storage.FilterFunc) (storage.RowIterator, error) {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
 
@@ -520,20 +861,312 @@ func (ds *DiskStorage) Select(tableName string, columns []string, condition stor
 		return nil, fmt.Errorf("table %s does not exist", tableName)
 	}
 
+	return ds.scanTable(tableInfo, columns, path, condition)
+}
+
+// AlterTable changes the schema of a table
+func (ds *DiskStorage) AlterTable(tableName string, schema catalog.TableSchema, change catalog.SchemaChange) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tableInfo, exists := ds.tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	newName := schema.Name()
+	if _, exists := ds.tables[newName]; exists && newName != tableName {
+		return fmt.Errorf("table %s already exists", newName)
+	}
+
+	// The rows already there take the default of an added column as the
+	// column stores it
+	if change.Action == types.AlterAddColumn {
+		var err error
+		if change.Column, err = storage.CoerceDefault(change.Column); err != nil {
+			return err
+		}
+		if schema, err = withColumn(schema, change.Column); err != nil {
+			return err
+		}
+	}
+
+	all, err := ds.scanTable(tableInfo, nil, storage.AccessPath{}, nil)
+	if err != nil {
+		return err
+	}
+	rows := make([]storage.Row, len(all.originalRows))
+	for i, row := range all.originalRows {
+		rows[i] = storage.AlterRow(row, change)
+		if err := storage.CheckRow(schema, rows[i]); err != nil {
+			return err
+		}
+	}
+
+	// Constraint indexes come from the new schema, keeping the trees of
+	// those that were there before; the others follow their columns
+	var indexes, added []*diskIndex
+	for _, def := range catalog.KeyIndexes(schema) {
+		if def.Primary {
+			continue
+		}
+		index := &diskIndex{Def: def}
+		for _, old := range tableInfo.Indexes {
+			columns, ok := change.RenameColumns(old.Def.Columns)
+			if old.Def.Constraint && ok && slices.Equal(columns, def.Columns) {
+				index.Tree = old.Tree
+			}
+		}
+		if index.Tree == nil {
+			added = append(added, index)
+		}
+		indexes = append(indexes, index)
+	}
+	for _, old := range tableInfo.Indexes {
+		def, ok := change.RenameIndex(old.Def)
+		if old.Def.Constraint || !ok {
+			continue
+		}
+		def.Table = newName
+		indexes = append(indexes, &diskIndex{Def: def, Tree: old.Tree})
+	}
+
+	// A new UNIQUE column must not give rows the same default
+	for _, index := range added {
+		checker := storage.NewIndexUniqueChecker(newName, []catalog.Index{index.Def})
+		for _, row := range rows {
+			if err := checker.Add(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Change the rows, whose keys stay the same
+	if change.Action == types.AlterDropColumn || change.Action == types.AlterRenameColumn {
+		for i, row := range rows {
+			if err := tableInfo.freeBlobs(all.keys[i]); err != nil {
+				return err
+			}
+			rowData, err := serializeRow(row, tableInfo.IndexTree.pageManager)
+			if err != nil {
+				return err
+			}
+			if err := tableInfo.IndexTree.Insert(all.keys[i], rowData); err != nil {
+				return err
+			}
+		}
+	}
+	for _, index := range added {
+		index.Tree, err = CreateNewTree(tableInfo.IndexTree.pageManager)
+		if err != nil {
+			return err
+		}
+		for i, row := range rows {
+			if err := index.Tree.Insert(index.entryKey(row, all.keys[i]), all.keys[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if newName != tableName {
+		pageManager := tableInfo.IndexTree.pageManager
+		newFile := filepath.Join(ds.dbDir, newName+".db")
+		if err := pageManager.FlushAllPages(); err != nil {
+			return err
+		}
+		if err := os.Rename(pageManager.filename, newFile); err != nil {
+			return err
+		}
+		pageManager.filename = newFile
+	}
+
+	rowIDs := NewTableRowIDGenerator(schema)
+	rowIDs.AutoID = tableInfo.RowIDs.AutoID
+	tableInfo.Schema, tableInfo.RowIDs, tableInfo.Indexes = schema, rowIDs, indexes
+	delete(ds.tables, tableName)
+	ds.tables[newName] = tableInfo
+
+	return ds.saveCatalog()
+}
+
+// CreateIndex builds a secondary index over the rows already in a table
+func (ds *DiskStorage) CreateIndex(tableName string, def catalog.Index) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tableInfo, exists := ds.tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	if tableInfo.index(def.Name) != nil {
+		return fmt.Errorf("index %s already exists on table %s", def.Name, tableName)
+	}
+
+	all, err := ds.scanTable(tableInfo, nil, storage.AccessPath{}, nil)
+	if err != nil {
+		return err
+	}
+
+	// Existing rows must already satisfy a unique index
+	if def.Unique {
+		checker := storage.NewIndexUniqueChecker(tableName, []catalog.Index{def})
+		for _, row := range all.originalRows {
+			if err := checker.Add(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	tree, err := CreateNewTree(tableInfo.IndexTree.pageManager)
+	if err != nil {
+		return err
+	}
+	index := &diskIndex{Def: def, Tree: tree}
+	for i, row := range all.originalRows {
+		err = tree.Insert(index.entryKey(row, all.keys[i]), all.keys[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	tableInfo.Indexes = append(tableInfo.Indexes, index)
+	return ds.saveCatalog()
+}
+
+// DropIndex removes a secondary index from a table
+func (ds *DiskStorage) DropIndex(tableName string, indexName string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tableInfo, exists := ds.tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	for i, index := range tableInfo.Indexes {
+		if index.Def.Name == indexName {
+			if index.Def.Constraint {
+				return fmt.Errorf("index %s backs a constraint and cannot be dropped", indexName)
+			}
+			tableInfo.Indexes = append(tableInfo.Indexes[:i], tableInfo.Indexes[i+1:]...)
+			return ds.saveCatalog()
+		}
+	}
+
+	return fmt.Errorf("index %s does not exist on table %s", indexName, tableName)
+}
+
+// SetTableStats stores the statistics of a table in the catalog
+func (ds *DiskStorage) SetTableStats(tableName string, stats catalog.TableStats) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tableInfo, exists := ds.tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	schema, err := newDiskTableSchema(tableInfo.Schema)
+	if err != nil {
+		return err
+	}
+	stored, err := newDiskTableStats(stats)
+	if err != nil {
+		return err
+	}
+	updated := *schema
+	updated.TableStats = stored
+	tableInfo.Schema = &updated
+	return ds.saveCatalog()
+}
+
+// CreateSequence creates a sequence, which is kept in the catalog
+func (ds *DiskStorage) CreateSequence(seq storage.Sequence) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if _, exists := ds.sequences[seq.Name]; exists {
+		return fmt.Errorf("sequence %s already exists", seq.Name)
+	}
+	ds.sequences[seq.Name] = &seq
+	if err := ds.saveCatalog(); err != nil {
+		delete(ds.sequences, seq.Name)
+		return err
+	}
+	return nil
+}
+
+// DropSequence removes a sequence
+func (ds *DiskStorage) DropSequence(name string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if _, exists := ds.sequences[name]; !exists {
+		return fmt.Errorf("sequence %s does not exist", name)
+	}
+	delete(ds.sequences, name)
+	return ds.saveCatalog()
+}
+
+// NextValue advances a sequence and saves the catalog
+func (ds *DiskStorage) NextValue(name string) (int64, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	seq, exists := ds.sequences[name]
+	if !exists {
+		return 0, fmt.Errorf("sequence %s does not exist", name)
+	}
+	val, err := seq.Next()
+	if err != nil {
+		return 0, err
+	}
+	return val, ds.saveCatalog()
+}
+
+// AdvanceSequence moves a sequence up to a value that was used without it
+func (ds *DiskStorage) AdvanceSequence(name string, value int64) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	seq, exists := ds.sequences[name]
+	if !exists {
+		return fmt.Errorf("sequence %s does not exist", name)
+	}
+	if !seq.Advance(value) {
+		return nil
+	}
+	return ds.saveCatalog()
+}
+
+// scanTable reads the rows of a table through a path; the caller must hold ds.mu
+func (ds *DiskStorage) scanTable(tableInfo *TableInfo, columns []string, path storage.AccessPath, condition storage.FilterFunc) (*DiskRowIterator, error) {
 	// Create iterator
 	iter := &DiskRowIterator{
 		tableInfo:    tableInfo,
-		columns:      columns,
 		condition:    condition,
 		rows:         make([]storage.Row, 0),
 		originalRows: make([]storage.Row, 0),
 		currentIdx:   -1,
 	}
+	allColumns := len(columns) == 0
+	for _, col := range columns {
+		switch col {
+		case "*":
+			allColumns = true
+		case storage.RowIDColumn:
+			iter.withID = true
+		default:
+			iter.columns = append(iter.columns, col)
+		}
+	}
+	if allColumns {
+		iter.columns = nil
+	} else if iter.withID {
+		iter.columns = append(iter.columns, storage.RowIDColumn)
+	}
 
-	// Load all rows that match the condition
-	// This is inefficient, but simplifies the implementation
-	// In a real database, we would use the B+ tree to efficiently filter rows
-	err := iter.loadRows()
+	err := ds.visitPath(tableInfo, path, iter.addRow)
 	if err != nil {
 		return nil, err
 	}
@@ -541,101 +1174,130 @@ func (ds *DiskStorage) Select(tableName string, columns []string, condition stor
 	return iter, nil
 }
 
+// visitPath calls fn with the key and contents of every row reached through an access path
+func (ds *DiskStorage) visitPath(tableInfo *TableInfo, path storage.AccessPath, fn func(key []byte, row storage.Row) error) error {
+	visitRow := func(key, value []byte) error {
+		row, err := deserializeRow(value, tableInfo.Schema, tableInfo.IndexTree.pageManager)
+		if err != nil {
+			return err
+		}
+		return fn(key, row)
+	}
+
+	if path.IsFullScan() {
+		return tableInfo.IndexTree.Scan(nil, func(key, value []byte) (bool, error) {
+			return true, visitRow(key, value)
+		})
+	}
+
+	// Either the primary key, which IndexTree is keyed by, or a secondary index
+	var index *diskIndex
+	tree := tableInfo.IndexTree
+	if !isPrimaryKeyIndex(tableInfo.Schema, path.Index) {
+		index = tableInfo.index(path.Index)
+		if index == nil {
+			return fmt.Errorf("index %s does not exist on table %s", path.Index, tableInfo.Schema.Name())
+		}
+		tree = index.Tree
+	}
+
+	// Ranges may overlap, so remember which rows were already visited
+	seen := make(map[string]bool)
+	for _, keyRange := range path.Ranges {
+		bounds := keyRange.Bounds()
+		err := tree.Scan(bounds.Start(), func(key, value []byte) (bool, error) {
+			cmp := bounds.Compare(key)
+			if cmp > 0 {
+				return false, nil
+			}
+			if cmp < 0 {
+				return true, nil
+			}
+
+			// Index entries point at the row key
+			rowID := key
+			if index != nil {
+				rowID = value
+			}
+			if seen[string(rowID)] {
+				return true, nil
+			}
+			seen[string(rowID)] = true
+
+			if index != nil {
+				rowData, err := tableInfo.IndexTree.Get(rowID)
+				if err != nil {
+					return false, fmt.Errorf("index %s points at a missing row: %w", index.Def.Name, err)
+				}
+				value = rowData
+			}
+			return true, visitRow(rowID, value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isPrimaryKeyIndex reports whether an index name refers to the table's primary key
+func isPrimaryKeyIndex(schema catalog.TableSchema, indexName string) bool {
+	for _, constraint := range catalog.UniqueConstraints(schema) {
+		if constraint.PrimaryKey {
+			return indexName == constraint.Name
+		}
+	}
+	return false
+}
+
 // DiskRowIterator implements the storage.RowIterator interface for disk-based storage
 type DiskRowIterator struct {
 	tableInfo    *TableInfo
 	columns      []string
+	withID       bool
 	condition    storage.FilterFunc
 	rows         []storage.Row
 	originalRows []storage.Row
 	originalRow  storage.Row
+	keys         [][]byte
 	currentIdx   int
 	err          error
 }
 
-// loadRows loads all rows that match the condition
-func (iter *DiskRowIterator) loadRows() error {
-	// Find the leaf node containing the smallest key
-	leafNodeID, err := iter.tableInfo.IndexTree.findLeafNode(iter.tableInfo.IndexTree.rootPageID, []byte{0})
-	if err != nil {
-		return err
+// addRow keeps a row if it matches the condition
+func (iter *DiskRowIterator) addRow(key []byte, row storage.Row) error {
+	if iter.withID {
+		row[storage.RowIDColumn] = parser.NewBlobValue(key)
 	}
 
-	// Iterate through all leaf nodes
-	for leafNodeID != 0 {
-		// Get the leaf node
-		node, err := iter.tableInfo.IndexTree.pageManager.GetPage(leafNodeID)
+	// Apply condition if provided
+	if iter.condition != nil {
+		match, err := iter.condition(row)
 		if err != nil {
 			return err
 		}
-
-		// Read leaf node header
-		data := node.Data()
-		nodeType := data[0] // Node type is the first byte
-		if nodeType != NodeTypeLeaf {
-			return fmt.Errorf("expected leaf node, got %d", nodeType)
+		if !match {
+			return nil
 		}
+	}
 
-		numKeys := binary.LittleEndian.Uint32(data[1:5])
-		nextLeafID := PageID(binary.LittleEndian.Uint32(data[5:9]))
-
-		// Read all keys and values
-		keyValueOffset := int(NodeHeaderSize)
-		for i := uint32(0); i < numKeys; i++ {
-			// Read key length
-			keyLen := int(binary.LittleEndian.Uint32(data[keyValueOffset : keyValueOffset+4]))
-			keyValueOffset += 4
-
-			// Read key data (keeping but not using the key)
-			_ = data[keyValueOffset : keyValueOffset+keyLen]
-			keyValueOffset += keyLen
-
-			// Read value length
-			valueLen := int(binary.LittleEndian.Uint32(data[keyValueOffset : keyValueOffset+4]))
-			keyValueOffset += 4
-
-			// Read value data
-			value := data[keyValueOffset : keyValueOffset+valueLen]
-			keyValueOffset += valueLen
-
-			// Deserialize row
-			row, err := deserializeRow(value, iter.tableInfo.Schema)
-			if err != nil {
-				return err
-			}
-
-			// Apply condition if provided
-			if iter.condition != nil {
-				match, err := iter.condition(row)
-				if err != nil {
-					return err
-				}
-				if !match {
-					continue
-				}
-			}
-
-			// Project columns if specified
-			if iter.columns != nil && len(iter.columns) > 0 {
-				projectedRow := make(storage.Row)
-				for _, col := range iter.columns {
-					if val, ok := row[col]; ok {
-						projectedRow[col] = val
-					}
-				}
-				iter.rows = append(iter.rows, projectedRow)
-			} else {
-				iter.rows = append(iter.rows, row)
+	// Project columns if specified
+	if len(iter.columns) > 0 {
+		projectedRow := make(storage.Row)
+		for _, col := range iter.columns {
+			if val, ok := row[col]; ok {
+				projectedRow[col] = val
 			}
-
-			// Keep original row for updates/deletes
-			iter.originalRows = append(iter.originalRows, row)
 		}
-
-		// Move to next leaf node
-		leafNodeID = nextLeafID
+		iter.rows = append(iter.rows, projectedRow)
+	} else {
+		iter.rows = append(iter.rows, row)
 	}
 
+	// Keep original row and its key for updates/deletes
+	iter.originalRows = append(iter.originalRows, row)
+	iter.keys = append(iter.keys, key)
 	return nil
 }
 
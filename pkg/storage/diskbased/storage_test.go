@@ -1,10 +1,19 @@
 package diskbased
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"testing/iotest"
 
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
 	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
 	"github.com/zhangbiao2009/simple-sql-db/pkg/storage"
 	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
@@ -43,6 +52,17 @@ func (v *mockValue) AsNull() (bool, error) {
 	return v.dataType == types.TypeNull, nil
 }
 
+func (v *mockValue) AsDecimal() (parser.Decimal, error) {
+	if v.dataType == types.TypeFloat {
+		return parser.NewFloatValue(v.floatVal).AsDecimal()
+	}
+	return parser.NewDecimal(v.intVal, 0), nil
+}
+
+func (v *mockValue) AsBytes() ([]byte, error) {
+	return []byte(v.stringVal), nil
+}
+
 // Mock implementation of catalog.TableSchema for testing
 type mockTableSchema struct {
 	name    string
@@ -79,11 +99,27 @@ func (s *mockTableSchema) GetColumnType(name string) types.DataType {
 	return col.Type()
 }
 
+func (s *mockTableSchema) Constraints() []parser.TableConstraint {
+	return nil
+}
+
+func (s *mockTableSchema) Stats() (catalog.TableStats, bool) {
+	return catalog.TableStats{}, false
+}
+
+func (s *mockTableSchema) Version() int {
+	return 0
+}
+
 // Mock implementation of parser.ColumnDefinition for testing
 type mockColumnDefinition struct {
-	name        string
-	dataType    types.DataType
-	constraints []types.Constraint
+	name         string
+	dataType     types.DataType
+	typeParams   []int
+	typeName     string
+	collation    parser.Collation
+	constraints  []types.Constraint
+	defaultValue parser.Value
 }
 
 func (c *mockColumnDefinition) Name() string {
@@ -98,6 +134,28 @@ func (c *mockColumnDefinition) Constraints() []types.Constraint {
 	return c.constraints
 }
 
+func (c *mockColumnDefinition) TypeParams() []int {
+	return c.typeParams
+}
+
+func (c *mockColumnDefinition) TypeName() string {
+	if c.typeName != "" {
+		return c.typeName
+	}
+	return parser.TypeName(c.dataType, c.typeParams)
+}
+
+func (c *mockColumnDefinition) Collation() parser.Collation {
+	return c.collation
+}
+
+func (c *mockColumnDefinition) Default() parser.Expression {
+	if c.defaultValue == nil {
+		return nil
+	}
+	return parser.NewLiteralExpression(c.defaultValue)
+}
+
 func setupTestDB(t *testing.T) (string, *DiskStorage) {
 	// Create a temporary directory for the test database
 	tempDir, err := os.MkdirTemp("", "diskbasedtest-*")
@@ -206,9 +264,11 @@ func TestDiskStorage_BasicOperations(t *testing.T) {
 		t.Errorf("Insert() error = %v", err)
 	}
 
-	// Note: Primary key constraints would normally be tested here
-	// The B+ tree doesn't enforce primary key constraints at the storage level
-	// This would need to be handled at a higher level
+	// Inserting the same primary key again must fail
+	err = diskStorage.Insert("users", row)
+	if _, ok := err.(*storage.ConstraintError); !ok {
+		t.Errorf("Insert() with duplicate primary key error = %v, want *storage.ConstraintError", err)
+	}
 
 	// Test Select all rows
 	rows, err := diskStorage.Select("users", []string{"id", "name", "active"}, nil)
@@ -429,6 +489,59 @@ func TestDiskStorage_Persistence(t *testing.T) {
 	}
 }
 
+func TestDiskStorage_LargeCatalog(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	// Far more tables with constraints than fit in one catalog page
+	const numTables = 30
+	for i := 0; i < numTables; i++ {
+		columns := []parser.ColumnDefinition{
+			&mockColumnDefinition{
+				name:        "id",
+				dataType:    types.TypeInt,
+				constraints: []types.Constraint{types.ConstraintPrimaryKey},
+			},
+		}
+		for j := 0; j < 8; j++ {
+			columns = append(columns, &mockColumnDefinition{
+				name:        fmt.Sprintf("column_with_a_long_name_%d", j),
+				dataType:    types.TypeString,
+				constraints: []types.Constraint{types.ConstraintNotNull, types.ConstraintUnique},
+			})
+		}
+		tableName := fmt.Sprintf("table_%d", i)
+		if err := diskStorage.CreateTable(tableName, &mockTableSchema{name: tableName, columns: columns}); err != nil {
+			t.Fatalf("CreateTable(%s) error = %v", tableName, err)
+		}
+	}
+	if err := diskStorage.CreateSequence(storage.Sequence{Name: "ids", Start: 1, Increment: 1}); err != nil {
+		t.Fatalf("CreateSequence() error = %v", err)
+	}
+
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+
+	for i := 0; i < numTables; i++ {
+		tableName := fmt.Sprintf("table_%d", i)
+		rows, err := reopenedStorage.Select(tableName, []string{"*"}, nil)
+		if err != nil {
+			t.Errorf("Select(%s) after reopening error = %v", tableName, err)
+			continue
+		}
+		rows.Close()
+	}
+	if _, err := reopenedStorage.NextValue("ids"); err != nil {
+		t.Errorf("NextValue() after reopening error = %v", err)
+	}
+}
+
 func TestDiskStorage_CompositeKeys(t *testing.T) {
 	tempDir, diskStorage := setupTestDB(t)
 	defer cleanupTestDB(tempDir)
@@ -598,3 +711,1264 @@ func TestDiskStorage_LargeDataset(t *testing.T) {
 		}
 	}
 }
+
+func TestDiskStorage_UniqueConstraints(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{
+			name:        "id",
+			dataType:    types.TypeInt,
+			constraints: []types.Constraint{types.ConstraintPrimaryKey},
+		},
+		&mockColumnDefinition{
+			name:        "email",
+			dataType:    types.TypeString,
+			constraints: []types.Constraint{types.ConstraintUnique},
+		},
+	}
+	schema := &mockTableSchema{name: "accounts", columns: columns}
+
+	err := diskStorage.CreateTable("accounts", schema)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	newRow := func(id int64, email string) map[string]parser.Value {
+		return map[string]parser.Value{
+			"id":    &mockValue{dataType: types.TypeInt, intVal: id},
+			"email": &mockValue{dataType: types.TypeString, stringVal: email},
+		}
+	}
+
+	for i, email := range []string{"a@example.com", "b@example.com"} {
+		if err := diskStorage.Insert("accounts", newRow(int64(i+1), email)); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	// Duplicate primary key
+	err = diskStorage.Insert("accounts", newRow(1, "c@example.com"))
+	constraintErr, ok := err.(*storage.ConstraintError)
+	if !ok {
+		t.Fatalf("Insert() with duplicate primary key error = %v, want *storage.ConstraintError", err)
+	}
+	if constraintErr.Constraint != "accounts_pkey" {
+		t.Errorf("ConstraintError.Constraint = %s, want accounts_pkey", constraintErr.Constraint)
+	}
+
+	// Duplicate unique value
+	err = diskStorage.Insert("accounts", newRow(3, "b@example.com"))
+	constraintErr, ok = err.(*storage.ConstraintError)
+	if !ok {
+		t.Fatalf("Insert() with duplicate unique value error = %v, want *storage.ConstraintError", err)
+	}
+	if constraintErr.Constraint != "accounts_email_key" {
+		t.Errorf("ConstraintError.Constraint = %s, want accounts_email_key", constraintErr.Constraint)
+	}
+
+	// Changing a primary key onto an existing one is rejected
+	_, err = diskStorage.Update("accounts", map[string]parser.Value{
+		"id": &mockValue{dataType: types.TypeInt, intVal: 1},
+	}, func(row storage.Row) (bool, error) {
+		id, _ := row["id"].AsInt()
+		return id == 2, nil
+	})
+	if _, ok := err.(*storage.ConstraintError); !ok {
+		t.Errorf("Update() creating duplicate primary key error = %v, want *storage.ConstraintError", err)
+	}
+
+	// Changing a primary key to a free value moves the row
+	count, err := diskStorage.Update("accounts", map[string]parser.Value{
+		"id": &mockValue{dataType: types.TypeInt, intVal: 7},
+	}, func(row storage.Row) (bool, error) {
+		id, _ := row["id"].AsInt()
+		return id == 2, nil
+	})
+	if err != nil || count != 1 {
+		t.Errorf("Update() = %d, %v, want 1, nil", count, err)
+	}
+
+	rows, _ := diskStorage.Select("accounts", []string{"id", "email"}, nil)
+	ids := map[int64]string{}
+	for rows.Next() {
+		id, _ := rows.Row()["id"].AsInt()
+		ids[id], _ = rows.Row()["email"].AsString()
+	}
+	rows.Close()
+	if len(ids) != 2 || ids[1] != "a@example.com" || ids[7] != "b@example.com" {
+		t.Errorf("Rows after update = %v, want map[1:a@example.com 7:b@example.com]", ids)
+	}
+
+	// Rows given values of their own can trade primary keys
+	count, err = diskStorage.UpdatePath("accounts", func(row storage.Row) (map[string]parser.Value, error) {
+		id, _ := row["id"].AsInt()
+		return map[string]parser.Value{"id": &mockValue{dataType: types.TypeInt, intVal: 8 - id}}, nil
+	}, storage.AccessPath{}, func(storage.Row) (bool, error) { return true, nil })
+	if err != nil || count != 2 {
+		t.Errorf("UpdatePath() = %d, %v, want 2, nil", count, err)
+	}
+	rows, _ = diskStorage.Select("accounts", []string{"id", "email"}, nil)
+	ids = map[int64]string{}
+	for rows.Next() {
+		id, _ := rows.Row()["id"].AsInt()
+		ids[id], _ = rows.Row()["email"].AsString()
+	}
+	rows.Close()
+	if len(ids) != 2 || ids[1] != "b@example.com" || ids[7] != "a@example.com" {
+		t.Errorf("Rows after swapping keys = %v, want map[1:b@example.com 7:a@example.com]", ids)
+	}
+}
+
+func TestDiskStorage_DuplicateRowsWithoutPrimaryKey(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "event", dataType: types.TypeString},
+	}
+	schema := &mockTableSchema{name: "events", columns: columns}
+
+	err := diskStorage.CreateTable("events", schema)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// Identical rows are separate rows when there is no primary key
+	for i := 0; i < 3; i++ {
+		err = diskStorage.Insert("events", map[string]parser.Value{
+			"event": &mockValue{dataType: types.TypeString, stringVal: "click"},
+		})
+		if err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	err = diskStorage.Close()
+	if err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+
+	// Row IDs keep counting after a restart instead of overwriting old rows
+	err = reopenedStorage.Insert("events", map[string]parser.Value{
+		"event": &mockValue{dataType: types.TypeString, stringVal: "click"},
+	})
+	if err != nil {
+		t.Fatalf("Insert() after reopening error = %v", err)
+	}
+
+	rows, err := reopenedStorage.Select("events", []string{"event"}, nil)
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	rows.Close()
+
+	if count != 4 {
+		t.Errorf("Got %d rows, want 4", count)
+	}
+
+	// Each row has its own ID, by which one of the identical rows can be
+	// changed, and the ID is not stored with the row
+	rows, err = reopenedStorage.Select("events", []string{"*", storage.RowIDColumn}, nil)
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	ids := make(map[string]bool)
+	var first parser.Value
+	for rows.Next() {
+		id := rows.Row()[storage.RowIDColumn]
+		if id == nil {
+			t.Fatalf("Select() row %v has no ID", rows.Row())
+		}
+		ids[parser.HashKey([]parser.Value{id})] = true
+		if first == nil {
+			first = id
+		}
+	}
+	rows.Close()
+	if len(ids) != 4 {
+		t.Errorf("Got %d row IDs, want 4", len(ids))
+	}
+
+	updated, err := reopenedStorage.UpdatePath("events", storage.SetValues(map[string]parser.Value{
+		"event": &mockValue{dataType: types.TypeString, stringVal: "scroll"},
+	}), storage.AccessPath{}, func(row storage.Row) (bool, error) {
+		return parser.HashKey([]parser.Value{row[storage.RowIDColumn]}) == parser.HashKey([]parser.Value{first}), nil
+	})
+	if err != nil || updated != 1 {
+		t.Fatalf("UpdatePath() by row ID = %d, %v, want 1 row", updated, err)
+	}
+	rows, err = reopenedStorage.Select("events", []string{"*"}, nil)
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	scrolls := 0
+	for rows.Next() {
+		if _, ok := rows.Row()[storage.RowIDColumn]; ok || len(rows.Row()) != 1 {
+			t.Errorf("Select() row = %v, want only the event", rows.Row())
+		}
+		if event, _ := rows.Row()["event"].AsString(); event == "scroll" {
+			scrolls++
+		}
+	}
+	rows.Close()
+	if scrolls != 1 {
+		t.Errorf("Got %d updated rows, want 1", scrolls)
+	}
+}
+
+func TestDiskStorage_TypeChecks(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+		&mockColumnDefinition{name: "price", dataType: types.TypeFloat, constraints: []types.Constraint{types.ConstraintNotNull}},
+	}
+	if err := diskStorage.CreateTable("prices", &mockTableSchema{name: "prices", columns: columns}); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// An INT is stored in a FLOAT column as a FLOAT
+	err := diskStorage.Insert("prices", map[string]parser.Value{
+		"id":    &mockValue{dataType: types.TypeInt, intVal: 1},
+		"price": &mockValue{dataType: types.TypeInt, intVal: 5},
+	})
+	if err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	rows, err := diskStorage.Select("prices", []string{"*"}, nil)
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if !rows.Next() || rows.Row()["price"].Type() != types.TypeFloat {
+		t.Errorf("stored price is not a FLOAT")
+	}
+	rows.Close()
+
+	invalid := []map[string]parser.Value{
+		{"id": &mockValue{dataType: types.TypeString, stringVal: "2"}, "price": &mockValue{dataType: types.TypeFloat, floatVal: 1}},
+		{"id": &mockValue{dataType: types.TypeInt, intVal: 3}},
+	}
+	for _, values := range invalid {
+		if err := diskStorage.Insert("prices", values); err == nil {
+			t.Errorf("Insert(%v) error = nil, want error", values)
+		}
+	}
+	_, err = diskStorage.Update("prices", map[string]parser.Value{"id": &mockValue{dataType: types.TypeFloat, floatVal: 1.5}}, nil)
+	if err == nil {
+		t.Errorf("Update() with a lossy value error = nil")
+	}
+}
+
+func TestDiskStorage_TemporalValues(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+		&mockColumnDefinition{name: "at", dataType: types.TypeTimestamp},
+		&mockColumnDefinition{name: "span", dataType: types.TypeInterval},
+	}
+	if err := diskStorage.CreateTable("events", &mockTableSchema{name: "events", columns: columns}); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	err := diskStorage.CreateIndex("events", catalog.Index{Name: "events_at", Table: "events", Columns: []string{"at"}})
+	if err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+
+	timestamp := func(s string) parser.Value {
+		val, err := parser.Cast(parser.NewStringValue(s), types.TypeTimestamp)
+		if err != nil {
+			t.Fatalf("Cast(%q) error = %v", s, err)
+		}
+		return val
+	}
+	span := parser.NewIntervalValue(parser.Interval{Months: 1, Days: 2, Micros: 3}).(*parser.IntervalValue)
+
+	// Text is stored as a TIMESTAMP, and times before 1970 sort first
+	rows := []map[string]parser.Value{
+		{"id": parser.NewIntValue(1), "at": timestamp("2026-10-16 09:00"), "span": span},
+		{"id": parser.NewIntValue(2), "at": parser.NewStringValue("1969-07-20 20:17")},
+		{"id": parser.NewIntValue(3), "at": timestamp("2026-10-17 10:00")},
+		{"id": parser.NewIntValue(4), "at": timestamp("2026-10-18 00:00")},
+	}
+	for _, row := range rows {
+		if err := diskStorage.Insert("events", row); err != nil {
+			t.Fatalf("Insert(%v) error = %v", row, err)
+		}
+	}
+	if err := diskStorage.Insert("events", map[string]parser.Value{"id": parser.NewIntValue(5), "at": parser.NewStringValue("soon")}); err == nil {
+		t.Errorf("Insert() of text that is no TIMESTAMP error = nil")
+	}
+
+	until := storage.AccessPath{
+		Index: "events_at",
+		Ranges: []storage.KeyRange{{
+			Low: []parser.Value{timestamp("1900-01-01")}, LowInclusive: true,
+			High: []parser.Value{timestamp("2026-10-18")}, HighInclusive: false,
+		}},
+	}
+	check := func(s *DiskStorage) {
+		iter, err := s.SelectPath("events", []string{"*"}, until, nil)
+		if err != nil {
+			t.Fatalf("SelectPath() error = %v", err)
+		}
+		defer iter.Close()
+
+		var ids []int64
+		for iter.Next() {
+			row := iter.Row()
+			id, _ := row["id"].AsInt()
+			ids = append(ids, id)
+			if id == 2 && row["at"].Type() != types.TypeTimestamp {
+				t.Errorf("text stored in a TIMESTAMP column as %v", row["at"].Type())
+			}
+			if got, ok := row["span"].(*parser.IntervalValue); id == 1 && (!ok || got.Interval() != span.Interval()) {
+				t.Errorf("span = %v, want %v", row["span"], span)
+			}
+		}
+		if !equalIDs(ids, []int64{2, 1, 3}) {
+			t.Errorf("time range = %v, want [2 1 3]", ids)
+		}
+	}
+	check(diskStorage)
+
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+	check(reopenedStorage)
+}
+
+func TestDiskStorage_DecimalValues(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+		&mockColumnDefinition{name: "amount", dataType: types.TypeDecimal, typeParams: []int{8, 2}},
+	}
+	if err := diskStorage.CreateTable("payments", &mockTableSchema{name: "payments", columns: columns}); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	err := diskStorage.CreateIndex("payments", catalog.Index{Name: "payments_amount", Table: "payments", Columns: []string{"amount"}})
+	if err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+
+	decimal := func(s string) parser.Value {
+		d, err := parser.ParseDecimal(s)
+		if err != nil {
+			t.Fatalf("ParseDecimal(%q) error = %v", s, err)
+		}
+		return parser.NewDecimalValue(d)
+	}
+
+	// Values are stored at the scale of the column, and negatives sort first
+	rows := []map[string]parser.Value{
+		{"id": parser.NewIntValue(1), "amount": decimal("19.9")},
+		{"id": parser.NewIntValue(2), "amount": decimal("-0.05")},
+		{"id": parser.NewIntValue(3), "amount": parser.NewIntValue(100)},
+		{"id": parser.NewIntValue(4), "amount": parser.NewStringValue("1000.10")},
+	}
+	for _, row := range rows {
+		if err := diskStorage.Insert("payments", row); err != nil {
+			t.Fatalf("Insert(%v) error = %v", row, err)
+		}
+	}
+	for _, amount := range []parser.Value{decimal("0.001"), decimal("1000000")} {
+		if err := diskStorage.Insert("payments", map[string]parser.Value{"id": parser.NewIntValue(5), "amount": amount}); err == nil {
+			t.Errorf("Insert() of %v into DECIMAL(8, 2) error = nil", amount)
+		}
+	}
+
+	upTo := storage.AccessPath{
+		Index: "payments_amount",
+		Ranges: []storage.KeyRange{{
+			Low: []parser.Value{decimal("-1")}, LowInclusive: true,
+			High: []parser.Value{decimal("100.00")}, HighInclusive: true,
+		}},
+	}
+	check := func(s *DiskStorage) {
+		iter, err := s.SelectPath("payments", []string{"*"}, upTo, nil)
+		if err != nil {
+			t.Fatalf("SelectPath() error = %v", err)
+		}
+		defer iter.Close()
+
+		var ids []int64
+		for iter.Next() {
+			row := iter.Row()
+			id, _ := row["id"].AsInt()
+			ids = append(ids, id)
+			if id == 1 && fmt.Sprint(row["amount"]) != "DECIMAL '19.90'" {
+				t.Errorf("amount = %v, want DECIMAL '19.90'", row["amount"])
+			}
+		}
+		if !equalIDs(ids, []int64{2, 1, 3}) {
+			t.Errorf("amount range = %v, want [2 1 3]", ids)
+		}
+	}
+	check(diskStorage)
+
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+	check(reopenedStorage)
+}
+
+func TestDiskStorage_BlobValues(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+		&mockColumnDefinition{name: "data", dataType: types.TypeBlob},
+	}
+	if err := diskStorage.CreateTable("files", &mockTableSchema{name: "files", columns: columns}); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// A large BLOB spans several overflow pages, a small one stays in its row;
+	// both keep bytes that aren't valid text
+	large := bytes.Repeat([]byte{0, 0xff, '"', 0x80}, 3*PageSize)
+	small := []byte{0xde, 0xad, 0, 0xbe, 0xef}
+	for i, data := range [][]byte{large, small} {
+		row := map[string]parser.Value{"id": parser.NewIntValue(int64(i + 1)), "data": parser.NewBlobValue(data)}
+		if err := diskStorage.Insert("files", row); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	check := func(s *DiskStorage, want map[int64][]byte) {
+		iter, err := s.Select("files", []string{"*"}, nil)
+		if err != nil {
+			t.Fatalf("Select() error = %v", err)
+		}
+		defer iter.Close()
+		for iter.Next() {
+			id, _ := iter.Row()["id"].AsInt()
+			got, err := iter.Row()["data"].AsBytes()
+			if err != nil || !bytes.Equal(got, want[id]) {
+				t.Errorf("row %d has %d bytes, %v, want %d", id, len(got), err, len(want[id]))
+			}
+		}
+	}
+	check(diskStorage, map[int64][]byte{1: large, 2: small})
+
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+	check(reopenedStorage, map[int64][]byte{1: large, 2: small})
+
+	// A BLOB is read and written in pieces
+	for id, want := range map[int64][]byte{1: large, 2: small} {
+		r, err := reopenedStorage.OpenBlob("files", "data", []parser.Value{parser.NewIntValue(id)})
+		if err != nil {
+			t.Fatalf("OpenBlob() error = %v", err)
+		}
+		got, err := io.ReadAll(iotest.OneByteReader(r))
+		if err != nil || r.Size() != int64(len(want)) || !bytes.Equal(got, want) {
+			t.Errorf("OpenBlob(%d) read %d bytes, size %d, error %v, want %d bytes", id, len(got), r.Size(), err, len(want))
+		}
+		r.Close()
+	}
+	streamed := bytes.Repeat([]byte("0123456789"), PageSize)
+	n, err := reopenedStorage.WriteBlob("files", "data", []parser.Value{parser.NewIntValue(2)}, iotest.HalfReader(bytes.NewReader(streamed)))
+	if err != nil || n != int64(len(streamed)) {
+		t.Fatalf("WriteBlob() = %d, %v, want %d", n, err, len(streamed))
+	}
+	if _, err := reopenedStorage.WriteBlob("files", "data", []parser.Value{parser.NewIntValue(3)}, bytes.NewReader(small)); err == nil {
+		t.Errorf("WriteBlob() of a missing row error = nil")
+	}
+	check(reopenedStorage, map[int64][]byte{1: large, 2: streamed})
+
+	// A BLOB is streamed into another row, while the row it is read from is
+	// changed too
+	key := func(id int64) []parser.Value { return []parser.Value{parser.NewIntValue(id)} }
+	r, err := reopenedStorage.OpenBlob("files", "data", key(1))
+	if err != nil {
+		t.Fatalf("OpenBlob() error = %v", err)
+	}
+	if _, err := reopenedStorage.WriteBlob("files", "data", key(1), bytes.NewReader(small)); err != nil {
+		t.Fatalf("WriteBlob() error = %v", err)
+	}
+	if n, err := reopenedStorage.WriteBlob("files", "data", key(2), iotest.HalfReader(r)); err != nil || n != int64(len(large)) {
+		t.Fatalf("WriteBlob() from OpenBlob() = %d, %v, want %d", n, err, len(large))
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	check(reopenedStorage, map[int64][]byte{1: small, 2: large})
+
+	// The pages of BLOBs that are replaced or deleted are reused
+	pm := reopenedStorage.tables["files"].IndexTree.pageManager
+	numPages := pm.numPages
+	if _, err := reopenedStorage.Delete("files", nil); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	row := map[string]parser.Value{"id": parser.NewIntValue(1), "data": parser.NewBlobValue(streamed)}
+	if err := reopenedStorage.Insert("files", row); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if _, err := reopenedStorage.WriteBlob("files", "data", []parser.Value{parser.NewIntValue(1)}, bytes.NewReader(large)); err != nil {
+		t.Fatalf("WriteBlob() error = %v", err)
+	}
+	if pm.numPages != numPages {
+		t.Errorf("file grew from %d to %d pages", numPages, pm.numPages)
+	}
+	check(reopenedStorage, map[int64][]byte{1: large})
+}
+
+func TestDiskStorage_JSONValues(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+		&mockColumnDefinition{name: "doc", dataType: types.TypeJSON},
+	}
+	if err := diskStorage.CreateTable("docs", &mockTableSchema{name: "docs", columns: columns}); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	docs := []string{`{"status": "active", "n": 1}`, `{"status":"closed"}`, `{"status":"active","tags":[1,2]}`, `[1]`}
+	for i, text := range docs {
+		doc, err := parser.ParseJSON(text)
+		if err != nil {
+			t.Fatalf("ParseJSON(%s) error = %v", text, err)
+		}
+		if err := diskStorage.Insert("docs", map[string]parser.Value{"id": parser.NewIntValue(int64(i + 1)), "doc": doc}); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	status, err := parser.ParseExpression("doc ->> 'status'")
+	if err != nil {
+		t.Fatalf("ParseExpression() error = %v", err)
+	}
+	index := catalog.Index{Name: "docs_status", Table: "docs", Columns: []string{"doc ->> 'status'"}, Expressions: []parser.Expression{status}}
+	if err := diskStorage.CreateIndex("docs", index); err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+
+	active := storage.AccessPath{
+		Index:  "docs_status",
+		Ranges: []storage.KeyRange{storage.PointRange([]parser.Value{parser.NewStringValue("active")})},
+	}
+	check := func(s *DiskStorage) {
+		iter, err := s.SelectPath("docs", []string{"*"}, active, nil)
+		if err != nil {
+			t.Fatalf("SelectPath() error = %v", err)
+		}
+		defer iter.Close()
+		var got []string
+		for iter.Next() {
+			got = append(got, fmt.Sprint(iter.Row()["id"], " ", iter.Row()["doc"]))
+		}
+		want := []string{`1 JSON '{"n":1,"status":"active"}'`, `3 JSON '{"status":"active","tags":[1,2]}'`}
+		if !slices.Equal(got, want) {
+			t.Errorf("rows through the expression index = %q, want %q", got, want)
+		}
+	}
+	check(diskStorage)
+
+	// The expression of the index is stored with it
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+	check(reopenedStorage)
+}
+
+func TestDiskStorage_Collations(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+		&mockColumnDefinition{name: "tag", dataType: types.TypeString, typeParams: []int{5}, collation: parser.CollateNoCase},
+		&mockColumnDefinition{name: "code", dataType: types.TypeString, typeParams: []int{2}, typeName: "CHAR(2)"},
+	}
+	if err := diskStorage.CreateTable("tags", &mockTableSchema{name: "tags", columns: columns}); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i, tag := range []string{"Red", "blue", "RED"} {
+		if err := diskStorage.Insert("tags", map[string]parser.Value{"id": parser.NewIntValue(int64(i + 1)), "tag": parser.NewStringValue(tag)}); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	if err := diskStorage.Insert("tags", map[string]parser.Value{"id": parser.NewIntValue(4), "tag": parser.NewStringValue("purple")}); err == nil {
+		t.Errorf("Insert() of text longer than VARCHAR(5) succeeded")
+	}
+	index := catalog.Index{Name: "tags_tag", Table: "tags", Columns: []string{"tag"}}
+	if err := diskStorage.CreateIndex("tags", index); err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+
+	// A lookup in any case finds the rows through the folded index keys
+	red := storage.AccessPath{
+		Index:  "tags_tag",
+		Ranges: []storage.KeyRange{storage.PointRange([]parser.Value{parser.Collate(parser.NewStringValue("red"), parser.CollateNoCase)})},
+	}
+	check := func(s *DiskStorage) {
+		col, _ := s.tables["tags"].Schema.GetColumn("tag")
+		if col.Collation() != parser.CollateNoCase || !slices.Equal(col.TypeParams(), []int{5}) {
+			t.Errorf("column tag = %v %v, want NOCASE [5]", col.Collation(), col.TypeParams())
+		}
+		if code, _ := s.tables["tags"].Schema.GetColumn("code"); col.TypeName() != "VARCHAR(5)" || code.TypeName() != "CHAR(2)" {
+			t.Errorf("types of tag and code = %s, %s, want VARCHAR(5), CHAR(2)", col.TypeName(), code.TypeName())
+		}
+
+		iter, err := s.SelectPath("tags", []string{"*"}, red, nil)
+		if err != nil {
+			t.Fatalf("SelectPath() error = %v", err)
+		}
+		defer iter.Close()
+		var got []string
+		for iter.Next() {
+			tag := iter.Row()["tag"]
+			if !parser.Equal(tag, parser.NewStringValue("red")) {
+				t.Errorf("tag %v read back does not compare under NOCASE", tag)
+			}
+			got = append(got, fmt.Sprint(iter.Row()["id"], " ", tag))
+		}
+		if want := []string{"1 'Red'", "3 'RED'"}; !slices.Equal(got, want) {
+			t.Errorf("rows through the index = %q, want %q", got, want)
+		}
+	}
+	check(diskStorage)
+
+	// The collation, length and type name are stored with the schema
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+	check(reopenedStorage)
+}
+
+func TestDiskStorage_Indexes(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{
+			name:        "id",
+			dataType:    types.TypeInt,
+			constraints: []types.Constraint{types.ConstraintPrimaryKey},
+		},
+		&mockColumnDefinition{name: "city", dataType: types.TypeString},
+		&mockColumnDefinition{name: "age", dataType: types.TypeInt},
+	}
+	schema := &mockTableSchema{name: "users", columns: columns}
+
+	err := diskStorage.CreateTable("users", schema)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// Insert out of order, including negative keys, to exercise key ordering
+	ids := []int64{40, -5, 12, 300, 7, 0, 25}
+	cities := []string{"Oslo", "Bergen", "Oslo", "Tromso", "Bergen", "Oslo", "Tromso"}
+	for i, id := range ids {
+		err = diskStorage.Insert("users", map[string]parser.Value{
+			"id":   &mockValue{dataType: types.TypeInt, intVal: id},
+			"city": &mockValue{dataType: types.TypeString, stringVal: cities[i]},
+			"age":  &mockValue{dataType: types.TypeInt, intVal: int64(20 + i)},
+		})
+		if err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	err = diskStorage.CreateIndex("users", catalog.Index{Name: "users_city_age", Table: "users", Columns: []string{"city", "age"}})
+	if err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+
+	intKey := func(i int64) parser.Value {
+		return &mockValue{dataType: types.TypeInt, intVal: i}
+	}
+	strKey := func(s string) parser.Value {
+		return &mockValue{dataType: types.TypeString, stringVal: s}
+	}
+
+	collectIDs := func(s *DiskStorage, path storage.AccessPath) []int64 {
+		iter, err := s.SelectPath("users", []string{"id"}, path, nil)
+		if err != nil {
+			t.Fatalf("SelectPath() error = %v", err)
+		}
+		defer iter.Close()
+
+		var result []int64
+		for iter.Next() {
+			id, _ := iter.Row()["id"].AsInt()
+			result = append(result, id)
+		}
+		return result
+	}
+
+	pkRange := storage.AccessPath{
+		Index: "users_pkey",
+		Ranges: []storage.KeyRange{{
+			Low: []parser.Value{intKey(-5)}, LowInclusive: true,
+			High: []parser.Value{intKey(25)}, HighInclusive: false,
+		}},
+	}
+	osloOlder := storage.AccessPath{
+		Index: "users_city_age",
+		Ranges: []storage.KeyRange{{
+			Low: []parser.Value{strKey("Oslo"), intKey(21)}, LowInclusive: false,
+			High: []parser.Value{strKey("Oslo")}, HighInclusive: true,
+		}},
+	}
+
+	checkPaths := func(s *DiskStorage) {
+		if got, want := collectIDs(s, pkRange), []int64{-5, 0, 7, 12}; !equalIDs(got, want) {
+			t.Errorf("primary key range = %v, want %v", got, want)
+		}
+		if got, want := collectIDs(s, osloOlder), []int64{12, 0}; !equalIDs(got, want) {
+			t.Errorf("secondary index range = %v, want %v", got, want)
+		}
+	}
+	checkPaths(diskStorage)
+
+	// Deleting through the index removes both the rows and their entries
+	deleted, err := diskStorage.DeletePath("users", osloOlder, func(row storage.Row) (bool, error) {
+		id, _ := row["id"].AsInt()
+		return id == 0, nil
+	})
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeletePath() = %d, %v, want 1 row", deleted, err)
+	}
+	if got := collectIDs(diskStorage, osloOlder); !equalIDs(got, []int64{12}) {
+		t.Errorf("secondary index after delete = %v, want [12]", got)
+	}
+
+	err = diskStorage.Insert("users", map[string]parser.Value{
+		"id":   intKey(0),
+		"city": strKey("Oslo"),
+		"age":  intKey(25),
+	})
+	if err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	// Indexes survive a restart
+	err = diskStorage.Close()
+	if err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+	checkPaths(reopenedStorage)
+
+	if err := reopenedStorage.DropIndex("users", "users_city_age"); err != nil {
+		t.Fatalf("DropIndex() error = %v", err)
+	}
+	if _, err := reopenedStorage.SelectPath("users", nil, osloOlder, nil); err == nil {
+		t.Errorf("SelectPath() through dropped index error = nil, want error")
+	}
+}
+
+func TestDiskStorage_AlterTable(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	// The catalog works out the schema of each version of the table
+	cat := catalog.NewCatalog()
+	err := cat.CreateTable("items", []parser.ColumnDefinition{
+		&mockColumnDefinition{
+			name:        "id",
+			dataType:    types.TypeInt,
+			constraints: []types.Constraint{types.ConstraintPrimaryKey},
+		},
+		&mockColumnDefinition{
+			name:        "name",
+			dataType:    types.TypeString,
+			constraints: []types.Constraint{types.ConstraintUnique},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	schema, _ := cat.GetTable("items")
+	if err := diskStorage.CreateTable("items", schema); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	for i, name := range []string{"bolt", "nut"} {
+		err = diskStorage.Insert("items", map[string]parser.Value{
+			"id":   &mockValue{dataType: types.TypeInt, intVal: int64(i + 1)},
+			"name": &mockValue{dataType: types.TypeString, stringVal: name},
+		})
+		if err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	index := catalog.Index{Name: "items_by_name", Table: "items", Columns: []string{"name", "id"}}
+	if err := diskStorage.CreateIndex("items", index); err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+
+	alter := func(s *DiskStorage, table string, change catalog.SchemaChange) {
+		t.Helper()
+		if err := cat.AlterTable(table, change); err != nil {
+			t.Fatalf("catalog AlterTable() error = %v", err)
+		}
+		newName := table
+		if change.Action == types.AlterRenameTable {
+			newName = change.NewName
+		}
+		schema, _ := cat.GetTable(newName)
+		if err := s.AlterTable(table, schema, change); err != nil {
+			t.Fatalf("AlterTable() error = %v", err)
+		}
+	}
+	rows := func(s *DiskStorage, table string, path storage.AccessPath) []string {
+		t.Helper()
+		iter, err := s.SelectPath(table, []string{"*"}, path, nil)
+		if err != nil {
+			t.Fatalf("SelectPath() error = %v", err)
+		}
+		defer iter.Close()
+		var result []string
+		for iter.Next() {
+			var cols []string
+			for col, val := range iter.Row() {
+				cols = append(cols, fmt.Sprintf("%s=%v", col, val))
+			}
+			sort.Strings(cols)
+			result = append(result, strings.Join(cols, " "))
+		}
+		return result
+	}
+
+	alter(diskStorage, "items", catalog.SchemaChange{
+		Action: types.AlterAddColumn,
+		Column: &mockColumnDefinition{
+			name:         "qty",
+			dataType:     types.TypeInt,
+			defaultValue: parser.NewIntValue(5),
+		},
+	})
+	// A default is stored as its column's type, and one that does not fit
+	// is rejected
+	tooLong := &mockColumnDefinition{name: "code", dataType: types.TypeString, typeParams: []int{2}, defaultValue: parser.NewStringValue("abcdef")}
+	schema, _ = cat.GetTable("items")
+	if err := diskStorage.AlterTable("items", schema, catalog.SchemaChange{Action: types.AlterAddColumn, Column: tooLong}); err == nil {
+		t.Errorf("AlterTable() of a default too long for VARCHAR(2) error = nil")
+	}
+	alter(diskStorage, "items", catalog.SchemaChange{
+		Action: types.AlterAddColumn,
+		Column: &mockColumnDefinition{
+			name:         "price",
+			dataType:     types.TypeDecimal,
+			typeParams:   []int{5, 2},
+			defaultValue: parser.NewFloatValue(1.5),
+		},
+	})
+	got := rows(diskStorage, "items", storage.AccessPath{})
+	if want := []string{"id=1 name='bolt' price=DECIMAL '1.50' qty=5", "id=2 name='nut' price=DECIMAL '1.50' qty=5"}; !slices.Equal(got, want) {
+		t.Errorf("rows after ADD COLUMN = %v, want %v", got, want)
+	}
+
+	alter(diskStorage, "items", catalog.SchemaChange{Action: types.AlterRenameColumn, ColumnName: "name", NewName: "label"})
+	alter(diskStorage, "items", catalog.SchemaChange{Action: types.AlterDropColumn, ColumnName: "qty"})
+	alter(diskStorage, "items", catalog.SchemaChange{Action: types.AlterRenameTable, NewName: "parts"})
+
+	if _, err := os.Stat(filepath.Join(tempDir, "parts.db")); err != nil {
+		t.Errorf("renamed table file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "items.db")); !os.IsNotExist(err) {
+		t.Errorf("old table file still exists")
+	}
+
+	// The changes survive a restart, and the indexes follow the columns
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+
+	byLabel := storage.AccessPath{
+		Index:  "items_by_name",
+		Ranges: []storage.KeyRange{storage.PointRange([]parser.Value{&mockValue{dataType: types.TypeString, stringVal: "nut"}})},
+	}
+	got = rows(reopenedStorage, "parts", byLabel)
+	if want := []string{"id=2 label='nut' price=DECIMAL '1.50'"}; !slices.Equal(got, want) {
+		t.Errorf("rows through renamed index = %v, want %v", got, want)
+	}
+	if stored := reopenedStorage.tables["parts"].Schema; stored.Version() != 5 || !stored.HasColumn("label") {
+		t.Errorf("stored schema = version %d %v, want version 5 with label", stored.Version(), stored.Columns())
+	}
+
+	err = reopenedStorage.Insert("parts", map[string]parser.Value{
+		"id":    &mockValue{dataType: types.TypeInt, intVal: 3},
+		"label": &mockValue{dataType: types.TypeString, stringVal: "bolt"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "parts_label_key") {
+		t.Errorf("Insert() of duplicate label error = %v, want parts_label_key violation", err)
+	}
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDiskStorage_PagesRead(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+	defer diskStorage.Close()
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{
+			name:        "id",
+			dataType:    types.TypeInt,
+			constraints: []types.Constraint{types.ConstraintPrimaryKey},
+		},
+	}
+	if err := diskStorage.CreateTable("items", &mockTableSchema{name: "items", columns: columns}); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := int64(0); i < 50; i++ {
+		err := diskStorage.Insert("items", map[string]parser.Value{"id": &mockValue{dataType: types.TypeInt, intVal: i}})
+		if err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	var counter storage.PageCounter = diskStorage
+	before := counter.PagesRead()
+	iter, err := diskStorage.Select("items", []string{"*"}, func(row storage.Row) (bool, error) { return true, nil })
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	iter.Close()
+
+	if counter.PagesRead() <= before {
+		t.Errorf("PagesRead() did not grow after a full scan")
+	}
+}
+
+// analyzedSchema is a schema with statistics, as the catalog has it after
+// ANALYZE
+type analyzedSchema struct {
+	*mockTableSchema
+	stats catalog.TableStats
+}
+
+func (s *analyzedSchema) Stats() (catalog.TableStats, bool) {
+	return s.stats, true
+}
+
+func TestDiskStorage_StatsStored(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+		&mockColumnDefinition{name: "city", dataType: types.TypeString},
+	}
+	schema := &analyzedSchema{
+		mockTableSchema: &mockTableSchema{name: "users", columns: columns},
+		stats:           catalog.TableStats{RowCount: 1000, Columns: map[string]catalog.ColumnStats{"id": {DistinctCount: 1000}}},
+	}
+	if err := diskStorage.CreateTable("users", schema); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// ANALYZE replaces the statistics the table was created with
+	stats := catalog.TableStats{
+		RowCount: 3,
+		Columns: map[string]catalog.ColumnStats{
+			"id": {
+				DistinctCount: 3,
+				Histogram: []parser.Value{
+					&mockValue{dataType: types.TypeInt, intVal: 1},
+					&mockValue{dataType: types.TypeInt, intVal: 3},
+				},
+			},
+			"city": {DistinctCount: 1, NullFraction: 0.5},
+		},
+	}
+	if err := diskStorage.SetTableStats("users", stats); err != nil {
+		t.Fatalf("SetTableStats() error = %v", err)
+	}
+
+	// The statistics are kept in the catalog file
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+	got, ok := reopenedStorage.tables["users"].Schema.Stats()
+	if !ok {
+		t.Fatalf("reopened schema has no statistics")
+	}
+	if got.RowCount != 3 || got.Columns["id"].DistinctCount != 3 || got.Columns["city"].NullFraction != 0.5 {
+		t.Errorf("reopened statistics = %+v, want %+v", got, stats)
+	}
+	var bounds []int64
+	for _, bound := range got.Columns["id"].Histogram {
+		i, _ := bound.AsInt()
+		bounds = append(bounds, i)
+	}
+	if !slices.Equal(bounds, []int64{1, 3}) {
+		t.Errorf("reopened histogram of id = %v, want [1 3]", bounds)
+	}
+}
+
+func TestDiskStorage_Sequences(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	// The default of an AUTOINCREMENT column is kept as its text
+	stmt, err := parser.NewParser().Parse("CREATE TABLE items (id INTEGER PRIMARY KEY AUTOINCREMENT, qty INT DEFAULT 1 + 2)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	cat := catalog.NewCatalog()
+	if err := cat.CreateTable("items", stmt.(parser.CreateTableStatement).Columns()); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	schema, _ := cat.GetTable("items")
+	if err := diskStorage.CreateTable("items", schema); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	for _, seq := range []storage.Sequence{
+		{Name: "items_id_seq", Start: 1, Increment: 1},
+		{Name: "countdown", Start: 10, Increment: -5},
+		{Name: "dropped", Start: 1, Increment: 1},
+	} {
+		if err := diskStorage.CreateSequence(seq); err != nil {
+			t.Fatalf("CreateSequence(%s) error = %v", seq.Name, err)
+		}
+	}
+	if err := diskStorage.CreateSequence(storage.Sequence{Name: "countdown", Start: 1, Increment: 1}); err == nil {
+		t.Errorf("CreateSequence() of an existing sequence error = nil, want error")
+	}
+	next := func(s *DiskStorage, name string) int64 {
+		t.Helper()
+		val, err := s.NextValue(name)
+		if err != nil {
+			t.Fatalf("NextValue(%s) error = %v", name, err)
+		}
+		return val
+	}
+	next(diskStorage, "items_id_seq")
+	if err := diskStorage.AdvanceSequence("items_id_seq", 7); err != nil {
+		t.Fatalf("AdvanceSequence() error = %v", err)
+	}
+	if err := diskStorage.AdvanceSequence("items_id_seq", 3); err != nil {
+		t.Fatalf("AdvanceSequence() error = %v", err)
+	}
+	if got := next(diskStorage, "countdown"); got != 10 {
+		t.Errorf("first value of countdown = %d, want 10", got)
+	}
+	if err := diskStorage.DropSequence("dropped"); err != nil {
+		t.Fatalf("DropSequence() error = %v", err)
+	}
+
+	// The counters survive a restart
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+
+	if got := next(reopenedStorage, "items_id_seq"); got != 8 {
+		t.Errorf("NextValue(items_id_seq) after restart = %d, want 8", got)
+	}
+	if got := next(reopenedStorage, "countdown"); got != 5 {
+		t.Errorf("NextValue(countdown) after restart = %d, want 5", got)
+	}
+	if _, err := reopenedStorage.NextValue("dropped"); err == nil {
+		t.Errorf("NextValue() of a dropped sequence error = nil, want error")
+	}
+
+	stored := reopenedStorage.tables["items"].Schema
+	id, _ := stored.GetColumn("id")
+	if seq, ok := catalog.AutoIncrementSequence(id); !ok || seq != "items_id_seq" {
+		t.Errorf("sequence of stored id column = %q, %v, want items_id_seq", seq, ok)
+	}
+	qty, _ := stored.GetColumn("qty")
+	if def, ok := qty.Default().(parser.LiteralExpression); !ok || fmt.Sprint(def.Value()) != "3" {
+		t.Errorf("stored default of qty = %v, want 3", qty.Default())
+	}
+}
+
+func TestDiskStorage_CheckConstraints(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	stmt, err := parser.NewParser().Parse(`CREATE TABLE items (id INT, line INT, qty INT CHECK (qty > 0), CONSTRAINT items_key PRIMARY KEY (id, line),
+		CONSTRAINT items_self FOREIGN KEY (id, line) REFERENCES items ON DELETE CASCADE)`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	create := stmt.(parser.CreateTableStatement)
+	cat := catalog.NewCatalog()
+	if err := cat.CreateTable("items", create.Columns(), create.Constraints()...); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	schema, _ := cat.GetTable("items")
+	if err := diskStorage.CreateTable("items", schema); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	row := func(id, line, qty int64) map[string]parser.Value {
+		return map[string]parser.Value{
+			"id":   &mockValue{dataType: types.TypeInt, intVal: id},
+			"line": &mockValue{dataType: types.TypeInt, intVal: line},
+			"qty":  &mockValue{dataType: types.TypeInt, intVal: qty},
+		}
+	}
+	if err := diskStorage.Insert("items", row(1, 1, 5)); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	// The constraints and the condition of the CHECK survive a restart
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+	reopenedStorage, err := NewDiskStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+
+	var constraintErr *storage.ConstraintError
+	err = reopenedStorage.Insert("items", row(2, 1, 0))
+	if !errors.As(err, &constraintErr) || constraintErr.Constraint != "items_qty_check" {
+		t.Errorf("Insert() of a failing row error = %v, want a violation of items_qty_check", err)
+	}
+	err = reopenedStorage.Insert("items", row(1, 1, 3))
+	if !errors.As(err, &constraintErr) || constraintErr.Constraint != "items_key" {
+		t.Errorf("Insert() of a duplicate key error = %v, want a violation of items_key", err)
+	}
+	_, err = reopenedStorage.Update("items", map[string]parser.Value{"qty": &mockValue{dataType: types.TypeInt, intVal: -1}},
+		func(storage.Row) (bool, error) { return true, nil })
+	if !errors.As(err, &constraintErr) || constraintErr.Constraint != "items_qty_check" {
+		t.Errorf("Update() to a failing row error = %v, want a violation of items_qty_check", err)
+	}
+	if err := reopenedStorage.Insert("items", row(1, 2, 3)); err != nil {
+		t.Errorf("Insert() error = %v", err)
+	}
+	if got := catalog.PrimaryKey(reopenedStorage.tables["items"].Schema); !slices.Equal(got, []string{"id", "line"}) {
+		t.Errorf("stored primary key = %v, want [id line]", got)
+	}
+	fks := catalog.ForeignKeys(reopenedStorage.tables["items"].Schema)
+	if len(fks) != 1 || fks[0].RefTable != "items" || !slices.Equal(fks[0].RefColumns, []string{"id", "line"}) ||
+		fks[0].OnDelete != types.ActionCascade {
+		t.Errorf("stored foreign keys = %v", fks)
+	}
+}
+
+func TestDiskStorage_UserFunctions(t *testing.T) {
+	tempDir, diskStorage := setupTestDB(t)
+	defer cleanupTestDB(tempDir)
+
+	functions := parser.NewFunctionRegistry()
+	err := functions.Register(&parser.ScalarFunction{
+		Name:       "double",
+		Signatures: []parser.Signature{{Args: []types.DataType{types.TypeInt}, Returns: types.TypeInt}},
+		Eval: func(args []parser.Value) (parser.Value, error) {
+			n, err := args[0].AsInt()
+			return parser.NewIntValue(2 * n), err
+		},
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	stmt, err := parser.NewParserWithFunctions(functions).Parse(
+		"CREATE TABLE items (id INT PRIMARY KEY, qty INT CHECK (double(qty) < 100))")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	create := stmt.(parser.CreateTableStatement)
+	cat := catalog.NewCatalog()
+	if err := cat.CreateTable("items", create.Columns(), create.Constraints()...); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	schema, _ := cat.GetTable("items")
+	if err := diskStorage.CreateTable("items", schema); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := diskStorage.Close(); err != nil {
+		t.Fatalf("Failed to close storage: %v", err)
+	}
+
+	// The stored CHECK calls a function only the registry knows
+	if _, err := NewDiskStorage(tempDir); err == nil {
+		t.Errorf("NewDiskStorage() without the function error = nil, want error")
+	}
+	reopenedStorage, err := NewDiskStorageWithFunctions(tempDir, functions)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopenedStorage.Close()
+
+	var constraintErr *storage.ConstraintError
+	err = reopenedStorage.Insert("items", map[string]parser.Value{
+		"id":  &mockValue{dataType: types.TypeInt, intVal: 1},
+		"qty": &mockValue{dataType: types.TypeInt, intVal: 60},
+	})
+	if !errors.As(err, &constraintErr) || constraintErr.Constraint != "items_qty_check" {
+		t.Errorf("Insert() of a failing row error = %v, want a violation of items_qty_check", err)
+	}
+}
@@ -24,14 +24,72 @@ type Storage interface {
 
 	// Select selects rows from a table that match a condition
 	Select(tableName string, columns []string, condition FilterFunc) (RowIterator, error)
+
+	// AlterTable brings a table and its rows in line with schema, the
+	// table's schema after change. Indexes follow the columns they cover.
+	AlterTable(tableName string, schema catalog.TableSchema, change catalog.SchemaChange) error
+
+	// CreateIndex builds an index over the rows already in a table
+	CreateIndex(tableName string, index catalog.Index) error
+
+	// DropIndex removes an index from a table
+	DropIndex(tableName string, indexName string) error
+
+	// SelectPath is Select reading only the rows reached through path
+	SelectPath(tableName string, columns []string, path AccessPath, condition FilterFunc) (RowIterator, error)
+
+	// UpdatePath is Update considering only the rows reached through path,
+	// setting in each row the values that set gives for it
+	UpdatePath(tableName string, set SetFunc, path AccessPath, condition FilterFunc) (int, error)
+
+	// DeletePath is Delete considering only the rows reached through path
+	DeletePath(tableName string, path AccessPath, condition FilterFunc) (int, error)
+
+	// CreateSequence creates a sequence
+	CreateSequence(seq Sequence) error
+
+	// DropSequence removes a sequence
+	DropSequence(name string) error
+
+	// NextValue advances a sequence and returns its new value
+	NextValue(name string) (int64, error)
+
+	// AdvanceSequence moves a sequence up to a value that was used without
+	// it, such as one given for an AUTOINCREMENT column
+	AdvanceSequence(name string, value int64) error
+}
+
+// PageCounter is implemented by storage engines that read their data in pages
+type PageCounter interface {
+	// PagesRead returns the number of pages read since the storage was opened
+	PagesRead() uint64
+}
+
+// StatsRecorder is implemented by storage engines that persist ANALYZE statistics
+type StatsRecorder interface {
+	// SetTableStats records the statistics of a table
+	SetTableStats(tableName string, stats catalog.TableStats) error
 }
 
 // Row represents a row in a table
 type Row map[string]parser.Value
 
+// RowIDColumn is the pseudo-column that holds the ID of a row
+const RowIDColumn = "#rowid"
+
 // FilterFunc is a function that filters rows
 type FilterFunc func(row Row) (bool, error)
 
+// SetFunc gives the values an update sets in a row, by column name
+type SetFunc func(row Row) (map[string]parser.Value, error)
+
+// SetValues returns the SetFunc that sets the same values in every row
+func SetValues(values map[string]parser.Value) SetFunc {
+	return func(Row) (map[string]parser.Value, error) {
+		return values, nil
+	}
+}
+
 // RowIterator iterates over rows returned by a query
 type RowIterator interface {
 	// Next advances to the next row
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// Type tags written in front of every key component. NULL sorts first.
+const (
+	keyTagNull   byte = 0x01
+	keyTagBool   byte = 0x02
+	keyTagInt    byte = 0x03
+	keyTagFloat  byte = 0x04
+	keyTagString byte = 0x05
+
+	keyTagDate        byte = 0x06
+	keyTagTime        byte = 0x07
+	keyTagTimestamp   byte = 0x08
+	keyTagTimestampTZ byte = 0x09
+	keyTagInterval    byte = 0x0A
+	keyTagDecimal     byte = 0x0B
+	keyTagBlob        byte = 0x0C
+	keyTagJSON        byte = 0x0D
+)
+
+// EncodeKey encodes a tuple of values into a byte string that sorts like the tuple
+func EncodeKey(values []parser.Value) []byte {
+	var buf []byte
+	for _, val := range values {
+		buf = appendKeyValue(buf, val)
+	}
+	return buf
+}
+
+// appendKeyValue appends the order-preserving encoding of one value
+func appendKeyValue(buf []byte, val parser.Value) []byte {
+	if val == nil {
+		return append(buf, keyTagNull)
+	}
+
+	switch val.Type() {
+	case types.TypeBool:
+		b, _ := val.AsBool()
+		if b {
+			return append(buf, keyTagBool, 1)
+		}
+		return append(buf, keyTagBool, 0)
+
+	case types.TypeInt:
+		i, _ := val.AsInt()
+		return appendKeyInt(append(buf, keyTagInt), i)
+
+	case types.TypeDate, types.TypeTime, types.TypeTimestamp, types.TypeTimestampTZ:
+		// Temporal values sort by their counts of days or microseconds
+		i, _ := val.AsInt()
+		return appendKeyInt(append(buf, temporalKeyTags[val.Type()]), i)
+
+	case types.TypeInterval:
+		var length int64
+		if iv, ok := val.(*parser.IntervalValue); ok {
+			length = iv.Interval().Length()
+		}
+		return appendKeyInt(append(buf, keyTagInterval), length)
+
+	case types.TypeFloat:
+		f, _ := val.AsFloat()
+		bits := math.Float64bits(f)
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		buf = append(buf, keyTagFloat)
+		return binary.BigEndian.AppendUint64(buf, bits)
+
+	case types.TypeDecimal:
+		d, _ := val.AsDecimal()
+		return appendKeyDecimal(append(buf, keyTagDecimal), d)
+
+	case types.TypeString:
+		// Text is keyed by its collation, so 'a' and 'A' have one key in a
+		// NOCASE column
+		s, _ := val.AsString()
+		s = parser.CollationOf(val).Key(s)
+		return appendKeyBytes(append(buf, keyTagString), []byte(s))
+
+	case types.TypeBlob:
+		b, _ := val.AsBytes()
+		return appendKeyBytes(append(buf, keyTagBlob), b)
+
+	case types.TypeJSON:
+		// Documents sort by their canonical text
+		s, _ := val.AsString()
+		return appendKeyBytes(append(buf, keyTagJSON), []byte(s))
+
+	default:
+		return append(buf, keyTagNull)
+	}
+}
+
+// temporalKeyTags are the tags of the temporal types
+var temporalKeyTags = map[types.DataType]byte{
+	types.TypeDate:        keyTagDate,
+	types.TypeTime:        keyTagTime,
+	types.TypeTimestamp:   keyTagTimestamp,
+	types.TypeTimestampTZ: keyTagTimestampTZ,
+}
+
+// appendKeyBytes appends a string of bytes, escaping 0x00
+func appendKeyBytes(buf []byte, b []byte) []byte {
+	for _, c := range b {
+		if c == 0x00 {
+			buf = append(buf, 0x00, 0xFF)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return append(buf, 0x00, 0x01)
+}
+
+// appendKeyInt appends an int64 so that the bytes sort like the numbers
+func appendKeyInt(buf []byte, i int64) []byte {
+	return binary.BigEndian.AppendUint64(buf, uint64(i)^(1<<63))
+}
+
+// appendKeyDecimal appends a DECIMAL so that the bytes sort like the numbers
+func appendKeyDecimal(buf []byte, d parser.Decimal) []byte {
+	sign := d.Sign()
+	buf = append(buf, byte(sign+2))
+	if sign == 0 {
+		return buf
+	}
+
+	digits := new(big.Int).Abs(d.Unscaled()).Text(10)
+	exponent := int64(len(digits) - d.Scale())
+	digits = strings.TrimRight(digits, "0")
+	if sign < 0 {
+		buf = appendKeyInt(buf, -exponent)
+		for i := 0; i < len(digits); i++ {
+			buf = append(buf, '0'+'9'-digits[i])
+		}
+		return append(buf, 0xFF)
+	}
+	buf = appendKeyInt(buf, exponent)
+	return append(append(buf, digits...), 0x00)
+}
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
@@ -11,18 +13,52 @@ import (
 
 // MemoryStorage is an in-memory implementation of Storage
 type MemoryStorage struct {
-	// map[tableName][]Row
-	tables map[string][]Row
-	mu     sync.RWMutex
-	// Keep track of schemas for validation
-	schemas map[string]catalog.TableSchema
+	tables    map[string]*memoryTable
+	sequences map[string]*Sequence
+	mu        sync.RWMutex
+}
+
+// memoryTable holds the rows of a table in insertion order, with its schema and indexes
+type memoryTable struct {
+	schema  catalog.TableSchema
+	rows    []*memoryRow
+	indexes []*memoryIndex
+	nextID  int64
+}
+
+// memoryRow is a stored row. Indexes and scans refer to rows by pointer.
+type memoryRow struct {
+	id     int64
+	values Row
+}
+
+// withID returns a copy of the row's values that holds its ID as well
+func (row *memoryRow) withID() Row {
+	values := make(Row, len(row.values)+1)
+	for colName, val := range row.values {
+		values[colName] = val
+	}
+	values[RowIDColumn] = parser.NewIntValue(row.id)
+	return values
+}
+
+// memoryIndex keeps the rows of a table sorted by their encoded index key
+type memoryIndex struct {
+	def     catalog.Index
+	entries []memoryIndexEntry
+}
+
+// memoryIndexEntry points from an encoded key to a row
+type memoryIndexEntry struct {
+	key []byte
+	row *memoryRow
 }
 
 // NewMemoryStorage creates a new memory storage
 func NewMemoryStorage() Storage {
 	return &MemoryStorage{
-		tables:  make(map[string][]Row),
-		schemas: make(map[string]catalog.TableSchema),
+		tables:    make(map[string]*memoryTable),
+		sequences: make(map[string]*Sequence),
 	}
 }
 
@@ -35,9 +71,16 @@ func (s *MemoryStorage) CreateTable(tableName string, schema catalog.TableSchema
 		return fmt.Errorf("table '%s' already exists in storage", tableName)
 	}
 
-	s.tables[tableName] = []Row{}
-	s.schemas[tableName] = schema
+	table := &memoryTable{
+		schema: schema,
+	}
 
+	// PRIMARY KEY and UNIQUE constraints are enforced through their indexes
+	for _, def := range catalog.KeyIndexes(schema) {
+		table.indexes = append(table.indexes, &memoryIndex{def: def})
+	}
+
+	s.tables[tableName] = table
 	return nil
 }
 
@@ -51,7 +94,6 @@ func (s *MemoryStorage) DropTable(tableName string) error {
 	}
 
 	delete(s.tables, tableName)
-	delete(s.schemas, tableName)
 
 	return nil
 }
@@ -61,168 +103,231 @@ func (s *MemoryStorage) Insert(tableName string, values map[string]parser.Value)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	rows, exists := s.tables[tableName]
+	table, exists := s.tables[tableName]
 	if !exists {
 		return fmt.Errorf("table '%s' does not exist", tableName)
 	}
 
-	schema, exists := s.schemas[tableName]
-	if !exists {
-		return fmt.Errorf("schema for table '%s' not found", tableName)
+	values, err := CoerceRow(table.schema, values)
+	if err != nil {
+		return err
 	}
 
-	// Validate values against schema
-	for _, col := range schema.Columns() {
-		colName := col.Name()
-		val, exists := values[colName]
-
-		// Check for NOT NULL constraint
-		for _, constraint := range col.Constraints() {
-			if constraint == types.ConstraintNotNull {
-				if !exists || val == nil {
-					return fmt.Errorf("column '%s' cannot be NULL", colName)
-				}
+	if err := CheckRow(table.schema, values); err != nil {
+		return err
+	}
 
-				isNull, _ := val.AsNull()
-				if isNull {
-					return fmt.Errorf("column '%s' cannot be NULL", colName)
-				}
-			}
+	// Check PRIMARY KEY and UNIQUE constraints with an index lookup
+	for _, index := range table.indexes {
+		if !index.def.Unique {
+			continue
 		}
-
-		// Check data type if value exists
-		if exists && val != nil {
-			isNull, _ := val.AsNull()
-			if !isNull && val.Type() != col.Type() {
-				return fmt.Errorf("type mismatch for column '%s'", colName)
-			}
+		keyValues, hasNull, err := UniqueKey(index.def, values)
+		if err != nil {
+			return err
+		}
+		if !hasNull && index.contains(EncodeKey(keyValues)) {
+			return NewUniqueViolation(tableName, index.def, keyValues)
 		}
 	}
 
 	// Add the row
-	s.tables[tableName] = append(rows, values)
+	table.nextID++
+	row := &memoryRow{id: table.nextID, values: values}
+	table.rows = append(table.rows, row)
+	for _, index := range table.indexes {
+		index.add(row)
+	}
 	return nil
 }
 
 // Update updates rows in a table that match a condition
 func (s *MemoryStorage) Update(tableName string, values map[string]parser.Value, condition FilterFunc) (int, error) {
+	return s.UpdatePath(tableName, SetValues(values), AccessPath{}, condition)
+}
+
+// UpdatePath updates the rows reached through path that match a condition
+func (s *MemoryStorage) UpdatePath(tableName string, set SetFunc, path AccessPath, condition FilterFunc) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	rows, exists := s.tables[tableName]
+	table, exists := s.tables[tableName]
 	if !exists {
 		return 0, fmt.Errorf("table '%s' does not exist", tableName)
 	}
 
-	schema, exists := s.schemas[tableName]
-	if !exists {
-		return 0, fmt.Errorf("schema for table '%s' not found", tableName)
+	// Find the matching rows and their new values before changing any of
+	// them
+	candidates, err := table.candidates(path)
+	if err != nil {
+		return 0, err
 	}
-
-	// Validate values against schema
-	for colName, val := range values {
-		col, exists := schema.GetColumn(colName)
-		if !exists {
-			return 0, fmt.Errorf("column '%s' does not exist", colName)
+	matched := make(map[*memoryRow]Row)
+	for _, row := range candidates {
+		withID := row.withID()
+		match, err := condition(withID)
+		if err != nil {
+			return 0, err
 		}
-
-		isNull, _ := val.AsNull()
-		if !isNull && val.Type() != col.Type() {
-			return 0, fmt.Errorf("type mismatch for column '%s'", colName)
+		if !match {
+			continue
 		}
-
-		// Check NOT NULL constraint
-		for _, constraint := range col.Constraints() {
-			if constraint == types.ConstraintNotNull && isNull {
-				return 0, fmt.Errorf("column '%s' cannot be NULL", colName)
-			}
+		values, err := set(withID)
+		if err != nil {
+			return 0, err
 		}
-	}
-
-	count := 0
-	for i := range rows {
-		match, err := condition(rows[i])
+		values, err = CoerceValues(table.schema, values)
 		if err != nil {
-			return count, err
+			return 0, err
+		}
+		newValues := mergeRow(row.values, values)
+		if err := CheckRow(table.schema, newValues); err != nil {
+			return 0, err
 		}
+		matched[row] = newValues
+	}
 
-		if match {
-			// Update values
-			for colName, val := range values {
-				rows[i][colName] = val
+	if len(matched) == 0 {
+		return 0, nil
+	}
+
+	// Make sure the table still satisfies its unique indexes afterwards
+	checker := NewIndexUniqueChecker(tableName, table.indexDefs())
+	if !checker.Empty() {
+		for _, row := range table.rows {
+			newValues, ok := matched[row]
+			if !ok {
+				newValues = row.values
+			}
+			if err := checker.Add(newValues); err != nil {
+				return 0, err
 			}
-			count++
 		}
 	}
 
-	return count, nil
+	for row, newValues := range matched {
+		row.values = newValues
+	}
+
+	// Keys of the changed rows may have moved
+	for _, index := range table.indexes {
+		index.rebuild(table.rows)
+	}
+
+	return len(matched), nil
+}
+
+// mergeRow returns a copy of row with values applied on top of it
+func mergeRow(row Row, values map[string]parser.Value) Row {
+	merged := make(Row, len(row)+len(values))
+	for colName, val := range row {
+		merged[colName] = val
+	}
+	for colName, val := range values {
+		merged[colName] = val
+	}
+	return merged
 }
 
 // Delete deletes rows from a table that match a condition
 func (s *MemoryStorage) Delete(tableName string, condition FilterFunc) (int, error) {
+	return s.DeletePath(tableName, AccessPath{}, condition)
+}
+
+// DeletePath deletes the rows reached through path that match a condition
+func (s *MemoryStorage) DeletePath(tableName string, path AccessPath, condition FilterFunc) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	rows, exists := s.tables[tableName]
+	table, exists := s.tables[tableName]
 	if !exists {
 		return 0, fmt.Errorf("table '%s' does not exist", tableName)
 	}
 
-	newRows := make([]Row, 0, len(rows))
-	deleted := 0
+	candidates, err := table.candidates(path)
+	if err != nil {
+		return 0, err
+	}
 
-	for _, row := range rows {
-		match, err := condition(row)
+	deleted := make(map[*memoryRow]bool)
+	for _, row := range candidates {
+		match, err := condition(row.withID())
 		if err != nil {
-			return deleted, err
+			return 0, err
 		}
-
 		if match {
-			deleted++
-		} else {
+			deleted[row] = true
+		}
+	}
+
+	if len(deleted) == 0 {
+		return 0, nil
+	}
+
+	newRows := make([]*memoryRow, 0, len(table.rows)-len(deleted))
+	for _, row := range table.rows {
+		if !deleted[row] {
 			newRows = append(newRows, row)
 		}
 	}
+	table.rows = newRows
 
-	s.tables[tableName] = newRows
-	return deleted, nil
+	for _, index := range table.indexes {
+		index.remove(deleted)
+	}
+
+	return len(deleted), nil
 }
 
 // Select selects rows from a table that match a condition
 func (s *MemoryStorage) Select(tableName string, columns []string, condition FilterFunc) (RowIterator, error) {
+	return s.SelectPath(tableName, columns, AccessPath{}, condition)
+}
+
+// SelectPath selects the rows reached through path that match a condition
+func (s *MemoryStorage) SelectPath(tableName string, columns []string, path AccessPath, condition FilterFunc) (RowIterator, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	rows, exists := s.tables[tableName]
+	table, exists := s.tables[tableName]
 	if !exists {
 		return nil, fmt.Errorf("table '%s' does not exist", tableName)
 	}
-
-	schema, exists := s.schemas[tableName]
-	if !exists {
-		return nil, fmt.Errorf("schema for table '%s' not found", tableName)
-	}
-
-	// Validate columns
-	if len(columns) > 0 && columns[0] != "*" {
-		for _, colName := range columns {
-			if !schema.HasColumn(colName) {
-				return nil, fmt.Errorf("column '%s' does not exist in table '%s'", colName, tableName)
+	schema := table.schema
+
+	// Validate columns, expanding * to all of them
+	selected := make([]string, 0, len(columns))
+	withID := false
+	for _, colName := range columns {
+		switch {
+		case colName == "*":
+			for _, col := range schema.Columns() {
+				selected = append(selected, col.Name())
 			}
+		case colName == RowIDColumn:
+			withID = true
+			selected = append(selected, colName)
+		case schema.HasColumn(colName):
+			selected = append(selected, colName)
+		default:
+			return nil, fmt.Errorf("column '%s' does not exist in table '%s'", colName, tableName)
 		}
-	} else if len(columns) == 1 && columns[0] == "*" {
-		// Select all columns
-		allCols := schema.Columns()
-		columns = make([]string, len(allCols))
-		for i, col := range allCols {
-			columns[i] = col.Name()
-		}
+	}
+	columns = selected
+
+	rows, err := table.candidates(path)
+	if err != nil {
+		return nil, err
 	}
 
 	// Filter rows
 	filteredRows := make([]Row, 0, len(rows))
 	for _, row := range rows {
-		match, err := condition(row)
+		values := row.values
+		if withID {
+			values = row.withID()
+		}
+		match, err := condition(values)
 		if err != nil {
 			return nil, err
 		}
@@ -232,11 +337,11 @@ func (s *MemoryStorage) Select(tableName string, columns []string, condition Fil
 			if len(columns) > 0 {
 				selectRow := make(Row)
 				for _, colName := range columns {
-					selectRow[colName] = row[colName]
+					selectRow[colName] = values[colName]
 				}
 				filteredRows = append(filteredRows, selectRow)
 			} else {
-				filteredRows = append(filteredRows, row)
+				filteredRows = append(filteredRows, row.values)
 			}
 		}
 	}
@@ -246,6 +351,250 @@ func (s *MemoryStorage) Select(tableName string, columns []string, condition Fil
 	}, nil
 }
 
+// AlterTable changes the schema of a table, rewriting its rows
+func (s *MemoryStorage) AlterTable(tableName string, schema catalog.TableSchema, change catalog.SchemaChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table, exists := s.tables[tableName]
+	if !exists {
+		return fmt.Errorf("table '%s' does not exist", tableName)
+	}
+	if _, exists := s.tables[schema.Name()]; exists && schema.Name() != tableName {
+		return fmt.Errorf("table '%s' already exists in storage", schema.Name())
+	}
+
+	if change.Action == types.AlterAddColumn {
+		var err error
+		if change.Column, err = CoerceDefault(change.Column); err != nil {
+			return err
+		}
+	}
+
+	altered := &memoryTable{schema: schema, nextID: table.nextID}
+	for _, row := range table.rows {
+		values := AlterRow(row.values, change)
+		if err := CheckRow(schema, values); err != nil {
+			return err
+		}
+		altered.rows = append(altered.rows, &memoryRow{id: row.id, values: values})
+	}
+
+	// Constraint indexes come from the new schema, the others follow their
+	// columns
+	defs := catalog.KeyIndexes(schema)
+	for _, index := range table.indexes {
+		if index.def.Constraint {
+			continue
+		}
+		def, ok := change.RenameIndex(index.def)
+		if !ok {
+			continue
+		}
+		def.Table = schema.Name()
+		defs = append(defs, def)
+	}
+
+	// A new UNIQUE column must not give rows the same default
+	checker := NewIndexUniqueChecker(schema.Name(), defs)
+	if !checker.Empty() {
+		for _, row := range altered.rows {
+			if err := checker.Add(row.values); err != nil {
+				return err
+			}
+		}
+	}
+	for _, def := range defs {
+		index := &memoryIndex{def: def}
+		index.rebuild(altered.rows)
+		altered.indexes = append(altered.indexes, index)
+	}
+
+	delete(s.tables, tableName)
+	s.tables[schema.Name()] = altered
+	return nil
+}
+
+// AlterRow returns a copy of a row changed to fit a table's schema after an ALTER TABLE
+func AlterRow(row Row, change catalog.SchemaChange) Row {
+	altered := make(Row, len(row)+1)
+	for colName, val := range row {
+		altered[colName] = val
+	}
+
+	switch change.Action {
+	case types.AlterAddColumn:
+		var val parser.Value = parser.NewNullValue()
+		if lit, ok := change.Column.Default().(parser.LiteralExpression); ok {
+			val = parser.Collate(lit.Value(), change.Column.Collation())
+		}
+		altered[change.Column.Name()] = val
+	case types.AlterDropColumn:
+		delete(altered, change.ColumnName)
+	case types.AlterRenameColumn:
+		if val, ok := altered[change.ColumnName]; ok {
+			delete(altered, change.ColumnName)
+			altered[change.NewName] = val
+		}
+	}
+	return altered
+}
+
+// CreateIndex builds an index over the rows already in a table
+func (s *MemoryStorage) CreateIndex(tableName string, index catalog.Index) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table, exists := s.tables[tableName]
+	if !exists {
+		return fmt.Errorf("table '%s' does not exist", tableName)
+	}
+
+	if table.index(index.Name) != nil {
+		return fmt.Errorf("index '%s' already exists on table '%s'", index.Name, tableName)
+	}
+
+	// Existing rows must already satisfy a unique index
+	if index.Unique {
+		checker := NewIndexUniqueChecker(tableName, []catalog.Index{index})
+		for _, row := range table.rows {
+			if err := checker.Add(row.values); err != nil {
+				return err
+			}
+		}
+	}
+
+	memIndex := &memoryIndex{def: index}
+	memIndex.rebuild(table.rows)
+	table.indexes = append(table.indexes, memIndex)
+	return nil
+}
+
+// DropIndex removes an index from a table
+func (s *MemoryStorage) DropIndex(tableName string, indexName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table, exists := s.tables[tableName]
+	if !exists {
+		return fmt.Errorf("table '%s' does not exist", tableName)
+	}
+
+	for i, index := range table.indexes {
+		if index.def.Name == indexName {
+			if index.def.Constraint {
+				return fmt.Errorf("index '%s' backs a constraint and cannot be dropped", indexName)
+			}
+			table.indexes = append(table.indexes[:i], table.indexes[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("index '%s' does not exist on table '%s'", indexName, tableName)
+}
+
+// indexDefs returns the definitions of the table's indexes
+func (t *memoryTable) indexDefs() []catalog.Index {
+	defs := make([]catalog.Index, len(t.indexes))
+	for i, index := range t.indexes {
+		defs[i] = index.def
+	}
+	return defs
+}
+
+// index finds an index by name
+func (t *memoryTable) index(name string) *memoryIndex {
+	for _, index := range t.indexes {
+		if index.def.Name == name {
+			return index
+		}
+	}
+	return nil
+}
+
+// candidates returns the rows reached through an access path
+func (t *memoryTable) candidates(path AccessPath) ([]*memoryRow, error) {
+	if path.IsFullScan() {
+		return t.rows, nil
+	}
+
+	index := t.index(path.Index)
+	if index == nil {
+		return nil, fmt.Errorf("index '%s' does not exist on table '%s'", path.Index, t.schema.Name())
+	}
+
+	var rows []*memoryRow
+	seen := make(map[*memoryRow]bool)
+	for _, keyRange := range path.Ranges {
+		bounds := keyRange.Bounds()
+		for _, entry := range index.entries[index.search(bounds.Start()):] {
+			cmp := bounds.Compare(entry.key)
+			if cmp > 0 {
+				break
+			}
+			if cmp == 0 && !seen[entry.row] {
+				seen[entry.row] = true
+				rows = append(rows, entry.row)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// keyOf encodes the index key of a row
+func (i *memoryIndex) keyOf(row *memoryRow) []byte {
+	return EncodeKey(i.def.KeyValues(row.values))
+}
+
+// search returns the position of the first entry with a key >= key
+func (i *memoryIndex) search(key []byte) int {
+	if key == nil {
+		return 0
+	}
+	return sort.Search(len(i.entries), func(j int) bool {
+		return bytes.Compare(i.entries[j].key, key) >= 0
+	})
+}
+
+// contains reports whether any row has exactly the given key
+func (i *memoryIndex) contains(key []byte) bool {
+	pos := i.search(key)
+	return pos < len(i.entries) && bytes.Equal(i.entries[pos].key, key)
+}
+
+// add inserts a row into the index, after any entries with an equal key
+func (i *memoryIndex) add(row *memoryRow) {
+	key := i.keyOf(row)
+	pos := sort.Search(len(i.entries), func(j int) bool {
+		return bytes.Compare(i.entries[j].key, key) > 0
+	})
+	i.entries = append(i.entries, memoryIndexEntry{})
+	copy(i.entries[pos+1:], i.entries[pos:])
+	i.entries[pos] = memoryIndexEntry{key: key, row: row}
+}
+
+// remove drops the entries of the given rows
+func (i *memoryIndex) remove(rows map[*memoryRow]bool) {
+	kept := i.entries[:0]
+	for _, entry := range i.entries {
+		if !rows[entry.row] {
+			kept = append(kept, entry)
+		}
+	}
+	i.entries = kept
+}
+
+// rebuild recreates the index from the given rows
+func (i *memoryIndex) rebuild(rows []*memoryRow) {
+	i.entries = make([]memoryIndexEntry, len(rows))
+	for j, row := range rows {
+		i.entries[j] = memoryIndexEntry{key: i.keyOf(row), row: row}
+	}
+	sort.SliceStable(i.entries, func(a, b int) bool {
+		return bytes.Compare(i.entries[a].key, i.entries[b].key) < 0
+	})
+}
+
 // memoryRowIterator is an implementation of RowIterator
 type memoryRowIterator struct {
 	rows  []Row
@@ -279,3 +628,52 @@ func (i *memoryRowIterator) Err() error {
 func (i *memoryRowIterator) Close() {
 	// Nothing to close for in-memory iterator
 }
+
+// CreateSequence creates a sequence
+func (s *MemoryStorage) CreateSequence(seq Sequence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sequences[seq.Name]; exists {
+		return fmt.Errorf("sequence '%s' already exists", seq.Name)
+	}
+	s.sequences[seq.Name] = &seq
+	return nil
+}
+
+// DropSequence removes a sequence
+func (s *MemoryStorage) DropSequence(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sequences[name]; !exists {
+		return fmt.Errorf("sequence '%s' not found", name)
+	}
+	delete(s.sequences, name)
+	return nil
+}
+
+// NextValue advances a sequence and returns its new value
+func (s *MemoryStorage) NextValue(name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq, exists := s.sequences[name]
+	if !exists {
+		return 0, fmt.Errorf("sequence '%s' not found", name)
+	}
+	return seq.Next()
+}
+
+// AdvanceSequence moves a sequence up to a value that was used without it
+func (s *MemoryStorage) AdvanceSequence(name string, value int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq, exists := s.sequences[name]
+	if !exists {
+		return fmt.Errorf("sequence '%s' not found", name)
+	}
+	seq.Advance(value)
+	return nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import "fmt"
+
+// Sequence is a counter for nextval() and AUTOINCREMENT columns
+type Sequence struct {
+	Name string
+
+	// Start is the first value, and Increment what each next value adds
+	Start     int64
+	Increment int64
+
+	// Value is the last value handed out; Called is false until the first one has been
+	Value  int64
+	Called bool
+}
+
+// Next advances the sequence and returns its new value
+func (s *Sequence) Next() (int64, error) {
+	if !s.Called {
+		s.Value, s.Called = s.Start, true
+		return s.Value, nil
+	}
+
+	next := s.Value + s.Increment
+	if (s.Increment > 0 && next < s.Value) || (s.Increment < 0 && next > s.Value) {
+		return 0, fmt.Errorf("sequence '%s' has run out of values", s.Name)
+	}
+	s.Value = next
+	return next, nil
+}
+
+// Advance moves the sequence up to a value used without it, reporting whether it changed
+func (s *Sequence) Advance(value int64) bool {
+	last, past := s.Value, s.Called
+	if !past {
+		// Values before the start are never handed out
+		last = s.Start - s.Increment
+	}
+	if (s.Increment > 0 && value <= last) || (s.Increment < 0 && value >= last) {
+		return false
+	}
+	s.Value, s.Called = value, true
+	return true
+}
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"testing"
 
+	"github.com/zhangbiao2009/simple-sql-db/pkg/catalog"
 	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
 	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
 )
@@ -40,6 +44,17 @@ func (v *mockValue) AsNull() (bool, error) {
 	return v.dataType == types.TypeNull, nil
 }
 
+func (v *mockValue) AsDecimal() (parser.Decimal, error) {
+	if v.dataType == types.TypeFloat {
+		return parser.NewFloatValue(v.floatVal).AsDecimal()
+	}
+	return parser.NewDecimal(v.intVal, 0), nil
+}
+
+func (v *mockValue) AsBytes() ([]byte, error) {
+	return []byte(v.stringVal), nil
+}
+
 // Mock implementation of catalog.TableSchema for testing
 type mockTableSchema struct {
 	name    string
@@ -76,10 +91,23 @@ func (s *mockTableSchema) GetColumnType(name string) types.DataType {
 	return col.Type()
 }
 
+func (s *mockTableSchema) Constraints() []parser.TableConstraint {
+	return nil
+}
+
+func (s *mockTableSchema) Stats() (catalog.TableStats, bool) {
+	return catalog.TableStats{}, false
+}
+
+func (s *mockTableSchema) Version() int {
+	return 0
+}
+
 // Mock implementation of parser.ColumnDefinition for testing
 type mockColumnDefinition struct {
 	name        string
 	dataType    types.DataType
+	typeParams  []int
 	constraints []types.Constraint
 }
 
@@ -95,6 +123,22 @@ func (c *mockColumnDefinition) Constraints() []types.Constraint {
 	return c.constraints
 }
 
+func (c *mockColumnDefinition) TypeParams() []int {
+	return c.typeParams
+}
+
+func (c *mockColumnDefinition) TypeName() string {
+	return parser.TypeName(c.dataType, c.typeParams)
+}
+
+func (c *mockColumnDefinition) Collation() parser.Collation {
+	return parser.CollateBinary
+}
+
+func (c *mockColumnDefinition) Default() parser.Expression {
+	return nil
+}
+
 func TestMemoryStorage(t *testing.T) {
 	// Create a new storage instance
 	storage := NewMemoryStorage()
@@ -291,3 +335,472 @@ func TestMemoryStorage(t *testing.T) {
 		t.Errorf("DropTable() with non-existent table should error")
 	}
 }
+
+func TestMemoryStorage_UniqueConstraints(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{
+			name:        "id",
+			dataType:    types.TypeInt,
+			constraints: []types.Constraint{types.ConstraintPrimaryKey},
+		},
+		&mockColumnDefinition{
+			name:        "email",
+			dataType:    types.TypeString,
+			constraints: []types.Constraint{types.ConstraintUnique},
+		},
+	}
+	schema := &mockTableSchema{name: "users", columns: columns}
+
+	err := storage.CreateTable("users", schema)
+	if err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	newRow := func(id int64, email string) map[string]parser.Value {
+		row := map[string]parser.Value{
+			"id": &mockValue{dataType: types.TypeInt, intVal: id},
+		}
+		if email == "" {
+			row["email"] = &mockValue{dataType: types.TypeNull}
+		} else {
+			row["email"] = &mockValue{dataType: types.TypeString, stringVal: email}
+		}
+		return row
+	}
+
+	if err := storage.Insert("users", newRow(1, "a@example.com")); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if err := storage.Insert("users", newRow(2, "b@example.com")); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	// Duplicate primary key
+	err = storage.Insert("users", newRow(1, "c@example.com"))
+	constraintErr, ok := err.(*ConstraintError)
+	if !ok {
+		t.Fatalf("Insert() with duplicate primary key error = %v, want *ConstraintError", err)
+	}
+	if constraintErr.Constraint != "users_pkey" || constraintErr.Type != types.ConstraintPrimaryKey {
+		t.Errorf("ConstraintError = %s (%v), want users_pkey", constraintErr.Constraint, constraintErr.Type)
+	}
+
+	// Duplicate unique value
+	err = storage.Insert("users", newRow(3, "a@example.com"))
+	constraintErr, ok = err.(*ConstraintError)
+	if !ok {
+		t.Fatalf("Insert() with duplicate unique value error = %v, want *ConstraintError", err)
+	}
+	if constraintErr.Constraint != "users_email_key" {
+		t.Errorf("ConstraintError.Constraint = %s, want users_email_key", constraintErr.Constraint)
+	}
+
+	// NULL primary key
+	err = storage.Insert("users", map[string]parser.Value{
+		"id":    &mockValue{dataType: types.TypeNull},
+		"email": &mockValue{dataType: types.TypeString, stringVal: "d@example.com"},
+	})
+	if err == nil {
+		t.Errorf("Insert() with NULL primary key should error")
+	}
+
+	// Several NULLs in a unique column do not conflict
+	if err := storage.Insert("users", newRow(4, "")); err != nil {
+		t.Errorf("Insert() with NULL unique value error = %v", err)
+	}
+	if err := storage.Insert("users", newRow(5, "")); err != nil {
+		t.Errorf("Insert() with second NULL unique value error = %v", err)
+	}
+
+	// Update that would duplicate a unique value is rejected and changes nothing
+	_, err = storage.Update("users", map[string]parser.Value{
+		"email": &mockValue{dataType: types.TypeString, stringVal: "a@example.com"},
+	}, func(row Row) (bool, error) {
+		id, _ := row["id"].AsInt()
+		return id == 2, nil
+	})
+	if _, ok := err.(*ConstraintError); !ok {
+		t.Errorf("Update() creating duplicate error = %v, want *ConstraintError", err)
+	}
+
+	// Update that gives several rows the same primary key is rejected
+	_, err = storage.Update("users", map[string]parser.Value{
+		"id": &mockValue{dataType: types.TypeInt, intVal: 10},
+	}, func(row Row) (bool, error) {
+		return true, nil
+	})
+	if _, ok := err.(*ConstraintError); !ok {
+		t.Errorf("Update() of every primary key error = %v, want *ConstraintError", err)
+	}
+
+	rows, _ := storage.Select("users", []string{"id", "email"}, func(row Row) (bool, error) {
+		id, _ := row["id"].AsInt()
+		return id == 2, nil
+	})
+	if !rows.Next() {
+		t.Fatalf("Row 2 missing after rejected updates")
+	}
+	email, _ := rows.Row()["email"].AsString()
+	if email != "b@example.com" {
+		t.Errorf("email after rejected update = %s, want b@example.com", email)
+	}
+	rows.Close()
+
+	// Update that keeps keys unique succeeds
+	count, err := storage.Update("users", map[string]parser.Value{
+		"email": &mockValue{dataType: types.TypeString, stringVal: "new@example.com"},
+	}, func(row Row) (bool, error) {
+		id, _ := row["id"].AsInt()
+		return id == 2, nil
+	})
+	if err != nil || count != 1 {
+		t.Errorf("Update() = %d, %v, want 1, nil", count, err)
+	}
+}
+
+func TestMemoryStorage_IndexPaths(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	columns := []parser.ColumnDefinition{
+		&mockColumnDefinition{
+			name:        "id",
+			dataType:    types.TypeInt,
+			constraints: []types.Constraint{types.ConstraintPrimaryKey},
+		},
+		&mockColumnDefinition{name: "city", dataType: types.TypeString},
+	}
+	schema := &mockTableSchema{name: "users", columns: columns}
+	if err := storage.CreateTable("users", schema); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+
+	cities := []string{"Oslo", "Bergen", "Oslo", "Tromso", "Bergen"}
+	for i, city := range cities {
+		err := storage.Insert("users", map[string]parser.Value{
+			"id":   &mockValue{dataType: types.TypeInt, intVal: int64(i + 1)},
+			"city": &mockValue{dataType: types.TypeString, stringVal: city},
+		})
+		if err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	cityIndex := catalog.Index{Name: "users_city", Table: "users", Columns: []string{"city"}}
+	if err := storage.CreateIndex("users", cityIndex); err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+
+	intKey := func(i int64) []parser.Value {
+		return []parser.Value{&mockValue{dataType: types.TypeInt, intVal: i}}
+	}
+	strKey := func(s string) []parser.Value {
+		return []parser.Value{&mockValue{dataType: types.TypeString, stringVal: s}}
+	}
+	all := func(row Row) (bool, error) { return true, nil }
+
+	collectIDs := func(path AccessPath) []int64 {
+		iter, err := storage.SelectPath("users", []string{"*"}, path, all)
+		if err != nil {
+			t.Fatalf("SelectPath() error = %v", err)
+		}
+		defer iter.Close()
+
+		var ids []int64
+		for iter.Next() {
+			id, _ := iter.Row()["id"].AsInt()
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name string
+		path AccessPath
+		want []int64
+	}{
+		{
+			name: "Point lookup on primary key",
+			path: AccessPath{Index: "users_pkey", Ranges: []KeyRange{PointRange(intKey(3))}},
+			want: []int64{3},
+		},
+		{
+			name: "Range scan on primary key",
+			path: AccessPath{Index: "users_pkey", Ranges: []KeyRange{{Low: intKey(2), LowInclusive: false, High: intKey(4), HighInclusive: true}}},
+			want: []int64{3, 4},
+		},
+		{
+			name: "Open-ended range",
+			path: AccessPath{Index: "users_pkey", Ranges: []KeyRange{{Low: intKey(4), LowInclusive: true}}},
+			want: []int64{4, 5},
+		},
+		{
+			name: "Secondary index lookup",
+			path: AccessPath{Index: "users_city", Ranges: []KeyRange{PointRange(strKey("Bergen"))}},
+			want: []int64{2, 5},
+		},
+		{
+			name: "Overlapping ranges return rows once",
+			path: AccessPath{Index: "users_pkey", Ranges: []KeyRange{PointRange(intKey(1)), PointRange(intKey(1))}},
+			want: []int64{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectIDs(tt.path)
+			if len(got) != len(tt.want) {
+				t.Fatalf("SelectPath() ids = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("SelectPath() ids = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// Updates and deletes through an index keep the index current
+	path := AccessPath{Index: "users_city", Ranges: []KeyRange{PointRange(strKey("Oslo"))}}
+	updated, err := storage.UpdatePath("users", SetValues(map[string]parser.Value{
+		"city": &mockValue{dataType: types.TypeString, stringVal: "Bergen"},
+	}), path, all)
+	if err != nil || updated != 2 {
+		t.Fatalf("UpdatePath() = %d, %v, want 2 rows", updated, err)
+	}
+	bergen := AccessPath{Index: "users_city", Ranges: []KeyRange{PointRange(strKey("Bergen"))}}
+	if got := collectIDs(bergen); len(got) != 4 {
+		t.Errorf("rows in Bergen after update = %v, want 4 rows", got)
+	}
+
+	deleted, err := storage.DeletePath("users", bergen, func(row Row) (bool, error) {
+		id, _ := row["id"].AsInt()
+		return id > 2, nil
+	})
+	if err != nil || deleted != 2 {
+		t.Fatalf("DeletePath() = %d, %v, want 2 rows", deleted, err)
+	}
+	if got := collectIDs(bergen); len(got) != 2 {
+		t.Errorf("rows in Bergen after delete = %v, want 2 rows", got)
+	}
+
+	// A unique index cannot be built over duplicate values
+	err = storage.CreateIndex("users", catalog.Index{Name: "users_city_key", Table: "users", Columns: []string{"city"}, Unique: true})
+	if _, ok := err.(*ConstraintError); !ok {
+		t.Errorf("CreateIndex() over duplicates error = %v, want *ConstraintError", err)
+	}
+
+	if err := storage.DropIndex("users", "users_pkey"); err == nil {
+		t.Errorf("DropIndex() on primary key error = nil, want error")
+	}
+	if err := storage.DropIndex("users", "users_city"); err != nil {
+		t.Errorf("DropIndex() error = %v", err)
+	}
+	if _, err := storage.SelectPath("users", nil, bergen, all); err == nil {
+		t.Errorf("SelectPath() through dropped index error = nil, want error")
+	}
+}
+
+func TestCoerceRow(t *testing.T) {
+	schema := &mockTableSchema{
+		name: "prices",
+		columns: []parser.ColumnDefinition{
+			&mockColumnDefinition{name: "qty", dataType: types.TypeInt},
+			&mockColumnDefinition{name: "price", dataType: types.TypeFloat, constraints: []types.Constraint{types.ConstraintNotNull}},
+		},
+	}
+	intValue := func(i int64) parser.Value { return &mockValue{dataType: types.TypeInt, intVal: i} }
+	floatValue := func(f float64) parser.Value { return &mockValue{dataType: types.TypeFloat, floatVal: f} }
+
+	// An INT widens to a FLOAT, and a whole FLOAT narrows to an INT
+	row, err := CoerceRow(schema, Row{"qty": floatValue(3), "price": intValue(2)})
+	if err != nil {
+		t.Fatalf("CoerceRow() error = %v", err)
+	}
+	if row["qty"].Type() != types.TypeInt || row["price"].Type() != types.TypeFloat {
+		t.Errorf("CoerceRow() types = %v %v, want INT FLOAT", row["qty"].Type(), row["price"].Type())
+	}
+	if f, _ := row["price"].AsFloat(); f != 2 {
+		t.Errorf("CoerceRow() price = %v, want 2", f)
+	}
+
+	invalid := []Row{
+		{"qty": floatValue(2.5), "price": floatValue(1)},
+		{"price": intValue(1<<53 + 1)},
+		{"price": &mockValue{dataType: types.TypeString, stringVal: "1.5"}},
+		{"qty": intValue(1)},
+		{"price": &mockValue{dataType: types.TypeNull}},
+	}
+	for _, r := range invalid {
+		if _, err := CoerceRow(schema, r); err == nil {
+			t.Errorf("CoerceRow(%v) error = nil, want error", r)
+		}
+	}
+
+	values, err := CoerceValues(schema, map[string]parser.Value{"price": intValue(4)})
+	if err != nil || values["price"].Type() != types.TypeFloat {
+		t.Errorf("CoerceValues() = %v, %v", values, err)
+	}
+	if _, err := CoerceValues(schema, map[string]parser.Value{"missing": intValue(1)}); err == nil {
+		t.Errorf("CoerceValues() of a missing column error = nil")
+	}
+
+	// Memory storage stores the converted values
+	s := NewMemoryStorage()
+	if err := s.CreateTable("prices", schema); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := s.Insert("prices", map[string]parser.Value{"qty": intValue(1), "price": intValue(5)}); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if _, err := s.Update("prices", map[string]parser.Value{"qty": floatValue(1.5)}, func(Row) (bool, error) { return true, nil }); err == nil {
+		t.Errorf("Update() with a lossy value error = nil")
+	}
+	iter, err := s.Select("prices", []string{"*"}, func(Row) (bool, error) { return true, nil })
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	defer iter.Close()
+	if !iter.Next() || iter.Row()["price"].Type() != types.TypeFloat {
+		t.Errorf("stored price is not a FLOAT")
+	}
+}
+
+func TestDecimalKeys(t *testing.T) {
+	decimal := func(s string) parser.Value {
+		d, err := parser.ParseDecimal(s)
+		if err != nil {
+			t.Fatalf("ParseDecimal(%q) error = %v", s, err)
+		}
+		return parser.NewDecimalValue(d)
+	}
+
+	// The keys sort in the order of the numbers
+	ordered := []string{"-1000", "-10.5", "-10", "-0.123", "-0.12", "0", "0.0001", "0.12", "0.123", "1", "9.99", "10", "123456789012345678901234567890"}
+	for i := 1; i < len(ordered); i++ {
+		a, b := EncodeKey([]parser.Value{decimal(ordered[i-1])}), EncodeKey([]parser.Value{decimal(ordered[i])})
+		if string(a) >= string(b) {
+			t.Errorf("key of %s does not sort before key of %s", ordered[i-1], ordered[i])
+		}
+	}
+
+	// Equal numbers have equal keys whatever their scale
+	if string(EncodeKey([]parser.Value{decimal("1.5")})) != string(EncodeKey([]parser.Value{decimal("1.500")})) {
+		t.Errorf("keys of 1.5 and 1.500 differ")
+	}
+
+	schema := &mockTableSchema{
+		name:    "prices",
+		columns: []parser.ColumnDefinition{&mockColumnDefinition{name: "price", dataType: types.TypeDecimal, typeParams: []int{5, 2}}},
+	}
+	row, err := CoerceRow(schema, Row{"price": &mockValue{dataType: types.TypeInt, intVal: 7}})
+	if err != nil {
+		t.Fatalf("CoerceRow() error = %v", err)
+	}
+	if s, _ := row["price"].AsString(); row["price"].Type() != types.TypeDecimal || s != "7.00" {
+		t.Errorf("CoerceRow() price = %v, want DECIMAL '7.00'", row["price"])
+	}
+	for _, price := range []parser.Value{decimal("1.005"), decimal("1000"), &mockValue{dataType: types.TypeFloat, floatVal: 2.345}} {
+		if _, err := CoerceRow(schema, Row{"price": price}); err == nil {
+			t.Errorf("CoerceRow(%v) error = nil, want error", price)
+		}
+	}
+}
+
+func TestBlobKeysAndStreaming(t *testing.T) {
+	// Keys of BLOBs sort byte by byte, shorter prefixes first, even with zero
+	// bytes inside
+	ordered := [][]byte{{}, {0}, {0, 0}, {0, 1}, {1}, {1, 0, 0xff}, {0xff}}
+	for i := 1; i < len(ordered); i++ {
+		a := EncodeKey([]parser.Value{parser.NewBlobValue(ordered[i-1])})
+		b := EncodeKey([]parser.Value{parser.NewBlobValue(ordered[i])})
+		if bytes.Compare(a, b) >= 0 {
+			t.Errorf("key of %x does not sort before key of %x", ordered[i-1], ordered[i])
+		}
+	}
+
+	s := NewMemoryStorage()
+	schema := &mockTableSchema{
+		name: "files",
+		columns: []parser.ColumnDefinition{
+			&mockColumnDefinition{name: "id", dataType: types.TypeInt, constraints: []types.Constraint{types.ConstraintPrimaryKey}},
+			&mockColumnDefinition{name: "data", dataType: types.TypeBlob},
+			&mockColumnDefinition{name: "thumb", dataType: types.TypeBlob},
+		},
+	}
+	if err := s.CreateTable("files", schema); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := s.CreateIndex("files", catalog.Index{Name: "files_thumb", Table: "files", Columns: []string{"thumb"}}); err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+	row := Row{"id": parser.NewIntValue(1), "data": parser.NewBlobValue([]byte{1, 2}), "thumb": parser.NewBlobValue(nil)}
+	if err := s.Insert("files", row); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	blobs := s.(BlobStorage)
+	data := bytes.Repeat([]byte{0, 1, 2, 0xff}, 1000)
+	n, err := blobs.WriteBlob("files", "data", []parser.Value{parser.NewIntValue(1)}, bytes.NewReader(data))
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("WriteBlob() = %d, %v, want %d", n, err, len(data))
+	}
+	r, err := blobs.OpenBlob("files", "data", []parser.Value{parser.NewIntValue(1)})
+	if err != nil {
+		t.Fatalf("OpenBlob() error = %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || r.Size() != int64(len(data)) || !bytes.Equal(got, data) {
+		t.Errorf("OpenBlob() read %d bytes, size %d, error %v, want %d bytes", len(got), r.Size(), err, len(data))
+	}
+
+	for _, tt := range []struct {
+		column string
+		key    []parser.Value
+	}{
+		{"thumb", []parser.Value{parser.NewIntValue(1)}},
+		{"id", []parser.Value{parser.NewIntValue(1)}},
+		{"missing", []parser.Value{parser.NewIntValue(1)}},
+		{"data", []parser.Value{parser.NewIntValue(2)}},
+		{"data", []parser.Value{parser.NewIntValue(1), parser.NewIntValue(2)}},
+	} {
+		if _, err := blobs.WriteBlob("files", tt.column, tt.key, bytes.NewReader(nil)); err == nil {
+			t.Errorf("WriteBlob(%s, %v) error = nil", tt.column, tt.key)
+		}
+	}
+}
+
+func TestEncodeValue(t *testing.T) {
+	decimal, _ := parser.ParseDecimal("12345678901234567890.25")
+	doc, _ := parser.ParseJSON(`{"a": [1, 2]}`)
+	date, _ := parser.Cast(parser.NewStringValue("2026-10-18"), types.TypeDate)
+	interval, _ := parser.Cast(parser.NewStringValue("1 month 2 days 3 seconds"), types.TypeInterval)
+	values := []parser.Value{
+		parser.NewIntValue(-7),
+		parser.NewFloatValue(2.5),
+		parser.NewStringValue("text"),
+		parser.Collate(parser.NewStringValue("Text"), parser.CollateNoCase),
+		parser.NewBoolValue(true),
+		parser.NewDecimalValue(decimal),
+		parser.NewBlobValue([]byte{0, 0xFF}),
+		doc,
+		date,
+		interval,
+		parser.NewNullValue(),
+	}
+
+	// Every value comes back with its type, value and collation
+	for _, val := range values {
+		ev, err := EncodeValue(val)
+		if err != nil {
+			t.Errorf("EncodeValue(%v) error = %v", val, err)
+			continue
+		}
+		got := ev.Value()
+		if got.Type() != val.Type() || fmt.Sprint(got) != fmt.Sprint(val) || parser.CollationOf(got) != parser.CollationOf(val) {
+			t.Errorf("EncodeValue(%v).Value() = %v %v", val, got.Type(), got)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/zhangbiao2009/simple-sql-db/pkg/parser"
+	"github.com/zhangbiao2009/simple-sql-db/pkg/types"
+)
+
+// EncodedValue is the JSON form of a single value
+type EncodedValue struct {
+	Type   types.DataType `json:"t"`
+	Int    int64          `json:"i,omitempty"`
+	Float  float64        `json:"f,omitempty"`
+	String string         `json:"s,omitempty"`
+	Bool   bool           `json:"b,omitempty"`
+
+	// Collation is that of text that compares other than byte by byte
+	Collation parser.Collation `json:"c,omitempty"`
+
+	// The months and days of an INTERVAL, whose microseconds are in Int
+	Months int64 `json:"mo,omitempty"`
+	Days   int64 `json:"d,omitempty"`
+
+	// Bytes holds a BLOB
+	Bytes []byte `json:"x,omitempty"`
+}
+
+// EncodeValue converts a value to its JSON form
+func EncodeValue(val parser.Value) (EncodedValue, error) {
+	ev := EncodedValue{Type: types.TypeNull}
+	if val != nil {
+		ev.Type = val.Type()
+	}
+
+	var err error
+	switch ev.Type {
+	case types.TypeInt:
+		ev.Int, err = val.AsInt()
+	case types.TypeFloat:
+		ev.Float, err = val.AsFloat()
+	case types.TypeString, types.TypeDecimal, types.TypeJSON:
+		// A DECIMAL is kept as its text, which keeps all its digits, and a
+		// JSON document as its canonical text
+		ev.String, err = val.AsString()
+		ev.Collation = parser.CollationOf(val)
+	case types.TypeBool:
+		ev.Bool, err = val.AsBool()
+	case types.TypeDate, types.TypeTime, types.TypeTimestamp, types.TypeTimestampTZ:
+		ev.Int, err = val.AsInt()
+	case types.TypeInterval:
+		iv, ok := val.(*parser.IntervalValue)
+		if !ok {
+			return ev, fmt.Errorf("cannot encode %v as an INTERVAL", val)
+		}
+		ev.Months, ev.Days, ev.Int = iv.Interval().Months, iv.Interval().Days, iv.Interval().Micros
+	case types.TypeBlob:
+		ev.Bytes, err = val.AsBytes()
+	}
+	return ev, err
+}
+
+// Value converts a value back from its JSON form
+func (ev EncodedValue) Value() parser.Value {
+	switch ev.Type {
+	case types.TypeInt:
+		return parser.NewIntValue(ev.Int)
+	case types.TypeFloat:
+		return parser.NewFloatValue(ev.Float)
+	case types.TypeString:
+		return parser.Collate(parser.NewStringValue(ev.String), ev.Collation)
+	case types.TypeDecimal:
+		if d, err := parser.ParseDecimal(ev.String); err == nil {
+			return parser.NewDecimalValue(d)
+		}
+	case types.TypeJSON:
+		if doc, err := parser.ParseJSON(ev.String); err == nil {
+			return doc
+		}
+	case types.TypeBool:
+		return parser.NewBoolValue(ev.Bool)
+	case types.TypeDate, types.TypeTime, types.TypeTimestamp, types.TypeTimestampTZ:
+		return parser.NewTemporalValue(ev.Type, ev.Int)
+	case types.TypeInterval:
+		return parser.NewIntervalValue(parser.Interval{Months: ev.Months, Days: ev.Days, Micros: ev.Int})
+	case types.TypeBlob:
+		return parser.NewBlobValue(ev.Bytes)
+	}
+	return parser.NewNullValue()
+}
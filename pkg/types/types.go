@@ -9,8 +9,51 @@ const (
 	TypeFloat
 	TypeString
 	TypeBool
+	TypeDate
+	TypeTime
+	TypeTimestamp
+	TypeTimestampTZ
+	TypeInterval
+	TypeDecimal
+	TypeBlob
+	TypeJSON
 )
 
+func (t DataType) String() string {
+	switch t {
+	case TypeInt:
+		return "INT"
+	case TypeFloat:
+		return "FLOAT"
+	case TypeString:
+		return "TEXT"
+	case TypeBool:
+		return "BOOL"
+	case TypeDate:
+		return "DATE"
+	case TypeTime:
+		return "TIME"
+	case TypeTimestamp:
+		return "TIMESTAMP"
+	case TypeTimestampTZ:
+		return "TIMESTAMPTZ"
+	case TypeInterval:
+		return "INTERVAL"
+	case TypeDecimal:
+		return "DECIMAL"
+	case TypeBlob:
+		return "BLOB"
+	case TypeJSON:
+		return "JSON"
+	}
+	return "NULL"
+}
+
+// IsTemporal reports whether a type is DATE, TIME, TIMESTAMP or TIMESTAMPTZ
+func (t DataType) IsTemporal() bool {
+	return t == TypeDate || t == TypeTime || t == TypeTimestamp || t == TypeTimestampTZ
+}
+
 // StatementType represents the type of SQL statement
 type StatementType int
 
@@ -21,6 +64,13 @@ const (
 	StmtUpdate
 	StmtDelete
 	StmtSelect
+	StmtCreateIndex
+	StmtDropIndex
+	StmtExplain
+	StmtAnalyze
+	StmtAlterTable
+	StmtCreateSequence
+	StmtDropSequence
 )
 
 // ResultType represents the type of operation result
@@ -40,4 +90,38 @@ const (
 	ConstraintNotNull
 	ConstraintUnique
 	ConstraintPrimaryKey
+	ConstraintAutoIncrement
+	ConstraintCheck
+	ConstraintForeignKey
+)
+
+// ReferentialAction is what a FOREIGN KEY does when a referenced row is deleted or updated
+type ReferentialAction int
+
+const (
+	ActionNoAction ReferentialAction = iota
+	ActionRestrict
+	ActionCascade
+	ActionSetNull
+)
+
+// AlterAction represents the change an ALTER TABLE statement makes
+type AlterAction int
+
+const (
+	AlterAddColumn AlterAction = iota
+	AlterDropColumn
+	AlterRenameColumn
+	AlterRenameTable
+	AlterAddConstraint
+	AlterDropConstraint
+)
+
+// JoinType represents the kind of a join between two tables
+type JoinType int
+
+const (
+	JoinInner JoinType = iota
+	JoinLeft
+	JoinCross
 )